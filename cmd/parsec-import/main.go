@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"parsec/internal/importer"
+	"parsec/internal/logger"
+	"parsec/internal/objstore"
+)
+
+func main() {
+	source := flag.String("source", "", "archive location: a file, a directory or s3://bucket/prefix")
+	target := flag.String("target", "http://localhost:8080/ingest", "Parsec ingest URL")
+	format := flag.String("format", "auto", "archive format: auto, ndjson (optionally gzipped) or parquet")
+	batchSize := flag.Int("batch", 500, "events per ingest request")
+	rate := flag.Float64("rate", 0, "maximum events per second (0 = unlimited)")
+	checkpoint := flag.String("checkpoint", "parsec-import.checkpoint.json", "checkpoint file for resuming")
+	flag.Parse()
+
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	logger.Init(logLevel)
+
+	log := logger.Logger.With().Str("component", "main").Logger()
+	if *source == "" {
+		log.Fatal().Msg("-source is required")
+	}
+
+	store, prefix, err := objstore.Parse(*source, objstore.S3ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Str("source", *source).Msg("invalid source")
+	}
+
+	cp, err := importer.LoadCheckpoint(*checkpoint)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load checkpoint")
+	}
+
+	apiKey := os.Getenv("API_KEY")
+	if apiKey == "" {
+		apiKey = "test-api-key-123" // Same default as the ingest auth middleware
+	}
+
+	imp := importer.New(importer.Config{
+		Target:        *target,
+		APIKey:        apiKey,
+		SigningSecret: os.Getenv("SIGNING_SECRET"),
+		Format:        importer.Format(*format),
+		BatchSize:     *batchSize,
+		RatePerSecond: *rate,
+	}, cp)
+
+	// Stop between batches on SIGINT/SIGTERM; the checkpoint lets a rerun resume
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	stats, err := imp.Run(ctx, store, prefix)
+	event := log.Info()
+	if err != nil {
+		event = log.Error().Err(err)
+	}
+	event.
+		Int("files", stats.Files).
+		Int("skipped", stats.Skipped).
+		Int("records", stats.Records).
+		Int("accepted", stats.Accepted).
+		Int("rejected", stats.Rejected).
+		Int("dropped", stats.Dropped).
+		Msg("import finished")
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+)
+
+func main() {
+	brokers := flag.String("brokers", os.Getenv("KAFKA_BROKERS"), "comma-separated Kafka brokers (default $KAFKA_BROKERS)")
+	group := flag.String("group", "parsec-processor", "consumer group to reset")
+	topic := flag.String("topic", "logs", "topic to reset the group's offsets on")
+	to := flag.String("to", "", "reset to the earliest or latest offsets")
+	toDatetime := flag.String("to-datetime", "", "reset to the first offsets at or after an RFC 3339 time")
+	offsets := flag.String("offsets", "", "reset to per-partition offsets, e.g. 0=1200,3=980")
+	execute := flag.Bool("execute", false, "apply the reset; without it the plan is only printed")
+	flag.Parse()
+
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	logger.Init(logLevel)
+
+	log := logger.Logger.With().Str("component", "main").Logger()
+	if *brokers == "" {
+		log.Fatal().Msg("-brokers or KAFKA_BROKERS is required")
+	}
+
+	reset := kafka.OffsetReset{Topic: *topic, To: *to}
+	if *toDatetime != "" {
+		t, err := time.Parse(time.RFC3339, *toDatetime)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid -to-datetime")
+		}
+		reset.Timestamp = &t
+	}
+	if *offsets != "" {
+		parsed, err := parseOffsets(*offsets)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid -offsets")
+		}
+		reset.Offsets = parsed
+	}
+	if err := reset.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("choose one of -to, -to-datetime and -offsets")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	controls := kafka.NewGroupOffsets(kafka.BrokerClient(strings.Split(*brokers, ",")))
+	var moves []kafka.PartitionReset
+	var err error
+	if *execute {
+		moves, err = controls.Apply(ctx, *group, reset)
+	} else {
+		moves, err = controls.Plan(ctx, *group, reset)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("group", *group).Str("topic", *topic).Msg("offset reset failed")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(moves)
+	if *execute {
+		log.Info().Str("group", *group).Str("topic", *topic).Int("partitions", len(moves)).Msg("offsets reset")
+	} else {
+		log.Info().Msg("dry run: rerun with -execute to apply")
+	}
+}
+
+// parseOffsets parses partition=offset pairs separated by commas
+func parseOffsets(s string) (map[int]int64, error) {
+	result := make(map[int]int64)
+	for _, pair := range strings.Split(s, ",") {
+		partition, offset, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, strconv.ErrSyntax
+		}
+		p, err := strconv.Atoi(partition)
+		if err != nil {
+			return nil, err
+		}
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result[p] = o
+	}
+	return result, nil
+}
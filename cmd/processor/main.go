@@ -2,30 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"parsec/internal/config"
+	"parsec/internal/crash"
 	"parsec/internal/logger"
 	"parsec/internal/processor"
 )
 
 func main() {
-	// Initialize logger
-	logLevel := os.Getenv("LOG_LEVEL")
-	if logLevel == "" {
-		logLevel = "info"
+	// Load configuration from flags, environment and config file
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	logger.Init(logLevel)
+
+	// Initialize logger
+	logger.Init(cfg.LogLevel)
 
 	log := logger.Logger.With().Str("component", "main").Logger()
 	log.Info().Msg("Starting Parsec Log Processor")
 
-	// Load configuration from environment
-	cfg := config.FromEnv()
-
 	log.Info().
+		Str("profile", cfg.Profile).
 		Strs("kafka_brokers", cfg.Kafka.Brokers).
 		Str("kafka_topic", cfg.Kafka.Topic).
 		Int("worker_pool_size", cfg.Kafka.Producer.PoolSize).
@@ -45,6 +53,7 @@ func main() {
 	// Run processor in background
 	errChan := make(chan error, 1)
 	go func() {
+		defer crash.Recover("processor")
 		if err := p.Run(ctx); err != nil {
 			errChan <- err
 		}
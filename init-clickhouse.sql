@@ -13,17 +13,26 @@ CREATE TABLE IF NOT EXISTS events
     severity LowCardinality(String),
     source LowCardinality(String),
     message String,
+    -- metadata flattened to dotted keys ("http.status"); metadata_json keeps
+    -- nested objects and arrays (empty when there are none)
     metadata Map(String, String),
+    metadata_json String,
+    -- typed copies of metadata set by tenant field type rules; bools are 0/1
+    typed_metadata Map(String, Float64),
     trace_id String,
     span_id String,
     received_at DateTime64(3, 'UTC'),
     ingest_node LowCardinality(String),
     partition_key String,
+    -- the ingest request an event arrived in and its position there
+    batch_id String,
+    batch_index UInt32,
     
     -- Indexes
     INDEX idx_tenant_id tenant_id TYPE bloom_filter GRANULARITY 1,
     INDEX idx_source source TYPE bloom_filter GRANULARITY 1,
-    INDEX idx_severity severity TYPE set(0) GRANULARITY 1
+    INDEX idx_severity severity TYPE set(0) GRANULARITY 1,
+    INDEX idx_batch_id batch_id TYPE bloom_filter GRANULARITY 1
 )
 ENGINE = MergeTree()
 PARTITION BY toYYYYMM(timestamp)
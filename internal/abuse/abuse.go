@@ -0,0 +1,476 @@
+// Package abuse slows down and blocks sources of malformed or
+// unauthenticated traffic, such as broken agents retrying invalid payloads
+// in a loop. Failures are counted per API key and per client IP in sliding
+// windows in the StateStore. A source over the tarpit threshold has its
+// requests delayed; one over the block threshold is refused for a while on
+// every node.
+package abuse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/ratelimit"
+	"parsec/internal/state"
+)
+
+// BlocksKey is the StateStore key holding every blocked source, as a
+// versioned value (see state.Versioned)
+const BlocksKey = "parsec:abuse:blocks"
+
+// failuresPrefix namespaces the failure windows of sources
+const failuresPrefix = "parsec:abuse:failures:"
+
+// Kind classifies a failed request
+type Kind string
+
+const (
+	// KindValidation is a request refused as malformed or invalid
+	KindValidation Kind = "validation"
+
+	// KindAuth is a request refused for missing or wrong credentials
+	KindAuth Kind = "auth"
+)
+
+// Classify returns the kind of failure a response status is, if any
+func Classify(status int) (Kind, bool) {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return KindAuth, true
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge,
+		http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return KindValidation, true
+	}
+	return "", false
+}
+
+// Config holds abuse detection thresholds
+type Config struct {
+	// Window is the sliding window failures are counted over
+	Window time.Duration
+
+	// TarpitThreshold is the failures per window after which a source's
+	// requests are delayed by TarpitDelay (0 = never)
+	TarpitThreshold int
+	TarpitDelay     time.Duration
+
+	// BlockThreshold is the failures per window after which a source is
+	// refused for BlockDuration (0 = never)
+	BlockThreshold int
+	BlockDuration  time.Duration
+
+	// TrustedProxies are the load balancers and proxies in front of the
+	// nodes. Requests they forward are counted against the client IP in
+	// X-Forwarded-For rather than the proxy's own.
+	TrustedProxies []netip.Prefix
+}
+
+// ParseProxies parses trusted proxies given as CIDRs or single IPs
+func ParseProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Block is a source refused for a while
+type Block struct {
+	Source   string    `json:"source"`
+	Kind     Kind      `json:"kind"`
+	Failures int64     `json:"failures"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+// Tarpit is a source whose requests this node delays
+type Tarpit struct {
+	Source string    `json:"source"`
+	Until  time.Time `json:"until"`
+}
+
+// Detector counts failures per source and decides which to slow down or
+// refuse. It is safe for concurrent use.
+type Detector struct {
+	store state.StateStore
+	cfg   Config
+
+	// shared holds the blocks of every node, changed as versions so
+	// concurrent changes on other nodes are kept
+	shared *state.Versioned
+
+	// writing serializes block changes, which read and write the store
+	writing sync.Mutex
+
+	mu      sync.RWMutex
+	blocks  map[string]Block
+	tarpits map[string]time.Time
+}
+
+// NewDetector creates a detector, or returns nil if neither threshold is
+// set
+func NewDetector(store state.StateStore, cfg Config) *Detector {
+	if cfg.TarpitThreshold <= 0 && cfg.BlockThreshold <= 0 {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.TarpitDelay <= 0 {
+		cfg.TarpitDelay = 2 * time.Second
+	}
+	if cfg.BlockDuration <= 0 {
+		cfg.BlockDuration = 10 * time.Minute
+	}
+	d := &Detector{
+		store:   store,
+		cfg:     cfg,
+		blocks:  make(map[string]Block),
+		tarpits: make(map[string]time.Time),
+	}
+	if store != nil {
+		d.shared = state.NewVersioned(store, BlocksKey)
+	}
+	return d
+}
+
+// Sources returns the sources a request is counted under: its client IP
+// and, if it carries credentials, its API key or token
+func (d *Detector) Sources(r *http.Request) (ip, key string) {
+	ip = "ip-" + d.clientIP(r)
+	if caller := ratelimit.CallerID(r); caller != "anonymous" {
+		key = caller
+	}
+	return ip, key
+}
+
+// clientIP is the address a request came from. Behind trusted proxies it
+// is the last X-Forwarded-For hop not added by one of them: earlier hops
+// are whatever the client sent, so they can't be trusted.
+func (d *Detector) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(d.cfg.TrustedProxies) == 0 || !d.trusted(host) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// A malformed hop can't be attributed, so the request counts
+			// against the proxy that passed it on
+			return host
+		}
+		host = addr.Unmap().String()
+		if !d.trusted(host) {
+			return host
+		}
+	}
+	return host
+}
+
+// trusted reports whether an address is one of the trusted proxies
+func (d *Detector) trusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range d.cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns the block of the first blocked source, and the tarpit delay
+// to apply otherwise
+func (d *Detector) Check(sources ...string) (Block, bool, time.Duration) {
+	now := time.Now()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var delay time.Duration
+	for _, source := range sources {
+		if source == "" {
+			continue
+		}
+		if b, ok := d.blocks[source]; ok && now.Before(b.Until) {
+			return b, true, 0
+		}
+		if until, ok := d.tarpits[source]; ok && now.Before(until) {
+			delay = d.cfg.TarpitDelay
+		}
+	}
+	return Block{}, false, delay
+}
+
+// Record counts a failure against a source, tarpitting or blocking it once
+// it crosses a threshold
+func (d *Detector) Record(ctx context.Context, source string, kind Kind) error {
+	metrics.AbuseFailures.WithLabelValues(string(kind)).Inc()
+
+	now := time.Now()
+	n, err := d.store.WindowAdd(ctx, failuresPrefix+source, now, d.cfg.Window)
+	if err != nil {
+		return err
+	}
+
+	if d.cfg.BlockThreshold > 0 && n >= int64(d.cfg.BlockThreshold) {
+		if _, blocked, _ := d.Check(source); !blocked {
+			return d.block(ctx, Block{Source: source, Kind: kind, Failures: n, Since: now.UTC(), Until: now.Add(d.cfg.BlockDuration).UTC()})
+		}
+		return nil
+	}
+	if d.cfg.TarpitThreshold > 0 && n >= int64(d.cfg.TarpitThreshold) {
+		d.mu.Lock()
+		_, tarpitted := d.tarpits[source]
+		d.tarpits[source] = now.Add(d.cfg.Window)
+		d.mu.Unlock()
+
+		if !tarpitted {
+			log := logger.WithComponent("abuse")
+			log.Warn().
+				Str("source", source).
+				Str("kind", string(kind)).
+				Int64("failures", n).
+				Dur("delay", d.cfg.TarpitDelay).
+				Msg("tarpitting source of failing requests")
+		}
+	}
+	return nil
+}
+
+// block adds a block and saves it for every node
+func (d *Detector) block(ctx context.Context, b Block) error {
+	err := d.update(ctx, func(blocks map[string]Block) {
+		blocks[b.Source] = b
+	})
+	if err != nil {
+		return err
+	}
+
+	log := logger.WithComponent("abuse")
+	log.Warn().
+		Str("source", b.Source).
+		Str("kind", string(b.Kind)).
+		Int64("failures", b.Failures).
+		Time("until", b.Until).
+		Msg("blocking source of failing requests")
+	return nil
+}
+
+// Clear lifts a source's block and tarpit and forgets its failures,
+// reporting whether it was blocked or tarpitted
+func (d *Detector) Clear(ctx context.Context, source string) (bool, error) {
+	var existed bool
+	err := d.update(ctx, func(blocks map[string]Block) {
+		_, existed = blocks[source]
+		delete(blocks, source)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	if until, ok := d.tarpits[source]; ok && time.Now().Before(until) {
+		existed = true
+	}
+	delete(d.tarpits, source)
+	d.mu.Unlock()
+
+	// A zero TTL removes the window, as Redis' EXPIRE does
+	if _, err := d.store.Expire(ctx, failuresPrefix+source, 0); err != nil {
+		return existed, err
+	}
+	return existed, nil
+}
+
+// Blocks returns the blocks in force, sorted by source
+func (d *Detector) Blocks() []Block {
+	now := time.Now()
+
+	d.mu.RLock()
+	out := make([]Block, 0, len(d.blocks))
+	for _, b := range d.blocks {
+		if now.Before(b.Until) {
+			out = append(out, b)
+		}
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// Tarpits returns the sources this node delays, sorted by source
+func (d *Detector) Tarpits() []Tarpit {
+	now := time.Now()
+
+	d.mu.RLock()
+	out := make([]Tarpit, 0, len(d.tarpits))
+	for source, until := range d.tarpits {
+		if now.Before(until) {
+			out = append(out, Tarpit{Source: source, Until: until.UTC()})
+		}
+	}
+	d.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// update applies change to the latest blocks, dropping expired ones, and
+// saves them
+func (d *Detector) update(ctx context.Context, change func(map[string]Block)) error {
+	d.writing.Lock()
+	defer d.writing.Unlock()
+
+	apply := func(data []byte) (map[string]Block, error) {
+		current := make(map[string]Block)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse abuse blocks: %w", err)
+			}
+		} else {
+			d.mu.RLock()
+			for source, b := range d.blocks {
+				current[source] = b
+			}
+			d.mu.RUnlock()
+		}
+
+		now := time.Now()
+		for source, b := range current {
+			if !now.Before(b.Until) {
+				delete(current, source)
+			}
+		}
+		change(current)
+		return current, nil
+	}
+
+	if d.shared == nil {
+		blocks, err := apply(nil)
+		if err != nil {
+			return err
+		}
+		d.replace(blocks)
+		return nil
+	}
+
+	// Applied to the stored blocks, again if another node changed them
+	// meanwhile, so its change is kept
+	var blocks map[string]Block
+	err := d.shared.Update(ctx, func(data []byte) ([]byte, error) {
+		var err error
+		if blocks, err = apply(data); err != nil {
+			return nil, err
+		}
+		return json.Marshal(blocks)
+	})
+	if err != nil {
+		return err
+	}
+	d.replace(blocks)
+	return nil
+}
+
+// replace swaps in a new set of blocks, forgets expired tarpits and
+// updates the gauge
+func (d *Detector) replace(blocks map[string]Block) {
+	now := time.Now()
+	active := 0
+	for _, b := range blocks {
+		if now.Before(b.Until) {
+			active++
+		}
+	}
+
+	d.mu.Lock()
+	d.blocks = blocks
+	for source, until := range d.tarpits {
+		if !now.Before(until) {
+			delete(d.tarpits, source)
+		}
+	}
+	d.mu.Unlock()
+
+	metrics.AbuseBlockedSources.Set(float64(active))
+}
+
+// Load replaces the in-memory blocks with those in the store
+func (d *Detector) Load(ctx context.Context) error {
+	if d.shared == nil {
+		return nil
+	}
+
+	// Nothing stored keeps this node's blocks, as a store that keeps
+	// nothing would lift them
+	data, err := d.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	blocks := make(map[string]Block)
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return fmt.Errorf("parse abuse blocks: %w", err)
+	}
+	d.replace(blocks)
+	return nil
+}
+
+// Run reloads blocks periodically so blocks made on other nodes apply here
+// within interval
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("abuse")
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload abuse blocks")
+			}
+		}
+	}
+}
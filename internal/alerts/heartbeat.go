@@ -0,0 +1,434 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// HeartbeatsKey is the StateStore key holding all registered heartbeats, as
+// a versioned value (see state.Versioned)
+const HeartbeatsKey = "parsec:heartbeats"
+
+// Per-source keys: when an event last arrived, and whether an alert is open
+const (
+	seenPrefix  = "parsec:heartbeat:seen:"
+	alertPrefix = "parsec:heartbeat:alert:"
+)
+
+// HeartbeatSource is the source of heartbeat alert events
+const HeartbeatSource = "parsec-heartbeat"
+
+// Heartbeat alert statuses, recorded in the heartbeat_status metadata key
+const (
+	StatusMissing   = "missing"
+	StatusRecovered = "recovered"
+)
+
+// MinHeartbeatInterval bounds how tight an expectation may be; shorter
+// intervals would alert on ordinary batching delays
+const MinHeartbeatInterval = 10 * time.Second
+
+var (
+	ErrInvalidHeartbeat = errors.New("heartbeat requires a tenant and source")
+	ErrInvalidInterval  = fmt.Errorf("heartbeat interval must be a duration of at least %s", MinHeartbeatInterval)
+)
+
+// heartbeatNamespace derives alert event IDs from the source and the time
+// it went silent, so the alert for one outage has one ID
+var heartbeatNamespace = uuid.MustParse("3f6d2a8c-7e1b-4c5d-9a0f-8b2e4d6c1a97")
+
+// Heartbeat registers a source that is expected to send events at least
+// once per interval
+type Heartbeat struct {
+	TenantID string `json:"tenant_id"`
+	Source   string `json:"source"`
+	Interval string `json:"interval"`
+
+	interval time.Duration
+}
+
+// HeartbeatStatus is a heartbeat with the time its source was last seen
+type HeartbeatStatus struct {
+	Heartbeat
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Missing  bool       `json:"missing"`
+}
+
+// key identifies the heartbeat's source within the store keys
+func (h Heartbeat) key() string {
+	return h.TenantID + ":" + h.Source
+}
+
+// validate normalizes the source and parses the interval
+func (h *Heartbeat) validate() error {
+	h.Source = strings.ToLower(strings.TrimSpace(h.Source))
+	if h.TenantID == "" || h.Source == "" {
+		return ErrInvalidHeartbeat
+	}
+	interval, err := time.ParseDuration(h.Interval)
+	if err != nil || interval < MinHeartbeatInterval {
+		return ErrInvalidInterval
+	}
+	h.interval = interval
+	h.Interval = interval.String()
+	return nil
+}
+
+// HeartbeatMonitor is a dead-man's switch for registered sources. Ingest
+// records when each source was last seen; Run shares those times through
+// the StateStore and has the alert engine evaluate each source's silence
+// against its interval. A source that goes quiet raises one CRITICAL event
+// in its tenant, and a recovery event once it sends again, however many
+// nodes are running.
+type HeartbeatMonitor struct {
+	store  state.StateStore
+	shared *state.Versioned
+	engine AlertEngine
+
+	// writing serializes registrations, which read and write the store
+	writing sync.Mutex
+
+	mu         sync.RWMutex
+	heartbeats map[string]Heartbeat
+
+	seenMu sync.Mutex
+	seen   map[string]time.Time
+}
+
+// NewHeartbeatMonitor creates a monitor. Registrations are shared through
+// store, which should be Redis when running several nodes.
+func NewHeartbeatMonitor(store state.StateStore, engine AlertEngine) *HeartbeatMonitor {
+	return &HeartbeatMonitor{
+		store:      store,
+		shared:     state.NewVersioned(store, HeartbeatsKey),
+		engine:     engine,
+		heartbeats: make(map[string]Heartbeat),
+		seen:       make(map[string]time.Time),
+	}
+}
+
+// Observe records an event's arrival if its source has a heartbeat. It
+// is called for every ingested event, so it only touches memory.
+func (m *HeartbeatMonitor) Observe(event *models.LogEvent) {
+	if m == nil {
+		return
+	}
+	key := event.TenantID + ":" + event.Source
+
+	m.mu.RLock()
+	_, ok := m.heartbeats[key]
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	m.seenMu.Lock()
+	m.seen[key] = time.Now()
+	m.seenMu.Unlock()
+}
+
+// Register adds or updates a heartbeat. A new source is given one interval
+// from now before it is considered missing.
+func (m *HeartbeatMonitor) Register(ctx context.Context, h Heartbeat) (Heartbeat, error) {
+	if err := h.validate(); err != nil {
+		return Heartbeat{}, err
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := m.store.SetNX(ctx, seenPrefix+h.key(), []byte(now), 0); err != nil {
+		return Heartbeat{}, err
+	}
+
+	err := m.update(ctx, func(heartbeats map[string]Heartbeat) {
+		heartbeats[h.key()] = h
+	})
+	return h, err
+}
+
+// Unregister removes a heartbeat and its state, reporting whether it
+// existed
+func (m *HeartbeatMonitor) Unregister(ctx context.Context, tenantID, source string) (bool, error) {
+	key := tenantID + ":" + strings.ToLower(source)
+
+	var ok bool
+	err := m.update(ctx, func(heartbeats map[string]Heartbeat) {
+		_, ok = heartbeats[key]
+		delete(heartbeats, key)
+	})
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	m.seenMu.Lock()
+	delete(m.seen, key)
+	m.seenMu.Unlock()
+
+	for _, k := range []string{seenPrefix + key, alertPrefix + key} {
+		if _, err := m.store.Expire(ctx, k, 0); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Status returns a tenant's heartbeats, sorted by source, or every
+// tenant's, sorted by tenant and source, when tenantID is empty
+func (m *HeartbeatMonitor) Status(ctx context.Context, tenantID string) ([]HeartbeatStatus, error) {
+	var statuses []HeartbeatStatus
+	for _, h := range m.list() {
+		if tenantID != "" && h.TenantID != tenantID {
+			continue
+		}
+		status := HeartbeatStatus{Heartbeat: h}
+		last, err := m.lastSeen(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		if !last.IsZero() {
+			status.LastSeen = &last
+		}
+		open, err := m.store.Get(ctx, alertPrefix+h.key())
+		if err != nil {
+			return nil, err
+		}
+		status.Missing = open != nil
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Load replaces the in-memory heartbeats with those in the store
+func (m *HeartbeatMonitor) Load(ctx context.Context) error {
+	data, err := m.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the heartbeats registered here, as a store
+		// that keeps nothing would drop them
+		return err
+	}
+
+	heartbeats, err := parseHeartbeats(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.heartbeats = heartbeats
+	m.mu.Unlock()
+	return nil
+}
+
+// Run reloads heartbeats, publishes last-seen times and evaluates every
+// source each interval until ctx is cancelled. Alert events are passed to
+// emit.
+func (m *HeartbeatMonitor) Run(ctx context.Context, interval time.Duration, emit func(*models.LogEvent)) {
+	log := logger.WithComponent("heartbeat")
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(ctx, time.Now(), emit); err != nil {
+				log.Warn().Err(err).Msg("heartbeat check failed")
+			}
+		}
+	}
+}
+
+// Check runs one evaluation round at now
+func (m *HeartbeatMonitor) Check(ctx context.Context, now time.Time, emit func(*models.LogEvent)) error {
+	if err := m.Load(ctx); err != nil {
+		return err
+	}
+	if err := m.flush(ctx); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, h := range m.list() {
+		if err := m.evaluate(ctx, h, now, emit); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.key(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate raises or resolves the alert for one heartbeat
+func (m *HeartbeatMonitor) evaluate(ctx context.Context, h Heartbeat, now time.Time, emit func(*models.LogEvent)) error {
+	last, err := m.lastSeen(ctx, h)
+	if err != nil || last.IsZero() {
+		return err
+	}
+	silence := now.Sub(last)
+
+	firing, err := m.engine.Evaluate(ctx, Rule{Name: "heartbeat", Threshold: h.interval.Seconds()}, silence.Seconds())
+	if err != nil {
+		return err
+	}
+
+	alertKey := alertPrefix + h.key()
+	if firing {
+		// Only the first node to notice raises the alert
+		opened, err := m.store.SetNX(ctx, alertKey, []byte(strconv.FormatInt(last.UnixNano(), 10)), 0)
+		if err != nil || !opened {
+			return err
+		}
+		emit(alertEvent(h, StatusMissing, last, now,
+			fmt.Sprintf("no events from %s for %s (expected every %s)", h.Source, silence.Truncate(time.Second), h.Interval)))
+		return nil
+	}
+
+	// Only the node that closes the alert reports the recovery
+	closed, err := m.store.Expire(ctx, alertKey, 0)
+	if err != nil || !closed {
+		return err
+	}
+	emit(alertEvent(h, StatusRecovered, last, now, fmt.Sprintf("events from %s resumed", h.Source)))
+	return nil
+}
+
+// alertEvent builds an alert event in the heartbeat's tenant
+func alertEvent(h Heartbeat, status string, last, now time.Time, message string) *models.LogEvent {
+	severity := models.SeverityCritical
+	if status == StatusRecovered {
+		severity = models.SeverityInfo
+	}
+	id := h.key() + ":" + status + ":" + strconv.FormatInt(last.UnixNano(), 10)
+
+	metrics.HeartbeatAlerts.WithLabelValues(status).Inc()
+	return &models.LogEvent{
+		ID:        uuid.NewSHA1(heartbeatNamespace, []byte(id)).String(),
+		TenantID:  h.TenantID,
+		Timestamp: now.UTC(),
+		Severity:  severity,
+		Source:    HeartbeatSource,
+		Message:   message,
+		Metadata: models.Metadata{
+			"heartbeat_source":   h.Source,
+			"heartbeat_interval": h.Interval,
+			"heartbeat_status":   status,
+			"last_seen":          last.UTC().Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// flush publishes the last-seen times recorded since the previous round
+func (m *HeartbeatMonitor) flush(ctx context.Context) error {
+	m.seenMu.Lock()
+	seen := m.seen
+	m.seen = make(map[string]time.Time, len(seen))
+	m.seenMu.Unlock()
+
+	for key, at := range seen {
+		if err := m.store.Set(ctx, seenPrefix+key, []byte(strconv.FormatInt(at.UnixNano(), 10))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastSeen reads when the heartbeat's source was last seen by any node,
+// or this node's newer unflushed time
+func (m *HeartbeatMonitor) lastSeen(ctx context.Context, h Heartbeat) (time.Time, error) {
+	var last time.Time
+	data, err := m.store.Get(ctx, seenPrefix+h.key())
+	if err != nil {
+		return last, err
+	}
+	if nanos, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+		last = time.Unix(0, nanos)
+	}
+
+	m.seenMu.Lock()
+	if at, ok := m.seen[h.key()]; ok && at.After(last) {
+		last = at
+	}
+	m.seenMu.Unlock()
+	return last, nil
+}
+
+// list returns the heartbeats sorted by tenant and source
+func (m *HeartbeatMonitor) list() []Heartbeat {
+	m.mu.RLock()
+	list := make([]Heartbeat, 0, len(m.heartbeats))
+	for _, h := range m.heartbeats {
+		list = append(list, h)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+	return list
+}
+
+// parseHeartbeats parses the stored heartbeats, keyed by tenant and source
+func parseHeartbeats(data []byte) (map[string]Heartbeat, error) {
+	var list []Heartbeat
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse heartbeats: %w", err)
+	}
+	heartbeats := make(map[string]Heartbeat, len(list))
+	for _, h := range list {
+		if h.validate() == nil {
+			heartbeats[h.key()] = h
+		}
+	}
+	return heartbeats, nil
+}
+
+// update applies change to the stored heartbeats, again if another node
+// changed them meanwhile so its change is kept, then swaps them in. With
+// nothing stored, change applies to the heartbeats registered here.
+func (m *HeartbeatMonitor) update(ctx context.Context, change func(map[string]Heartbeat)) error {
+	m.writing.Lock()
+	defer m.writing.Unlock()
+
+	var heartbeats map[string]Heartbeat
+	err := m.shared.Update(ctx, func(data []byte) ([]byte, error) {
+		if len(data) > 0 {
+			var err error
+			if heartbeats, err = parseHeartbeats(data); err != nil {
+				return nil, err
+			}
+		} else {
+			heartbeats = make(map[string]Heartbeat)
+			for _, h := range m.list() {
+				heartbeats[h.key()] = h
+			}
+		}
+		change(heartbeats)
+
+		list := make([]Heartbeat, 0, len(heartbeats))
+		for _, h := range heartbeats {
+			list = append(list, h)
+		}
+		return json.Marshal(list)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.heartbeats = heartbeats
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,452 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/logger"
+	"parsec/internal/logql"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// SearchesKey is the StateStore key holding all saved searches, as a
+// versioned value (see state.Versioned)
+const SearchesKey = "parsec:searches"
+
+// Per-search keys: the period a node claimed to run, the last result, and
+// whether an alert is open
+const (
+	searchRunPrefix   = "parsec:search:run:"
+	searchLastPrefix  = "parsec:search:last:"
+	searchAlertPrefix = "parsec:search:alert:"
+)
+
+// SearchSource is the source of saved search alert events
+const SearchSource = "parsec-search"
+
+// Saved search alert statuses, recorded in the search_status metadata key
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Saved search conditions: alert when a period's count is above or below
+// the threshold
+const (
+	ConditionAbove = "above"
+	ConditionBelow = "below"
+)
+
+// Bounds of how often a saved search runs. Each run scans its whole
+// period, so periods are kept within what the query API scans.
+const (
+	MinSearchInterval = time.Minute
+	MaxSearchInterval = 24 * time.Hour
+)
+
+var (
+	ErrInvalidSearch         = errors.New("saved search requires a tenant, name and query")
+	ErrInvalidSearchQuery    = errors.New("invalid saved search query")
+	ErrInvalidSearchInterval = fmt.Errorf("saved search interval must be a duration from %s to %s", MinSearchInterval, MaxSearchInterval)
+	ErrInvalidCondition      = errors.New("saved search condition must be above or below, with a threshold of 0 or more")
+)
+
+// searchNamespace derives alert event IDs from the search, status and
+// period, so each alert has one ID however many nodes see it
+var searchNamespace = uuid.MustParse("9b2f4e1d-6c3a-4f8e-b7d5-2a1c9e8f0d34")
+
+// SearchCounter counts a tenant's events matching a query over from..to.
+// The query API implements it.
+type SearchCounter interface {
+	Count(ctx context.Context, tenantID, query string, from, to time.Time) (int, error)
+}
+
+// SavedSearch is a tenant's query run every interval over the interval
+// before, alerting when the count of matching events crosses a threshold
+type SavedSearch struct {
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+	Every    string `json:"every"`
+
+	// Condition is above (the default) or below the threshold
+	Condition string `json:"condition"`
+	Threshold int    `json:"threshold"`
+
+	every time.Duration
+}
+
+// SearchStatus is a saved search with its last result
+type SearchStatus struct {
+	SavedSearch
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastCount *int       `json:"last_count,omitempty"`
+	Firing    bool       `json:"firing"`
+}
+
+// searchResult is a search's last result in the store
+type searchResult struct {
+	At    time.Time `json:"at"`
+	Count int       `json:"count"`
+}
+
+// key identifies the search within the store keys
+func (s SavedSearch) key() string {
+	return s.TenantID + ":" + s.Name
+}
+
+// validate normalizes the name, checks the query and parses the interval
+func (s *SavedSearch) validate() error {
+	s.Name = strings.ToLower(strings.TrimSpace(s.Name))
+	s.Query = strings.TrimSpace(s.Query)
+	if s.TenantID == "" || s.Name == "" || s.Query == "" {
+		return ErrInvalidSearch
+	}
+
+	query, err := logql.Parse(s.Query)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSearchQuery, err)
+	}
+	if tenant, found, err := query.Take("tenant"); err != nil || found && tenant != s.TenantID {
+		return fmt.Errorf("%w: it may only match its own tenant", ErrInvalidSearchQuery)
+	}
+
+	every, err := time.ParseDuration(s.Every)
+	if err != nil || every < MinSearchInterval || every > MaxSearchInterval {
+		return ErrInvalidSearchInterval
+	}
+	s.every = every
+	s.Every = every.String()
+
+	if s.Condition == "" {
+		s.Condition = ConditionAbove
+	}
+	if (s.Condition != ConditionAbove && s.Condition != ConditionBelow) || s.Threshold < 0 {
+		return ErrInvalidCondition
+	}
+	return nil
+}
+
+// firing reports whether a count crosses the threshold. The engine alerts
+// on values above a threshold, so "below" compares the negated values.
+func (s SavedSearch) firing(ctx context.Context, engine AlertEngine, count int) (bool, error) {
+	rule := Rule{Name: "search", Threshold: float64(s.Threshold)}
+	value := float64(count)
+	if s.Condition == ConditionBelow {
+		rule.Threshold, value = -rule.Threshold, -value
+	}
+	return engine.Evaluate(ctx, rule, value)
+}
+
+// SearchMonitor runs saved searches on their schedules. Each period of a
+// search is run by the first node to claim it, which records the count
+// and raises one alert event in the tenant when the count crosses the
+// threshold, and one when it no longer does.
+type SearchMonitor struct {
+	store   state.StateStore
+	shared  *state.Versioned
+	engine  AlertEngine
+	counter SearchCounter
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu       sync.RWMutex
+	searches map[string]SavedSearch
+}
+
+// NewSearchMonitor creates a monitor counting events with counter. Saved
+// searches are shared through store, which should be Redis when running
+// several nodes.
+func NewSearchMonitor(store state.StateStore, engine AlertEngine, counter SearchCounter) *SearchMonitor {
+	return &SearchMonitor{
+		store:    store,
+		shared:   state.NewVersioned(store, SearchesKey),
+		engine:   engine,
+		counter:  counter,
+		searches: make(map[string]SavedSearch),
+	}
+}
+
+// Save adds or updates a saved search
+func (m *SearchMonitor) Save(ctx context.Context, s SavedSearch) (SavedSearch, error) {
+	if err := s.validate(); err != nil {
+		return SavedSearch{}, err
+	}
+	err := m.update(ctx, func(searches map[string]SavedSearch) {
+		searches[s.key()] = s
+	})
+	return s, err
+}
+
+// Delete removes a saved search and its state, reporting whether it
+// existed
+func (m *SearchMonitor) Delete(ctx context.Context, tenantID, name string) (bool, error) {
+	key := tenantID + ":" + strings.ToLower(name)
+
+	var ok bool
+	err := m.update(ctx, func(searches map[string]SavedSearch) {
+		_, ok = searches[key]
+		delete(searches, key)
+	})
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	for _, k := range []string{searchLastPrefix + key, searchAlertPrefix + key} {
+		if _, err := m.store.Expire(ctx, k, 0); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Status returns a tenant's saved searches with their last results, sorted
+// by name
+func (m *SearchMonitor) Status(ctx context.Context, tenantID string) ([]SearchStatus, error) {
+	if err := m.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	var statuses []SearchStatus
+	for _, s := range m.list() {
+		if s.TenantID != tenantID {
+			continue
+		}
+		status := SearchStatus{SavedSearch: s}
+		data, err := m.store.Get(ctx, searchLastPrefix+s.key())
+		if err != nil {
+			return nil, err
+		}
+		var last searchResult
+		if len(data) > 0 && json.Unmarshal(data, &last) == nil {
+			status.LastRun, status.LastCount = &last.At, &last.Count
+		}
+		open, err := m.store.Get(ctx, searchAlertPrefix+s.key())
+		if err != nil {
+			return nil, err
+		}
+		status.Firing = open != nil
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Load replaces the in-memory searches with those in the store
+func (m *SearchMonitor) Load(ctx context.Context) error {
+	data, err := m.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the searches saved here, as a store that
+		// keeps nothing would drop them
+		return err
+	}
+
+	searches, err := parseSearches(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.searches = searches
+	m.mu.Unlock()
+	return nil
+}
+
+// Run checks for due searches each interval until ctx is cancelled. Alert
+// events are passed to emit.
+func (m *SearchMonitor) Run(ctx context.Context, interval time.Duration, emit func(*models.LogEvent)) {
+	log := logger.WithComponent("searches")
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(ctx, time.Now(), emit); err != nil {
+				log.Warn().Err(err).Msg("saved search check failed")
+			}
+		}
+	}
+}
+
+// Check runs every search whose latest complete period no node has run yet
+func (m *SearchMonitor) Check(ctx context.Context, now time.Time, emit func(*models.LogEvent)) error {
+	if err := m.Load(ctx); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range m.list() {
+		if err := m.run(ctx, s, now, emit); err != nil {
+			metrics.SearchRuns.WithLabelValues("failed").Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", s.key(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run counts one search's latest complete period, if this node claims it,
+// and raises or resolves its alert
+func (m *SearchMonitor) run(ctx context.Context, s SavedSearch, now time.Time, emit func(*models.LogEvent)) error {
+	to := now.Truncate(s.every)
+	from := to.Add(-s.every)
+
+	period := strconv.FormatInt(to.Unix(), 10)
+	runKey := searchRunPrefix + s.key() + ":" + period
+	claimed, err := m.store.SetNX(ctx, runKey, []byte(period), 2*s.every)
+	if err != nil || !claimed {
+		return err
+	}
+
+	count, err := m.counter.Count(ctx, s.TenantID, s.Query, from, to)
+	if err != nil {
+		// Released so the period is retried next round
+		m.store.Expire(ctx, runKey, 0)
+		return err
+	}
+	metrics.SearchRuns.WithLabelValues("succeeded").Inc()
+
+	data, err := json.Marshal(searchResult{At: to.UTC(), Count: count})
+	if err != nil {
+		return err
+	}
+	if err := m.store.Set(ctx, searchLastPrefix+s.key(), data); err != nil {
+		return err
+	}
+
+	firing, err := s.firing(ctx, m.engine, count)
+	if err != nil {
+		return err
+	}
+
+	alertKey := searchAlertPrefix + s.key()
+	if firing {
+		opened, err := m.store.SetNX(ctx, alertKey, []byte(period), 0)
+		if err != nil || !opened {
+			return err
+		}
+		emit(searchEvent(s, StatusFiring, count, from, to,
+			fmt.Sprintf("saved search %s matched %d events in %s (%s %d)", s.Name, count, s.Every, s.Condition, s.Threshold)))
+		return nil
+	}
+
+	closed, err := m.store.Expire(ctx, alertKey, 0)
+	if err != nil || !closed {
+		return err
+	}
+	emit(searchEvent(s, StatusResolved, count, from, to,
+		fmt.Sprintf("saved search %s is back within its threshold with %d events", s.Name, count)))
+	return nil
+}
+
+// searchEvent builds an alert event in the search's tenant
+func searchEvent(s SavedSearch, status string, count int, from, to time.Time, message string) *models.LogEvent {
+	severity := models.SeverityError
+	if status == StatusResolved {
+		severity = models.SeverityInfo
+	}
+	id := s.key() + ":" + status + ":" + strconv.FormatInt(to.Unix(), 10)
+
+	metrics.SearchAlerts.WithLabelValues(status).Inc()
+	return &models.LogEvent{
+		ID:        uuid.NewSHA1(searchNamespace, []byte(id)).String(),
+		TenantID:  s.TenantID,
+		Timestamp: to.UTC(),
+		Severity:  severity,
+		Source:    SearchSource,
+		Message:   message,
+		Metadata: models.Metadata{
+			"search_name":      s.Name,
+			"search_query":     s.Query,
+			"search_count":     strconv.Itoa(count),
+			"search_condition": s.Condition,
+			"search_threshold": strconv.Itoa(s.Threshold),
+			"search_status":    status,
+			"search_from":      from.UTC().Format(time.RFC3339),
+			"search_to":        to.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// list returns the searches sorted by tenant and name
+func (m *SearchMonitor) list() []SavedSearch {
+	m.mu.RLock()
+	list := make([]SavedSearch, 0, len(m.searches))
+	for _, s := range m.searches {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+	return list
+}
+
+// parseSearches parses the stored searches, keyed by tenant and name
+func parseSearches(data []byte) (map[string]SavedSearch, error) {
+	var list []SavedSearch
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse saved searches: %w", err)
+	}
+	searches := make(map[string]SavedSearch, len(list))
+	for _, s := range list {
+		if s.validate() == nil {
+			searches[s.key()] = s
+		}
+	}
+	return searches, nil
+}
+
+// update applies change to the stored searches, again if another node
+// changed them meanwhile so its change is kept, then swaps them in. With
+// nothing stored, change applies to the searches saved here.
+func (m *SearchMonitor) update(ctx context.Context, change func(map[string]SavedSearch)) error {
+	m.writing.Lock()
+	defer m.writing.Unlock()
+
+	var searches map[string]SavedSearch
+	err := m.shared.Update(ctx, func(data []byte) ([]byte, error) {
+		if len(data) > 0 {
+			var err error
+			if searches, err = parseSearches(data); err != nil {
+				return nil, err
+			}
+		} else {
+			searches = make(map[string]SavedSearch)
+			for _, s := range m.list() {
+				searches[s.key()] = s
+			}
+		}
+		change(searches)
+
+		list := make([]SavedSearch, 0, len(searches))
+		for _, s := range searches {
+			list = append(list, s)
+		}
+		return json.Marshal(list)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.searches = searches
+	m.mu.Unlock()
+	return nil
+}
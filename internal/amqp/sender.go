@@ -0,0 +1,310 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// maxInFlight bounds the publishes awaiting a confirm
+const maxInFlight = 500
+
+// maxRoutingKey is the longest routing key AMQP 0-9-1 allows
+const maxRoutingKey = 255
+
+var (
+	// ErrNacked is returned for messages the broker refused to accept
+	ErrNacked = errors.New("message nacked by broker")
+
+	// ErrChannelClosed is returned for messages in flight when the channel
+	// closed; they are retried on a new connection
+	ErrChannelClosed = errors.New("AMQP channel closed")
+)
+
+// Channel is the part of *amqp.Channel the sender uses
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// Dialer opens a channel on a new connection
+type Dialer func() (Channel, error)
+
+// Sender publishes messages to an AMQP 0-9-1 exchange (RabbitMQ) with
+// publisher confirms. Routing keys are built from the message topic, tenant
+// and severity. A closed connection is re-dialed on the next send, so the
+// dispatcher's retries ride out broker restarts.
+type Sender struct {
+	cfg  config.AMQPConfig
+	dial Dialer
+
+	// mu serializes sends; confirms are matched to messages by delivery tag,
+	// which needs a single publisher on the channel
+	mu       sync.Mutex
+	ch       Channel
+	confirms chan amqp.Confirmation
+	closed   chan *amqp.Error
+	seq      uint64
+	dialed   bool
+}
+
+// Connect dials the broker, declares the exchange and returns a sender
+func Connect(cfg config.AMQPConfig) (*Sender, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("AMQP URL is required")
+	}
+	return New(cfg, func() (Channel, error) {
+		props := amqp.NewConnectionProperties()
+		props.SetClientConnectionName("parsec")
+		conn, err := amqp.DialConfig(cfg.URL, amqp.Config{Properties: props, Heartbeat: 10 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &connChannel{Channel: ch, conn: conn}, nil
+	})
+}
+
+// connChannel closes its connection along with the channel
+type connChannel struct {
+	*amqp.Channel
+	conn *amqp.Connection
+}
+
+func (c *connChannel) Close() error {
+	c.Channel.Close()
+	return c.conn.Close()
+}
+
+// New creates a sender over channels opened by dial, dialing once to fail
+// fast on bad settings
+func New(cfg config.AMQPConfig, dial Dialer) (*Sender, error) {
+	if cfg.Exchange == "" {
+		return nil, errors.New("AMQP exchange is required")
+	}
+	if cfg.ExchangeType == "" {
+		cfg.ExchangeType = amqp.ExchangeTopic
+	}
+	if cfg.RoutingKey == "" {
+		cfg.RoutingKey = "{topic}"
+	}
+	if cfg.PublishTimeout <= 0 {
+		cfg.PublishTimeout = 5 * time.Second
+	}
+
+	s := &Sender{cfg: cfg, dial: dial}
+	if _, err := s.channel(); err != nil {
+		return nil, fmt.Errorf("connect to AMQP broker: %w", err)
+	}
+	return s, nil
+}
+
+// channel returns the open channel, dialing a new connection if the last
+// one closed. Callers hold mu (or own s exclusively).
+func (s *Sender) channel() (Channel, error) {
+	log := logger.WithComponent("amqp")
+	if s.ch != nil {
+		select {
+		case err := <-s.closed:
+			log.Warn().Err(err).Msg("AMQP channel closed; reconnecting")
+			s.reset()
+		default:
+			return s.ch, nil
+		}
+	}
+
+	ch, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	if err := ch.ExchangeDeclare(s.cfg.Exchange, s.cfg.ExchangeType, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("declare exchange %s: %w", s.cfg.Exchange, err)
+	}
+
+	s.ch = ch
+	s.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, maxInFlight))
+	s.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+	s.seq = 0
+	if s.dialed {
+		metrics.AMQPReconnects.Inc()
+		log.Info().Str("exchange", s.cfg.Exchange).Msg("AMQP connection recovered")
+	}
+	s.dialed = true
+	return ch, nil
+}
+
+// reset drops the channel so the next send reconnects
+func (s *Sender) reset() {
+	if s.ch != nil {
+		s.ch.Close()
+	}
+	s.ch, s.confirms, s.closed = nil, nil, nil
+}
+
+// Limits bounds the publishes awaiting confirms at once
+func (s *Sender) Limits() bus.Limits {
+	return bus.Limits{Messages: maxInFlight}
+}
+
+// Send publishes messages without waiting in between, then matches the
+// broker's confirms to them
+func (s *Sender) Send(ctx context.Context, msgs []bus.Message) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(msgs))
+	ch, err := s.channel()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.PublishTimeout)
+	defer cancel()
+
+	pending := make(map[uint64]int, len(msgs))
+	for i, msg := range msgs {
+		if err := ch.PublishWithContext(ctx, s.cfg.Exchange, s.routingKey(msg), false, false, publishing(msg)); err != nil {
+			// The channel is unusable; fail the rest without publishing
+			for j := i; j < len(msgs); j++ {
+				errs[j] = err
+			}
+			break
+		}
+		s.seq++
+		pending[s.seq] = i
+	}
+
+	for len(pending) > 0 {
+		select {
+		case c, ok := <-s.confirms:
+			if !ok {
+				for _, i := range pending {
+					errs[i] = ErrChannelClosed
+				}
+				s.reset()
+				return errs
+			}
+			i, known := pending[c.DeliveryTag]
+			if !known {
+				continue
+			}
+			delete(pending, c.DeliveryTag)
+			if !c.Ack {
+				errs[i] = ErrNacked
+			}
+		case <-ctx.Done():
+			for _, i := range pending {
+				errs[i] = ctx.Err()
+			}
+			// Late confirms would be matched to the wrong messages
+			s.reset()
+			return errs
+		}
+	}
+	return errs
+}
+
+// publishing converts a message into a persistent AMQP publishing; headers
+// are carried in the header table
+func publishing(m bus.Message) amqp.Publishing {
+	headers := make(amqp.Table, len(m.Headers)+1)
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if len(m.Key) > 0 {
+		headers["partition_key"] = string(m.Key)
+	}
+
+	pub := amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    m.Time,
+		Body:         m.Value,
+	}
+	if v, ok := headers[bus.HeaderContentEncoding].(string); ok {
+		pub.ContentEncoding = v
+	}
+	if v, ok := headers["event_id"].(string); ok {
+		pub.MessageId = v
+	}
+	return pub
+}
+
+// routingKey expands the {topic}, {tenant}, {severity} and {priority}
+// placeholders of the configured routing key
+func (s *Sender) routingKey(m bus.Message) string {
+	key := strings.NewReplacer(
+		"{topic}", routingWord(m.Topic),
+		"{tenant}", routingWord(header(m, "tenant_id")),
+		"{severity}", routingWord(strings.ToLower(header(m, "severity"))),
+		"{priority}", routingWord(header(m, "priority")),
+	).Replace(s.cfg.RoutingKey)
+	if len(key) > maxRoutingKey {
+		key = key[:maxRoutingKey]
+	}
+	return key
+}
+
+// routingWord keeps a value to a single topic-exchange word
+func routingWord(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return strings.NewReplacer(".", "_", "*", "_", "#", "_").Replace(v)
+}
+
+func header(m bus.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// HealthCheck verifies a channel is open, reconnecting if needed
+func (s *Sender) HealthCheck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.channel()
+	return err
+}
+
+// Close closes the channel and connection
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		return nil
+	}
+	err := s.ch.Close()
+	s.ch = nil
+	return err
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"parsec/internal/abuse"
+	"parsec/internal/logger"
+	"parsec/internal/rbac"
+)
+
+// AbuseHandler shows and clears blocked and tarpitted sources
+type AbuseHandler struct {
+	detector *abuse.Detector
+}
+
+// NewAbuseHandler creates an abuse detection admin handler
+func NewAbuseHandler(detector *abuse.Detector) *AbuseHandler {
+	return &AbuseHandler{detector: detector}
+}
+
+// AbuseState lists the sources being refused or slowed down. Blocks apply
+// on every node; tarpits are this node's.
+type AbuseState struct {
+	Blocks  []abuse.Block  `json:"blocks"`
+	Tarpits []abuse.Tarpit `json:"tarpits"`
+}
+
+// ServeHTTP handles GET /admin/abuse and DELETE /admin/abuse/{source},
+// which lifts a source's block and tarpit and forgets its failures
+func (h *AbuseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	source := r.PathValue("source")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "abuse").
+		Logger()
+
+	switch {
+	case source == "" && r.Method == http.MethodGet:
+		// fall through to the response below
+
+	case source != "" && r.Method == http.MethodDelete:
+		existed, err := h.detector.Clear(r.Context(), source)
+		if err != nil {
+			log.Error().Err(err).Str("source", source).Msg("failed to clear abuse block")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !existed {
+			writeJSONError(w, http.StatusNotFound, "source is not blocked or tarpitted")
+			return
+		}
+		event := log.Info().Bool("audit", true).Str("source", source)
+		if p, ok := rbac.FromContext(r.Context()); ok {
+			event = event.Str("principal", p.Name)
+		}
+		event.Msg("abuse block cleared")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AbuseState{
+		Blocks:  h.detector.Blocks(),
+		Tarpits: h.detector.Tarpits(),
+	})
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/metrics"
+	"parsec/internal/rbac"
+	"parsec/internal/receipts"
+	"parsec/pkg/models"
+)
+
+// ErrIngestStopped is the error of events left unprocessed when an async
+// batch is interrupted by shutdown
+var ErrIngestStopped = errors.New("ingest stopped before the event was processed")
+
+// AsyncConfig holds settings for ?mode=async batches
+type AsyncConfig struct {
+	// MaxBodySize bounds an async batch's body (0 = 100MB)
+	MaxBodySize int64
+
+	// MaxPending bounds the batches staged but not yet ingested (0 = 16)
+	MaxPending int
+
+	// MaxStagedBytes bounds the bodies of those batches (0 = 256MB)
+	MaxStagedBytes int64
+
+	// Workers ingests staged batches concurrently (0 = 1)
+	Workers int
+}
+
+// AsyncResponse is returned for a batch accepted with ?mode=async
+type AsyncResponse struct {
+	BatchID   string `json:"batch_id"`
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url"`
+}
+
+// stagedBatch is an async batch waiting to be ingested
+type stagedBatch struct {
+	id        string
+	body      []byte
+	received  time.Time
+	requestID string
+
+	// principal sent the batch; its events are checked against its tenants
+	principal *rbac.Principal
+
+	// retention is the client's retention hint in seconds (0 = none)
+	retention int64
+}
+
+// asyncIngest is the staging area of async batches. Batches are held in
+// memory, so those still staged at shutdown are marked failed for the
+// client to resend.
+type asyncIngest struct {
+	cfg    AsyncConfig
+	staged chan *stagedBatch
+	bytes  atomic.Int64
+}
+
+// newAsyncIngest creates the staging area, applying defaults
+func newAsyncIngest(cfg AsyncConfig) *asyncIngest {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 100 * 1024 * 1024
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 16
+	}
+	if cfg.MaxStagedBytes <= 0 {
+		cfg.MaxStagedBytes = 256 * 1024 * 1024
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	return &asyncIngest{cfg: cfg, staged: make(chan *stagedBatch, cfg.MaxPending)}
+}
+
+// reserve claims room for a body of n bytes, reporting whether there was
+// room
+func (a *asyncIngest) reserve(n int) bool {
+	if len(a.staged) == cap(a.staged) {
+		return false
+	}
+	if a.bytes.Add(int64(n)) > a.cfg.MaxStagedBytes {
+		a.release(n)
+		return false
+	}
+	metrics.AsyncStagedBytes.Set(float64(a.bytes.Load()))
+	return true
+}
+
+// release returns the room of a body of n bytes
+func (a *asyncIngest) release(n int) {
+	metrics.AsyncStagedBytes.Set(float64(a.bytes.Add(-int64(n))))
+}
+
+// asyncMode reads the ?mode= parameter (sync or async); the query is only
+// parsed when present so plain requests don't pay for it
+func asyncMode(r *http.Request) (bool, error) {
+	if r.URL.RawQuery == "" {
+		return false, nil
+	}
+	switch r.URL.Query().Get("mode") {
+	case "", "sync":
+		return false, nil
+	case "async":
+		return true, nil
+	default:
+		return false, errors.New("mode must be sync or async")
+	}
+}
+
+// serveAsync stages a batch and responds 202 with its batch ID straight
+// away; GET /batches/{id} reports it pending until a worker has ingested it
+func (h *IngestHandler) serveAsync(w http.ResponseWriter, r *http.Request, atomicBatch bool, log *requestLogger) {
+	if h.async == nil {
+		h.writeError(w, http.StatusBadRequest, "async ingest requires batch receipts")
+		return
+	}
+	if atomicBatch {
+		h.writeError(w, http.StatusBadRequest, "atomic batches can't be ingested asynchronously")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.async.cfg.MaxBodySize))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read async request body")
+		h.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	if !h.async.reserve(len(body)) {
+		log.Warn().Int("body_size", len(body)).Msg("async staging full")
+		metrics.AsyncBatchesTotal.WithLabelValues("refused").Inc()
+		w.Header().Set("Retry-After", "5")
+		h.writeError(w, http.StatusServiceUnavailable, "async staging full")
+		return
+	}
+
+	batch := &stagedBatch{
+		id:        string(h.appendBatchID(nil)),
+		body:      body,
+		received:  time.Now(),
+		requestID: log.requestID,
+	}
+	batch.principal, _ = rbac.FromContext(r.Context())
+	batch.retention = clientRetention(r.Context())
+
+	// The pending receipt is stored before the batch can complete, so it
+	// never replaces the final one
+	pending := &receipts.Receipt{
+		BatchID:    batch.id,
+		Tenants:    batchTenants(batch.principal, nil),
+		Node:       h.nodeID,
+		ReceivedAt: batch.received.UTC(),
+		Status:     receipts.BatchPending,
+		Events:     []receipts.Disposition{},
+	}
+	if !h.saveReceipt(r.Context(), pending, log) {
+		h.async.release(len(body))
+		h.writeError(w, http.StatusServiceUnavailable, "batch receipts unavailable")
+		return
+	}
+
+	select {
+	case h.async.staged <- batch:
+	default:
+		// Another request took the last slot since reserve
+		h.async.release(len(body))
+		h.failBatch(context.WithoutCancel(r.Context()), batch, "", "async staging full", log)
+		w.Header().Set("Retry-After", "5")
+		h.writeError(w, http.StatusServiceUnavailable, "async staging full")
+		return
+	}
+	metrics.AsyncBatchesTotal.WithLabelValues("staged").Inc()
+	log.Info().Str("batch_id", batch.id).Int("body_size", len(body)).Msg("async batch staged")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(batchIDHeader, batch.id)
+	w.Header().Set("Location", "/batches/"+batch.id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(AsyncResponse{
+		BatchID:   batch.id,
+		Status:    receipts.BatchPending,
+		StatusURL: "/batches/" + batch.id,
+	})
+}
+
+// RunAsync ingests staged async batches until ctx is cancelled, then
+// marks those never started as failed. It returns at once when async
+// ingest is off.
+func (h *IngestHandler) RunAsync(ctx context.Context) {
+	if h.async == nil {
+		return
+	}
+
+	// Receipts are written past shutdown so no batch stays pending
+	abandon := func(batch *stagedBatch) {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		h.async.release(len(batch.body))
+		h.failBatch(saveCtx, batch, "", "node shut down before the batch was ingested", &requestLogger{requestID: batch.requestID})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < h.async.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case batch := <-h.async.staged:
+					if ctx.Err() != nil {
+						abandon(batch)
+						return
+					}
+					h.ingestStaged(ctx, batch)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case batch := <-h.async.staged:
+			abandon(batch)
+		default:
+			return
+		}
+	}
+}
+
+// ingestStaged ingests a staged batch and stores its final receipt
+func (h *IngestHandler) ingestStaged(ctx context.Context, batch *stagedBatch) {
+	defer h.async.release(len(batch.body))
+	log := &requestLogger{requestID: batch.requestID}
+	if batch.principal != nil {
+		ctx = rbac.NewContext(ctx, batch.principal)
+	}
+	if batch.retention > 0 {
+		ctx = withRetention(ctx, batch.retention)
+	}
+
+	response, batchRef, converted, batchErr := h.ingestBatch(ctx, batch.body, batch.id, false, true, log)
+	saveCtx := context.WithoutCancel(ctx)
+	if batchErr != nil {
+		h.failBatch(saveCtx, batch, batchRef, batchErr.msg, log)
+		return
+	}
+
+	h.receipt(saveCtx, batch.id, batchRef, batch.received, converted, &response, log)
+	metrics.AsyncBatchesTotal.WithLabelValues("completed").Inc()
+	metrics.AsyncBatchDuration.Observe(time.Since(batch.received).Seconds())
+}
+
+// failBatch stores the receipt of an async batch that failed as a whole
+func (h *IngestHandler) failBatch(ctx context.Context, batch *stagedBatch, batchRef, reason string, log *requestLogger) {
+	now := time.Now().UTC()
+	h.saveReceipt(ctx, &receipts.Receipt{
+		BatchID:     batch.id,
+		BatchRef:    batchRef,
+		Tenants:     batchTenants(batch.principal, nil),
+		Node:        h.nodeID,
+		ReceivedAt:  batch.received.UTC(),
+		Status:      receipts.BatchFailed,
+		Error:       reason,
+		CompletedAt: &now,
+		Events:      []receipts.Disposition{},
+	}, log)
+	log.Warn().Str("batch_id", batch.id).Str("reason", reason).Msg("async batch failed")
+	metrics.AsyncBatchesTotal.WithLabelValues("failed").Inc()
+}
+
+// processPaced ingests an async batch's events, waiting for room in the
+// queue before each so a huge batch doesn't fill it and have its tail
+// rejected. Events left when ctx is cancelled are rejected.
+func (h *IngestHandler) processPaced(ctx context.Context, events []*models.LogEvent, sizes []int, batchID string, response *IngestResponse, log *requestLogger) {
+	for i, event := range events {
+		if event == nil {
+			continue
+		}
+		if !h.waitForRoom(ctx) {
+			response.Errors = append(response.Errors, IngestError{
+				Index:   i,
+				EventID: event.ID,
+				Error:   ErrIngestStopped.Error(),
+			})
+			response.Rejected++
+			metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+			continue
+		}
+		h.ingestEvent(ctx, i, event, sizes[i], nil, batchID, response, log)
+	}
+
+	response.Success = response.Rejected == 0
+}
+
+// waitForRoom waits until the queue has room, reporting false if ctx is
+// cancelled first. With an overflow policy the queue always takes events.
+func (h *IngestHandler) waitForRoom(ctx context.Context) bool {
+	if h.overflow != nil || len(h.envelopeChan) < cap(h.envelopeChan) {
+		return ctx.Err() == nil
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if len(h.envelopeChan) < cap(h.envelopeChan) {
+				return true
+			}
+		}
+	}
+}
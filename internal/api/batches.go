@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/rbac"
+	"parsec/internal/receipts"
+	"parsec/pkg/models"
+)
+
+// batchIDHeader carries the server's batch ID when receipts are on, for
+// clients reading responses that don't include the receipt
+const batchIDHeader = "X-Batch-Id"
+
+// receipt builds, signs and stores the receipt of a batch received at
+// received. A receipt that can't be stored is still returned.
+func (h *IngestHandler) receipt(ctx context.Context, batchID, batchRef string, received time.Time, events []*models.LogEvent, response *IngestResponse, log *requestLogger) *receipts.Receipt {
+	now := time.Now().UTC()
+	principal, _ := rbac.FromContext(ctx)
+	receipt := &receipts.Receipt{
+		BatchID:     batchID,
+		BatchRef:    batchRef,
+		Tenants:     batchTenants(principal, events),
+		Node:        h.nodeID,
+		ReceivedAt:  received.UTC(),
+		Status:      receipts.BatchCompleted,
+		CompletedAt: &now,
+		Accepted:    response.Accepted,
+		Rejected:    response.Rejected,
+		Dropped:     response.Dropped,
+		Events:      dispositions(events, response),
+	}
+	h.saveReceipt(ctx, receipt, log)
+	return receipt
+}
+
+// batchTenants returns the tenants a batch's receipt belongs to, sorted:
+// those of its events the sender may ingest for, or the sender's own when
+// there are none. Events that failed conversion are nil; p is nil without
+// authentication.
+func batchTenants(p *rbac.Principal, events []*models.LogEvent) []string {
+	seen := make(map[string]bool)
+	var tenants []string
+	for _, event := range events {
+		if event == nil || seen[event.TenantID] || (p != nil && !p.Can(rbac.PermIngest, event.TenantID)) {
+			continue
+		}
+		seen[event.TenantID] = true
+		tenants = append(tenants, event.TenantID)
+	}
+	if len(tenants) == 0 && p != nil {
+		tenants = append(tenants, p.Tenants...)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// saveReceipt stores a receipt, logging a failure, and reports whether it
+// was stored
+func (h *IngestHandler) saveReceipt(ctx context.Context, receipt *receipts.Receipt, log *requestLogger) bool {
+	if err := h.receipts.Save(ctx, receipt); err != nil {
+		log.Error().Err(err).Str("batch_id", receipt.BatchID).Msg("failed to store batch receipt")
+		metrics.ReceiptsTotal.WithLabelValues("failed").Inc()
+		return false
+	}
+	metrics.ReceiptsTotal.WithLabelValues("stored").Inc()
+	return true
+}
+
+// dispositions lists what became of each of a batch's events: those with
+// an error were rejected, or dropped (e.g. duplicates) if counted as such,
+// and those without one were accepted unless a rule or filter dropped them.
+// Events that failed conversion or were duplicates are nil.
+func dispositions(batch []*models.LogEvent, response *IngestResponse) []receipts.Disposition {
+	n := len(batch)
+	events := make([]receipts.Disposition, n)
+	for i, event := range batch {
+		events[i] = receipts.Disposition{Index: i, Status: receipts.StatusAccepted}
+		if event != nil {
+			events[i].EventID = event.ID
+		}
+	}
+	for _, i := range response.droppedAt {
+		events[i].Status = receipts.StatusDropped
+	}
+	for _, e := range response.Errors {
+		if e.Index < 0 || e.Index >= n {
+			continue
+		}
+		d := &events[e.Index]
+		d.Error = e.Error
+		if e.EventID != "" {
+			d.EventID = e.EventID
+		}
+		if d.Status != receipts.StatusDropped {
+			d.Status = receipts.StatusRejected
+		}
+	}
+	return events
+}
+
+// BatchesHandler returns the receipts of ingest batches
+type BatchesHandler struct {
+	receipts *receipts.Store
+}
+
+// NewBatchesHandler creates a batch receipt handler
+func NewBatchesHandler(store *receipts.Store) *BatchesHandler {
+	return &BatchesHandler{receipts: store}
+}
+
+// ServeHTTP handles GET /batches/{id}, the receipt of a completed batch or
+// the status of one still being ingested asynchronously
+func (h *BatchesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	batchID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "batches").
+		Logger()
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	receipt, err := h.receipts.Get(r.Context(), batchID)
+	if errors.Is(err, receipts.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("batch_id", batchID).Msg("failed to read batch receipt")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Another tenant's batch is reported as unknown, so batch IDs can't be
+	// probed across tenants
+	if !receiptPermitted(r.Context(), receipt) {
+		writeJSONError(w, http.StatusNotFound, receipts.ErrNotFound.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// receiptPermitted reports whether the caller may ingest for every tenant
+// of a receipt; a receipt without tenants needs an unscoped key
+func receiptPermitted(ctx context.Context, receipt *receipts.Receipt) bool {
+	if len(receipt.Tenants) == 0 {
+		return rbac.Permits(ctx, rbac.PermIngest, "")
+	}
+	for _, tenantID := range receipt.Tenants {
+		if !rbac.Permits(ctx, rbac.PermIngest, tenantID) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/browser"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// BrowserSource is the source of browser reports that don't name one
+const BrowserSource = "browser"
+
+// BrowserConfig configures the browser error reporting endpoint
+type BrowserConfig struct {
+	// Tenants may receive browser reports; the endpoint has no API key
+	// (sendBeacon cannot set headers), so only listed tenants are accepted
+	Tenants []string
+
+	// SourceMaps symbolicates stack traces; nil leaves them as reported
+	SourceMaps *browser.SourceMaps
+
+	// Geo maps client IPs to locations; nil disables geo metadata
+	Geo *browser.GeoDB
+
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, for
+	// deployments behind a proxy or load balancer
+	TrustForwardedFor bool
+}
+
+// BrowserHandler accepts JavaScript error reports sent by browsers with
+// navigator.sendBeacon or fetch, and ingests them through the ingest handler
+type BrowserHandler struct {
+	ingest  *IngestHandler
+	tenants map[string]bool
+	cfg     BrowserConfig
+}
+
+// NewBrowserHandler creates a browser error reporting handler
+func NewBrowserHandler(ingest *IngestHandler, cfg BrowserConfig) *BrowserHandler {
+	tenants := make(map[string]bool, len(cfg.Tenants))
+	for _, tenant := range cfg.Tenants {
+		if tenant = strings.TrimSpace(tenant); tenant != "" {
+			tenants[tenant] = true
+		}
+	}
+	return &BrowserHandler{ingest: ingest, tenants: tenants, cfg: cfg}
+}
+
+// BrowserReport is one error report. Only message is required.
+type BrowserReport struct {
+	ID        string          `json:"id,omitempty"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Type      string          `json:"type,omitempty"` // e.g. TypeError
+	Message   string          `json:"message"`
+	Stack     string          `json:"stack,omitempty"` // error.stack
+	URL       string          `json:"url,omitempty"`   // page URL
+	Release   string          `json:"release,omitempty"`
+	Source    string          `json:"source,omitempty"`
+	Metadata  models.Metadata `json:"metadata,omitempty"`
+}
+
+// ServeHTTP handles POST /ingest/browser?tenant=<tenant> with a report or
+// an array of reports. Bodies may be sent as text/plain, which sendBeacon
+// uses for strings and which needs no CORS preflight.
+func (h *BrowserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := &requestLogger{requestID: r.Header.Get(requestIDHeader)}
+
+	// Reports come from pages on any origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "application/json" && mediaType != "text/plain" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "content-type must be application/json or text/plain")
+			return
+		}
+	}
+
+	tenant := r.URL.Query().Get("tenant")
+	if !h.tenants[tenant] {
+		log.Warn().Str("tenant_id", tenant).Msg("browser reports not enabled for tenant")
+		writeJSONError(w, http.StatusForbidden, "browser reports are not enabled for this tenant")
+		return
+	}
+
+	format, err := negotiateResponse(r)
+	if errors.Is(err, errNotAcceptable) {
+		writeJSONError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := h.ingest.readBody(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	reports, err := parseBrowserReports(body)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse browser reports")
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	metrics.BrowserReports.WithLabelValues(tenant).Add(float64(len(reports)))
+	log.Info().Int("batch_size", len(reports)).Str("tenant_id", tenant).Msg("processing browser reports")
+
+	// The client is the same for every report in a request
+	ua := browser.ParseUserAgent(r.UserAgent())
+	loc, located := h.cfg.Geo.Lookup(h.clientIP(r))
+
+	events := make([]*models.LogEvent, len(reports))
+	for i, report := range reports {
+		// Each event gets its own metadata maps, which stages may modify
+		client := ua.Metadata()
+		if located {
+			client["geo"] = loc.Metadata()
+		}
+		events[i] = h.event(r, tenant, report, client)
+	}
+	h.ingest.serveEvents(w, r, format, body, events, log)
+}
+
+// parseBrowserReports decodes a report or an array of reports
+func parseBrowserReports(body []byte) ([]BrowserReport, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reports []BrowserReport
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+		if len(reports) == 0 {
+			return nil, errors.New("no reports provided")
+		}
+		return reports, nil
+	}
+
+	var report BrowserReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, err
+	}
+	return []BrowserReport{report}, nil
+}
+
+// event converts a report into a log event. The message carries the error
+// type and the (symbolicated) stack; client details go in metadata. A bad
+// timestamp falls back to the time of receipt, since browser clocks are
+// often wrong.
+func (h *BrowserHandler) event(r *http.Request, tenant string, report BrowserReport, client map[string]any) *models.LogEvent {
+	event := &models.LogEvent{
+		ID:       report.ID,
+		TenantID: tenant,
+		Severity: models.Severity(report.Level),
+		Source:   report.Source,
+		Message:  report.Message,
+		Metadata: make(models.Metadata, len(report.Metadata)+len(client)+4),
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Severity == "" {
+		event.Severity = models.SeverityError
+	}
+	if event.Source == "" {
+		event.Source = BrowserSource
+	}
+	if ts, err := models.ParseTimestamp(report.Timestamp); err == nil && report.Timestamp != "" {
+		event.Timestamp = ts
+	} else {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	for k, v := range report.Metadata {
+		event.Metadata[k] = v
+	}
+	for k, v := range client {
+		event.Metadata[k] = v
+	}
+	if ua := r.UserAgent(); ua != "" {
+		event.Metadata["user_agent"] = ua
+	}
+	if report.URL != "" {
+		event.Metadata["url"] = report.URL
+	}
+	if report.Release != "" {
+		event.Metadata["release"] = report.Release
+	}
+
+	if report.Type != "" && !strings.HasPrefix(event.Message, report.Type) {
+		event.Message = report.Type + ": " + event.Message
+	}
+
+	frames := browser.ParseStack(report.Stack)
+	if len(frames) == 0 {
+		return event
+	}
+
+	resolved := h.cfg.SourceMaps.Symbolicate(r.Context(), tenant, report.Release, frames)
+	metrics.BrowserFrames.WithLabelValues(tenant, "symbolicated").Add(float64(resolved))
+	metrics.BrowserFrames.WithLabelValues(tenant, "unmapped").Add(float64(len(frames) - resolved))
+	if resolved > 0 {
+		event.Metadata["symbolicated"] = true
+	}
+
+	event.Message += "\n" + browser.FormatStack(frames)
+	return event
+}
+
+// clientIP is the address the report came from
+func (h *BrowserHandler) clientIP(r *http.Request) netip.Addr {
+	if h.cfg.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if addr, err := netip.ParseAddr(strings.TrimSpace(first)); err == nil {
+				return addr
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr
+}
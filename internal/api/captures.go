@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"parsec/internal/capture"
+	"parsec/internal/logger"
+)
+
+// CapturesHandler exposes the requests sampled for debugging
+type CapturesHandler struct {
+	recorder *capture.Recorder
+}
+
+// NewCapturesHandler creates a request capture admin handler
+func NewCapturesHandler(recorder *capture.Recorder) *CapturesHandler {
+	return &CapturesHandler{recorder: recorder}
+}
+
+// ServeHTTP lists captures on GET, newest first, filtered by the tenant
+// and limit query parameters, and discards them on DELETE. Captures are
+// kept per node.
+func (h *CapturesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "captures").
+		Logger()
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		limit := 0
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = n
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"captures": h.recorder.List(q.Get("tenant"), limit)})
+
+	case http.MethodDelete:
+		h.recorder.Clear()
+		log.Info().Msg("request captures cleared")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"parsec/internal/config"
+)
+
+// ConfigHandler exposes the resolved runtime configuration
+type ConfigHandler struct {
+	cfg *config.Config
+}
+
+// NewConfigHandler creates an effective configuration admin handler
+func NewConfigHandler(cfg *config.Config) *ConfigHandler {
+	return &ConfigHandler{cfg: cfg}
+}
+
+// ConfigResponse is the response to GET /admin/config
+type ConfigResponse struct {
+	Profile  string           `json:"profile,omitempty"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// ServeHTTP returns every setting with its value and source (default,
+// profile or env), secrets redacted. ?prefix=kafka.producer limits the
+// settings to a section and ?source=env to those from one source.
+func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	source := r.URL.Query().Get("source")
+
+	settings := make([]config.Setting, 0)
+	for _, setting := range h.cfg.Effective() {
+		if prefix != "" && setting.Key != prefix && !strings.HasPrefix(setting.Key, prefix+".") {
+			continue
+		}
+		if source != "" && setting.Source != source {
+			continue
+		}
+		settings = append(settings, setting)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigResponse{Profile: h.cfg.Profile, Settings: settings})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"parsec/internal/discovery"
+)
+
+// regionHeader lets SDKs name the region they run in
+const regionHeader = "X-Parsec-Region"
+
+// DiscoverHandler tells clients which ingest endpoints to use
+type DiscoverHandler struct {
+	registry *discovery.Registry
+}
+
+// NewDiscoverHandler creates a node discovery handler
+func NewDiscoverHandler(registry *discovery.Registry) *DiscoverHandler {
+	return &DiscoverHandler{registry: registry}
+}
+
+// ServeHTTP handles GET /discover. The client's region comes from the
+// region query parameter or the X-Parsec-Region header, defaulting to this
+// node's, which GeoDNS picked as the nearest; limit caps the endpoints.
+// Without announced nodes the node answering is the only endpoint.
+func (h *DiscoverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		region = r.Header.Get(regionHeader)
+	}
+	var limit int
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	answer := h.registry.Discover(region, limit)
+	if len(answer.Endpoints) == 0 {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		answer.Endpoints = []discovery.Node{h.registry.Local(scheme + "://" + r.Host)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(answer.TTLSeconds))
+	json.NewEncoder(w).Encode(answer)
+}
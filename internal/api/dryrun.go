@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/pipeline"
+	"parsec/pkg/models"
+)
+
+// DryRunHandler runs events through the ingest stages and routing rules
+// without publishing
+type DryRunHandler struct {
+	ingest *IngestHandler
+}
+
+// NewDryRunHandler creates a dry-run handler sharing the ingest handler's stages
+func NewDryRunHandler(ingest *IngestHandler) *DryRunHandler {
+	return &DryRunHandler{ingest: ingest}
+}
+
+// DryRunResponse reports what would happen to each event
+type DryRunResponse struct {
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []DryRunResult `json:"results"`
+}
+
+// DryRunResult is the outcome for a single event
+type DryRunResult struct {
+	Index     int              `json:"index"`
+	EventID   string           `json:"event_id,omitempty"`
+	Accepted  bool             `json:"accepted"`
+	Error     string           `json:"error,omitempty"`
+	SizeBytes int              `json:"size_bytes,omitempty"` // canonical size as received
+	Stages    []string         `json:"stages"`
+	Envelope  *models.Envelope `json:"envelope,omitempty"`
+	Routing   *RoutingDecision `json:"routing,omitempty"`
+}
+
+// RoutingDecision describes where an accepted event would go
+type RoutingDecision struct {
+	// Action is "publish", "hold" (waiting for multi-line continuation) or
+	// "drop" (filtered by a script, or dropped or sampled out by a routing rule)
+	Action       string `json:"action"`
+	Topic        string `json:"topic,omitempty"`
+	PartitionKey string `json:"partition_key,omitempty"`
+	Priority     string `json:"priority,omitempty"`
+	Retention    string `json:"retention,omitempty"`
+
+	// RetentionSeconds is the retention hint storage gets, from a routing
+	// rule or the X-Parsec-Retention header
+	RetentionSeconds int64    `json:"retention_seconds,omitempty"`
+	Rules            []string `json:"rules,omitempty"`
+
+	// Tier is the tenant's service tier and Acks the Kafka acks it sets
+	Tier string `json:"tier,omitempty"`
+	Acks string `json:"acks,omitempty"`
+}
+
+// ServeHTTP handles the dry-run request
+func (h *DryRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "ingest_dry_run").
+		Logger()
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.ingest.maxBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	inputs, _, err := h.ingest.parseBody(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r, err = requestRetention(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := pipeline.WithDryRun(r.Context())
+	batchID := "dry-run"
+	response := DryRunResponse{Results: make([]DryRunResult, 0, len(inputs))}
+
+	for i, input := range inputs {
+		result := DryRunResult{Index: i, EventID: input.ID}
+
+		event, err := h.ingest.convertInput(input)
+		if err != nil {
+			result.Error = err.Error()
+			result.Stages = []string{"convert"}
+			response.Rejected++
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		result.SizeBytes = event.Size()
+		if err := h.ingest.checkEventSize(result.SizeBytes); err != nil {
+			result.Error = err.Error()
+			result.Stages = []string{"convert"}
+			response.Rejected++
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		stages, err := h.ingest.prepare(ctx, event)
+		result.Stages = append([]string{"convert"}, stages...)
+		result.EventID = event.ID
+		if errors.Is(err, pipeline.ErrDropped) {
+			result.Accepted = true
+			result.Routing = &RoutingDecision{Action: "drop"}
+			response.Accepted++
+			response.Results = append(response.Results, result)
+			continue
+		}
+		if err != nil {
+			result.Error = err.Error()
+			response.Rejected++
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		decision := h.ingest.router.Evaluate(event)
+		envelope := models.NewEnvelope(event, h.ingest.nodeID).WithBatch(batchID, i)
+		envelope.Topic = decision.Topic
+		envelope.Priority = decision.Priority
+		envelope.Retention = decision.Retention
+		envelope.RetentionSeconds = retentionSeconds(ctx, decision)
+		envelope.Acks = h.ingest.tiers.Acks(event.TenantID)
+		tier, _ := h.ingest.tiers.Tier(event.TenantID)
+
+		result.Accepted = true
+		result.Envelope = envelope
+		result.Routing = &RoutingDecision{
+			Action:           "publish",
+			Topic:            h.ingest.topic,
+			PartitionKey:     envelope.PartitionKey,
+			Priority:         decision.Priority,
+			Retention:        decision.Retention,
+			RetentionSeconds: envelope.RetentionSeconds,
+			Rules:            decision.Matched,
+			Tier:             string(tier),
+			Acks:             envelope.Acks,
+		}
+		if decision.Topic != "" {
+			result.Routing.Topic = decision.Topic
+		}
+		result.Stages = append(result.Stages, "route")
+
+		if decision.Drop {
+			result.Routing.Action = "drop"
+			result.Envelope = nil
+		} else if h.ingest.assembler != nil && h.ingest.assembler.Applies(event) {
+			result.Stages = append(result.Stages, "multiline")
+			result.Routing.Action = "hold"
+		}
+
+		response.Accepted++
+		response.Results = append(response.Results, result)
+	}
+
+	log.Info().
+		Int("accepted", response.Accepted).
+		Int("rejected", response.Rejected).
+		Msg("dry run complete")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
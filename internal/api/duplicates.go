@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// DuplicatePolicy decides what happens to events in one batch that share an
+// ID, which would otherwise be published twice
+type DuplicatePolicy string
+
+const (
+	// DuplicateKeepFirst keeps the first event with an ID and drops the rest
+	DuplicateKeepFirst DuplicatePolicy = "keep_first"
+
+	// DuplicateKeepLast keeps the last event with an ID and drops the rest
+	DuplicateKeepLast DuplicatePolicy = "keep_last"
+
+	// DuplicateReject rejects every event whose ID appears more than once
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// ParseDuplicatePolicy validates a policy name ("" = keep_first)
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(name); p {
+	case "":
+		return DuplicateKeepFirst, nil
+	case DuplicateKeepFirst, DuplicateKeepLast, DuplicateReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate ID policy %q", name)
+	}
+}
+
+// dedupe applies the duplicate policy to a batch, clearing the slots of
+// dropped and rejected events. Each of them gets an error pointing at the
+// index of an event sharing its ID; dropped events count as dropped, not
+// rejected.
+func (h *IngestHandler) dedupe(events []*models.LogEvent, response *IngestResponse, log *requestLogger) {
+	if len(events) < 2 {
+		return
+	}
+
+	// Indexes of the events with each ID, only allocated once one repeats
+	first := make(map[string]int, len(events))
+	var repeated map[string][]int
+	for i, event := range events {
+		if event == nil || event.ID == "" {
+			continue
+		}
+		j, seen := first[event.ID]
+		if !seen {
+			first[event.ID] = i
+			continue
+		}
+		if repeated == nil {
+			repeated = make(map[string][]int)
+		}
+		if repeated[event.ID] == nil {
+			repeated[event.ID] = []int{j}
+		}
+		repeated[event.ID] = append(repeated[event.ID], i)
+	}
+
+	for id, indexes := range repeated {
+		keep := -1
+		switch h.duplicates {
+		case DuplicateKeepFirst:
+			keep = indexes[0]
+		case DuplicateKeepLast:
+			keep = indexes[len(indexes)-1]
+		}
+
+		for n, i := range indexes {
+			if i == keep {
+				continue
+			}
+
+			// Point at the kept event, or at another copy when all are rejected
+			other := keep
+			if other < 0 {
+				other = indexes[0]
+				if n == 0 {
+					other = indexes[1]
+				}
+			}
+
+			tenantID := events[i].TenantID
+			ingestErr := IngestError{
+				Index:       i,
+				EventID:     id,
+				DuplicateOf: &other,
+			}
+			if keep < 0 {
+				ingestErr.Error = fmt.Sprintf("duplicate event ID (also at index %d)", other)
+				response.Rejected++
+				metrics.IngestEventsTotal.WithLabelValues(tenantID, "rejected").Inc()
+				metrics.IngestValidationErrors.WithLabelValues("duplicate_id").Inc()
+			} else {
+				ingestErr.Error = fmt.Sprintf("duplicate event ID, dropped in favour of index %d", other)
+				response.drop(i)
+				metrics.IngestEventsTotal.WithLabelValues(tenantID, "duplicate").Inc()
+			}
+			response.Errors = append(response.Errors, ingestErr)
+			events[i] = nil
+		}
+
+		log.Warn().
+			Str("event_id", id).
+			Ints("indexes", indexes).
+			Str("policy", string(h.duplicates)).
+			Msg("duplicate event ID in batch")
+	}
+}
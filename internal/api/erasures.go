@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/erasure"
+	"parsec/internal/logger"
+)
+
+// ErasureHandler creates and reports tenant data erasure jobs
+type ErasureHandler struct {
+	manager *erasure.Manager
+}
+
+// NewErasureHandler creates a tenant erasure handler; a nil manager reports
+// erasure as unavailable
+func NewErasureHandler(manager *erasure.Manager) *ErasureHandler {
+	return &ErasureHandler{manager: manager}
+}
+
+// ServeHTTP handles POST /admin/tenants/{tenant}/erasures (create a job) and
+// GET /admin/tenants/{tenant}/erasures/{id} (job progress)
+func (h *ErasureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	jobID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "erasures").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+	if h.manager == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "erasure is not configured")
+		return
+	}
+
+	var (
+		job    *erasure.Job
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case jobID == "" && r.Method == http.MethodPost:
+		var req erasure.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"requested_by\": \"...\", \"reference\": \"...\", \"subject\": {\"key\": \"...\", \"value\": \"...\"}}")
+			return
+		}
+		job, err = h.manager.Create(r.Context(), tenantID, req)
+		if errors.Is(err, erasure.ErrMissingRequester) || errors.Is(err, erasure.ErrInvalidSubject) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, erasure.ErrNoTargets) {
+			writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err == nil {
+			status = http.StatusAccepted
+			w.Header().Set("Location", r.URL.Path+"/"+job.ID)
+			log.Info().Str("job_id", job.ID).Str("requested_by", job.RequestedBy).Msg("erasure job created")
+		}
+
+	case jobID != "" && r.Method == http.MethodGet:
+		job, err = h.manager.Get(r.Context(), tenantID, jobID)
+		if errors.Is(err, erasure.ErrJobNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("erasure request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/export"
+	"parsec/internal/logger"
+)
+
+// ExportHandler creates and reports tenant export jobs
+type ExportHandler struct {
+	manager *export.Manager
+}
+
+// NewExportHandler creates a tenant export handler; a nil manager reports
+// exports as unavailable
+func NewExportHandler(manager *export.Manager) *ExportHandler {
+	return &ExportHandler{manager: manager}
+}
+
+// ServeHTTP handles POST /admin/tenants/{tenant}/exports (create a job) and
+// GET /admin/tenants/{tenant}/exports/{id} (job status and download URL)
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	jobID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "exports").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+	if h.manager == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "exports are not configured")
+		return
+	}
+
+	var (
+		job    *export.Job
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case jobID == "" && r.Method == http.MethodPost:
+		var req export.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"from\": RFC3339, \"to\": RFC3339, \"format\": \"ndjson|parquet\"}")
+			return
+		}
+		job, err = h.manager.Create(r.Context(), tenantID, req)
+		if errors.Is(err, export.ErrInvalidRange) || errors.Is(err, export.ErrInvalidFormat) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err == nil {
+			status = http.StatusAccepted
+			w.Header().Set("Location", r.URL.Path+"/"+job.ID)
+			log.Info().Str("job_id", job.ID).Time("from", job.From).Time("to", job.To).Msg("export job created")
+		}
+
+	case jobID != "" && r.Method == http.MethodGet:
+		job, err = h.manager.Get(r.Context(), tenantID, jobID)
+		if errors.Is(err, export.ErrJobNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("export request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// fastPathMaxBody is the largest body read into an exactly sized buffer and
+// tried on the single-event decoder; sidecar events are well under it
+const fastPathMaxBody = 8 * 1024
+
+// requestIDHeader is X-Request-ID in canonical form, which Header.Get looks
+// up without allocating
+const requestIDHeader = "X-Request-Id"
+
+// batchIDSpace is the room reserved after a small body for its batch ID:
+// the node ID plus a dash-separated timestamp and counter
+func batchIDSpace(nodeID string) int {
+	return len(nodeID) + 2 + 2*20
+}
+
+// singleEvent is an event and its envelope allocated together, so an
+// accepted single event costs one allocation besides its body
+type singleEvent struct {
+	envelope models.Envelope
+	event    models.LogEvent
+}
+
+// readBody reads the request body. A small body of known length is read
+// into a buffer of exactly its size, with spare capacity for the batch ID.
+func (h *IngestHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	n := r.ContentLength
+	if n <= 0 || n > fastPathMaxBody || n > h.maxBodySize {
+		return io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	}
+
+	body := make([]byte, n, int(n)+batchIDSpace(h.nodeID))
+	if _, err := io.ReadFull(r.Body, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// appendBatchID appends a unique batch ID to dst
+func (h *IngestHandler) appendBatchID(dst []byte) []byte {
+	counter := atomic.AddUint64(&h.batchCounter, 1)
+	dst = append(dst, h.nodeID...)
+	dst = append(dst, '-')
+	dst = strconv.AppendInt(dst, time.Now().UnixNano(), 10)
+	dst = append(dst, '-')
+	return strconv.AppendUint(dst, counter, 10)
+}
+
+// bodyBatchID writes a batch ID into the spare capacity after body and
+// returns it without copying; body and the ID share one allocation
+func (h *IngestHandler) bodyBatchID(body []byte) string {
+	id := h.appendBatchID(body[len(body):])
+	return unsafe.String(unsafe.SliceData(id), len(id))
+}
+
+// serveSingle ingests a request holding a single event. Only the event and
+// its envelope are allocated, and the request logs at debug level.
+func (h *IngestHandler) serveSingle(w http.ResponseWriter, r *http.Request, format responseFormat, body []byte, event *models.LogEvent, log *requestLogger) {
+	// A single event is also a batch of one
+	size := event.Size()
+	if err := h.checkBatchSize(int64(size)); err != nil {
+		log.Warn().Int("event_bytes", size).Msg("batch too large")
+		metrics.IngestValidationErrors.WithLabelValues("batch_too_large").Inc()
+		h.writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	slot := &singleEvent{event: *event}
+	batchID := h.bodyBatchID(body)
+
+	var response IngestResponse
+	h.ingestEvent(r.Context(), 0, &slot.event, size, &slot.envelope, batchID, &response, log)
+	response.Success = response.Rejected == 0
+
+	log.Debug().
+		Str("event_id", slot.event.ID).
+		Int("accepted", response.Accepted).
+		Int("rejected", response.Rejected).
+		Msg("single event processed")
+
+	h.writeResponse(w, format, response)
+}
+
+// decodeSingle decodes a body holding one event, bare or wrapped as
+// {"event": {...}}, straight into event. Strings without escapes point into
+// body, which must not be modified afterwards. It returns false for anything
+// else (batches, unknown fields, non-string values, bad timestamps or
+// malformed JSON), leaving the general decoder to accept or reject it.
+func decodeSingle(body []byte, event *models.LogEvent) bool {
+	s := scanner{buf: body}
+	if !s.next('{') {
+		return false
+	}
+	key, ok := s.key()
+	if !ok {
+		return false
+	}
+
+	if key == "event" {
+		if !s.next('{') || !s.fields(event, "", false) {
+			return false
+		}
+		return s.next('}') && s.end()
+	}
+
+	// A bare object is only taken for an event when it has an ID
+	return s.fields(event, key, true) && s.end() && event.ID != ""
+}
+
+// scanner reads the flat JSON objects sidecars send
+type scanner struct {
+	buf []byte
+	pos int
+}
+
+// skipSpace skips JSON whitespace
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.buf) {
+		switch s.buf[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// next consumes c if it is the next token
+func (s *scanner) next(c byte) bool {
+	s.skipSpace()
+	if s.pos < len(s.buf) && s.buf[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// null consumes a null literal if it is the next token
+func (s *scanner) null() bool {
+	s.skipSpace()
+	if bytes.HasPrefix(s.buf[s.pos:], []byte("null")) {
+		s.pos += len("null")
+		return true
+	}
+	return false
+}
+
+// end reports whether only whitespace is left
+func (s *scanner) end() bool {
+	s.skipSpace()
+	return s.pos == len(s.buf)
+}
+
+// key reads an object key and its colon
+func (s *scanner) key() (string, bool) {
+	key, ok := s.str()
+	return key, ok && s.next(':')
+}
+
+// str reads a string. Plain strings point into the buffer; escaped or
+// non-UTF-8 ones are decoded by encoding/json so the result matches it.
+func (s *scanner) str() (string, bool) {
+	if !s.next('"') {
+		return "", false
+	}
+
+	start := s.pos
+	plain := true
+	ascii := true
+	for s.pos < len(s.buf) {
+		c := s.buf[s.pos]
+		switch {
+		case c == '"':
+			raw := s.buf[start:s.pos]
+			s.pos++
+			if plain && (ascii || utf8.Valid(raw)) {
+				return unsafe.String(unsafe.SliceData(raw), len(raw)), true
+			}
+			var decoded string
+			if err := json.Unmarshal(s.buf[start-1:s.pos], &decoded); err != nil {
+				return "", false
+			}
+			return decoded, true
+		case c == '\\':
+			plain = false
+			s.pos += 2
+		case c < 0x20:
+			return "", false
+		default:
+			if c >= utf8.RuneSelf {
+				ascii = false
+			}
+			s.pos++
+		}
+	}
+	return "", false
+}
+
+// fields decodes an object's members into event, up to and including the
+// closing brace. key is the first member's key when the caller has read it.
+func (s *scanner) fields(event *models.LogEvent, key string, haveKey bool) bool {
+	if !haveKey {
+		if s.next('}') {
+			return true
+		}
+		var ok bool
+		if key, ok = s.key(); !ok {
+			return false
+		}
+	}
+
+	for {
+		if !s.field(event, key) {
+			return false
+		}
+		if s.next('}') {
+			return true
+		}
+		if !s.next(',') {
+			return false
+		}
+		var ok bool
+		if key, ok = s.key(); !ok {
+			return false
+		}
+	}
+}
+
+// field decodes the value of one member
+func (s *scanner) field(event *models.LogEvent, key string) bool {
+	var dst *string
+	switch key {
+	case "id":
+		dst = &event.ID
+	case "tenant_id":
+		dst = &event.TenantID
+	case "severity":
+		dst = (*string)(&event.Severity)
+	case "source":
+		dst = &event.Source
+	case "message":
+		dst = &event.Message
+	case "trace_id":
+		dst = &event.TraceID
+	case "span_id":
+		dst = &event.SpanID
+	case "timestamp":
+		value, ok := s.str()
+		if !ok {
+			return false
+		}
+		ts, err := models.ParseTimestamp(value)
+		if err != nil {
+			return false
+		}
+		event.Timestamp = ts
+		return true
+	case "metadata":
+		return s.metadata(event)
+	default:
+		return false
+	}
+
+	// null leaves the field as it is, like encoding/json
+	if s.null() {
+		return true
+	}
+	value, ok := s.str()
+	if ok {
+		*dst = value
+	}
+	return ok
+}
+
+// metadata decodes a flat object of strings; other values, such as nested
+// objects, fail the fast path so encoding/json decodes the event
+func (s *scanner) metadata(event *models.LogEvent) bool {
+	if s.null() {
+		event.Metadata = nil
+		return true
+	}
+	if !s.next('{') {
+		return false
+	}
+	if event.Metadata == nil {
+		event.Metadata = make(models.Metadata)
+	}
+	if s.next('}') {
+		return true
+	}
+
+	for {
+		key, ok := s.key()
+		if !ok {
+			return false
+		}
+		value, ok := s.str()
+		if !ok {
+			return false
+		}
+		event.Metadata[key] = value
+
+		if s.next('}') {
+			return true
+		}
+		if !s.next(',') {
+			return false
+		}
+	}
+}
+
+// acceptedOne is the response to a single accepted event
+var acceptedOne = []byte(`{"success":true,"accepted":1,"rejected":0}` + "\n")
+
+// jsonContentType is shared by responses; net/http only reads it
+var jsonContentType = []string{"application/json"}
+
+// responseEncoder is a pooled buffer and JSON encoder writing to it
+type responseEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var responseEncoders = sync.Pool{
+	New: func() any {
+		e := &responseEncoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// writeResponse writes an ingest response in the negotiated format: 400 if
+// every event was rejected, 207 on partial success and 200 otherwise
+func (h *IngestHandler) writeResponse(w http.ResponseWriter, format responseFormat, response IngestResponse) {
+	if format.compact {
+		response.Errors = nil
+		response.Receipt = nil
+		w.Header().Set("Preference-Applied", "return=minimal")
+	}
+	switch format.encoding {
+	case encodeMsgpack:
+		w.Header()["Content-Type"] = msgpackContentType
+	case encodeProtobuf:
+		w.Header()["Content-Type"] = protobufContentType
+	default:
+		w.Header()["Content-Type"] = jsonContentType
+	}
+
+	switch {
+	case response.Rejected > 0 && response.Accepted == 0:
+		w.WriteHeader(http.StatusBadRequest)
+	case response.Rejected > 0:
+		// Partial success — Multi-Status
+		w.WriteHeader(http.StatusMultiStatus)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if format.encoding == encodeJSON && response.Success && response.Accepted == 1 &&
+		response.Rejected == 0 && response.Dropped == 0 && response.Receipt == nil {
+		w.Write(acceptedOne)
+		return
+	}
+
+	e := responseEncoders.Get().(*responseEncoder)
+	e.buf.Reset()
+	switch format.encoding {
+	case encodeMsgpack:
+		e.buf.Write(appendMsgpack(e.buf.AvailableBuffer(), response))
+	case encodeProtobuf:
+		e.buf.Write(appendProtobuf(e.buf.AvailableBuffer(), response))
+	default:
+		e.enc.Encode(response)
+	}
+	w.Write(e.buf.Bytes())
+	responseEncoders.Put(e)
+}
+
+// requestLogger builds the request-scoped logger on first use. Accepted
+// events log nothing above debug, so the hot path never builds it.
+type requestLogger struct {
+	requestID string
+	log       *zerolog.Logger
+}
+
+// event starts a log event at level, or returns nil (a no-op event) when
+// the level is disabled
+func (l *requestLogger) event(level zerolog.Level) *zerolog.Event {
+	if level < zerolog.GlobalLevel() || level < logger.Logger.GetLevel() {
+		return nil
+	}
+	if l.log == nil {
+		log := logger.Logger.With().
+			Str("request_id", l.requestID).
+			Str("handler", "ingest").
+			Logger()
+		l.log = &log
+	}
+	return l.log.WithLevel(level)
+}
+
+func (l *requestLogger) Debug() *zerolog.Event { return l.event(zerolog.DebugLevel) }
+func (l *requestLogger) Info() *zerolog.Event  { return l.event(zerolog.InfoLevel) }
+func (l *requestLogger) Warn() *zerolog.Event  { return l.event(zerolog.WarnLevel) }
+func (l *requestLogger) Error() *zerolog.Event { return l.event(zerolog.ErrorLevel) }
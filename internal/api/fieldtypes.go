@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/coercion"
+	"parsec/internal/logger"
+)
+
+// FieldTypeHandler manages a tenant's metadata field type rules
+type FieldTypeHandler struct {
+	engine *coercion.Engine
+}
+
+// NewFieldTypeHandler creates a field type rules admin handler
+func NewFieldTypeHandler(engine *coercion.Engine) *FieldTypeHandler {
+	return &FieldTypeHandler{engine: engine}
+}
+
+// FieldTypeRules is the request and response body for tenant field types
+type FieldTypeRules struct {
+	TenantID string          `json:"tenant_id"`
+	Rules    []coercion.Rule `json:"rules"`
+}
+
+// ServeHTTP handles GET (list), PUT (replace) and DELETE (clear) for
+// /admin/tenants/{tenant}/field-types
+func (h *FieldTypeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "field_types").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req FieldTypeRules
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"rules\": [{\"field\": ..., \"type\": \"int\"|\"float\"|\"bool\"}]}")
+			return
+		}
+		if err := h.engine.SetRules(r.Context(), tenantID, req.Rules); err != nil {
+			status := http.StatusBadRequest
+			if !isFieldTypeError(err) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist field type rules")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Int("rules", len(req.Rules)).Msg("field type rules updated")
+
+	case http.MethodDelete:
+		if err := h.engine.SetRules(r.Context(), tenantID, nil); err != nil {
+			log.Error().Err(err).Msg("failed to clear field type rules")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Msg("field type rules cleared")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FieldTypeRules{
+		TenantID: tenantID,
+		Rules:    h.engine.Rules(tenantID),
+	})
+}
+
+// isFieldTypeError reports whether err is a client-side rule error
+func isFieldTypeError(err error) bool {
+	for _, target := range []error{
+		coercion.ErrMissingField,
+		coercion.ErrUnknownType,
+		coercion.ErrDuplicateRule,
+		coercion.ErrTooManyRules,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/flags"
+	"parsec/internal/logger"
+)
+
+// FlagsHandler exposes feature flags for inspection and runtime toggling
+type FlagsHandler struct {
+	manager *flags.Manager
+}
+
+// NewFlagsHandler creates a new feature flag admin handler
+func NewFlagsHandler(manager *flags.Manager) *FlagsHandler {
+	return &FlagsHandler{manager: manager}
+}
+
+// SetFlagRequest is the payload for toggling a flag
+type SetFlagRequest struct {
+	Flag string     `json:"flag"`
+	Rule flags.Rule `json:"rule"`
+}
+
+// ServeHTTP returns flags on GET, updates a flag on POST and removes a
+// flag's runtime override on DELETE ?flag=name
+func (h *FlagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "flags").
+		Logger()
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.manager.Snapshot())
+
+	case http.MethodPost:
+		var req SetFlagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Flag == "" {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"flag\": name, \"rule\": {...}}")
+			return
+		}
+
+		if err := h.manager.Set(r.Context(), flags.Flag(req.Flag), req.Rule); err != nil {
+			log.Error().Err(err).Str("flag", req.Flag).Msg("failed to persist feature flag")
+			writeJSONError(w, http.StatusInternalServerError, "failed to persist flag")
+			return
+		}
+
+		log.Info().
+			Str("flag", req.Flag).
+			Bool("enabled", req.Rule.Enabled).
+			Int("percent", req.Rule.Percent).
+			Int("tenant_overrides", len(req.Rule.Tenants)).
+			Msg("feature flag updated")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.manager.Snapshot())
+
+	case http.MethodDelete:
+		flag := r.URL.Query().Get("flag")
+		if flag == "" {
+			writeJSONError(w, http.StatusBadRequest, "expected ?flag=name")
+			return
+		}
+
+		err := h.manager.Delete(r.Context(), flags.Flag(flag))
+		if errors.Is(err, flags.ErrNoOverride) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("flag", flag).Msg("failed to remove feature flag override")
+			writeJSONError(w, http.StatusInternalServerError, "failed to remove flag override")
+			return
+		}
+
+		log.Info().Str("flag", flag).Msg("feature flag override removed")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.manager.Snapshot())
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// writeJSONError writes an error response in the ingest error format
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
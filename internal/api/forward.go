@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/rbac"
+	"parsec/internal/suspension"
+	"parsec/pkg/models"
+)
+
+// ForwardHandler accepts envelopes forwarded by edge nodes. Edge nodes have
+// already run the ingest stages and routing rules, so envelopes are queued
+// as they are.
+type ForwardHandler struct {
+	ingest *IngestHandler
+}
+
+// NewForwardHandler creates a forward handler queueing through the ingest
+// handler's queue and overflow policy
+func NewForwardHandler(ingest *IngestHandler) *ForwardHandler {
+	return &ForwardHandler{ingest: ingest}
+}
+
+// ForwardResponse reports how many leading envelopes were handled. Processed
+// envelopes (queued or rejected as malformed) must not be resent; the rest
+// were refused because the queue was full and should be retried.
+type ForwardResponse struct {
+	Processed int `json:"processed"`
+	Rejected  int `json:"rejected"`
+}
+
+// ForwardResult is the outcome of accepting one forwarded envelope
+type ForwardResult int
+
+const (
+	// ForwardAccepted means the envelope was queued
+	ForwardAccepted ForwardResult = iota
+	// ForwardRejected means the envelope was malformed and dropped
+	ForwardRejected
+	// ForwardQueueFull means the envelope was refused and should be resent
+	ForwardQueueFull
+)
+
+// Accept validates one forwarded envelope line and queues it
+func (h *ForwardHandler) Accept(line []byte) ForwardResult {
+	var envelope models.Envelope
+	if err := json.Unmarshal(line, &envelope); err != nil || envelope.Event == nil || envelope.Event.TenantID == "" {
+		metrics.ForwardReceived.WithLabelValues("rejected").Inc()
+		return ForwardRejected
+	}
+
+	// Events an edge node accepted before a pause are kept; a block drops
+	// them here too
+	if s, suspended := h.ingest.suspensions.Get(envelope.Event.TenantID); suspended && s.Mode == suspension.ModeBlocked {
+		metrics.ForwardReceived.WithLabelValues("rejected").Inc()
+		metrics.SuspendedIngestRefused.WithLabelValues(s.TenantID, string(s.Mode), "event").Inc()
+		return ForwardRejected
+	}
+
+	if !h.ingest.enqueue(&envelope, nil) {
+		metrics.ForwardReceived.WithLabelValues("queue_full").Inc()
+		return ForwardQueueFull
+	}
+	h.ingest.heartbeats.Observe(envelope.Event)
+	h.ingest.feed.Observe(envelope.Event)
+	metrics.ForwardReceived.WithLabelValues("accepted").Inc()
+	metrics.IngestEventsTotal.WithLabelValues(envelope.Event.TenantID, "accepted").Inc()
+	return ForwardAccepted
+}
+
+// Pressure returns how full the ingest queue is, from 0 to 1
+func (h *ForwardHandler) Pressure() float64 {
+	queue := h.ingest.envelopeChan
+	if cap(queue) == 0 {
+		return 0
+	}
+	return float64(len(queue)) / float64(cap(queue))
+}
+
+// ServeHTTP handles a batch of newline-delimited JSON envelopes, optionally
+// gzip-compressed
+func (h *ForwardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "ingest_forward").
+		Logger()
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Edge nodes forward every tenant's events, which keys limited to some
+	// tenants may not
+	if !rbac.Permits(r.Context(), rbac.PermIngest, "") {
+		principal, _ := rbac.FromContext(r.Context())
+		rbac.Denial(principal, rbac.PermIngest, "").
+			Str("request_id", r.Header.Get("X-Request-ID")).
+			Str("path", r.URL.Path).
+			Msg("request not authorized")
+		writeJSONError(w, http.StatusForbidden, "forwarding needs an API key for all tenants")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.ingest.maxBodySize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid gzip body")
+			return
+		}
+		// Bound the decompressed size as well
+		reader = io.LimitReader(gz, h.ingest.maxBodySize)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), int(h.ingest.maxBodySize))
+
+	var resp ForwardResponse
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			resp.Processed++
+			continue
+		}
+
+		result := h.Accept(line)
+		if result == ForwardQueueFull {
+			// The edge node keeps the rest and retries them
+			break
+		}
+		if result == ForwardRejected {
+			log.Warn().Int("index", resp.Processed).Msg("malformed forwarded envelope")
+			resp.Rejected++
+		}
+		resp.Processed++
+	}
+	if err := scanner.Err(); err != nil && resp.Processed == 0 {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Debug().
+		Int("processed", resp.Processed).
+		Int("rejected", resp.Rejected).
+		Str("edge_node", r.Header.Get("X-Parsec-Node")).
+		Msg("forwarded batch queued")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
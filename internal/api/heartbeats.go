@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/alerts"
+	"parsec/internal/logger"
+)
+
+// HeartbeatHandler lets agents register the sources they expect to keep
+// sending events
+type HeartbeatHandler struct {
+	monitor *alerts.HeartbeatMonitor
+}
+
+// NewHeartbeatHandler creates a heartbeat registration handler
+func NewHeartbeatHandler(monitor *alerts.HeartbeatMonitor) *HeartbeatHandler {
+	return &HeartbeatHandler{monitor: monitor}
+}
+
+// HeartbeatRequest is the body of a registration
+type HeartbeatRequest struct {
+	Interval string `json:"interval"`
+}
+
+// HeartbeatList is the response listing a tenant's heartbeats
+type HeartbeatList struct {
+	TenantID   string                   `json:"tenant_id"`
+	Heartbeats []alerts.HeartbeatStatus `json:"heartbeats"`
+}
+
+// ServeHTTP handles GET /heartbeats/{tenant} (list with last-seen times),
+// PUT /heartbeats/{tenant}/{source} (register or change the interval) and
+// DELETE /heartbeats/{tenant}/{source}
+func (h *HeartbeatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	source := r.PathValue("source")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "heartbeats").
+		Str("tenant_id", tenantID).
+		Str("source", source).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && source == "":
+		// fall through to the list below
+
+	case r.Method == http.MethodPut && source != "":
+		var req HeartbeatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"interval\": \"5m\"}")
+			return
+		}
+		registered, err := h.monitor.Register(r.Context(), alerts.Heartbeat{TenantID: tenantID, Source: source, Interval: req.Interval})
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, alerts.ErrInvalidHeartbeat) && !errors.Is(err, alerts.ErrInvalidInterval) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to register heartbeat")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Str("interval", registered.Interval).Msg("heartbeat registered")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(registered)
+		return
+
+	case r.Method == http.MethodDelete && source != "":
+		existed, err := h.monitor.Unregister(r.Context(), tenantID, source)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to remove heartbeat")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !existed {
+			writeJSONError(w, http.StatusNotFound, "heartbeat not found")
+			return
+		}
+		log.Info().Msg("heartbeat removed")
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	statuses, err := h.monitor.Status(r.Context(), tenantID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read heartbeats")
+		writeJSONError(w, http.StatusInternalServerError, "failed to read heartbeats")
+		return
+	}
+	if statuses == nil {
+		statuses = []alerts.HeartbeatStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HeartbeatList{TenantID: tenantID, Heartbeats: statuses})
+}
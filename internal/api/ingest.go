@@ -1,19 +1,72 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/rs/zerolog"
-
+	"parsec/internal/alerts"
 	"parsec/internal/logger"
+	"parsec/internal/memguard"
+	"parsec/internal/metapolicy"
 	"parsec/internal/metrics"
-	"parsec/internal/models"
+	"parsec/internal/multiline"
+	"parsec/internal/pipeline"
+	"parsec/internal/presets"
+	"parsec/internal/queue"
+	"parsec/internal/rbac"
+	"parsec/internal/receipts"
+	"parsec/internal/routing"
+	"parsec/internal/suspension"
+	"parsec/internal/tiers"
+	"parsec/internal/ui"
+	"parsec/pkg/models"
+)
+
+// QueueFullError is the per-event error for events rejected because the
+// queue was full; clients may retry them
+const QueueFullError = "internal queue full, try again later"
+
+// ErrQueueFull is recorded when the envelope queue rejects an event, and
+// returned by Submit
+var ErrQueueFull = errors.New(QueueFullError)
+
+var (
+	// ErrEventTooLarge is returned for events whose canonical size exceeds
+	// the per-event limit
+	ErrEventTooLarge = errors.New("event too large")
+
+	// ErrBatchTooLarge is returned for requests whose events together exceed
+	// the per-batch limit
+	ErrBatchTooLarge = errors.New("batch too large")
+
+	// ErrTenantNotAllowed is the error for events of a tenant the caller's
+	// API key or token is not limited to
+	ErrTenantNotAllowed = errors.New("not allowed to send events for this tenant")
+
+	// ErrMemoryPressure is the error for DEBUG events shed while memory is
+	// close to its limit; clients may retry them
+	ErrMemoryPressure = errors.New("debug events rejected under memory pressure, try again later")
+
+	// ErrTenantRateLimited is the error for events over their tenant's
+	// tier rate; clients may retry them
+	ErrTenantRateLimited = errors.New("tenant rate limit exceeded, try again later")
+)
+
+const (
+	// DefaultMaxEventBytes bounds the canonical size of a single event
+	DefaultMaxEventBytes = 1024 * 1024 // 1MB
+
+	// DefaultMaxBatchBytes bounds the canonical size of a request's events
+	DefaultMaxBatchBytes = 10 * 1024 * 1024 // 10MB
 )
 
 // IngestHandler handles log event ingestion via HTTP
@@ -24,18 +77,131 @@ type IngestHandler struct {
 	// Node identifier for tracking
 	nodeID string
 
+	// Region stamped on envelopes (empty outside multi-region setups)
+	region string
+
 	// Batch counter for generating batch IDs
 	batchCounter uint64
 
 	// Max body size (default 10MB)
 	maxBodySize int64
+
+	// Limits on the canonical (JSON-encoded) size of each event and of all
+	// events in a request, independent of how the body was framed
+	maxEventBytes int
+	maxBatchBytes int64
+
+	// What to do with events sharing an ID within a batch
+	duplicates DuplicatePolicy
+
+	// Stages run on every event before routing
+	pipeline *pipeline.Pipeline
+
+	// Optional multi-line reassembly
+	assembler *multiline.Assembler
+
+	// Topic events are published to (reported by dry runs)
+	topic string
+
+	// Optional per-tenant routing rules
+	router *routing.Engine
+
+	// Optional overflow policy applied when the queue stays full
+	overflow *queue.Overflow
+
+	// Optional dead-man's switch recording when sources were last seen
+	heartbeats *alerts.HeartbeatMonitor
+
+	// Optional feed of recent events for the operator console
+	feed *ui.Feed
+
+	// Optional registry of tenants whose ingestion is suspended
+	suspensions *suspension.Registry
+
+	// Optional tenant tiers limiting rates and setting acks
+	tiers *tiers.Registry
+
+	// Optional memory watchdog deciding which events to shed
+	memory *memguard.Watchdog
+
+	// Optional store of batch receipts
+	receipts *receipts.Store
+
+	// Optional staging area of ?mode=async batches; needs receipts
+	async *asyncIngest
+
+	// Counters for the stages after the pipeline, for introspection
+	routeStats     pipeline.Stats
+	multilineStats pipeline.Stats
+	publishStats   pipeline.Stats
+
+	// Events, and their bytes, handed to the workers
+	accepted      atomic.Uint64
+	acceptedBytes atomic.Uint64
+
+	// stopping guards the queue against sends once Stop is called, as the
+	// processor closes it next
+	stopping sync.RWMutex
+	stopped  bool
 }
 
 // IngestConfig holds configuration for the ingest handler
 type IngestConfig struct {
 	EnvelopeChan chan<- *models.Envelope
 	NodeID       string
+	Region       string
 	MaxBodySize  int64
+	Truncation   models.TruncationPolicy
+	Assembler    *multiline.Assembler
+	Presets      *presets.Registry
+	Topic        string
+	Router       *routing.Engine
+
+	// MaxEventBytes and MaxBatchBytes bound the canonical size of an event
+	// and of all events in a request (0 uses the defaults)
+	MaxEventBytes int
+	MaxBatchBytes int64
+
+	// Duplicates handles events sharing an ID within a batch ("" keeps the
+	// first)
+	Duplicates DuplicatePolicy
+
+	// Metadata strips denied keys and caps value sizes right after format
+	// presets; nil disables it
+	Metadata *metapolicy.Engine
+
+	// Overflow applies an eviction policy when the queue stays full; nil
+	// rejects new events as soon as the queue is full
+	Overflow *queue.Overflow
+
+	// Stages are extra pipeline stages (e.g. tenant scripts) run after
+	// format presets and before truncation and validation
+	Stages []pipeline.Stage
+
+	// Heartbeats is told about every valid event; nil disables it
+	Heartbeats *alerts.HeartbeatMonitor
+
+	// Feed keeps recent events for the operator console; nil disables it
+	Feed *ui.Feed
+
+	// Suspensions refuses events of paused and blocked tenants; nil
+	// disables it
+	Suspensions *suspension.Registry
+
+	// Tiers rate-limits tenants' events and sets their Kafka acks by
+	// service tier; nil disables it. Tier routing defaults are applied by
+	// the Router.
+	Tiers *tiers.Registry
+
+	// Memory sheds DEBUG events under memory pressure; nil disables it
+	Memory *memguard.Watchdog
+
+	// Receipts keeps a receipt of every batch; nil disables receipts
+	Receipts *receipts.Store
+
+	// Async enables ?mode=async batches, reported through their receipts;
+	// nil (or no Receipts) disables it
+	Async *AsyncConfig
 }
 
 // NewIngestHandler creates a new ingest handler
@@ -53,10 +219,58 @@ func NewIngestHandler(cfg IngestConfig) *IngestHandler {
 		maxBodySize = 10 * 1024 * 1024 // 10MB default
 	}
 
+	maxEventBytes := cfg.MaxEventBytes
+	if maxEventBytes == 0 {
+		maxEventBytes = DefaultMaxEventBytes
+	}
+	maxBatchBytes := cfg.MaxBatchBytes
+	if maxBatchBytes == 0 {
+		maxBatchBytes = DefaultMaxBatchBytes
+	}
+
+	duplicates := cfg.Duplicates
+	if duplicates == "" {
+		duplicates = DuplicateKeepFirst
+	}
+
+	stages := []pipeline.Stage{
+		pipeline.NormalizeStage{},
+		pipeline.PresetStage{Registry: cfg.Presets},
+	}
+	if cfg.Metadata != nil {
+		stages = append(stages, cfg.Metadata)
+	}
+	stages = append(stages, cfg.Stages...)
+	stages = append(stages,
+		pipeline.TruncateStage{Policy: cfg.Truncation},
+		pipeline.ValidateStage{},
+	)
+
+	var async *asyncIngest
+	if cfg.Async != nil && cfg.Receipts != nil {
+		async = newAsyncIngest(*cfg.Async)
+	}
+
 	return &IngestHandler{
-		envelopeChan: cfg.EnvelopeChan,
-		nodeID:       nodeID,
-		maxBodySize:  maxBodySize,
+		envelopeChan:  cfg.EnvelopeChan,
+		nodeID:        nodeID,
+		region:        cfg.Region,
+		maxBodySize:   maxBodySize,
+		maxEventBytes: maxEventBytes,
+		maxBatchBytes: maxBatchBytes,
+		duplicates:    duplicates,
+		pipeline:      pipeline.New(stages...),
+		assembler:     cfg.Assembler,
+		topic:         cfg.Topic,
+		router:        cfg.Router,
+		overflow:      cfg.Overflow,
+		heartbeats:    cfg.Heartbeats,
+		feed:          cfg.Feed,
+		suspensions:   cfg.Suspensions,
+		tiers:         cfg.Tiers,
+		memory:        cfg.Memory,
+		receipts:      cfg.Receipts,
+		async:         async,
 	}
 }
 
@@ -67,19 +281,23 @@ type IngestRequest struct {
 
 	// Batch of events
 	Events []LogEventInput `json:"events,omitempty"`
+
+	// BatchRef is the client's own reference for the batch, echoed in its
+	// receipt
+	BatchRef string `json:"batch_ref,omitempty"`
 }
 
 // LogEventInput is the input format for log events (with string timestamp)
 type LogEventInput struct {
-	ID        string            `json:"id"`
-	TenantID  string            `json:"tenant_id"`
-	Timestamp string            `json:"timestamp"` // String for flexible parsing
-	Severity  string            `json:"severity"`
-	Source    string            `json:"source"`
-	Message   string            `json:"message"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
-	TraceID   string            `json:"trace_id,omitempty"`
-	SpanID    string            `json:"span_id,omitempty"`
+	ID        string          `json:"id"`
+	TenantID  string          `json:"tenant_id"`
+	Timestamp string          `json:"timestamp"` // String for flexible parsing
+	Severity  string          `json:"severity"`
+	Source    string          `json:"source"`
+	Message   string          `json:"message"`
+	Metadata  models.Metadata `json:"metadata,omitempty"`
+	TraceID   string          `json:"trace_id,omitempty"`
+	SpanID    string          `json:"span_id,omitempty"`
 }
 
 // IngestResponse is the response returned to clients
@@ -87,7 +305,20 @@ type IngestResponse struct {
 	Success  bool          `json:"success"`
 	Accepted int           `json:"accepted"`
 	Rejected int           `json:"rejected"`
+	Dropped  int           `json:"dropped,omitempty"` // dropped by tenant routing rules
 	Errors   []IngestError `json:"errors,omitempty"`
+
+	// Receipt records every event's outcome when batch receipts are on
+	Receipt *receipts.Receipt `json:"receipt,omitempty"`
+
+	// droppedAt lists the indexes of dropped events, for receipts
+	droppedAt []int
+}
+
+// drop counts the event at index i as dropped
+func (r *IngestResponse) drop(i int) {
+	r.Dropped++
+	r.droppedAt = append(r.droppedAt, i)
 }
 
 // IngestError describes a validation error for a specific event
@@ -95,15 +326,18 @@ type IngestError struct {
 	Index   int    `json:"index"`
 	EventID string `json:"event_id,omitempty"`
 	Error   string `json:"error"`
+
+	// Code identifies refusals clients handle specially, such as
+	// "tenant_paused"
+	Code string `json:"code,omitempty"`
+
+	// DuplicateOf is the index of another event in the batch with the same ID
+	DuplicateOf *int `json:"duplicate_of,omitempty"`
 }
 
 // ServeHTTP handles the ingest HTTP request
 func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	requestID := r.Header.Get("X-Request-ID")
-	log := logger.Logger.With().
-		Str("request_id", requestID).
-		Str("handler", "ingest").
-		Logger()
+	log := &requestLogger{requestID: r.Header.Get(requestIDHeader)}
 
 	// Only accept POST
 	if r.Method != http.MethodPost {
@@ -120,11 +354,48 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Limit body size
-	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	// Pick the response format before ingesting anything
+	format, err := negotiateResponse(r)
+	if errors.Is(err, errNotAcceptable) {
+		log.Warn().Str("accept", r.Header.Get("Accept")).Msg("no acceptable response type")
+		h.writeError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	// Read body
-	body, err := io.ReadAll(r.Body)
+	// ?atomic=true accepts a batch only if every event passes
+	atomic, err := atomicBatch(r)
+	if err != nil {
+		log.Warn().Str("atomic", r.URL.Query().Get("atomic")).Msg("invalid atomic parameter")
+		h.writeError(w, http.StatusBadRequest, "atomic must be true or false")
+		return
+	}
+
+	// X-Parsec-Retention asks storage to keep the events for a while
+	r, err = requestRetention(r)
+	if err != nil {
+		log.Warn().Str("retention", r.Header.Get(retentionHeader)).Msg("invalid retention hint")
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// ?mode=async stages the batch and ingests it in the background
+	async, err := asyncMode(r)
+	if err != nil {
+		log.Warn().Str("mode", r.URL.Query().Get("mode")).Msg("invalid mode parameter")
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if async {
+		h.serveAsync(w, r, atomic, log)
+		return
+	}
+
+	// Read body (limited to maxBodySize)
+	body, err := h.readBody(w, r)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read request body")
 		h.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
@@ -133,28 +404,84 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	log.Debug().Int("body_size", len(body)).Msg("request body read")
 
+	// Most traffic is single events from sidecars; decode those directly
+	// into the event instead of going through IngestRequest
+	var single models.LogEvent
+	if decodeSingle(body, &single) {
+		metrics.IngestBatchSize.Observe(1)
+		h.serveSingle(w, r, format, body, &single, log)
+		return
+	}
+
+	received := time.Now()
+	batchID := h.bodyBatchID(body)
+	response, batchRef, converted, batchErr := h.ingestBatch(r.Context(), body, batchID, atomic, false, log)
+	if batchErr != nil {
+		h.writeError(w, batchErr.status, batchErr.msg)
+		return
+	}
+
+	if h.receipts != nil {
+		w.Header().Set(batchIDHeader, batchID)
+		response.Receipt = h.receipt(r.Context(), batchID, batchRef, received, converted, &response, log)
+	}
+
+	h.writeResponse(w, format, response)
+}
+
+// batchError refuses a batch as a whole, with the HTTP status to respond with
+type batchError struct {
+	status int
+	msg    string
+}
+
+// ingestBatch parses a batch body and ingests its events, returning the
+// response, the client's batch reference and the converted events (nil
+// where conversion failed or a duplicate was removed). Async batches are
+// bounded by their own body limit rather than the batch size limit, and
+// wait for room in the queue instead of having events rejected.
+func (h *IngestHandler) ingestBatch(ctx context.Context, body []byte, batchID string, atomic, async bool, log *requestLogger) (IngestResponse, string, []*models.LogEvent, *batchError) {
+	var response IngestResponse
+
 	// Parse JSON
-	events, err := h.parseBody(body)
+	events, batchRef, err := h.parseBody(body)
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to parse request body")
-		h.writeError(w, http.StatusBadRequest, err.Error())
-		return
+		return response, "", nil, &batchError{http.StatusBadRequest, err.Error()}
+	}
+	if len(batchRef) > receipts.MaxRefLength {
+		return response, "", nil, &batchError{http.StatusBadRequest, fmt.Sprintf("batch_ref exceeds %d characters", receipts.MaxRefLength)}
 	}
 
 	if len(events) == 0 {
 		log.Warn().Msg("no events in request")
-		h.writeError(w, http.StatusBadRequest, "no events provided")
-		return
+		return response, batchRef, nil, &batchError{http.StatusBadRequest, "no events provided"}
 	}
 
 	log.Info().Int("batch_size", len(events)).Msg("processing event batch")
 	metrics.IngestBatchSize.Observe(float64(len(events)))
 
-	// Generate batch ID
-	batchID := h.generateBatchID()
+	// Measure the events themselves: a body holding one huge event is not
+	// a batch
+	converted, sizes, total := h.convertEvents(events, &response, log)
+	if err := h.checkBatchSize(total); err != nil && !async {
+		log.Warn().Int64("batch_bytes", total).Int("batch_size", len(events)).Msg("batch too large")
+		metrics.IngestValidationErrors.WithLabelValues("batch_too_large").Inc()
+		return response, batchRef, nil, &batchError{http.StatusRequestEntityTooLarge, err.Error()}
+	}
+
+	h.dedupe(converted, &response, log)
 
 	// Process events
-	response := h.processEvents(events, batchID, log)
+	switch {
+	case atomic:
+		h.processAtomic(ctx, converted, sizes, batchID, &response, log)
+	case async:
+		h.processPaced(ctx, converted, sizes, batchID, &response, log)
+	default:
+		h.processEvents(ctx, converted, sizes, batchID, &response, log)
+	}
+	sortErrors(response.Errors)
 
 	log.Info().
 		Int("accepted", response.Accepted).
@@ -162,54 +489,45 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Bool("success", response.Success).
 		Msg("batch processing complete")
 
-	// Return response
-	w.Header().Set("Content-Type", "application/json")
-	// If all rejected => 400, if partial success => 207, else 200
-	if response.Rejected > 0 && response.Accepted == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-	} else if response.Rejected > 0 && response.Accepted > 0 {
-		// Partial success — Multi-Status
-		w.WriteHeader(http.StatusMultiStatus)
-	} else {
-		w.WriteHeader(http.StatusOK)
-	}
-	json.NewEncoder(w).Encode(response)
+	return response, batchRef, converted, nil
 }
 
-// parseBody parses the JSON body into a slice of LogEventInput
-func (h *IngestHandler) parseBody(body []byte) ([]LogEventInput, error) {
+// parseBody parses the JSON body into a slice of LogEventInput, with the
+// client's batch reference when the body is an IngestRequest
+func (h *IngestHandler) parseBody(body []byte) ([]LogEventInput, string, error) {
 	// Try parsing as IngestRequest first
 	var req IngestRequest
 	if err := json.Unmarshal(body, &req); err == nil {
 		if len(req.Events) > 0 {
-			return req.Events, nil
+			return req.Events, req.BatchRef, nil
 		}
 		if req.Event != nil {
-			return []LogEventInput{*req.Event}, nil
+			return []LogEventInput{*req.Event}, req.BatchRef, nil
 		}
 	}
 
 	// Try parsing as array of events
 	var events []LogEventInput
 	if err := json.Unmarshal(body, &events); err == nil && len(events) > 0 {
-		return events, nil
+		return events, "", nil
 	}
 
 	// Try parsing as single event
 	var single LogEventInput
 	if err := json.Unmarshal(body, &single); err == nil && single.ID != "" {
-		return []LogEventInput{single}, nil
+		return []LogEventInput{single}, "", nil
 	}
 
-	return nil, fmt.Errorf("invalid JSON format: expected event object or array of events")
+	return nil, "", fmt.Errorf("invalid JSON format: expected event object or array of events")
 }
 
-// processEvents validates, normalizes, and pushes events to the channel
-func (h *IngestHandler) processEvents(inputs []LogEventInput, batchID string, log zerolog.Logger) IngestResponse {
-	response := IngestResponse{
-		Success: true,
-		Errors:  make([]IngestError, 0),
-	}
+// convertEvents converts inputs to events, recording failures in response
+// and leaving their slots nil. It returns each event's canonical size and
+// their total.
+func (h *IngestHandler) convertEvents(inputs []LogEventInput, response *IngestResponse, log *requestLogger) ([]*models.LogEvent, []int, int64) {
+	events := make([]*models.LogEvent, len(inputs))
+	sizes := make([]int, len(inputs))
+	var total int64
 
 	for i, input := range inputs {
 		// Convert input to LogEvent
@@ -232,62 +550,565 @@ func (h *IngestHandler) processEvents(inputs []LogEventInput, batchID string, lo
 			continue
 		}
 
-		// Normalize the event
-		event.Normalize()
+		events[i] = event
+		sizes[i] = event.Size()
+		total += int64(sizes[i])
+	}
 
-		// Validate the event
-		if err := event.Validate(); err != nil {
-			log.Warn().
-				Err(err).
-				Int("index", i).
-				Str("event_id", event.ID).
-				Str("tenant_id", event.TenantID).
-				Msg("validation failed")
+	return events, sizes, total
+}
 
-			response.Errors = append(response.Errors, IngestError{
-				Index:   i,
-				EventID: event.ID,
-				Error:   err.Error(),
-			})
-			response.Rejected++
+// processEvents validates, normalizes, and pushes converted events to the
+// channel, skipping those that failed conversion
+func (h *IngestHandler) processEvents(ctx context.Context, events []*models.LogEvent, sizes []int, batchID string, response *IngestResponse, log *requestLogger) {
+	for i, event := range events {
+		if event != nil {
+			h.ingestEvent(ctx, i, event, sizes[i], nil, batchID, response, log)
+		}
+	}
+
+	response.Success = response.Rejected == 0
+}
+
+// serveEvents ingests events decoded from another input format (Windows
+// XML, browser reports) as one batch, with the same size limits, duplicate
+// handling and response as /ingest
+func (h *IngestHandler) serveEvents(w http.ResponseWriter, r *http.Request, format responseFormat, body []byte, events []*models.LogEvent, log *requestLogger) {
+	sizes := make([]int, len(events))
+	var total int64
+	for i, event := range events {
+		sizes[i] = event.Size()
+		total += int64(sizes[i])
+	}
+	if err := h.checkBatchSize(total); err != nil {
+		log.Warn().Int64("batch_bytes", total).Int("batch_size", len(events)).Msg("batch too large")
+		metrics.IngestValidationErrors.WithLabelValues("batch_too_large").Inc()
+		h.writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	var response IngestResponse
+	h.dedupe(events, &response, log)
+
+	batchID := h.bodyBatchID(body)
+	h.processEvents(r.Context(), events, sizes, batchID, &response, log)
+	sortErrors(response.Errors)
+
+	h.writeResponse(w, format, response)
+}
+
+// sortErrors orders per-event errors by index, since conversion, duplicate
+// and pipeline errors are found in separate passes
+func sortErrors(errs []IngestError) {
+	sort.SliceStable(errs, func(a, b int) bool { return errs[a].Index < errs[b].Index })
+}
+
+// processAtomic ingests a batch all or nothing: events are published only
+// if every one of them converted and passed the pipeline. Otherwise the
+// whole batch is rejected, with errors for the events that failed.
+func (h *IngestHandler) processAtomic(ctx context.Context, events []*models.LogEvent, sizes []int, batchID string, response *IngestResponse, log *requestLogger) {
+	passed := make([]bool, len(events))
+	if response.Rejected == 0 {
+		for i, event := range events {
+			if event != nil {
+				passed[i] = h.checkEvent(ctx, i, event, sizes[i], response, log)
+			}
+		}
+	}
+
+	if response.Rejected > 0 {
+		log.Warn().
+			Int("batch_size", len(events)).
+			Int("failed", response.Rejected).
+			Msg("atomic batch rejected")
+		h.rejectBatch(events, passed, response)
+		return
+	}
+
+	// Refuse the batch up front rather than enqueue part of it: the room
+	// for every event, and its bytes, is reserved before any is queued
+	n, bytes := 0, int64(0)
+	for i, ok := range passed {
+		if ok {
+			n++
+			bytes += int64(events[i].Size())
+		}
+	}
+	var reservation *queue.Reservation
+	if h.overflow != nil {
+		reservation = h.overflow.Reserve(n, bytes)
+	}
+	if reservation == nil && (h.overflow != nil || cap(h.envelopeChan)-len(h.envelopeChan) < n) {
+		log.Warn().Int("batch_size", len(events)).Msg("queue too full for atomic batch")
+		for i, event := range events {
+			if passed[i] {
+				response.Errors = append(response.Errors, IngestError{
+					Index:   i,
+					EventID: event.ID,
+					Error:   QueueFullError,
+				})
+			}
+		}
+		h.rejectBatch(events, passed, response)
+		return
+	}
+	if reservation != nil {
+		defer reservation.Release()
+		ctx = withReservation(ctx, reservation)
+	}
+
+	for i, event := range events {
+		if passed[i] {
+			h.publishEvent(ctx, i, event, nil, batchID, response, log)
+		}
+	}
+	response.Success = response.Rejected == 0
+}
+
+// rejectBatch marks every event of an atomic batch rejected, counting the
+// ones that had passed
+func (h *IngestHandler) rejectBatch(events []*models.LogEvent, passed []bool, response *IngestResponse) {
+	for i, event := range events {
+		if passed[i] {
 			metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
-			metrics.IngestValidationErrors.WithLabelValues("validation_error").Inc()
-			continue
+			metrics.IngestValidationErrors.WithLabelValues("atomic_batch").Inc()
 		}
+	}
+	response.Accepted = 0
+	response.Dropped = 0
+	response.droppedAt = nil
+	response.Rejected = len(events)
+	response.Success = false
+}
 
-		// Create envelope and push to channel
-		envelope := models.NewEnvelope(event, h.nodeID).WithBatch(batchID, i)
+// reservationKey is the context key of an atomic batch's queue reservation
+type reservationKey struct{}
 
-		// Non-blocking send with timeout
-		select {
-		case h.envelopeChan <- envelope:
+// withReservation returns ctx carrying the queue room reserved for a batch
+func withReservation(ctx context.Context, r *queue.Reservation) context.Context {
+	return context.WithValue(ctx, reservationKey{}, r)
+}
+
+// reservationFrom returns the queue room reserved for the batch in ctx, if
+// any
+func reservationFrom(ctx context.Context) *queue.Reservation {
+	r, _ := ctx.Value(reservationKey{}).(*queue.Reservation)
+	return r
+}
+
+// atomicBatch reads the ?atomic= parameter; the query is only parsed when
+// present so plain requests don't pay for it
+func atomicBatch(r *http.Request) (bool, error) {
+	if r.URL.RawQuery == "" {
+		return false, nil
+	}
+	value := r.URL.Query().Get("atomic")
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// checkEventSize enforces the per-event size limit
+func (h *IngestHandler) checkEventSize(size int) error {
+	if size > h.maxEventBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrEventTooLarge, size, h.maxEventBytes)
+	}
+	return nil
+}
+
+// checkBatchSize enforces the per-batch size limit
+func (h *IngestHandler) checkBatchSize(total int64) error {
+	if total > h.maxBatchBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrBatchTooLarge, total, h.maxBatchBytes)
+	}
+	return nil
+}
+
+// ingestEvent runs one event through the pipeline, routing and multi-line
+// reassembly and enqueues it, recording the outcome in response. size is
+// the event's canonical size as received. envelope is filled in if given
+// (the fast path allocates it with the event) and allocated otherwise.
+func (h *IngestHandler) ingestEvent(ctx context.Context, i int, event *models.LogEvent, size int, envelope *models.Envelope, batchID string, response *IngestResponse, log *requestLogger) {
+	if h.checkEvent(ctx, i, event, size, response, log) {
+		h.publishEvent(ctx, i, event, envelope, batchID, response, log)
+	}
+}
+
+// checkEvent enforces the event size limit and runs the event through the
+// pipeline, recording rejected and filtered events in response. It returns
+// true if the event should be published.
+func (h *IngestHandler) checkEvent(ctx context.Context, i int, event *models.LogEvent, size int, response *IngestResponse, log *requestLogger) bool {
+	// Callers limited to some tenants only send events of those
+	if !rbac.Permits(ctx, rbac.PermIngest, event.TenantID) {
+		principal, _ := rbac.FromContext(ctx)
+		rbac.Denial(principal, rbac.PermIngest, event.TenantID).
+			Str("request_id", log.requestID).
+			Str("event_id", event.ID).
+			Msg("event not authorized")
+
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   ErrTenantNotAllowed.Error(),
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues("tenant_not_allowed").Inc()
+		return false
+	}
+
+	if s, suspended := h.suspensions.Get(event.TenantID); suspended {
+		log.Debug().
+			Int("index", i).
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Str("mode", string(s.Mode)).
+			Msg("event of suspended tenant refused")
+
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   s.Error(),
+			Code:    s.Code(),
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues(s.Code()).Inc()
+		metrics.SuspendedIngestRefused.WithLabelValues(event.TenantID, string(s.Mode), "event").Inc()
+		return false
+	}
+
+	if !h.tiers.Allow(event.TenantID) {
+		log.Debug().
+			Int("index", i).
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Msg("event over tenant tier rate limit")
+
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   ErrTenantRateLimited.Error(),
+			Code:    "tenant_rate_limited",
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues("tenant_rate_limited").Inc()
+		return false
+	}
+
+	metrics.IngestEventBytes.WithLabelValues(event.TenantID).Observe(float64(size))
+	if err := h.checkEventSize(size); err != nil {
+		log.Warn().
+			Int("index", i).
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Int("event_bytes", size).
+			Msg("event too large")
+
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   err.Error(),
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues("event_too_large").Inc()
+		return false
+	}
+
+	// Run normalization, presets, scripts, truncation and validation
+	err := h.pipeline.Run(ctx, event)
+	if errors.Is(err, pipeline.ErrDropped) {
+		response.drop(i)
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "filtered").Inc()
+		log.Debug().
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Msg("event filtered by pipeline stage")
+		return false
+	}
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Int("index", i).
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Msg("validation failed")
+
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   err.Error(),
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues("validation_error").Inc()
+		return false
+	}
+
+	// Shed low-value events before they are buffered
+	if h.memory.Sheds(event.Severity) {
+		response.Errors = append(response.Errors, IngestError{
+			Index:   i,
+			EventID: event.ID,
+			Error:   ErrMemoryPressure.Error(),
+		})
+		response.Rejected++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+		metrics.IngestValidationErrors.WithLabelValues("memory_pressure").Inc()
+		metrics.MemoryShedEvents.WithLabelValues(event.TenantID).Inc()
+		return false
+	}
+
+	return true
+}
+
+// publishEvent routes an event that passed the pipeline, holds it for
+// multi-line reassembly or enqueues it, recording the outcome in response
+func (h *IngestHandler) publishEvent(ctx context.Context, i int, event *models.LogEvent, envelope *models.Envelope, batchID string, response *IngestResponse, log *requestLogger) {
+	// A valid event shows its source is alive, even if routing drops it
+	h.heartbeats.Observe(event)
+	h.feed.Observe(event)
+
+	// Apply tenant routing rules; dropped events are not an error
+	decision := h.route(event)
+	if decision.Drop {
+		response.drop(i)
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "dropped_by_rule").Inc()
+		log.Debug().
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Strs("rules", decision.Matched).
+			Msg("event dropped by routing rule")
+		return
+	}
+
+	// Hold continuation lines for reassembly, releasing completed events
+	if h.assembler != nil {
+		start := time.Now()
+		held := true
+		for _, ready := range h.assembler.Add(event) {
+			if ready == event {
+				held = false
+				continue
+			}
+			h.Emit(ready)
+		}
+		h.multilineStats.Record(time.Since(start), pipeline.Result{Changed: held}, nil)
+		if held {
 			response.Accepted++
 			metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "accepted").Inc()
 			log.Debug().
 				Str("event_id", event.ID).
 				Str("tenant_id", event.TenantID).
-				Str("severity", string(event.Severity)).
-				Msg("event enqueued")
-		default:
-			// Channel full - reject event
-			log.Error().
-				Str("event_id", event.ID).
-				Str("tenant_id", event.TenantID).
-				Msg("queue full, event rejected")
+				Msg("event held for multi-line reassembly")
+			return
+		}
+	}
 
-			response.Errors = append(response.Errors, IngestError{
-				Index:   i,
-				EventID: event.ID,
-				Error:   "internal queue full, try again later",
-			})
-			response.Rejected++
-			metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
-			metrics.IngestValidationErrors.WithLabelValues("queue_full").Inc()
+	// Create envelope and push to channel
+	if envelope == nil {
+		envelope = new(models.Envelope)
+	}
+	envelope.Wrap(event, h.nodeID)
+	envelope.WithBatch(batchID, i)
+	envelope.Region = h.region
+	envelope.Topic = decision.Topic
+	envelope.Priority = decision.Priority
+	envelope.Retention = decision.Retention
+	envelope.RetentionSeconds = retentionSeconds(ctx, decision)
+	envelope.Partition = decision.Partition
+	envelope.Acks = h.tiers.Acks(event.TenantID)
+
+	if h.enqueue(envelope, reservationFrom(ctx)) {
+		response.Accepted++
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "accepted").Inc()
+		log.Debug().
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Str("severity", string(event.Severity)).
+			Msg("event enqueued")
+		return
+	}
+
+	// Channel full - reject event
+	log.Error().
+		Str("event_id", event.ID).
+		Str("tenant_id", event.TenantID).
+		Msg("queue full, event rejected")
+
+	response.Errors = append(response.Errors, IngestError{
+		Index:   i,
+		EventID: event.ID,
+		Error:   QueueFullError,
+	})
+	response.Rejected++
+	metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "rejected").Inc()
+	metrics.IngestValidationErrors.WithLabelValues("queue_full").Inc()
+}
+
+// Submit ingests an event read by a built-in input (e.g. the systemd
+// journal) through the same pipeline, routing and queue as HTTP requests.
+// It returns ErrQueueFull when the event should be retried later, with a
+// fresh copy since the pipeline modifies it; any other error means the
+// event was rejected.
+func (h *IngestHandler) Submit(ctx context.Context, event *models.LogEvent) error {
+	var response IngestResponse
+	h.ingestEvent(ctx, 0, event, event.Size(), nil, "", &response, &requestLogger{})
+	if len(response.Errors) == 0 {
+		return nil
+	}
+	if response.Errors[0].Error == QueueFullError {
+		return ErrQueueFull
+	}
+	if response.Errors[0].Error == ErrMemoryPressure.Error() {
+		return ErrMemoryPressure
+	}
+	if response.Errors[0].Error == ErrTenantRateLimited.Error() {
+		return ErrTenantRateLimited
+	}
+	return errors.New(response.Errors[0].Error)
+}
+
+// prepare runs an event through the ingest pipeline and returns the stages
+// that applied to it. Stages skip metrics when ctx is a dry run.
+func (h *IngestHandler) prepare(ctx context.Context, event *models.LogEvent) ([]string, error) {
+	traces, err := h.pipeline.Process(ctx, event)
+	return stageLabels(traces), err
+}
+
+// stageLabels flattens stage traces into the names reported by dry runs.
+// Normalize and validate always run; other stages are listed only when they
+// applied, with their detail (e.g. "preset:nginx:parsed").
+func stageLabels(traces []pipeline.StageTrace) []string {
+	labels := make([]string, 0, len(traces))
+	for _, t := range traces {
+		switch {
+		case t.Stage == "normalize" || t.Stage == "validate":
+			labels = append(labels, t.Stage)
+			if t.Detail != "" {
+				labels = append(labels, t.Detail)
+			}
+		case t.Changed || t.Drop || t.Error != "" || t.Detail != "":
+			if t.Detail != "" {
+				labels = append(labels, t.Stage+":"+t.Detail)
+			} else {
+				labels = append(labels, t.Stage)
+			}
 		}
 	}
+	return labels
+}
 
-	response.Success = response.Rejected == 0
-	return response
+// Emit enqueues an event completed outside of a request (e.g. a multi-line
+// event flushed on timeout). Events are dropped if the queue is full.
+func (h *IngestHandler) Emit(event *models.LogEvent) {
+	h.EmitToPartition(event, nil)
+}
+
+// EmitToPartition is Emit writing the event to partition (when not nil)
+// over any routing rule's, e.g. for canaries probing each partition
+func (h *IngestHandler) EmitToPartition(event *models.LogEvent, partition *int) {
+	decision := h.route(event)
+	if decision.Drop {
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "dropped_by_rule").Inc()
+		return
+	}
+
+	envelope := models.NewEnvelope(event, h.nodeID)
+	envelope.Region = h.region
+	envelope.Topic = decision.Topic
+	envelope.Priority = decision.Priority
+	envelope.Retention = decision.Retention
+	envelope.RetentionSeconds = decision.RetentionSeconds
+	envelope.Partition = decision.Partition
+	envelope.Acks = h.tiers.Acks(event.TenantID)
+	if partition != nil {
+		envelope.Partition = partition
+	}
+
+	if !h.enqueue(envelope, nil) {
+		msg := "queue full, flushed event dropped"
+		if h.Stopped() {
+			msg = "ingest stopped, flushed event dropped"
+		}
+		log := logger.WithComponent("ingest")
+		log.Error().
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID).
+			Msg(msg)
+		metrics.IngestEventsTotal.WithLabelValues(event.TenantID, "dropped").Inc()
+	}
+}
+
+// Stop makes every later enqueue fail, waiting for those in progress, so
+// the queue can be closed without a late Emit sending on it
+func (h *IngestHandler) Stop() {
+	h.stopping.Lock()
+	defer h.stopping.Unlock()
+	h.stopped = true
+}
+
+// Stopped reports whether Stop was called
+func (h *IngestHandler) Stopped() bool {
+	h.stopping.RLock()
+	defer h.stopping.RUnlock()
+	return h.stopped
+}
+
+// enqueue hands an envelope to the workers without blocking, applying the
+// overflow policy if one is configured, or into the room of reservation
+// when not nil. It fails once Stop is called.
+func (h *IngestHandler) enqueue(envelope *models.Envelope, reservation *queue.Reservation) bool {
+	h.stopping.RLock()
+	defer h.stopping.RUnlock()
+	if h.stopped {
+		h.publishStats.Record(0, pipeline.Result{}, ErrIngestStopped)
+		return false
+	}
+
+	// Sized up front: once queued, the envelope belongs to the workers
+	size := envelope.Event.Size()
+	accepted := false
+	if reservation != nil {
+		accepted = reservation.Put(envelope)
+	} else if h.overflow != nil {
+		accepted = h.overflow.Offer(envelope)
+	} else {
+		select {
+		case h.envelopeChan <- envelope:
+			accepted = true
+		default:
+		}
+	}
+
+	if accepted {
+		h.publishStats.Record(0, pipeline.Result{}, nil)
+		h.accepted.Add(1)
+		h.acceptedBytes.Add(uint64(size))
+	} else {
+		h.publishStats.Record(0, pipeline.Result{}, ErrQueueFull)
+	}
+	return accepted
+}
+
+// Accepted returns how many events, and bytes of events, were handed to
+// the workers
+func (h *IngestHandler) Accepted() (events, bytes uint64) {
+	return h.accepted.Load(), h.acceptedBytes.Load()
+}
+
+// route evaluates the tenant's routing rules, counting the outcome
+func (h *IngestHandler) route(event *models.LogEvent) routing.Decision {
+	start := time.Now()
+	decision := h.router.Evaluate(event)
+	h.routeStats.Record(time.Since(start), pipeline.Result{
+		Drop:    decision.Drop,
+		Changed: decision.Topic != "" || decision.Priority != "" || decision.Retention != "" || decision.RetentionSeconds > 0 || decision.Partition != nil,
+	}, nil)
+	return decision
 }
 
 // convertInput converts LogEventInput to LogEvent
@@ -311,18 +1132,7 @@ func (h *IngestHandler) convertInput(input LogEventInput) (*models.LogEvent, err
 	}, nil
 }
 
-// generateBatchID generates a unique batch ID
-func (h *IngestHandler) generateBatchID() string {
-	counter := atomic.AddUint64(&h.batchCounter, 1)
-	return fmt.Sprintf("%s-%d-%d", h.nodeID, time.Now().UnixNano(), counter)
-}
-
 // writeError writes an error response
 func (h *IngestHandler) writeError(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": false,
-		"error":   message,
-	})
+	writeJSONError(w, status, message)
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"parsec/internal/jobs"
+	"parsec/internal/logger"
+)
+
+// JobsHandler lists, reports and cancels background jobs of every kind
+type JobsHandler struct {
+	scheduler *jobs.Scheduler
+}
+
+// NewJobsHandler creates a background jobs admin handler
+func NewJobsHandler(scheduler *jobs.Scheduler) *JobsHandler {
+	return &JobsHandler{scheduler: scheduler}
+}
+
+// ServeHTTP handles GET /admin/jobs (list, filtered by the kind, status,
+// tenant and limit query parameters), GET /admin/jobs/{id} and
+// DELETE /admin/jobs/{id} (cancel)
+func (h *JobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "jobs").
+		Logger()
+
+	var (
+		resp   any
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case jobID == "" && r.Method == http.MethodGet:
+		q := r.URL.Query()
+		filter := jobs.Filter{Kind: q.Get("kind"), Status: q.Get("status"), TenantID: q.Get("tenant")}
+		if limit := q.Get("limit"); limit != "" {
+			if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+		}
+		var records []jobs.Record
+		records, err = h.scheduler.List(r.Context(), filter)
+		resp = map[string]any{"jobs": records}
+
+	case jobID != "" && r.Method == http.MethodGet:
+		resp, err = h.scheduler.Get(r.Context(), jobID)
+
+	case jobID != "" && r.Method == http.MethodDelete:
+		var rec *jobs.Record
+		rec, err = h.scheduler.Cancel(r.Context(), jobID)
+		if errors.Is(err, jobs.ErrJobFinished) {
+			writeJSONError(w, http.StatusConflict, "job already "+rec.Status)
+			return
+		}
+		if err == nil {
+			status = http.StatusAccepted
+			resp = rec
+			log.Info().Str("job_id", jobID).Str("kind", rec.Kind).Str("tenant_id", rec.TenantID).Msg("job cancellation requested")
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("jobs request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
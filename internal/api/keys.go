@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/rbac"
+)
+
+// KeysHandler lists API keys and rotates them
+type KeysHandler struct {
+	authn   *rbac.Authenticator
+	overlap time.Duration
+}
+
+// NewKeysHandler creates an API key admin handler. Rotated keys keep
+// working for overlap unless the request gives another window.
+func NewKeysHandler(authn *rbac.Authenticator, overlap time.Duration) *KeysHandler {
+	return &KeysHandler{authn: authn, overlap: overlap}
+}
+
+// RotateKeyRequest is the optional body of a rotation. Durations are Go
+// durations such as "24h".
+type RotateKeyRequest struct {
+	// Overlap is how long the replaced keys keep working
+	Overlap string `json:"overlap,omitempty"`
+
+	// ExpiresIn is the new key's lifetime ("" = never expires)
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// ServeHTTP handles GET /admin/keys (every key without its secret) and
+// POST /admin/keys/{id}/rotate, which returns the new key once. Rotating
+// needs an unlimited role whose scope covers the key's, as the response
+// carries a working secret.
+func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keyID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "keys").
+		Logger()
+
+	switch {
+	case keyID == "" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"keys": h.authn.Keys()})
+		return
+
+	case keyID != "" && r.Method == http.MethodPost:
+		// handled below
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	principal, _ := rbac.FromContext(r.Context())
+	if !rbac.Permits(r.Context(), rbac.PermManage, "") {
+		rbac.Denial(principal, rbac.PermManage, "").
+			Str("request_id", r.Header.Get("X-Request-ID")).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("key_id", keyID).
+			Msg("request not authorized")
+		writeJSONError(w, http.StatusForbidden, "rotating API keys needs a role for all tenants")
+		return
+	}
+	var key *rbac.KeyInfo
+	for _, k := range h.authn.Keys() {
+		if k.ID == keyID {
+			key = &k
+			break
+		}
+	}
+	if key == nil {
+		writeJSONError(w, http.StatusNotFound, rbac.ErrUnknownKey.Error())
+		return
+	}
+	if principal != nil && !principal.Covers(key.Role, key.Tenants) {
+		rbac.Denial(principal, rbac.PermManage, "").
+			Str("request_id", r.Header.Get("X-Request-ID")).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("key_id", keyID).
+			Str("key_role", string(key.Role)).
+			Msg("request not authorized")
+		writeJSONError(w, http.StatusForbidden, "may not rotate a key with a wider scope than your own")
+		return
+	}
+
+	var req RotateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "expected {\"overlap\": \"24h\", \"expires_in\": \"2160h\"}")
+		return
+	}
+	overlap := h.overlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			writeJSONError(w, http.StatusBadRequest, "overlap must be a non-negative duration such as \"24h\"")
+			return
+		}
+		overlap = d
+	}
+	var lifetime time.Duration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= overlap {
+			writeJSONError(w, http.StatusBadRequest, "expires_in must be a duration longer than the overlap")
+			return
+		}
+		lifetime = d
+	}
+
+	rotation, err := h.authn.Rotate(r.Context(), keyID, overlap, lifetime)
+	if errors.Is(err, rbac.ErrUnknownKey) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("key_id", keyID).Msg("failed to rotate API key")
+		writeJSONError(w, http.StatusInternalServerError, "failed to rotate key")
+		return
+	}
+
+	event := log.Info().
+		Bool("audit", true).
+		Str("key_id", keyID).
+		Time("previous_expire_at", rotation.PreviousExpireAt)
+	if p, ok := rbac.FromContext(r.Context()); ok {
+		event = event.Str("principal", p.Name).Str("role", string(p.Role))
+	}
+	event.Msg("API key rotated")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rotation)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/ratelimit"
+)
+
+// LimitsHandler reports the caller's current rate limit quota
+type LimitsHandler struct {
+	limiter *ratelimit.Limiter
+}
+
+// NewLimitsHandler creates a quota introspection handler (limiter may be nil)
+func NewLimitsHandler(limiter *ratelimit.Limiter) *LimitsHandler {
+	return &LimitsHandler{limiter: limiter}
+}
+
+// LimitsResponse is the caller's quota; Quota is omitted when limiting is off
+type LimitsResponse struct {
+	Enabled bool             `json:"enabled"`
+	Quota   *ratelimit.Quota `json:"quota,omitempty"`
+}
+
+// ServeHTTP handles GET /limits. Checking the quota does not consume it.
+func (h *LimitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var response LimitsResponse
+	if h.limiter != nil {
+		quota, err := h.limiter.Peek(r.Context(), ratelimit.CallerID(r))
+		if err != nil {
+			log := logger.Logger.With().
+				Str("request_id", r.Header.Get("X-Request-ID")).
+				Str("handler", "limits").
+				Logger()
+			log.Error().Err(err).Msg("failed to read rate limit quota")
+			writeJSONError(w, http.StatusInternalServerError, "failed to read quota")
+			return
+		}
+		response.Enabled = true
+		response.Quota = &quota
+		ratelimit.SetHeaders(w, quota)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
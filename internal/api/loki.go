@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/export"
+	"parsec/internal/logger"
+	"parsec/internal/logql"
+	"parsec/internal/querycache"
+	"parsec/pkg/models"
+)
+
+// lokiTenantHeader names the tenant of a query, as Loki's multi-tenancy
+// does; Grafana sends it when set as a custom header on the datasource
+const lokiTenantHeader = "X-Scope-OrgID"
+
+// lokiLabels are the stream labels of events: the source, and the severity
+// in lower case as level, which Grafana colours log lines by
+var lokiLabels = []string{"level", "source"}
+
+// LokiConfig holds limits of the Loki-compatible query API
+type LokiConfig struct {
+	// MaxLimit bounds the lines one query returns (0 = 5000)
+	MaxLimit int
+
+	// MaxRange bounds the time range one query scans (0 = 24h)
+	MaxRange time.Duration
+
+	// Cache keeps query results for a few seconds (nil = no cache)
+	Cache *querycache.Cache
+
+	// OnQuery, when set, is called with the tenant of each query run, e.g.
+	// to meter usage
+	OnQuery func(tenantID string)
+}
+
+// LokiHandler serves the read endpoints of Loki's HTTP API over stored
+// events, so Grafana's Loki datasource can explore them without a plugin.
+// Each event is a line of its message in the stream of its labels.
+type LokiHandler struct {
+	source export.Source
+	cfg    LokiConfig
+}
+
+// NewLokiHandler creates a Loki-compatible query handler reading events
+// from source
+func NewLokiHandler(source export.Source, cfg LokiConfig) *LokiHandler {
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 5000
+	}
+	if cfg.MaxRange <= 0 {
+		cfg.MaxRange = 24 * time.Hour
+	}
+	return &LokiHandler{source: source, cfg: cfg}
+}
+
+// lokiResponse is the envelope of every Loki API response
+type lokiResponse struct {
+	Status string `json:"status"`
+	Data   any    `json:"data"`
+}
+
+// lokiStreams is the data of a log query
+type lokiStreams struct {
+	ResultType string         `json:"resultType"`
+	Result     []lokiStream   `json:"result"`
+	Stats      map[string]any `json:"stats"`
+}
+
+// lokiStream is one stream's lines, as [nanosecond timestamp, line] pairs
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// streamLabels returns an event's stream labels
+func streamLabels(event *models.LogEvent) map[string]string {
+	return map[string]string{
+		"level":  strings.ToLower(string(event.Severity)),
+		"source": event.Source,
+	}
+}
+
+// Labels handles GET /loki/api/v1/labels, the label names of streams
+func (h *LokiHandler) Labels(w http.ResponseWriter, r *http.Request) {
+	writeLoki(w, lokiLabels)
+}
+
+// LabelValues handles GET /loki/api/v1/label/{name}/values, the values a
+// label takes in the tenant's streams over start..end, optionally within
+// the streams matching ?query=
+func (h *LokiHandler) LabelValues(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	log := h.logger(r)
+
+	query := &logql.Query{}
+	if selector := r.URL.Query().Get("query"); selector != "" {
+		var err error
+		if query, err = logql.ParseSelector(selector); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	tenantID, err := lokiTenant(r, query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := h.timeRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !isLokiLabel(name) {
+		writeLoki(w, []string{})
+		return
+	}
+	h.queried(tenantID)
+	key := h.cacheKey(from, to, "label_values", name, query.String())
+	body, err := h.cached(r, tenantID, key, func(ctx context.Context) ([]byte, error) {
+		values := []string{}
+		seen := make(map[string]bool)
+		err := h.source.Scan(ctx, tenantID, from, to, func(event *models.LogEvent) error {
+			labels := streamLabels(event)
+			if value := labels[name]; value != "" && !seen[value] && query.Matches(labels, event.Message) {
+				seen[value] = true
+				values = append(values, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(values)
+		return lokiBody(values)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("tenant_id", tenantID).Msg("label values scan failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeLokiBody(w, body)
+}
+
+// Query handles GET /loki/api/v1/query. Like Loki, log queries are only
+// run over a range.
+func (h *LokiHandler) Query(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusBadRequest, "log queries are not supported as an instant query type, use /loki/api/v1/query_range")
+}
+
+// QueryRange handles GET /loki/api/v1/query_range: the lines matching
+// ?query= between ?start= and ?end=, up to ?limit= of them, newest first
+// (?direction=backward) or oldest first (forward)
+func (h *LokiHandler) QueryRange(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	log := h.logger(r)
+
+	query, err := logql.Parse(params.Get("query"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tenantID, err := lokiTenant(r, query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := h.timeRange(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := min(100, h.cfg.MaxLimit)
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+	if limit > h.cfg.MaxLimit {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("max entries limit per query exceeded, limit > max_entries_limit (%d > %d)", limit, h.cfg.MaxLimit))
+		return
+	}
+
+	forward := false
+	switch params.Get("direction") {
+	case "", "backward", "BACKWARD":
+	case "forward", "FORWARD":
+		forward = true
+	default:
+		writeJSONError(w, http.StatusBadRequest, "direction must be forward or backward")
+		return
+	}
+
+	h.queried(tenantID)
+	key := h.cacheKey(from, to, "query_range", query.String(), strconv.Itoa(limit), strconv.FormatBool(forward))
+	body, err := h.cached(r, tenantID, key, func(ctx context.Context) ([]byte, error) {
+		// Events arrive in topic order, so the first limit lines of the
+		// direction are kept by sorting and trimming as they accumulate
+		var events []*models.LogEvent
+		before := func(a, b *models.LogEvent) bool {
+			if forward {
+				return a.Timestamp.Before(b.Timestamp)
+			}
+			return a.Timestamp.After(b.Timestamp)
+		}
+		trim := func() {
+			sort.SliceStable(events, func(a, b int) bool { return before(events[a], events[b]) })
+			if len(events) > limit {
+				events = events[:limit]
+			}
+		}
+		err := h.source.Scan(ctx, tenantID, from, to, func(event *models.LogEvent) error {
+			if query.Matches(streamLabels(event), event.Message) {
+				events = append(events, event)
+				if len(events) >= 2*limit {
+					trim()
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		trim()
+
+		return lokiBody(lokiStreams{
+			ResultType: "streams",
+			Result:     groupStreams(events),
+			Stats:      map[string]any{},
+		})
+	})
+	if err != nil {
+		log.Error().Err(err).Str("tenant_id", tenantID).Msg("query scan failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeLokiBody(w, body)
+}
+
+// queried reports a query run for a tenant
+func (h *LokiHandler) queried(tenantID string) {
+	if h.cfg.OnQuery != nil {
+		h.cfg.OnQuery(tenantID)
+	}
+}
+
+// cacheKey keys a query's result by its parts and its range, rounded to the
+// cache's bucket
+func (h *LokiHandler) cacheKey(from, to time.Time, parts ...string) string {
+	if h.cfg.Cache == nil {
+		return ""
+	}
+	return querycache.Key(append(parts, h.cfg.Cache.Bucket(from), h.cfg.Cache.Bucket(to))...)
+}
+
+// cached runs a query through the cache, if there is one
+func (h *LokiHandler) cached(r *http.Request, tenantID, key string, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	if h.cfg.Cache == nil {
+		return load(r.Context())
+	}
+	return h.cfg.Cache.Do(r.Context(), tenantID, key, load)
+}
+
+// Count counts a tenant's lines matching query over from..to, for saved
+// search alerts
+func (h *LokiHandler) Count(ctx context.Context, tenantID, query string, from, to time.Time) (int, error) {
+	q, err := logql.Parse(query)
+	if err != nil {
+		return 0, err
+	}
+	if matched, found, err := q.Take("tenant"); err != nil {
+		return 0, err
+	} else if found && matched != tenantID {
+		return 0, fmt.Errorf("query matches tenant %q, not %q", matched, tenantID)
+	}
+
+	count := 0
+	err = h.source.Scan(ctx, tenantID, from, to, func(event *models.LogEvent) error {
+		if q.Matches(streamLabels(event), event.Message) {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// groupStreams groups ordered events into streams by their labels, keeping
+// their order within each stream
+func groupStreams(events []*models.LogEvent) []lokiStream {
+	streams := []lokiStream{}
+	index := make(map[string]int)
+	for _, event := range events {
+		labels := streamLabels(event)
+		key := labels["level"] + "\x00" + labels["source"]
+		i, ok := index[key]
+		if !ok {
+			i = len(streams)
+			index[key] = i
+			streams = append(streams, lokiStream{Stream: labels})
+		}
+		streams[i].Values = append(streams[i].Values, [2]string{
+			strconv.FormatInt(event.Timestamp.UnixNano(), 10),
+			event.Message,
+		})
+	}
+	return streams
+}
+
+// lokiTenant reads the tenant from the X-Scope-OrgID header or a
+// {tenant="..."} matcher, which is removed from the query
+func lokiTenant(r *http.Request, query *logql.Query) (string, error) {
+	header := r.Header.Get(lokiTenantHeader)
+	matched, found, err := query.Take("tenant")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case header != "" && found && matched != header:
+		return "", fmt.Errorf("tenant %q doesn't match %s %q", matched, lokiTenantHeader, header)
+	case header != "":
+		return header, nil
+	case found:
+		return matched, nil
+	}
+	return "", errors.New("a tenant is required: set " + lokiTenantHeader + " or match {tenant=\"...\"}")
+}
+
+// timeRange reads ?start= and ?end= (default: the last hour), which must
+// not span more than the configured range
+func (h *LokiHandler) timeRange(r *http.Request) (time.Time, time.Time, error) {
+	params := r.URL.Query()
+	to := time.Now()
+	if v := params.Get("end"); v != "" {
+		t, err := parseLokiTime(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %w", err)
+		}
+		to = t
+	}
+	from := to.Add(-time.Hour)
+	if v := params.Get("start"); v != "" {
+		t, err := parseLokiTime(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %w", err)
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("start must be before end")
+	}
+	if to.Sub(from) > h.cfg.MaxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("the query time range exceeds the limit (%s)", h.cfg.MaxRange)
+	}
+	// Loki's end is inclusive; the scan's is not
+	return from, to.Add(time.Nanosecond), nil
+}
+
+// parseLokiTime parses a timestamp the ways Loki accepts: RFC3339, Unix
+// seconds with a fraction, or an integer of Unix seconds or, when too large
+// to be seconds, nanoseconds
+func parseLokiTime(s string) (time.Time, error) {
+	if strings.Contains(s, "T") {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	if strings.Contains(s, ".") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if n > 1e12 {
+		return time.Unix(0, n), nil
+	}
+	return time.Unix(n, 0), nil
+}
+
+// isLokiLabel reports whether name is a stream label
+func isLokiLabel(name string) bool {
+	for _, label := range lokiLabels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// logger returns the request's logger
+func (h *LokiHandler) logger(r *http.Request) *zerolog.Logger {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "loki").
+		Logger()
+	return &log
+}
+
+// writeLoki writes a successful Loki API response
+func writeLoki(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lokiResponse{Status: "success", Data: data})
+}
+
+// lokiBody encodes a successful Loki API response, as writeLoki writes it
+func lokiBody(data any) ([]byte, error) {
+	body, err := json.Marshal(lokiResponse{Status: "success", Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// writeLokiBody writes an encoded Loki API response
+func writeLokiBody(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
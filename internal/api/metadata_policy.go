@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/metapolicy"
+)
+
+// MetadataPolicyHandler manages a tenant's metadata key allow/deny lists
+type MetadataPolicyHandler struct {
+	engine *metapolicy.Engine
+}
+
+// NewMetadataPolicyHandler creates a metadata policy admin handler
+func NewMetadataPolicyHandler(engine *metapolicy.Engine) *MetadataPolicyHandler {
+	return &MetadataPolicyHandler{engine: engine}
+}
+
+// MetadataPolicy is the request and response body for a tenant's policy
+type MetadataPolicy struct {
+	TenantID string `json:"tenant_id"`
+	metapolicy.Policy
+}
+
+// ServeHTTP handles GET, PUT (replace) and DELETE (clear) for
+// /admin/tenants/{tenant}/metadata-policy
+func (h *MetadataPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "metadata_policy").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req MetadataPolicy
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"allow\": [...], \"deny\": [...]}")
+			return
+		}
+		policy, err := h.engine.SetPolicy(r.Context(), tenantID, req.Policy)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, metapolicy.ErrInvalidPattern) && !errors.Is(err, metapolicy.ErrTooManyKeys) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist metadata policy")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Int("allow", len(policy.Allow)).Int("deny", len(policy.Deny)).Msg("metadata policy updated")
+
+	case http.MethodDelete:
+		if _, err := h.engine.SetPolicy(r.Context(), tenantID, metapolicy.Policy{}); err != nil {
+			log.Error().Err(err).Msg("failed to clear metadata policy")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Msg("metadata policy cleared")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MetadataPolicy{
+		TenantID: tenantID,
+		Policy:   h.engine.Policy(tenantID),
+	})
+}
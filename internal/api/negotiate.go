@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Media types ingest responses can be encoded as
+const (
+	mediaJSON     = "application/json"
+	mediaMsgpack  = "application/msgpack"
+	mediaProtobuf = "application/x-protobuf"
+)
+
+var (
+	msgpackContentType  = []string{mediaMsgpack}
+	protobufContentType = []string{mediaProtobuf}
+)
+
+// errNotAcceptable is returned when the Accept header names no supported
+// media type
+var errNotAcceptable = errors.New("acceptable response types: " + mediaJSON + ", " + mediaMsgpack + ", " + mediaProtobuf)
+
+// responseEncoding selects the encoding of an ingest response
+type responseEncoding uint8
+
+const (
+	encodeJSON responseEncoding = iota
+	encodeMsgpack
+	encodeProtobuf
+)
+
+// mediaEncodings maps accepted media types (and their common aliases) to
+// encodings
+var mediaEncodings = map[string]responseEncoding{
+	"*/*":                             encodeJSON,
+	"application/*":                   encodeJSON,
+	mediaJSON:                         encodeJSON,
+	mediaMsgpack:                      encodeMsgpack,
+	"application/x-msgpack":           encodeMsgpack,
+	"application/vnd.msgpack":         encodeMsgpack,
+	mediaProtobuf:                     encodeProtobuf,
+	"application/protobuf":            encodeProtobuf,
+	"application/vnd.google.protobuf": encodeProtobuf,
+}
+
+// responseFormat is how a request wants its ingest response written. The
+// zero value is the full JSON response.
+type responseFormat struct {
+	encoding responseEncoding
+
+	// compact leaves out per-event errors, keeping only the counts
+	compact bool
+}
+
+// negotiateResponse picks the response format from the Accept header, and
+// compact mode from "Prefer: return=minimal" or ?compact=true. It is
+// called before any event is ingested so an unacceptable request has no
+// effect.
+func negotiateResponse(r *http.Request) (responseFormat, error) {
+	var format responseFormat
+
+	for _, prefer := range r.Header.Values("Prefer") {
+		for _, token := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "return=minimal") {
+				format.compact = true
+			}
+		}
+	}
+	if r.URL.RawQuery != "" {
+		if compact := r.URL.Query().Get("compact"); compact != "" {
+			v, err := strconv.ParseBool(compact)
+			if err != nil {
+				return format, errors.New("compact must be true or false")
+			}
+			format.compact = v
+		}
+	}
+
+	accept := r.Header.Get("Accept")
+	switch accept {
+	case "", "*/*", mediaJSON:
+		return format, nil
+	}
+
+	best := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		encoding, ok := mediaEncodings[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		// The first of equally preferred types wins
+		if q > 0 && q > best {
+			best = q
+			format.encoding = encoding
+		}
+	}
+	if best < 0 {
+		return format, errNotAcceptable
+	}
+	return format, nil
+}
+
+// appendMsgpack encodes a response as a MessagePack map with the same keys
+// (and omitted empty fields) as its JSON form
+func appendMsgpack(b []byte, response IngestResponse) []byte {
+	fields := 3
+	if response.Dropped != 0 {
+		fields++
+	}
+	if len(response.Errors) > 0 {
+		fields++
+	}
+
+	b = append(b, 0x80|byte(fields)) // fixmap
+	b = appendMsgpackString(b, "success")
+	if response.Success {
+		b = append(b, 0xc3)
+	} else {
+		b = append(b, 0xc2)
+	}
+	b = appendMsgpackString(b, "accepted")
+	b = appendMsgpackInt(b, int64(response.Accepted))
+	b = appendMsgpackString(b, "rejected")
+	b = appendMsgpackInt(b, int64(response.Rejected))
+	if response.Dropped != 0 {
+		b = appendMsgpackString(b, "dropped")
+		b = appendMsgpackInt(b, int64(response.Dropped))
+	}
+	if len(response.Errors) == 0 {
+		return b
+	}
+
+	b = appendMsgpackString(b, "errors")
+	b = appendMsgpackArray(b, len(response.Errors))
+	for _, e := range response.Errors {
+		fields := 2
+		if e.EventID != "" {
+			fields++
+		}
+		if e.DuplicateOf != nil {
+			fields++
+		}
+		b = append(b, 0x80|byte(fields))
+		b = appendMsgpackString(b, "index")
+		b = appendMsgpackInt(b, int64(e.Index))
+		if e.EventID != "" {
+			b = appendMsgpackString(b, "event_id")
+			b = appendMsgpackString(b, e.EventID)
+		}
+		b = appendMsgpackString(b, "error")
+		b = appendMsgpackString(b, e.Error)
+		if e.DuplicateOf != nil {
+			b = appendMsgpackString(b, "duplicate_of")
+			b = appendMsgpackInt(b, int64(*e.DuplicateOf))
+		}
+	}
+	return b
+}
+
+// appendMsgpackString appends a MessagePack str
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackInt appends a MessagePack integer in its smallest form
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n < 128:
+		return append(b, byte(n)) // positive fixint
+	case n >= -32 && n < 0:
+		return append(b, byte(n)) // negative fixint
+	case n >= 0 && n <= math.MaxUint16:
+		return append(b, 0xcd, byte(n>>8), byte(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return append(b, 0xce, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		u := uint64(n)
+		return append(b, 0xd3, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32),
+			byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	}
+}
+
+// appendMsgpackArray appends a MessagePack array header
+func appendMsgpackArray(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+// appendProtobuf encodes a response as the protobuf message
+//
+//	message IngestResponse {
+//	  bool success = 1;
+//	  int64 accepted = 2;
+//	  int64 rejected = 3;
+//	  int64 dropped = 4;
+//	  repeated IngestError errors = 5;
+//	}
+//
+//	message IngestError {
+//	  int64 index = 1;
+//	  string event_id = 2;
+//	  string error = 3;
+//	  optional int64 duplicate_of = 4;
+//	}
+//
+// Like generated code, it leaves out fields with default values.
+func appendProtobuf(b []byte, response IngestResponse) []byte {
+	if response.Success {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	b = appendProtobufInt(b, 2, response.Accepted)
+	b = appendProtobufInt(b, 3, response.Rejected)
+	b = appendProtobufInt(b, 4, response.Dropped)
+
+	var msg []byte
+	for _, e := range response.Errors {
+		msg = appendProtobufInt(msg[:0], 1, e.Index)
+		if e.EventID != "" {
+			msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+			msg = protowire.AppendString(msg, e.EventID)
+		}
+		if e.Error != "" {
+			msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+			msg = protowire.AppendString(msg, e.Error)
+		}
+		if e.DuplicateOf != nil {
+			// Explicit presence: written even when zero
+			msg = protowire.AppendTag(msg, 4, protowire.VarintType)
+			msg = protowire.AppendVarint(msg, uint64(*e.DuplicateOf))
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+	return b
+}
+
+// appendProtobufInt appends a non-zero int64 field
+func appendProtobufInt(b []byte, num protowire.Number, n int) []byte {
+	if n == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(n))
+}
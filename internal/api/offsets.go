@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+)
+
+// OffsetsHandler inspects and resets a consumer group's offsets
+type OffsetsHandler struct {
+	offsets      *kafka.GroupOffsets
+	defaultTopic string
+}
+
+// NewOffsetsHandler creates a consumer group offsets admin handler;
+// requests without a topic use defaultTopic
+func NewOffsetsHandler(offsets *kafka.GroupOffsets, defaultTopic string) *OffsetsHandler {
+	return &OffsetsHandler{offsets: offsets, defaultTopic: defaultTopic}
+}
+
+// OffsetResetRequest is the POST body. Without Confirm the reset is only
+// planned; Confirm must repeat the group ID to apply it.
+type OffsetResetRequest struct {
+	kafka.OffsetReset
+	Confirm string `json:"confirm,omitempty"`
+}
+
+// OffsetResetResponse lists the moves a reset made or would make
+type OffsetResetResponse struct {
+	GroupID    string                 `json:"group_id"`
+	Topic      string                 `json:"topic"`
+	Applied    bool                   `json:"applied"`
+	Partitions []kafka.PartitionReset `json:"partitions"`
+}
+
+// ServeHTTP handles GET (describe) and POST (reset) for
+// /admin/consumer-groups/{group}/offsets
+func (h *OffsetsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	group := r.PathValue("group")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "offsets").
+		Str("group_id", group).
+		Logger()
+
+	if group == "" {
+		writeJSONError(w, http.StatusBadRequest, "group is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		topic := r.URL.Query().Get("topic")
+		if topic == "" {
+			topic = h.defaultTopic
+		}
+		states, err := h.offsets.Describe(r.Context(), group, topic)
+		if err != nil {
+			log.Error().Err(err).Str("topic", topic).Msg("failed to describe offsets")
+			writeJSONError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group_id":   group,
+			"topic":      topic,
+			"partitions": states,
+		})
+
+	case http.MethodPost:
+		var req OffsetResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if req.Topic == "" {
+			req.Topic = h.defaultTopic
+		}
+		if req.Confirm != "" && req.Confirm != group {
+			writeJSONError(w, http.StatusBadRequest, "confirm must equal the group ID")
+			return
+		}
+
+		resp := OffsetResetResponse{GroupID: group, Topic: req.Topic, Applied: req.Confirm != ""}
+		var err error
+		if resp.Applied {
+			resp.Partitions, err = h.offsets.Apply(r.Context(), group, req.OffsetReset)
+		} else {
+			resp.Partitions, err = h.offsets.Plan(r.Context(), group, req.OffsetReset)
+		}
+		if err != nil {
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, kafka.ErrInvalidReset):
+				status = http.StatusBadRequest
+			case errors.Is(err, kafka.ErrGroupActive):
+				status = http.StatusConflict
+			default:
+				log.Error().Err(err).Str("topic", req.Topic).Msg("failed to reset offsets")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		if resp.Applied {
+			log.Warn().
+				Str("topic", req.Topic).
+				Interface("partitions", resp.Partitions).
+				Msg("consumer group offsets reset")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+)
+
+// PartitionsHandler manages a tenant's Kafka partition pin
+type PartitionsHandler struct {
+	balancer *kafka.TenantBalancer
+}
+
+// NewPartitionsHandler creates a partition pin admin handler
+func NewPartitionsHandler(balancer *kafka.TenantBalancer) *PartitionsHandler {
+	return &PartitionsHandler{balancer: balancer}
+}
+
+// PartitionPin is the request and response body for a tenant's pin.
+// Partitions is null when the tenant shares the unpinned partitions.
+type PartitionPin struct {
+	TenantID   string                `json:"tenant_id"`
+	Partitions *kafka.PartitionRange `json:"partitions"`
+}
+
+// ServeHTTP handles GET, PUT (pin) and DELETE (unpin) for
+// /admin/tenants/{tenant}/partitions
+func (h *PartitionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "partitions").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req PartitionPin
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Partitions == nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"partitions\": {\"first\": n, \"last\": n}}")
+			return
+		}
+		if err := h.balancer.SetPin(r.Context(), tenantID, req.Partitions); err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, kafka.ErrInvalidPartitionRange) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist partition pin")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().
+			Int("first", req.Partitions.First).
+			Int("last", req.Partitions.Last).
+			Msg("tenant pinned to partitions")
+
+	case http.MethodDelete:
+		if err := h.balancer.SetPin(r.Context(), tenantID, nil); err != nil {
+			log.Error().Err(err).Msg("failed to clear partition pin")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Msg("tenant unpinned from partitions")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp := PartitionPin{TenantID: tenantID}
+	if pin, ok := h.balancer.Pin(tenantID); ok {
+		resp.Partitions = &pin
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
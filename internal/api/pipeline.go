@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"parsec/internal/pipeline"
+)
+
+// PipelineHandler reports the stages active on this node
+type PipelineHandler struct {
+	ingest *IngestHandler
+}
+
+// NewPipelineHandler creates a pipeline introspection handler
+func NewPipelineHandler(ingest *IngestHandler) *PipelineHandler {
+	return &PipelineHandler{ingest: ingest}
+}
+
+// PipelineResponse is the stage graph of this node. Stages run in order;
+// transform stages may reject or drop an event before it reaches the next.
+type PipelineResponse struct {
+	NodeID string `json:"node_id"`
+
+	// ConfigHash covers every stage's configuration, so nodes can be
+	// compared at a glance
+	ConfigHash string          `json:"config_hash"`
+	Stages     []PipelineStage `json:"stages"`
+}
+
+// PipelineStage describes a single stage
+type PipelineStage struct {
+	pipeline.StageInfo
+
+	// Kind is "transform", "route", "reassemble" or "publish"
+	Kind string `json:"kind"`
+
+	// Next is the stage events continue to ("" for the last stage)
+	Next string `json:"next,omitempty"`
+}
+
+// ServeHTTP handles GET /admin/pipeline
+func (h *PipelineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ingest.describe())
+}
+
+// describe assembles the stage graph: the ingest pipeline, then routing,
+// multi-line reassembly (if enabled) and publishing
+func (h *IngestHandler) describe() PipelineResponse {
+	var stages []PipelineStage
+	for _, info := range h.pipeline.Describe() {
+		stages = append(stages, PipelineStage{StageInfo: info, Kind: "transform"})
+	}
+
+	stages = append(stages, PipelineStage{
+		StageInfo: pipeline.StageInfo{
+			Name:       "route",
+			ConfigHash: pipeline.ConfigHash(h.router.Config()),
+			Stats:      h.routeStats.Snapshot(),
+		},
+		Kind: "route",
+	})
+
+	if h.assembler != nil {
+		stages = append(stages, PipelineStage{
+			StageInfo: pipeline.StageInfo{
+				Name:       "multiline",
+				ConfigHash: pipeline.ConfigHash(h.assembler.Config()),
+				Stats:      h.multilineStats.Snapshot(),
+			},
+			Kind: "reassemble",
+		})
+	}
+
+	stages = append(stages, PipelineStage{
+		StageInfo: pipeline.StageInfo{
+			Name:       "publish",
+			ConfigHash: pipeline.ConfigHash(h.topic),
+			Stats:      h.publishStats.Snapshot(),
+		},
+		Kind: "publish",
+	})
+
+	hashes := make([]string, len(stages))
+	for i := range stages {
+		if i+1 < len(stages) {
+			stages[i].Next = stages[i+1].Name
+		}
+		hashes[i] = stages[i].Name + "=" + stages[i].ConfigHash
+	}
+
+	return PipelineResponse{
+		NodeID:     h.nodeID,
+		ConfigHash: pipeline.ConfigHash(hashes),
+		Stages:     stages,
+	}
+}
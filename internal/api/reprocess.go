@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/reprocess"
+)
+
+// ReprocessHandler creates and reports reprocessing jobs
+type ReprocessHandler struct {
+	manager *reprocess.Manager
+}
+
+// NewReprocessHandler creates a reprocessing handler; a nil manager
+// reports reprocessing as unavailable
+func NewReprocessHandler(manager *reprocess.Manager) *ReprocessHandler {
+	return &ReprocessHandler{manager: manager}
+}
+
+// ServeHTTP handles POST /admin/reprocess (create a job) and
+// GET /admin/reprocess/{id} (job status and progress)
+func (h *ReprocessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "reprocess").
+		Logger()
+
+	if h.manager == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "reprocessing is not configured")
+		return
+	}
+
+	var (
+		job    *reprocess.Job
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case jobID == "" && r.Method == http.MethodPost:
+		var req reprocess.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"topic\": \"...\", \"from\": RFC3339, \"to\": RFC3339}")
+			return
+		}
+		job, err = h.manager.Create(r.Context(), req)
+		if errors.Is(err, reprocess.ErrInvalidRequest) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err == nil {
+			status = http.StatusAccepted
+			w.Header().Set("Location", r.URL.Path+"/"+job.ID)
+			log.Info().
+				Str("job_id", job.ID).
+				Str("topic", job.Topic).
+				Time("from", job.From).
+				Time("to", job.To).
+				Str("pipeline", job.Pipeline).
+				Str("sink", job.Sink).
+				Msg("reprocess job created")
+		}
+
+	case jobID != "" && r.Method == http.MethodGet:
+		job, err = h.manager.Get(r.Context(), jobID)
+		if errors.Is(err, reprocess.ErrJobNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("reprocess request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
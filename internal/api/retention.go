@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"parsec/internal/routing"
+	"parsec/pkg/models"
+)
+
+// retentionHeader lets clients ask storage to keep a request's events for
+// a while, e.g. "7y" for audit events or "3d" for debug lines
+const retentionHeader = "X-Parsec-Retention"
+
+// retentionKey is the context key of a request's retention hint
+type retentionKey struct{}
+
+// withRetention returns ctx carrying a retention hint in seconds
+func withRetention(ctx context.Context, seconds int64) context.Context {
+	return context.WithValue(ctx, retentionKey{}, seconds)
+}
+
+// requestRetention parses a request's retention hint into its context.
+// Requests without one are returned as they are.
+func requestRetention(r *http.Request) (*http.Request, error) {
+	hint := r.Header.Get(retentionHeader)
+	if hint == "" {
+		return r, nil
+	}
+	ttl, err := models.ParseRetention(hint)
+	if err != nil {
+		return r, err
+	}
+	return r.WithContext(withRetention(r.Context(), int64(ttl/time.Second))), nil
+}
+
+// retentionSeconds returns the retention hint for an event: the routing
+// rule's, then the client's (0 = none). Operators' rules win, so a policy
+// such as "debug lines for 3 days" holds whatever clients ask for.
+func retentionSeconds(ctx context.Context, decision routing.Decision) int64 {
+	if decision.RetentionSeconds > 0 {
+		return decision.RetentionSeconds
+	}
+	return clientRetention(ctx)
+}
+
+// clientRetention returns the retention hint the client asked for (0 =
+// none)
+func clientRetention(ctx context.Context) int64 {
+	seconds, _ := ctx.Value(retentionKey{}).(int64)
+	return seconds
+}
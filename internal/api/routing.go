@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/routing"
+	"parsec/pkg/models"
+)
+
+// RoutingHandler manages a tenant's routing rules
+type RoutingHandler struct {
+	engine *routing.Engine
+}
+
+// NewRoutingHandler creates a routing rules admin handler
+func NewRoutingHandler(engine *routing.Engine) *RoutingHandler {
+	return &RoutingHandler{engine: engine}
+}
+
+// RoutingRules is the request and response body for tenant rules
+type RoutingRules struct {
+	TenantID string         `json:"tenant_id"`
+	Rules    []routing.Rule `json:"rules"`
+}
+
+// ServeHTTP handles GET (list), PUT (replace) and DELETE (clear) for
+// /admin/tenants/{tenant}/routes
+func (h *RoutingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "routing").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req RoutingRules
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"rules\": [...]}")
+			return
+		}
+		if err := h.engine.SetRules(r.Context(), tenantID, req.Rules); err != nil {
+			status := http.StatusBadRequest
+			if !isRuleError(err) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist routing rules")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Int("rules", len(req.Rules)).Msg("routing rules updated")
+
+	case http.MethodDelete:
+		if err := h.engine.SetRules(r.Context(), tenantID, nil); err != nil {
+			log.Error().Err(err).Msg("failed to clear routing rules")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Msg("routing rules cleared")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RoutingRules{
+		TenantID: tenantID,
+		Rules:    h.engine.Rules(tenantID),
+	})
+}
+
+// isRuleError reports whether err is a client-side rule validation error
+func isRuleError(err error) bool {
+	for _, target := range []error{
+		routing.ErrUnknownAction,
+		routing.ErrMissingTopic,
+		routing.ErrTopicNotAllowed,
+		routing.ErrInvalidPriority,
+		routing.ErrInvalidRetention,
+		routing.ErrInvalidSample,
+		routing.ErrInvalidSource,
+		routing.ErrTooManyRules,
+		models.ErrInvalidSeverity,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
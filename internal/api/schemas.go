@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/schema"
+)
+
+// SchemaHandler manages a tenant's metadata schema
+type SchemaHandler struct {
+	registry *schema.Registry
+}
+
+// NewSchemaHandler creates a tenant schema admin handler
+func NewSchemaHandler(registry *schema.Registry) *SchemaHandler {
+	return &SchemaHandler{registry: registry}
+}
+
+// SchemaRequest sets a tenant's JSON Schema and what happens to events that
+// fail it (reject, the default, or flag)
+type SchemaRequest struct {
+	Schema json.RawMessage `json:"schema"`
+	Mode   schema.Mode     `json:"mode,omitempty"`
+}
+
+// ServeHTTP handles GET, PUT (replace) and DELETE for
+// /admin/tenants/{tenant}/schema
+func (h *SchemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "schemas").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	var current schema.Schema
+	switch r.Method {
+	case http.MethodGet:
+		s, ok := h.registry.Get(tenantID)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "schema not found")
+			return
+		}
+		current = s
+
+	case http.MethodPut:
+		var req SchemaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"schema\": {...}, \"mode\": \"reject\"|\"flag\"}")
+			return
+		}
+		s, err := h.registry.Set(r.Context(), tenantID, schema.Schema{Schema: req.Schema, Mode: req.Mode})
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, schema.ErrInvalidSchema) && !errors.Is(err, schema.ErrInvalidMode) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist tenant schema")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Str("mode", string(s.Mode)).Msg("tenant schema updated")
+		current = s
+
+	case http.MethodDelete:
+		existed, err := h.registry.Delete(r.Context(), tenantID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to delete tenant schema")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !existed {
+			writeJSONError(w, http.StatusNotFound, "schema not found")
+			return
+		}
+		log.Info().Msg("tenant schema deleted")
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
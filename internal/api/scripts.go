@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/scripting"
+)
+
+// ScriptHandler manages a tenant's filter/transform script
+type ScriptHandler struct {
+	engine *scripting.Engine
+}
+
+// NewScriptHandler creates a tenant script admin handler
+func NewScriptHandler(engine *scripting.Engine) *ScriptHandler {
+	return &ScriptHandler{engine: engine}
+}
+
+// ScriptRequest sets a new script version, or re-activates an earlier one
+// when RollbackTo is set
+type ScriptRequest struct {
+	Filter     string `json:"filter,omitempty"`
+	Transform  string `json:"transform,omitempty"`
+	RollbackTo int    `json:"rollback_to,omitempty"`
+}
+
+// ServeHTTP handles GET (status), PUT (new version or rollback) and DELETE
+// for /admin/tenants/{tenant}/script
+func (h *ScriptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "scripts").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req ScriptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"filter\": ..., \"transform\": ...} or {\"rollback_to\": version}")
+			return
+		}
+
+		var (
+			script scripting.Script
+			err    error
+		)
+		if req.RollbackTo > 0 {
+			script, err = h.engine.Rollback(r.Context(), tenantID, req.RollbackTo)
+		} else {
+			script, err = h.engine.Set(r.Context(), tenantID, scripting.Script{
+				Filter:    req.Filter,
+				Transform: req.Transform,
+			})
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			if !isScriptError(err) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist tenant script")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Int("version", script.Version).Msg("tenant script updated")
+
+	case http.MethodDelete:
+		if err := h.engine.Delete(r.Context(), tenantID); err != nil {
+			log.Error().Err(err).Msg("failed to delete tenant script")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Msg("tenant script deleted")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.engine.Status(tenantID))
+}
+
+// isScriptError reports whether err is a client-side script error
+func isScriptError(err error) bool {
+	for _, target := range []error{
+		scripting.ErrEmptyScript,
+		scripting.ErrCompile,
+		scripting.ErrScriptTooLarge,
+		scripting.ErrVersionNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/alerts"
+	"parsec/internal/logger"
+)
+
+// SearchHandler lets operators save a tenant's queries and have them run
+// on a schedule, alerting when their counts cross a threshold
+type SearchHandler struct {
+	monitor *alerts.SearchMonitor
+}
+
+// NewSearchHandler creates a saved search handler
+func NewSearchHandler(monitor *alerts.SearchMonitor) *SearchHandler {
+	return &SearchHandler{monitor: monitor}
+}
+
+// SearchRequest is the body of a saved search
+type SearchRequest struct {
+	Query     string `json:"query"`
+	Every     string `json:"every"`
+	Condition string `json:"condition"`
+	Threshold int    `json:"threshold"`
+}
+
+// SearchList is the response listing a tenant's saved searches
+type SearchList struct {
+	TenantID string                `json:"tenant_id"`
+	Searches []alerts.SearchStatus `json:"searches"`
+}
+
+// ServeHTTP handles GET /searches/{tenant} (list with last results), PUT
+// /searches/{tenant}/{name} (save or change a search) and DELETE
+// /searches/{tenant}/{name}
+func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	name := r.PathValue("name")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "searches").
+		Str("tenant_id", tenantID).
+		Str("search", name).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		// fall through to the list below
+
+	case r.Method == http.MethodPut && name != "":
+		var req SearchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"query\": \"{source=\\\"api\\\"} |= \\\"timeout\\\"\", \"every\": \"5m\", \"threshold\": 10}")
+			return
+		}
+		saved, err := h.monitor.Save(r.Context(), alerts.SavedSearch{
+			TenantID:  tenantID,
+			Name:      name,
+			Query:     req.Query,
+			Every:     req.Every,
+			Condition: req.Condition,
+			Threshold: req.Threshold,
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+			if !isSearchError(err) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to save search")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Bool("audit", true).Str("query", saved.Query).Str("every", saved.Every).
+			Str("condition", saved.Condition).Int("threshold", saved.Threshold).Msg("search saved")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+		return
+
+	case r.Method == http.MethodDelete && name != "":
+		existed, err := h.monitor.Delete(r.Context(), tenantID, name)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to delete search")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !existed {
+			writeJSONError(w, http.StatusNotFound, "saved search not found")
+			return
+		}
+		log.Info().Bool("audit", true).Msg("search deleted")
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	statuses, err := h.monitor.Status(r.Context(), tenantID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read saved searches")
+		writeJSONError(w, http.StatusInternalServerError, "failed to read saved searches")
+		return
+	}
+	if statuses == nil {
+		statuses = []alerts.SearchStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchList{TenantID: tenantID, Searches: statuses})
+}
+
+// isSearchError reports whether a save failed on the search itself
+func isSearchError(err error) bool {
+	for _, target := range []error{
+		alerts.ErrInvalidSearch,
+		alerts.ErrInvalidSearchQuery,
+		alerts.ErrInvalidSearchInterval,
+		alerts.ErrInvalidCondition,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+
+	"parsec/internal/metrics"
+	"parsec/internal/sentry"
+	"parsec/pkg/models"
+)
+
+// sentryItemTypes are the item types counted by name; others are counted
+// as "other" to bound the metric's labels
+var sentryItemTypes = map[string]bool{
+	sentry.ItemEvent: true, sentry.ItemLog: true,
+	"transaction": true, "session": true, "sessions": true, "attachment": true,
+	"client_report": true, "check_in": true, "profile": true, "replay_event": true,
+	"replay_recording": true, "feedback": true, "span": true,
+}
+
+// SentryHandler accepts Sentry SDK envelopes, so applications can point
+// an existing Sentry DSN at Parsec. Error and message events and log
+// records are ingested through the ingest handler; other items are
+// acknowledged and dropped.
+type SentryHandler struct {
+	ingest   *IngestHandler
+	projects map[string]sentry.Project
+}
+
+// NewSentryHandler creates a Sentry envelope handler for projects, keyed by
+// the project ID in their DSNs
+func NewSentryHandler(ingest *IngestHandler, projects map[string]sentry.Project) *SentryHandler {
+	return &SentryHandler{ingest: ingest, projects: projects}
+}
+
+// ServeHTTP handles POST /api/{project}/envelope/. The DSN's public key is
+// taken from the X-Sentry-Auth header, the sentry_key query parameter
+// (browser SDKs) or the envelope header's DSN (tunnels). The response is
+// the same as for /ingest.
+func (h *SentryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := &requestLogger{requestID: r.Header.Get(requestIDHeader)}
+
+	// Browser SDKs post from the application's origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, X-Sentry-Auth")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	project, ok := h.projects[r.PathValue("project")]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown project")
+		return
+	}
+
+	format, err := negotiateResponse(r)
+	if errors.Is(err, errNotAcceptable) {
+		writeJSONError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := h.ingest.readBody(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	data, err := h.decompress(r.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	envelope, err := sentry.ParseEnvelope(data)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse sentry envelope")
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := sentry.AuthKey(r.Header.Get("X-Sentry-Auth"))
+	if key == "" {
+		key = r.URL.Query().Get("sentry_key")
+	}
+	if key == "" {
+		key = envelope.Header.PublicKey()
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(project.Key)) != 1 {
+		log.Warn().Str("tenant_id", project.Tenant).Msg("invalid sentry key")
+		writeJSONError(w, http.StatusUnauthorized, "invalid sentry key")
+		return
+	}
+
+	events, err := h.events(envelope, project.Tenant)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse sentry envelope")
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Info().Int("batch_size", len(events)).Str("tenant_id", project.Tenant).Msg("processing sentry envelope")
+	h.ingest.serveEvents(w, r, format, body, events, log)
+}
+
+// decompress undoes the gzip or deflate encoding SDKs may apply, bounding
+// the decompressed size by the body limit
+func (h *SentryHandler) decompress(encoding string, body []byte) ([]byte, error) {
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, errors.New("unsupported content-encoding " + encoding)
+	}
+	if err != nil {
+		return nil, errors.New("invalid " + encoding + " body")
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, h.ingest.maxBodySize+1))
+	if err != nil {
+		return nil, errors.New("invalid " + encoding + " body")
+	}
+	if int64(len(data)) > h.ingest.maxBodySize {
+		return nil, errors.New("decompressed body too large")
+	}
+	return data, nil
+}
+
+// events converts an envelope's event and log items
+func (h *SentryHandler) events(envelope *sentry.Envelope, tenant string) ([]*models.LogEvent, error) {
+	// Zero when absent or invalid
+	sentAt, _ := models.ParseTimestamp(envelope.Header.SentAt)
+
+	var events []*models.LogEvent
+	for _, item := range envelope.Items {
+		itemType := item.Type
+		if !sentryItemTypes[itemType] {
+			itemType = "other"
+		}
+		metrics.SentryItems.WithLabelValues(tenant, itemType).Inc()
+
+		switch item.Type {
+		case sentry.ItemEvent:
+			event, err := sentry.ParseEvent(item.Payload)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event.LogEvent(tenant, envelope.Header.EventID, sentAt))
+		case sentry.ItemLog:
+			records, err := sentry.ParseLogs(item.Payload)
+			if err != nil {
+				return nil, err
+			}
+			for i := range records {
+				events = append(events, records[i].LogEvent(tenant, sentAt))
+			}
+		}
+	}
+	return events, nil
+}
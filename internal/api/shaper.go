@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+)
+
+// ShaperHandler exposes the Kafka write shaper for runtime tuning
+type ShaperHandler struct {
+	shaper *kafka.Shaper
+}
+
+// NewShaperHandler creates a write shaper admin handler
+func NewShaperHandler(shaper *kafka.Shaper) *ShaperHandler {
+	return &ShaperHandler{shaper: shaper}
+}
+
+// ServeHTTP returns the limits on GET and replaces them on PUT. Limits are
+// per node; zero means unlimited.
+func (h *ShaperHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "shaper").
+		Logger()
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var limits kafka.ShaperLimits
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"messages_per_sec\": n, \"bytes_per_sec\": n}")
+			return
+		}
+		if limits.MessagesPerSec < 0 || limits.BytesPerSec < 0 {
+			writeJSONError(w, http.StatusBadRequest, "limits must not be negative")
+			return
+		}
+		h.shaper.SetLimits(limits)
+
+		log.Info().
+			Float64("messages_per_sec", limits.MessagesPerSec).
+			Float64("bytes_per_sec", limits.BytesPerSec).
+			Msg("kafka write shaper updated")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.shaper.Limits())
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"parsec/internal/browser"
+	"parsec/internal/logger"
+)
+
+// SourceMapHandler manages a tenant's source maps for browser reports
+type SourceMapHandler struct {
+	maps *browser.SourceMaps
+}
+
+// NewSourceMapHandler creates a tenant source map admin handler
+func NewSourceMapHandler(maps *browser.SourceMaps) *SourceMapHandler {
+	return &SourceMapHandler{maps: maps}
+}
+
+// SourceMapList is the response to GET
+type SourceMapList struct {
+	SourceMaps []browser.SourceMapInfo `json:"source_maps"`
+}
+
+// ServeHTTP handles GET (list), PUT (upload; the body is the source map)
+// and DELETE for /admin/tenants/{tenant}/sourcemaps. PUT and DELETE take
+// ?release= and ?file=, the script's URL or file name.
+func (h *SourceMapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "sourcemaps").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	release := r.URL.Query().Get("release")
+	file := r.URL.Query().Get("file")
+
+	switch r.Method {
+	case http.MethodGet:
+		infos, err := h.maps.List(r.Context(), tenantID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to list source maps")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SourceMapList{SourceMaps: infos})
+
+	case http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, browser.MaxSourceMapBytes))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "source map too large")
+			return
+		}
+		if err := h.maps.Put(r.Context(), tenantID, release, file, data); err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, browser.ErrInvalidName) && !errors.Is(err, browser.ErrInvalidSourceMap) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to store source map")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Str("release", release).Str("file", file).Int("bytes", len(data)).Msg("source map uploaded")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(browser.SourceMapInfo{Release: release, File: file, Size: int64(len(data))})
+
+	case http.MethodDelete:
+		if err := h.maps.Delete(r.Context(), tenantID, release, file); err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, browser.ErrInvalidName) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to delete source map")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().Str("release", release).Str("file", file).Msg("source map deleted")
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
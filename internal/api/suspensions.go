@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/rbac"
+	"parsec/internal/suspension"
+)
+
+// SuspensionHandler pauses, blocks and resumes tenants' ingestion
+type SuspensionHandler struct {
+	registry *suspension.Registry
+}
+
+// NewSuspensionHandler creates a tenant suspension admin handler
+func NewSuspensionHandler(registry *suspension.Registry) *SuspensionHandler {
+	return &SuspensionHandler{registry: registry}
+}
+
+// SuspendRequest is the body of a pause or block
+type SuspendRequest struct {
+	Mode   suspension.Mode `json:"mode"`
+	Reason string          `json:"reason,omitempty"`
+
+	// Duration lifts the suspension automatically, e.g. "1h" ("" = until
+	// lifted)
+	Duration string `json:"duration,omitempty"`
+}
+
+// SuspensionStatus is the response for one tenant
+type SuspensionStatus struct {
+	TenantID   string                 `json:"tenant_id"`
+	Suspended  bool                   `json:"suspended"`
+	Suspension *suspension.Suspension `json:"suspension,omitempty"`
+}
+
+// ServeHTTP handles GET /admin/suspensions (every suspended tenant) and
+// GET (status), PUT (pause or block) and DELETE (resume) for
+// /admin/tenants/{tenant}/suspension. Changes need an unlimited role, so
+// tenant admins can't lift their own block.
+func (h *SuspensionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "suspensions").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"suspensions": h.registry.List()})
+		return
+	}
+
+	if r.Method != http.MethodGet && !rbac.Permits(r.Context(), rbac.PermManage, "") {
+		principal, _ := rbac.FromContext(r.Context())
+		rbac.Denial(principal, rbac.PermManage, tenantID).
+			Str("request_id", r.Header.Get("X-Request-ID")).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Msg("request not authorized")
+		writeJSONError(w, http.StatusForbidden, "suspending tenants needs a role for all tenants")
+		return
+	}
+
+	var by string
+	if principal, ok := rbac.FromContext(r.Context()); ok {
+		by = principal.Name
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req SuspendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"mode\": \"paused\"|\"blocked\", \"reason\": ...}")
+			return
+		}
+		s := suspension.Suspension{TenantID: tenantID, Mode: req.Mode, Reason: req.Reason, By: by}
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				writeJSONError(w, http.StatusBadRequest, "duration must be a positive duration such as \"1h\"")
+				return
+			}
+			until := time.Now().Add(d).UTC()
+			s.Until = &until
+		}
+
+		s, err := h.registry.Suspend(r.Context(), s)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, suspension.ErrInvalidMode) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist suspension")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		event := log.Info().
+			Bool("audit", true).
+			Str("mode", string(s.Mode)).
+			Str("reason", s.Reason).
+			Str("principal", by)
+		if s.Until != nil {
+			event = event.Time("until", *s.Until)
+		}
+		event.Msg("tenant ingestion suspended")
+
+	case http.MethodDelete:
+		existed, err := h.registry.Lift(r.Context(), tenantID)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to lift suspension")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !existed {
+			writeJSONError(w, http.StatusNotFound, "tenant is not suspended")
+			return
+		}
+		log.Info().Bool("audit", true).Str("principal", by).Msg("tenant ingestion resumed")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status := SuspensionStatus{TenantID: tenantID}
+	if s, ok := h.registry.Get(tenantID); ok {
+		status.Suspended = true
+		status.Suspension = &s
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/rbac"
+	"parsec/internal/tiers"
+)
+
+// TiersHandler assigns tenants service tiers
+type TiersHandler struct {
+	registry *tiers.Registry
+}
+
+// NewTiersHandler creates a tenant tier admin handler
+func NewTiersHandler(registry *tiers.Registry) *TiersHandler {
+	return &TiersHandler{registry: registry}
+}
+
+// TierRequest is the body of a tier assignment
+type TierRequest struct {
+	Tier tiers.Tier `json:"tier"`
+}
+
+// TierStatus is the response for one tenant
+type TierStatus struct {
+	TenantID string `json:"tenant_id"`
+
+	// Tier is empty for tenants on no tier, whose knobs keep the global
+	// settings
+	Tier   tiers.Tier    `json:"tier,omitempty"`
+	Policy *tiers.Policy `json:"policy,omitempty"`
+
+	// Assignment is nil for tenants on the default tier
+	Assignment *tiers.Assignment `json:"assignment,omitempty"`
+}
+
+// TierList is the response listing the tiers and assigned tenants
+type TierList struct {
+	Default  tiers.Tier                  `json:"default,omitempty"`
+	Policies map[tiers.Tier]tiers.Policy `json:"policies"`
+	Tenants  []tiers.Assignment          `json:"tenants"`
+}
+
+// ServeHTTP handles GET /admin/tiers (the policies and every assigned
+// tenant) and GET (status), PUT (assign) and DELETE (return to the
+// configured or default tier) for /admin/tenants/{tenant}/tier. Changes
+// need an unlimited role, so tenant admins can't upgrade themselves.
+func (h *TiersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.PathValue("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "tiers").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	if tenantID == "" {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TierList{
+			Default:  h.registry.Default(),
+			Policies: h.registry.Policies(),
+			Tenants:  h.registry.List(),
+		})
+		return
+	}
+
+	if r.Method != http.MethodGet && !rbac.Permits(r.Context(), rbac.PermManage, "") {
+		principal, _ := rbac.FromContext(r.Context())
+		rbac.Denial(principal, rbac.PermManage, tenantID).
+			Str("request_id", r.Header.Get("X-Request-ID")).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Msg("request not authorized")
+		writeJSONError(w, http.StatusForbidden, "changing tenant tiers needs a role for all tenants")
+		return
+	}
+
+	var by string
+	if principal, ok := rbac.FromContext(r.Context()); ok {
+		by = principal.Name
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// fall through to the response below
+
+	case http.MethodPut:
+		var req TierRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "expected {\"tier\": \"bronze\"|\"silver\"|\"gold\"}")
+			return
+		}
+		previous, _ := h.registry.Tier(tenantID)
+		a, err := h.registry.Assign(r.Context(), tiers.Assignment{TenantID: tenantID, Tier: req.Tier, By: by})
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, tiers.ErrUnknownTier) {
+				status = http.StatusInternalServerError
+				log.Error().Err(err).Msg("failed to persist tier assignment")
+			}
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		log.Info().
+			Bool("audit", true).
+			Str("tier", string(a.Tier)).
+			Str("previous_tier", string(previous)).
+			Str("principal", by).
+			Msg("tenant tier assigned")
+
+	case http.MethodDelete:
+		err := h.registry.Unassign(r.Context(), tenantID)
+		switch {
+		case errors.Is(err, tiers.ErrNotAssigned):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		case errors.Is(err, tiers.ErrStaticTier):
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			log.Error().Err(err).Msg("failed to remove tier assignment")
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Info().Bool("audit", true).Str("principal", by).Msg("tenant tier assignment removed")
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status := TierStatus{TenantID: tenantID}
+	if tier, ok := h.registry.Tier(tenantID); ok {
+		status.Tier = tier
+		if policy, ok := h.registry.Policy(tier); ok {
+			status.Policy = &policy
+		}
+	}
+	for _, a := range h.registry.List() {
+		if a.TenantID == tenantID {
+			status.Assignment = &a
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/logger"
+	"parsec/internal/slo"
+	"parsec/internal/ui"
+)
+
+// tailKeepalive is how often an idle live tail sends a comment, so proxies
+// don't close it
+const tailKeepalive = 15 * time.Second
+
+// UIHandler serves the data of the embedded operator console
+type UIHandler struct {
+	feed       *ui.Feed
+	heartbeats *alerts.HeartbeatMonitor
+	slo        *slo.Tracker
+}
+
+// NewUIHandler creates the console's API handler. heartbeats may be nil
+// when heartbeat alerts are disabled.
+func NewUIHandler(feed *ui.Feed, heartbeats *alerts.HeartbeatMonitor, tracker *slo.Tracker) *UIHandler {
+	return &UIHandler{feed: feed, heartbeats: heartbeats, slo: tracker}
+}
+
+// AlertState is the open alerts shown by the console: the SLO objectives
+// with their alert levels, and the registered heartbeats
+type AlertState struct {
+	Objectives []slo.Status             `json:"objectives"`
+	Heartbeats []alerts.HeartbeatStatus `json:"heartbeats"`
+}
+
+// Tail handles GET /ui/api/tail, a live tail of ingested events as
+// server-sent events, of one tenant with ?tenant=. It starts with up to
+// ?backlog= (default 100) recent events.
+func (h *UIHandler) Tail(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "ui_tail").
+		Str("tenant_id", tenantID).
+		Logger()
+
+	backlog := 100
+	if v := r.URL.Query().Get("backlog"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "backlog must be a non-negative integer")
+			return
+		}
+		backlog = n
+	}
+
+	recent, events, cancel := h.feed.Subscribe(tenantID, backlog)
+	defer cancel()
+
+	// The tail outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(entry ui.Entry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(append([]byte("data: "), data...), '\n', '\n'))
+		return err
+	}
+	for _, entry := range recent {
+		if err := send(entry); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Warn().Err(err).Msg("live tail can't be flushed")
+		return
+	}
+	log.Debug().Msg("live tail started")
+
+	keepalive := time.NewTicker(tailKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debug().Msg("live tail closed")
+			return
+		case <-keepalive.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+		case entry := <-events:
+			if err := send(entry); err != nil {
+				return
+			}
+			// Send what else is waiting in one flush
+			for n := len(events); n > 0; n-- {
+				if err := send(<-events); err != nil {
+					return
+				}
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Errors handles GET /ui/api/errors, the recent errors of each tenant
+func (h *UIHandler) Errors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"tenants": h.feed.Errors()})
+}
+
+// Alerts handles GET /ui/api/alerts, the alert state of SLOs and
+// heartbeats
+func (h *UIHandler) Alerts(w http.ResponseWriter, r *http.Request) {
+	state := AlertState{
+		Objectives: h.slo.Snapshot(time.Now()).Objectives,
+		Heartbeats: []alerts.HeartbeatStatus{},
+	}
+	if h.heartbeats != nil {
+		statuses, err := h.heartbeats.Status(r.Context(), "")
+		if err != nil {
+			logger.Logger.Error().Err(err).Str("handler", "ui_alerts").Msg("failed to read heartbeats")
+			writeJSONError(w, http.StatusInternalServerError, "failed to read heartbeats")
+			return
+		}
+		if statuses != nil {
+			state.Heartbeats = statuses
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/uploads"
+)
+
+// uploadOffsetHeader carries an upload's offset: the one a chunk is
+// written at in requests, and the one the next chunk starts at in
+// responses
+const uploadOffsetHeader = "Upload-Offset"
+
+// IngestLines ingests a batch of an upload's NDJSON lines like an async
+// batch, waiting for room in the queue. Lines may be events or envelopes
+// holding one (as written by the file sink).
+func (h *IngestHandler) IngestLines(ctx context.Context, batchID string, lines [][]byte) uploads.Result {
+	log := &requestLogger{requestID: batchID}
+	var result uploads.Result
+
+	// at maps each decoded event back to its line in the batch
+	inputs := make([]LogEventInput, 0, len(lines))
+	at := make([]int, 0, len(lines))
+	for i, line := range lines {
+		var record struct {
+			LogEventInput
+			Event *LogEventInput `json:"event"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			result.Errors = append(result.Errors, uploads.LineError{Line: int64(i), Error: "invalid JSON: " + err.Error()})
+			result.Rejected++
+			metrics.IngestValidationErrors.WithLabelValues("conversion_error").Inc()
+			continue
+		}
+		if record.Event != nil {
+			record.LogEventInput = *record.Event
+		}
+		inputs = append(inputs, record.LogEventInput)
+		at = append(at, i)
+	}
+
+	var response IngestResponse
+	converted, sizes, _ := h.convertEvents(inputs, &response, log)
+	h.dedupe(converted, &response, log)
+	h.processPaced(ctx, converted, sizes, batchID, &response, log)
+
+	result.Accepted += response.Accepted
+	result.Rejected += response.Rejected
+	result.Dropped += response.Dropped
+	for _, e := range response.Errors {
+		result.Errors = append(result.Errors, uploads.LineError{
+			Line:    int64(at[e.Index]),
+			EventID: e.EventID,
+			Error:   e.Error,
+		})
+	}
+	sort.SliceStable(result.Errors, func(a, b int) bool { return result.Errors[a].Line < result.Errors[b].Line })
+	return result
+}
+
+// UploadsHandler serves resumable uploads of large NDJSON dumps
+type UploadsHandler struct {
+	manager *uploads.Manager
+
+	// maxChunk bounds one appended chunk, like an /ingest body
+	maxChunk int64
+}
+
+// NewUploadsHandler creates a resumable upload handler accepting chunks of
+// up to maxChunk bytes
+func NewUploadsHandler(manager *uploads.Manager, maxChunk int64) *UploadsHandler {
+	if maxChunk <= 0 {
+		maxChunk = 10 * 1024 * 1024
+	}
+	return &UploadsHandler{manager: manager, maxChunk: maxChunk}
+}
+
+// uploadRequest optionally declares an upload's size, which commits then
+// check the upload reached
+type uploadRequest struct {
+	Size int64 `json:"size"`
+}
+
+// ServeHTTP handles POST /uploads (create), GET /uploads/{id} (status),
+// PATCH /uploads/{id} (append the body at the Upload-Offset header),
+// DELETE /uploads/{id} (abort) and POST /uploads/{id}/commit (ingest)
+func (h *UploadsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "uploads").
+		Str("upload_id", id).
+		Logger()
+
+	var (
+		upload *uploads.Upload
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		var req uploadRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "expected {\"size\": bytes} or an empty body")
+				return
+			}
+		}
+		upload, err = h.manager.Create(r.Context(), req.Size)
+		if err == nil {
+			status = http.StatusCreated
+			w.Header().Set("Location", "/uploads/"+upload.ID)
+			log.Info().Str("upload_id", upload.ID).Int64("size", upload.Size).Msg("upload created")
+		}
+
+	case id != "" && r.URL.Path == "/uploads/"+id+"/commit":
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		upload, err = h.manager.Commit(r.Context(), id)
+		if err == nil {
+			status = http.StatusAccepted
+			w.Header().Set("Location", "/uploads/"+id)
+			log.Info().Int64("bytes", upload.Offset).Msg("upload committed")
+		}
+
+	case id != "" && r.Method == http.MethodGet:
+		upload, err = h.manager.Get(r.Context(), id)
+
+	case id != "" && r.Method == http.MethodPatch:
+		offset, perr := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+		if perr != nil || offset < 0 {
+			writeJSONError(w, http.StatusBadRequest, uploadOffsetHeader+" must be a byte offset")
+			return
+		}
+		upload, err = h.manager.Append(r.Context(), id, offset, http.MaxBytesReader(w, r.Body, h.maxChunk))
+
+	case id != "" && r.Method == http.MethodDelete:
+		upload, err = h.manager.Abort(r.Context(), id)
+		if err == nil {
+			log.Info().Msg("upload aborted")
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if upload != nil {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		h.writeError(w, err, &log)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// writeError maps an upload error to its status. Conflicts come with the
+// upload's current offset, for clients resuming an upload.
+func (h *UploadsHandler) writeError(w http.ResponseWriter, err error, log *zerolog.Logger) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, uploads.ErrTooLarge), errors.As(err, &tooLarge):
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, uploads.ErrEmpty):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, uploads.ErrOffsetMismatch),
+		errors.Is(err, uploads.ErrWrongNode),
+		errors.Is(err, uploads.ErrNotOpen),
+		errors.Is(err, uploads.ErrIncomplete),
+		errors.Is(err, uploads.ErrFinished):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	default:
+		log.Error().Err(err).Msg("upload request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"parsec/internal/logger"
+	"parsec/internal/usage"
+)
+
+// UsageReportsHandler serves the monthly usage reports billing reads
+type UsageReportsHandler struct {
+	reports *usage.Reports
+}
+
+// NewUsageReportsHandler creates a usage reports admin handler
+func NewUsageReportsHandler(reports *usage.Reports) *UsageReportsHandler {
+	return &UsageReportsHandler{reports: reports}
+}
+
+// ServeHTTP handles GET /admin/usage-reports (list), GET
+// /admin/usage-reports/{month} (the report as JSON, or CSV with
+// ?format=csv) and POST /admin/usage-reports/{month} (generate it now,
+// e.g. for the month so far or after a failure)
+func (h *UsageReportsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	month := r.PathValue("month")
+	log := logger.Logger.With().
+		Str("request_id", r.Header.Get("X-Request-ID")).
+		Str("handler", "usage_reports").
+		Str("month", month).
+		Logger()
+
+	var (
+		resp   any
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case month == "" && r.Method == http.MethodGet:
+		var reports []usage.Report
+		reports, err = h.reports.List(r.Context())
+		resp = map[string]any{"reports": reports}
+
+	case month != "" && r.Method == http.MethodGet:
+		var report *usage.Report
+		report, err = h.reports.Get(r.Context(), month)
+		if err == nil && r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="usage-`+report.Month+`.csv"`)
+			report.WriteCSV(w)
+			return
+		}
+		resp = report
+
+	case month != "" && r.Method == http.MethodPost:
+		var report *usage.Report
+		report, err = h.reports.Generate(r.Context(), month)
+		if err == nil {
+			status = http.StatusAccepted
+			resp = report
+			log.Info().Bool("audit", true).Str("job_id", report.JobID).Msg("usage report requested")
+		}
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch {
+	case errors.Is(err, usage.ErrInvalidMonth):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, usage.ErrReportNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, usage.ErrReportRunning):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("usage reports request failed")
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"parsec/internal/winevent"
+	"parsec/pkg/models"
+)
+
+// WindowsHandler accepts Windows events as XML, as sent by Windows Event
+// Forwarding collectors, and ingests them through the ingest handler
+type WindowsHandler struct {
+	ingest *IngestHandler
+	tenant string
+}
+
+// NewWindowsHandler creates a Windows event handler. Events are assigned
+// to the request's ?tenant= or else to tenant.
+func NewWindowsHandler(ingest *IngestHandler, tenant string) *WindowsHandler {
+	return &WindowsHandler{ingest: ingest, tenant: tenant}
+}
+
+// ServeHTTP handles a body of one or more <Event> elements, optionally
+// gzip-compressed. The response is the same as for /ingest.
+func (h *WindowsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := &requestLogger{requestID: r.Header.Get(requestIDHeader)}
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "application/xml" && mediaType != "text/xml" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "content-type must be application/xml")
+			return
+		}
+	}
+
+	format, err := negotiateResponse(r)
+	if errors.Is(err, errNotAcceptable) {
+		writeJSONError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		tenant = h.tenant
+	}
+	if tenant == "" {
+		writeJSONError(w, http.StatusBadRequest, "tenant is required")
+		return
+	}
+
+	body, err := h.ingest.readBody(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	var reader io.Reader = bytes.NewReader(body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid gzip body")
+			return
+		}
+		// Bound the decompressed size as well
+		reader = io.LimitReader(gz, h.ingest.maxBodySize)
+	}
+
+	events, err := winevent.Decode(reader)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse windows events")
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Info().Int("batch_size", len(events)).Str("tenant_id", tenant).Msg("processing windows events")
+
+	converted := make([]*models.LogEvent, len(events))
+	for i, event := range events {
+		converted[i] = event.LogEvent(tenant)
+	}
+	h.ingest.serveEvents(w, r, format, body, converted, log)
+}
@@ -0,0 +1,376 @@
+// Package batch fans items from a channel out to workers that collect them
+// into batches, flushing each batch when it is full, when it has waited
+// long enough, on request and at shutdown. Components that buffer work in
+// front of a slow sink (the envelope worker pool, for one) share this
+// batching and shutdown logic instead of keeping their own copies.
+package batch
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// FlushFunc delivers a batch. The slice is reused once it returns, so it
+// must not be retained. WorkerID(ctx) tells which worker delivers it.
+type FlushFunc[T any] func(ctx context.Context, items []T)
+
+// Aggregator is the worker ID of the aggregator that merges partial batches
+// when compacting
+const Aggregator = -1
+
+// workerKey is the context key of the delivering worker's ID
+type workerKey struct{}
+
+// WorkerID returns the ID of the worker delivering a batch: its index, or
+// Aggregator. ok is false outside of a FlushFunc.
+func WorkerID(ctx context.Context) (id int, ok bool) {
+	id, ok = ctx.Value(workerKey{}).(int)
+	return id, ok
+}
+
+// Config holds batcher settings
+type Config[T any] struct {
+	// Name identifies the batcher in logs and panic metrics
+	Name string
+
+	// Input is read until it is closed or the batcher is stopped
+	Input <-chan T
+
+	// Workers is the number of goroutines collecting batches (0 = 4)
+	Workers int
+
+	// Size flushes a batch once it holds this many items (0 = 100)
+	Size int
+
+	// Timeout flushes a partial batch this long after the last flush
+	// (0 = 100ms)
+	Timeout time.Duration
+
+	// Flush delivers batches; it is called concurrently by the workers
+	Flush FlushFunc[T]
+
+	// Compact merges the partial batches workers flush on timeout into
+	// batches of up to Size before delivering them
+	Compact bool
+
+	// CompactLinger is how long the aggregator waits for more partial
+	// batches (0 = Timeout)
+	CompactLinger time.Duration
+
+	// OnCompact, if set, is called for each partial batch the aggregator
+	// receives
+	OnCompact func()
+
+	// OnTake, if set, is called by a worker for each item it takes from
+	// the input
+	OnTake func(worker int, item T)
+}
+
+// WorkerStats counts the batches a worker delivered
+type WorkerStats struct {
+	// ID is the worker's index; the aggregator that merges partial batches
+	// when compacting is reported with ID -1
+	ID int `json:"id"`
+
+	Batches uint64 `json:"batches"`
+	Items   uint64 `json:"items"`
+
+	// LastFlush is when the worker last delivered a batch (nil = never)
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+}
+
+// counters are a worker's delivery statistics
+type counters struct {
+	batches, items atomic.Uint64
+	lastFlush      atomic.Int64 // unix nanos, 0 = never
+}
+
+// Batcher collects items into batches across a set of workers
+type Batcher[T any] struct {
+	cfg Config[T]
+
+	// stats holds a slot per worker, then one for the aggregator
+	stats []counters
+
+	// compact receives partial batches for the aggregator; nil when
+	// compaction is off
+	compact     chan []T
+	compactDone chan struct{}
+	compactOnce sync.Once
+
+	// flush asks workers, and flushCompact the aggregator, to deliver what
+	// they hold without waiting for a full batch
+	flush        chan struct{}
+	flushCompact chan struct{}
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a batcher; Start begins reading the input
+func New[T any](cfg Config[T]) *Batcher[T] {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 100 * time.Millisecond
+	}
+	if cfg.CompactLinger <= 0 {
+		cfg.CompactLinger = cfg.Timeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Batcher[T]{
+		cfg:    cfg,
+		flush:  make(chan struct{}, cfg.Workers),
+		stats:  make([]counters, cfg.Workers+1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if cfg.Compact {
+		b.compact = make(chan []T, cfg.Workers)
+		b.compactDone = make(chan struct{})
+		b.flushCompact = make(chan struct{}, 1)
+	}
+	return b
+}
+
+// Start launches the workers (and the aggregator when compacting)
+func (b *Batcher[T]) Start() {
+	if b.compact != nil {
+		go b.aggregate()
+	}
+	for i := 0; i < b.cfg.Workers; i++ {
+		b.wg.Add(1)
+		go b.worker(i)
+	}
+}
+
+// Stop stops the workers, which flush what they hold, then the aggregator.
+// It may be called more than once.
+func (b *Batcher[T]) Stop() {
+	b.cancel()
+	b.wg.Wait()
+	if b.compact != nil {
+		// Workers are gone; flush what the aggregator holds
+		b.compactOnce.Do(func() { close(b.compact) })
+		<-b.compactDone
+	}
+}
+
+// Flush asks every worker, and the aggregator, to deliver the items they
+// are batching now rather than on timeout. It doesn't wait for delivery.
+func (b *Batcher[T]) Flush() {
+	for i := 0; i < b.cfg.Workers; i++ {
+		select {
+		case b.flush <- struct{}{}:
+		default:
+			// Enough requests are already pending
+		}
+	}
+	if b.flushCompact != nil {
+		select {
+		case b.flushCompact <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Workers returns the number of workers
+func (b *Batcher[T]) Workers() int { return b.cfg.Workers }
+
+// Size returns the batch size
+func (b *Batcher[T]) Size() int { return b.cfg.Size }
+
+// Timeout returns the partial batch timeout
+func (b *Batcher[T]) Timeout() time.Duration { return b.cfg.Timeout }
+
+// Stats returns each worker's delivery statistics, followed by the
+// aggregator's when compacting
+func (b *Batcher[T]) Stats() []WorkerStats {
+	stats := make([]WorkerStats, 0, len(b.stats))
+	for i := range b.stats {
+		id := i
+		if i == b.cfg.Workers {
+			if b.compact == nil {
+				break
+			}
+			id = Aggregator
+		}
+		c := &b.stats[i]
+		s := WorkerStats{ID: id, Batches: c.batches.Load(), Items: c.items.Load()}
+		if last := c.lastFlush.Load(); last != 0 {
+			t := time.Unix(0, last).UTC()
+			s.LastFlush = &t
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// deliver flushes a batch, counting it against slot
+func (b *Batcher[T]) deliver(slot int, items []T) {
+	c := &b.stats[slot]
+	c.batches.Add(1)
+	c.items.Add(uint64(len(items)))
+	c.lastFlush.Store(time.Now().UnixNano())
+
+	id := slot
+	if slot == b.cfg.Workers {
+		id = Aggregator
+	}
+	b.cfg.Flush(context.WithValue(b.ctx, workerKey{}, id), items)
+}
+
+// worker collects items from the input into batches
+func (b *Batcher[T]) worker(id int) {
+	defer b.wg.Done()
+
+	log := logger.WithComponent(b.cfg.Name).With().Int("worker_id", id).Logger()
+
+	// Panic recovery
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			log.Error().
+				Interface("panic", r).
+				Bytes("stack", stack).
+				Msg("worker panic recovered")
+			metrics.PanicsRecovered.WithLabelValues(b.cfg.Name).Inc()
+		}
+	}()
+
+	log.Info().Msg("worker started")
+	defer log.Info().Msg("worker stopped")
+
+	batch := make([]T, 0, b.cfg.Size)
+	timer := time.NewTimer(b.cfg.Timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			// Flush remaining batch before exiting
+			if len(batch) > 0 {
+				b.deliver(id, batch)
+			}
+			return
+
+		case item, ok := <-b.cfg.Input:
+			if !ok {
+				// Input closed, flush and exit
+				if len(batch) > 0 {
+					b.deliver(id, batch)
+				}
+				return
+			}
+
+			if b.cfg.OnTake != nil {
+				b.cfg.OnTake(id, item)
+			}
+			batch = append(batch, item)
+
+			// Flush when batch is full
+			if len(batch) >= b.cfg.Size {
+				b.deliver(id, batch)
+				batch = batch[:0]
+				timer.Reset(b.cfg.Timeout)
+			}
+
+		case <-timer.C:
+			// Flush on timeout if we have any items
+			if len(batch) > 0 {
+				b.flushPartial(id, batch)
+				batch = batch[:0]
+			}
+			timer.Reset(b.cfg.Timeout)
+
+		case <-b.flush:
+			// Deliver directly; merging would only hold items longer
+			if len(batch) > 0 {
+				b.deliver(id, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flushPartial hands a batch flushed on timeout to the aggregator, or
+// delivers it when compaction is off
+func (b *Batcher[T]) flushPartial(id int, batch []T) {
+	if b.compact == nil {
+		b.deliver(id, batch)
+		return
+	}
+
+	// The worker reuses its batch
+	sub := append([]T(nil), batch...)
+	select {
+	case b.compact <- sub:
+	case <-b.ctx.Done():
+		b.deliver(id, sub)
+	}
+}
+
+// aggregate merges partial batches from all workers, delivering whenever
+// Size items are pending or the linger since the first pending one
+// expires. Partial batches only arrive under light load, so delivering
+// from this one goroutine keeps up.
+func (b *Batcher[T]) aggregate() {
+	defer close(b.compactDone)
+
+	pending := make([]T, 0, b.cfg.Size)
+	linger := time.NewTimer(b.cfg.CompactLinger)
+	linger.Stop()
+
+	for {
+		select {
+		case sub, ok := <-b.compact:
+			if !ok {
+				// The batcher is stopping; flush like the workers do
+				if len(pending) > 0 {
+					b.deliver(b.cfg.Workers, pending)
+				}
+				return
+			}
+			if b.cfg.OnCompact != nil {
+				b.cfg.OnCompact()
+			}
+			if len(pending) == 0 {
+				linger.Reset(b.cfg.CompactLinger)
+			}
+			pending = append(pending, sub...)
+
+			for len(pending) >= b.cfg.Size {
+				b.deliver(b.cfg.Workers, pending[:b.cfg.Size])
+				pending = append(pending[:0], pending[b.cfg.Size:]...)
+			}
+			if len(pending) == 0 {
+				linger.Stop()
+			}
+
+		case <-linger.C:
+			if len(pending) > 0 {
+				b.deliver(b.cfg.Workers, pending)
+				pending = pending[:0]
+			}
+
+		case <-b.flushCompact:
+			if len(pending) > 0 {
+				b.deliver(b.cfg.Workers, pending)
+				pending = pending[:0]
+				linger.Stop()
+			}
+		}
+	}
+}
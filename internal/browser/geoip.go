@@ -0,0 +1,134 @@
+package browser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Location is where an IP address is registered
+type Location struct {
+	Country string `json:"country"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// Metadata returns the location as nested event metadata
+func (l Location) Metadata() map[string]any {
+	m := map[string]any{"country": l.Country}
+	if l.Region != "" {
+		m["region"] = l.Region
+	}
+	if l.City != "" {
+		m["city"] = l.City
+	}
+	return m
+}
+
+// GeoDB maps IP networks to locations. Lookups try the most specific
+// network first, so nested networks may refine broader ones.
+type GeoDB struct {
+	networks map[netip.Prefix]Location
+
+	// bits lists the prefix lengths present, longest first
+	bits []int
+}
+
+// LoadGeoDB reads a GeoDB from a CSV file (see ReadGeoDB)
+func LoadGeoDB(path string) (*GeoDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGeoDB(f)
+}
+
+// ReadGeoDB parses lines of "network,country[,region[,city]]", e.g.
+// "203.0.113.0/24,AU,NSW,Sydney". Blank lines, lines starting with # and a
+// header line starting with "network" are skipped.
+func ReadGeoDB(r io.Reader) (*GeoDB, error) {
+	db := &GeoDB{networks: make(map[netip.Prefix]Location)}
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || line == 1 && strings.HasPrefix(text, "network") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("line %d: country is required", line)
+		}
+
+		loc := Location{Country: strings.TrimSpace(fields[1])}
+		if len(fields) > 2 {
+			loc.Region = strings.TrimSpace(fields[2])
+		}
+		if len(fields) > 3 {
+			loc.City = strings.TrimSpace(strings.Join(fields[3:], ","))
+		}
+
+		prefix = normalizePrefix(prefix)
+		db.networks[prefix] = loc
+		if !seen[prefix.Bits()] {
+			seen[prefix.Bits()] = true
+			db.bits = append(db.bits, prefix.Bits())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(db.bits)))
+	return db, nil
+}
+
+// normalizePrefix masks a prefix and maps IPv4 networks into IPv6 so both
+// families share one table
+func normalizePrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4() {
+		p = netip.PrefixFrom(netip.AddrFrom16(p.Addr().As16()), p.Bits()+96)
+	}
+	return p.Masked()
+}
+
+// Lookup returns the location of the most specific network holding addr.
+// A nil GeoDB finds nothing.
+func (db *GeoDB) Lookup(addr netip.Addr) (Location, bool) {
+	if db == nil || !addr.IsValid() {
+		return Location{}, false
+	}
+	addr = netip.AddrFrom16(addr.As16())
+
+	for _, bits := range db.bits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if loc, ok := db.networks[prefix]; ok {
+			return loc, true
+		}
+	}
+	return Location{}, false
+}
+
+// Len returns the number of networks
+func (db *GeoDB) Len() int {
+	if db == nil {
+		return 0
+	}
+	return len(db.networks)
+}
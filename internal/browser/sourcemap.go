@@ -0,0 +1,202 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidSourceMap is returned for source maps that cannot be parsed
+var ErrInvalidSourceMap = errors.New("invalid source map")
+
+// Position is a location in an original source file. Line and Column are
+// 1-based, like the positions in JavaScript stack traces.
+type Position struct {
+	Source string
+	Line   int
+	Column int
+	Name   string
+}
+
+// segment maps a generated column to an original position; source and
+// name are indexes, -1 when absent
+type segment struct {
+	column       int
+	source       int
+	sourceLine   int
+	sourceColumn int
+	name         int
+}
+
+// SourceMap is a parsed revision 3 source map
+type SourceMap struct {
+	sources []string
+	names   []string
+
+	// lines holds each generated line's segments, sorted by column
+	lines [][]segment
+}
+
+// sourceMapJSON is the source map document
+type sourceMapJSON struct {
+	Version    int               `json:"version"`
+	SourceRoot string            `json:"sourceRoot"`
+	Sources    []string          `json:"sources"`
+	Names      []string          `json:"names"`
+	Mappings   string            `json:"mappings"`
+	Sections   []json.RawMessage `json:"sections"`
+}
+
+// ParseSourceMap parses a revision 3 source map. Index maps (with
+// sections) are not supported.
+func ParseSourceMap(data []byte) (*SourceMap, error) {
+	var doc sourceMapJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSourceMap, err)
+	}
+	if doc.Version != 3 {
+		return nil, fmt.Errorf("%w: version %d, want 3", ErrInvalidSourceMap, doc.Version)
+	}
+	if len(doc.Sections) > 0 {
+		return nil, fmt.Errorf("%w: index maps are not supported", ErrInvalidSourceMap)
+	}
+
+	m := &SourceMap{
+		sources: make([]string, len(doc.Sources)),
+		names:   doc.Names,
+	}
+	for i, source := range doc.Sources {
+		if doc.SourceRoot != "" && !strings.Contains(source, "://") {
+			source = strings.TrimSuffix(doc.SourceRoot, "/") + "/" + source
+		}
+		m.sources[i] = source
+	}
+
+	lines, err := decodeMappings(doc.Mappings, len(m.sources), len(m.names))
+	if err != nil {
+		return nil, err
+	}
+	m.lines = lines
+	return m, nil
+}
+
+// decodeMappings decodes the Base64 VLQ mappings string. Fields other than
+// the generated column are relative to the previous segment in the file;
+// the generated column is relative within a line.
+func decodeMappings(mappings string, sources, names int) ([][]segment, error) {
+	var (
+		lines  [][]segment
+		line   []segment
+		source int
+		srcLn  int
+		srcCol int
+		name   int
+	)
+
+	for i, group := range strings.Split(mappings, ";") {
+		column := 0
+		line = nil
+		for _, encoded := range strings.Split(group, ",") {
+			if encoded == "" {
+				continue
+			}
+			fields, err := decodeVLQ(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidSourceMap, i+1, err)
+			}
+
+			column += fields[0]
+			seg := segment{column: column, source: -1, name: -1}
+			switch len(fields) {
+			case 1:
+			case 4, 5:
+				source += fields[1]
+				srcLn += fields[2]
+				srcCol += fields[3]
+				if source < 0 || source >= sources {
+					return nil, fmt.Errorf("%w: line %d: source index %d out of range", ErrInvalidSourceMap, i+1, source)
+				}
+				seg.source, seg.sourceLine, seg.sourceColumn = source, srcLn, srcCol
+				if len(fields) == 5 {
+					name += fields[4]
+					if name < 0 || name >= names {
+						return nil, fmt.Errorf("%w: line %d: name index %d out of range", ErrInvalidSourceMap, i+1, name)
+					}
+					seg.name = name
+				}
+			default:
+				return nil, fmt.Errorf("%w: line %d: segment with %d fields", ErrInvalidSourceMap, i+1, len(fields))
+			}
+			line = append(line, seg)
+		}
+
+		sort.SliceStable(line, func(a, b int) bool { return line[a].column < line[b].column })
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// decodeVLQ decodes one segment's Base64 VLQ values
+func decodeVLQ(encoded string) ([]int, error) {
+	var (
+		values []int
+		value  int
+		shift  uint
+	)
+	for i := 0; i < len(encoded); i++ {
+		digit := strings.IndexByte(base64Digits, encoded[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base64 digit %q", encoded[i])
+		}
+		if shift > 30 {
+			return nil, errors.New("value overflows")
+		}
+
+		value |= (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+
+		// The lowest bit is the sign
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, errors.New("truncated value")
+	}
+	return values, nil
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Lookup returns the original position of a 1-based generated line and
+// column: that of the closest mapped column at or before it on the line
+func (m *SourceMap) Lookup(line, column int) (Position, bool) {
+	if line < 1 || line > len(m.lines) {
+		return Position{}, false
+	}
+	segments := m.lines[line-1]
+
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].column > column-1 }) - 1
+	if i < 0 || segments[i].source < 0 {
+		return Position{}, false
+	}
+
+	seg := segments[i]
+	pos := Position{
+		Source: m.sources[seg.source],
+		Line:   seg.sourceLine + 1,
+		Column: seg.sourceColumn + 1,
+	}
+	if seg.name >= 0 {
+		pos.Name = m.names[seg.name]
+	}
+	return pos, true
+}
@@ -0,0 +1,251 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/objstore"
+)
+
+const (
+	// MaxSourceMapBytes bounds an uploaded source map
+	MaxSourceMapBytes = 32 << 20
+
+	// maxNameBytes bounds release and file names
+	maxNameBytes = 512
+
+	// maxCachedMaps bounds the parsed source maps kept in memory
+	maxCachedMaps = 32
+
+	// defaultCacheTTL is how long a parsed (or missing) source map is
+	// reused before it is read again, so uploads on other nodes are seen
+	defaultCacheTTL = 5 * time.Minute
+)
+
+// ErrInvalidName is returned for empty or unusable tenant, release or file
+// names
+var ErrInvalidName = errors.New("tenant, release and file are required and must not be . or ..")
+
+// SourceMapInfo describes an uploaded source map
+type SourceMapInfo struct {
+	Release string `json:"release"`
+	File    string `json:"file"`
+	Size    int64  `json:"size"`
+}
+
+// cachedMap is a parsed source map, or a miss when m is nil
+type cachedMap struct {
+	m        *SourceMap
+	loadedAt time.Time
+}
+
+// SourceMaps stores tenants' source maps in an object store, keyed by
+// release and script file, and symbolicates stack frames with them
+type SourceMaps struct {
+	bucket objstore.Bucket
+	prefix string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedMap
+}
+
+// NewSourceMaps creates a source map store under prefix in bucket
+func NewSourceMaps(bucket objstore.Bucket, prefix string) *SourceMaps {
+	return &SourceMaps{
+		bucket: bucket,
+		prefix: prefix,
+		ttl:    defaultCacheTTL,
+		cache:  make(map[string]cachedMap),
+	}
+}
+
+// objectKey is where a source map is stored. Names are escaped so each is
+// one path segment.
+func (s *SourceMaps) objectKey(tenantID, release, file string) string {
+	return path.Join(s.prefix, url.PathEscape(tenantID), url.PathEscape(release), url.PathEscape(file)+".map")
+}
+
+// validName rejects names that are empty, too long or would escape their
+// path segment
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && len(name) <= maxNameBytes
+}
+
+// Put validates and stores a tenant's source map for a script file of a
+// release. file is the script's URL, or just its file name to match it on
+// any host and path.
+func (s *SourceMaps) Put(ctx context.Context, tenantID, release, file string, data []byte) error {
+	if !validName(tenantID) || !validName(release) || !validName(file) {
+		return ErrInvalidName
+	}
+	if len(data) > MaxSourceMapBytes {
+		return fmt.Errorf("%w: larger than %d bytes", ErrInvalidSourceMap, MaxSourceMapBytes)
+	}
+	m, err := ParseSourceMap(data)
+	if err != nil {
+		return err
+	}
+
+	key := s.objectKey(tenantID, release, file)
+	if err := s.bucket.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.store(key, cachedMap{m: m, loadedAt: time.Now()})
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes a source map; deleting a missing one is not an error
+func (s *SourceMaps) Delete(ctx context.Context, tenantID, release, file string) error {
+	if !validName(tenantID) || !validName(release) || !validName(file) {
+		return ErrInvalidName
+	}
+
+	key := s.objectKey(tenantID, release, file)
+	if err := s.bucket.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.cache, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns a tenant's source maps, sorted by release and file
+func (s *SourceMaps) List(ctx context.Context, tenantID string) ([]SourceMapInfo, error) {
+	if !validName(tenantID) {
+		return nil, ErrInvalidName
+	}
+
+	tenantPrefix := path.Join(s.prefix, url.PathEscape(tenantID)) + "/"
+	objects, err := s.bucket.List(ctx, tenantPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SourceMapInfo, 0, len(objects))
+	for _, obj := range objects {
+		rest := strings.TrimSuffix(strings.TrimPrefix(obj.Key, tenantPrefix), ".map")
+		escapedRelease, escapedFile, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		release, err1 := url.PathUnescape(escapedRelease)
+		file, err2 := url.PathUnescape(escapedFile)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		infos = append(infos, SourceMapInfo{Release: release, File: file, Size: obj.Size})
+	}
+	return infos, nil
+}
+
+// Symbolicate maps frames of a release's scripts to their original
+// sources in place, returning how many were mapped. Frames without a
+// matching source map or mapping are left as they are.
+func (s *SourceMaps) Symbolicate(ctx context.Context, tenantID, release string, frames []Frame) int {
+	if s == nil || !validName(tenantID) || !validName(release) {
+		return 0
+	}
+
+	resolved := 0
+	for i := range frames {
+		m := s.lookup(ctx, tenantID, release, frames[i].File)
+		if m == nil {
+			continue
+		}
+		pos, ok := m.Lookup(frames[i].Line, frames[i].Column)
+		if !ok {
+			continue
+		}
+
+		frames[i].File = pos.Source
+		frames[i].Line = pos.Line
+		frames[i].Column = pos.Column
+		if pos.Name != "" {
+			frames[i].Function = pos.Name
+		}
+		frames[i].Symbolicated = true
+		resolved++
+	}
+	return resolved
+}
+
+// lookup finds the source map for a script URL: one uploaded for the URL
+// without its query or fragment, else one for its file name
+func (s *SourceMaps) lookup(ctx context.Context, tenantID, release, script string) *SourceMap {
+	script, _, _ = strings.Cut(script, "#")
+	script, _, _ = strings.Cut(script, "?")
+
+	candidates := []string{script}
+	if base := path.Base(script); base != script && validName(base) {
+		candidates = append(candidates, base)
+	}
+
+	for _, file := range candidates {
+		if !validName(file) {
+			continue
+		}
+		if m := s.load(ctx, s.objectKey(tenantID, release, file)); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// load returns a parsed source map from the cache or the bucket; misses
+// are cached too, so unmapped scripts don't hit the bucket on every report
+func (s *SourceMaps) load(ctx context.Context, key string) *SourceMap {
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < s.ttl {
+		return cached.m
+	}
+
+	var m *SourceMap
+	r, err := s.bucket.Open(ctx, key)
+	if err == nil {
+		data, readErr := io.ReadAll(io.LimitReader(r, MaxSourceMapBytes+1))
+		r.Close()
+		if readErr != nil {
+			// Transient errors are not cached
+			return nil
+		}
+		// Maps are validated on upload; an unparsable one is treated as missing
+		m, _ = ParseSourceMap(data)
+	} else if !errors.Is(err, objstore.ErrNotFound) {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.store(key, cachedMap{m: m, loadedAt: time.Now()})
+	s.mu.Unlock()
+	return m
+}
+
+// store caches a map, evicting the oldest entry when full; callers hold s.mu
+func (s *SourceMaps) store(key string, entry cachedMap) {
+	if _, ok := s.cache[key]; !ok && len(s.cache) >= maxCachedMaps {
+		oldest := ""
+		for k, v := range s.cache {
+			if oldest == "" || v.loadedAt.Before(s.cache[oldest].loadedAt) {
+				oldest = k
+			}
+		}
+		delete(s.cache, oldest)
+	}
+	s.cache[key] = entry
+}
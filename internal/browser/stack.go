@@ -0,0 +1,86 @@
+package browser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxFrames bounds the frames parsed from one stack trace
+const MaxFrames = 100
+
+// Frame is one stack frame. Line and Column are 1-based; Symbolicated is
+// set once the frame has been mapped to its original source.
+type Frame struct {
+	Function     string
+	File         string
+	Line         int
+	Column       int
+	Symbolicated bool
+}
+
+var (
+	// chromeFrame matches V8 frames: "    at fn (https://x/app.js:10:15)",
+	// "    at https://x/app.js:10:15" and "    at async fn (...)"
+	chromeFrame = regexp.MustCompile(`^\s*at (?:(.+?) \()?(.+?):(\d+):(\d+)\)?\s*$`)
+
+	// geckoFrame matches Firefox and Safari frames: "fn@https://x/app.js:10:15"
+	geckoFrame = regexp.MustCompile(`^\s*(.*?)@(.+?):(\d+):(\d+)\s*$`)
+)
+
+// ParseStack parses a JavaScript error.stack string in the V8 (Chrome,
+// Edge, Node) or Gecko/WebKit (Firefox, Safari) format. Lines that are not
+// frames, such as the leading "TypeError: ..." line, are skipped.
+func ParseStack(stack string) []Frame {
+	var frames []Frame
+	for _, line := range strings.Split(stack, "\n") {
+		if len(frames) == MaxFrames {
+			break
+		}
+
+		match := chromeFrame.FindStringSubmatch(line)
+		if match == nil {
+			match = geckoFrame.FindStringSubmatch(line)
+		}
+		if match == nil {
+			continue
+		}
+
+		lineNo, err1 := strconv.Atoi(match[3])
+		column, err2 := strconv.Atoi(match[4])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		frames = append(frames, Frame{
+			Function: match[1],
+			File:     match[2],
+			Line:     lineNo,
+			Column:   column,
+		})
+	}
+	return frames
+}
+
+// FormatStack renders frames in the V8 format
+func FormatStack(frames []Frame) string {
+	var b strings.Builder
+	for i, f := range frames {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("    at ")
+		if f.Function != "" {
+			b.WriteString(f.Function)
+			b.WriteString(" (")
+		}
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Column))
+		if f.Function != "" {
+			b.WriteByte(')')
+		}
+	}
+	return b.String()
+}
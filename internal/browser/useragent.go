@@ -0,0 +1,146 @@
+package browser
+
+import (
+	"strings"
+)
+
+// Device classes reported by ParseUserAgent
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// UserAgent is what ParseUserAgent recognises in a User-Agent header.
+// Unrecognised parts are left empty.
+type UserAgent struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device,omitempty"`
+}
+
+// browserTokens are checked in order: most browsers also claim to be
+// Chrome and Safari, so the specific ones come first
+var browserTokens = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"}, // Safari puts its version in Version/
+}
+
+// windowsVersions maps Windows NT kernel versions to product names
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// ParseUserAgent extracts the browser, operating system and device class
+// from a User-Agent header. It recognises the major browsers and platforms
+// and is not meant to be exhaustive.
+func ParseUserAgent(header string) UserAgent {
+	var ua UserAgent
+	if header == "" {
+		return ua
+	}
+
+	lower := strings.ToLower(header)
+	if strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") ||
+		strings.Contains(lower, "spider") || strings.Contains(lower, "headlesschrome") {
+		ua.Device = DeviceBot
+	}
+
+	for _, b := range browserTokens {
+		if version, ok := tokenVersion(header, b.token); ok {
+			if b.name == "Safari" && !strings.Contains(header, "Safari/") {
+				continue
+			}
+			ua.Browser = b.name
+			ua.BrowserVersion = version
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(header, "Windows NT "):
+		ua.OS = "Windows"
+		version, _ := tokenVersion(header, "Windows NT ")
+		ua.OSVersion = windowsVersions[version]
+	case strings.Contains(header, "iPhone") || strings.Contains(header, "iPad") || strings.Contains(header, "iPod"):
+		ua.OS = "iOS"
+		if version, ok := tokenVersion(header, "OS "); ok {
+			ua.OSVersion = strings.ReplaceAll(version, "_", ".")
+		}
+	case strings.Contains(header, "Android"):
+		ua.OS = "Android"
+		ua.OSVersion, _ = tokenVersion(header, "Android ")
+	case strings.Contains(header, "CrOS"):
+		ua.OS = "Chrome OS"
+	case strings.Contains(header, "Mac OS X"):
+		ua.OS = "macOS"
+		if version, ok := tokenVersion(header, "Mac OS X "); ok {
+			ua.OSVersion = strings.ReplaceAll(version, "_", ".")
+		}
+	case strings.Contains(header, "Linux"):
+		ua.OS = "Linux"
+	}
+
+	if ua.Device == "" {
+		switch {
+		case strings.Contains(header, "iPad") || strings.Contains(header, "Tablet") ||
+			ua.OS == "Android" && !strings.Contains(header, "Mobile"):
+			ua.Device = DeviceTablet
+		case strings.Contains(header, "Mobile") || strings.Contains(header, "iPhone") || strings.Contains(header, "iPod"):
+			ua.Device = DeviceMobile
+		default:
+			ua.Device = DeviceDesktop
+		}
+	}
+
+	return ua
+}
+
+// tokenVersion returns the version following token, e.g. "120.0.6099.71"
+// for "Chrome/" in "... Chrome/120.0.6099.71 Safari/537.36"
+func tokenVersion(header, token string) (string, bool) {
+	i := strings.Index(header, token)
+	if i < 0 {
+		return "", false
+	}
+	rest := header[i+len(token):]
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == '_')
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	return rest[:end], true
+}
+
+// Metadata returns the parsed fields as nested event metadata
+func (ua UserAgent) Metadata() map[string]any {
+	m := make(map[string]any, 3)
+	if ua.Browser != "" {
+		m["browser"] = map[string]any{"name": ua.Browser, "version": ua.BrowserVersion}
+	}
+	if ua.OS != "" {
+		m["os"] = map[string]any{"name": ua.OS, "version": ua.OSVersion}
+	}
+	if ua.Device != "" {
+		m["device"] = ua.Device
+	}
+	return m
+}
@@ -0,0 +1,28 @@
+package bus
+
+import (
+	"errors"
+
+	pub "parsec/pkg/bus"
+)
+
+// Backends a Publisher can be built for
+const (
+	BackendKafka   = "kafka"
+	BackendNATS    = "nats"
+	BackendKinesis = "kinesis"
+	BackendPubSub  = "pubsub"
+	BackendAMQP    = "amqp"
+	BackendFile    = "file"
+	BackendForward = "forward"
+)
+
+// ErrSerializeFailed is returned when an envelope cannot be encoded
+var ErrSerializeFailed = errors.New("failed to serialize message")
+
+// Publisher and Stats are public so services embedding Parsec can supply
+// or reuse publishers; the aliases keep this package's names working
+type (
+	Publisher = pub.Publisher
+	Stats     = pub.Stats
+)
@@ -0,0 +1,308 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// ErrPublisherClosed is returned after Close
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// Dead-letter headers record where a message was headed and why it failed
+const (
+	HeaderDLQTopic = "dlq_topic"
+	HeaderDLQError = "dlq_error"
+)
+
+// Sender delivers encoded messages for a Dispatcher. Backends without
+// native headers are expected to frame them with MarshalRecord.
+type Sender interface {
+	// Send delivers messages and returns one error per message (nil when
+	// delivered). Errors wrapped in PermanentError are not retried.
+	Send(ctx context.Context, msgs []Message) []error
+
+	// Limits bounds the requests Send is called with
+	Limits() Limits
+
+	HealthCheck(ctx context.Context) error
+	Close() error
+}
+
+// Limits caps a single Send call
+type Limits struct {
+	// Messages is the most messages per call
+	Messages int
+
+	// Bytes is the most message bytes (Message.Size) per call; a larger
+	// message can never be delivered
+	Bytes int
+}
+
+// PermanentError marks a failure that retrying cannot fix, such as a
+// rejected message; the message is dead-lettered instead
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err as a PermanentError
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// Size approximates a message's size on the wire
+func (m Message) Size() int {
+	size := len(m.Key) + len(m.Value)
+	for _, h := range m.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	return size
+}
+
+// DispatchConfig controls retries and dead-lettering
+type DispatchConfig struct {
+	// MaxRetries is the number of retries for failed messages
+	MaxRetries int
+
+	// RetryBackoff is the initial backoff, doubled on each retry
+	RetryBackoff time.Duration
+
+	// DLQTopic receives permanently rejected messages ("" = drop them)
+	DLQTopic string
+}
+
+// Dispatcher is a Publisher over a Sender. It encodes envelopes, splits
+// them into requests within the sender's limits, retries only the messages
+// that failed and dead-letters the ones the bus rejected outright.
+type Dispatcher struct {
+	backend string
+	sender  Sender
+	encoder *Encoder
+	cfg     DispatchConfig
+	closed  atomic.Bool
+
+	// Metrics
+	messagesSent   atomic.Uint64
+	messagesFailed atomic.Uint64
+	bytesWritten   atomic.Uint64
+}
+
+// NewDispatcher creates a publisher for backend over sender
+func NewDispatcher(backend string, sender Sender, encoder *Encoder, cfg DispatchConfig) *Dispatcher {
+	return &Dispatcher{backend: backend, sender: sender, encoder: encoder, cfg: cfg}
+}
+
+// Publish sends an envelope and waits for delivery
+func (d *Dispatcher) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return d.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+// PublishBatch delivers envelopes, returning an error if any was neither
+// delivered nor dead-lettered
+func (d *Dispatcher) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	if d.closed.Load() {
+		return ErrPublisherClosed
+	}
+	if len(envelopes) == 0 {
+		return nil
+	}
+
+	log := logger.WithComponent("bus").With().Str("backend", d.backend).Logger()
+	start := time.Now()
+	defer func() {
+		metrics.BusPublishDuration.WithLabelValues(d.backend).Observe(time.Since(start).Seconds())
+	}()
+
+	msgs := make([]Message, 0, len(envelopes))
+	failed := 0
+	for _, envelope := range envelopes {
+		msg, err := d.encoder.Encode(ctx, envelope)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("event_id", envelope.Event.ID).
+				Str("tenant_id", envelope.Event.TenantID).
+				Msg("failed to serialize envelope")
+			failed++
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+
+	rejected, undelivered, lastErr := d.deliver(ctx, msgs)
+	if len(rejected) > 0 {
+		if d.cfg.DLQTopic == "" {
+			undelivered = append(undelivered, rejected...)
+		} else {
+			letters := make([]Message, len(rejected))
+			for i, r := range rejected {
+				letters[i] = deadLetter(r.msg, d.cfg.DLQTopic, r.err)
+			}
+			dlqRejected, dlqUndelivered, err := d.deliver(ctx, letters)
+			metrics.BusDeadLettered.WithLabelValues(d.backend).Add(float64(len(rejected) - len(dlqRejected) - len(dlqUndelivered)))
+			undelivered = append(undelivered, dlqRejected...)
+			undelivered = append(undelivered, dlqUndelivered...)
+			if err != nil {
+				lastErr = err
+			}
+		}
+	}
+
+	failed += len(undelivered)
+	if failed > 0 {
+		d.messagesFailed.Add(uint64(failed))
+		metrics.BusPublishTotal.WithLabelValues(d.backend, "failed").Add(float64(failed))
+	}
+	if len(undelivered) > 0 {
+		log.Error().
+			Ctx(ctx).
+			Err(lastErr).
+			Int("failed", len(undelivered)).
+			Int("batch_size", len(envelopes)).
+			Msg("publish failed after all retries")
+		return fmt.Errorf("%d of %d messages failed after %d attempts: %w", len(undelivered), len(envelopes), d.cfg.MaxRetries+1, lastErr)
+	}
+	return nil
+}
+
+// outcome is a message that was not delivered and why
+type outcome struct {
+	msg Message
+	err error
+}
+
+// deliver sends messages in requests within the sender's limits, retrying
+// transient failures. It returns the messages the bus rejected permanently
+// and the ones still failing once retries ran out.
+func (d *Dispatcher) deliver(ctx context.Context, msgs []Message) (rejected, undelivered []outcome, lastErr error) {
+	limits := d.sender.Limits()
+
+	pending := msgs[:0:0]
+	for _, msg := range msgs {
+		if limits.Bytes > 0 && msg.Size() > limits.Bytes {
+			// Too large for the bus, and for its dead-letter topic
+			err := fmt.Errorf("message of %d bytes exceeds the %d byte limit", msg.Size(), limits.Bytes)
+			undelivered, lastErr = append(undelivered, outcome{msg, err}), err
+			continue
+		}
+		pending = append(pending, msg)
+	}
+
+	backoff := d.cfg.RetryBackoff
+	for attempt := 0; attempt <= d.cfg.MaxRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			log := logger.WithComponent("bus")
+			log.Warn().
+				Str("backend", d.backend).
+				Int("attempt", attempt).
+				Int("pending", len(pending)).
+				Dur("backoff", backoff).
+				Msg("retrying publish")
+			metrics.BusPublishRetries.WithLabelValues(d.backend).Inc()
+
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				for _, msg := range pending {
+					undelivered = append(undelivered, outcome{msg, ctx.Err()})
+				}
+				return rejected, undelivered, ctx.Err()
+			}
+		}
+
+		var retry []Message
+		for _, chunk := range split(pending, limits) {
+			errs := d.sender.Send(ctx, chunk)
+			for i, msg := range chunk {
+				var err error
+				if i < len(errs) {
+					err = errs[i]
+				}
+				var permanent *PermanentError
+				switch {
+				case err == nil:
+					d.messagesSent.Add(1)
+					d.bytesWritten.Add(uint64(len(msg.Value)))
+					metrics.BusPublishTotal.WithLabelValues(d.backend, "success").Inc()
+				case errors.As(err, &permanent):
+					rejected, lastErr = append(rejected, outcome{msg, err}), err
+				default:
+					retry, lastErr = append(retry, msg), err
+				}
+			}
+		}
+		pending = retry
+	}
+
+	for _, msg := range pending {
+		undelivered = append(undelivered, outcome{msg, lastErr})
+	}
+	return rejected, undelivered, lastErr
+}
+
+// split chunks messages into requests within limits
+func split(msgs []Message, limits Limits) [][]Message {
+	var chunks [][]Message
+	start, size := 0, 0
+	for i, msg := range msgs {
+		full := limits.Messages > 0 && i-start >= limits.Messages
+		if limits.Bytes > 0 && size+msg.Size() > limits.Bytes {
+			full = true
+		}
+		if full && i > start {
+			chunks = append(chunks, msgs[start:i])
+			start, size = i, 0
+		}
+		size += msg.Size()
+	}
+	if start < len(msgs) {
+		chunks = append(chunks, msgs[start:])
+	}
+	return chunks
+}
+
+// deadLetter readdresses a rejected message to the DLQ topic, keeping its
+// key, value and headers so it can be replayed
+func deadLetter(msg Message, topic string, err error) Message {
+	headers := append([]Header(nil), msg.Headers...)
+	headers = append(headers,
+		Header{Key: HeaderDLQTopic, Value: []byte(msg.Topic)},
+		Header{Key: HeaderDLQError, Value: []byte(err.Error())},
+	)
+	return Message{Topic: topic, Key: msg.Key, Value: msg.Value, Headers: headers, Time: msg.Time}
+}
+
+// HealthCheck verifies the bus is reachable
+func (d *Dispatcher) HealthCheck(ctx context.Context) error {
+	if d.closed.Load() {
+		return ErrPublisherClosed
+	}
+	return d.sender.HealthCheck(ctx)
+}
+
+// Stats returns publisher statistics
+func (d *Dispatcher) Stats() Stats {
+	return Stats{
+		MessagesSent:   d.messagesSent.Load(),
+		MessagesFailed: d.messagesFailed.Load(),
+		BytesWritten:   d.bytesWritten.Load(),
+	}
+}
+
+// Close closes the sender
+func (d *Dispatcher) Close() error {
+	if d.closed.Swap(true) {
+		return nil
+	}
+	return d.sender.Close()
+}
@@ -0,0 +1,180 @@
+package bus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"parsec/internal/encryption"
+	"parsec/internal/flags"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Envelope value encodings, recorded in the content-encoding header
+const (
+	HeaderContentEncoding = "content-encoding"
+	EncodingGzip          = "gzip"
+
+	// HeaderEncryptionKeyID names the key an encrypted envelope was sealed
+	// with; the value is compressed (if at all) before it is encrypted
+	HeaderEncryptionKeyID = "encryption-key-id"
+)
+
+// HeaderPartition asks a bus that partitions topics to write the message
+// to the partition it names rather than balance it
+const HeaderPartition = "partition"
+
+// HeaderRetentionSeconds carries an event's retention hint, so storage
+// consumers can place it without decoding the envelope
+const HeaderRetentionSeconds = "retention_seconds"
+
+// Header is a message header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is an encoded envelope, independent of the bus carrying it
+type Message struct {
+	// Topic is the Kafka topic; other buses map it to a subject, stream,
+	// topic or routing key
+	Topic string
+
+	// Key partitions messages by tenant
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	Time    time.Time
+}
+
+// Encoder turns envelopes into messages with the same headers, compression
+// and encryption on every bus
+type Encoder struct {
+	// Topic is used for envelopes without a routed topic
+	Topic string
+
+	// CompressThreshold gzips envelopes at least this large (0 = off)
+	CompressThreshold int
+
+	// Flags gates compression on the envelope_compression flag per tenant;
+	// nil compresses for every tenant
+	Flags *flags.Manager
+
+	// Cipher seals envelopes of tenants with a key (nil = plaintext)
+	Cipher *encryption.Cipher
+}
+
+// Encode serializes an envelope, compressing large envelopes individually
+// and encrypting them for encrypted tenants
+func (e *Encoder) Encode(ctx context.Context, envelope *models.Envelope) (Message, error) {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrSerializeFailed, err)
+	}
+
+	topic := e.Topic
+	if envelope.Topic != "" {
+		topic = envelope.Topic
+	}
+
+	msg := Message{
+		Topic: topic,
+		Key:   []byte(envelope.PartitionKey), // Partition by tenant
+		Value: data,
+		Headers: []Header{
+			{Key: "tenant_id", Value: []byte(envelope.Event.TenantID)},
+			{Key: "event_id", Value: []byte(envelope.Event.ID)},
+			{Key: "ingest_node", Value: []byte(envelope.IngestNode)},
+			{Key: "severity", Value: []byte(envelope.Event.Severity)},
+		},
+		Time: envelope.ReceivedAt,
+	}
+
+	if envelope.Priority != "" {
+		msg.Headers = append(msg.Headers, Header{Key: "priority", Value: []byte(envelope.Priority)})
+	}
+
+	if envelope.Retention != "" {
+		msg.Headers = append(msg.Headers, Header{Key: "retention", Value: []byte(envelope.Retention)})
+	}
+
+	if envelope.RetentionSeconds > 0 {
+		msg.Headers = append(msg.Headers, Header{Key: HeaderRetentionSeconds, Value: []byte(strconv.FormatInt(envelope.RetentionSeconds, 10))})
+	}
+
+	if envelope.Region != "" {
+		msg.Headers = append(msg.Headers, Header{Key: "region", Value: []byte(envelope.Region)})
+	}
+
+	if envelope.BatchID != "" {
+		msg.Headers = append(msg.Headers,
+			Header{Key: "batch_id", Value: []byte(envelope.BatchID)},
+			Header{Key: "batch_index", Value: []byte(strconv.Itoa(envelope.BatchIndex))},
+		)
+	}
+
+	if envelope.Partition != nil {
+		msg.Headers = append(msg.Headers, Header{Key: HeaderPartition, Value: []byte(strconv.Itoa(*envelope.Partition))})
+	}
+
+	if e.shouldCompress(envelope, len(data)) {
+		compressed, err := compressValue(data)
+		if err != nil {
+			return Message{}, fmt.Errorf("%w: %v", ErrSerializeFailed, err)
+		}
+
+		// Only keep the compressed form if it actually saves space
+		if len(compressed) < len(data) {
+			msg.Value = compressed
+			msg.Headers = append(msg.Headers, Header{Key: HeaderContentEncoding, Value: []byte(EncodingGzip)})
+			metrics.KafkaEnvelopesCompressed.Inc()
+			metrics.KafkaEnvelopeBytesSaved.Add(float64(len(data) - len(compressed)))
+		}
+	}
+
+	// Encrypt last; ciphertext does not compress
+	if e.Cipher != nil {
+		sealed, keyID, err := e.Cipher.Seal(ctx, envelope.Event.TenantID, msg.Value)
+		if err != nil {
+			// Never fall back to plaintext for an encrypted tenant
+			metrics.KafkaEncryptionFailures.Inc()
+			return Message{}, fmt.Errorf("%w: encrypt: %v", ErrSerializeFailed, err)
+		}
+		if keyID != "" {
+			msg.Value = sealed
+			msg.Headers = append(msg.Headers, Header{Key: HeaderEncryptionKeyID, Value: []byte(keyID)})
+			metrics.KafkaEnvelopesEncrypted.Inc()
+		}
+	}
+
+	return msg, nil
+}
+
+// shouldCompress reports whether an envelope qualifies for per-envelope compression
+func (e *Encoder) shouldCompress(envelope *models.Envelope, size int) bool {
+	if e.CompressThreshold <= 0 || size < e.CompressThreshold {
+		return false
+	}
+	if e.Flags != nil {
+		return e.Flags.Enabled(flags.EnvelopeCompression, envelope.Event.TenantID)
+	}
+	return true
+}
+
+// compressValue gzips a serialized envelope
+func compressValue(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
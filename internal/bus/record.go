@@ -0,0 +1,43 @@
+package bus
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// record frames a message for buses that carry only a payload
+type record struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Value   []byte            `json:"value"`
+}
+
+// MarshalRecord frames a message's headers and value as JSON, so that
+// consumers of header-less buses (Kinesis) can still tell how an envelope
+// was compressed or encrypted
+func MarshalRecord(msg Message) ([]byte, error) {
+	r := record{Value: msg.Value}
+	if len(msg.Headers) > 0 {
+		r.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			r.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return json.Marshal(r)
+}
+
+// UnmarshalRecord reverses MarshalRecord
+func UnmarshalRecord(data []byte) (Message, error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Message{}, err
+	}
+	if r.Value == nil {
+		return Message{}, errors.New("record has no value")
+	}
+
+	msg := Message{Value: r.Value}
+	for k, v := range r.Headers {
+		msg.Headers = append(msg.Headers, Header{Key: k, Value: []byte(v)})
+	}
+	return msg, nil
+}
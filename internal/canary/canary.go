@@ -0,0 +1,271 @@
+// Package canary sends synthetic events through the pipeline and confirms
+// they come out the other end. Each node marks its canaries with its node
+// ID, times them at each stage they are seen (published by the workers,
+// read back from Kafka, handled by a storage consumer) and counts those
+// never confirmed as lost, so delivery is checked end to end rather than
+// by whether the producer is connected. Given the topic's partition count,
+// canaries rotate across partitions so one that stops accepting writes is
+// noticed too.
+package canary
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Source is the source of canary events
+const Source = "parsec-canary"
+
+// Metadata keys set on canary events
+const (
+	MetaNode      = "canary_node"
+	MetaSeq       = "canary_seq"
+	MetaPartition = "canary_partition"
+)
+
+// Stages a canary is seen at
+const (
+	StagePublished = "published"
+	StageKafka     = "kafka"
+	StageStorage   = "storage"
+)
+
+// Config holds canary settings
+type Config struct {
+	// NodeID marks this node's canaries
+	NodeID string
+
+	// Tenant receives canary events
+	Tenant string
+
+	// Interval is how often a canary is sent (0 = 30s)
+	Interval time.Duration
+
+	// Timeout is how long a canary has to be confirmed before it counts as
+	// lost (0 = 1m)
+	Timeout time.Duration
+
+	// Confirm is the stage that confirms delivery (default StagePublished)
+	Confirm string
+
+	// Partitions returns how many partitions canaries rotate across (nil
+	// or 0 = leave partitioning to the bus)
+	Partitions func() int
+}
+
+// Stats reports the canaries this node sent
+type Stats struct {
+	Sent      uint64 `json:"sent"`
+	Delivered uint64 `json:"delivered"`
+	Lost      uint64 `json:"lost"`
+	Pending   int    `json:"pending"`
+
+	// Confirm is the stage that confirms delivery
+	Confirm string `json:"confirm"`
+
+	// LastDelivered is when a canary was last confirmed, with its latency
+	// from being sent
+	LastDelivered *time.Time `json:"last_delivered,omitempty"`
+	LastLatencyMS float64    `json:"last_latency_ms"`
+}
+
+// Canary sends canary events and tracks them until they are confirmed
+type Canary struct {
+	cfg  Config
+	emit func(event *models.LogEvent, partition *int)
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[string]pending
+	stats   Stats
+}
+
+// pending is a canary awaiting confirmation
+type pending struct {
+	sent      time.Time
+	partition *int
+}
+
+// New creates a canary passing its events to emit, with the partition to
+// write each to (nil = any)
+func New(cfg Config, emit func(event *models.LogEvent, partition *int)) *Canary {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.Confirm == "" {
+		cfg.Confirm = StagePublished
+	}
+	return &Canary{
+		cfg:     cfg,
+		emit:    emit,
+		pending: make(map[string]pending),
+		stats:   Stats{Confirm: cfg.Confirm},
+	}
+}
+
+// Run sends a canary every interval, and expires those not confirmed in
+// time, until ctx is cancelled
+func (c *Canary) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			c.Expire(now)
+			c.Send(now)
+		}
+	}
+}
+
+// Send emits a canary event at now
+func (c *Canary) Send(now time.Time) {
+	id := uuid.NewString()
+	var partitions int
+	if c.cfg.Partitions != nil {
+		partitions = c.cfg.Partitions()
+	}
+
+	c.mu.Lock()
+	c.seq++
+	seq := c.seq
+	var partition *int
+	if partitions > 0 {
+		n := int((seq - 1) % uint64(partitions))
+		partition = &n
+	}
+	c.pending[id] = pending{sent: now, partition: partition}
+	c.stats.Sent++
+	c.mu.Unlock()
+
+	event := &models.LogEvent{
+		ID:        id,
+		TenantID:  c.cfg.Tenant,
+		Timestamp: now.UTC(),
+		Severity:  models.SeverityInfo,
+		Source:    Source,
+		Message:   "canary " + strconv.FormatUint(seq, 10) + " from " + c.cfg.NodeID,
+		Metadata: models.Metadata{
+			MetaNode: c.cfg.NodeID,
+			MetaSeq:  seq,
+		},
+	}
+	if partition != nil {
+		event.Metadata[MetaPartition] = *partition
+	}
+
+	metrics.CanaryEvents.WithLabelValues("sent").Inc()
+	c.emit(event, partition)
+}
+
+// Observe records that this node's canary id was seen at stage at now,
+// confirming it at the confirm stage. Other event IDs are ignored, so
+// every message read from the bus can be passed in.
+func (c *Canary) Observe(stage, id string, now time.Time) {
+	c.mu.Lock()
+	p, ok := c.pending[id]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	latency := now.Sub(p.sent)
+	confirmed := stage == c.cfg.Confirm
+	if confirmed {
+		delete(c.pending, id)
+		c.stats.Delivered++
+		c.stats.LastDelivered = &now
+		c.stats.LastLatencyMS = float64(latency) / float64(time.Millisecond)
+	}
+	c.mu.Unlock()
+
+	metrics.CanaryLatency.WithLabelValues(stage).Observe(latency.Seconds())
+	if confirmed {
+		metrics.CanaryEvents.WithLabelValues("delivered").Inc()
+		metrics.CanaryLastDelivered.Set(float64(now.Unix()))
+	}
+}
+
+// Published observes the canaries among envelopes the workers published;
+// it has the signature of worker.Config.OnPublish
+func (c *Canary) Published(published, _ []*models.Envelope) {
+	now := time.Now()
+	for _, envelope := range published {
+		if envelope.Event.Source == Source {
+			c.Observe(StagePublished, envelope.Event.ID, now)
+		}
+	}
+}
+
+// Expire counts canaries unconfirmed after the timeout as lost, logging
+// the partitions they were written to
+func (c *Canary) Expire(now time.Time) {
+	c.mu.Lock()
+	var lost int
+	var partitions []int
+	for id, p := range c.pending {
+		if now.Sub(p.sent) > c.cfg.Timeout {
+			delete(c.pending, id)
+			lost++
+			if p.partition != nil && !slices.Contains(partitions, *p.partition) {
+				partitions = append(partitions, *p.partition)
+			}
+		}
+	}
+	c.stats.Lost += uint64(lost)
+	c.mu.Unlock()
+
+	if lost > 0 {
+		slices.Sort(partitions)
+		log := logger.WithComponent("canary")
+		log.Warn().Int("lost", lost).Ints("partitions", partitions).Dur("timeout", c.cfg.Timeout).Str("confirm", c.cfg.Confirm).Msg("canary events not delivered")
+		metrics.CanaryEvents.WithLabelValues("lost").Add(float64(lost))
+	}
+}
+
+// Stats returns the canary counts
+func (c *Canary) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Pending = len(c.pending)
+	return s
+}
+
+// WatchKafka confirms canaries as they are read back from topic, until
+// ctx is cancelled. Each node reads as its own consumer group, so it sees
+// every partition.
+func (c *Canary) WatchKafka(ctx context.Context, brokers []string, topic string) error {
+	return kafka.WatchHeader(ctx, brokers, topic, "parsec-canary-"+c.cfg.NodeID, "event_id", func(id string) {
+		c.Observe(StageKafka, id, time.Now())
+	})
+}
+
+// StoredHandler is consumer middleware timing canaries once a storage
+// handler has written them, measured from their timestamp since the
+// consumer runs apart from the node that sent them. Add it last, so it
+// wraps the storage handler itself.
+func StoredHandler(next kafka.MessageHandler) kafka.MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		err := next(ctx, envelope)
+		if event := envelope.Event; err == nil && event.Source == Source {
+			metrics.CanaryLatency.WithLabelValues(StageStorage).Observe(time.Since(event.Timestamp).Seconds())
+		}
+		return err
+	}
+}
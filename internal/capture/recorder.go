@@ -0,0 +1,306 @@
+// Package capture keeps a sample of raw agent requests and their
+// responses in memory, so a misbehaving agent can be debugged from what it
+// actually sent without turning on debug logging for everyone. Capture is
+// off until the request_capture feature flag enables it, globally or for
+// some tenants; captured bodies are size-capped and redacted.
+package capture
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"parsec/internal/flags"
+	"parsec/internal/metrics"
+)
+
+// Config holds capture settings
+type Config struct {
+	// PerMinute caps captures per tenant per minute (0 = 5)
+	PerMinute int
+
+	// MaxBodyBytes caps the request and response body kept per capture
+	// (0 = 4096)
+	MaxBodyBytes int
+
+	// Size is how many captures the ring buffer holds (0 = 200)
+	Size int
+}
+
+// Capture is a recorded request and its response
+type Capture struct {
+	ID        uint64    `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Route  string `json:"route,omitempty"`
+
+	Status     int     `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+
+	Headers map[string]string `json:"headers"`
+
+	// Bodies are cut off at MaxBodyBytes; binary and compressed bodies are
+	// described rather than kept
+	RequestBody       string `json:"request_body"`
+	RequestTruncated  bool   `json:"request_truncated,omitempty"`
+	ResponseBody      string `json:"response_body"`
+	ResponseTruncated bool   `json:"response_truncated,omitempty"`
+}
+
+// Recorder samples requests into a ring buffer
+type Recorder struct {
+	cfg   Config
+	flags *flags.Manager
+
+	mu      sync.Mutex
+	ring    []Capture
+	next    int
+	seq     uint64
+	minute  int64
+	counted map[string]int
+}
+
+// NewRecorder creates a recorder gated by the request_capture flag
+func NewRecorder(manager *flags.Manager, cfg Config) *Recorder {
+	if cfg.PerMinute <= 0 {
+		cfg.PerMinute = 5
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 4096
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 200
+	}
+	return &Recorder{
+		cfg:     cfg,
+		flags:   manager,
+		ring:    make([]Capture, 0, cfg.Size),
+		counted: make(map[string]int),
+	}
+}
+
+// Middleware captures requests while the flag is on for some tenant. The
+// request body is recorded as the handler reads it, so requests pass
+// through unchanged.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rec.flags.AnyEnabled(flags.RequestCapture) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		body := &teeBody{ReadCloser: r.Body, max: rec.cfg.MaxBodyBytes}
+		r.Body = body
+		cw := &captureWriter{ResponseWriter: w, max: rec.cfg.MaxBodyBytes, status: http.StatusOK}
+
+		next.ServeHTTP(cw, r)
+
+		// Requests rejected before their body was read still show it
+		body.fill()
+		rec.record(r, body, cw, time.Since(start))
+	})
+}
+
+// record keeps a capture if the flag is on for its tenant and the tenant
+// is within its per-minute quota
+func (rec *Recorder) record(r *http.Request, body *teeBody, cw *captureWriter, elapsed time.Duration) {
+	tenant := tenantOf(r, body.buf)
+	if !rec.flags.Enabled(flags.RequestCapture, tenant) {
+		return
+	}
+	if !rec.allow(tenant) {
+		metrics.RequestCaptures.WithLabelValues("rate_limited").Inc()
+		return
+	}
+
+	c := Capture{
+		Time:              time.Now().UTC(),
+		RequestID:         r.Header.Get("X-Request-ID"),
+		TenantID:          tenant,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Query:             redactQuery(r.URL.Query()),
+		Route:             r.Pattern,
+		Status:            cw.status,
+		DurationMS:        float64(elapsed.Microseconds()) / 1e3,
+		Headers:           redactHeaders(r.Header),
+		RequestBody:       bodyText(body.buf, r.Header.Get("Content-Encoding")),
+		RequestTruncated:  body.truncated,
+		ResponseBody:      bodyText(cw.buf, cw.Header().Get("Content-Encoding")),
+		ResponseTruncated: cw.truncated,
+	}
+	rec.add(c)
+	metrics.RequestCaptures.WithLabelValues("captured").Inc()
+}
+
+// allow counts a capture against the tenant's quota for this minute
+func (rec *Recorder) allow(tenant string) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if minute := time.Now().Unix() / 60; minute != rec.minute {
+		rec.minute = minute
+		clear(rec.counted)
+	}
+	if rec.counted[tenant] >= rec.cfg.PerMinute {
+		return false
+	}
+	rec.counted[tenant]++
+	return true
+}
+
+// add stores a capture, overwriting the oldest once the ring is full
+func (rec *Recorder) add(c Capture) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.seq++
+	c.ID = rec.seq
+	if len(rec.ring) < rec.cfg.Size {
+		rec.ring = append(rec.ring, c)
+		return
+	}
+	rec.ring[rec.next] = c
+	rec.next = (rec.next + 1) % rec.cfg.Size
+}
+
+// List returns up to limit captures, newest first, optionally for one
+// tenant (limit <= 0 = all)
+func (rec *Recorder) List(tenant string, limit int) []Capture {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	captures := []Capture{}
+	for i := len(rec.ring) - 1; i >= 0; i-- {
+		c := rec.ring[(rec.next+i)%len(rec.ring)]
+		if tenant != "" && c.TenantID != tenant {
+			continue
+		}
+		captures = append(captures, c)
+		if limit > 0 && len(captures) == limit {
+			break
+		}
+	}
+	return captures
+}
+
+// Clear discards every capture
+func (rec *Recorder) Clear() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.ring, rec.next = rec.ring[:0], 0
+}
+
+// tenantField finds the first tenant_id in a JSON body, complete or not
+var tenantField = regexp.MustCompile(`"tenant_id"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+
+// tenantOf resolves a request's tenant from its path, its query or, for
+// ingest bodies, the first event's tenant_id ("" when none is found)
+func tenantOf(r *http.Request, body []byte) string {
+	if tenant := r.PathValue("tenant"); tenant != "" {
+		return tenant
+	}
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		return tenant
+	}
+	if m := tenantField.FindSubmatch(body); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// bodyText renders a captured body, redacted, or describes one that isn't text
+func bodyText(body []byte, encoding string) string {
+	switch {
+	case len(body) == 0:
+		return ""
+	case encoding != "" && encoding != "identity":
+		return "[" + encoding + " encoded body omitted]"
+	case !utf8.Valid(body):
+		return "[binary body omitted]"
+	}
+	return RedactBody(string(body))
+}
+
+// redactQuery encodes query parameters, masking sensitive ones
+func redactQuery(q url.Values) string {
+	for name := range q {
+		if sensitiveName.MatchString(name) {
+			q[name] = []string{Redacted}
+		}
+	}
+	return q.Encode()
+}
+
+// teeBody records up to max bytes of a request body as it is read
+type teeBody struct {
+	io.ReadCloser
+	max       int
+	buf       []byte
+	truncated bool
+	eof       bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.keep(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// keep appends read bytes up to the cap
+func (b *teeBody) keep(p []byte) {
+	room := b.max - len(b.buf)
+	if len(p) > room {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+}
+
+// fill reads what the handler left unread, up to the cap
+func (b *teeBody) fill() {
+	if b.eof || b.truncated || b.ReadCloser == nil || b.ReadCloser == http.NoBody {
+		return
+	}
+	rest := make([]byte, b.max-len(b.buf)+1)
+	n, _ := io.ReadFull(b.ReadCloser, rest)
+	b.keep(rest[:n])
+}
+
+// captureWriter records the status and up to max bytes of the response
+type captureWriter struct {
+	http.ResponseWriter
+	max       int
+	status    int
+	buf       []byte
+	truncated bool
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	room := w.max - len(w.buf)
+	if len(p) > room {
+		w.buf = append(w.buf, p[:max(room, 0)]...)
+		w.truncated = true
+	} else {
+		w.buf = append(w.buf, p...)
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"net/http"
+	"regexp"
+
+	"parsec/internal/signing"
+)
+
+// Redacted replaces sensitive values in captures
+const Redacted = "[REDACTED]"
+
+// sensitiveNames are substrings of field, parameter and header names
+// whose values suggest a credential or personal data
+const sensitiveNames = `password|passwd|secret|token|api[_-]?key|authorization|cookie|session|email|phone|ssn`
+
+// Patterns redacted from captured bodies. Bodies are often cut off at the
+// size cap, so they are matched as text rather than parsed.
+var (
+	sensitiveName = regexp.MustCompile(`(?i)` + sensitiveNames)
+
+	// sensitiveField matches a JSON string field with a sensitive name,
+	// keeping the name
+	sensitiveField = regexp.MustCompile(`(?i)("[\w-]*(?:` + sensitiveNames + `)[\w-]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+	email      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	cardNumber = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	bearer     = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+// RedactBody masks credentials and personal data in a captured body:
+// values of fields named like passwords, tokens or emails, and email
+// addresses, card numbers and bearer tokens anywhere
+func RedactBody(body string) string {
+	body = sensitiveField.ReplaceAllString(body, `$1"`+Redacted+`"`)
+	body = bearer.ReplaceAllString(body, Redacted)
+	body = email.ReplaceAllString(body, Redacted)
+	return cardNumber.ReplaceAllStringFunc(body, func(digits string) string {
+		// Timestamps and IDs are digit runs too; only checksummed ones go
+		if luhn(digits) {
+			return Redacted
+		}
+		return digits
+	})
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum card
+// numbers carry
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// redactHeaders flattens headers, masking credentials
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if len(values) == 0 {
+			continue
+		}
+		if sensitiveName.MatchString(name) || http.CanonicalHeaderKey(name) == signing.HeaderSignature {
+			out[name] = Redacted
+			continue
+		}
+		out[name] = values[0]
+	}
+	return out
+}
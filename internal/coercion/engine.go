@@ -0,0 +1,225 @@
+package coercion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding all tenants' field type rules, as a
+// versioned value (see state.Versioned)
+const StoreKey = "parsec:field_types"
+
+// Engine applies per-tenant field type rules as a pipeline stage. Rules are
+// shared across nodes via the StateStore and reloaded by Run.
+type Engine struct {
+	shared *state.Versioned
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu    sync.RWMutex
+	rules map[string][]Rule
+}
+
+// NewEngine creates a coercion engine backed by the given store (may be nil)
+func NewEngine(store state.StateStore) *Engine {
+	e := &Engine{rules: make(map[string][]Rule)}
+	if store != nil {
+		e.shared = state.NewVersioned(store, StoreKey)
+	}
+	return e
+}
+
+// Name implements pipeline.Stage
+func (e *Engine) Name() string { return "coerce" }
+
+// Process implements pipeline.Stage. Typed fields are copied to the event's
+// TypedMetadata and their string values rewritten in canonical form. Values
+// that do not parse are left as strings and counted; they never reject the
+// event.
+func (e *Engine) Process(ctx context.Context, event *models.LogEvent) (pipeline.Result, error) {
+	if e == nil || len(event.Metadata) == 0 {
+		return pipeline.Result{}, nil
+	}
+
+	e.mu.RLock()
+	rules := e.rules[event.TenantID]
+	e.mu.RUnlock()
+
+	dryRun := pipeline.IsDryRun(ctx)
+	var result pipeline.Result
+	failed := 0
+	for _, rule := range rules {
+		value, ok := event.Metadata[rule.Field]
+		if !ok {
+			continue
+		}
+
+		typed, canonical, err := rule.Coerce(models.Stringify(value))
+		if err != nil {
+			failed++
+			if !dryRun {
+				metrics.MetadataCoercions.WithLabelValues(event.TenantID, "failed").Inc()
+			}
+			continue
+		}
+		if !dryRun {
+			metrics.MetadataCoercions.WithLabelValues(event.TenantID, "ok").Inc()
+		}
+
+		if event.TypedMetadata == nil {
+			event.TypedMetadata = make(map[string]any, len(rules))
+		}
+		event.TypedMetadata[rule.Field] = typed
+		event.Metadata[rule.Field] = canonical
+		result.Changed = true
+	}
+
+	if failed > 0 {
+		result.Detail = fmt.Sprintf("%d failed", failed)
+	}
+	return result, nil
+}
+
+// Rules returns a tenant's rules
+func (e *Engine) Rules(tenantID string) []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules[tenantID]...)
+}
+
+// Config implements pipeline.Configured: every tenant's rules
+func (e *Engine) Config() any {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rules := make(map[string][]Rule, len(e.rules))
+	for tenantID, r := range e.rules {
+		rules[tenantID] = append([]Rule(nil), r...)
+	}
+	return rules
+}
+
+// SetRules validates and replaces a tenant's rules. An empty list removes them.
+func (e *Engine) SetRules(ctx context.Context, tenantID string, rules []Rule) error {
+	if len(rules) > MaxRulesPerTenant {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyRules, len(rules), MaxRulesPerTenant)
+	}
+	seen := make(map[string]bool, len(rules))
+	for i := range rules {
+		rules[i].normalize()
+		if err := rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if seen[rules[i].Field] {
+			return fmt.Errorf("rule %d: %w: %s", i, ErrDuplicateRule, rules[i].Field)
+		}
+		seen[rules[i].Field] = true
+	}
+
+	e.writing.Lock()
+	defer e.writing.Unlock()
+
+	apply := func(data []byte) (map[string][]Rule, error) {
+		current := make(map[string][]Rule)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse field type rules: %w", err)
+			}
+		} else {
+			e.mu.RLock()
+			for id, r := range e.rules {
+				current[id] = r
+			}
+			e.mu.RUnlock()
+		}
+		if len(rules) == 0 {
+			delete(current, tenantID)
+		} else {
+			current[tenantID] = rules
+		}
+		return current, nil
+	}
+
+	var next map[string][]Rule
+	if e.shared == nil {
+		next, _ = apply(nil)
+	} else {
+		// Applied to the stored rules, again if another node changed them
+		// meanwhile, so every tenant's change is kept
+		err := e.shared.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if next, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(next)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	e.rules = next
+	e.mu.Unlock()
+	return nil
+}
+
+// Load replaces the in-memory rules with those in the store
+func (e *Engine) Load(ctx context.Context) error {
+	if e.shared == nil {
+		return nil
+	}
+
+	data, err := e.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the rules set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	rules := make(map[string][]Rule)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse field type rules: %w", err)
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Run reloads rules periodically so changes made on other nodes propagate
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("coercion")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload field type rules")
+			}
+		}
+	}
+}
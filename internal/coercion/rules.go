@@ -0,0 +1,98 @@
+package coercion
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"parsec/pkg/models"
+)
+
+// Type is the type a metadata value is coerced to
+type Type string
+
+const (
+	TypeInt   Type = "int"
+	TypeFloat Type = "float"
+	TypeBool  Type = "bool"
+)
+
+// Rule validation errors
+var (
+	ErrMissingField  = errors.New("rule requires a field")
+	ErrUnknownType   = errors.New("type must be int, float or bool")
+	ErrDuplicateRule = errors.New("field has more than one rule")
+	ErrTooManyRules  = errors.New("too many field type rules")
+)
+
+// errNotCoercible is returned for values that do not parse as the rule's type
+var errNotCoercible = errors.New("value not coercible")
+
+// MaxRulesPerTenant matches the metadata key limit: one rule per key
+const MaxRulesPerTenant = models.MaxMetadataKeys
+
+// Rule types a metadata field, e.g. {"field":"latency_ms","type":"float"}
+type Rule struct {
+	Field string `json:"field"`
+	Type  Type   `json:"type"`
+}
+
+// normalize lowercases the field like NormalizeStage does metadata keys
+func (r *Rule) normalize() {
+	r.Field = strings.ToLower(strings.TrimSpace(r.Field))
+	r.Type = Type(strings.ToLower(strings.TrimSpace(string(r.Type))))
+}
+
+// Validate checks the rule is well-formed
+func (r Rule) Validate() error {
+	if r.Field == "" {
+		return ErrMissingField
+	}
+	switch r.Type {
+	case TypeInt, TypeFloat, TypeBool:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownType, r.Type)
+	}
+}
+
+// Coerce parses a metadata value as the rule's type. It returns the typed
+// value and the value's canonical string form, so the string metadata and
+// the typed copy agree (e.g. "YES" becomes true and "true").
+func (r Rule) Coerce(value string) (any, string, error) {
+	value = strings.TrimSpace(value)
+
+	switch r.Type {
+	case TypeInt:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n, strconv.FormatInt(n, 10), nil
+		}
+		// Accept integral floats such as "200.0" or "1e3"
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, "", errNotCoercible
+		}
+		n := int64(f)
+		return n, strconv.FormatInt(n, 10), nil
+
+	case TypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		// NaN and infinities have no JSON encoding
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, "", errNotCoercible
+		}
+		return f, strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case TypeBool:
+		switch strings.ToLower(value) {
+		case "true", "t", "1", "yes", "y", "on":
+			return true, "true", nil
+		case "false", "f", "0", "no", "n", "off":
+			return false, "false", nil
+		}
+		return nil, "", errNotCoercible
+	}
+	return nil, "", fmt.Errorf("%w: %q", ErrUnknownType, r.Type)
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Values for PARSEC_STRICT_CONFIG
+const (
+	StrictOff    = "off"
+	StrictWarn   = "warn"
+	StrictReject = "reject"
+)
+
+// strictPrefixes are the prefixes of variables checked against the known
+// names; other variables belong to the environment, not to Parsec
+var strictPrefixes = []string{"KAFKA_", "PARSEC_"}
+
+// maxSuggestDistance bounds the edits between an unknown variable and the
+// known name suggested for it
+const maxSuggestDistance = 3
+
+var (
+	// knownEnv records every variable load reads
+	knownEnv     sync.Map
+	knownEnvOnce sync.Once
+)
+
+// UnknownVar is a variable that looks like configuration but isn't read
+type UnknownVar struct {
+	Name string
+
+	// Suggestion is the closest known variable, if one is close enough
+	Suggestion string
+}
+
+func (u UnknownVar) String() string {
+	if u.Suggestion == "" {
+		return u.Name
+	}
+	return u.Name + " (did you mean " + u.Suggestion + "?)"
+}
+
+// CheckStrict reports an error for modes other than off, warn and reject
+func CheckStrict(mode string) error {
+	switch mode {
+	case StrictOff, StrictWarn, StrictReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown strict config mode %q (want off, warn or reject)", mode)
+	}
+}
+
+// KnownEnv returns the variables read by FromEnv, sorted
+func KnownEnv() []string {
+	// FromEnv reads every variable regardless of the values set, so one
+	// pass records them all
+	knownEnvOnce.Do(func() { FromEnv() })
+
+	var names []string
+	knownEnv.Range(func(key, _ any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// UnknownEnv returns the KAFKA_* and PARSEC_* variables in environ
+// ("NAME=value" entries, as from os.Environ) that FromEnv doesn't read,
+// sorted by name, with the closest known name for likely misspellings such
+// as KAFKA_BATCHSIZE
+func UnknownEnv(environ []string) []UnknownVar {
+	known := KnownEnv()
+	isKnown := make(map[string]bool, len(known))
+	for _, name := range known {
+		isKnown[name] = true
+	}
+
+	var unknown []UnknownVar
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if isKnown[name] || !strictPrefixed(name) {
+			continue
+		}
+		unknown = append(unknown, UnknownVar{Name: name, Suggestion: suggest(name, known)})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Name < unknown[j].Name })
+	return unknown
+}
+
+// strictPrefixed reports whether name has one of the checked prefixes
+func strictPrefixed(name string) bool {
+	for _, prefix := range strictPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the known name closest to name. Names that differ only
+// in case or underscores match outright; otherwise the nearest within
+// maxSuggestDistance edits is chosen, the first in order on ties.
+func suggest(name string, known []string) string {
+	squash := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, "_", "")) }
+
+	best, bestDistance := "", maxSuggestDistance+1
+	for _, candidate := range known {
+		if squash(candidate) == squash(name) {
+			return candidate
+		}
+		if d := distance(strings.ToUpper(name), candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
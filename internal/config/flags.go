@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Load builds the configuration from command-line flags, environment
+// variables and a configuration file, in that order of precedence, over
+// the defaults (and profile). Every variable has a flag named after it:
+// KAFKA_BROKERS is --kafka-brokers, and PARSEC_PROFILE is --profile.
+// --config names the file, which sets variables as NAME=value lines, like
+// a systemd EnvironmentFile. Values are parsed as FromEnv parses the
+// variables. Flags that fail to parse return an error, as flag.ErrHelp
+// for -h and --help.
+func Load(name string, args []string, output io.Writer) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configFile := fs.String("config", "", "configuration file of NAME=value lines")
+	flagNames := make(map[string]string)
+	values := make(map[string]*string)
+	for _, env := range KnownEnv() {
+		flagName := FlagName(env)
+		flagNames[flagName] = env
+		values[env] = fs.String(flagName, "", "overrides "+env)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var file map[string]string
+	if *configFile != "" {
+		var err error
+		if file, err = ReadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// A flag set to an empty value masks the environment and file,
+	// restoring the default
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[flagNames[f.Name]] = true })
+
+	return load(func(env string) string {
+		if set[env] {
+			return *values[env]
+		}
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+		return file[env]
+	}), nil
+}
+
+// FlagName returns the flag for a variable: lower case, with dashes for
+// underscores and without the PARSEC_ prefix
+func FlagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, "PARSEC_")), "_", "-")
+}
+
+// ReadFile reads a configuration file of NAME=value lines. Blank lines and
+// lines starting with # are skipped, an "export " prefix is allowed, and
+// values may be quoted. Names that aren't configuration variables are an
+// error.
+func ReadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	known := make(map[string]bool)
+	for _, name := range KnownEnv() {
+		known[name] = true
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, n)
+		}
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			unknown := UnknownVar{Name: name, Suggestion: suggest(name, KnownEnv())}
+			return nil, fmt.Errorf("%s:%d: unknown setting %s", path, n, unknown)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
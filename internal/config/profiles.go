@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile names for PARSEC_PROFILE
+const (
+	ProfileDev                = "dev"
+	ProfileStaging            = "staging"
+	ProfileProdHighThroughput = "prod-high-throughput"
+)
+
+// profiles bundle tuned settings for common deployments. A profile is
+// applied over the defaults; environment variables still override it.
+var profiles = map[string]func(cfg *Config){
+	// dev favours latency and easy debugging over throughput: events are
+	// published almost immediately, uncompressed, by a single writer
+	ProfileDev: func(cfg *Config) {
+		p := &cfg.Kafka.Producer
+		p.BatchSize = 10
+		p.BatchTimeout = 10 * time.Millisecond
+		p.RequiredAcks = 1
+		p.Compression = "none"
+		p.WriteTimeout = 5 * time.Second
+		p.PoolSize = 1
+		p.MinPoolSize = 0
+		p.MaxPoolSize = 0
+
+		cfg.Flags.RefreshInterval = 2 * time.Second
+		cfg.Forward.BatchSize = 50
+		cfg.Forward.FlushInterval = 100 * time.Millisecond
+	},
+
+	// staging mirrors production durability at modest volume, and waits
+	// for Kafka so environments can be brought up in any order
+	ProfileStaging: func(cfg *Config) {
+		p := &cfg.Kafka.Producer
+		p.BatchSize = 200
+		p.BatchTimeout = 50 * time.Millisecond
+		p.RequiredAcks = -1
+		p.Compression = "snappy"
+		p.WriteTimeout = 10 * time.Second
+		p.PoolSize = 4
+		p.MinPoolSize = 2
+		p.MaxPoolSize = 8
+
+		cfg.Startup.WaitFor = "kafka"
+		cfg.Startup.MaxWait = 2 * time.Minute
+	},
+
+	// prod-high-throughput trades a little latency for larger, better
+	// compressed batches, an elastic writer pool and longer timeouts for
+	// large requests over long-lived connections
+	ProfileProdHighThroughput: func(cfg *Config) {
+		p := &cfg.Kafka.Producer
+		p.BatchSize = 1000
+		p.BatchTimeout = 50 * time.Millisecond
+		p.CompactBatches = true
+		p.CompactLinger = 20 * time.Millisecond
+		p.RequiredAcks = -1
+		p.Compression = "zstd"
+		p.MaxMessageBytes = 4 * 1024 * 1024 // 4MB
+		p.WriteTimeout = 30 * time.Second
+		p.PoolSize = 8
+		p.MinPoolSize = 4
+		p.MaxPoolSize = 32
+		p.PoolTargetLatency = 100 * time.Millisecond
+		p.PoolResizeInterval = 5 * time.Second
+
+		cfg.HTTP.MaxConcurrentStreams = 1000
+		cfg.HTTP.IdleTimeout = 5 * time.Minute
+		cfg.HTTP.ReadTimeout = 30 * time.Second
+		cfg.HTTP.WriteTimeout = 30 * time.Second
+
+		cfg.Forward.BatchSize = 2000
+		cfg.Forward.BatchBytes = 16 * 1024 * 1024
+		cfg.Region.MirrorQueueSize = 100000
+		cfg.Region.MirrorBatchSize = 2000
+
+		cfg.Startup.WaitFor = "kafka"
+		cfg.Startup.MaxWait = 5 * time.Minute
+	},
+}
+
+// ProfileNames returns the available profiles, sorted
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckProfile reports an error for names that are not a profile; the
+// empty name (no profile) is valid
+func CheckProfile(name string) error {
+	if _, ok := profiles[name]; !ok && name != "" {
+		return fmt.Errorf("unknown profile %q (want %s)", name, strings.Join(ProfileNames(), ", "))
+	}
+	return nil
+}
+
+// ApplyProfile sets the named profile's settings on cfg and records it in
+// cfg.Profile
+func (c *Config) ApplyProfile(name string) error {
+	if err := CheckProfile(name); err != nil {
+		return err
+	}
+	if apply := profiles[name]; apply != nil {
+		apply(c)
+	}
+	c.Profile = name
+	return nil
+}
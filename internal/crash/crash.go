@@ -0,0 +1,174 @@
+// Package crash writes a report to disk when a goroutine panics, so
+// post-mortems have the stack, configuration and recent logs even when the
+// journal has dropped or rotated them.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+)
+
+// Config controls crash reports
+type Config struct {
+	// Dir is where reports are written; empty disables them
+	Dir string
+
+	// LogLines is how many recent log lines a report includes
+	LogLines int
+
+	// ConfigHash identifies the configuration in use
+	ConfigHash string
+}
+
+var (
+	mu      sync.Mutex
+	cfg     Config
+	started = time.Now()
+
+	// stats are the sources of runtime statistics, by name
+	stats = make(map[string]func() any)
+)
+
+// Init sets the configuration used by Recover
+func Init(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+}
+
+// AddStats registers a source of statistics (queue depths and the like)
+// included in reports under name
+func AddStats(name string, fn func() any) {
+	mu.Lock()
+	defer mu.Unlock()
+	stats[name] = fn
+}
+
+// Report is the content of a crash report file
+type Report struct {
+	Time       time.Time      `json:"time"`
+	Goroutine  string         `json:"goroutine"`
+	Panic      string         `json:"panic"`
+	Stack      string         `json:"stack"`
+	ConfigHash string         `json:"config_hash,omitempty"`
+	Host       string         `json:"host"`
+	PID        int            `json:"pid"`
+	GoVersion  string         `json:"go_version"`
+	Uptime     string         `json:"uptime"`
+	Memory     Memory         `json:"memory"`
+	Stats      map[string]any `json:"stats,omitempty"`
+	Logs       []string       `json:"logs"`
+}
+
+// Memory is the process's memory use when it crashed
+type Memory struct {
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapSys    uint64 `json:"heap_sys_bytes"`
+	Sys        uint64 `json:"sys_bytes"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Recover, deferred at the top of a goroutine, writes a report for a panic
+// and then panics again, so the process still crashes as it would have.
+// goroutine names the goroutine in the report.
+func Recover(goroutine string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	log := logger.WithComponent("crash")
+	path, err := Write(goroutine, value, debug.Stack())
+	switch {
+	case err != nil:
+		log.Error().Err(err).Msg("failed to write crash report")
+	case path != "":
+		log.Error().Str("path", path).Str("goroutine", goroutine).Msg("crash report written")
+	}
+	panic(value)
+}
+
+// Write writes a report for a panic and returns its path, or "" when
+// reports are disabled
+func Write(goroutine string, value any, stack []byte) (string, error) {
+	mu.Lock()
+	c := cfg
+	sources := make(map[string]func() any, len(stats))
+	for name, fn := range stats {
+		sources[name] = fn
+	}
+	mu.Unlock()
+
+	if c.Dir == "" {
+		return "", nil
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	report := Report{
+		Time:       now,
+		Goroutine:  goroutine,
+		Panic:      fmt.Sprint(value),
+		Stack:      string(stack),
+		ConfigHash: c.ConfigHash,
+		Host:       host,
+		PID:        os.Getpid(),
+		GoVersion:  runtime.Version(),
+		Uptime:     time.Since(started).Round(time.Second).String(),
+		Memory:     memory(),
+		Stats:      collect(sources),
+		Logs:       logger.Recent(c.LogLines),
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode crash report: %w", err)
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	path := filepath.Join(c.Dir, fmt.Sprintf("crash-%s-%d.json", now.Format("20060102T150405.000Z"), report.PID))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	return path, nil
+}
+
+// memory reads the current memory statistics
+func memory() Memory {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return Memory{
+		HeapAlloc:  m.HeapAlloc,
+		HeapSys:    m.HeapSys,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// collect calls each statistics source. A source that panics in turn is
+// reported as such rather than losing the report.
+func collect(sources map[string]func() any) map[string]any {
+	values := make(map[string]any, len(sources))
+	for name, fn := range sources {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					values[name] = fmt.Sprintf("unavailable: %v", r)
+				}
+			}()
+			values[name] = fn()
+		}()
+	}
+	return values
+}
@@ -0,0 +1,324 @@
+// Package discovery tells clients which ingest endpoints to use. Each node
+// announces its URL, region, load and protocols in the StateStore every
+// few seconds; /discover ranks the announced nodes for a client, nearest
+// region and least loaded first, and lists the entry points of other
+// regions, which usually have a store of their own.
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/state"
+)
+
+// IndexKey is the StateStore key listing the IDs of announced nodes
+const IndexKey = "parsec:discovery:nodes"
+
+// nodePrefix keys each node's announcement, which expires unless renewed
+const nodePrefix = "parsec:discovery:node:"
+
+// Node is an announced ingest node
+type Node struct {
+	ID     string `json:"node_id"`
+	Region string `json:"region,omitempty"`
+	URL    string `json:"url"`
+
+	// Load is how full the node's ingest queue is, from 0 to 1
+	Load float64 `json:"load"`
+
+	// Protocols are the transports and ingest modes the node accepts, e.g.
+	// "h2" or "async"
+	Protocols []string  `json:"protocols"`
+	Updated   time.Time `json:"updated"`
+}
+
+// RegionEndpoint is a region's entry point, typically a GeoDNS or load
+// balancer name
+type RegionEndpoint struct {
+	Region string `json:"region"`
+	URL    string `json:"url"`
+}
+
+// Discovery is the answer to a client asking where to send events
+type Discovery struct {
+	NodeID string `json:"node_id"`
+	Region string `json:"region,omitempty"`
+
+	// Endpoints are nodes of this deployment, preferred first
+	Endpoints []Node `json:"endpoints"`
+
+	// Regions are entry points of every known region, preferred first
+	Regions []RegionEndpoint `json:"regions,omitempty"`
+
+	// TTLSeconds is how long clients may keep using the answer
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// ParseRegions parses region entry points from "region=url,..."
+func ParseRegions(s string) (map[string]string, error) {
+	regions := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		region, url, ok := strings.Cut(entry, "=")
+		region, url = strings.TrimSpace(region), strings.TrimSpace(url)
+		if !ok || region == "" || url == "" {
+			return nil, errors.New("discovery region must be region=url: " + entry)
+		}
+		regions[region] = strings.TrimSuffix(url, "/")
+	}
+	return regions, nil
+}
+
+// Config holds what a node announces about itself
+type Config struct {
+	// Self is this node; it is only announced if it has a URL
+	Self Node
+
+	// Load reports the node's current load from 0 to 1; nil reports 0
+	Load func() float64
+
+	// Interval is how often the node announces itself and reloads the
+	// others; announcements expire after three intervals
+	Interval time.Duration
+
+	// Regions maps regions to their entry points
+	Regions map[string]string
+}
+
+// Registry announces this node and keeps the latest view of the others
+type Registry struct {
+	store state.StateStore
+	cfg   Config
+
+	mu    sync.RWMutex
+	nodes []Node
+}
+
+// NewRegistry creates a registry sharing announcements through store
+func NewRegistry(store state.StateStore, cfg Config) *Registry {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Self.URL != "" {
+		cfg.Self.URL = strings.TrimSuffix(cfg.Self.URL, "/")
+	}
+	return &Registry{store: store, cfg: cfg}
+}
+
+// ttl is how long an announcement lasts without being renewed
+func (r *Registry) ttl() time.Duration {
+	return 3 * r.cfg.Interval
+}
+
+// Announce publishes this node's current load and adds it to the index
+func (r *Registry) Announce(ctx context.Context) error {
+	if r.cfg.Self.URL == "" {
+		return nil
+	}
+
+	node := r.cfg.Self
+	if r.cfg.Load != nil {
+		node.Load = min(max(r.cfg.Load(), 0), 1)
+	}
+	node.Updated = time.Now().UTC()
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	key := nodePrefix + node.ID
+	if err := r.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	if _, err := r.store.Expire(ctx, key, r.ttl()); err != nil {
+		return err
+	}
+
+	// Checked on every announcement, so a lost concurrent write heals
+	ids, err := r.index(ctx)
+	if err != nil || slices.Contains(ids, node.ID) {
+		return err
+	}
+	return r.setIndex(ctx, append(ids, node.ID))
+}
+
+// Withdraw removes this node, so clients stop being sent to it
+func (r *Registry) Withdraw(ctx context.Context) error {
+	if r.cfg.Self.URL == "" {
+		return nil
+	}
+	if _, err := r.store.Expire(ctx, nodePrefix+r.cfg.Self.ID, 0); err != nil {
+		return err
+	}
+	ids, err := r.index(ctx)
+	if err != nil {
+		return err
+	}
+	return r.setIndex(ctx, slices.DeleteFunc(ids, func(id string) bool { return id == r.cfg.Self.ID }))
+}
+
+// Refresh reloads the announced nodes, dropping expired ones from the index
+func (r *Registry) Refresh(ctx context.Context) error {
+	ids, err := r.index(ctx)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]Node, 0, len(ids))
+	live := make([]string, 0, len(ids))
+	for _, id := range ids {
+		data, err := r.store.Get(ctx, nodePrefix+id)
+		if err != nil {
+			return err
+		}
+		var node Node
+		if len(data) == 0 || json.Unmarshal(data, &node) != nil {
+			continue
+		}
+		// Stores without expiry keep announcements of dead nodes
+		if time.Since(node.Updated) > r.ttl() {
+			continue
+		}
+		nodes = append(nodes, node)
+		live = append(live, id)
+	}
+
+	r.mu.Lock()
+	r.nodes = nodes
+	r.mu.Unlock()
+
+	if len(live) < len(ids) {
+		return r.setIndex(ctx, live)
+	}
+	return nil
+}
+
+// index reads the announced node IDs
+func (r *Registry) index(ctx context.Context) ([]string, error) {
+	data, err := r.store.Get(ctx, IndexKey)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// setIndex writes the announced node IDs
+func (r *Registry) setIndex(ctx context.Context, ids []string) error {
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return r.store.Set(ctx, IndexKey, data)
+}
+
+// Run announces this node and reloads the others every interval until ctx
+// is cancelled, then withdraws the node
+func (r *Registry) Run(ctx context.Context) {
+	log := logger.WithComponent("discovery")
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Announce(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("failed to announce node")
+		}
+		if err := r.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("failed to reload announced nodes")
+		}
+
+		select {
+		case <-ctx.Done():
+			withdrawCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+			if err := r.Withdraw(withdrawCtx); err != nil {
+				log.Warn().Err(err).Msg("failed to withdraw node")
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Discover ranks endpoints for a client in region ("" = this node's
+// region): nodes of that region first, then by load. limit caps the
+// endpoints (0 = all).
+func (r *Registry) Discover(region string, limit int) Discovery {
+	if region == "" {
+		region = r.cfg.Self.Region
+	}
+
+	r.mu.RLock()
+	nodes := slices.Clone(r.nodes)
+	r.mu.RUnlock()
+
+	slices.SortFunc(nodes, func(a, b Node) int {
+		if (a.Region == region) != (b.Region == region) {
+			if a.Region == region {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(a.Load, b.Load); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if limit > 0 && len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+
+	regions := make([]RegionEndpoint, 0, len(r.cfg.Regions))
+	for name, url := range r.cfg.Regions {
+		regions = append(regions, RegionEndpoint{Region: name, URL: url})
+	}
+	rank := func(name string) int {
+		switch name {
+		case region:
+			return 0
+		case r.cfg.Self.Region:
+			return 1
+		}
+		return 2
+	}
+	slices.SortFunc(regions, func(a, b RegionEndpoint) int {
+		if c := cmp.Compare(rank(a.Region), rank(b.Region)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Region, b.Region)
+	})
+
+	return Discovery{
+		NodeID:     r.cfg.Self.ID,
+		Region:     r.cfg.Self.Region,
+		Endpoints:  nodes,
+		Regions:    regions,
+		TTLSeconds: int(r.ttl().Seconds()),
+	}
+}
+
+// Local returns this node reached at url with its current load, for
+// answering clients when no node is announced
+func (r *Registry) Local(url string) Node {
+	node := r.cfg.Self
+	node.URL = url
+	if r.cfg.Load != nil {
+		node.Load = min(max(r.cfg.Load(), 0), 1)
+	}
+	node.Updated = time.Now().UTC()
+	return node
+}
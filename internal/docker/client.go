@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// client is a minimal Docker Engine API client
+type client struct {
+	http *http.Client
+	base string
+}
+
+// newClient creates a client for a unix:// or tcp:// Docker host
+func newClient(host string) (*client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parse docker host: %w", err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &client{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &client{http: &http.Client{}, base: "http://" + u.Host}, nil
+	case "https":
+		return &client{http: &http.Client{}, base: "https://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q", host)
+	}
+}
+
+// summary is an entry of GET /containers/json
+type summary struct {
+	ID    string `json:"Id"`
+	State string `json:"State"`
+}
+
+// details is the part of GET /containers/{id}/json the input uses. Labels
+// include those inherited from the image.
+type details struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Tty    bool              `json:"Tty"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// running lists the running containers
+func (c *client) running(ctx context.Context) ([]summary, error) {
+	var containers []summary
+	if err := c.get(ctx, "/containers/json", &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// inspect returns a container's details
+func (c *client) inspect(ctx context.Context, id string) (*details, error) {
+	var d details
+	if err := c.get(ctx, "/containers/"+id+"/json", &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// logs follows a container's stdout and stderr with timestamps, starting
+// at since (zero = from the start). The stream ends when the container
+// stops or ctx is cancelled.
+func (c *client) logs(ctx context.Context, id string, since time.Time) (io.ReadCloser, error) {
+	query := url.Values{
+		"follow":     {"1"},
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"timestamps": {"1"},
+	}
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+
+	resp, err := c.do(ctx, "/containers/"+id+"/logs?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// get decodes a JSON response
+func (c *client) get(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends a GET request, turning error statuses into errors
+func (c *client) do(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker api %s: %s: %s", path, resp.Status, body)
+	}
+	return resp, nil
+}
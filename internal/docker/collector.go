@@ -0,0 +1,458 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// Labels a container can set to route its logs
+const (
+	TenantLabel = "parsec.tenant"
+	SourceLabel = "parsec.source"
+)
+
+// Metadata keys stamped on container events; labels are copied as
+// LabelPrefix + key
+const (
+	MetadataContainerID   = "container_id"
+	MetadataContainerName = "container_name"
+	MetadataImage         = "image"
+	MetadataStream        = "stream"
+	LabelPrefix           = "label."
+)
+
+// checkpointTTL keeps a stopped container's checkpoint in case it is
+// started again
+const checkpointTTL = 24 * time.Hour
+
+// Queue-full backoff bounds
+const (
+	minSubmitBackoff = 10 * time.Millisecond
+	maxSubmitBackoff = time.Second
+)
+
+// containerNamespace derives stable event IDs, so a line re-read after a
+// restart keeps its ID
+var containerNamespace = uuid.MustParse("0d8e5b6a-41c7-4f3e-b2a9-7c1d9e4f6a25")
+
+// Sink receives container events; the ingest handler implements it
+type Sink interface {
+	Submit(ctx context.Context, event *models.LogEvent) error
+}
+
+// Collector discovers running containers and follows their logs. The
+// timestamp of each container's last submitted line is checkpointed in the
+// state store, so restarts resume after it.
+type Collector struct {
+	cfg    config.DockerConfig
+	sink   Sink
+	store  state.StateStore
+	client *client
+	stdout models.Severity
+	stderr models.Severity
+	labels map[string]bool
+
+	mu      sync.Mutex
+	streams map[string]*container
+	resume  map[string]time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// container is a container whose logs are being followed
+type container struct {
+	id       string
+	metadata map[string]string
+	tenant   string
+	source   string
+	tty      bool
+
+	mu    sync.Mutex
+	last  time.Time
+	saved time.Time
+}
+
+// New creates a collector
+func New(cfg config.DockerConfig, sink Sink, store state.StateStore) (*Collector, error) {
+	if cfg.Tenant == "" {
+		return nil, errors.New("docker tenant is required")
+	}
+	stdout := models.Severity(strings.ToUpper(cfg.StdoutSeverity))
+	stderr := models.Severity(strings.ToUpper(cfg.StderrSeverity))
+	if !stdout.IsValid() || !stderr.IsValid() {
+		return nil, fmt.Errorf("invalid docker stream severity %q/%q", cfg.StdoutSeverity, cfg.StderrSeverity)
+	}
+	if cfg.DiscoveryInterval <= 0 {
+		cfg.DiscoveryInterval = 5 * time.Second
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = 5 * time.Second
+	}
+
+	client, err := newClient(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels map[string]bool
+	for _, label := range cfg.Labels {
+		if label = strings.TrimSpace(label); label != "" {
+			if labels == nil {
+				labels = make(map[string]bool)
+			}
+			labels[label] = true
+		}
+	}
+
+	return &Collector{
+		cfg:     cfg,
+		sink:    sink,
+		store:   store,
+		client:  client,
+		stdout:  stdout,
+		stderr:  stderr,
+		labels:  labels,
+		streams: make(map[string]*container),
+		resume:  make(map[string]time.Time),
+	}, nil
+}
+
+// Start discovers containers in the background until Close. Containers
+// running now are found before Start returns.
+func (c *Collector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	c.discover(ctx, true)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(ctx)
+	}()
+}
+
+// Close stops following containers and checkpoints them
+func (c *Collector) Close() error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
+
+// run rediscovers containers and writes checkpoints until ctx is cancelled
+func (c *Collector) run(ctx context.Context) {
+	discover := time.NewTicker(c.cfg.DiscoveryInterval)
+	defer discover.Stop()
+	save := time.NewTicker(c.cfg.CheckpointInterval)
+	defer save.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-discover.C:
+			c.discover(ctx, false)
+		case <-save.C:
+			c.mu.Lock()
+			streams := make([]*container, 0, len(c.streams))
+			for _, s := range c.streams {
+				streams = append(streams, s)
+			}
+			c.mu.Unlock()
+			for _, s := range streams {
+				c.save(ctx, s)
+			}
+		}
+	}
+}
+
+// discover follows containers that are running and not yet followed
+func (c *Collector) discover(ctx context.Context, initial bool) {
+	log := logger.WithComponent("docker")
+
+	running, err := c.client.running(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Warn().Err(err).Msg("failed to list containers")
+		}
+		return
+	}
+
+	alive := make(map[string]bool, len(running))
+	for _, summary := range running {
+		alive[summary.ID] = true
+
+		c.mu.Lock()
+		_, followed := c.streams[summary.ID]
+		c.mu.Unlock()
+		if followed {
+			continue
+		}
+
+		details, err := c.client.inspect(ctx, summary.ID)
+		if err != nil {
+			log.Warn().Err(err).Str("container_id", shortID(summary.ID)).Msg("failed to inspect container")
+			continue
+		}
+		c.follow(ctx, c.container(details), c.since(ctx, summary.ID, initial))
+	}
+
+	// Forget resume points of containers that are gone
+	c.mu.Lock()
+	for id := range c.resume {
+		if !alive[id] {
+			delete(c.resume, id)
+		}
+	}
+	metrics.DockerContainersFollowed.Set(float64(len(c.streams)))
+	c.mu.Unlock()
+}
+
+// since returns where a container's logs resume: after its last line, at
+// now for containers found at startup without a checkpoint (unless
+// ReadFromHead), or from the start
+func (c *Collector) since(ctx context.Context, id string, initial bool) time.Time {
+	c.mu.Lock()
+	last, ok := c.resume[id]
+	c.mu.Unlock()
+	if ok {
+		return last
+	}
+
+	data, err := c.store.Get(ctx, checkpointKey(id))
+	if err == nil && data != nil {
+		if ts, err := time.Parse(time.RFC3339Nano, string(data)); err == nil {
+			return ts
+		}
+	}
+
+	if initial && !c.cfg.ReadFromHead {
+		return time.Now().UTC()
+	}
+	return time.Time{}
+}
+
+// container builds the follow state from a container's details
+func (c *Collector) container(d *details) *container {
+	name := strings.TrimPrefix(d.Name, "/")
+	labels := d.Config.Labels
+
+	s := &container{
+		id:     d.ID,
+		tenant: c.cfg.Tenant,
+		source: name,
+		tty:    d.Config.Tty,
+		metadata: map[string]string{
+			MetadataContainerID:   shortID(d.ID),
+			MetadataContainerName: name,
+			MetadataImage:         d.Config.Image,
+		},
+	}
+	if tenant := labels[TenantLabel]; tenant != "" {
+		s.tenant = tenant
+	}
+	if source := labels[SourceLabel]; source != "" {
+		s.source = source
+	}
+
+	// Copy labels in key order up to the metadata limit, leaving room
+	// for the stream key
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		if c.labels == nil || c.labels[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(s.metadata)+1 >= models.MaxMetadataKeys {
+			break
+		}
+		s.metadata[LabelPrefix+key] = labels[key]
+	}
+	return s
+}
+
+// follow streams a container's logs until it stops or ctx is cancelled
+func (c *Collector) follow(ctx context.Context, s *container, since time.Time) {
+	s.last = since
+	c.mu.Lock()
+	c.streams[s.id] = s
+	c.mu.Unlock()
+
+	log := logger.WithComponent("docker")
+	log.Info().
+		Str("container_id", shortID(s.id)).
+		Str("container_name", s.metadata[MetadataContainerName]).
+		Time("since", since).
+		Msg("following container logs")
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		if err := c.stream(ctx, s, since); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("container_id", shortID(s.id)).Msg("container log stream failed")
+		}
+
+		// Stopped or failed: keep the resume point for the next discovery
+		c.mu.Lock()
+		delete(c.streams, s.id)
+		c.resume[s.id] = s.lastTimestamp()
+		c.mu.Unlock()
+
+		saveCtx := context.WithoutCancel(ctx)
+		c.save(saveCtx, s)
+		if ctx.Err() == nil {
+			if _, err := c.store.Expire(saveCtx, checkpointKey(s.id), checkpointTTL); err != nil {
+				log.Warn().Err(err).Str("container_id", shortID(s.id)).Msg("failed to expire container checkpoint")
+			}
+		}
+	}()
+}
+
+// stream reads a container's log stream, submitting each line
+func (c *Collector) stream(ctx context.Context, s *container, since time.Time) error {
+	body, err := c.client.logs(ctx, s.id, since)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	lines := newDemux(body, s.tty)
+	for {
+		l, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// since is inclusive; skip what was already submitted
+		if !since.IsZero() && !l.timestamp.After(since) {
+			continue
+		}
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		if !c.submit(ctx, s, l) {
+			return nil
+		}
+
+		s.mu.Lock()
+		s.last = l.timestamp
+		s.mu.Unlock()
+	}
+}
+
+// submit sends a line to the sink, waiting out a full queue. It returns
+// false if ctx ended first.
+func (c *Collector) submit(ctx context.Context, s *container, l line) bool {
+	backoff := minSubmitBackoff
+	for {
+		err := c.sink.Submit(ctx, c.event(s, l))
+		if errors.Is(err, handlers.ErrQueueFull) {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxSubmitBackoff)
+			continue
+		}
+
+		if err != nil {
+			metrics.DockerLines.WithLabelValues(l.stream, "rejected").Inc()
+			log := logger.WithComponent("docker")
+			log.Warn().Err(err).Str("container_id", shortID(s.id)).Msg("container log line rejected")
+		} else {
+			metrics.DockerLines.WithLabelValues(l.stream, "ingested").Inc()
+		}
+		return true
+	}
+}
+
+// event builds the event for a line; stderr and stdout map to their
+// configured severities
+func (c *Collector) event(s *container, l line) *models.LogEvent {
+	severity := c.stdout
+	if l.stream == Stderr {
+		severity = c.stderr
+	}
+
+	metadata := make(models.Metadata, len(s.metadata)+1)
+	for k, v := range s.metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataStream] = l.stream
+
+	key := s.id + "\x00" + l.stream + "\x00" + l.timestamp.Format(time.RFC3339Nano) + "\x00" + l.text
+	return &models.LogEvent{
+		ID:        uuid.NewSHA1(containerNamespace, []byte(key)).String(),
+		TenantID:  s.tenant,
+		Timestamp: l.timestamp,
+		Severity:  severity,
+		Source:    s.source,
+		Message:   l.text,
+		Metadata:  metadata,
+	}
+}
+
+// save writes a container's checkpoint if it moved
+func (c *Collector) save(ctx context.Context, s *container) {
+	s.mu.Lock()
+	last, saved := s.last, s.saved
+	s.mu.Unlock()
+	if last.IsZero() || last.Equal(saved) {
+		return
+	}
+
+	if err := c.store.Set(ctx, checkpointKey(s.id), []byte(last.Format(time.RFC3339Nano))); err != nil {
+		log := logger.WithComponent("docker")
+		log.Error().Err(err).Str("container_id", shortID(s.id)).Msg("failed to write container checkpoint")
+		return
+	}
+
+	s.mu.Lock()
+	s.saved = last
+	s.mu.Unlock()
+}
+
+// lastTimestamp returns the timestamp of the last submitted line
+func (s *container) lastTimestamp() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// checkpointKey is the state store key of a container's checkpoint
+func checkpointKey(id string) string {
+	return "parsec:docker:" + id
+}
+
+// shortID is the 12-character container ID docker prints
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
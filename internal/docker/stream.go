@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Stream names, also stored in metadata
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// maxLineBytes bounds a line held while waiting for its newline
+const maxLineBytes = 1024 * 1024
+
+// line is a timestamped log line
+type line struct {
+	stream    string
+	timestamp time.Time
+	text      string
+}
+
+// demux splits a container's log stream into lines. Without a TTY, Docker
+// multiplexes stdout and stderr in frames with an 8-byte header (stream,
+// three zero bytes, big-endian payload size); with one, the stream is raw
+// stdout.
+type demux struct {
+	r       *bufio.Reader
+	tty     bool
+	header  [8]byte
+	partial map[string][]byte
+	ready   []line
+}
+
+func newDemux(r io.Reader, tty bool) *demux {
+	return &demux{
+		r:       bufio.NewReaderSize(r, 32*1024),
+		tty:     tty,
+		partial: make(map[string][]byte, 2),
+	}
+}
+
+// next returns the next line, or io.EOF when the stream ends
+func (d *demux) next() (line, error) {
+	for len(d.ready) == 0 {
+		stream, payload, err := d.frame()
+		if err != nil {
+			return line{}, err
+		}
+		d.split(stream, payload)
+	}
+
+	l := d.ready[0]
+	d.ready = d.ready[1:]
+	return l, nil
+}
+
+// frame reads the next frame's payload
+func (d *demux) frame() (string, []byte, error) {
+	if d.tty {
+		payload, err := d.r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			err = nil
+		}
+		if len(payload) > 0 {
+			return Stdout, bytes.Clone(payload), nil
+		}
+		return "", nil, err
+	}
+
+	if _, err := io.ReadFull(d.r, d.header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return "", nil, err
+	}
+	stream := Stdout
+	if d.header[0] == 2 {
+		stream = Stderr
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(d.header[4:]))
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		return "", nil, io.EOF
+	}
+	return stream, payload, nil
+}
+
+// split appends a payload to its stream's partial line and queues the
+// complete lines; Docker splits lines over 16KB across frames
+func (d *demux) split(stream string, payload []byte) {
+	buf := append(d.partial[stream], payload...)
+	for {
+		n := bytes.IndexByte(buf, '\n')
+		if n < 0 {
+			if len(buf) >= maxLineBytes {
+				n = len(buf)
+			} else {
+				break
+			}
+		}
+		d.ready = append(d.ready, parseLine(stream, buf[:n]))
+		if n == len(buf) {
+			buf = buf[:0]
+			break
+		}
+		buf = buf[n+1:]
+	}
+	d.partial[stream] = bytes.Clone(buf)
+}
+
+// parseLine splits off the RFC 3339 timestamp Docker prefixes each line with
+func parseLine(stream string, raw []byte) line {
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	l := line{stream: stream, text: string(raw)}
+
+	if i := bytes.IndexByte(raw, ' '); i > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, string(raw[:i])); err == nil {
+			l.timestamp = ts.UTC()
+			l.text = string(raw[i+1:])
+		}
+	}
+	if l.timestamp.IsZero() {
+		l.timestamp = time.Now().UTC()
+	}
+	return l
+}
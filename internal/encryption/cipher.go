@@ -0,0 +1,94 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrCiphertextTooShort is returned for values shorter than a nonce
+var ErrCiphertextTooShort = errors.New("ciphertext too short")
+
+// Cipher seals envelope payloads with AES-GCM under per-tenant keys. The
+// tenant ID is authenticated as additional data, so a payload cannot be
+// replayed under another tenant.
+type Cipher struct {
+	keyring Keyring
+
+	mu    sync.RWMutex
+	aeads map[string]cipher.AEAD
+}
+
+// NewCipher creates a cipher over the keyring
+func NewCipher(keyring Keyring) *Cipher {
+	return &Cipher{keyring: keyring, aeads: make(map[string]cipher.AEAD)}
+}
+
+// Seal encrypts plaintext for the tenant, returning the ciphertext (nonce
+// first) and the key ID. Tenants without a key get an empty key ID and their
+// plaintext back.
+func (c *Cipher) Seal(ctx context.Context, tenantID string, plaintext []byte) ([]byte, string, error) {
+	id, ok := c.keyring.TenantKey(tenantID)
+	if !ok {
+		return plaintext, "", nil
+	}
+
+	aead, err := c.aead(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(tenantID)), id, nil
+}
+
+// Open decrypts a payload sealed for the tenant under the key ID
+func (c *Cipher) Open(ctx context.Context, keyID, tenantID string, ciphertext []byte) ([]byte, error) {
+	aead, err := c.aead(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrCiphertextTooShort
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(tenantID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt with key %s: %w", keyID, err)
+	}
+	return plaintext, nil
+}
+
+// aead returns the cached AES-GCM instance for a key ID
+func (c *Cipher) aead(ctx context.Context, id string) (cipher.AEAD, error) {
+	c.mu.RLock()
+	aead, ok := c.aeads[id]
+	c.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	key, err := c.keyring.Key(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.aeads[id] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
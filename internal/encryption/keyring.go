@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownKey is returned when a key ID is not in the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring resolves tenants to key IDs and key IDs to AES keys. Envelopes
+// record the key ID they were sealed with, so retired keys must stay
+// resolvable until their envelopes age out. A KMS-backed keyring implements
+// Key by unwrapping data keys.
+type Keyring interface {
+	// TenantKey returns the ID of the key new envelopes for the tenant are
+	// sealed with, or false if the tenant is not encrypted
+	TenantKey(tenantID string) (string, bool)
+
+	// Key returns a 16, 24 or 32 byte AES key
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeyring holds keys supplied through configuration
+type StaticKeyring struct {
+	keys    map[string][]byte
+	tenants map[string]string
+}
+
+// ParseKeyring parses keys as comma-separated id=base64 pairs and tenants as
+// comma-separated tenant=id pairs, e.g. ENCRYPTION_KEYS="k1=..." and
+// ENCRYPTION_TENANTS="acme=k1"
+func ParseKeyring(keys, tenants string) (*StaticKeyring, error) {
+	k := &StaticKeyring{keys: map[string][]byte{}, tenants: map[string]string{}}
+
+	for _, pair := range splitPairs(keys) {
+		id, encoded, ok := strings.Cut(pair, "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key %q: expected id=base64", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("key %s: AES keys are 16, 24 or 32 bytes, got %d", id, n)
+		}
+		k.keys[id] = key
+	}
+
+	for _, pair := range splitPairs(tenants) {
+		tenantID, id, ok := strings.Cut(pair, "=")
+		if !ok || tenantID == "" {
+			return nil, fmt.Errorf("invalid tenant key %q: expected tenant=id", pair)
+		}
+		if _, ok := k.keys[id]; !ok {
+			return nil, fmt.Errorf("tenant %s: %w %q", tenantID, ErrUnknownKey, id)
+		}
+		k.tenants[tenantID] = id
+	}
+	return k, nil
+}
+
+// splitPairs splits a comma-separated list, dropping blanks
+func splitPairs(s string) []string {
+	var pairs []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// TenantKey returns the tenant's active key ID
+func (k *StaticKeyring) TenantKey(tenantID string) (string, bool) {
+	id, ok := k.tenants[tenantID]
+	return id, ok
+}
+
+// Key returns key material by ID
+func (k *StaticKeyring) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
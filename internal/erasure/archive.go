@@ -0,0 +1,209 @@
+package erasure
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+
+	"parsec/internal/export"
+	"parsec/internal/objstore"
+	"parsec/pkg/models"
+)
+
+// Archive erases events from objects stored under <prefix><tenant>/, the
+// layout tenant exports use. Objects are rewritten without the events in
+// scope and deleted once empty; NDJSON (optionally gzipped) and Parquet in
+// the export layout are supported.
+type Archive struct {
+	name   string
+	bucket objstore.Bucket
+	prefix string
+}
+
+// NewArchive creates an archive target
+func NewArchive(name string, bucket objstore.Bucket, prefix string) *Archive {
+	return &Archive{name: name, bucket: bucket, prefix: prefix}
+}
+
+// Name identifies the archive
+func (a *Archive) Name() string {
+	return a.name
+}
+
+// Erase rewrites each of the tenant's objects
+func (a *Archive) Erase(ctx context.Context, scope Scope, progress func(Progress)) error {
+	objects, err := a.bucket.List(ctx, a.prefix+scope.TenantID+"/")
+	if err != nil {
+		return fmt.Errorf("list objects: %w", err)
+	}
+
+	var p Progress
+	for _, obj := range objects {
+		deleted, err := a.eraseObject(ctx, obj.Key, scope)
+		if err != nil {
+			return fmt.Errorf("%s: %w", obj.Key, err)
+		}
+		p.Scanned++
+		p.Deleted += deleted
+		progress(p)
+	}
+	return nil
+}
+
+// eraseObject filters one object into a temporary file and replaces the
+// original, returning the number of events removed
+func (a *Archive) eraseObject(ctx context.Context, key string, scope Scope) (int64, error) {
+	src, err := os.CreateTemp("", "parsec-erasure-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		src.Close()
+		os.Remove(src.Name())
+	}()
+
+	body, err := a.bucket.Open(ctx, key)
+	if errors.Is(err, objstore.ErrNotFound) {
+		// Removed since it was listed, e.g. by an earlier attempt
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(src, body)
+	body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := os.CreateTemp("", "parsec-erasure-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		dst.Close()
+		os.Remove(dst.Name())
+	}()
+
+	var kept, deleted int64
+	if strings.HasSuffix(key, ".parquet") {
+		kept, deleted, err = filterParquet(src, size, dst, scope)
+	} else {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		kept, deleted, err = filterNDJSON(src, dst, scope)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case deleted == 0:
+		return 0, nil
+	case kept == 0:
+		return deleted, a.bucket.Delete(ctx, key)
+	}
+
+	written, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return deleted, a.bucket.Put(ctx, key, dst, written)
+}
+
+// archivedEvent holds the fields scope matching needs
+type archivedEvent struct {
+	TenantID string          `json:"tenant_id"`
+	Metadata models.Metadata `json:"metadata"`
+}
+
+// filterNDJSON copies lines not in scope, keeping gzip if the input had it.
+// Lines that are not events are kept as they are.
+func filterNDJSON(r io.Reader, w io.Writer, scope Scope) (kept, deleted int64, err error) {
+	br := bufio.NewReader(r)
+	out := w
+	var gz *gzip.Writer
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		in, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, 0, fmt.Errorf("open gzip: %w", err)
+		}
+		br = bufio.NewReader(in)
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e archivedEvent
+			if json.Unmarshal(line, &e) == nil && scope.Matches(e.TenantID, e.Metadata) {
+				deleted++
+			} else {
+				kept++
+				if _, err := out.Write(line); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return 0, 0, readErr
+		}
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return kept, deleted, nil
+}
+
+// filterParquet copies rows not in scope from an export-layout Parquet file
+func filterParquet(r io.ReaderAt, size int64, w io.Writer, scope Scope) (kept, deleted int64, err error) {
+	f, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open parquet: %w", err)
+	}
+	reader := parquet.NewGenericReader[export.Row](f)
+	defer reader.Close()
+	writer := parquet.NewGenericWriter[export.Row](w, parquet.Compression(&parquet.Zstd))
+
+	rows := make([]export.Row, 256)
+	for {
+		n, readErr := reader.Read(rows)
+		for _, row := range rows[:n] {
+			if scope.Matches(row.TenantID, models.StringMetadata(row.Metadata)) {
+				deleted++
+				continue
+			}
+			kept++
+			if _, err := writer.Write([]export.Row{row}); err != nil {
+				return 0, 0, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return 0, 0, readErr
+		}
+	}
+	return kept, deleted, writer.Close()
+}
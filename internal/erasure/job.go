@@ -0,0 +1,117 @@
+package erasure
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Erasure errors
+var (
+	ErrInvalidSubject   = errors.New("subject requires a metadata key and value")
+	ErrMissingRequester = errors.New("requested_by is required")
+	ErrJobNotFound      = errors.New("erasure job not found")
+	ErrNoTargets        = errors.New("no erasure targets configured")
+)
+
+// Subject identifies one data subject's events by a metadata field, e.g.
+// {"key": "user_id", "value": "42"}. Nested fields use dotted keys
+// ("user.id"), matching their flattened storage columns.
+type Subject struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Request asks for a tenant's events to be deleted. Without a subject every
+// event of the tenant is deleted.
+type Request struct {
+	Subject *Subject `json:"subject,omitempty"`
+
+	// RequestedBy and Reference are recorded for audit, e.g. the requester
+	// and the legal ticket
+	RequestedBy string `json:"requested_by"`
+	Reference   string `json:"reference,omitempty"`
+}
+
+// Validate checks the request
+func (r *Request) Validate() error {
+	if strings.TrimSpace(r.RequestedBy) == "" {
+		return ErrMissingRequester
+	}
+	if r.Subject != nil && (r.Subject.Key == "" || r.Subject.Value == "") {
+		return ErrInvalidSubject
+	}
+	return nil
+}
+
+// Scope selects the events a job deletes
+type Scope struct {
+	TenantID string
+	Subject  *Subject
+}
+
+// Matches reports whether an event with the tenant and metadata is in scope
+func (s Scope) Matches(tenantID string, metadata models.Metadata) bool {
+	if tenantID != s.TenantID {
+		return false
+	}
+	if s.Subject == nil {
+		return true
+	}
+	value, ok := metadata.Lookup(s.Subject.Key)
+	return ok && models.Stringify(value) == s.Subject.Value
+}
+
+// Progress is a target's running totals
+type Progress struct {
+	// Scanned counts objects or tables examined
+	Scanned int64 `json:"scanned"`
+
+	// Deleted counts events removed
+	Deleted int64 `json:"deleted"`
+}
+
+// TargetStatus is one backend's part of a job
+type TargetStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Progress
+	Error string `json:"error,omitempty"`
+}
+
+// Job is an asynchronous tenant erasure and its audit record
+type Job struct {
+	ID          string   `json:"id"`
+	TenantID    string   `json:"tenant_id"`
+	Subject     *Subject `json:"subject,omitempty"`
+	RequestedBy string   `json:"requested_by"`
+	Reference   string   `json:"reference,omitempty"`
+	Status      string   `json:"status"`
+
+	// Targets reports progress per storage backend or archive
+	Targets []TargetStatus `json:"targets"`
+
+	// Deleted is the total across targets
+	Deleted int64 `json:"deleted"`
+
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// scope returns the events the job deletes
+func (j *Job) scope() Scope {
+	return Scope{TenantID: j.TenantID, Subject: j.Subject}
+}
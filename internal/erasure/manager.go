@@ -0,0 +1,256 @@
+package erasure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/jobs"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// Target is a storage backend or archive events can be deleted from
+type Target interface {
+	// Name identifies the target in job progress and metrics
+	Name() string
+
+	// Erase deletes the events in scope, reporting running totals as it goes.
+	// Erasing again after a partial failure must be safe.
+	Erase(ctx context.Context, scope Scope, progress func(Progress)) error
+}
+
+// Config holds erasure settings
+type Config struct {
+	// Concurrency bounds jobs running at once (0 = 1)
+	Concurrency int
+
+	// JobTTL is how long job records are kept for audit (0 = 365 days)
+	JobTTL time.Duration
+
+	// OnFinished is called with a job's tenant when the job ends, e.g. to
+	// drop cached query results. Failed and cancelled jobs may have erased
+	// part of the data, so it is called whatever the outcome.
+	OnFinished func(ctx context.Context, tenantID string)
+}
+
+// Manager runs erasure jobs on a job scheduler and records them in the
+// StateStore so any node can report a job's progress
+type Manager struct {
+	store   state.StateStore
+	targets []Target
+	cfg     Config
+
+	// jobs runs the erasures; ownJobs is set when the manager created it
+	jobs    *jobs.Scheduler
+	ownJobs bool
+}
+
+// NewManager creates an erasure manager over the targets
+func NewManager(store state.StateStore, targets []Target, cfg Config) *Manager {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.JobTTL <= 0 {
+		cfg.JobTTL = 365 * 24 * time.Hour
+	}
+
+	m := &Manager{
+		store:   store,
+		targets: targets,
+		cfg:     cfg,
+	}
+	m.jobs, m.ownJobs = jobs.NewScheduler(store, jobs.Config{}), true
+	m.jobs.SetLimit(jobs.KindErasure, cfg.Concurrency)
+	return m
+}
+
+// WithScheduler runs erasures on a shared scheduler, which its owner closes
+func (m *Manager) WithScheduler(s *jobs.Scheduler) *Manager {
+	m.jobs, m.ownJobs = s, false
+	s.SetLimit(jobs.KindErasure, m.cfg.Concurrency)
+	return m
+}
+
+// jobKey is the StateStore key of a job
+func jobKey(tenantID, id string) string {
+	return "parsec:erasure:" + tenantID + ":" + id
+}
+
+// Create validates the request, records a pending job and starts it
+func (m *Manager) Create(ctx context.Context, tenantID string, req Request) (*Job, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if len(m.targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	job := &Job{
+		ID:          uuid.New().String(),
+		TenantID:    tenantID,
+		Subject:     req.Subject,
+		RequestedBy: req.RequestedBy,
+		Reference:   req.Reference,
+		Status:      StatusPending,
+		CreatedAt:   time.Now().UTC(),
+	}
+	for _, t := range m.targets {
+		job.Targets = append(job.Targets, TargetStatus{Name: t.Name(), Status: StatusPending})
+	}
+	if err := m.save(ctx, job); err != nil {
+		return nil, err
+	}
+	metrics.ErasureJobs.WithLabelValues(StatusPending).Inc()
+	m.audit(job, "erasure requested")
+
+	// The job runs on its own copy so the caller's view stays stable
+	created := *job
+	created.Targets = append([]TargetStatus(nil), job.Targets...)
+	_, err := m.jobs.Submit(ctx, jobs.Task{
+		ID:       job.ID,
+		Kind:     jobs.KindErasure,
+		TenantID: tenantID,
+		Detail:   "/admin/tenants/" + tenantID + "/erasures/" + job.ID,
+		Run: func(ctx context.Context, report func(jobs.Progress)) error {
+			return m.run(ctx, job, report)
+		},
+		Finish: func(err error) { m.finish(job, err) },
+	})
+	if err != nil {
+		m.finish(job, err)
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Get returns a tenant's job
+func (m *Manager) Get(ctx context.Context, tenantID, id string) (*Job, error) {
+	data, err := m.store.Get(ctx, jobKey(tenantID, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("parse erasure job: %w", err)
+	}
+	return &job, nil
+}
+
+// Close cancels running jobs, marking them failed, and waits for them. A
+// shared scheduler is left to its owner.
+func (m *Manager) Close() {
+	if m.ownJobs {
+		m.jobs.Close()
+	}
+}
+
+// run executes a job once the scheduler starts it. Every target is
+// attempted even if an earlier one fails, so a retry only has to finish
+// what is left.
+func (m *Manager) run(ctx context.Context, job *Job, report func(jobs.Progress)) error {
+	log := logger.WithComponent("erasure")
+
+	started := time.Now().UTC()
+	job.Status, job.StartedAt = StatusRunning, &started
+	m.record(ctx, job)
+
+	var failed error
+	for i, target := range m.targets {
+		status := &job.Targets[i]
+		status.Status = StatusRunning
+		m.record(ctx, job)
+
+		var erased int64
+		err := target.Erase(ctx, job.scope(), func(p Progress) {
+			job.Deleted += p.Deleted - status.Deleted
+			erased = p.Deleted
+			status.Progress = p
+			m.record(ctx, job)
+			report(jobs.Progress{Done: job.Deleted, Unit: "deleted events"})
+		})
+		metrics.ErasedEvents.WithLabelValues(target.Name()).Add(float64(erased))
+
+		status.Status = StatusSucceeded
+		if err != nil {
+			status.Status, status.Error = StatusFailed, err.Error()
+			failed = fmt.Errorf("%s: %w", target.Name(), err)
+			log.Error().Err(err).Str("job_id", job.ID).Str("target", target.Name()).Msg("erasure target failed")
+		}
+	}
+	return failed
+}
+
+// finish records the job's outcome
+func (m *Manager) finish(job *Job, err error) {
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+	job.Status = StatusSucceeded
+	switch {
+	case errors.Is(err, jobs.ErrCancelled):
+		job.Status, job.Error = StatusCancelled, err.Error()
+	case err != nil:
+		job.Status, job.Error = StatusFailed, err.Error()
+	}
+	metrics.ErasureJobs.WithLabelValues(job.Status).Inc()
+
+	// The job context may be cancelled; the final status must still land
+	m.record(context.Background(), job)
+	m.audit(job, "erasure "+job.Status)
+	if m.cfg.OnFinished != nil {
+		m.cfg.OnFinished(context.Background(), job.TenantID)
+	}
+}
+
+// save writes a job record with the audit TTL
+func (m *Manager) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	key := jobKey(job.TenantID, job.ID)
+	if err := m.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = m.store.Expire(ctx, key, m.cfg.JobTTL)
+	return err
+}
+
+// record saves a running job's progress, logging failures
+func (m *Manager) record(ctx context.Context, job *Job) {
+	if err := m.save(ctx, job); err != nil {
+		log := logger.WithComponent("erasure")
+		log.Warn().Err(err).Str("job_id", job.ID).Msg("failed to record erasure job")
+	}
+}
+
+// audit writes the job's audit trail entry to the log
+func (m *Manager) audit(job *Job, msg string) {
+	log := logger.WithComponent("erasure")
+
+	event := log.Info().
+		Bool("audit", true).
+		Str("job_id", job.ID).
+		Str("tenant_id", job.TenantID).
+		Str("requested_by", job.RequestedBy).
+		Str("reference", job.Reference).
+		Str("status", job.Status).
+		Int64("deleted", job.Deleted)
+	if job.Subject != nil {
+		// The subject value is personal data; only the key is logged
+		event = event.Str("subject_key", job.Subject.Key)
+	}
+	if job.Error != "" {
+		event = event.Str("error", job.Error)
+	}
+	event.Msg(msg)
+}
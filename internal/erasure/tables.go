@@ -0,0 +1,72 @@
+package erasure
+
+import (
+	"context"
+	"fmt"
+
+	"parsec/internal/storage"
+)
+
+// Tables erases events from a ClickHouse base table and its retention
+// partitions with lightweight DELETEs. Tenant-wide erasures also clear the
+// tenant's rollup rows; subject erasures leave them, as rollups hold only
+// counts.
+type Tables struct {
+	conn storage.Conn
+	base string
+}
+
+// NewTables creates a ClickHouse target for the base table, e.g. logs
+func NewTables(conn storage.Conn, base string) *Tables {
+	return &Tables{conn: conn, base: base}
+}
+
+// Name identifies the target
+func (t *Tables) Name() string {
+	return "clickhouse:" + t.base
+}
+
+// Erase counts and deletes matching rows table by table
+func (t *Tables) Erase(ctx context.Context, scope Scope, progress func(Progress)) error {
+	policy := storage.DefaultRetentionPolicy()
+	tables := []string{
+		t.base,
+		policy.PartitionFor(t.base, storage.TierShort).Table,
+		policy.PartitionFor(t.base, storage.TierLong).Table,
+	}
+
+	where, args := "tenant_id = ?", []any{scope.TenantID}
+	if scope.Subject != nil {
+		where += " AND metadata[?] = ?"
+		args = append(args, scope.Subject.Key, scope.Subject.Value)
+	}
+
+	var p Progress
+	for _, table := range tables {
+		n, err := t.conn.QueryInt(ctx, fmt.Sprintf("SELECT count() FROM %s WHERE %s", table, where), args...)
+		if err != nil {
+			return fmt.Errorf("count %s: %w", table, err)
+		}
+		if n > 0 {
+			if err := t.conn.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", table, where), args...); err != nil {
+				return fmt.Errorf("delete from %s: %w", table, err)
+			}
+		}
+		p.Scanned++
+		p.Deleted += n
+		progress(p)
+	}
+
+	if scope.Subject != nil {
+		return nil
+	}
+	for _, r := range storage.DefaultRollups {
+		table := r.Table(t.base)
+		if err := t.conn.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE tenant_id = ?", table), scope.TenantID); err != nil {
+			return fmt.Errorf("delete from %s: %w", table, err)
+		}
+		p.Scanned++
+		progress(p)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Formats an export can be written in
+const (
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Request validation errors
+var (
+	ErrInvalidRange  = errors.New("from must be before to")
+	ErrInvalidFormat = errors.New("format must be ndjson or parquet")
+	ErrJobNotFound   = errors.New("export job not found")
+)
+
+// Request describes the events to export
+type Request struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Format string    `json:"format,omitempty"`
+}
+
+// Validate checks the request, defaulting the format to ndjson
+func (r *Request) Validate() error {
+	if r.From.IsZero() || r.To.IsZero() || !r.From.Before(r.To) {
+		return ErrInvalidRange
+	}
+	switch r.Format {
+	case "":
+		r.Format = FormatNDJSON
+	case FormatNDJSON, FormatParquet:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidFormat, r.Format)
+	}
+	return nil
+}
+
+// Job is an asynchronous tenant export
+type Job struct {
+	ID       string    `json:"id"`
+	TenantID string    `json:"tenant_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Format   string    `json:"format"`
+	Status   string    `json:"status"`
+
+	// Events and Bytes are the exported event count and compressed size
+	Events int64 `json:"events"`
+	Bytes  int64 `json:"bytes"`
+
+	// Key is the object holding the export once it succeeded
+	Key string `json:"key,omitempty"`
+
+	// URL is a freshly signed download link, filled in on read
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// extension returns the object suffix for the job's format
+func (j *Job) extension() string {
+	if j.Format == FormatParquet {
+		return ".parquet"
+	}
+	return ".ndjson.gz"
+}
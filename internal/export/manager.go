@@ -0,0 +1,262 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/jobs"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/objstore"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// Source yields a tenant's stored events
+type Source interface {
+	// Scan calls fn for each of the tenant's events with a timestamp in
+	// [from, to)
+	Scan(ctx context.Context, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error
+}
+
+// Config holds export settings
+type Config struct {
+	// Prefix is prepended to export object keys
+	Prefix string
+
+	// URLTTL is how long signed download URLs stay valid (0 = 1h)
+	URLTTL time.Duration
+
+	// Concurrency bounds export jobs running at once (0 = 2)
+	Concurrency int
+
+	// JobTTL is how long job records are kept (0 = 7 days)
+	JobTTL time.Duration
+}
+
+// Manager runs export jobs on a job scheduler and tracks them in the
+// StateStore so any node can report a job's status
+type Manager struct {
+	store  state.StateStore
+	source Source
+	dest   objstore.Uploader
+	cfg    Config
+
+	// jobs runs the exports; ownJobs is set when the manager created it
+	jobs    *jobs.Scheduler
+	ownJobs bool
+}
+
+// NewManager creates an export manager
+func NewManager(store state.StateStore, source Source, dest objstore.Uploader, cfg Config) *Manager {
+	if cfg.URLTTL <= 0 {
+		cfg.URLTTL = time.Hour
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.JobTTL <= 0 {
+		cfg.JobTTL = 7 * 24 * time.Hour
+	}
+
+	m := &Manager{
+		store:  store,
+		source: source,
+		dest:   dest,
+		cfg:    cfg,
+	}
+	m.jobs, m.ownJobs = jobs.NewScheduler(store, jobs.Config{}), true
+	m.jobs.SetLimit(jobs.KindExport, cfg.Concurrency)
+	return m
+}
+
+// WithScheduler runs exports on a shared scheduler, which its owner closes
+func (m *Manager) WithScheduler(s *jobs.Scheduler) *Manager {
+	m.jobs, m.ownJobs = s, false
+	s.SetLimit(jobs.KindExport, m.cfg.Concurrency)
+	return m
+}
+
+// jobKey is the StateStore key of a job
+func jobKey(tenantID, id string) string {
+	return "parsec:export:" + tenantID + ":" + id
+}
+
+// Create validates the request, records a pending job and starts it
+func (m *Manager) Create(ctx context.Context, tenantID string, req Request) (*Job, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:        uuid.New().String(),
+		TenantID:  tenantID,
+		From:      req.From.UTC(),
+		To:        req.To.UTC(),
+		Format:    req.Format,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := m.save(ctx, job); err != nil {
+		return nil, err
+	}
+	metrics.ExportJobs.WithLabelValues(StatusPending).Inc()
+
+	// The job runs on its own copy so the caller's view stays stable
+	created := *job
+	_, err := m.jobs.Submit(ctx, jobs.Task{
+		ID:       job.ID,
+		Kind:     jobs.KindExport,
+		TenantID: tenantID,
+		Detail:   "/admin/tenants/" + tenantID + "/exports/" + job.ID,
+		Run: func(ctx context.Context, report func(jobs.Progress)) error {
+			return m.run(ctx, job, report)
+		},
+		Finish: func(err error) { m.finish(job, err) },
+	})
+	if err != nil {
+		m.finish(job, err)
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Get returns a tenant's job, with a freshly signed URL once it succeeded
+func (m *Manager) Get(ctx context.Context, tenantID, id string) (*Job, error) {
+	data, err := m.store.Get(ctx, jobKey(tenantID, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("parse export job: %w", err)
+	}
+
+	if job.Status == StatusSucceeded {
+		url, err := m.dest.SignedURL(job.Key, m.cfg.URLTTL)
+		if err != nil {
+			return nil, fmt.Errorf("sign export URL: %w", err)
+		}
+		expires := time.Now().Add(m.cfg.URLTTL).UTC()
+		job.URL, job.URLExpiresAt = url, &expires
+	}
+	return &job, nil
+}
+
+// Close cancels running jobs, marking them failed, and waits for them. A
+// shared scheduler is left to its owner.
+func (m *Manager) Close() {
+	if m.ownJobs {
+		m.jobs.Close()
+	}
+}
+
+// run executes a job once the scheduler starts it
+func (m *Manager) run(ctx context.Context, job *Job, report func(jobs.Progress)) error {
+	job.Status = StatusRunning
+	if err := m.save(ctx, job); err != nil {
+		log := logger.WithComponent("export")
+		log.Warn().Err(err).Str("job_id", job.ID).Msg("failed to record export job status")
+	}
+	return m.export(ctx, job, report)
+}
+
+// export writes the tenant's events to a temporary file and uploads it
+func (m *Manager) export(ctx context.Context, job *Job, report func(jobs.Progress)) error {
+	tmp, err := os.CreateTemp("", "parsec-export-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	w := newEventWriter(job.Format, tmp)
+	err = m.source.Scan(ctx, job.TenantID, job.From, job.To, func(e *models.LogEvent) error {
+		job.Events++
+		report(jobs.Progress{Done: job.Events, Unit: "events"})
+		return w.Write(e)
+	})
+	if err != nil {
+		return fmt.Errorf("scan events: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("encode export: %w", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := m.cfg.Prefix + job.TenantID + "/" + job.ID + job.extension()
+	if err := m.dest.Put(ctx, key, tmp, size); err != nil {
+		return fmt.Errorf("upload export: %w", err)
+	}
+	job.Key, job.Bytes = key, size
+	metrics.ExportedEvents.Add(float64(job.Events))
+	return nil
+}
+
+// finish records the job's outcome
+func (m *Manager) finish(job *Job, err error) {
+	log := logger.WithComponent("export")
+
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+	job.Status = StatusSucceeded
+	switch {
+	case errors.Is(err, jobs.ErrCancelled):
+		job.Status, job.Error = StatusCancelled, err.Error()
+	case err != nil:
+		job.Status, job.Error = StatusFailed, err.Error()
+	}
+	metrics.ExportJobs.WithLabelValues(job.Status).Inc()
+
+	// The job context may be cancelled; the final status must still land
+	if saveErr := m.save(context.Background(), job); saveErr != nil {
+		log.Error().Err(saveErr).Str("job_id", job.ID).Msg("failed to record export job result")
+	}
+
+	event := log.Info()
+	if job.Status == StatusFailed {
+		event = log.Error().Err(err)
+	}
+	event.
+		Str("job_id", job.ID).
+		Str("tenant_id", job.TenantID).
+		Str("status", job.Status).
+		Int64("events", job.Events).
+		Int64("bytes", job.Bytes).
+		Str("key", job.Key).
+		Msg("export finished")
+}
+
+// save writes a job record with the job TTL
+func (m *Manager) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	key := jobKey(job.TenantID, job.ID)
+	if err := m.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = m.store.Expire(ctx, key, m.cfg.JobTTL)
+	return err
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"parsec/pkg/models"
+)
+
+// eventWriter encodes exported events
+type eventWriter interface {
+	Write(e *models.LogEvent) error
+	Close() error
+}
+
+// newEventWriter returns a writer for the format
+func newEventWriter(format string, w io.Writer) eventWriter {
+	if format == FormatParquet {
+		return &parquetWriter{w: parquet.NewGenericWriter[Row](w, parquet.Compression(&parquet.Zstd))}
+	}
+	gz := gzip.NewWriter(w)
+	return &ndjsonWriter{gz: gz, enc: json.NewEncoder(gz)}
+}
+
+// ndjsonWriter writes gzipped newline-delimited JSON events
+type ndjsonWriter struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(e *models.LogEvent) error { return w.enc.Encode(e) }
+func (w *ndjsonWriter) Close() error                   { return w.gz.Close() }
+
+// Row is the Parquet layout of an exported event. parsec-import reads it
+// back, so exports can be re-ingested. Metadata is flattened to dotted keys
+// for querying; MetadataJSON keeps its structure.
+type Row struct {
+	ID           string            `parquet:"id"`
+	TenantID     string            `parquet:"tenant_id"`
+	Timestamp    time.Time         `parquet:"timestamp,timestamp(millisecond)"`
+	Severity     string            `parquet:"severity"`
+	Source       string            `parquet:"source"`
+	Message      string            `parquet:"message"`
+	Metadata     map[string]string `parquet:"metadata"`
+	MetadataJSON string            `parquet:"metadata_json,optional"`
+	TraceID      string            `parquet:"trace_id,optional"`
+	SpanID       string            `parquet:"span_id,optional"`
+}
+
+// parquetWriter buffers rows into row groups
+type parquetWriter struct {
+	w   *parquet.GenericWriter[Row]
+	row [1]Row
+}
+
+func (w *parquetWriter) Write(e *models.LogEvent) error {
+	var metadataJSON string
+	if len(e.Metadata) > 0 {
+		data, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return err
+		}
+		metadataJSON = string(data)
+	}
+
+	w.row[0] = Row{
+		ID:           e.ID,
+		TenantID:     e.TenantID,
+		Timestamp:    e.Timestamp,
+		Severity:     string(e.Severity),
+		Source:       e.Source,
+		Message:      e.Message,
+		Metadata:     e.Metadata.Flatten(),
+		MetadataJSON: metadataJSON,
+		TraceID:      e.TraceID,
+		SpanID:       e.SpanID,
+	}
+	_, err := w.w.Write(w.row[:])
+	return err
+}
+
+func (w *parquetWriter) Close() error { return w.w.Close() }
@@ -0,0 +1,333 @@
+package filesink
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Fsync policies
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+// partSuffix marks the file being written; it is renamed on rotation so
+// that only complete files carry the final name
+const partSuffix = ".part"
+
+// Publisher writes envelopes as newline-delimited JSON to files in a
+// directory, rotating them by size and age. Completed files can be replayed
+// with parsec-import.
+type Publisher struct {
+	cfg config.FileSinkConfig
+	ext string
+
+	mu      sync.Mutex
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	w       io.Writer
+	opened  time.Time
+	dirty   bool
+	lastErr error
+
+	stop   chan struct{}
+	done   chan struct{}
+	closed atomic.Bool
+
+	// Metrics
+	messagesSent   atomic.Uint64
+	messagesFailed atomic.Uint64
+	bytesWritten   atomic.Uint64
+}
+
+// New creates the directory, finalizes files left by a previous run and
+// starts the rotation and fsync loop
+func New(cfg config.FileSinkConfig) (*Publisher, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("file sink requires a directory")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 128 << 20
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = time.Hour
+	}
+	if cfg.FsyncInterval <= 0 {
+		cfg.FsyncInterval = time.Second
+	}
+	switch cfg.Fsync {
+	case "":
+		cfg.Fsync = FsyncInterval
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q (expected always, interval or never)", cfg.Fsync)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create file sink dir: %w", err)
+	}
+
+	p := &Publisher{
+		cfg:  cfg,
+		ext:  ".ndjson",
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if cfg.Compress {
+		p.ext += ".gz"
+	}
+	if err := p.recover(); err != nil {
+		return nil, err
+	}
+
+	go p.run()
+	return p, nil
+}
+
+// recover renames files a crash left behind. A compressed file may end
+// mid-stream; every complete line before that is still readable.
+func (p *Publisher) recover() error {
+	parts, err := filepath.Glob(filepath.Join(p.cfg.Dir, "*"+partSuffix))
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err := os.Rename(part, strings.TrimSuffix(part, partSuffix)); err != nil {
+			return fmt.Errorf("recover %s: %w", part, err)
+		}
+		log := logger.WithComponent("filesink")
+		log.Warn().Str("file", part).Msg("finalized file left by an unclean shutdown")
+	}
+	return nil
+}
+
+// Publish writes an envelope
+func (p *Publisher) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return p.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+// PublishBatch writes envelopes, one JSON line each
+func (p *Publisher) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	if p.closed.Load() {
+		return bus.ErrPublisherClosed
+	}
+	if len(envelopes) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, envelope := range envelopes {
+		line, err := json.Marshal(envelope)
+		if err != nil {
+			p.fail(len(envelopes) - i)
+			return fmt.Errorf("%w: %v", bus.ErrSerializeFailed, err)
+		}
+		line = append(line, '\n')
+
+		if err := p.writeLine(line); err != nil {
+			p.lastErr = err
+			p.fail(len(envelopes) - i)
+			return fmt.Errorf("write %d of %d envelopes: %w", len(envelopes)-i, len(envelopes), err)
+		}
+		p.messagesSent.Add(1)
+		p.bytesWritten.Add(uint64(len(line)))
+	}
+	metrics.FileSinkEnvelopes.WithLabelValues("success").Add(float64(len(envelopes)))
+
+	if p.cfg.Fsync == FsyncAlways {
+		if err := p.sync(); err != nil {
+			p.lastErr = err
+			return err
+		}
+	}
+	p.lastErr = nil
+	return nil
+}
+
+// fail counts envelopes that were not written
+func (p *Publisher) fail(n int) {
+	p.messagesFailed.Add(uint64(n))
+	metrics.FileSinkEnvelopes.WithLabelValues("failed").Add(float64(n))
+}
+
+// writeLine appends a line, rotating first if the file is full or old
+func (p *Publisher) writeLine(line []byte) error {
+	if p.file != nil {
+		switch {
+		case p.counter.n+int64(len(line)) > p.cfg.MaxBytes && p.counter.n > 0:
+			if err := p.rotate("size"); err != nil {
+				return err
+			}
+		case time.Since(p.opened) >= p.cfg.MaxAge:
+			if err := p.rotate("age"); err != nil {
+				return err
+			}
+		}
+	}
+	if p.file == nil {
+		if err := p.open(); err != nil {
+			return err
+		}
+	}
+
+	p.dirty = true
+	_, err := p.w.Write(line)
+	return err
+}
+
+// open starts a new file named by its UTC start time
+func (p *Publisher) open() error {
+	now := time.Now().UTC()
+	name := filepath.Join(p.cfg.Dir, "parsec-"+now.Format("20060102T150405.000000000Z")+p.ext+partSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open sink file: %w", err)
+	}
+
+	p.file, p.opened = file, now
+	p.counter = &countingWriter{w: file}
+	p.w = p.counter
+	if p.cfg.Compress {
+		p.gz = gzip.NewWriter(p.counter)
+		p.w = p.gz
+	}
+	return nil
+}
+
+// rotate completes the current file: flushes, syncs, closes and renames it
+func (p *Publisher) rotate(reason string) error {
+	if p.file == nil {
+		return nil
+	}
+
+	var err error
+	if p.gz != nil {
+		err = p.gz.Close()
+	}
+	if syncErr := p.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	name := p.file.Name()
+	p.file, p.gz, p.w, p.counter = nil, nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("close sink file: %w", err)
+	}
+
+	if err := os.Rename(name, strings.TrimSuffix(name, partSuffix)); err != nil {
+		return fmt.Errorf("finalize sink file: %w", err)
+	}
+	metrics.FileSinkRotations.WithLabelValues(reason).Inc()
+	return nil
+}
+
+// sync flushes compressed data and fsyncs the file
+func (p *Publisher) sync() error {
+	if p.file == nil || !p.dirty {
+		return nil
+	}
+	if p.gz != nil {
+		if err := p.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// run rotates idle files past their age and applies the interval fsync
+// policy
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(min(p.cfg.FsyncInterval, p.cfg.MaxAge))
+	defer ticker.Stop()
+
+	log := logger.WithComponent("filesink")
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			var err error
+			if p.file != nil && time.Since(p.opened) >= p.cfg.MaxAge {
+				err = p.rotate("age")
+			} else if p.cfg.Fsync == FsyncInterval {
+				err = p.sync()
+			}
+			if err != nil {
+				p.lastErr = err
+				log.Error().Err(err).Msg("file sink flush failed")
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// HealthCheck reports the last write or flush failure, such as a full disk
+func (p *Publisher) HealthCheck(ctx context.Context) error {
+	if p.closed.Load() {
+		return bus.ErrPublisherClosed
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+// Stats returns publisher statistics
+func (p *Publisher) Stats() bus.Stats {
+	return bus.Stats{
+		MessagesSent:   p.messagesSent.Load(),
+		MessagesFailed: p.messagesFailed.Load(),
+		BytesWritten:   p.bytesWritten.Load(),
+	}
+}
+
+// Close stops the background loop and completes the current file
+func (p *Publisher) Close() error {
+	if p.closed.Swap(true) {
+		return nil
+	}
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rotate("shutdown")
+}
+
+// countingWriter tracks the bytes written to a file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,338 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/state"
+)
+
+// Flag identifies a feature flag
+type Flag string
+
+// Known flags gating risky behaviours
+const (
+	AsyncProducer       Flag = "async_producer"
+	NewCodec            Flag = "new_codec"
+	Sampling            Flag = "sampling"
+	EnvelopeCompression Flag = "envelope_compression"
+	RequestCapture      Flag = "request_capture"
+)
+
+// StoreKey is the StateStore key listing the flags with runtime overrides.
+// Each override is kept under its own key, so nodes changing different
+// flags at once don't overwrite each other.
+const StoreKey = "parsec:flags"
+
+// ErrNoOverride is returned when deleting a flag without a runtime override
+var ErrNoOverride = errors.New("flag has no runtime override")
+
+// overrideKey is the StateStore key of a flag's runtime override
+func overrideKey(flag Flag) string {
+	return StoreKey + ":override:" + string(flag)
+}
+
+// Rule describes when a flag is enabled.
+//
+// Evaluation order: an explicit tenant entry wins, then the percentage
+// rollout (stable per tenant), then the global Enabled value.
+type Rule struct {
+	Enabled bool            `json:"enabled"`
+	Percent int             `json:"percent,omitempty"`
+	Tenants map[string]bool `json:"tenants,omitempty"`
+}
+
+// Source loads flag rules from a backing store
+type Source interface {
+	Name() string
+	Load(ctx context.Context) (map[Flag]Rule, error)
+}
+
+// Manager evaluates feature flags merged from several sources
+type Manager struct {
+	sources []Source
+	store   state.StateStore
+
+	mu        sync.RWMutex
+	rules     map[Flag]Rule
+	overrides map[Flag]Rule
+}
+
+// NewManager creates a flag manager. Sources are merged in order, later
+// sources overriding earlier ones. If store is non-nil, runtime overrides
+// set via Set are persisted there and shared with other nodes.
+func NewManager(store state.StateStore, sources ...Source) *Manager {
+	return &Manager{
+		sources:   sources,
+		store:     store,
+		rules:     make(map[Flag]Rule),
+		overrides: make(map[Flag]Rule),
+	}
+}
+
+// Enabled reports whether the flag is on for the given tenant. An empty
+// tenant evaluates the global value.
+func (m *Manager) Enabled(flag Flag, tenantID string) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.RLock()
+	rule, ok := m.overrides[flag]
+	if !ok {
+		rule, ok = m.rules[flag]
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	return rule.evaluate(flag, tenantID)
+}
+
+// AnyEnabled reports whether the flag is on globally or for any tenant,
+// for callers that must decide before they know the tenant
+func (m *Manager) AnyEnabled(flag Flag) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.RLock()
+	rule, ok := m.overrides[flag]
+	if !ok {
+		rule, ok = m.rules[flag]
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	if rule.Enabled || rule.Percent > 0 {
+		return true
+	}
+	for _, on := range rule.Tenants {
+		if on {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate applies the rule to a tenant
+func (r Rule) evaluate(flag Flag, tenantID string) bool {
+	if tenantID != "" {
+		if v, ok := r.Tenants[tenantID]; ok {
+			return v
+		}
+		if r.Percent > 0 {
+			return bucket(flag, tenantID) < r.Percent
+		}
+	}
+	return r.Enabled
+}
+
+// bucket maps a tenant to a stable bucket in [0, 100) for a flag
+func bucket(flag Flag, tenantID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(tenantID))
+	return int(h.Sum32() % 100)
+}
+
+// Set overrides a flag at runtime, persisting it to the store if configured
+func (m *Manager) Set(ctx context.Context, flag Flag, rule Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.overrides[flag] = rule
+	m.mu.Unlock()
+
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Set(ctx, overrideKey(flag), data); err != nil {
+		return err
+	}
+	return m.list(ctx, func(names []string) []string {
+		if slices.Contains(names, string(flag)) {
+			return names
+		}
+		return append(names, string(flag))
+	})
+}
+
+// Delete removes a flag's runtime override, so its sources' rule applies
+// again
+func (m *Manager) Delete(ctx context.Context, flag Flag) error {
+	m.mu.Lock()
+	_, ok := m.overrides[flag]
+	delete(m.overrides, flag)
+	m.mu.Unlock()
+
+	if !ok && m.store != nil {
+		// Possibly set on another node since the last refresh
+		data, err := m.store.Get(ctx, overrideKey(flag))
+		if err != nil {
+			return err
+		}
+		ok = len(data) > 0
+	}
+	if !ok {
+		return ErrNoOverride
+	}
+	if m.store == nil {
+		return nil
+	}
+	if err := m.list(ctx, func(names []string) []string {
+		return slices.DeleteFunc(names, func(name string) bool { return name == string(flag) })
+	}); err != nil {
+		return err
+	}
+	_, err := m.store.Expire(ctx, overrideKey(flag), 0)
+	return err
+}
+
+// list changes the names of the flags with overrides in the store
+func (m *Manager) list(ctx context.Context, change func(names []string) []string) error {
+	return state.NewVersioned(m.store, StoreKey).Update(ctx, func(current []byte) ([]byte, error) {
+		var names []string
+		if len(current) > 0 {
+			if err := json.Unmarshal(current, &names); err != nil {
+				return nil, err
+			}
+		}
+		names = change(names)
+		sort.Strings(names)
+		return json.Marshal(names)
+	})
+}
+
+// Snapshot returns the effective rule for every known flag
+func (m *Manager) Snapshot() map[Flag]Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[Flag]Rule, len(m.rules)+len(m.overrides))
+	for flag, rule := range m.rules {
+		out[flag] = rule
+	}
+	for flag, rule := range m.overrides {
+		out[flag] = rule
+	}
+	return out
+}
+
+// Names returns the sorted names of all flags with a rule
+func (m *Manager) Names() []string {
+	snapshot := m.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for flag := range snapshot {
+		names = append(names, string(flag))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Refresh reloads rules from all sources and the store
+func (m *Manager) Refresh(ctx context.Context) error {
+	log := logger.WithComponent("flags")
+	rules := make(map[Flag]Rule)
+
+	var firstErr error
+	for _, src := range m.sources {
+		loaded, err := src.Load(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("source", src.Name()).Msg("failed to load feature flags")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for flag, rule := range loaded {
+			rules[flag] = rule
+		}
+	}
+
+	m.mu.Lock()
+	m.rules = rules
+	m.mu.Unlock()
+
+	if m.store != nil {
+		overrides, err := m.loadOverrides(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to load feature flag overrides")
+			return err
+		}
+		// Nothing listed leaves this node's overrides, as a store that
+		// keeps nothing would wipe them
+		if overrides != nil {
+			m.mu.Lock()
+			m.overrides = overrides
+			m.mu.Unlock()
+		}
+	}
+
+	return firstErr
+}
+
+// loadOverrides reads the overrides listed in the store, nil if no list
+// was written
+func (m *Manager) loadOverrides(ctx context.Context) (map[Flag]Rule, error) {
+	data, err := state.NewVersioned(m.store, StoreKey).Get(ctx)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("parse flag overrides list: %w", err)
+	}
+
+	overrides := make(map[Flag]Rule, len(names))
+	for _, name := range names {
+		data, err := m.store.Get(ctx, overrideKey(Flag(name)))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			// Listed by a Set whose rule was deleted since
+			continue
+		}
+		var rule Rule
+		if err := json.Unmarshal(data, &rule); err != nil {
+			return nil, fmt.Errorf("parse override of %s: %w", name, err)
+		}
+		overrides[Flag(name)] = rule
+	}
+	return overrides, nil
+}
+
+// Run refreshes flags periodically until the context is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Refresh(ctx)
+		}
+	}
+}
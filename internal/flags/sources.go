@@ -0,0 +1,65 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvSource parses global toggles from a comma-separated list such as
+// "async_producer=true,sampling=false". A bare name enables the flag.
+type EnvSource struct {
+	Value string
+}
+
+// Name implements Source
+func (s EnvSource) Name() string { return "env" }
+
+// Load implements Source
+func (s EnvSource) Load(ctx context.Context) (map[Flag]Rule, error) {
+	rules := make(map[Flag]Rule)
+	for _, part := range strings.Split(s.Value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(part, "=")
+		enabled := true
+		if found {
+			v, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("flag %q: invalid value %q", name, value)
+			}
+			enabled = v
+		}
+		rules[Flag(strings.TrimSpace(name))] = Rule{Enabled: enabled}
+	}
+	return rules, nil
+}
+
+// FileSource loads rules from a JSON file mapping flag names to rules.
+// The file is re-read on every refresh so edits take effect without a restart.
+type FileSource struct {
+	Path string
+}
+
+// Name implements Source
+func (s FileSource) Name() string { return "file" }
+
+// Load implements Source
+func (s FileSource) Load(ctx context.Context) (map[Flag]Rule, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[Flag]Rule)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.Path, err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,335 @@
+package forward
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBufferFull is returned when the disk buffer has reached its size cap
+var ErrBufferFull = errors.New("forward buffer full")
+
+const (
+	segmentSuffix = ".seg"
+	offsetSuffix  = ".offset"
+
+	// segmentBytes rotates the segment being appended to
+	segmentBytes = 8 << 20
+)
+
+// Position addresses a line in the buffer by segment name and byte offset.
+// Positions order by segment, then offset; the zero Position precedes all
+// others.
+type Position struct {
+	Segment string `json:"segment,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
+}
+
+// IsZero reports whether p is the zero Position
+func (p Position) IsZero() bool {
+	return p.Segment == "" && p.Offset == 0
+}
+
+// Before reports whether p comes before o
+func (p Position) Before(o Position) bool {
+	if p.Segment != o.Segment {
+		return p.Segment < o.Segment
+	}
+	return p.Offset < o.Offset
+}
+
+// Buffer is a disk queue of JSON lines split into segment files. Lines are
+// appended to the newest segment and read from the oldest; the read offset
+// of the oldest segment is persisted next to it, so lines are delivered at
+// least once across restarts.
+type Buffer struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	segments []string // oldest first
+	tail     *os.File
+	tailSize int64
+	offset   int64 // read offset in segments[0]
+	size     int64 // bytes not yet committed
+}
+
+// OpenBuffer opens (or creates) a buffer in dir, resuming from segments left
+// by a previous run
+func OpenBuffer(dir string, maxBytes int64) (*Buffer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("forward buffer requires a directory")
+	}
+	if maxBytes <= 0 {
+		maxBytes = 1 << 30
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create forward buffer dir: %w", err)
+	}
+
+	b := &Buffer{dir: dir, maxBytes: maxBytes}
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segments)
+	b.segments = segments
+
+	for _, seg := range segments {
+		info, err := os.Stat(seg)
+		if err != nil {
+			return nil, err
+		}
+		b.size += info.Size()
+	}
+	if len(segments) > 0 {
+		data, err := os.ReadFile(segments[0] + offsetSuffix)
+		if err == nil {
+			b.offset, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		}
+		b.size -= b.offset
+	}
+	return b, nil
+}
+
+// Append writes lines (each ending in '\n') to the newest segment
+func (b *Buffer) Append(lines []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size+int64(len(lines)) > b.maxBytes {
+		return ErrBufferFull
+	}
+	if b.tail == nil || b.tailSize >= segmentBytes {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := b.tail.Write(lines)
+	b.tailSize += int64(n)
+	b.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return b.tail.Sync()
+}
+
+// rotate starts a new segment named by the current time
+func (b *Buffer) rotate() error {
+	if b.tail != nil {
+		b.tail.Close()
+	}
+	name := filepath.Join(b.dir, time.Now().UTC().Format("20060102T150405.000000000Z")+segmentSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open forward segment: %w", err)
+	}
+	b.tail, b.tailSize = file, 0
+	b.segments = append(b.segments, name)
+	return nil
+}
+
+// Peek returns up to max lines (and about maxBytes) from the oldest segment
+// without consuming them
+func (b *Buffer) Peek(max, maxBytes int) ([][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.segments) > 0 {
+		file, err := os.Open(b.segments[0])
+		if err != nil {
+			return nil, err
+		}
+		lines, err := readLines(file, b.offset, max, maxBytes)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) > 0 {
+			return lines, nil
+		}
+
+		// The oldest segment is fully read; drop it unless it is still being
+		// written
+		if !b.dropHead() {
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// Head returns the position of the oldest uncommitted line, or the zero
+// Position when the buffer has no segments
+func (b *Buffer) Head() Position {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.head()
+}
+
+func (b *Buffer) head() Position {
+	if len(b.segments) == 0 {
+		return Position{}
+	}
+	return Position{Segment: filepath.Base(b.segments[0]), Offset: b.offset}
+}
+
+// Read returns up to max lines (and about maxBytes) from one segment,
+// starting at from or at the head if from has already been committed. It
+// returns the position of the first line and the position after the last;
+// reading never consumes lines, so several reads may be outstanding.
+func (b *Buffer) Read(from Position, max, maxBytes int) (lines [][]byte, start, next Position, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if from.Before(b.head()) {
+		from = b.head()
+	}
+	for i, seg := range b.segments {
+		name := filepath.Base(seg)
+		if name < from.Segment {
+			continue
+		}
+		if name > from.Segment {
+			from = Position{Segment: name}
+		}
+
+		file, err := os.Open(seg)
+		if err != nil {
+			return nil, from, from, err
+		}
+		lines, err := readLines(file, from.Offset, max, maxBytes)
+		file.Close()
+		if err != nil {
+			return nil, from, from, err
+		}
+		if len(lines) > 0 {
+			next = from
+			for _, line := range lines {
+				next.Offset += int64(len(line))
+			}
+			return lines, from, next, nil
+		}
+
+		// Lines may still be appended to the last segment
+		if i == len(b.segments)-1 || (b.tail != nil && b.tail.Name() == seg) {
+			break
+		}
+	}
+	return nil, from, from, nil
+}
+
+// CommitTo consumes every line before pos, deleting segments that are fully
+// consumed. Positions at or before the head are ignored.
+func (b *Buffer) CommitTo(pos Position) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.segments) > 0 && filepath.Base(b.segments[0]) < pos.Segment {
+		if !b.dropHead() {
+			return nil
+		}
+	}
+	if len(b.segments) == 0 || filepath.Base(b.segments[0]) != pos.Segment || pos.Offset <= b.offset {
+		return nil
+	}
+	return b.commit(pos.Offset - b.offset)
+}
+
+// readLines reads whole lines from offset
+func readLines(r io.ReadSeeker, offset int64, max, maxBytes int) ([][]byte, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+
+	var lines [][]byte
+	size := 0
+	for len(lines) < max {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial line is left for the next read
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if size+len(line) > maxBytes && len(lines) > 0 {
+			break
+		}
+		size += len(line)
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// Commit consumes the first n bytes returned by Peek
+func (b *Buffer) Commit(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.segments) == 0 {
+		return nil
+	}
+	return b.commit(n)
+}
+
+// commit advances the head offset by n bytes
+func (b *Buffer) commit(n int64) error {
+	b.offset += n
+	b.size -= n
+
+	info, err := os.Stat(b.segments[0])
+	if err != nil {
+		return err
+	}
+	if b.offset >= info.Size() && b.dropHead() {
+		return nil
+	}
+	return os.WriteFile(b.segments[0]+offsetSuffix, []byte(strconv.FormatInt(b.offset, 10)), 0o644)
+}
+
+// dropHead deletes the oldest segment, discounting any bytes left unread in
+// it. The segment being appended to is kept. It reports whether a segment
+// was dropped.
+func (b *Buffer) dropHead() bool {
+	head := b.segments[0]
+	if b.tail != nil && b.tail.Name() == head {
+		return false
+	}
+	if info, err := os.Stat(head); err == nil && info.Size() > b.offset {
+		b.size -= info.Size() - b.offset
+	}
+	os.Remove(head)
+	os.Remove(head + offsetSuffix)
+	b.segments = b.segments[1:]
+	b.offset = 0
+	return true
+}
+
+// Size returns the bytes not yet committed
+func (b *Buffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Close closes the segment being written
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tail == nil {
+		return nil
+	}
+	err := b.tail.Close()
+	b.tail = nil
+	return err
+}
@@ -0,0 +1,315 @@
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/signing"
+	"parsec/pkg/models"
+)
+
+// Forwarding protocols
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// Forwarder is the edge-mode publisher. Envelopes are appended to a disk
+// buffer and a background loop forwards them in gzip-compressed batches to
+// a central Parsec, either POSTed to its /ingest/forward endpoint or over
+// an mTLS grpc stream, retrying with backoff while the central node is
+// unreachable.
+type Forwarder struct {
+	cfg    config.ForwardConfig
+	nodeID string
+	buffer *Buffer
+	client *http.Client
+	conn   *grpc.ClientConn
+
+	// ctx aborts an in-flight request on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	closed atomic.Bool
+
+	// Metrics
+	messagesSent   atomic.Uint64
+	messagesFailed atomic.Uint64
+	bytesWritten   atomic.Uint64
+}
+
+// New opens the buffer and starts forwarding
+func New(cfg config.ForwardConfig, nodeID string) (*Forwarder, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("forward URL is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = 4 << 20
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.RetryBackoff {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTP
+	}
+	if cfg.Protocol != ProtocolHTTP && cfg.Protocol != ProtocolGRPC {
+		return nil, fmt.Errorf("unknown forward protocol %q", cfg.Protocol)
+	}
+
+	buffer, err := OpenBuffer(cfg.BufferDir, cfg.BufferMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Forwarder{
+		ctx:    ctx,
+		cancel: cancel,
+		cfg:    cfg,
+		nodeID: nodeID,
+		buffer: buffer,
+		client: &http.Client{Timeout: cfg.Timeout},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	metrics.ForwardBufferedBytes.Set(float64(buffer.Size()))
+
+	if cfg.Protocol == ProtocolGRPC {
+		if err := f.dial(); err != nil {
+			cancel()
+			buffer.Close()
+			return nil, err
+		}
+		go f.runStream()
+		return f, nil
+	}
+	go f.run()
+	return f, nil
+}
+
+// Publish buffers an envelope
+func (f *Forwarder) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return f.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+// PublishBatch buffers envelopes on disk; they are forwarded in the
+// background
+func (f *Forwarder) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	if f.closed.Load() {
+		return bus.ErrPublisherClosed
+	}
+	if len(envelopes) == 0 {
+		return nil
+	}
+
+	var lines bytes.Buffer
+	for _, envelope := range envelopes {
+		line, err := json.Marshal(envelope)
+		if err != nil {
+			f.messagesFailed.Add(uint64(len(envelopes)))
+			return fmt.Errorf("%w: %v", bus.ErrSerializeFailed, err)
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+
+	if err := f.buffer.Append(lines.Bytes()); err != nil {
+		f.messagesFailed.Add(uint64(len(envelopes)))
+		metrics.ForwardEnvelopes.WithLabelValues("buffer_full").Add(float64(len(envelopes)))
+		return err
+	}
+	metrics.ForwardBufferedBytes.Set(float64(f.buffer.Size()))
+
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run forwards buffered envelopes until Close
+func (f *Forwarder) run() {
+	defer close(f.done)
+
+	log := logger.WithComponent("forwarder")
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	backoff := f.cfg.RetryBackoff
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-f.wake:
+		case <-ticker.C:
+		}
+
+		for {
+			sent, err := f.forwardBatch()
+			if err != nil {
+				log.Warn().Err(err).Dur("retry_in", backoff).Int64("buffered_bytes", f.buffer.Size()).Msg("forwarding failed")
+				select {
+				case <-f.stop:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, f.cfg.MaxBackoff)
+				continue
+			}
+			backoff = f.cfg.RetryBackoff
+			if !sent {
+				break
+			}
+		}
+	}
+}
+
+// forwardBatch sends the oldest buffered batch and commits what the central
+// node processed. It reports whether there was anything to send.
+func (f *Forwarder) forwardBatch() (bool, error) {
+	lines, err := f.buffer.Peek(f.cfg.BatchSize, f.cfg.BatchBytes)
+	if err != nil || len(lines) == 0 {
+		return false, err
+	}
+
+	resp, err := f.send(lines)
+	if err != nil {
+		metrics.ForwardRequests.WithLabelValues("failed").Inc()
+		return true, err
+	}
+	metrics.ForwardRequests.WithLabelValues("success").Inc()
+
+	processed := min(resp.Processed, len(lines))
+	var n int64
+	for _, line := range lines[:processed] {
+		n += int64(len(line))
+	}
+	if err := f.buffer.Commit(n); err != nil {
+		return true, fmt.Errorf("commit forward buffer: %w", err)
+	}
+	metrics.ForwardBufferedBytes.Set(float64(f.buffer.Size()))
+
+	f.messagesSent.Add(uint64(processed - resp.Rejected))
+	f.messagesFailed.Add(uint64(resp.Rejected))
+	metrics.ForwardEnvelopes.WithLabelValues("forwarded").Add(float64(processed - resp.Rejected))
+	metrics.ForwardEnvelopes.WithLabelValues("rejected").Add(float64(resp.Rejected))
+
+	if processed < len(lines) {
+		return true, fmt.Errorf("central queue full after %d of %d envelopes", processed, len(lines))
+	}
+	return true, nil
+}
+
+// send posts lines as one gzip-compressed, optionally signed request
+func (f *Forwarder) send(lines [][]byte) (handlers.ForwardResponse, error) {
+	var result handlers.ForwardResponse
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	for _, line := range lines {
+		gz.Write(line)
+	}
+	if err := gz.Close(); err != nil {
+		return result, err
+	}
+
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodPost, f.cfg.URL, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-API-Key", f.cfg.APIKey)
+	req.Header.Set("X-Parsec-Node", f.nodeID)
+	if f.cfg.SigningSecret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := uuid.New().String()
+		req.Header.Set(signing.HeaderTimestamp, ts)
+		req.Header.Set(signing.HeaderNonce, nonce)
+		req.Header.Set(signing.HeaderSignature, signing.Sign([]byte(f.cfg.SigningSecret), ts, nonce, body.Bytes()))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return result, fmt.Errorf("central returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("decode forward response: %w", err)
+	}
+	f.bytesWritten.Add(uint64(body.Len()))
+	return result, nil
+}
+
+// HealthCheck fails while the buffer is full, when envelopes are being
+// refused. An unreachable central node alone is not a failure.
+func (f *Forwarder) HealthCheck(ctx context.Context) error {
+	if f.closed.Load() {
+		return bus.ErrPublisherClosed
+	}
+	if f.buffer.Size() >= f.buffer.maxBytes {
+		return ErrBufferFull
+	}
+	return nil
+}
+
+// Stats returns forwarding statistics; BytesWritten counts compressed bytes
+// sent
+func (f *Forwarder) Stats() bus.Stats {
+	return bus.Stats{
+		MessagesSent:   f.messagesSent.Load(),
+		MessagesFailed: f.messagesFailed.Load(),
+		BytesWritten:   f.bytesWritten.Load(),
+	}
+}
+
+// Close stops forwarding; buffered envelopes stay on disk for the next run
+func (f *Forwarder) Close() error {
+	if f.closed.Swap(true) {
+		return nil
+	}
+	close(f.stop)
+	f.cancel()
+	<-f.done
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	return f.buffer.Close()
+}
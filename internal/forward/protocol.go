@@ -0,0 +1,105 @@
+package forward
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The grpc forwarding protocol is a single bidirectional stream per edge
+// node. The central node opens it with an Ack carrying the node's resume
+// token and initial credits; the edge then sends Batches read from its disk
+// buffer, keeping at most Credits unacknowledged. Each Batch is answered by
+// an Ack in order. An Ack's Position is the resume token: every line before
+// it has been queued centrally and may be committed by the edge. When the
+// central queue fills, the Ack carries RetryAfterMS and later batches are
+// discarded until the edge resends from Position.
+//
+// Messages are JSON encoded; there is no generated code to keep in step.
+
+const (
+	serviceName  = "parsec.forward.v1.Forwarder"
+	streamMethod = "/" + serviceName + "/Stream"
+
+	// codecName selects jsonCodec through the grpc content subtype
+	codecName = "json"
+)
+
+// Batch is a run of buffered lines sent by an edge node
+type Batch struct {
+	// Seq numbers batches on the stream from 1
+	Seq uint64 `json:"seq"`
+
+	// From is the position the edge read from: the previous batch's end
+	// or the position it resumed at. Start is the first line's position,
+	// which differs from From when the read moved on to the next segment.
+	From  Position `json:"from"`
+	Start Position `json:"start"`
+
+	// Envelopes are the lines without their trailing newlines
+	Envelopes []json.RawMessage `json:"envelopes"`
+}
+
+// Ack answers a Batch; the Ack opening the stream has Seq 0
+type Ack struct {
+	Seq uint64 `json:"seq"`
+
+	// Position is the resume token
+	Position Position `json:"position"`
+
+	// Processed counts lines of the batch that were queued, rejected as
+	// malformed or skipped as already received; Rejected counts the
+	// malformed ones
+	Processed int `json:"processed"`
+	Rejected  int `json:"rejected"`
+
+	// Credits is how many batches may now be unacknowledged
+	Credits int `json:"credits"`
+
+	// RetryAfterMS is set when the central queue filled mid-batch; the
+	// edge resends from Position after the delay
+	RetryAfterMS int64 `json:"retry_after_ms,omitempty"`
+
+	// Discarded is set when the batch did not continue from Position
+	Discarded bool `json:"discarded,omitempty"`
+}
+
+// jsonCodec encodes protocol messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// streamServer is implemented by Server; grpc checks registered services
+// against it
+type streamServer interface {
+	serve(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*streamServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Stream",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(streamServer).serve(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "parsec/internal/forward/protocol.go",
+}
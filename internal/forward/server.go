@@ -0,0 +1,305 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // edge nodes compress batches
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+const (
+	// resumeKeyPrefix prefixes each edge node's resume token in the state
+	// store
+	resumeKeyPrefix = "parsec:forward:resume:"
+
+	// retryAfter is how long an edge node waits after the queue fills
+	retryAfter = 500 * time.Millisecond
+)
+
+// Sink queues envelopes received from edge nodes
+type Sink interface {
+	Accept(line []byte) handlers.ForwardResult
+
+	// Pressure returns how full the queue is, from 0 to 1
+	Pressure() float64
+}
+
+// Server is the central node's grpc forwarding listener. Each edge node,
+// identified by its client certificate, has one stream at a time; its
+// resume token is kept in the state store so a reconnecting node (or a
+// restarted central node sharing the store) continues where it left off.
+type Server struct {
+	cfg   config.ForwardServerConfig
+	sink  Sink
+	store state.StateStore
+	lis   net.Listener
+	grpc  *grpc.Server
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is an edge node's active stream
+type session struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewServer listens on cfg.Addr; call Serve to accept streams
+func NewServer(cfg config.ForwardServerConfig, sink Sink, store state.StateStore) (*Server, error) {
+	if cfg.Window <= 0 {
+		cfg.Window = 8
+	}
+	tlsConfig, err := serverTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		sink:     sink,
+		store:    store,
+		lis:      lis,
+		sessions: make(map[string]*session),
+	}
+	s.grpc = grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	s.grpc.RegisterService(&serviceDesc, s)
+	return s, nil
+}
+
+// Addr returns the listen address
+func (s *Server) Addr() net.Addr {
+	return s.lis.Addr()
+}
+
+// Serve accepts streams until Close
+func (s *Server) Serve() error {
+	return s.grpc.Serve(s.lis)
+}
+
+// Close drops all streams; edge nodes resend anything unacknowledged
+func (s *Server) Close() {
+	s.grpc.Stop()
+}
+
+// serve runs one edge node's stream
+func (s *Server) serve(stream grpc.ServerStream) error {
+	node, err := peerNode(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	log := logger.WithComponent("forward_server")
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	defer s.claim(node, cancel)()
+
+	metrics.ForwardStreams.Inc()
+	defer metrics.ForwardStreams.Dec()
+
+	expected, err := s.loadResume(ctx, node)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "load resume token: %v", err)
+	}
+	if err := stream.SendMsg(&Ack{Position: expected, Credits: s.credits()}); err != nil {
+		return err
+	}
+	log.Info().
+		Str("edge_node", node).
+		Str("resume_segment", expected.Segment).
+		Int64("resume_offset", expected.Offset).
+		Msg("edge node connected")
+
+	batches := make(chan *Batch)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			batch := new(Batch)
+			if err := stream.RecvMsg(batch); err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	synced := false
+	for {
+		var batch *Batch
+		select {
+		case <-ctx.Done():
+			return status.Error(codes.Aborted, "stream replaced or cancelled")
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case batch = <-batches:
+		}
+
+		before := expected
+		ack := s.apply(batch, &expected, !synced)
+		if !ack.Discarded {
+			synced = true
+		}
+		if expected != before {
+			if err := s.saveResume(ctx, node, expected); err != nil {
+				// The edge skips ahead of a stale token on reconnect
+				log.Warn().Err(err).Str("edge_node", node).Msg("failed to save resume token")
+			}
+		}
+		if err := stream.SendMsg(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// apply queues a batch's lines from expected on and advances expected past
+// them. The first batch of a stream may start beyond expected, since the
+// edge may have committed lines whose token was not saved.
+func (s *Server) apply(batch *Batch, expected *Position, first bool) *Ack {
+	ack := &Ack{Seq: batch.Seq, Credits: s.credits()}
+
+	switch {
+	case batch.From == *expected, first && expected.Before(batch.From):
+	case batch.From.Before(*expected):
+		// Resent after a reconnect; lines before expected are skipped
+	default:
+		// Sent before the edge saw an earlier partial ack
+		ack.Position = *expected
+		ack.Discarded = true
+		metrics.ForwardStreamBatches.WithLabelValues("discarded").Inc()
+		return ack
+	}
+
+	pos := batch.Start
+	for _, line := range batch.Envelopes {
+		end := Position{Segment: pos.Segment, Offset: pos.Offset + int64(len(line)) + 1}
+		if pos.Before(*expected) {
+			ack.Processed++
+			pos = end
+			continue
+		}
+
+		switch s.sink.Accept(line) {
+		case handlers.ForwardQueueFull:
+			*expected = pos
+			ack.Position = pos
+			ack.RetryAfterMS = retryAfter.Milliseconds()
+			metrics.ForwardStreamBatches.WithLabelValues("partial").Inc()
+			return ack
+		case handlers.ForwardRejected:
+			ack.Rejected++
+		}
+		ack.Processed++
+		*expected = end
+		pos = end
+	}
+
+	ack.Position = *expected
+	metrics.ForwardStreamBatches.WithLabelValues("complete").Inc()
+	return ack
+}
+
+// credits returns the window granted to edge nodes, throttled to one batch
+// in flight while the queue is more than half full
+func (s *Server) credits() int {
+	if s.sink.Pressure() > 0.5 {
+		return 1
+	}
+	return s.cfg.Window
+}
+
+// claim makes this the node's only stream, ending any earlier one first so
+// two streams never apply the same lines. It returns the release func.
+func (s *Server) claim(node string, cancel context.CancelFunc) func() {
+	sess := &session{cancel: cancel, done: make(chan struct{})}
+
+	s.mu.Lock()
+	prev := s.sessions[node]
+	s.sessions[node] = sess
+	s.mu.Unlock()
+
+	if prev != nil {
+		prev.cancel()
+		<-prev.done
+	}
+	return func() {
+		s.mu.Lock()
+		if s.sessions[node] == sess {
+			delete(s.sessions, node)
+		}
+		s.mu.Unlock()
+		close(sess.done)
+	}
+}
+
+func (s *Server) loadResume(ctx context.Context, node string) (Position, error) {
+	var pos Position
+	data, err := s.store.Get(ctx, resumeKeyPrefix+node)
+	if err != nil || data == nil {
+		return pos, err
+	}
+	err = json.Unmarshal(data, &pos)
+	return pos, err
+}
+
+func (s *Server) saveResume(ctx context.Context, node string, pos Position) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(ctx, resumeKeyPrefix+node, data)
+}
+
+// peerNode returns the edge node named by the verified client certificate:
+// its common name, or its first DNS name
+func peerNode(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", errors.New("no verified client certificate")
+	}
+	cert := info.State.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, nil
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0], nil
+	}
+	return "", errors.New("client certificate names no node")
+}
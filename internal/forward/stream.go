@@ -0,0 +1,218 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// dial prepares the mTLS connection to the central node; grpc connects
+// lazily and reconnects on its own
+func (f *Forwarder) dial() error {
+	tlsConfig, err := clientTLS(f.cfg)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.NewClient(f.cfg.URL,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("forward grpc client: %w", err)
+	}
+	f.conn = conn
+	return nil
+}
+
+// runStream keeps a stream to the central node open until Close,
+// reconnecting with backoff
+func (f *Forwarder) runStream() {
+	defer close(f.done)
+
+	log := logger.WithComponent("forwarder")
+	backoff := f.cfg.RetryBackoff
+	for {
+		progressed, err := f.stream()
+		if f.closed.Load() {
+			return
+		}
+		if progressed {
+			backoff = f.cfg.RetryBackoff
+		}
+		log.Warn().Err(err).Dur("retry_in", backoff).Int64("buffered_bytes", f.buffer.Size()).Msg("forwarding stream closed")
+		metrics.ForwardRequests.WithLabelValues("failed").Inc()
+
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, f.cfg.MaxBackoff)
+	}
+}
+
+// ackResult is a received Ack or the error ending the stream
+type ackResult struct {
+	ack *Ack
+	err error
+}
+
+// stream forwards over one stream until it fails or Close. Batches are sent
+// while the central node's credits allow; each Ack commits the buffer up to
+// its resume token. After a partial or discarded batch nothing more is sent
+// until every outstanding batch is answered, then reading restarts at the
+// token. It reports whether any batch was acknowledged.
+func (f *Forwarder) stream() (bool, error) {
+	connectCtx, cancelConnect := context.WithTimeout(f.ctx, f.cfg.Timeout)
+	defer cancelConnect()
+
+	ctx, cancel := context.WithCancel(f.ctx)
+	defer cancel()
+
+	// The connect timeout covers opening the stream and its first Ack
+	opened := make(chan struct{})
+	go func() {
+		select {
+		case <-connectCtx.Done():
+			if connectCtx.Err() == context.DeadlineExceeded {
+				cancel()
+			}
+		case <-opened:
+		}
+	}()
+
+	st, err := f.conn.NewStream(ctx, &serviceDesc.Streams[0], streamMethod,
+		grpc.CallContentSubtype(codecName),
+		grpc.UseCompressor(gzip.Name),
+		grpc.WaitForReady(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	welcome := new(Ack)
+	if err := st.RecvMsg(welcome); err != nil {
+		return false, err
+	}
+	close(opened)
+
+	if err := f.buffer.CommitTo(welcome.Position); err != nil {
+		return false, fmt.Errorf("commit forward buffer: %w", err)
+	}
+	cursor := f.buffer.Head()
+	if cursor.Before(welcome.Position) {
+		cursor = welcome.Position
+	}
+	credits := max(welcome.Credits, 1)
+
+	acks := make(chan ackResult)
+	go func() {
+		for {
+			ack := new(Ack)
+			err := st.RecvMsg(ack)
+			select {
+			case acks <- ackResult{ack: ack, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var sent, acked uint64
+	var rewinding bool
+	var paused <-chan time.Time
+	progressed := false
+	for {
+		for !rewinding && paused == nil && sent-acked < uint64(credits) {
+			lines, start, next, err := f.buffer.Read(cursor, f.cfg.BatchSize, f.cfg.BatchBytes)
+			if err != nil {
+				return progressed, err
+			}
+			if len(lines) == 0 {
+				break
+			}
+
+			batch := &Batch{Seq: sent + 1, From: cursor, Start: start, Envelopes: make([]json.RawMessage, len(lines))}
+			for i, line := range lines {
+				batch.Envelopes[i] = bytes.TrimSuffix(line, []byte{'\n'})
+			}
+			if err := st.SendMsg(batch); err != nil {
+				return progressed, err
+			}
+			sent++
+			cursor = next
+		}
+
+		select {
+		case <-f.stop:
+			st.CloseSend()
+			return progressed, nil
+		case <-f.wake:
+		case <-ticker.C:
+		case <-paused:
+			paused = nil
+		case res := <-acks:
+			if res.err != nil {
+				return progressed, res.err
+			}
+			ack := res.ack
+			if ack.Seq != acked+1 {
+				return progressed, fmt.Errorf("ack %d out of order, expected %d", ack.Seq, acked+1)
+			}
+			acked = ack.Seq
+			credits = max(ack.Credits, 1)
+			progressed = true
+			f.handleAck(ack)
+
+			if ack.RetryAfterMS > 0 || ack.Discarded {
+				if !rewinding && ack.RetryAfterMS > 0 {
+					paused = time.After(time.Duration(ack.RetryAfterMS) * time.Millisecond)
+				}
+				rewinding = true
+			}
+			if rewinding && acked == sent {
+				rewinding = false
+				cursor = ack.Position
+			}
+		}
+	}
+}
+
+// handleAck commits the buffer up to the ack's resume token and records
+// the batch's outcome
+func (f *Forwarder) handleAck(ack *Ack) {
+	log := logger.WithComponent("forwarder")
+
+	if err := f.buffer.CommitTo(ack.Position); err != nil {
+		log.Error().Err(err).Msg("failed to commit forward buffer")
+	}
+	metrics.ForwardBufferedBytes.Set(float64(f.buffer.Size()))
+	if ack.Discarded {
+		return
+	}
+
+	metrics.ForwardRequests.WithLabelValues("success").Inc()
+	f.messagesSent.Add(uint64(ack.Processed - ack.Rejected))
+	f.messagesFailed.Add(uint64(ack.Rejected))
+	metrics.ForwardEnvelopes.WithLabelValues("forwarded").Add(float64(ack.Processed - ack.Rejected))
+	metrics.ForwardEnvelopes.WithLabelValues("rejected").Add(float64(ack.Rejected))
+}
@@ -0,0 +1,49 @@
+package httpserver
+
+import "net/http"
+
+// Middleware wraps a handler; see the middleware package
+type Middleware = func(http.Handler) http.Handler
+
+// Router registers routes on a ServeMux, wrapping each in the middleware
+// of the group it was registered through. Patterns are ServeMux patterns,
+// so they may be method-scoped ("GET /admin/jobs/{id}") and carry path
+// parameters, read with r.PathValue.
+type Router struct {
+	mux        *http.ServeMux
+	middleware []Middleware
+}
+
+// NewRouter creates a router without middleware
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Group returns a router registering on the same mux whose routes run
+// through this router's middleware, then middlewares, in order
+func (r *Router) Group(middlewares ...Middleware) *Router {
+	return &Router{
+		mux:        r.mux,
+		middleware: append(append([]Middleware(nil), r.middleware...), middlewares...),
+	}
+}
+
+// Handle registers a handler for the pattern, wrapped in the group's
+// middleware. Like ServeMux, it panics on conflicting patterns.
+func (r *Router) Handle(pattern string, h http.Handler) {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	r.mux.Handle(pattern, h)
+}
+
+// HandleFunc registers a handler function for the pattern
+func (r *Router) HandleFunc(pattern string, f http.HandlerFunc) {
+	r.Handle(pattern, f)
+}
+
+// ServeHTTP dispatches the request to the route matching it. Requests to
+// a method-scoped route with another method get 405 with an Allow header.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
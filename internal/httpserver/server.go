@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"parsec/internal/config"
+	"parsec/internal/metrics"
+)
+
+// Server is an HTTP server configured from config.HTTPConfig
+type Server struct {
+	cfg config.HTTPConfig
+	srv *http.Server
+	tls bool
+}
+
+// New builds the server. With TLS, HTTP/2 is offered through ALPN unless
+// disabled; without it, H2C accepts cleartext HTTP/2.
+func New(cfg config.HTTPConfig, handler http.Handler) (*Server, error) {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("http TLS requires both a certificate and a key")
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: cfg.MaxConcurrentStreams,
+		IdleTimeout:          cfg.IdleTimeout,
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           countProtocols(handler),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ConnState:         trackConn,
+	}
+	srv.SetKeepAlivesEnabled(cfg.KeepAlives)
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load http certificate: %w", err)
+		}
+		// Session tickets are on by default, so reconnecting agents
+		// resume instead of doing a full handshake
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	switch {
+	case cfg.TLSCertFile != "" && cfg.HTTP2:
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return nil, fmt.Errorf("configure http2: %w", err)
+		}
+	case cfg.TLSCertFile != "":
+		// A non-nil empty map turns off net/http's built-in HTTP/2
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	case cfg.H2C:
+		// Registers h2s for graceful shutdown of HTTP/2 connections. It
+		// also sets an empty TLSConfig, so TLS is tracked separately.
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return nil, fmt.Errorf("configure h2c: %w", err)
+		}
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+
+	return &Server{cfg: cfg, srv: srv, tls: cfg.TLSCertFile != ""}, nil
+}
+
+// Listen opens the listening socket with the configured TCP keep-alive
+func (s *Server) Listen() (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: s.cfg.TCPKeepAlive}
+	return lc.Listen(context.Background(), "tcp", s.cfg.Addr)
+}
+
+// Serve accepts connections on ln until Shutdown. It returns
+// http.ErrServerClosed after a shutdown.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.tls {
+		return s.srv.ServeTLS(ln, "", "")
+	}
+	return s.srv.Serve(ln)
+}
+
+// ListenAndServe listens on the configured address and serves
+func (s *Server) ListenAndServe() error {
+	ln, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests,
+// HTTP/2 streams included
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// Addr returns the configured listen address
+func (s *Server) Addr() string {
+	return s.cfg.Addr
+}
+
+// TLS reports whether the server terminates TLS
+func (s *Server) TLS() bool {
+	return s.tls
+}
+
+// trackConn counts accepted and open connections; a high open rate
+// relative to requests means clients are not reusing connections. h2c
+// connections are hijacked by the HTTP/2 server and leave the gauge then.
+func trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		metrics.HTTPConnectionsOpened.Inc()
+		metrics.HTTPConnectionsActive.Inc()
+	case http.StateHijacked, http.StateClosed:
+		metrics.HTTPConnectionsActive.Dec()
+	}
+}
+
+// Request counters per protocol, resolved once instead of per request
+var (
+	http1Requests = metrics.HTTPRequestsByProtocol.WithLabelValues("http/1")
+	http2Requests = metrics.HTTPRequestsByProtocol.WithLabelValues("http/2")
+)
+
+// countProtocols counts requests by protocol version
+func countProtocols(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			http2Requests.Inc()
+		} else {
+			http1Requests.Inc()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
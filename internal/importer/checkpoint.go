@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileProgress records how far an archive object has been imported
+type FileProgress struct {
+	// Size detects objects replaced since the checkpoint was written
+	Size int64 `json:"size"`
+
+	// Records is the number of records sent (accepted or rejected)
+	Records int64 `json:"records"`
+
+	// Done is set once every record has been sent
+	Done bool `json:"done"`
+}
+
+// Checkpoint persists per-object progress so an interrupted import resumes
+// where it stopped. Records are sent at least once.
+type Checkpoint struct {
+	path string
+
+	mu    sync.Mutex
+	Files map[string]*FileProgress `json:"files"`
+}
+
+// LoadCheckpoint reads the checkpoint file ("" = in-memory only)
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	cp := &Checkpoint{path: path, Files: make(map[string]*FileProgress)}
+	if path == "" {
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint: %w", err)
+	}
+	if cp.Files == nil {
+		cp.Files = make(map[string]*FileProgress)
+	}
+	return cp, nil
+}
+
+// Progress returns an object's progress, restarting it if its size changed
+func (c *Checkpoint) Progress(key string, size int64) FileProgress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.Files[key]
+	if !ok || p.Size != size {
+		return FileProgress{Size: size}
+	}
+	return *p
+}
+
+// Update records an object's progress and writes the checkpoint file
+func (c *Checkpoint) Update(key string, p FileProgress) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Files[key] = &p
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write-then-rename so a crash never leaves a torn checkpoint
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,363 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/logger"
+	"parsec/internal/objstore"
+	"parsec/internal/signing"
+)
+
+// Config holds importer settings
+type Config struct {
+	// Target is the Parsec ingest URL, e.g. http://localhost:8080/ingest
+	Target string
+
+	// APIKey is sent as X-API-Key
+	APIKey string
+
+	// SigningSecret signs requests when the target requires it
+	SigningSecret string
+
+	// Format forces the archive format (auto = by file extension)
+	Format Format
+
+	// BatchSize is the number of events per ingest request (0 = 500)
+	BatchSize int
+
+	// RatePerSecond caps events sent per second (0 = unlimited)
+	RatePerSecond float64
+
+	// MaxRetries bounds retries of a batch on 429, 5xx and network errors
+	MaxRetries int
+
+	// Client is the HTTP client (nil = 30s timeout client)
+	Client *http.Client
+}
+
+// Stats summarizes an import
+type Stats struct {
+	Files    int `json:"files"`
+	Skipped  int `json:"skipped"`
+	Records  int `json:"records"`
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	Dropped  int `json:"dropped"`
+}
+
+// Importer replays archived events through the ingest API, so they pass
+// the same pipeline as live traffic with their original event time
+type Importer struct {
+	cfg        Config
+	checkpoint *Checkpoint
+
+	// Pacing state for RatePerSecond
+	started time.Time
+	sent    int
+}
+
+// New creates an importer that records progress in the checkpoint
+func New(cfg Config, checkpoint *Checkpoint) *Importer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatAuto
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Importer{cfg: cfg, checkpoint: checkpoint}
+}
+
+// Run imports every object under prefix in key order, skipping objects the
+// checkpoint marks done, resuming partially imported ones and ignoring
+// incomplete file sink output (*.part)
+func (im *Importer) Run(ctx context.Context, store objstore.Store, prefix string) (Stats, error) {
+	log := logger.WithComponent("importer")
+	var stats Stats
+
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return stats, fmt.Errorf("list archive: %w", err)
+	}
+
+	im.started = time.Now()
+	for _, obj := range objects {
+		// Files still being written by a file sink
+		if strings.HasSuffix(obj.Key, ".part") {
+			continue
+		}
+
+		progress := im.checkpoint.Progress(obj.Key, obj.Size)
+		if progress.Done {
+			stats.Skipped++
+			continue
+		}
+
+		log.Info().Str("object", obj.Key).Int64("resume_at", progress.Records).Msg("importing archive object")
+		if err := im.importObject(ctx, store, obj, progress, &stats); err != nil {
+			return stats, fmt.Errorf("%s: %w", obj.Key, err)
+		}
+		stats.Files++
+	}
+	return stats, nil
+}
+
+// importObject streams one object in batches, checkpointing after each
+func (im *Importer) importObject(ctx context.Context, store objstore.Store, obj objstore.Object, progress FileProgress, stats *Stats) error {
+	records, closeFn, err := im.open(ctx, store, obj)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	// Skip records sent before the checkpoint
+	for i := int64(0); i < progress.Records; i++ {
+		if _, err := records.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+	}
+
+	batch := make([]handlers.LogEventInput, 0, im.cfg.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := im.send(ctx, batch, stats); err != nil {
+			return err
+		}
+		progress.Records += int64(len(batch))
+		batch = batch[:0]
+		return im.checkpoint.Update(obj.Key, progress)
+	}
+
+	for {
+		event, err := records.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		stats.Records++
+		batch = append(batch, event)
+		if len(batch) == im.cfg.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	progress.Done = true
+	return im.checkpoint.Update(obj.Key, progress)
+}
+
+// open returns a record reader for an object. Parquet needs random access,
+// so remote objects are first copied to a temporary file.
+func (im *Importer) open(ctx context.Context, store objstore.Store, obj objstore.Object) (RecordReader, func(), error) {
+	body, err := store.Open(ctx, obj.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format := im.cfg.Format
+	if format == FormatAuto {
+		format = DetectFormat(obj.Key)
+	}
+
+	if format != FormatParquet {
+		records, err := NewNDJSONReader(body)
+		if err != nil {
+			body.Close()
+			return nil, nil, err
+		}
+		return records, func() { body.Close() }, nil
+	}
+
+	file, ok := body.(*os.File)
+	cleanup := func() { body.Close() }
+	if !ok {
+		tmp, err := os.CreateTemp("", "parsec-import-*.parquet")
+		if err != nil {
+			body.Close()
+			return nil, nil, err
+		}
+		_, err = io.Copy(tmp, body)
+		body.Close()
+		cleanup = func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("download: %w", err)
+		}
+		file = tmp
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	records, err := NewParquetReader(file, info.Size())
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return records, cleanup, nil
+}
+
+// send posts a batch, retrying transient failures and events the target
+// rejected because its queue was full
+func (im *Importer) send(ctx context.Context, batch []handlers.LogEventInput, stats *Stats) error {
+	log := logger.WithComponent("importer")
+	pending := batch
+	backoff := 500 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		if err := im.pace(ctx, len(pending)); err != nil {
+			return err
+		}
+
+		resp, retryAfter, err := im.post(ctx, pending)
+		if err == nil {
+			stats.Accepted += resp.Accepted
+			stats.Dropped += resp.Dropped
+
+			var retry []handlers.LogEventInput
+			for _, e := range resp.Errors {
+				if e.Error == handlers.QueueFullError && e.Index < len(pending) {
+					retry = append(retry, pending[e.Index])
+					continue
+				}
+				stats.Rejected++
+				log.Warn().Str("event_id", e.EventID).Str("error", e.Error).Msg("archived event rejected")
+			}
+			if len(retry) == 0 {
+				return nil
+			}
+			// Retried events are counted again once accepted
+			pending = retry
+			err = fmt.Errorf("%d events rejected: %s", len(retry), handlers.QueueFullError)
+		}
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) || attempt >= im.cfg.MaxRetries {
+			return err
+		}
+		wait := backoff << attempt
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		log.Warn().Err(err).Int("attempt", attempt+1).Dur("retry_in", wait).Msg("ingest request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// post sends one ingest request. Transient failures return an error and the
+// server's Retry-After, if any; client errors are wrapped as permanent.
+func (im *Importer) post(ctx context.Context, events []handlers.LogEventInput) (handlers.IngestResponse, time.Duration, error) {
+	var result handlers.IngestResponse
+
+	body, err := json.Marshal(handlers.IngestRequest{Events: events})
+	if err != nil {
+		return result, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, im.cfg.Target, bytes.NewReader(body))
+	if err != nil {
+		return result, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", im.cfg.APIKey)
+	if im.cfg.SigningSecret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := uuid.New().String()
+		req.Header.Set(signing.HeaderTimestamp, ts)
+		req.Header.Set(signing.HeaderNonce, nonce)
+		req.Header.Set(signing.HeaderSignature, signing.Sign([]byte(im.cfg.SigningSecret), ts, nonce, body))
+	}
+
+	resp, err := im.cfg.Client.Do(req)
+	if err != nil {
+		return result, 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusMultiStatus:
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return result, 0, fmt.Errorf("decode ingest response: %w", err)
+		}
+		return result, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return result, retryAfter, fmt.Errorf("ingest returned %s", resp.Status)
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return result, 0, &PermanentError{Status: resp.StatusCode, Body: string(bytes.TrimSpace(msg))}
+	}
+}
+
+// PermanentError is a client error from the ingest API that retrying won't fix
+type PermanentError struct {
+	Status int
+	Body   string
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("ingest returned %d: %s", e.Status, e.Body)
+}
+
+// pace blocks until sending n more events stays within RatePerSecond
+func (im *Importer) pace(ctx context.Context, n int) error {
+	if im.cfg.RatePerSecond <= 0 {
+		return nil
+	}
+
+	due := im.started.Add(time.Duration(float64(im.sent) / im.cfg.RatePerSecond * float64(time.Second)))
+	im.sent += n
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
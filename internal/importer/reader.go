@@ -0,0 +1,247 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	handlers "parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+// Format is an archive encoding
+type Format string
+
+const (
+	FormatAuto    Format = "auto"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+// DetectFormat picks the format from the object key. Anything that is not
+// Parquet is read as NDJSON (gzip is detected from the content).
+func DetectFormat(key string) Format {
+	if strings.HasSuffix(strings.ToLower(key), ".parquet") {
+		return FormatParquet
+	}
+	return FormatNDJSON
+}
+
+// RecordReader yields archived events in file order; Next returns io.EOF
+// after the last record
+type RecordReader interface {
+	Next() (handlers.LogEventInput, error)
+}
+
+// ndjsonReader reads one JSON event per line. Lines may also be envelopes
+// (as written by the file sink), whose event is used.
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewNDJSONReader reads newline-delimited JSON events, transparently
+// decompressing gzip input
+func NewNDJSONReader(r io.Reader) (RecordReader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		r = gz
+	} else {
+		r = br
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonReader{scanner: scanner}, nil
+}
+
+func (r *ndjsonReader) Next() (handlers.LogEventInput, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record struct {
+			handlers.LogEventInput
+			Event *handlers.LogEventInput `json:"event"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return handlers.LogEventInput{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if record.Event != nil {
+			return *record.Event, nil
+		}
+		return record.LogEventInput, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return handlers.LogEventInput{}, err
+	}
+	return handlers.LogEventInput{}, io.EOF
+}
+
+// parquetReader maps Parquet columns named like the ingest fields to events.
+// Metadata may be a MAP<string,string> column or a JSON string; a
+// metadata_json column, as written by exports, takes precedence.
+type parquetReader struct {
+	reader  *parquet.Reader
+	columns []parquetColumn
+	rows    []parquet.Row
+	pending []parquet.Row
+}
+
+// parquetColumn describes one leaf column
+type parquetColumn struct {
+	path     []string
+	timeUnit time.Duration // non-zero for TIMESTAMP columns
+}
+
+// NewParquetReader reads events from a Parquet file
+func NewParquetReader(r io.ReaderAt, size int64) (RecordReader, error) {
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("open parquet: %w", err)
+	}
+
+	schema := file.Schema()
+	paths := schema.Columns()
+	columns := make([]parquetColumn, len(paths))
+	for i, path := range paths {
+		columns[i].path = path
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			continue
+		}
+		if lt := leaf.Node.Type().LogicalType(); lt != nil && lt.Timestamp != nil {
+			switch {
+			case lt.Timestamp.Unit.Millis != nil:
+				columns[i].timeUnit = time.Millisecond
+			case lt.Timestamp.Unit.Micros != nil:
+				columns[i].timeUnit = time.Microsecond
+			default:
+				columns[i].timeUnit = time.Nanosecond
+			}
+		}
+	}
+
+	return &parquetReader{
+		reader:  parquet.NewReader(file),
+		columns: columns,
+		rows:    make([]parquet.Row, 128),
+	}, nil
+}
+
+func (r *parquetReader) Next() (handlers.LogEventInput, error) {
+	if len(r.pending) == 0 {
+		n, err := r.reader.ReadRows(r.rows)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return handlers.LogEventInput{}, err
+		}
+		r.pending = r.rows[:n]
+	}
+
+	row := r.pending[0]
+	r.pending = r.pending[1:]
+	return r.convert(row)
+}
+
+// convert maps a row's leaf values to event fields
+func (r *parquetReader) convert(row parquet.Row) (handlers.LogEventInput, error) {
+	var event handlers.LogEventInput
+	var metaKeys, metaValues []string
+	var metaJSON string
+
+	for _, v := range row {
+		if v.IsNull() || v.Column() >= len(r.columns) {
+			continue
+		}
+		col := r.columns[v.Column()]
+		name := col.path[0]
+		s := parquetString(v, col.timeUnit)
+
+		switch name {
+		case "id":
+			event.ID = s
+		case "tenant_id":
+			event.TenantID = s
+		case "timestamp":
+			event.Timestamp = s
+		case "severity":
+			event.Severity = s
+		case "source":
+			event.Source = s
+		case "message":
+			event.Message = s
+		case "trace_id":
+			event.TraceID = s
+		case "span_id":
+			event.SpanID = s
+		case "metadata_json":
+			metaJSON = s
+		case "metadata":
+			switch leaf := col.path[len(col.path)-1]; {
+			case len(col.path) == 1:
+				if err := json.Unmarshal([]byte(s), &event.Metadata); err != nil {
+					return event, fmt.Errorf("metadata: %w", err)
+				}
+			case leaf == "key":
+				metaKeys = append(metaKeys, s)
+			case leaf == "value":
+				metaValues = append(metaValues, s)
+			}
+		}
+	}
+
+	if len(metaKeys) > 0 {
+		event.Metadata = make(models.Metadata, len(metaKeys))
+		for i, k := range metaKeys {
+			if i < len(metaValues) {
+				event.Metadata[k] = metaValues[i]
+			}
+		}
+	}
+	if metaJSON != "" {
+		event.Metadata = nil
+		if err := json.Unmarshal([]byte(metaJSON), &event.Metadata); err != nil {
+			return event, fmt.Errorf("metadata_json: %w", err)
+		}
+	}
+	return event, nil
+}
+
+// parquetString renders a value for an event field; timestamps become RFC 3339
+func parquetString(v parquet.Value, timeUnit time.Duration) string {
+	switch v.Kind() {
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	case parquet.Int64:
+		if timeUnit != 0 {
+			return time.Unix(0, v.Int64()*int64(timeUnit)).UTC().Format(time.RFC3339Nano)
+		}
+		return strconv.FormatInt(v.Int64(), 10)
+	case parquet.Int32:
+		return strconv.FormatInt(int64(v.Int32()), 10)
+	case parquet.Double:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64)
+	case parquet.Boolean:
+		return strconv.FormatBool(v.Boolean())
+	default:
+		return v.String()
+	}
+}
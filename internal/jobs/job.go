@@ -0,0 +1,94 @@
+// Package jobs runs long background work (exports, erasures,
+// reprocessing, uploads, usage reports) for the features that own it. The
+// scheduler bounds how many jobs of a kind run at once, keeps a common record of
+// every job in the StateStore with its progress, and cancels jobs on
+// request from any node. Features keep their own detailed job records alongside.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Job kinds run by Parsec's features
+const (
+	KindExport    = "export"
+	KindErasure   = "erasure"
+	KindReprocess = "reprocess"
+	KindUpload    = "upload"
+	KindUsage     = "usage"
+)
+
+// Scheduler errors
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+
+	// ErrCancelled is passed to Task.Finish for jobs cancelled on request
+	ErrCancelled = errors.New("job cancelled")
+)
+
+// Progress is a job's running total of work done
+type Progress struct {
+	Done int64 `json:"done"`
+
+	// Total is the work expected, when known (0 = unknown)
+	Total int64 `json:"total,omitempty"`
+
+	// Unit names what Done counts, e.g. "events"
+	Unit string `json:"unit,omitempty"`
+}
+
+// Record is the scheduler's view of a job
+type Record struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// Detail is where the owning feature reports the job in full
+	Detail string `json:"detail,omitempty"`
+
+	Status   string   `json:"status"`
+	Progress Progress `json:"progress"`
+
+	// Node ran (or is running) the job
+	Node string `json:"node,omitempty"`
+
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Finished reports whether the job has reached a final status
+func (r *Record) Finished() bool {
+	return r.Status == StatusSucceeded || r.Status == StatusFailed || r.Status == StatusCancelled
+}
+
+// Task is a unit of work handed to the scheduler
+type Task struct {
+	// ID is the owning feature's job ID, shared by the scheduler record
+	ID       string
+	Kind     string
+	TenantID string
+	Detail   string
+
+	// Run does the work, reporting progress as it goes. ctx is cancelled
+	// when the job is cancelled or the scheduler closes.
+	Run func(ctx context.Context, report func(Progress)) error
+
+	// Finish records the outcome in the feature's own job record. It is
+	// called exactly once, with ErrCancelled for cancelled jobs, including
+	// jobs that never started.
+	Finish func(err error)
+}
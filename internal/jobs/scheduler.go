@@ -0,0 +1,389 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// StateStore keys. Records are listed newest first through a sequence:
+// each job takes the next number and indexes its ID under it.
+const (
+	recordPrefix = "parsec:jobs:"
+	seqKey       = "parsec:jobs:seq"
+	indexPrefix  = "parsec:jobs:seq:"
+	cancelSuffix = ":cancel"
+)
+
+// Config holds scheduler settings
+type Config struct {
+	// NodeID is recorded on the jobs this node runs
+	NodeID string
+
+	// JobTTL is how long records are kept (0 = 7 days); features keep
+	// their own records for as long as they need
+	JobTTL time.Duration
+
+	// ProgressInterval is how often running jobs record progress (0 = 5s)
+	ProgressInterval time.Duration
+
+	// CancelPoll is how often running jobs check for a cancellation made
+	// on another node (0 = 2s)
+	CancelPoll time.Duration
+}
+
+// Filter selects records to list; empty fields match everything
+type Filter struct {
+	Kind     string
+	Status   string
+	TenantID string
+
+	// Limit bounds the records returned (0 = 100)
+	Limit int
+}
+
+// running is a job this node is running
+type running struct {
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Scheduler runs jobs in the background, at most a per-kind limit at once
+type Scheduler struct {
+	store state.StateStore
+	cfg   Config
+
+	mu      sync.Mutex
+	limits  map[string]chan struct{}
+	running map[string]*running
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a job scheduler
+func NewScheduler(store state.StateStore, cfg Config) *Scheduler {
+	if cfg.JobTTL <= 0 {
+		cfg.JobTTL = 7 * 24 * time.Hour
+	}
+	if cfg.ProgressInterval <= 0 {
+		cfg.ProgressInterval = 5 * time.Second
+	}
+	if cfg.CancelPoll <= 0 {
+		cfg.CancelPoll = 2 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		store:   store,
+		cfg:     cfg,
+		limits:  make(map[string]chan struct{}),
+		running: make(map[string]*running),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// SetLimit bounds how many jobs of kind run at once on this node
+// (default 1). It applies to jobs submitted afterwards.
+func (s *Scheduler) SetLimit(kind string, n int) {
+	if n <= 0 {
+		n = 1
+	}
+	s.mu.Lock()
+	s.limits[kind] = make(chan struct{}, n)
+	s.mu.Unlock()
+}
+
+// slots returns the concurrency slots of kind
+func (s *Scheduler) slots(kind string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.limits[kind]
+	if !ok {
+		sem = make(chan struct{}, 1)
+		s.limits[kind] = sem
+	}
+	return sem
+}
+
+// Submit records a pending job and starts it once a slot of its kind is
+// free
+func (s *Scheduler) Submit(ctx context.Context, task Task) (*Record, error) {
+	if task.ID == "" || task.Kind == "" || task.Run == nil || task.Finish == nil {
+		return nil, errors.New("task requires an ID, kind, Run and Finish")
+	}
+
+	rec := &Record{
+		ID:        task.ID,
+		Kind:      task.Kind,
+		TenantID:  task.TenantID,
+		Detail:    task.Detail,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.save(ctx, rec); err != nil {
+		return nil, err
+	}
+	seq, err := s.store.Incr(ctx, seqKey, 1)
+	if err != nil {
+		return nil, err
+	}
+	index := indexPrefix + strconv.FormatInt(seq, 10)
+	if err := s.store.Set(ctx, index, []byte(rec.ID)); err != nil {
+		return nil, err
+	}
+	if _, err := s.store.Expire(ctx, index, s.cfg.JobTTL); err != nil {
+		return nil, err
+	}
+	metrics.JobsTotal.WithLabelValues(task.Kind, StatusPending).Inc()
+
+	jobCtx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.running[task.ID] = &running{cancel: cancel}
+	s.mu.Unlock()
+
+	// The job runs on its own copy so the caller's view stays stable
+	submitted := *rec
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.run(jobCtx, task, rec)
+	}()
+	return &submitted, nil
+}
+
+// run executes a job once a slot is free
+func (s *Scheduler) run(ctx context.Context, task Task, rec *Record) {
+	log := logger.WithComponent("jobs").With().Str("job_id", task.ID).Str("kind", task.Kind).Logger()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, task.ID)
+		s.mu.Unlock()
+	}()
+
+	sem := s.slots(task.Kind)
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+		// A slot freed by a cancellation can race the cancellation itself
+		if ctx.Err() != nil {
+			s.finish(task, rec, s.outcome(task.ID, ctx.Err()))
+			return
+		}
+	case <-ctx.Done():
+		s.finish(task, rec, s.outcome(task.ID, ctx.Err()))
+		return
+	}
+
+	started := time.Now().UTC()
+	var mu sync.Mutex // guards rec.Progress while the job runs
+	rec.Status, rec.StartedAt, rec.Node = StatusRunning, &started, s.cfg.NodeID
+	s.record(ctx, rec)
+	metrics.JobsRunning.WithLabelValues(task.Kind).Inc()
+	defer metrics.JobsRunning.WithLabelValues(task.Kind).Dec()
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		progress := time.NewTicker(s.cfg.ProgressInterval)
+		poll := time.NewTicker(s.cfg.CancelPoll)
+		defer progress.Stop()
+		defer poll.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-progress.C:
+				mu.Lock()
+				s.record(ctx, rec)
+				mu.Unlock()
+			case <-poll.C:
+				if s.cancelRequested(ctx, task.ID) {
+					log.Info().Msg("job cancelled from another node")
+					s.cancelLocal(task.ID)
+				}
+			}
+		}
+	}()
+
+	err := task.Run(ctx, func(p Progress) {
+		mu.Lock()
+		rec.Progress = p
+		mu.Unlock()
+	})
+	// The recorder stops first, so it can't overwrite the outcome
+	close(done)
+	<-stopped
+
+	err = s.outcome(task.ID, err)
+	s.finish(task, rec, err)
+	if err != nil && !errors.Is(err, ErrCancelled) {
+		log.Error().Err(err).Msg("job failed")
+	}
+}
+
+// outcome replaces the error of a job cancelled on request with
+// ErrCancelled
+func (s *Scheduler) outcome(id string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.running[id]; r != nil && r.cancelled {
+		return ErrCancelled
+	}
+	return err
+}
+
+// finish records a job's outcome and hands it to the feature
+func (s *Scheduler) finish(task Task, rec *Record, err error) {
+	now := time.Now().UTC()
+	rec.CompletedAt = &now
+	switch {
+	case err == nil:
+		rec.Status = StatusSucceeded
+	case errors.Is(err, ErrCancelled):
+		rec.Status, rec.Error = StatusCancelled, err.Error()
+	default:
+		rec.Status, rec.Error = StatusFailed, err.Error()
+	}
+	metrics.JobsTotal.WithLabelValues(task.Kind, rec.Status).Inc()
+
+	// The scheduler context may be cancelled; the final status must still land
+	s.record(context.Background(), rec)
+	task.Finish(err)
+}
+
+// Get returns a job's record
+func (s *Scheduler) Get(ctx context.Context, id string) (*Record, error) {
+	data, err := s.store.Get(ctx, recordPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parse job: %w", err)
+	}
+	return &rec, nil
+}
+
+// List returns the newest records matching the filter
+func (s *Scheduler) List(ctx context.Context, f Filter) ([]Record, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+
+	data, err := s.store.Get(ctx, seqKey)
+	if err != nil {
+		return nil, err
+	}
+	last, _ := strconv.ParseInt(string(data), 10, 64)
+
+	records := []Record{}
+	for seq := last; seq > 0 && len(records) < f.Limit; seq-- {
+		id, err := s.store.Get(ctx, indexPrefix+strconv.FormatInt(seq, 10))
+		if err != nil {
+			return nil, err
+		}
+		if len(id) == 0 {
+			// Index entries expire with their records; older ones are gone too
+			break
+		}
+		rec, err := s.Get(ctx, string(id))
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (f.Kind == "" || rec.Kind == f.Kind) &&
+			(f.Status == "" || rec.Status == f.Status) &&
+			(f.TenantID == "" || rec.TenantID == f.TenantID) {
+			records = append(records, *rec)
+		}
+	}
+	return records, nil
+}
+
+// Cancel stops a pending or running job. Jobs running on another node
+// stop when it next polls for cancellation.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (*Record, error) {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Finished() {
+		return rec, ErrJobFinished
+	}
+
+	if !s.cancelLocal(id) {
+		key := recordPrefix + id + cancelSuffix
+		if err := s.store.Set(ctx, key, []byte("1")); err != nil {
+			return nil, err
+		}
+		if _, err := s.store.Expire(ctx, key, s.cfg.JobTTL); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// cancelLocal cancels a job running on this node, reporting whether it was
+func (s *Scheduler) cancelLocal(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.running[id]
+	if r == nil {
+		return false
+	}
+	r.cancelled = true
+	r.cancel()
+	return true
+}
+
+// cancelRequested reports whether another node asked to cancel the job
+func (s *Scheduler) cancelRequested(ctx context.Context, id string) bool {
+	data, err := s.store.Get(ctx, recordPrefix+id+cancelSuffix)
+	return err == nil && len(data) > 0
+}
+
+// Close cancels pending and running jobs, which fail, and waits for them
+func (s *Scheduler) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// save writes a record with the job TTL
+func (s *Scheduler) save(ctx context.Context, rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	key := recordPrefix + rec.ID
+	if err := s.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = s.store.Expire(ctx, key, s.cfg.JobTTL)
+	return err
+}
+
+// record saves a record, logging failures
+func (s *Scheduler) record(ctx context.Context, rec *Record) {
+	if err := s.save(ctx, rec); err != nil {
+		log := logger.WithComponent("jobs")
+		log.Warn().Err(err).Str("job_id", rec.ID).Msg("failed to record job")
+	}
+}
@@ -0,0 +1,159 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/pkg/models"
+)
+
+// Source is used for entries with neither a unit nor a syslog identifier
+const Source = "journal"
+
+// journalNamespace derives stable event IDs from journal cursors, so an
+// entry re-read after a restart keeps its ID
+var journalNamespace = uuid.MustParse("6f1c2a44-3d1e-4b8a-9e55-0b6f4c6d2a17")
+
+var errNoCursor = errors.New("journal entry has no cursor")
+
+// entry is a journal entry as printed by journalctl -o json. MESSAGE is a
+// string, or an array of bytes when it is not valid UTF-8.
+type entry struct {
+	Cursor     string          `json:"__CURSOR"`
+	Realtime   string          `json:"__REALTIME_TIMESTAMP"`
+	Message    json.RawMessage `json:"MESSAGE"`
+	Priority   string          `json:"PRIORITY"`
+	Unit       string          `json:"_SYSTEMD_UNIT"`
+	Identifier string          `json:"SYSLOG_IDENTIFIER"`
+	PID        string          `json:"_PID"`
+	Hostname   string          `json:"_HOSTNAME"`
+	BootID     string          `json:"_BOOT_ID"`
+	Transport  string          `json:"_TRANSPORT"`
+}
+
+// parseEntry converts one line of journalctl JSON output to a LogEvent and
+// returns the entry's cursor
+func (r *Reader) parseEntry(line []byte) (*models.LogEvent, string, error) {
+	var e entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, "", err
+	}
+	if e.Cursor == "" {
+		return nil, "", errNoCursor
+	}
+
+	event := &models.LogEvent{
+		ID:        uuid.NewSHA1(journalNamespace, []byte(e.Cursor)).String(),
+		TenantID:  r.tenant(e.Unit),
+		Timestamp: realtime(e.Realtime),
+		Severity:  severity(e.Priority),
+		Source:    source(e),
+		Message:   message(e.Message),
+		Metadata:  make(models.Metadata, 5),
+	}
+
+	for key, value := range map[string]string{
+		"unit":      e.Unit,
+		"pid":       e.PID,
+		"host":      e.Hostname,
+		"boot_id":   e.BootID,
+		"transport": e.Transport,
+	} {
+		if value != "" {
+			event.Metadata[key] = value
+		}
+	}
+
+	return event, e.Cursor, nil
+}
+
+// tenant returns the tenant owning a unit's entries
+func (r *Reader) tenant(unit string) string {
+	if tenant, ok := r.unitTenants[unit]; ok {
+		return tenant
+	}
+	return r.cfg.Tenant
+}
+
+// severity maps a syslog priority to a severity
+func severity(priority string) models.Severity {
+	p, err := strconv.Atoi(priority)
+	if err != nil {
+		return models.SeverityInfo
+	}
+	switch {
+	case p <= 2: // emerg, alert, crit
+		return models.SeverityCritical
+	case p == 3:
+		return models.SeverityError
+	case p == 4:
+		return models.SeverityWarning
+	case p == 7:
+		return models.SeverityDebug
+	default: // notice, info
+		return models.SeverityInfo
+	}
+}
+
+// source names the service that wrote an entry: its unit without the
+// .service suffix, else its syslog identifier
+func source(e entry) string {
+	switch {
+	case e.Unit != "":
+		return strings.TrimSuffix(e.Unit, ".service")
+	case e.Identifier != "":
+		return e.Identifier
+	default:
+		return Source
+	}
+}
+
+// realtime parses __REALTIME_TIMESTAMP (microseconds since the epoch)
+func realtime(us string) time.Time {
+	v, err := strconv.ParseInt(us, 10, 64)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return time.UnixMicro(v).UTC()
+}
+
+// message decodes MESSAGE, which journalctl prints as a byte array when it
+// is not valid UTF-8
+func message(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		b := make([]byte, len(ints))
+		for i, v := range ints {
+			b[i] = byte(v)
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	return ""
+}
+
+// parseUnitTenants parses "unit=tenant,..." pairs
+func parseUnitTenants(s string) (map[string]string, error) {
+	tenants := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		unit, tenant, ok := strings.Cut(pair, "=")
+		unit, tenant = strings.TrimSpace(unit), strings.TrimSpace(tenant)
+		if !ok || unit == "" || tenant == "" {
+			return nil, errors.New("journal unit tenant must be unit=tenant: " + pair)
+		}
+		tenants[unit] = tenant
+	}
+	return tenants, nil
+}
@@ -0,0 +1,306 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Sink receives journal events; the ingest handler implements it
+type Sink interface {
+	Submit(ctx context.Context, event *models.LogEvent) error
+}
+
+// Restart and queue-full backoff bounds
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = 30 * time.Second
+	minSubmitBackoff  = 10 * time.Millisecond
+	maxSubmitBackoff  = time.Second
+)
+
+// Reader tails the systemd journal through journalctl -o json and submits
+// each entry as a LogEvent. The cursor of the last submitted entry is
+// checkpointed, so a restart resumes after it: entries are read at least
+// once and keep their IDs when re-read.
+type Reader struct {
+	cfg         config.JournalConfig
+	sink        Sink
+	unitTenants map[string]string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	cursor string
+	saved  string
+}
+
+// New creates a reader and loads the checkpointed cursor
+func New(cfg config.JournalConfig, sink Sink) (*Reader, error) {
+	if cfg.JournalctlPath == "" {
+		cfg.JournalctlPath = "journalctl"
+	}
+	if cfg.Tenant == "" {
+		return nil, errors.New("journal tenant is required")
+	}
+	if cfg.MinPriority < 0 || cfg.MinPriority > 7 {
+		return nil, fmt.Errorf("journal min priority must be 0-7, got %d", cfg.MinPriority)
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = 5 * time.Second
+	}
+
+	unitTenants, err := parseUnitTenants(cfg.UnitTenants)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{cfg: cfg, sink: sink, unitTenants: unitTenants}
+	if cfg.CursorFile != "" {
+		data, err := os.ReadFile(cfg.CursorFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read journal cursor: %w", err)
+		}
+		r.cursor = strings.TrimSpace(string(data))
+		r.saved = r.cursor
+	}
+	return r, nil
+}
+
+// Start tails the journal in the background until Close
+func (r *Reader) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		r.run(ctx)
+	}()
+	go func() {
+		defer r.wg.Done()
+		r.checkpointLoop(ctx)
+	}()
+}
+
+// Close stops journalctl, waits for the reader and writes the cursor
+func (r *Reader) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+	return r.checkpoint()
+}
+
+// Cursor returns the cursor of the last submitted entry
+func (r *Reader) Cursor() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursor
+}
+
+// run runs journalctl, restarting it with backoff when it exits
+func (r *Reader) run(ctx context.Context) {
+	log := logger.WithComponent("journal")
+	backoff := minRestartBackoff
+
+	for {
+		read, err := r.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if read > 0 {
+			backoff = minRestartBackoff
+		}
+
+		metrics.JournalRestarts.Inc()
+		log.Warn().
+			Err(err).
+			Dur("backoff", backoff).
+			Msg("journalctl exited, restarting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// follow runs one journalctl process and submits its entries until it
+// exits or ctx is cancelled. It returns the number of entries read.
+func (r *Reader) follow(ctx context.Context) (int, error) {
+	cmd := exec.CommandContext(ctx, r.cfg.JournalctlPath, r.args()...)
+	cmd.Stderr = io.Discard
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("start journalctl: %w", err)
+	}
+
+	read := 0
+	lines := bufio.NewReaderSize(stdout, 64*1024)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 {
+			read++
+			r.handle(ctx, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// Drain so Wait does not block on a full pipe
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return read, err
+	}
+	return read, errors.New("journalctl exited")
+}
+
+// args builds the journalctl command line, resuming after the cursor
+func (r *Reader) args() []string {
+	args := []string{
+		"--follow",
+		"--output=json",
+		"--no-pager",
+		"--priority=" + strconv.Itoa(r.cfg.MinPriority),
+	}
+
+	switch cursor := r.Cursor(); {
+	case cursor != "":
+		args = append(args, "--after-cursor="+cursor)
+	case r.cfg.ReadFromHead:
+		args = append(args, "--lines=all")
+	default:
+		args = append(args, "--lines=0")
+	}
+
+	if r.cfg.Directory != "" {
+		args = append(args, "--directory="+r.cfg.Directory)
+	}
+	for _, unit := range r.cfg.Units {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			args = append(args, "--unit="+unit)
+		}
+	}
+	return args
+}
+
+// handle submits one entry, waiting out a full queue, and advances the
+// cursor past it
+func (r *Reader) handle(ctx context.Context, line []byte) {
+	log := logger.WithComponent("journal")
+
+	event, cursor, err := r.parseEntry(line)
+	if err != nil {
+		metrics.JournalEntries.WithLabelValues("malformed").Inc()
+		log.Warn().Err(err).Msg("skipping malformed journal entry")
+		return
+	}
+
+	backoff := minSubmitBackoff
+	for {
+		err = r.sink.Submit(ctx, event)
+		if !errors.Is(err, handlers.ErrQueueFull) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			// Not submitted: leave the cursor so the entry is re-read
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxSubmitBackoff)
+
+		// Submit modifies the event, so each attempt gets a fresh one
+		event, _, _ = r.parseEntry(line)
+	}
+
+	if err != nil {
+		metrics.JournalEntries.WithLabelValues("rejected").Inc()
+		log.Warn().
+			Err(err).
+			Str("source", event.Source).
+			Msg("journal entry rejected")
+	} else {
+		metrics.JournalEntries.WithLabelValues("ingested").Inc()
+	}
+
+	r.mu.Lock()
+	r.cursor = cursor
+	r.mu.Unlock()
+}
+
+// checkpointLoop writes the cursor every CheckpointInterval
+func (r *Reader) checkpointLoop(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.checkpoint(); err != nil {
+				log := logger.WithComponent("journal")
+				log.Error().Err(err).Msg("failed to write journal cursor")
+			}
+		}
+	}
+}
+
+// checkpoint writes the cursor if it moved since the last write
+func (r *Reader) checkpoint() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cfg.CursorFile == "" || r.cursor == r.saved {
+		return nil
+	}
+
+	dir := filepath.Dir(r.cfg.CursorFile)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("write journal cursor: %w", err)
+	}
+
+	// Write-then-rename so a crash never leaves a torn cursor
+	tmp, err := os.CreateTemp(dir, ".journal-cursor-*")
+	if err != nil {
+		return fmt.Errorf("write journal cursor: %w", err)
+	}
+	if _, err := tmp.WriteString(r.cursor + "\n"); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write journal cursor: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write journal cursor: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.cfg.CursorFile); err != nil {
+		return fmt.Errorf("write journal cursor: %w", err)
+	}
+
+	r.saved = r.cursor
+	return nil
+}
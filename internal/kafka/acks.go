@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// requiredAcks maps an envelope's acks level to kafka-go's RequiredAcks,
+// reporting false for "" (the producer's setting) and unknown levels
+func requiredAcks(level string) (int, bool) {
+	switch level {
+	case "none":
+		return int(kafka.RequireNone), true
+	case "leader":
+		return int(kafka.RequireOne), true
+	case "all":
+		return int(kafka.RequireAll), true
+	default:
+		return 0, false
+	}
+}
+
+// acksGroup holds the messages of a batch published with one acks level
+type acksGroup struct {
+	level    string
+	messages []kafka.Message
+}
+
+// groupByAcks splits messages by their envelopes' acks levels, keeping the
+// order within each level. Levels the pool's writers publish with are
+// grouped as "", and batches without levels stay whole.
+func (p *Producer) groupByAcks(levels []string, messages []kafka.Message) []acksGroup {
+	if len(levels) == 0 {
+		return []acksGroup{{messages: messages}}
+	}
+	var groups []acksGroup
+	index := make(map[string]int)
+	for i, msg := range messages {
+		level := levels[i]
+		if acks, ok := requiredAcks(level); !ok || acks == p.cfg.RequiredAcks {
+			level = ""
+		}
+		g, ok := index[level]
+		if !ok {
+			g = len(groups)
+			index[level] = g
+			groups = append(groups, acksGroup{level: level})
+		}
+		groups[g].messages = append(groups[g].messages, msg)
+	}
+	return groups
+}
+
+// acquire checks out a writer publishing with an acks level. Levels other
+// than the producer's are rare (tenant tiers), so each gets one shared
+// writer, created on first use, instead of a pool.
+func (p *Producer) acquire(ctx context.Context, level string) (*pooledWriter, func(), error) {
+	acks, ok := requiredAcks(level)
+	if !ok || acks == p.cfg.RequiredAcks {
+		w, err := p.pool.acquire(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return w, func() { p.pool.release(w) }, nil
+	}
+
+	p.acksMu.Lock()
+	defer p.acksMu.Unlock()
+	if p.acksWriters == nil {
+		p.acksWriters = make(map[int]*pooledWriter)
+	}
+	w, ok := p.acksWriters[acks]
+	if !ok {
+		// Without outcomes the writer is safe to share: kafka-go writers
+		// take concurrent writes
+		w = &pooledWriter{Writer: p.newAcksWriter(acks), label: "acks" + strconv.Itoa(acks)}
+		p.acksWriters[acks] = w
+	}
+	return w, func() {}, nil
+}
+
+// closeAcksWriters closes the writers of acks levels other than the
+// producer's
+func (p *Producer) closeAcksWriters() error {
+	p.acksMu.Lock()
+	defer p.acksMu.Unlock()
+
+	var errs []error
+	for acks, w := range p.acksWriters {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(p.acksWriters, acks)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,308 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// PinStoreKey is the StateStore key holding all tenants' partition pins, as a
+// versioned value (see state.Versioned)
+const PinStoreKey = "parsec:partition-pins"
+
+// ErrInvalidPartitionRange is returned for a range that doesn't start at
+// zero or above and end at or after its start
+var ErrInvalidPartitionRange = errors.New("invalid partition range")
+
+// PartitionRange is an inclusive range of partition numbers
+type PartitionRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// Validate checks the range is well formed
+func (r PartitionRange) Validate() error {
+	if r.First < 0 || r.Last < r.First {
+		return fmt.Errorf("%w: %d-%d", ErrInvalidPartitionRange, r.First, r.Last)
+	}
+	return nil
+}
+
+// contains reports whether the range includes partition
+func (r PartitionRange) contains(partition int) bool {
+	return r.First <= partition && partition <= r.Last
+}
+
+// TenantBalancer partitions messages by tenant (the message key). Pinned
+// tenants hash across their own partition range; every other tenant hashes
+// across the partitions no tenant is pinned to, so a noisy tenant can be
+// isolated from the shared partitions. Without pins it partitions exactly
+// as kafka.Hash does. Pins are shared across nodes via the StateStore.
+// A message with a partition header goes to that partition when the topic
+// has it and the tenant's pin (if any) allows it.
+type TenantBalancer struct {
+	stored *state.Versioned
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu   sync.RWMutex
+	pins map[string]PartitionRange
+
+	// keyless balances messages without a key, as kafka.Hash does
+	keyless kafka.RoundRobin
+}
+
+// NewTenantBalancer creates a balancer backed by the given store (may be nil)
+func NewTenantBalancer(store state.StateStore) *TenantBalancer {
+	b := &TenantBalancer{pins: make(map[string]PartitionRange)}
+	if store != nil {
+		b.stored = state.NewVersioned(store, PinStoreKey)
+	}
+	return b
+}
+
+// Balance implements kafka.Balancer
+func (b *TenantBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if target := header(msg, HeaderPartition); target != "" {
+		if partition, ok := b.override(string(msg.Key), target, partitions); ok {
+			return partition
+		}
+		metrics.KafkaPartitionOverrideMisses.WithLabelValues(msg.Topic).Inc()
+	}
+	if msg.Key == nil {
+		return b.keyless.Balance(msg, partitions...)
+	}
+	hash := fnv1a(msg.Key)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if pin, ok := b.pins[string(msg.Key)]; ok {
+		if partition, ok := pick(hash, partitions, pin.contains); ok {
+			return partition
+		}
+		// The topic has no partitions in the range (it may have fewer
+		// partitions than the one the pin was sized for)
+		metrics.KafkaPartitionPinMisses.WithLabelValues(string(msg.Key)).Inc()
+	} else if len(b.pins) > 0 {
+		if partition, ok := pick(hash, partitions, b.shared); ok {
+			return partition
+		}
+		// Pins cover every partition; share them all
+	}
+
+	partition, _ := pick(hash, partitions, nil)
+	return partition
+}
+
+// override returns the partition named by target, if the topic has it and
+// tenant's pin (if any) includes it
+func (b *TenantBalancer) override(tenant, target string, partitions []int) (int, bool) {
+	partition, err := strconv.Atoi(target)
+	if err != nil || !slices.Contains(partitions, partition) {
+		return 0, false
+	}
+	b.mu.RLock()
+	pin, pinned := b.pins[tenant]
+	b.mu.RUnlock()
+	if pinned && !pin.contains(partition) {
+		return 0, false
+	}
+	return partition, true
+}
+
+// shared reports whether no tenant is pinned to partition; the caller holds mu
+func (b *TenantBalancer) shared(partition int) bool {
+	for _, pin := range b.pins {
+		if pin.contains(partition) {
+			return false
+		}
+	}
+	return true
+}
+
+// pick hashes across the partitions accepted by include (all of them when
+// nil) without allocating, the way kafka.Hash does across all partitions.
+// It reports false when include accepts none.
+func pick(hash uint32, partitions []int, include func(int) bool) (int, bool) {
+	n := len(partitions)
+	if include != nil {
+		n = 0
+		for _, p := range partitions {
+			if include(p) {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+
+	index := int32(hash) % int32(n)
+	if index < 0 {
+		index = -index
+	}
+	for _, p := range partitions {
+		if include != nil && !include(p) {
+			continue
+		}
+		if index == 0 {
+			return p, true
+		}
+		index--
+	}
+	return 0, false
+}
+
+// fnv1a is the 32-bit FNV-1a hash kafka.Hash uses by default
+func fnv1a(key []byte) uint32 {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+	h := uint32(offset)
+	for _, c := range key {
+		h ^= uint32(c)
+		h *= prime
+	}
+	return h
+}
+
+// Pin returns a tenant's partition range, if pinned
+func (b *TenantBalancer) Pin(tenantID string) (PartitionRange, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	pin, ok := b.pins[tenantID]
+	return pin, ok
+}
+
+// Config returns every tenant's pin, for introspection
+func (b *TenantBalancer) Config() any {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	pins := make(map[string]PartitionRange, len(b.pins))
+	for tenantID, pin := range b.pins {
+		pins[tenantID] = pin
+	}
+	return pins
+}
+
+// SetPin validates and sets a tenant's partition range. A nil range unpins
+// the tenant.
+func (b *TenantBalancer) SetPin(ctx context.Context, tenantID string, pin *PartitionRange) error {
+	if pin != nil {
+		if err := pin.Validate(); err != nil {
+			return err
+		}
+	}
+
+	b.writing.Lock()
+	defer b.writing.Unlock()
+
+	apply := func(data []byte) (map[string]PartitionRange, error) {
+		current := make(map[string]PartitionRange)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse partition pins: %w", err)
+			}
+		} else {
+			b.mu.RLock()
+			for id, r := range b.pins {
+				current[id] = r
+			}
+			b.mu.RUnlock()
+		}
+		if pin == nil {
+			delete(current, tenantID)
+		} else {
+			current[tenantID] = *pin
+		}
+		return current, nil
+	}
+
+	var next map[string]PartitionRange
+	if b.stored == nil {
+		next, _ = apply(nil)
+	} else {
+		// Applied to the stored pins, again if another node changed them
+		// meanwhile, so every tenant's change is kept
+		err := b.stored.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if next, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(next)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.pins = next
+	b.mu.Unlock()
+	return nil
+}
+
+// Load replaces the in-memory pins with those in the store
+func (b *TenantBalancer) Load(ctx context.Context) error {
+	if b.stored == nil {
+		return nil
+	}
+
+	data, err := b.stored.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the pins set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	pins := make(map[string]PartitionRange)
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return fmt.Errorf("parse partition pins: %w", err)
+	}
+
+	b.mu.Lock()
+	b.pins = pins
+	b.mu.Unlock()
+	return nil
+}
+
+// Run reloads pins periodically so changes made on other nodes propagate
+func (b *TenantBalancer) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("kafka_balancer")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload partition pins")
+			}
+		}
+	}
+}
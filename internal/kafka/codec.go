@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/bus"
+	"parsec/internal/encryption"
+)
+
+// Envelope value encodings and headers, shared with every bus
+const (
+	HeaderContentEncoding = bus.HeaderContentEncoding
+	EncodingGzip          = bus.EncodingGzip
+	HeaderEncryptionKeyID = bus.HeaderEncryptionKeyID
+	HeaderPartition       = bus.HeaderPartition
+)
+
+// ErrEncrypted is returned when decoding an encrypted envelope without keys
+var ErrEncrypted = errors.New("envelope is encrypted")
+
+// DecodeValue returns the plain envelope bytes for a consumed message,
+// decompressing it if the producer marked it as compressed
+func DecodeValue(msg kafka.Message) ([]byte, error) {
+	if keyID := header(msg, HeaderEncryptionKeyID); keyID != "" {
+		return nil, fmt.Errorf("%w with key %s", ErrEncrypted, keyID)
+	}
+
+	switch encoding := header(msg, HeaderContentEncoding); encoding {
+	case "":
+		return msg.Value, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(msg.Value))
+		if err != nil {
+			return nil, fmt.Errorf("gzip envelope: %w", err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported envelope encoding %q", encoding)
+	}
+}
+
+// DecryptValue is DecodeValue for messages that may be encrypted; a nil
+// cipher only accepts plaintext messages
+func DecryptValue(ctx context.Context, msg kafka.Message, c *encryption.Cipher) ([]byte, error) {
+	keyID := header(msg, HeaderEncryptionKeyID)
+	if keyID == "" || c == nil {
+		return DecodeValue(msg)
+	}
+
+	plaintext, err := c.Open(ctx, keyID, header(msg, "tenant_id"), msg.Value)
+	if err != nil {
+		return nil, err
+	}
+	msg.Value = plaintext
+	msg.Headers = withoutHeader(msg.Headers, HeaderEncryptionKeyID)
+	return DecodeValue(msg)
+}
+
+// withoutHeader returns a copy of headers without key
+func withoutHeader(headers []kafka.Header, key string) []kafka.Header {
+	kept := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		if h.Key != key {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
@@ -4,55 +4,133 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"sync"
 
 	"github.com/segmentio/kafka-go"
 
 	"parsec/internal/config"
-	"parsec/internal/models"
+	"parsec/internal/encryption"
+	"parsec/internal/region"
+	"parsec/pkg/models"
 )
 
 // MessageHandler processes consumed messages
 type MessageHandler func(ctx context.Context, envelope *models.Envelope) error
 
+// BatchHandler processes consumed messages a fetch at a time, for bulk
+// inserts and windowed aggregation. The slice is not reused.
+type BatchHandler func(ctx context.Context, envelopes []*models.Envelope) error
+
+// Reader reads messages for a Consumer; *kafka.Reader implements it
+type Reader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 // Consumer is a Kafka consumer for processing log events
 type Consumer struct {
-	reader  *kafka.Reader
-	handler MessageHandler
-	cfg     config.ConsumerConfig
-	wg      sync.WaitGroup
-	cancel  context.CancelFunc
+	reader       Reader
+	handler      MessageHandler
+	batchHandler BatchHandler
+	cfg          config.ConsumerConfig
+	cipher       *encryption.Cipher
+	wg           sync.WaitGroup
+	cancel       context.CancelFunc
 }
 
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(brokers []string, topic string, cfg config.ConsumerConfig, handler MessageHandler) (*Consumer, error) {
-	if len(brokers) == 0 {
-		return nil, errors.New("at least one broker is required")
+	if handler == nil {
+		return nil, errors.New("handler is required")
 	}
 
-	if topic == "" {
-		return nil, errors.New("topic is required")
+	reader, err := newReader(brokers, topic, cfg)
+	if err != nil {
+		return nil, err
 	}
 
+	return &Consumer{
+		reader:  reader,
+		handler: handler,
+		cfg:     cfg,
+	}, nil
+}
+
+// NewBatchConsumer creates a Kafka consumer that hands the handler up to
+// cfg.BatchSize envelopes at a time: those already fetched, plus any that
+// arrive within cfg.BatchWait of the first. A batch's offsets are
+// committed once the handler returns. WithDedup and WithMiddleware don't
+// apply to batch handlers.
+func NewBatchConsumer(brokers []string, topic string, cfg config.ConsumerConfig, handler BatchHandler) (*Consumer, error) {
 	if handler == nil {
 		return nil, errors.New("handler is required")
 	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
+	reader, err := newReader(brokers, topic, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		reader:       reader,
+		batchHandler: handler,
+		cfg:          cfg,
+	}, nil
+}
+
+// newReader creates a kafka-go reader for the consumer group
+func newReader(brokers []string, topic string, cfg config.ConsumerConfig) (*kafka.Reader, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+
+	if topic == "" {
+		return nil, errors.New("topic is required")
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  brokers,
 		Topic:    topic,
 		GroupID:  cfg.GroupID,
 		MinBytes: cfg.MinBytes,
 		MaxBytes: cfg.MaxBytes,
 		MaxWait:  cfg.MaxWait,
-	})
+	}), nil
+}
 
-	return &Consumer{
-		reader:  reader,
-		handler: handler,
-		cfg:     cfg,
-	}, nil
+// WithReader reads from r instead of the brokers, closing the reader it
+// replaces
+func (c *Consumer) WithReader(r Reader) *Consumer {
+	c.reader.Close()
+	c.reader = r
+	return c
+}
+
+// WithCipher decrypts envelopes sealed for encrypted tenants
+func (c *Consumer) WithCipher(cipher *encryption.Cipher) *Consumer {
+	c.cipher = cipher
+	return c
+}
+
+// WithDedup drops envelopes already handled, such as the copy of an event
+// mirrored in from another region
+func (c *Consumer) WithDedup(d *region.Deduplicator) *Consumer {
+	c.handler = d.Wrap(c.handler)
+	return c
+}
+
+// WithMiddleware wraps the handler in middlewares, the first outermost.
+// Middleware added later wraps what was added before, dedup included.
+func (c *Consumer) WithMiddleware(middlewares ...HandlerMiddleware) *Consumer {
+	c.handler = ChainHandler(c.handler, middlewares...)
+	return c
 }
 
 // Start begins consuming messages
@@ -62,7 +140,11 @@ func (c *Consumer) Start(ctx context.Context) error {
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-		c.consumeLoop(ctx)
+		if c.batchHandler != nil {
+			c.consumeBatches(ctx)
+		} else {
+			c.consumeLoop(ctx)
+		}
 	}()
 
 	return nil
@@ -86,21 +168,100 @@ func (c *Consumer) consumeLoop(ctx context.Context) {
 			continue
 		}
 
-		// Deserialize envelope
-		var envelope models.Envelope
-		if err := json.Unmarshal(msg.Value, &envelope); err != nil {
-			log.Printf("error deserializing message: %v", err)
+		envelope, err := c.decode(ctx, msg)
+		if err != nil {
+			log.Printf("error decoding message: %v", err)
 			continue
 		}
 
 		// Process message
-		if err := c.handler(ctx, &envelope); err != nil {
+		if err := c.handler(ctx, envelope); err != nil {
+			// DeadLetterHandler middleware keeps failures off this path
 			log.Printf("error handling message %s: %v", envelope.Event.ID, err)
-			// Could implement dead-letter queue here
 		}
 	}
 }
 
+// consumeBatches fetches, handles and commits batches of messages
+func (c *Consumer) consumeBatches(ctx context.Context) {
+	for {
+		msgs, envelopes := c.fetchBatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+
+		if len(envelopes) > 0 {
+			if err := c.batchHandler(ctx, envelopes); err != nil {
+				log.Printf("error handling batch of %d messages: %v", len(envelopes), err)
+			}
+		}
+		// Undecodable messages are committed with the rest; redelivery
+		// wouldn't fix them
+		if err := c.reader.CommitMessages(ctx, msgs...); err != nil && ctx.Err() == nil {
+			log.Printf("error committing batch offsets: %v", err)
+		}
+	}
+}
+
+// fetchBatch waits for a message, then takes those that follow until the
+// batch is full or BatchWait has passed. It returns every message fetched
+// and the envelopes of those that decoded.
+func (c *Consumer) fetchBatch(ctx context.Context) ([]kafka.Message, []*models.Envelope) {
+	msg, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("error fetching message: %v", err)
+		}
+		return nil, nil
+	}
+
+	msgs := make([]kafka.Message, 0, c.cfg.BatchSize)
+	envelopes := make([]*models.Envelope, 0, c.cfg.BatchSize)
+	add := func(msg kafka.Message) {
+		msgs = append(msgs, msg)
+		envelope, err := c.decode(ctx, msg)
+		if err != nil {
+			log.Printf("error decoding message: %v", err)
+			return
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	add(msg)
+
+	waitCtx, cancel := context.WithTimeout(ctx, c.cfg.BatchWait)
+	defer cancel()
+	for len(msgs) < c.cfg.BatchSize {
+		msg, err := c.reader.FetchMessage(waitCtx)
+		if err != nil {
+			break
+		}
+		add(msg)
+	}
+	return msgs, envelopes
+}
+
+// decode decodes a message with the consumer's cipher
+func (c *Consumer) decode(ctx context.Context, msg kafka.Message) (*models.Envelope, error) {
+	return decodeEnvelope(ctx, msg, c.cipher)
+}
+
+// decodeEnvelope decrypts, decompresses and deserializes a message's envelope
+func decodeEnvelope(ctx context.Context, msg kafka.Message, cipher *encryption.Cipher) (*models.Envelope, error) {
+	value, err := DecryptValue(ctx, msg, cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope models.Envelope
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return nil, fmt.Errorf("deserialize envelope: %w", err)
+	}
+	return &envelope, nil
+}
+
 // Stop stops the consumer
 func (c *Consumer) Stop() error {
 	if c.cancel != nil {
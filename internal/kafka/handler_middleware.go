@@ -0,0 +1,205 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/bus"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// HandlerMiddleware wraps a MessageHandler, as HTTP middleware wraps an
+// http.Handler
+type HandlerMiddleware func(MessageHandler) MessageHandler
+
+// ChainHandler applies middlewares in order; the first is outermost
+func ChainHandler(h MessageHandler, middlewares ...HandlerMiddleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultHandlerMiddleware is the chain most handlers want: recover
+// panics, attach trace context, then log and measure every envelope
+func DefaultHandlerMiddleware() []HandlerMiddleware {
+	return []HandlerMiddleware{RecoverHandler, TraceHandler, LogHandler, MeasureHandler}
+}
+
+// RecoverHandler turns a handler panic into an error, so one bad envelope
+// doesn't stop the consumer
+func RecoverHandler(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log := logger.WithComponent("kafka_consumer")
+				log.Error().
+					Interface("panic", r).
+					Str("stack", string(debug.Stack())).
+					Str("event_id", envelope.Event.ID).
+					Msg("handler panic recovered")
+				metrics.PanicsRecovered.WithLabelValues("consumer_handler").Inc()
+				err = fmt.Errorf("handler panic: %v", r)
+			}
+		}()
+		return next(ctx, envelope)
+	}
+}
+
+// TraceHandler puts a logger carrying the envelope's event, tenant and
+// trace IDs in the context; handlers log through zerolog.Ctx(ctx)
+func TraceHandler(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		event := envelope.Event
+		fields := logger.WithComponent("kafka_consumer").With().
+			Str("event_id", event.ID).
+			Str("tenant_id", event.TenantID)
+		if event.TraceID != "" {
+			fields = fields.Str("trace_id", event.TraceID)
+		}
+		if event.SpanID != "" {
+			fields = fields.Str("span_id", event.SpanID)
+		}
+		log := fields.Logger()
+		return next(log.WithContext(ctx), envelope)
+	}
+}
+
+// LogHandler logs each envelope's outcome, through the context's logger
+// when TraceHandler set one
+func LogHandler(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		start := time.Now()
+		err := next(ctx, envelope)
+		duration := time.Since(start)
+
+		log := zerolog.Ctx(ctx)
+		if log.GetLevel() == zerolog.Disabled {
+			l := logger.WithComponent("kafka_consumer").With().Str("event_id", envelope.Event.ID).Logger()
+			log = &l
+		}
+		if err != nil {
+			log.Error().Err(err).Dur("duration", duration).Msg("failed to handle envelope")
+		} else {
+			log.Debug().Dur("duration", duration).Msg("envelope handled")
+		}
+		return err
+	}
+}
+
+// MeasureHandler counts envelopes by outcome and times the handler
+func MeasureHandler(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		start := time.Now()
+		err := next(ctx, envelope)
+		metrics.ConsumerHandleDuration.Observe(time.Since(start).Seconds())
+
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		metrics.ConsumerHandledTotal.WithLabelValues(result).Inc()
+		return err
+	}
+}
+
+// TimingsHandler stamps envelopes as persisted once the handler stores
+// them and records how long they took to reach each stage. Add it last, so
+// it wraps the storage handler itself. Stages are timed across nodes, so
+// clock skew between them shows up in the stages that cross nodes.
+func TimingsHandler(next MessageHandler) MessageHandler {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		if err := next(ctx, envelope); err != nil {
+			return err
+		}
+
+		timings := &envelope.Timings
+		timings.Persisted = time.Now().UTC()
+		for stage, d := range timings.Stages() {
+			metrics.EnvelopeStageDuration.WithLabelValues(stage).Observe(d.Seconds())
+		}
+		if !timings.Received.IsZero() {
+			metrics.EnvelopeStageDuration.WithLabelValues("total").Observe(max(timings.Persisted.Sub(timings.Received), 0).Seconds())
+		}
+		return nil
+	}
+}
+
+// RetryHandler retries a failing handler up to attempts times in all,
+// doubling backoff between attempts. Errors wrapped with bus.Permanent and
+// context cancellation are not retried.
+func RetryHandler(attempts int, backoff time.Duration) HandlerMiddleware {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, envelope *models.Envelope) error {
+			wait := backoff
+			var err error
+			for attempt := 0; attempt < attempts; attempt++ {
+				if attempt > 0 {
+					metrics.ConsumerRetries.Inc()
+					select {
+					case <-time.After(wait):
+						wait *= 2
+					case <-ctx.Done():
+						return errors.Join(err, ctx.Err())
+					}
+				}
+
+				err = next(ctx, envelope)
+				var permanent *bus.PermanentError
+				if err == nil || errors.As(err, &permanent) || ctx.Err() != nil {
+					return err
+				}
+				envelope.RetryCount++
+			}
+			return err
+		}
+	}
+}
+
+// DeadLetterPublisher publishes envelopes a handler gave up on
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, envelope *models.Envelope) error
+}
+
+// DeadLetterHandler publishes envelopes the handler fails on to topic,
+// with the original topic and error in the bus.HeaderDLQTopic and
+// bus.HeaderDLQError metadata keys, and reports them handled. An envelope
+// that can't be dead-lettered returns both errors.
+func DeadLetterHandler(publisher DeadLetterPublisher, topic string) HandlerMiddleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, envelope *models.Envelope) error {
+			err := next(ctx, envelope)
+			if err == nil {
+				return nil
+			}
+
+			letter := *envelope
+			event := *envelope.Event
+			event.Metadata = make(models.Metadata, len(envelope.Event.Metadata)+2)
+			for k, v := range envelope.Event.Metadata {
+				event.Metadata[k] = v
+			}
+			event.Metadata[bus.HeaderDLQTopic] = envelope.Topic
+			event.Metadata[bus.HeaderDLQError] = err.Error()
+			letter.Event = &event
+			letter.Topic = topic
+
+			if dlqErr := publisher.Publish(context.WithoutCancel(ctx), &letter); dlqErr != nil {
+				metrics.ConsumerDeadLettered.WithLabelValues("error").Inc()
+				return errors.Join(err, fmt.Errorf("dead-letter publish: %w", dlqErr))
+			}
+			metrics.ConsumerDeadLettered.WithLabelValues("success").Inc()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/pkg/models"
+)
+
+// Interceptor hooks into every message the producer publishes, so
+// cross-cutting concerns (header stamping, audit sampling, latency
+// tracing) don't need changes to the producer itself
+type Interceptor interface {
+	// BeforePublish runs after the envelope is encoded, before the message
+	// is shaped and written. It may modify the message (headers, say); an
+	// error fails the message without publishing it.
+	BeforePublish(ctx context.Context, envelope *models.Envelope, msg *kafka.Message) error
+
+	// AfterPublish runs once the write of a message BeforePublish accepted
+	// has succeeded or failed
+	AfterPublish(ctx context.Context, result PublishResult)
+}
+
+// PublishResult is the outcome of publishing one message
+type PublishResult struct {
+	Envelope *models.Envelope
+	Message  kafka.Message
+
+	// Err is nil when the message was written
+	Err error
+
+	// Duration is from the start of the publish call until the write (with
+	// retries) completed, shared by every message of a batch
+	Duration time.Duration
+}
+
+// WithInterceptors adds interceptors to the producer. BeforePublish hooks
+// run in the order given and AfterPublish hooks in reverse, so the first
+// interceptor wraps the others.
+func WithInterceptors(interceptors ...Interceptor) ProducerOption {
+	return func(p *Producer) {
+		p.interceptors = append(p.interceptors, interceptors...)
+	}
+}
+
+// beforePublish runs the BeforePublish hooks, stopping at the first error.
+// A message a hook rejects gets no AfterPublish calls.
+func (p *Producer) beforePublish(ctx context.Context, envelope *models.Envelope, msg *kafka.Message) error {
+	for _, i := range p.interceptors {
+		if err := i.BeforePublish(ctx, envelope, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterPublish runs the AfterPublish hooks for each message
+func (p *Producer) afterPublish(ctx context.Context, start time.Time, err error, envelopes []*models.Envelope, messages []kafka.Message) {
+	if len(p.interceptors) == 0 {
+		return
+	}
+	duration := time.Since(start)
+	for n := range messages {
+		result := PublishResult{
+			Envelope: envelopes[n],
+			Message:  messages[n],
+			Err:      err,
+			Duration: duration,
+		}
+		for i := len(p.interceptors) - 1; i >= 0; i-- {
+			p.interceptors[i].AfterPublish(ctx, result)
+		}
+	}
+}
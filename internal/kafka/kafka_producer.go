@@ -2,35 +2,50 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/compress"
 
+	"parsec/internal/bus"
 	"parsec/internal/config"
+	"parsec/internal/encryption"
+	"parsec/internal/flags"
 	"parsec/internal/logger"
 	"parsec/internal/metrics"
-	"parsec/internal/models"
+	"parsec/pkg/models"
 )
 
 // Producer errors
 var (
 	ErrProducerClosed  = errors.New("producer is closed")
 	ErrPublishTimeout  = errors.New("publish timeout")
-	ErrSerializeFailed = errors.New("failed to serialize message")
+	ErrSerializeFailed = bus.ErrSerializeFailed
 )
 
 // Producer is a Kafka producer with connection pooling, retry, and batching
 type Producer struct {
-	cfg     config.ProducerConfig
-	topic   string
-	writers []*kafka.Writer
-	pool    chan *kafka.Writer
-	closed  atomic.Bool
+	cfg       config.ProducerConfig
+	topic     string
+	pool      *writerPool
+	newWriter func() Writer
+	closed    atomic.Bool
+	encoder   bus.Encoder
+	shaper    *Shaper
+	balancer  kafka.Balancer
+
+	// newAcksWriter creates the writers of envelopes asking for other acks
+	// than cfg.RequiredAcks, one per level
+	newAcksWriter func(acks int) Writer
+	acksMu        sync.Mutex
+	acksWriters   map[int]*pooledWriter
+
+	// interceptors hook into each message published
+	interceptors []Interceptor
 
 	// Metrics
 	messagesSent   atomic.Uint64
@@ -41,6 +56,44 @@ type Producer struct {
 // ProducerOption is a functional option for configuring the producer
 type ProducerOption func(*Producer)
 
+// WithFlags gates per-envelope compression on the envelope_compression flag
+// for each tenant. Without it, compression applies to every tenant.
+func WithFlags(m *flags.Manager) ProducerOption {
+	return func(p *Producer) {
+		p.encoder.Flags = m
+	}
+}
+
+// WithShaper rate-limits writes through the given shaper
+func WithShaper(s *Shaper) ProducerOption {
+	return func(p *Producer) {
+		p.shaper = s
+	}
+}
+
+// WithBalancer assigns messages to partitions with the given balancer
+// instead of hashing the key across all partitions
+func WithBalancer(b kafka.Balancer) ProducerOption {
+	return func(p *Producer) {
+		p.balancer = b
+	}
+}
+
+// WithEncryption seals envelopes of tenants with a key in the cipher's keyring
+func WithEncryption(c *encryption.Cipher) ProducerOption {
+	return func(p *Producer) {
+		p.encoder.Cipher = c
+	}
+}
+
+// WithWriterFactory creates the pool's writers with newWriter instead of
+// kafka-go writers for the configured brokers
+func WithWriterFactory(newWriter func() Writer) ProducerOption {
+	return func(p *Producer) {
+		p.newWriter = newWriter
+	}
+}
+
 // NewProducer creates a new Kafka producer with the given configuration
 func NewProducer(brokers []string, topic string, cfg config.ProducerConfig, opts ...ProducerOption) (*Producer, error) {
 	if len(brokers) == 0 {
@@ -56,10 +109,12 @@ func NewProducer(brokers []string, topic string, cfg config.ProducerConfig, opts
 	}
 
 	p := &Producer{
-		cfg:     cfg,
-		topic:   topic,
-		writers: make([]*kafka.Writer, cfg.PoolSize),
-		pool:    make(chan *kafka.Writer, cfg.PoolSize),
+		cfg:   cfg,
+		topic: topic,
+		encoder: bus.Encoder{
+			Topic:             topic,
+			CompressThreshold: cfg.EnvelopeCompressThreshold,
+		},
 	}
 
 	// Apply options
@@ -67,27 +122,39 @@ func NewProducer(brokers []string, topic string, cfg config.ProducerConfig, opts
 		opt(p)
 	}
 
-	// Get compression codec
-	compression := getCompression(cfg.Compression)
+	if p.newWriter == nil {
+		// Get compression codec
+		compression := getCompression(cfg.Compression)
 
-	// Create writer pool
-	for i := 0; i < cfg.PoolSize; i++ {
-		writer := &kafka.Writer{
-			Addr:         kafka.TCP(brokers...),
-			Topic:        topic,
-			Balancer:     &kafka.Hash{}, // Partition by key
-			BatchSize:    cfg.BatchSize,
-			BatchTimeout: cfg.BatchTimeout,
-			WriteTimeout: cfg.WriteTimeout,
-			RequiredAcks: kafka.RequiredAcks(cfg.RequiredAcks),
-			Compression:  compression,
-			MaxAttempts:  cfg.MaxRetries + 1,
-			Async:        false, // Sync for reliability
+		balancer := p.balancer
+		if balancer == nil {
+			balancer = &kafka.Hash{} // Partition by key
 		}
-		p.writers[i] = writer
-		p.pool <- writer
+
+		p.newAcksWriter = func(acks int) Writer {
+			// Topic is set per message so routing rules can redirect envelopes
+			return &kafka.Writer{
+				Addr:         kafka.TCP(brokers...),
+				Balancer:     balancer,
+				BatchSize:    cfg.BatchSize,
+				BatchTimeout: cfg.BatchTimeout,
+				WriteTimeout: cfg.WriteTimeout,
+				RequiredAcks: kafka.RequiredAcks(acks),
+				Compression:  compression,
+				MaxAttempts:  cfg.MaxRetries + 1,
+				Async:        false, // Sync for reliability
+			}
+		}
+		p.newWriter = func() Writer {
+			return p.newAcksWriter(cfg.RequiredAcks)
+		}
+	} else {
+		p.newAcksWriter = func(int) Writer { return p.newWriter() }
 	}
 
+	// Create writer pool
+	p.pool = newWriterPool(cfg, p.newWriter)
+
 	return p, nil
 }
 
@@ -108,39 +175,37 @@ func getCompression(name string) compress.Compression {
 }
 
 // Publish sends an envelope to Kafka
-func (p *Producer) Publish(ctx context.Context, envelope *models.Envelope) error {
+func (p *Producer) Publish(ctx context.Context, envelope *models.Envelope) (err error) {
 	if p.closed.Load() {
 		return ErrProducerClosed
 	}
+	start := time.Now()
 
-	// Serialize envelope to JSON
-	data, err := json.Marshal(envelope)
+	// Serialize envelope into a Kafka message
+	msg, err := p.buildMessage(ctx, envelope)
 	if err != nil {
 		p.messagesFailed.Add(1)
-		return fmt.Errorf("%w: %v", ErrSerializeFailed, err)
+		return err
 	}
+	defer func() {
+		if len(p.interceptors) > 0 {
+			p.afterPublish(ctx, start, err, []*models.Envelope{envelope}, []kafka.Message{msg})
+		}
+	}()
 
-	// Create Kafka message
-	msg := kafka.Message{
-		Key:   []byte(envelope.PartitionKey), // Partition by tenant
-		Value: data,
-		Headers: []kafka.Header{
-			{Key: "tenant_id", Value: []byte(envelope.Event.TenantID)},
-			{Key: "event_id", Value: []byte(envelope.Event.ID)},
-			{Key: "ingest_node", Value: []byte(envelope.IngestNode)},
-		},
-		Time: envelope.ReceivedAt,
+	// Hold back if over the configured write rate
+	if err := p.shape(ctx, 1, len(msg.Value)); err != nil {
+		p.messagesFailed.Add(1)
+		return err
 	}
 
 	// Get writer from pool with timeout
-	var writer *kafka.Writer
-	select {
-	case writer = <-p.pool:
-		defer func() { p.pool <- writer }()
-	case <-ctx.Done():
+	writer, release, err := p.acquire(ctx, envelope.Acks)
+	if err != nil {
 		p.messagesFailed.Add(1)
-		return ctx.Err()
+		return err
 	}
+	defer release()
 
 	// Publish with retries
 	err = p.publishWithRetry(ctx, writer, msg)
@@ -150,12 +215,12 @@ func (p *Producer) Publish(ctx context.Context, envelope *models.Envelope) error
 	}
 
 	p.messagesSent.Add(1)
-	p.bytesWritten.Add(uint64(len(data)))
+	p.bytesWritten.Add(uint64(len(msg.Value)))
 	return nil
 }
 
 // PublishBatch sends multiple envelopes to Kafka in a single batch
-func (p *Producer) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+func (p *Producer) PublishBatch(ctx context.Context, envelopes []*models.Envelope) (err error) {
 	if p.closed.Load() {
 		return ErrProducerClosed
 	}
@@ -167,10 +232,13 @@ func (p *Producer) PublishBatch(ctx context.Context, envelopes []*models.Envelop
 	log := logger.WithComponent("kafka_producer")
 	start := time.Now()
 
-	// Convert envelopes to messages
+	// Convert envelopes to messages, keeping the envelopes of those built
+	// for the interceptors
 	messages := make([]kafka.Message, 0, len(envelopes))
+	var built []*models.Envelope
+	var levels []string
 	for _, envelope := range envelopes {
-		data, err := json.Marshal(envelope)
+		msg, err := p.buildMessage(ctx, envelope)
 		if err != nil {
 			log.Error().
 				Err(err).
@@ -181,42 +249,71 @@ func (p *Producer) PublishBatch(ctx context.Context, envelopes []*models.Envelop
 			metrics.KafkaPublishTotal.WithLabelValues("failed").Inc()
 			continue
 		}
-
-		msg := kafka.Message{
-			Key:   []byte(envelope.PartitionKey),
-			Value: data,
-			Headers: []kafka.Header{
-				{Key: "tenant_id", Value: []byte(envelope.Event.TenantID)},
-				{Key: "event_id", Value: []byte(envelope.Event.ID)},
-				{Key: "ingest_node", Value: []byte(envelope.IngestNode)},
-			},
-			Time: envelope.ReceivedAt,
-		}
 		messages = append(messages, msg)
+		if len(p.interceptors) > 0 {
+			built = append(built, envelope)
+		}
+		// Levels are only tracked once an envelope asks for one
+		if envelope.Acks != "" && levels == nil {
+			levels = make([]string, len(messages)-1, len(envelopes))
+		}
+		if levels != nil {
+			levels = append(levels, envelope.Acks)
+		}
 	}
 
 	if len(messages) == 0 {
 		return nil
 	}
+	defer func() { p.afterPublish(ctx, start, err, built, messages) }()
+
+	bytesTotal := uint64(0)
+	for _, msg := range messages {
+		bytesTotal += uint64(len(msg.Value))
+	}
+
+	// Hold back if over the configured write rate
+	if err := p.shape(ctx, len(messages), int(bytesTotal)); err != nil {
+		p.messagesFailed.Add(uint64(len(messages)))
+		return err
+	}
+
+	// Envelopes asking for other acks go through their own writers
+	for _, group := range p.groupByAcks(levels, messages) {
+		if groupErr := p.writeBatch(ctx, group.level, group.messages); groupErr != nil {
+			err = errors.Join(err, groupErr)
+		}
+	}
+	return err
+}
+
+// writeBatch publishes messages with an acks level ("" = the producer's)
+func (p *Producer) writeBatch(ctx context.Context, level string, messages []kafka.Message) error {
+	log := logger.WithComponent("kafka_producer")
+	start := time.Now()
+
+	bytesTotal := uint64(0)
+	for _, msg := range messages {
+		bytesTotal += uint64(len(msg.Value))
+	}
 
 	// Get writer from pool
-	var writer *kafka.Writer
-	select {
-	case writer = <-p.pool:
-		defer func() { p.pool <- writer }()
-	case <-ctx.Done():
+	writer, release, err := p.acquire(ctx, level)
+	if err != nil {
 		p.messagesFailed.Add(uint64(len(messages)))
-		return ctx.Err()
+		return err
 	}
+	defer release()
 
 	// Publish batch with retries
-	err := p.publishBatchWithRetry(ctx, writer, messages)
+	err = p.publishBatchWithRetry(ctx, writer, messages)
 	duration := time.Since(start)
 
-	metrics.KafkaPublishDuration.Observe(duration.Seconds())
+	metrics.KafkaPublishDuration.WithLabelValues(writer.label).Observe(duration.Seconds())
 
 	if err != nil {
 		log.Error().
+			Ctx(ctx).
 			Err(err).
 			Int("batch_size", len(messages)).
 			Dur("duration", duration).
@@ -234,18 +331,45 @@ func (p *Producer) PublishBatch(ctx context.Context, envelopes []*models.Envelop
 	p.messagesSent.Add(uint64(len(messages)))
 	metrics.KafkaPublishTotal.WithLabelValues("success").Add(float64(len(messages)))
 
-	bytesTotal := uint64(0)
-	for _, msg := range messages {
-		bytesTotal += uint64(len(msg.Value))
-	}
 	p.bytesWritten.Add(bytesTotal)
 	metrics.KafkaBytesWritten.Add(float64(bytesTotal))
 
 	return nil
 }
 
+// shape waits for the shaper, if any
+func (p *Producer) shape(ctx context.Context, messages, bytes int) error {
+	if p.shaper == nil {
+		return nil
+	}
+	return p.shaper.Wait(ctx, messages, bytes)
+}
+
+// buildMessage encodes an envelope into a Kafka message
+func (p *Producer) buildMessage(ctx context.Context, envelope *models.Envelope) (kafka.Message, error) {
+	m, err := p.encoder.Encode(ctx, envelope)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	msg := kafka.Message{
+		Topic:   m.Topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: make([]kafka.Header, len(m.Headers)),
+		Time:    m.Time,
+	}
+	for i, h := range m.Headers {
+		msg.Headers[i] = kafka.Header{Key: h.Key, Value: h.Value}
+	}
+	if err := p.beforePublish(ctx, envelope, &msg); err != nil {
+		return kafka.Message{}, err
+	}
+	return msg, nil
+}
+
 // publishWithRetry publishes a single message with exponential backoff retry
-func (p *Producer) publishWithRetry(ctx context.Context, writer *kafka.Writer, msg kafka.Message) error {
+func (p *Producer) publishWithRetry(ctx context.Context, writer *pooledWriter, msg kafka.Message) error {
 	log := logger.WithComponent("kafka_producer")
 	var lastErr error
 	backoff := p.cfg.RetryBackoff
@@ -267,7 +391,7 @@ func (p *Producer) publishWithRetry(ctx context.Context, writer *kafka.Writer, m
 			}
 		}
 
-		err := writer.WriteMessages(ctx, msg)
+		err := writer.write(ctx, msg)
 		if err == nil {
 			return nil
 		}
@@ -293,7 +417,7 @@ func (p *Producer) publishWithRetry(ctx context.Context, writer *kafka.Writer, m
 }
 
 // publishBatchWithRetry publishes a batch of messages with exponential backoff retry
-func (p *Producer) publishBatchWithRetry(ctx context.Context, writer *kafka.Writer, messages []kafka.Message) error {
+func (p *Producer) publishBatchWithRetry(ctx context.Context, writer *pooledWriter, messages []kafka.Message) error {
 	log := logger.WithComponent("kafka_producer")
 	var lastErr error
 	backoff := p.cfg.RetryBackoff
@@ -316,7 +440,7 @@ func (p *Producer) publishBatchWithRetry(ctx context.Context, writer *kafka.Writ
 			}
 		}
 
-		err := writer.WriteMessages(ctx, messages...)
+		err := writer.write(ctx, messages...)
 		if err == nil {
 			return nil
 		}
@@ -348,22 +472,15 @@ func (p *Producer) Close() error {
 		return nil // Already closed
 	}
 
-	var errs []error
-	for _, writer := range p.writers {
-		if err := writer.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("errors closing writers: %v", errs)
+	if err := errors.Join(p.pool.close(), p.closeAcksWriters()); err != nil {
+		return fmt.Errorf("errors closing writers: %w", err)
 	}
 	return nil
 }
 
 // Stats returns producer statistics
-func (p *Producer) Stats() ProducerStats {
-	return ProducerStats{
+func (p *Producer) Stats() bus.Stats {
+	return bus.Stats{
 		MessagesSent:   p.messagesSent.Load(),
 		MessagesFailed: p.messagesFailed.Load(),
 		BytesWritten:   p.bytesWritten.Load(),
@@ -371,11 +488,7 @@ func (p *Producer) Stats() ProducerStats {
 }
 
 // ProducerStats holds producer metrics
-type ProducerStats struct {
-	MessagesSent   uint64
-	MessagesFailed uint64
-	BytesWritten   uint64
-}
+type ProducerStats = bus.Stats
 
 // HealthCheck verifies the producer can connect to Kafka
 func (p *Producer) HealthCheck(ctx context.Context) error {
@@ -384,15 +497,25 @@ func (p *Producer) HealthCheck(ctx context.Context) error {
 	}
 
 	// Get a writer from pool
-	var writer *kafka.Writer
-	select {
-	case writer = <-p.pool:
-		defer func() { p.pool <- writer }()
-	case <-ctx.Done():
-		return ctx.Err()
+	writer, err := p.pool.acquire(ctx)
+	if err != nil {
+		return err
 	}
+	defer p.pool.release(writer)
 
 	// Try to get writer stats (this doesn't actually write)
-	_ = writer.Stats()
+	if w, ok := writer.Writer.(*kafka.Writer); ok {
+		_ = w.Stats()
+	}
 	return nil
 }
+
+// PoolSize returns the current number of writers
+func (p *Producer) PoolSize() int {
+	return p.pool.size()
+}
+
+// WriterStats reports each pooled writer's use
+func (p *Producer) WriterStats() []WriterStats {
+	return p.pool.stats()
+}
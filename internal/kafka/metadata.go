@@ -0,0 +1,258 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// TopicMetadata is a topic's partition layout as last fetched
+type TopicMetadata struct {
+	Topic      string `json:"topic"`
+	Partitions int    `json:"partitions"`
+
+	// Leaders counts the partitions each broker leads, by broker ID
+	Leaders []BrokerLeaders `json:"leaders"`
+
+	// LeaderImbalance is the most partitions one broker leads over an
+	// even share across the brokers holding replicas (1 = balanced)
+	LeaderImbalance float64 `json:"leader_imbalance"`
+
+	// UnderReplicated counts partitions with replicas out of sync
+	UnderReplicated int `json:"under_replicated"`
+
+	FetchedAt time.Time `json:"fetched_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// BrokerLeaders is how many of a topic's partitions a broker leads
+type BrokerLeaders struct {
+	Broker     int    `json:"broker"`
+	Host       string `json:"host"`
+	Partitions int    `json:"partitions"`
+}
+
+// Warnings describes what is wrong with the layout for a producer with
+// concurrency parallel writers: fewer partitions than writers leaves some
+// idle behind the same leaders, and imbalanced leaders load one broker
+func (m TopicMetadata) Warnings(concurrency int, maxImbalance float64) []string {
+	if m.Partitions == 0 {
+		return nil
+	}
+	var warnings []string
+	if m.Partitions < concurrency {
+		warnings = append(warnings, fmt.Sprintf("%d partitions for %d concurrent writers", m.Partitions, concurrency))
+	}
+	if maxImbalance > 0 && m.LeaderImbalance > maxImbalance {
+		warnings = append(warnings, fmt.Sprintf("leaders imbalanced %.2fx across %d brokers", m.LeaderImbalance, len(m.Leaders)))
+	}
+	if m.UnderReplicated > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d under-replicated partitions", m.UnderReplicated))
+	}
+	return warnings
+}
+
+// MetadataFetcher reads the partitions of topics
+type MetadataFetcher func(ctx context.Context, topics []string) ([]kafka.Partition, error)
+
+// MetadataCache keeps the partition layout of topics, refreshed
+// periodically so reading it never waits on the brokers
+type MetadataCache struct {
+	topics []string
+	fetch  MetadataFetcher
+
+	mu   sync.RWMutex
+	meta map[string]TopicMetadata
+}
+
+// NewMetadataCache creates a cache for topics (duplicates and empty names
+// are ignored), read from the first reachable broker
+func NewMetadataCache(brokers []string, topics ...string) *MetadataCache {
+	return &MetadataCache{
+		topics: uniqueTopics(topics),
+		fetch: func(ctx context.Context, topics []string) ([]kafka.Partition, error) {
+			return readPartitions(ctx, brokers, topics)
+		},
+		meta: make(map[string]TopicMetadata),
+	}
+}
+
+// WithFetcher reads metadata through f instead of the brokers
+func (c *MetadataCache) WithFetcher(f MetadataFetcher) *MetadataCache {
+	c.fetch = f
+	return c
+}
+
+// readPartitions reads topics' partitions, trying each broker in turn
+func readPartitions(ctx context.Context, brokers []string, topics []string) ([]kafka.Partition, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		partitions, err := conn.ReadPartitions(topics...)
+		conn.Close()
+		if err == nil {
+			return partitions, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Refresh fetches the topics' metadata and updates the gauges. A topic
+// that can't be read keeps its last layout with the error recorded.
+func (c *MetadataCache) Refresh(ctx context.Context) error {
+	partitions, err := c.fetch(ctx, c.topics)
+	now := time.Now().UTC()
+
+	byTopic := make(map[string][]kafka.Partition)
+	for _, p := range partitions {
+		byTopic[p.Topic] = append(byTopic[p.Topic], p)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range c.topics {
+		if err != nil {
+			m := c.meta[topic]
+			m.Topic, m.Error = topic, err.Error()
+			c.meta[topic] = m
+			continue
+		}
+		m := layout(topic, byTopic[topic], now)
+		c.meta[topic] = m
+
+		metrics.KafkaTopicPartitions.WithLabelValues(topic).Set(float64(m.Partitions))
+		metrics.KafkaTopicLeaderImbalance.WithLabelValues(topic).Set(m.LeaderImbalance)
+		metrics.KafkaTopicUnderReplicated.WithLabelValues(topic).Set(float64(m.UnderReplicated))
+		metrics.KafkaTopicLeaders.DeletePartialMatch(map[string]string{"topic": topic})
+		for _, l := range m.Leaders {
+			metrics.KafkaTopicLeaders.WithLabelValues(topic, strconv.Itoa(l.Broker)).Set(float64(l.Partitions))
+		}
+	}
+	return err
+}
+
+// layout summarizes a topic's partitions
+func layout(topic string, partitions []kafka.Partition, now time.Time) TopicMetadata {
+	m := TopicMetadata{Topic: topic, Partitions: len(partitions), FetchedAt: now, Leaders: []BrokerLeaders{}}
+	if len(partitions) == 0 {
+		m.Error = "topic not found"
+		return m
+	}
+
+	leaders := make(map[int]*BrokerLeaders)
+	brokers := make(map[int]bool)
+	for _, p := range partitions {
+		l, ok := leaders[p.Leader.ID]
+		if !ok {
+			l = &BrokerLeaders{Broker: p.Leader.ID, Host: p.Leader.Host}
+			leaders[p.Leader.ID] = l
+		}
+		l.Partitions++
+		brokers[p.Leader.ID] = true
+		for _, r := range p.Replicas {
+			brokers[r.ID] = true
+		}
+		if len(p.Isr) < len(p.Replicas) {
+			m.UnderReplicated++
+		}
+	}
+
+	most := 0
+	for _, l := range leaders {
+		m.Leaders = append(m.Leaders, *l)
+		most = max(most, l.Partitions)
+	}
+	sort.Slice(m.Leaders, func(i, j int) bool { return m.Leaders[i].Broker < m.Leaders[j].Broker })
+
+	// An even share can't go below one partition per broker
+	even := max(float64(len(partitions))/float64(len(brokers)), 1)
+	m.LeaderImbalance = float64(most) / even
+	return m
+}
+
+// Topics returns the cached metadata, sorted by topic
+func (c *MetadataCache) Topics() []TopicMetadata {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]TopicMetadata, 0, len(c.meta))
+	for _, m := range c.meta {
+		topics = append(topics, m)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	return topics
+}
+
+// Partitions returns the topic's partition count as last fetched (0 if
+// never fetched)
+func (c *MetadataCache) Partitions(topic string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.meta[topic].Partitions
+}
+
+// Run refreshes the metadata every interval until ctx is cancelled,
+// logging a topic's warnings for a producer with concurrency writers
+// whenever they change
+func (c *MetadataCache) Run(ctx context.Context, interval time.Duration, concurrency int, maxImbalance float64) {
+	log := logger.WithComponent("kafka_metadata")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	warned := make(map[string]string)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		refreshCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := c.Refresh(refreshCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("failed to refresh topic metadata")
+		}
+
+		for _, m := range c.Topics() {
+			if m.Error != "" {
+				continue
+			}
+			warnings := m.Warnings(concurrency, maxImbalance)
+			summary := fmt.Sprint(warnings)
+			if summary == warned[m.Topic] {
+				continue
+			}
+			warned[m.Topic] = summary
+			if len(warnings) == 0 {
+				log.Info().Str("topic", m.Topic).Int("partitions", m.Partitions).Msg("topic layout ok")
+				continue
+			}
+			log.Warn().Str("topic", m.Topic).Int("partitions", m.Partitions).Strs("warnings", warnings).Msg("topic layout limits throughput")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
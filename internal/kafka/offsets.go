@@ -0,0 +1,398 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Offset reset errors
+var (
+	ErrInvalidReset = errors.New("invalid offset reset")
+	ErrGroupActive  = errors.New("consumer group has active members")
+)
+
+// Named reset targets
+const (
+	ResetEarliest = "earliest"
+	ResetLatest   = "latest"
+)
+
+// OffsetClient is the part of *kafka.Client that offset resets use
+type OffsetClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+	DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (*kafka.DescribeGroupsResponse, error)
+	OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error)
+	OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error)
+	DeleteGroups(ctx context.Context, req *kafka.DeleteGroupsRequest) (*kafka.DeleteGroupsResponse, error)
+}
+
+// BrokerClient returns an OffsetClient for the brokers
+func BrokerClient(brokers []string) OffsetClient {
+	return &kafka.Client{Addr: kafka.TCP(brokers...), Timeout: 10 * time.Second}
+}
+
+// OffsetReset says where to move a consumer group's offsets on a topic.
+// Exactly one of To, Timestamp and Offsets is set.
+type OffsetReset struct {
+	Topic string `json:"topic"`
+
+	// To is ResetEarliest or ResetLatest
+	To string `json:"to,omitempty"`
+
+	// Timestamp moves each partition to its first message at or after it
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+
+	// Offsets moves the partitions given; the rest keep their offsets
+	Offsets map[int]int64 `json:"offsets,omitempty"`
+}
+
+// Validate checks the reset names a topic and exactly one target
+func (r OffsetReset) Validate() error {
+	if r.Topic == "" {
+		return fmt.Errorf("%w: topic is required", ErrInvalidReset)
+	}
+
+	targets := 0
+	if r.To != "" {
+		if r.To != ResetEarliest && r.To != ResetLatest {
+			return fmt.Errorf("%w: to must be %q or %q", ErrInvalidReset, ResetEarliest, ResetLatest)
+		}
+		targets++
+	}
+	if r.Timestamp != nil {
+		targets++
+	}
+	if len(r.Offsets) > 0 {
+		targets++
+	}
+	if targets != 1 {
+		return fmt.Errorf("%w: set exactly one of to, timestamp and offsets", ErrInvalidReset)
+	}
+	return nil
+}
+
+// PartitionState is a consumer group's position on one partition
+type PartitionState struct {
+	Partition int `json:"partition"`
+
+	// Committed is the group's next offset, or -1 if it has none
+	Committed int64 `json:"committed"`
+
+	// Earliest and Latest bound the partition's retained offsets
+	Earliest int64 `json:"earliest"`
+	Latest   int64 `json:"latest"`
+
+	// Lag is how many messages the group has yet to consume
+	Lag int64 `json:"lag"`
+}
+
+// PartitionReset is the move of one partition's committed offset
+type PartitionReset struct {
+	Partition int   `json:"partition"`
+	From      int64 `json:"from"`
+	To        int64 `json:"to"`
+
+	// Clamped is set when the requested offset was outside the retained
+	// offsets and was moved to the nearest end
+	Clamped bool `json:"clamped,omitempty"`
+}
+
+// GroupOffsets inspects and resets consumer group offsets, standing in for
+// kafka-consumer-groups.sh --reset-offsets
+type GroupOffsets struct {
+	client OffsetClient
+}
+
+// NewGroupOffsets creates offset controls using client
+func NewGroupOffsets(client OffsetClient) *GroupOffsets {
+	return &GroupOffsets{client: client}
+}
+
+// Describe returns the group's position on each partition of topic
+func (g *GroupOffsets) Describe(ctx context.Context, group, topic string) ([]PartitionState, error) {
+	partitions, err := g.partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	states, err := g.states(ctx, group, topic, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PartitionState, 0, len(partitions))
+	for _, p := range partitions {
+		result = append(result, states[p])
+	}
+	return result, nil
+}
+
+// Plan returns the moves a reset would make, without making them
+func (g *GroupOffsets) Plan(ctx context.Context, group string, reset OffsetReset) ([]PartitionReset, error) {
+	if err := reset.Validate(); err != nil {
+		return nil, err
+	}
+
+	partitions, err := g.partitions(ctx, reset.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(reset.Offsets) > 0 {
+		known := make(map[int]bool, len(partitions))
+		for _, p := range partitions {
+			known[p] = true
+		}
+		partitions = partitions[:0]
+		for p := range reset.Offsets {
+			if !known[p] {
+				return nil, fmt.Errorf("%w: topic %s has no partition %d", ErrInvalidReset, reset.Topic, p)
+			}
+			partitions = append(partitions, p)
+		}
+		sort.Ints(partitions)
+	}
+
+	states, err := g.states(ctx, group, reset.Topic, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	var atTime map[int]int64
+	if reset.Timestamp != nil {
+		if atTime, err = g.offsetsAt(ctx, reset.Topic, partitions, *reset.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
+	moves := make([]PartitionReset, 0, len(partitions))
+	for _, p := range partitions {
+		state := states[p]
+		var target int64
+		switch {
+		case reset.To == ResetEarliest:
+			target = state.Earliest
+		case reset.To == ResetLatest:
+			target = state.Latest
+		case reset.Timestamp != nil:
+			target = atTime[p]
+		default:
+			target = reset.Offsets[p]
+		}
+
+		move := PartitionReset{Partition: p, From: state.Committed, To: target}
+		if target < state.Earliest {
+			move.To, move.Clamped = state.Earliest, true
+		} else if target > state.Latest {
+			move.To, move.Clamped = state.Latest, true
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// Apply makes a reset and returns the moves made. The group must have no
+// active members, as its consumers would overwrite the new offsets.
+func (g *GroupOffsets) Apply(ctx context.Context, group string, reset OffsetReset) ([]PartitionReset, error) {
+	if err := g.checkInactive(ctx, group); err != nil {
+		return nil, err
+	}
+
+	moves, err := g.Plan(ctx, group, reset)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]kafka.OffsetCommit, len(moves))
+	for i, move := range moves {
+		commits[i] = kafka.OffsetCommit{Partition: move.Partition, Offset: move.To}
+	}
+	// Generation -1 commits for a group with no members
+	resp, err := g.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{reset.Topic: commits},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("commit offsets: %w", err)
+	}
+	for _, p := range resp.Topics[reset.Topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("commit offset of partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return moves, nil
+}
+
+// Delete removes a consumer group and its committed offsets; the group
+// must have no active members
+func (g *GroupOffsets) Delete(ctx context.Context, group string) error {
+	resp, err := g.client.DeleteGroups(ctx, &kafka.DeleteGroupsRequest{GroupIDs: []string{group}})
+	if err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	if err := resp.Errors[group]; err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	return nil
+}
+
+// checkInactive returns ErrGroupActive if the group has members
+func (g *GroupOffsets) checkInactive(ctx context.Context, group string) error {
+	resp, err := g.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{group}})
+	if err != nil {
+		return fmt.Errorf("describe group: %w", err)
+	}
+	for _, desc := range resp.Groups {
+		if desc.Error != nil {
+			return fmt.Errorf("describe group: %w", desc.Error)
+		}
+		if len(desc.Members) > 0 {
+			return fmt.Errorf("%w: stop its %d consumers first (state %s)", ErrGroupActive, len(desc.Members), desc.GroupState)
+		}
+	}
+	return nil
+}
+
+// partitions returns the topic's partition IDs in order
+func (g *GroupOffsets) partitions(ctx context.Context, topic string) ([]int, error) {
+	resp, err := g.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("topic metadata: %w", err)
+	}
+	for _, t := range resp.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic, t.Error)
+		}
+		partitions := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			partitions[i] = p.ID
+		}
+		sort.Ints(partitions)
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("topic %s not found", topic)
+}
+
+// states reads the group's committed offsets and the partitions' bounds
+func (g *GroupOffsets) states(ctx context.Context, group, topic string, partitions []int) (map[int]PartitionState, error) {
+	states := make(map[int]PartitionState, len(partitions))
+	for _, p := range partitions {
+		states[p] = PartitionState{Partition: p, Committed: -1}
+	}
+
+	committed, err := g.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: group,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return nil, fmt.Errorf("fetch committed offsets: %w", committed.Error)
+	}
+	for _, p := range committed.Topics[topic] {
+		if state, ok := states[p.Partition]; ok && p.Error == nil {
+			state.Committed = p.CommittedOffset
+			states[p.Partition] = state
+		}
+	}
+
+	// Separate requests: a partition may appear only once in each
+	for _, bound := range []int64{kafka.FirstOffset, kafka.LastOffset} {
+		requests := make([]kafka.OffsetRequest, len(partitions))
+		for i, p := range partitions {
+			requests[i] = kafka.OffsetRequest{Partition: p, Timestamp: bound}
+		}
+		offsets, err := g.listOffsets(ctx, topic, requests)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range offsets {
+			state := states[o.Partition]
+			if bound == kafka.FirstOffset {
+				state.Earliest = o.FirstOffset
+			} else {
+				state.Latest = o.LastOffset
+			}
+			states[o.Partition] = state
+		}
+	}
+
+	for p, state := range states {
+		if state.Committed >= 0 {
+			state.Lag = state.Latest - state.Committed
+		} else {
+			state.Lag = state.Latest - state.Earliest
+		}
+		states[p] = state
+	}
+	return states, nil
+}
+
+// offsetsAt returns each partition's first offset at or after t; a
+// partition with no such message maps to its latest offset
+func (g *GroupOffsets) offsetsAt(ctx context.Context, topic string, partitions []int, t time.Time) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		requests[i] = kafka.TimeOffsetOf(p, t)
+	}
+	offsets, err := g.listOffsets(ctx, topic, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]int64, len(partitions))
+	for _, o := range offsets {
+		result[o.Partition] = -1
+		for offset := range o.Offsets {
+			result[o.Partition] = offset
+		}
+	}
+	var latest []int
+	for _, p := range partitions {
+		if result[p] < 0 {
+			latest = append(latest, p)
+		}
+	}
+	if len(latest) == 0 {
+		return result, nil
+	}
+
+	requests = requests[:0]
+	for _, p := range latest {
+		requests = append(requests, kafka.LastOffsetOf(p))
+	}
+	offsets, err = g.listOffsets(ctx, topic, requests)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range offsets {
+		result[o.Partition] = o.LastOffset
+	}
+	return result, nil
+}
+
+// listOffsets sends one ListOffsets request and checks partition errors
+func (g *GroupOffsets) listOffsets(ctx context.Context, topic string, requests []kafka.OffsetRequest) ([]kafka.PartitionOffsets, error) {
+	resp, err := g.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets: %w", err)
+	}
+	offsets := resp.Topics[topic]
+	for _, o := range offsets {
+		if o.Error != nil {
+			return nil, fmt.Errorf("list offsets of partition %d: %w", o.Partition, o.Error)
+		}
+	}
+	return offsets, nil
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Ping checks that a broker is reachable and serves topic's metadata,
+// trying each broker in turn
+func Ping(ctx context.Context, brokers []string, topic string) error {
+	if len(brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+
+	var errs []error
+	for _, broker := range brokers {
+		err := ping(ctx, broker, topic)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return errors.Join(errs...)
+}
+
+// ping reads topic's partitions from one broker
+func ping(ctx context.Context, broker, topic string) error {
+	conn, err := kafka.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions", topic)
+	}
+	return nil
+}
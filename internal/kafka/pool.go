@@ -0,0 +1,394 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// Writer writes messages to Kafka; *kafka.Writer implements it
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// evictMinSamples is the fewest writes a writer's error rate is judged on
+const evictMinSamples = 5
+
+// pooledWriter is a writer with its recent outcomes. Only the caller that
+// has it checked out touches it.
+type pooledWriter struct {
+	Writer
+
+	// outcomes is a ring of recent writes; true marks a failure
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+
+	checkedOut time.Time
+
+	// id, created and the counters below are reported by the pool's stats
+	id        int
+	created   time.Time
+	busy      atomic.Bool
+	writes    atomic.Uint64
+	writeErrs atomic.Uint64
+	messages  atomic.Uint64
+
+	// slot is the lowest index free when the writer was created, so a
+	// replacement takes over its predecessor's; it labels the writer's
+	// metrics, which stay below MaxPoolSize series however often writers
+	// are replaced
+	slot  int
+	label string
+}
+
+// WriterStats reports a pooled writer's use since it was created
+type WriterStats struct {
+	// ID numbers writers in the order the pool created them
+	ID int `json:"id"`
+
+	// Slot is the writer label of parsec_kafka_publish_duration_seconds
+	Slot int `json:"slot"`
+
+	// Busy is set while a publish has the writer checked out
+	Busy bool `json:"busy"`
+
+	// Writes and Errors count write calls, retries included, and those
+	// that failed; Messages counts the messages written
+	Writes   uint64 `json:"writes"`
+	Errors   uint64 `json:"errors"`
+	Messages uint64 `json:"messages"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// write writes messages and records the outcome. Cancellation says
+// nothing about the connection and is not recorded.
+func (w *pooledWriter) write(ctx context.Context, msgs ...kafka.Message) error {
+	err := w.WriteMessages(ctx, msgs...)
+	w.writes.Add(1)
+	if err != nil {
+		w.writeErrs.Add(1)
+	} else {
+		w.messages.Add(uint64(len(msgs)))
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if len(w.outcomes) == 0 {
+		return err
+	}
+
+	if w.count == len(w.outcomes) {
+		if w.outcomes[w.next] {
+			w.failures--
+		}
+	} else {
+		w.count++
+	}
+	w.outcomes[w.next] = err != nil
+	if err != nil {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.outcomes)
+	return err
+}
+
+// unhealthy reports whether the writer's recent error rate reaches rate
+func (w *pooledWriter) unhealthy(rate float64) bool {
+	if rate <= 0 || w.count < min(evictMinSamples, len(w.outcomes)) {
+		return false
+	}
+	return float64(w.failures)/float64(w.count) >= rate
+}
+
+// writerPool holds the producer's writers. Publishes check a writer out
+// and back in; a writer whose recent error rate shows a wedged connection
+// is closed and replaced on check-in, and between MinPoolSize and
+// MaxPoolSize the pool grows while publishes wait for writers and run over
+// the target latency, and shrinks while writers sit idle.
+type writerPool struct {
+	newWriter func() Writer
+	cfg       config.ProducerConfig
+
+	// idle has room for MaxPoolSize writers, so check-ins never block
+	idle chan *pooledWriter
+
+	mu      sync.Mutex
+	writers map[*pooledWriter]struct{}
+	closed  bool
+	nextID  int
+
+	// Publish statistics since the last resize
+	inUse     int
+	peakInUse int
+	publishes int
+	waited    int
+	latency   time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newWriterPool creates PoolSize writers and starts resizing if the bounds
+// allow it
+func newWriterPool(cfg config.ProducerConfig, newWriter func() Writer) *writerPool {
+	if cfg.MinPoolSize <= 0 {
+		cfg.MinPoolSize = cfg.PoolSize
+	}
+	if cfg.MaxPoolSize < cfg.PoolSize {
+		cfg.MaxPoolSize = cfg.PoolSize
+	}
+	cfg.MinPoolSize = min(cfg.MinPoolSize, cfg.PoolSize)
+	if cfg.PoolTargetLatency <= 0 {
+		cfg.PoolTargetLatency = 250 * time.Millisecond
+	}
+	if cfg.PoolResizeInterval <= 0 {
+		cfg.PoolResizeInterval = 10 * time.Second
+	}
+
+	p := &writerPool{
+		newWriter: newWriter,
+		cfg:       cfg,
+		idle:      make(chan *pooledWriter, cfg.MaxPoolSize),
+		writers:   make(map[*pooledWriter]struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	p.mu.Lock()
+	for i := 0; i < cfg.PoolSize; i++ {
+		p.idle <- p.add()
+	}
+	p.mu.Unlock()
+
+	if cfg.MaxPoolSize > cfg.MinPoolSize {
+		go p.run()
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+// add creates a writer; the caller holds mu and puts it in idle
+func (p *writerPool) add() *pooledWriter {
+	w := &pooledWriter{
+		Writer:   p.newWriter(),
+		outcomes: make([]bool, max(p.cfg.WriterEvictWindow, 0)),
+		id:       p.nextID,
+		created:  time.Now().UTC(),
+		slot:     p.freeSlot(),
+	}
+	w.label = strconv.Itoa(w.slot)
+	p.nextID++
+	p.writers[w] = struct{}{}
+	metrics.KafkaWriterPoolSize.Set(float64(len(p.writers)))
+	return w
+}
+
+// freeSlot returns the lowest slot no writer holds; the caller holds mu
+func (p *writerPool) freeSlot() int {
+	used := make(map[int]bool, len(p.writers))
+	for w := range p.writers {
+		used[w.slot] = true
+	}
+	slot := 0
+	for used[slot] {
+		slot++
+	}
+	return slot
+}
+
+// acquire checks out a writer, waiting for one to be checked in
+func (p *writerPool) acquire(ctx context.Context) (*pooledWriter, error) {
+	start := time.Now()
+
+	var w *pooledWriter
+	select {
+	case w = <-p.idle:
+	default:
+		p.mu.Lock()
+		p.waited++
+		p.mu.Unlock()
+
+		select {
+		case w = <-p.idle:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	p.inUse++
+	p.peakInUse = max(p.peakInUse, p.inUse)
+	p.mu.Unlock()
+
+	w.checkedOut = start
+	w.busy.Store(true)
+	return w, nil
+}
+
+// release checks a writer back in, replacing it if it has turned unhealthy
+func (p *writerPool) release(w *pooledWriter) {
+	w.busy.Store(false)
+	p.mu.Lock()
+	p.inUse--
+	p.publishes++
+	p.latency += time.Since(w.checkedOut)
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	if !w.unhealthy(p.cfg.WriterEvictErrorRate) {
+		p.mu.Unlock()
+		p.idle <- w
+		return
+	}
+
+	delete(p.writers, w)
+	replacement := p.add()
+	p.mu.Unlock()
+
+	log := logger.WithComponent("kafka_producer")
+	log.Warn().
+		Int("failures", w.failures).
+		Int("writes", w.count).
+		Msg("evicting unhealthy kafka writer")
+	metrics.KafkaWriterEvictions.Inc()
+	w.Close()
+	p.idle <- replacement
+}
+
+// size returns the number of writers
+func (p *writerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.writers)
+}
+
+// stats reports the pool's writers in the order they were created
+func (p *writerPool) stats() []WriterStats {
+	p.mu.Lock()
+	stats := make([]WriterStats, 0, len(p.writers))
+	for w := range p.writers {
+		stats = append(stats, WriterStats{
+			ID:        w.id,
+			Slot:      w.slot,
+			Busy:      w.busy.Load(),
+			Writes:    w.writes.Load(),
+			Errors:    w.writeErrs.Load(),
+			Messages:  w.messages.Load(),
+			CreatedAt: w.created,
+		})
+	}
+	p.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// run resizes the pool every PoolResizeInterval until close
+func (p *writerPool) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.PoolResizeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.resize()
+		}
+	}
+}
+
+// resize grows the pool by one writer when publishes waited for a writer
+// and averaged over the target latency, and shrinks it by one when a
+// writer stayed idle throughout and latency was well under target
+func (p *writerPool) resize() {
+	log := logger.WithComponent("kafka_producer")
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	var avg time.Duration
+	if p.publishes > 0 {
+		avg = p.latency / time.Duration(p.publishes)
+	}
+	size := len(p.writers)
+	grow := p.waited > 0 && avg > p.cfg.PoolTargetLatency && size < p.cfg.MaxPoolSize
+	shrink := !grow && p.peakInUse < size && avg < p.cfg.PoolTargetLatency/2 && size > p.cfg.MinPoolSize
+
+	p.publishes, p.waited, p.latency = 0, 0, 0
+	p.peakInUse = p.inUse
+
+	if grow {
+		w := p.add()
+		p.mu.Unlock()
+		p.idle <- w
+		metrics.KafkaWriterPoolResizes.WithLabelValues("grow").Inc()
+		log.Info().Int("size", size+1).Dur("avg_latency", avg).Msg("kafka writer pool grown")
+		return
+	}
+	p.mu.Unlock()
+	if !shrink {
+		return
+	}
+
+	// Only an idle writer is retired; if all are busy the pool was not
+	// idle after all
+	select {
+	case w := <-p.idle:
+		p.mu.Lock()
+		delete(p.writers, w)
+		metrics.KafkaWriterPoolSize.Set(float64(len(p.writers)))
+		p.mu.Unlock()
+		w.Close()
+		metrics.KafkaWriterPoolResizes.WithLabelValues("shrink").Inc()
+		log.Info().Int("size", size-1).Dur("avg_latency", avg).Msg("kafka writer pool shrunk")
+	default:
+	}
+}
+
+// close stops resizing and closes every writer
+func (p *writerPool) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	writers := make([]*pooledWriter, 0, len(p.writers))
+	for w := range p.writers {
+		writers = append(writers, w)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
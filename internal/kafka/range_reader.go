@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/encryption"
+	"parsec/internal/logger"
+	"parsec/pkg/models"
+)
+
+// RangeSpec describes a RangeReader read
+type RangeSpec struct {
+	// Group is the temporary consumer group; it is deleted afterwards
+	Group string
+
+	// Topic is read from the first message received at From (less clock
+	// skew) to the end offsets when the read starts
+	Topic string
+	From  time.Time
+
+	// Readers is the number of group members sharing the partitions (0 = 1)
+	Readers int
+
+	// Started, if set, is called with the number of messages in range
+	// before any is read
+	Started func(total int64)
+}
+
+// RangeReader reads a bounded stretch of a topic through a temporary
+// consumer group, so several readers share its partitions and a rebalance
+// resumes from committed offsets. Messages may be seen more than once.
+type RangeReader struct {
+	brokers []string
+	offsets *GroupOffsets
+	cipher  *encryption.Cipher
+
+	newReader func(group, topic string) Reader
+}
+
+// NewRangeReader creates a range reader; offsets positions and removes
+// the temporary groups
+func NewRangeReader(brokers []string, offsets *GroupOffsets) *RangeReader {
+	r := &RangeReader{brokers: brokers, offsets: offsets}
+	r.newReader = func(group, topic string) Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        r.brokers,
+			Topic:          topic,
+			GroupID:        group,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			CommitInterval: time.Second,
+		})
+	}
+	return r
+}
+
+// WithCipher decrypts envelopes sealed for encrypted tenants
+func (r *RangeReader) WithCipher(c *encryption.Cipher) *RangeReader {
+	r.cipher = c
+	return r
+}
+
+// WithReaderFactory creates group members with fn instead of dialing the
+// brokers
+func (r *RangeReader) WithReaderFactory(fn func(group, topic string) Reader) *RangeReader {
+	r.newReader = fn
+	return r
+}
+
+// Read calls fn for each envelope in range, concurrently from
+// spec.Readers goroutines, until every partition reaches its end offset.
+// The first error from fn stops the read and is returned.
+func (r *RangeReader) Read(ctx context.Context, spec RangeSpec, fn func(*models.Envelope) error) error {
+	if spec.Group == "" || spec.Topic == "" {
+		return errors.New("group and topic are required")
+	}
+	if spec.Readers <= 0 {
+		spec.Readers = 1
+	}
+	log := logger.WithComponent("kafka_range_reader").With().
+		Str("group", spec.Group).
+		Str("topic", spec.Topic).
+		Logger()
+
+	from := spec.From.Add(-MaxClockSkew)
+	if _, err := r.offsets.Apply(ctx, spec.Group, OffsetReset{Topic: spec.Topic, Timestamp: &from}); err != nil {
+		return fmt.Errorf("position group: %w", err)
+	}
+	defer func() {
+		if err := r.offsets.Delete(context.WithoutCancel(ctx), spec.Group); err != nil {
+			log.Warn().Err(err).Msg("failed to delete temporary consumer group")
+		}
+	}()
+
+	states, err := r.offsets.Describe(ctx, spec.Group, spec.Topic)
+	if err != nil {
+		return err
+	}
+	// end holds the end offset of each partition still to be read
+	end := make(map[int]int64)
+	var total int64
+	for _, s := range states {
+		if s.Committed >= 0 && s.Committed < s.Latest {
+			end[s.Partition] = s.Latest
+			total += s.Latest - s.Committed
+		}
+	}
+	if spec.Started != nil {
+		spec.Started(total)
+	}
+	if len(end) == 0 {
+		return nil
+	}
+
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	// done marks a partition read; the last one ends the read
+	done := func(partition int) {
+		mu.Lock()
+		if _, ok := end[partition]; ok {
+			delete(end, partition)
+			if len(end) == 0 {
+				cancel()
+			}
+		}
+		mu.Unlock()
+	}
+	endOf := func(partition int) (int64, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		e, ok := end[partition]
+		return e, ok
+	}
+
+	for i := 0; i < spec.Readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader := r.newReader(spec.Group, spec.Topic)
+			defer reader.Close()
+
+			for {
+				msg, err := reader.FetchMessage(readCtx)
+				if err != nil {
+					if readCtx.Err() == nil {
+						fail(fmt.Errorf("fetch message: %w", err))
+					}
+					return
+				}
+
+				// Partitions already finished, and messages past the end,
+				// are left for nobody
+				last, ok := endOf(msg.Partition)
+				if !ok || msg.Offset >= last {
+					continue
+				}
+
+				envelope, err := decodeEnvelope(readCtx, msg, r.cipher)
+				if err != nil {
+					log.Warn().Err(err).Int("partition", msg.Partition).Int64("offset", msg.Offset).Msg("skipping undecodable message")
+				} else if err := fn(envelope); err != nil {
+					fail(err)
+					return
+				}
+
+				if err := reader.CommitMessages(readCtx, msg); err != nil && readCtx.Err() == nil {
+					log.Warn().Err(err).Int("partition", msg.Partition).Msg("failed to commit offset")
+				}
+				if msg.Offset >= last-1 {
+					done(msg.Partition)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/encryption"
+	"parsec/pkg/models"
+)
+
+// MaxClockSkew is how far ahead of receipt an event timestamp may be
+// (mirrors event validation), so scans can seek by receive time
+const MaxClockSkew = time.Minute
+
+// Scanner reads a tenant's envelopes back from the event topics
+type Scanner struct {
+	brokers []string
+	topics  []string
+
+	// tenantTopics adds per-tenant topics (e.g. routing rule targets)
+	tenantTopics func(tenantID string) []string
+
+	// cipher decrypts encrypted envelopes (nil = plaintext only)
+	cipher *encryption.Cipher
+}
+
+// NewScanner creates a scanner over the given topics (duplicates and empty
+// names are ignored)
+func NewScanner(brokers []string, topics ...string) *Scanner {
+	return &Scanner{brokers: brokers, topics: uniqueTopics(topics)}
+}
+
+// uniqueTopics drops duplicate and empty topic names, keeping the order
+func uniqueTopics(topics []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, t := range topics {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// WithTenantTopics also scans the topics fn returns for the tenant
+func (s *Scanner) WithTenantTopics(fn func(tenantID string) []string) *Scanner {
+	s.tenantTopics = fn
+	return s
+}
+
+// WithCipher decrypts envelopes sealed for encrypted tenants
+func (s *Scanner) WithCipher(c *encryption.Cipher) *Scanner {
+	s.cipher = c
+	return s
+}
+
+// Scan calls fn for each of the tenant's events with a timestamp in
+// [from, to). Every partition is read from the first message received at
+// from (less clock skew) to its current end, since backfilled events can
+// arrive long after their timestamp.
+func (s *Scanner) Scan(ctx context.Context, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error {
+	if len(s.brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+
+	topics := s.topics
+	if s.tenantTopics != nil {
+		topics = uniqueTopics(append(append([]string(nil), s.topics...), s.tenantTopics(tenantID)...))
+	}
+
+	for _, topic := range topics {
+		conn, err := kafka.DialContext(ctx, "tcp", s.brokers[0])
+		if err != nil {
+			return fmt.Errorf("dial kafka: %w", err)
+		}
+		partitions, err := conn.ReadPartitions(topic)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("read partitions of %s: %w", topic, err)
+		}
+
+		for _, p := range partitions {
+			if err := s.scanPartition(ctx, topic, p.ID, tenantID, from, to, fn); err != nil {
+				return fmt.Errorf("%s/%d: %w", topic, p.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scanPartition reads one partition between the seek offset and its end
+func (s *Scanner) scanPartition(ctx context.Context, topic string, partition int, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error {
+	leader, err := kafka.DialLeader(ctx, "tcp", s.brokers[0], topic, partition)
+	if err != nil {
+		return err
+	}
+	start, err := leader.ReadOffset(from.Add(-MaxClockSkew))
+	if err != nil {
+		leader.Close()
+		return err
+	}
+	end, err := leader.ReadLastOffset()
+	leader.Close()
+	if err != nil {
+		return err
+	}
+	if start < 0 || start >= end {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.brokers,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(start); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		if header(msg, "tenant_id") == tenantID {
+			data, err := DecryptValue(ctx, msg, s.cipher)
+			if err != nil {
+				return err
+			}
+			var envelope models.Envelope
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				return fmt.Errorf("decode envelope at offset %d: %w", msg.Offset, err)
+			}
+			if e := envelope.Event; e != nil && !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+		}
+
+		if msg.Offset >= end-1 {
+			return nil
+		}
+	}
+}
+
+// header returns a message header value
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"parsec/internal/metrics"
+)
+
+// ShaperLimits caps the producer's write rate. Zero means unlimited.
+type ShaperLimits struct {
+	MessagesPerSec float64 `json:"messages_per_sec"`
+	BytesPerSec    float64 `json:"bytes_per_sec"`
+}
+
+// bucket is a token bucket holding up to one second of its rate. Tokens may
+// go negative so requests larger than the burst are delayed, not refused.
+type bucket struct {
+	rate     float64
+	tokens   float64
+	lastFill time.Time
+}
+
+// reserve takes n tokens and returns how long the caller must wait
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.tokens += now.Sub(b.lastFill).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.lastFill = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// setRate changes the rate, keeping at most one second of burst. A bucket
+// that was unlimited starts full.
+func (b *bucket) setRate(rate float64, now time.Time) {
+	if b.rate <= 0 || b.tokens > rate {
+		b.tokens = rate
+	}
+	b.rate = rate
+	b.lastFill = now
+}
+
+// Shaper smooths writes to Kafka with message and byte token buckets so
+// replay or backfill bursts cannot overwhelm a shared cluster. Limits can be
+// changed at runtime.
+type Shaper struct {
+	mu       sync.Mutex
+	limits   ShaperLimits
+	messages bucket
+	bytes    bucket
+}
+
+// NewShaper creates a shaper with the given limits
+func NewShaper(limits ShaperLimits) *Shaper {
+	s := &Shaper{}
+	s.SetLimits(limits)
+	return s
+}
+
+// SetLimits replaces the limits; waiting writers keep their reservations
+func (s *Shaper) SetLimits(limits ShaperLimits) {
+	if limits.MessagesPerSec < 0 {
+		limits.MessagesPerSec = 0
+	}
+	if limits.BytesPerSec < 0 {
+		limits.BytesPerSec = 0
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits = limits
+	s.messages.setRate(limits.MessagesPerSec, now)
+	s.bytes.setRate(limits.BytesPerSec, now)
+}
+
+// Limits returns the current limits
+func (s *Shaper) Limits() ShaperLimits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// Wait blocks until the messages and bytes may be written. If the context is
+// cancelled first, the reservation is returned.
+func (s *Shaper) Wait(ctx context.Context, messages, bytes int) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	delay := s.messages.reserve(float64(messages), now)
+	if d := s.bytes.reserve(float64(bytes), now); d > delay {
+		delay = d
+	}
+	s.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	metrics.KafkaShaperDelay.Observe(delay.Seconds())
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if s.messages.rate > 0 {
+			s.messages.tokens += float64(messages)
+		}
+		if s.bytes.rate > 0 {
+			s.bytes.tokens += float64(bytes)
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
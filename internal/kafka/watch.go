@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// WatchHeader reads topic from its end as consumer group groupID, calling
+// fn with the value of each message's key header ("" when missing) until
+// ctx is cancelled. Messages aren't decoded or decrypted, so watching
+// costs little beyond the fetches themselves.
+func WatchHeader(ctx context.Context, brokers []string, topic, groupID, key string, fn func(value string)) error {
+	if len(brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     groupID,
+		StartOffset: kafka.LastOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(header(msg, key))
+	}
+}
@@ -0,0 +1,237 @@
+package kinesis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/sigv4"
+)
+
+// Kinesis Data Streams quotas
+const (
+	maxRecords      = 500
+	maxRecordBytes  = 1 << 20
+	maxPartitionKey = 256
+
+	// maxRequestBytes stays under the 5 MiB request quota once values are
+	// base64-framed into records
+	maxRequestBytes = 3 << 20
+)
+
+const (
+	apiTargetPrefix  = "Kinesis_20131202."
+	apiContentType   = "application/x-amz-json-1.1"
+	defaultPartition = "parsec"
+)
+
+// Sender puts messages into Kinesis data streams named StreamPrefix + topic.
+// Kinesis records carry no headers, so each record is a bus record framing
+// the envelope headers and value (see bus.MarshalRecord).
+type Sender struct {
+	cfg      config.KinesisConfig
+	endpoint string
+	signer   sigv4.Signer
+	client   *http.Client
+}
+
+// New creates a Kinesis sender using the standard AWS_* credentials
+func New(cfg config.KinesisConfig) (*Sender, error) {
+	creds := sigv4.CredentialsFromEnv()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("kinesis requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return NewWithCredentials(cfg, creds)
+}
+
+// NewWithCredentials creates a Kinesis sender with explicit credentials
+func NewWithCredentials(cfg config.KinesisConfig, creds sigv4.Credentials) (*Sender, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("kinesis region is required")
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = 10 * time.Second
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kinesis." + cfg.Region + ".amazonaws.com"
+	}
+
+	return &Sender{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/",
+		signer:   sigv4.Signer{Credentials: creds, Region: cfg.Region, Service: "kinesis"},
+		client:   &http.Client{Timeout: cfg.RequestTimeout},
+	}, nil
+}
+
+// Limits returns the PutRecords request quotas
+func (s *Sender) Limits() bus.Limits {
+	return bus.Limits{Messages: maxRecords, Bytes: maxRequestBytes}
+}
+
+type putRecord struct {
+	Data         []byte `json:"Data"`
+	PartitionKey string `json:"PartitionKey"`
+}
+
+type putRecordsRequest struct {
+	StreamName string      `json:"StreamName"`
+	Records    []putRecord `json:"Records"`
+}
+
+type putRecordsResponse struct {
+	FailedRecordCount int `json:"FailedRecordCount"`
+	Records           []struct {
+		SequenceNumber string `json:"SequenceNumber"`
+		ErrorCode      string `json:"ErrorCode"`
+		ErrorMessage   string `json:"ErrorMessage"`
+	} `json:"Records"`
+}
+
+// Send puts messages with one PutRecords call per stream. Records Kinesis
+// fails individually (throttling, internal errors) are reported for retry.
+func (s *Sender) Send(ctx context.Context, msgs []bus.Message) []error {
+	errs := make([]error, len(msgs))
+
+	// Group by stream, keeping each message's position
+	byStream := make(map[string][]int)
+	var streams []string
+	for i, msg := range msgs {
+		stream := s.cfg.StreamPrefix + msg.Topic
+		if _, ok := byStream[stream]; !ok {
+			streams = append(streams, stream)
+		}
+		byStream[stream] = append(byStream[stream], i)
+	}
+
+	for _, stream := range streams {
+		idx := byStream[stream]
+		req := putRecordsRequest{StreamName: stream}
+		var sent []int
+		for _, i := range idx {
+			data, err := bus.MarshalRecord(msgs[i])
+			if err != nil {
+				errs[i] = bus.Permanent(err)
+				continue
+			}
+			key := partitionKey(msgs[i])
+			if len(data)+len(key) > maxRecordBytes {
+				errs[i] = bus.Permanent(fmt.Errorf("record of %d bytes exceeds the Kinesis 1 MiB limit", len(data)+len(key)))
+				continue
+			}
+			req.Records = append(req.Records, putRecord{Data: data, PartitionKey: key})
+			sent = append(sent, i)
+		}
+		if len(sent) == 0 {
+			continue
+		}
+
+		var resp putRecordsResponse
+		if err := s.call(ctx, "PutRecords", req, &resp); err != nil {
+			for _, i := range sent {
+				errs[i] = err
+			}
+			continue
+		}
+		for j, i := range sent {
+			if j >= len(resp.Records) {
+				errs[i] = errors.New("kinesis returned fewer records than sent")
+				continue
+			}
+			if r := resp.Records[j]; r.ErrorCode != "" {
+				errs[i] = fmt.Errorf("%s: %s", r.ErrorCode, r.ErrorMessage)
+			}
+		}
+	}
+	return errs
+}
+
+// partitionKey spreads records by the envelope partition key (the tenant),
+// falling back to a fixed key
+func partitionKey(msg bus.Message) string {
+	key := string(msg.Key)
+	if key == "" {
+		key = defaultPartition
+	}
+	if len(key) > maxPartitionKey {
+		key = key[:maxPartitionKey]
+	}
+	return key
+}
+
+// apiError is the body of a failed Kinesis API call
+type apiError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// call invokes a Kinesis JSON API operation
+func (s *Sender) call(ctx context.Context, op string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return bus.Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", apiContentType)
+	req.Header.Set("X-Amz-Target", apiTargetPrefix+op)
+	s.signer.Sign(req, sigv4.PayloadHash(body), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr apiError
+		json.Unmarshal(msg, &apiErr)
+		if apiErr.Type == "" {
+			apiErr.Message = strings.TrimSpace(string(msg))
+		}
+		// Drop the "com.amazonaws.kinesis.v20131202#" namespace if present
+		code := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+		err := fmt.Errorf("kinesis %s: %s: %s %s", op, resp.Status, code, apiErr.Message)
+		if resp.StatusCode/100 == 4 && !retryable(code) {
+			return bus.Permanent(err)
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retryable reports whether a 4xx error code is throttling
+func retryable(code string) bool {
+	switch code {
+	case "ProvisionedThroughputExceededException", "LimitExceededException",
+		"KMSThrottlingException", "ThrottlingException", "":
+		return true
+	}
+	return false
+}
+
+// HealthCheck verifies the credentials and endpoint with ListStreams
+func (s *Sender) HealthCheck(ctx context.Context) error {
+	var out json.RawMessage
+	return s.call(ctx, "ListStreams", map[string]int{"Limit": 1}, &out)
+}
+
+// Close releases idle connections
+func (s *Sender) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
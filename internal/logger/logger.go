@@ -34,6 +34,9 @@ func Init(level string) {
 		}
 	}
 
+	// Keep the latest lines for crash reports
+	output = io.MultiWriter(output, recent)
+
 	// Create logger with context
 	Logger = zerolog.New(output).
 		With().
@@ -46,6 +49,11 @@ func Init(level string) {
 		Msg("logger initialized")
 }
 
+// AddHook attaches a hook to the global logger
+func AddHook(h zerolog.Hook) {
+	Logger = Logger.Hook(h)
+}
+
 // WithComponent returns a logger with a component field
 func WithComponent(component string) zerolog.Logger {
 	return Logger.With().Str("component", component).Logger()
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+)
+
+// recentCapacity is how many log lines are kept for Recent
+const recentCapacity = 1000
+
+// recent holds the latest lines written by Logger
+var recent = &ring{lines: make([]string, recentCapacity)}
+
+// ring is a fixed-size buffer of log lines
+type ring struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// Write stores one log line; zerolog writes each event in a single call
+func (r *ring) Write(p []byte) (int, error) {
+	line := string(bytes.TrimRight(p, "\n"))
+
+	r.mu.Lock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+// Recent returns up to the n most recent log lines, oldest first. At most
+// the last 1000 lines are kept.
+func Recent(n int) []string {
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+
+	size := recent.next
+	if recent.full {
+		size = len(recent.lines)
+	}
+	n = min(max(n, 0), size)
+
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = recent.lines[(recent.next-n+i+len(recent.lines))%len(recent.lines)]
+	}
+	return lines
+}
@@ -0,0 +1,322 @@
+// Package logql parses the subset of LogQL that Grafana's Loki datasource
+// sends for log queries: a stream selector followed by line filters, e.g.
+//
+//	{source="api", level=~"error|warn"} |= "timeout" != "healthcheck"
+//
+// Metric queries (count_over_time and the like) and parser stages (| json,
+// | logfmt, | line_format) are not supported and fail to parse.
+package logql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupported is returned for valid LogQL this package doesn't evaluate
+var ErrUnsupported = errors.New("unsupported LogQL")
+
+// Match types of label matchers and line filters
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// Matcher selects streams by one label
+type Matcher struct {
+	Name  string
+	Type  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// Matches reports whether a label value (empty when missing) matches
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// LineFilter keeps or drops lines by their content
+type LineFilter struct {
+	// Type is "|=" (contains), "!=" (doesn't contain), "|~" (matches) or
+	// "!~" (doesn't match)
+	Type  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// Matches reports whether a line passes the filter
+func (f *LineFilter) Matches(line string) bool {
+	switch f.Type {
+	case "|=":
+		return strings.Contains(line, f.Value)
+	case "!=":
+		return !strings.Contains(line, f.Value)
+	case "|~":
+		return f.re.MatchString(line)
+	default:
+		return !f.re.MatchString(line)
+	}
+}
+
+// Query is a parsed log query
+type Query struct {
+	Matchers []*Matcher
+	Filters  []*LineFilter
+}
+
+// Matches reports whether a line with the given labels is selected
+func (q *Query) Matches(labels map[string]string, line string) bool {
+	for _, m := range q.Matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	for _, f := range q.Filters {
+		if !f.Matches(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// Take removes the equality matchers on label from the query and returns
+// their value, e.g. to read the tenant out of {tenant="acme"}. It reports
+// false when there are none, and fails on other matchers of the label.
+func (q *Query) Take(label string) (string, bool, error) {
+	var (
+		value string
+		found bool
+		kept  = q.Matchers[:0]
+	)
+	for _, m := range q.Matchers {
+		if m.Name != label {
+			kept = append(kept, m)
+			continue
+		}
+		if m.Type != MatchEqual || (found && m.Value != value) {
+			return "", false, fmt.Errorf("%s must be matched with a single =", label)
+		}
+		value, found = m.Value, true
+	}
+	q.Matchers = kept
+	return value, found, nil
+}
+
+// String returns the query in a normal form: matchers sorted, values
+// quoted and spacing fixed, so queries selecting the same lines the same
+// way read alike, e.g. for cache keys
+func (q *Query) String() string {
+	matchers := make([]string, 0, len(q.Matchers))
+	for _, m := range q.Matchers {
+		matchers = append(matchers, m.Name+m.Type+strconv.Quote(m.Value))
+	}
+	slices.Sort(matchers)
+
+	var b strings.Builder
+	b.WriteString("{" + strings.Join(matchers, ", ") + "}")
+	for _, f := range q.Filters {
+		b.WriteString(" " + f.Type + " " + strconv.Quote(f.Value))
+	}
+	return b.String()
+}
+
+// Parse parses a log query
+func Parse(query string) (*Query, error) {
+	p := &parser{s: query}
+	q, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", query, err)
+	}
+	return q, nil
+}
+
+// ParseSelector parses a stream selector alone, as sent with label value
+// requests
+func ParseSelector(selector string) (*Query, error) {
+	p := &parser{s: selector}
+	matchers, err := p.selector()
+	if err == nil {
+		p.space()
+		if !p.done() {
+			err = fmt.Errorf("unexpected %q after the selector", p.rest())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", selector, err)
+	}
+	return &Query{Matchers: matchers}, nil
+}
+
+// parser reads a query left to right
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) done() bool   { return p.pos >= len(p.s) }
+func (p *parser) rest() string { return p.s[p.pos:] }
+
+// space skips whitespace
+func (p *parser) space() {
+	for !p.done() && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips tok if it comes next
+func (p *parser) consume(tok string) bool {
+	if strings.HasPrefix(p.rest(), tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) query() (*Query, error) {
+	p.space()
+	if !strings.HasPrefix(p.rest(), "{") {
+		return nil, fmt.Errorf("%w: only log queries starting with a stream selector are supported", ErrUnsupported)
+	}
+	matchers, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{Matchers: matchers}
+
+	for {
+		p.space()
+		if p.done() {
+			return q, nil
+		}
+		var typ string
+		for _, op := range []string{"|=", "!=", "|~", "!~"} {
+			if p.consume(op) {
+				typ = op
+				break
+			}
+		}
+		if typ == "" {
+			if strings.HasPrefix(p.rest(), "|") {
+				return nil, fmt.Errorf("%w: pipeline stage %q", ErrUnsupported, p.rest())
+			}
+			return nil, fmt.Errorf("unexpected %q", p.rest())
+		}
+		p.space()
+		value, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		f := &LineFilter{Type: typ, Value: value}
+		if typ == "|~" || typ == "!~" {
+			if f.re, err = regexp.Compile(value); err != nil {
+				return nil, err
+			}
+		}
+		q.Filters = append(q.Filters, f)
+	}
+}
+
+// selector parses {name op "value", ...}, which needs at least one matcher
+func (p *parser) selector() ([]*Matcher, error) {
+	p.space()
+	if !p.consume("{") {
+		return nil, errors.New("expected a stream selector {...}")
+	}
+
+	var matchers []*Matcher
+	for {
+		p.space()
+		if p.consume("}") {
+			if len(matchers) == 0 {
+				return nil, errors.New("a stream selector needs at least one matcher")
+			}
+			return matchers, nil
+		}
+		if len(matchers) > 0 && !p.consume(",") {
+			return nil, fmt.Errorf("expected , or } at %q", p.rest())
+		}
+		p.space()
+
+		m, err := p.matcher()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+}
+
+// matcher parses name op "value"
+func (p *parser) matcher() (*Matcher, error) {
+	start := p.pos
+	for !p.done() && (p.s[p.pos] == '_' || unicode.IsLetter(rune(p.s[p.pos])) || (p.pos > start && unicode.IsDigit(rune(p.s[p.pos])))) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("expected a label name at %q", p.rest())
+	}
+	m := &Matcher{Name: p.s[start:p.pos]}
+
+	p.space()
+	for _, op := range []string{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if p.consume(op) {
+			m.Type = op
+			break
+		}
+	}
+	if m.Type == "" {
+		return nil, fmt.Errorf("expected =, !=, =~ or !~ after %s", m.Name)
+	}
+
+	p.space()
+	value, err := p.str()
+	if err != nil {
+		return nil, err
+	}
+	m.Value = value
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		// Label regexps match the whole value, as in Prometheus
+		if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// str parses a double-quoted (with Go escapes) or backquoted string
+func (p *parser) str() (string, error) {
+	if p.done() || (p.s[p.pos] != '"' && p.s[p.pos] != '`') {
+		return "", fmt.Errorf("expected a string at %q", p.rest())
+	}
+	quote := p.s[p.pos]
+	for end := p.pos + 1; end < len(p.s); end++ {
+		switch {
+		case quote == '"' && p.s[end] == '\\':
+			end++
+		case p.s[end] == quote:
+			value, err := strconv.Unquote(p.s[p.pos : end+1])
+			if err != nil {
+				return "", fmt.Errorf("invalid string %s: %w", p.s[p.pos:end+1], err)
+			}
+			p.pos = end + 1
+			return value, nil
+		}
+	}
+	return "", errors.New("unterminated string")
+}
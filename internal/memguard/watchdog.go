@@ -0,0 +1,236 @@
+// Package memguard watches memory use against the process's memory limit
+// and sheds load progressively as it gets close, so a burst ends in
+// rejected requests rather than an OOM kill that loses every buffered
+// envelope.
+package memguard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	parsecmetrics "parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Level is how much load is being shed; each level includes the ones
+// below it
+type Level int32
+
+const (
+	// LevelNormal sheds nothing
+	LevelNormal Level = iota
+
+	// LevelShrinkQueue caps the envelope queue well below its capacity
+	LevelShrinkQueue
+
+	// LevelRejectDebug also rejects DEBUG events at ingest
+	LevelRejectDebug
+
+	// LevelFlush also flushes buffered envelopes on every check
+	LevelFlush
+)
+
+// String returns the level's metric label
+func (l Level) String() string {
+	switch l {
+	case LevelShrinkQueue:
+		return "shrink_queue"
+	case LevelRejectDebug:
+		return "reject_debug"
+	case LevelFlush:
+		return "flush"
+	default:
+		return "normal"
+	}
+}
+
+// hysteresis is how far (as a fraction of the limit) usage must fall below
+// a level's threshold before the level is left, so shedding doesn't flap
+const hysteresis = 0.05
+
+// defaultInterval is the check interval when Config.Interval is unset
+const defaultInterval = time.Second
+
+// Shedder is what the watchdog sheds load through
+type Shedder interface {
+	// ShrinkQueue caps the envelope queue (true) or lifts the cap (false)
+	ShrinkQueue(shrink bool)
+
+	// Flush publishes buffered envelopes now
+	Flush()
+}
+
+// Config holds watchdog settings
+type Config struct {
+	// Limit is the memory limit in bytes; 0 uses GOMEMLIMIT
+	Limit int64
+
+	// ShrinkQueue, RejectDebug and Flush are the fractions of the limit at
+	// which each level starts, in increasing order
+	ShrinkQueue float64
+	RejectDebug float64
+	Flush       float64
+
+	// Interval is how often memory is sampled
+	Interval time.Duration
+
+	// Usage reports memory use in bytes; nil reads the runtime's total
+	// minus memory returned to the OS, which is what GOMEMLIMIT bounds
+	Usage func() uint64
+}
+
+// Watchdog samples memory use and sets the shedding level
+type Watchdog struct {
+	limit      int64
+	thresholds [LevelFlush + 1]float64
+	interval   time.Duration
+	usage      func() uint64
+	shedder    Shedder
+
+	level atomic.Int32
+
+	// mu serializes checks
+	mu sync.Mutex
+}
+
+// New creates a watchdog shedding load through shedder. It returns nil,
+// which sheds nothing, when neither Limit nor GOMEMLIMIT sets a limit.
+func New(cfg Config, shedder Shedder) (*Watchdog, error) {
+	if !(0 < cfg.ShrinkQueue && cfg.ShrinkQueue <= cfg.RejectDebug && cfg.RejectDebug <= cfg.Flush) {
+		return nil, fmt.Errorf("memory shedding thresholds must increase from above 0: %g, %g, %g",
+			cfg.ShrinkQueue, cfg.RejectDebug, cfg.Flush)
+	}
+
+	limit := cfg.Limit
+	if limit <= 0 {
+		// A negative input reads the limit without changing it
+		limit = debug.SetMemoryLimit(-1)
+	}
+	if limit <= 0 || limit == math.MaxInt64 {
+		return nil, nil
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	usage := cfg.Usage
+	if usage == nil {
+		usage = runtimeUsage
+	}
+
+	parsecmetrics.MemoryLimitBytes.Set(float64(limit))
+	return &Watchdog{
+		limit:      limit,
+		thresholds: [...]float64{0, cfg.ShrinkQueue, cfg.RejectDebug, cfg.Flush},
+		interval:   interval,
+		usage:      usage,
+		shedder:    shedder,
+	}, nil
+}
+
+// Limit returns the memory limit in bytes
+func (w *Watchdog) Limit() int64 { return w.limit }
+
+// Level returns the current shedding level
+func (w *Watchdog) Level() Level {
+	if w == nil {
+		return LevelNormal
+	}
+	return Level(w.level.Load())
+}
+
+// Sheds reports whether an event of the given severity should be rejected
+// at the current level
+func (w *Watchdog) Sheds(severity models.Severity) bool {
+	return w.Level() >= LevelRejectDebug && severity.Rank() <= models.SeverityDebug.Rank()
+}
+
+// Check samples memory use once, moves to the level it calls for and, at
+// LevelFlush, forces a flush. It returns the new level.
+func (w *Watchdog) Check() Level {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	used := w.usage()
+	parsecmetrics.MemoryUsageBytes.Set(float64(used))
+	fraction := float64(used) / float64(w.limit)
+
+	previous := Level(w.level.Load())
+	level := previous
+	// Rise to the highest level reached
+	for l := LevelFlush; l > level; l-- {
+		if fraction >= w.thresholds[l] {
+			level = l
+			break
+		}
+	}
+	// Fall while clearly below the current level's threshold
+	for level > LevelNormal && fraction < w.thresholds[level]-hysteresis {
+		level--
+	}
+
+	if level != previous {
+		w.transition(previous, level, used)
+	}
+	if level >= LevelFlush {
+		w.shedder.Flush()
+		parsecmetrics.MemoryForcedFlushes.Inc()
+	}
+	return level
+}
+
+// transition applies a level change
+func (w *Watchdog) transition(from, to Level, used uint64) {
+	w.level.Store(int32(to))
+	parsecmetrics.MemoryShedLevel.Set(float64(to))
+	for l := from + 1; l <= to; l++ {
+		parsecmetrics.MemoryShedActivations.WithLabelValues(l.String()).Inc()
+	}
+	if (from >= LevelShrinkQueue) != (to >= LevelShrinkQueue) {
+		w.shedder.ShrinkQueue(to >= LevelShrinkQueue)
+	}
+
+	log := logger.WithComponent("memguard")
+	event := log.Info()
+	if to > from {
+		event = log.Warn()
+	}
+	event.
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Uint64("used_bytes", used).
+		Int64("limit_bytes", w.limit).
+		Msg("memory shedding level changed")
+}
+
+// Run checks memory every interval until ctx is cancelled
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// runtimeUsage reads the memory the runtime holds from the OS
+func runtimeUsage() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
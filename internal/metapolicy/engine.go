@@ -0,0 +1,248 @@
+package metapolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding all tenants' metadata policies, as a
+// versioned value (see state.Versioned)
+const StoreKey = "parsec:metadata_policies"
+
+// Limits are the metadata limits applied to every tenant
+type Limits struct {
+	// MaxValueBytes truncates longer metadata values (0 = unlimited)
+	MaxValueBytes int
+
+	// Deny lists keys stripped for every tenant (e.g. "authorization")
+	Deny []string
+}
+
+// Engine enforces metadata limits and per-tenant key policies as a pipeline
+// stage. Policies are shared across nodes via the StateStore and reloaded
+// by Run.
+type Engine struct {
+	shared *state.Versioned
+	limits Limits
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+// NewEngine creates a metadata policy engine backed by the given store
+// (may be nil)
+func NewEngine(store state.StateStore, limits Limits) *Engine {
+	limits.Deny = normalizePatterns(limits.Deny)
+	e := &Engine{
+		limits:   limits,
+		policies: make(map[string]Policy),
+	}
+	if store != nil {
+		e.shared = state.NewVersioned(store, StoreKey)
+	}
+	return e
+}
+
+// Name implements pipeline.Stage
+func (e *Engine) Name() string { return "metadata" }
+
+// Process implements pipeline.Stage. Stripped keys and truncated values
+// never reject the event.
+func (e *Engine) Process(ctx context.Context, event *models.LogEvent) (pipeline.Result, error) {
+	if e == nil || len(event.Metadata) == 0 {
+		return pipeline.Result{}, nil
+	}
+
+	e.mu.RLock()
+	policy := e.policies[event.TenantID]
+	e.mu.RUnlock()
+
+	var denied, disallowed, truncated int
+	for key, value := range event.Metadata {
+		switch {
+		case matchAny(e.limits.Deny, key) || matchAny(policy.Deny, key):
+			delete(event.Metadata, key)
+			denied++
+			continue
+		case len(policy.Allow) > 0 && !matchAny(policy.Allow, key):
+			delete(event.Metadata, key)
+			disallowed++
+			continue
+		}
+
+		if s, ok := value.(string); ok && e.limits.MaxValueBytes > 0 && len(s) > e.limits.MaxValueBytes {
+			event.Metadata[key] = truncate(s, e.limits.MaxValueBytes)
+			truncated++
+		}
+	}
+
+	if denied+disallowed+truncated == 0 {
+		return pipeline.Result{}, nil
+	}
+	if !pipeline.IsDryRun(ctx) {
+		if denied > 0 {
+			metrics.MetadataKeysStripped.WithLabelValues(event.TenantID, "deny").Add(float64(denied))
+		}
+		if disallowed > 0 {
+			metrics.MetadataKeysStripped.WithLabelValues(event.TenantID, "allowlist").Add(float64(disallowed))
+		}
+		if truncated > 0 {
+			metrics.MetadataValuesTruncated.WithLabelValues(event.TenantID).Add(float64(truncated))
+		}
+	}
+	return pipeline.Result{
+		Changed: true,
+		Detail:  fmt.Sprintf("stripped=%d truncated=%d", denied+disallowed, truncated),
+	}, nil
+}
+
+// truncate cuts value to at most max bytes on a UTF-8 rune boundary
+func truncate(value string, max int) string {
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
+// Policy returns a tenant's policy
+func (e *Engine) Policy(tenantID string) Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policies[tenantID]
+}
+
+// Config implements pipeline.Configured: the global limits and every
+// tenant's policy
+func (e *Engine) Config() any {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	policies := make(map[string]Policy, len(e.policies))
+	for tenantID, p := range e.policies {
+		policies[tenantID] = p
+	}
+	return map[string]any{
+		"max_value_bytes": e.limits.MaxValueBytes,
+		"deny":            e.limits.Deny,
+		"tenants":         policies,
+	}
+}
+
+// SetPolicy validates and replaces a tenant's policy. An empty policy
+// removes it.
+func (e *Engine) SetPolicy(ctx context.Context, tenantID string, policy Policy) (Policy, error) {
+	policy.normalize()
+	if err := policy.Validate(); err != nil {
+		return Policy{}, err
+	}
+
+	e.writing.Lock()
+	defer e.writing.Unlock()
+
+	apply := func(data []byte) (map[string]Policy, error) {
+		current := make(map[string]Policy)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse metadata policies: %w", err)
+			}
+		} else {
+			e.mu.RLock()
+			for id, p := range e.policies {
+				current[id] = p
+			}
+			e.mu.RUnlock()
+		}
+		if policy.IsEmpty() {
+			delete(current, tenantID)
+		} else {
+			current[tenantID] = policy
+		}
+		return current, nil
+	}
+
+	var next map[string]Policy
+	if e.shared == nil {
+		next, _ = apply(nil)
+	} else {
+		// Applied to the stored policies, again if another node changed them
+		// meanwhile, so every tenant's change is kept
+		err := e.shared.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if next, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(next)
+		})
+		if err != nil {
+			return Policy{}, err
+		}
+	}
+
+	e.mu.Lock()
+	e.policies = next
+	e.mu.Unlock()
+	return policy, nil
+}
+
+// Load replaces the in-memory policies with those in the store
+func (e *Engine) Load(ctx context.Context) error {
+	if e.shared == nil {
+		return nil
+	}
+
+	data, err := e.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the policies set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	policies := make(map[string]Policy)
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return fmt.Errorf("parse metadata policies: %w", err)
+	}
+
+	e.mu.Lock()
+	e.policies = policies
+	e.mu.Unlock()
+	return nil
+}
+
+// Run reloads policies periodically so changes made on other nodes propagate
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("metapolicy")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload metadata policies")
+			}
+		}
+	}
+}
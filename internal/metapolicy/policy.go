@@ -0,0 +1,70 @@
+package metapolicy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy validation errors
+var (
+	ErrInvalidPattern = errors.New("invalid key pattern")
+	ErrTooManyKeys    = errors.New("too many key patterns")
+)
+
+// MaxPatterns bounds the allow and deny lists of a tenant
+const MaxPatterns = 100
+
+// Policy is a tenant's metadata key allow/deny lists. Patterns are
+// lower-case keys or globs (e.g. "x-*"). When Allow is non-empty, keys
+// matching none of its patterns are stripped; keys matching Deny are always
+// stripped.
+type Policy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// IsEmpty reports whether the policy strips nothing
+func (p Policy) IsEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// normalize lowercases patterns like NormalizeStage does metadata keys
+func (p *Policy) normalize() {
+	p.Allow = normalizePatterns(p.Allow)
+	p.Deny = normalizePatterns(p.Deny)
+}
+
+func normalizePatterns(patterns []string) []string {
+	var out []string
+	for _, pattern := range patterns {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+			out = append(out, pattern)
+		}
+	}
+	return out
+}
+
+// Validate checks the patterns are well-formed
+func (p Policy) Validate() error {
+	if len(p.Allow) > MaxPatterns || len(p.Deny) > MaxPatterns {
+		return fmt.Errorf("%w: max %d per list", ErrTooManyKeys, MaxPatterns)
+	}
+	for _, pattern := range append(append([]string(nil), p.Allow...), p.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidPattern, pattern)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether key matches one of the patterns
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
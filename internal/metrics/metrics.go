@@ -6,7 +6,8 @@ import (
 )
 
 var (
-	// HTTP metrics
+	// HTTP metrics. The endpoint label is the matched route pattern
+	// (/admin/jobs/{id}), not the raw path.
 	HTTPRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "parsec_http_requests_total",
@@ -42,13 +43,35 @@ var (
 		[]string{"method", "endpoint"},
 	)
 
+	HTTPConnectionsOpened = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_http_connections_opened_total",
+			Help: "Total number of client connections accepted by the HTTP server",
+		},
+	)
+
+	HTTPConnectionsActive = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_http_connections_active",
+			Help: "Number of open client connections to the HTTP server",
+		},
+	)
+
+	HTTPRequestsByProtocol = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_http_requests_by_protocol_total",
+			Help: "Total number of HTTP requests by protocol version",
+		},
+		[]string{"protocol"},
+	)
+
 	// Ingest metrics
 	IngestEventsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "parsec_ingest_events_total",
 			Help: "Total number of events received",
 		},
-		[]string{"tenant_id", "status"}, // status: accepted, rejected
+		[]string{"tenant_id", "status"}, // status: accepted, rejected, dropped
 	)
 
 	IngestBatchSize = promauto.NewHistogram(
@@ -67,6 +90,213 @@ var (
 		[]string{"error_type"},
 	)
 
+	IngestMessagesTruncated = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_ingest_messages_truncated_total",
+			Help: "Total number of over-long messages truncated instead of rejected",
+		},
+		[]string{"tenant_id"},
+	)
+
+	IngestPresetMatches = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_ingest_preset_events_total",
+			Help: "Total number of events handled by a format preset",
+		},
+		[]string{"preset", "result"}, // result: parsed, unparsed
+	)
+
+	IngestEventBytes = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_ingest_event_size_bytes",
+			Help:    "Canonical (JSON-encoded) size of events as received",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+		},
+		[]string{"tenant_id"},
+	)
+
+	// Multi-line reassembly metrics
+	MultilineLinesMerged = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_multiline_lines_merged_total",
+			Help: "Total number of continuation lines merged into a previous event",
+		},
+	)
+
+	MultilineTimeoutFlushes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_multiline_flushes_total",
+			Help: "Total number of reassembled events flushed by timeout or shutdown",
+		},
+	)
+
+	// Tenant script metrics
+	ScriptExecutions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_script_executions_total",
+			Help: "Total number of tenant script evaluations",
+		},
+		[]string{"tenant_id", "status"}, // status: ok, filtered, error, disabled
+	)
+
+	// Metadata policy metrics
+	MetadataKeysStripped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_metadata_keys_stripped_total",
+			Help: "Total number of metadata keys stripped by deny lists or tenant allowlists",
+		},
+		[]string{"tenant_id", "reason"}, // reason: deny, allowlist
+	)
+
+	MetadataValuesTruncated = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_metadata_values_truncated_total",
+			Help: "Total number of metadata values truncated to the size limit",
+		},
+		[]string{"tenant_id"},
+	)
+
+	// Tenant field type metrics
+	MetadataCoercions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_metadata_coercions_total",
+			Help: "Total number of metadata values coerced by tenant field type rules",
+		},
+		[]string{"tenant_id", "result"}, // result: ok, failed
+	)
+
+	// Tenant schema validation metrics
+	SchemaValidations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_schema_validations_total",
+			Help: "Total number of events validated against tenant metadata schemas",
+		},
+		[]string{"tenant_id", "result"}, // result: valid, flagged, rejected
+	)
+
+	// Browser error reporting metrics
+	BrowserReports = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_browser_reports_total",
+			Help: "Total number of browser error reports received",
+		},
+		[]string{"tenant_id"},
+	)
+
+	BrowserFrames = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_browser_stack_frames_total",
+			Help: "Total number of browser stack frames, by whether a source map resolved them",
+		},
+		[]string{"tenant_id", "result"}, // result: symbolicated, unmapped
+	)
+
+	// Sentry envelope metrics
+	SentryItems = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_sentry_envelope_items_total",
+			Help: "Total number of Sentry envelope items received, by item type",
+		},
+		[]string{"tenant_id", "type"}, // type: event, log, or a skipped type such as transaction
+	)
+
+	// Startup metrics
+	StartupDependencyReady = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_startup_dependency_ready",
+			Help: "Whether a dependency waited for at startup was reachable (1) or not (0)",
+		},
+		[]string{"dependency"}, // dependency: kafka, redis, storage
+	)
+
+	StartupWaitSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_startup_wait_seconds",
+			Help: "Time spent waiting for dependencies at startup",
+		},
+	)
+
+	// Memory watchdog metrics
+	MemoryUsageBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_memory_usage_bytes",
+			Help: "Memory counted against the memory limit, as last sampled by the watchdog",
+		},
+	)
+
+	MemoryLimitBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_memory_limit_bytes",
+			Help: "Memory limit the watchdog sheds load against",
+		},
+	)
+
+	MemoryShedLevel = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_memory_shed_level",
+			Help: "Current load shedding level (0 none, 1 queue shrunk, 2 debug rejected, 3 forced flushes)",
+		},
+	)
+
+	MemoryShedActivations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_memory_shed_activations_total",
+			Help: "Total number of times memory pressure raised load shedding to a level",
+		},
+		[]string{"level"}, // level: shrink_queue, reject_debug, flush
+	)
+
+	MemoryShedEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_memory_shed_events_total",
+			Help: "Total number of events rejected by memory load shedding",
+		},
+		[]string{"tenant_id"},
+	)
+
+	MemoryForcedFlushes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_memory_forced_flushes_total",
+			Help: "Total number of buffer flushes forced by memory pressure",
+		},
+	)
+
+	// WASM plugin metrics
+	PluginCalls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_plugin_calls_total",
+			Help: "Total number of WASM plugin invocations",
+		},
+		[]string{"plugin", "status"}, // status: ok, dropped, error, timeout
+	)
+
+	PluginDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_plugin_duration_seconds",
+			Help:    "WASM plugin invocation latency in seconds",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05},
+		},
+		[]string{"plugin"},
+	)
+
+	// Request capture
+	RequestCaptures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_request_captures_total",
+			Help: "Requests sampled for debugging, by result (captured, rate_limited)",
+		},
+		[]string{"result"},
+	)
+
+	// Windowed rates
+	RatePerSecond = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_rate_per_second",
+			Help: "Per-second rate averaged over the window (1m, 5m, 15m EWMA), by stream",
+		},
+		[]string{"stream", "window"},
+	)
+
 	// Worker metrics
 	WorkerQueueSize = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -82,6 +312,42 @@ var (
 		},
 	)
 
+	QueueSlowConsumer = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_queue_slow_consumer",
+			Help: "1 while the worker queue has stayed full past the overflow grace period",
+		},
+	)
+
+	QueueOverflowDecisions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_queue_overflow_decisions_total",
+			Help: "Overflow policy decisions taken while the worker queue was full",
+		},
+		[]string{"policy", "decision"}, // decision: rejected, evicted, spilled, spill_failed, replayed
+	)
+
+	QueueBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_queue_bytes",
+			Help: "Bytes of events buffered between ingest and publishing (queue and worker batches)",
+		},
+	)
+
+	QueueMaxBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_queue_max_bytes",
+			Help: "Limit on the bytes of events buffered between ingest and publishing",
+		},
+	)
+
+	QueueBytesExceeded = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_queue_bytes_exceeded_total",
+			Help: "Total number of envelopes that found the buffered byte limit reached",
+		},
+	)
+
 	WorkerProcessedTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "parsec_worker_processed_total",
@@ -96,12 +362,29 @@ var (
 		},
 	)
 
-	WorkerBatchPublishDuration = promauto.NewHistogram(
+	WorkerBatchPublishDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "parsec_worker_batch_publish_duration_seconds",
 			Help:    "Time taken to publish a batch to Kafka",
 			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
 		},
+		[]string{"worker_id"}, // worker index, or "aggregator" for merged batches
+	)
+
+	WorkerQueueWait = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_worker_queue_wait_seconds",
+			Help:    "Time from an envelope being received to a worker taking it off the queue",
+			Buckets: []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+		},
+		[]string{"worker_id"},
+	)
+
+	WorkerBatchesCompacted = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_worker_batches_compacted_total",
+			Help: "Total number of partial worker batches merged before publishing",
+		},
 	)
 
 	// Kafka producer metrics
@@ -113,12 +396,46 @@ var (
 		[]string{"status"}, // status: success, failed
 	)
 
-	KafkaPublishDuration = promauto.NewHistogram(
+	KafkaPublishDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "parsec_kafka_publish_duration_seconds",
 			Help:    "Time taken to publish to Kafka",
 			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
 		},
+		[]string{"writer"}, // pool slot, below the maximum pool size
+	)
+
+	// Kafka topic layout, from the metadata cache
+	KafkaTopicPartitions = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_kafka_topic_partitions",
+			Help: "Number of partitions of each topic Parsec writes to",
+		},
+		[]string{"topic"},
+	)
+
+	KafkaTopicLeaders = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_kafka_topic_leader_partitions",
+			Help: "Number of a topic's partitions each broker leads",
+		},
+		[]string{"topic", "broker"},
+	)
+
+	KafkaTopicLeaderImbalance = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_kafka_topic_leader_imbalance",
+			Help: "Most partitions one broker leads over an even share across the topic's brokers (1 = balanced)",
+		},
+		[]string{"topic"},
+	)
+
+	KafkaTopicUnderReplicated = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_kafka_topic_under_replicated_partitions",
+			Help: "Number of a topic's partitions with replicas out of sync",
+		},
+		[]string{"topic"},
 	)
 
 	KafkaPublishRetries = promauto.NewCounter(
@@ -135,6 +452,682 @@ var (
 		},
 	)
 
+	KafkaEnvelopesCompressed = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_envelopes_compressed_total",
+			Help: "Total number of envelopes individually compressed before publish",
+		},
+	)
+
+	KafkaEnvelopeBytesSaved = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_envelope_bytes_saved_total",
+			Help: "Total bytes saved by per-envelope compression",
+		},
+	)
+
+	KafkaEnvelopesEncrypted = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_envelopes_encrypted_total",
+			Help: "Total number of envelopes encrypted with a tenant key",
+		},
+	)
+
+	KafkaEncryptionFailures = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_encryption_failures_total",
+			Help: "Envelopes not published because tenant encryption failed",
+		},
+	)
+
+	KafkaShaperDelay = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "parsec_kafka_shaper_delay_seconds",
+			Help:    "Time writes were held back by the Kafka write shaper",
+			Buckets: []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+	)
+
+	KafkaWriterPoolSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_kafka_writer_pool_size",
+			Help: "Number of Kafka writers in the producer pool",
+		},
+	)
+
+	KafkaWriterPoolResizes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_writer_pool_resizes_total",
+			Help: "Total number of Kafka writer pool resizes",
+		},
+		[]string{"direction"}, // direction: grow, shrink
+	)
+
+	KafkaWriterEvictions = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_writer_evictions_total",
+			Help: "Total number of Kafka writers evicted for a high error rate and recreated",
+		},
+	)
+
+	KafkaPartitionPinMisses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_partition_pin_misses_total",
+			Help: "Messages of pinned tenants hashed across all partitions because the topic has none in the pinned range",
+		},
+		[]string{"tenant_id"},
+	)
+
+	KafkaPartitionOverrideMisses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_kafka_partition_override_misses_total",
+			Help: "Messages balanced as usual because the partition they named doesn't exist or is outside the tenant's pinned range",
+		},
+		[]string{"topic"},
+	)
+
+	// Kafka consumer handler metrics
+	ConsumerHandledTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_consumer_handled_total",
+			Help: "Total number of consumed envelopes handled",
+		},
+		[]string{"result"}, // result: success, error
+	)
+
+	ConsumerHandleDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "parsec_consumer_handle_duration_seconds",
+			Help:    "Time taken to handle a consumed envelope",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+	)
+
+	EnvelopeStageDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_envelope_stage_duration_seconds",
+			Help:    "Time envelopes handled by consumers took to reach each stage from the one before",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"stage"}, // stage: dequeued, published, persisted, total
+	)
+
+	ConsumerRetries = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_consumer_retries_total",
+			Help: "Total number of consumed envelopes retried after a handler error",
+		},
+	)
+
+	ConsumerDeadLettered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_consumer_dead_lettered_total",
+			Help: "Consumed envelopes the handler failed on, by whether the dead-letter publish succeeded",
+		},
+		[]string{"result"}, // result: success, error
+	)
+
+	// Message bus publisher metrics (NATS, Kinesis, Pub/Sub, AMQP)
+	BusPublishTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_bus_publish_total",
+			Help: "Total number of messages published to the message bus",
+		},
+		[]string{"backend", "status"}, // status: success, failed
+	)
+
+	BusPublishDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_bus_publish_duration_seconds",
+			Help:    "Time taken to publish a batch to the message bus, including retries",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"backend"},
+	)
+
+	BusPublishRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_bus_publish_retries_total",
+			Help: "Total number of message bus publish retries",
+		},
+		[]string{"backend"},
+	)
+
+	BusDeadLettered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_bus_dead_lettered_total",
+			Help: "Total number of rejected messages published to the dead-letter topic",
+		},
+		[]string{"backend"},
+	)
+
+	AMQPReconnects = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_amqp_reconnects_total",
+			Help: "Total number of AMQP connections re-established after the broker closed one",
+		},
+	)
+
+	// Local file sink
+	FileSinkEnvelopes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_filesink_envelopes_total",
+			Help: "Total number of envelopes written by the file sink",
+		},
+		[]string{"status"}, // status: success, failed
+	)
+
+	FileSinkRotations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_filesink_rotations_total",
+			Help: "Total number of file sink files completed",
+		},
+		[]string{"reason"}, // reason: size, age, shutdown
+	)
+
+	// Edge forwarding
+	ForwardEnvelopes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_forward_envelopes_total",
+			Help: "Total number of envelopes handled by the edge forwarder",
+		},
+		[]string{"status"}, // status: forwarded, rejected, buffer_full
+	)
+
+	ForwardRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_forward_requests_total",
+			Help: "Total number of forward requests sent to the central node",
+		},
+		[]string{"status"}, // status: success, failed
+	)
+
+	ForwardBufferedBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_forward_buffered_bytes",
+			Help: "Bytes buffered on disk awaiting forwarding",
+		},
+	)
+
+	ForwardReceived = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_forward_received_total",
+			Help: "Total number of forwarded envelopes received from edge nodes",
+		},
+		[]string{"status"}, // status: accepted, rejected, queue_full
+	)
+
+	ForwardStreams = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_forward_streams",
+			Help: "Edge node streams currently connected to the grpc forwarding listener",
+		},
+	)
+
+	ForwardStreamBatches = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_forward_stream_batches_total",
+			Help: "Total number of batches received on forwarding streams",
+		},
+		[]string{"status"}, // status: complete, partial, discarded
+	)
+
+	// Multi-region
+	RegionMirrorEnvelopes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_region_mirror_envelopes_total",
+			Help: "Total number of envelopes mirrored to the remote region",
+		},
+		[]string{"status"}, // status: mirrored, failed, dropped
+	)
+
+	RegionMirrorQueued = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_region_mirror_queued",
+			Help: "Envelopes waiting to be mirrored to the remote region",
+		},
+	)
+
+	RegionDuplicates = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_region_duplicates_total",
+			Help: "Total number of consumed envelopes dropped as already handled",
+		},
+		[]string{"region"}, // region the dropped copy was ingested in
+	)
+
+	// Self-monitoring metrics
+	SelfMonitorEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_selfmon_events_total",
+			Help: "Total number of internal log events handled by the self-monitoring hook",
+		},
+		[]string{"status"}, // status: enqueued, rate_limited, suppressed, dropped, reentrant, closed
+	)
+
+	// systemd journal input metrics
+	JournalEntries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_journal_entries_total",
+			Help: "Total number of systemd journal entries read",
+		},
+		[]string{"status"}, // status: ingested, rejected, malformed
+	)
+
+	JournalRestarts = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_journal_restarts_total",
+			Help: "Total number of times journalctl was restarted after exiting",
+		},
+	)
+
+	// File tailing input metrics
+	TailLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_tail_lines_total",
+			Help: "Total number of lines read from tailed files",
+		},
+		[]string{"status"}, // status: ingested, rejected
+	)
+
+	TailFilesOpen = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_tail_files_open",
+			Help: "Number of files currently being tailed",
+		},
+	)
+
+	TailRotations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_tail_rotations_total",
+			Help: "Total number of tailed files rotated, removed or truncated",
+		},
+		[]string{"kind"}, // kind: rotated, truncated
+	)
+
+	// Docker container log input metrics
+	DockerLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_docker_lines_total",
+			Help: "Total number of container log lines read",
+		},
+		[]string{"stream", "status"}, // stream: stdout, stderr; status: ingested, rejected
+	)
+
+	DockerContainersFollowed = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_docker_containers_followed",
+			Help: "Number of containers whose logs are being followed",
+		},
+	)
+
+	// Upstream Kafka topic input metrics
+	UpstreamMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_upstream_messages_total",
+			Help: "Total number of messages consumed from upstream Kafka topics",
+		},
+		[]string{"topic", "status"}, // status: ingested, rejected, malformed
+	)
+
+	// MQTT bridge metrics
+	MQTTMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_mqtt_messages_total",
+			Help: "Total number of messages received from MQTT topics",
+		},
+		[]string{"status"}, // status: ingested, rejected, malformed
+	)
+
+	// Heartbeat (dead-man's switch) metrics
+	HeartbeatAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_heartbeat_alerts_total",
+			Help: "Total number of heartbeat alerts raised for silent sources and their recoveries",
+		},
+		[]string{"status"}, // status: missing, recovered
+	)
+
+	// Saved search metrics
+	SearchRuns = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_search_runs_total",
+			Help: "Total number of scheduled saved search runs by result",
+		},
+		[]string{"result"}, // result: succeeded, failed
+	)
+
+	SearchAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_search_alerts_total",
+			Help: "Total number of saved search alerts raised and resolved",
+		},
+		[]string{"status"}, // status: firing, resolved
+	)
+
+	// SLO (error budget) metrics
+	SLOEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_slo_events_total",
+			Help: "Total number of events counted against each SLO, good or bad",
+		},
+		[]string{"slo", "result"}, // result: good, bad
+	)
+
+	SLOBurnRate = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_slo_burn_rate",
+			Help: "How many times faster than sustainable each SLO's error budget was spent over the window (5m, 30m, 1h, 6h)",
+		},
+		[]string{"slo", "window"},
+	)
+
+	SLOBudgetRemaining = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_slo_error_budget_remaining",
+			Help: "Share of each SLO's error budget left over the SLO window, negative once overspent",
+		},
+		[]string{"slo"},
+	)
+
+	SLOAlerts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_slo_alerts_total",
+			Help: "Total number of SLO burn rate alerts raised and recovered",
+		},
+		[]string{"slo", "level"}, // level: fast_burn, slow_burn, recovered
+	)
+
+	// Canary (synthetic event) metrics
+	CanaryEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_canary_events_total",
+			Help: "Total number of canary events sent, confirmed delivered, or lost after the canary timeout",
+		},
+		[]string{"result"}, // result: sent, delivered, lost
+	)
+
+	CanaryLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "parsec_canary_latency_seconds",
+			Help:    "Time from sending a canary event to seeing it at each stage",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"stage"}, // stage: published, kafka, storage
+	)
+
+	CanaryLastDelivered = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_canary_last_delivered_timestamp_seconds",
+			Help: "Unix time a canary event was last confirmed delivered",
+		},
+	)
+
+	// Batch receipt metrics
+	ReceiptsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_receipts_total",
+			Help: "Total number of batch receipts issued, by whether they were stored for /batches/{id}",
+		},
+		[]string{"result"},
+	)
+
+	AsyncBatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_async_batches_total",
+			Help: "Total number of ?mode=async batches staged, refused for lack of room, completed or failed as a whole",
+		},
+		[]string{"result"},
+	)
+
+	AsyncStagedBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_async_staged_bytes",
+			Help: "Bytes of async batches staged but not yet ingested",
+		},
+	)
+
+	AsyncBatchDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "parsec_async_batch_duration_seconds",
+			Help:    "Time from staging an async batch to its receipt being completed",
+			Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+	)
+
+	// Resumable upload metrics
+	UploadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_uploads_total",
+			Help: "Total number of resumable uploads by status transition",
+		},
+		[]string{"status"}, // status: created, committed, completed, failed, aborted
+	)
+
+	UploadBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_upload_bytes_total",
+			Help: "Total number of bytes received in resumable upload chunks",
+		},
+	)
+
+	// Remote-write metrics
+	RemoteWritePushes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_remote_write_pushes_total",
+			Help: "Total number of metric pushes to the remote-write endpoint, by result",
+		},
+		[]string{"result"}, // result: sent, failed
+	)
+
+	RemoteWriteSeries = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_remote_write_series_total",
+			Help: "Total number of series samples sent to the remote-write endpoint",
+		},
+	)
+
+	// Authorization metrics
+	AuthzDenials = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_authz_denials_total",
+			Help: "Total number of requests and events refused by role-based access control",
+		},
+		[]string{"permission", "reason"}, // reason: unauthenticated, forbidden
+	)
+
+	AuthKeyExpiry = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_auth_key_expiry_timestamp_seconds",
+			Help: "Unix time at which the last unexpired API key with each ID expires; absent for IDs with a key that never expires",
+		},
+		[]string{"key_id"},
+	)
+
+	AuthExpiringKeyRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_auth_expiring_key_requests_total",
+			Help: "Total number of requests authenticated with API keys due to expire within the warning window",
+		},
+		[]string{"key_id"},
+	)
+
+	// Tenant suspension metrics
+	TenantsSuspended = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_tenants_suspended",
+			Help: "Number of tenants whose ingestion is suspended",
+		},
+		[]string{"mode"}, // paused, blocked
+	)
+
+	// Tenant tier metrics
+	TenantTiers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_tenant_tiers",
+			Help: "Number of tenants assigned each service tier, not counting those on the default tier",
+		},
+		[]string{"tier"}, // bronze, silver, gold
+	)
+
+	SuspendedIngestRefused = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_ingest_suspended_refused_total",
+			Help: "Total number of requests and events refused because their tenant is suspended",
+		},
+		[]string{"tenant_id", "mode", "stage"}, // stage: request, event
+	)
+
+	// Abuse detection metrics
+	AbuseFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_abuse_failures_total",
+			Help: "Total number of failed requests counted towards abuse thresholds",
+		},
+		[]string{"kind"}, // validation, auth
+	)
+
+	AbuseActions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_abuse_actions_total",
+			Help: "Total number of requests delayed or refused as abusive",
+		},
+		[]string{"action"}, // tarpit, block
+	)
+
+	AbuseBlockedSources = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_abuse_blocked_sources",
+			Help: "Number of API keys and IPs currently blocked for failing requests",
+		},
+	)
+
+	// Rate limiting
+	RateLimitedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_ratelimit_rejected_total",
+			Help: "Total number of requests rejected by the per-caller rate limit",
+		},
+		[]string{"endpoint"},
+	)
+
+	// Request signing
+	SignedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_signed_requests_total",
+			Help: "Total number of signature checks on signed ingest requests",
+		},
+		[]string{"result"}, // result: valid, missing, invalid, expired, replayed, error
+	)
+
+	// Storage write buffering
+	StorageFlushes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_storage_flushes_total",
+			Help: "Total number of buffered storage flushes",
+		},
+		[]string{"reason", "status"}, // reason: size, interval, shutdown; status: success, failed
+	)
+
+	StorageBufferedRows = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "parsec_storage_buffered_rows",
+			Help: "Rows buffered in memory awaiting a storage flush",
+		},
+	)
+
+	StorageSpilledRows = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_storage_spilled_rows_total",
+			Help: "Rows written to the spill file because they could not be flushed on shutdown",
+		},
+	)
+
+	// Background jobs
+	JobsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_jobs_total",
+			Help: "Background jobs by kind and status transition",
+		},
+		[]string{"kind", "status"}, // status: pending, succeeded, failed, cancelled
+	)
+
+	JobsRunning = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "parsec_jobs_running",
+			Help: "Background jobs running on this node by kind",
+		},
+		[]string{"kind"},
+	)
+
+	// Tenant exports
+	ExportJobs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_export_jobs_total",
+			Help: "Tenant export jobs by status transition",
+		},
+		[]string{"status"}, // status: pending, succeeded, failed
+	)
+
+	ExportedEvents = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "parsec_exported_events_total",
+			Help: "Total number of events written by tenant exports",
+		},
+	)
+
+	// Reprocessing jobs
+	ReprocessJobs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_reprocess_jobs_total",
+			Help: "Reprocessing jobs by status transition",
+		},
+		[]string{"status"}, // status: pending, succeeded, failed
+	)
+
+	ReprocessedEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_reprocessed_events_total",
+			Help: "Events read by reprocessing jobs by outcome",
+		},
+		[]string{"result"}, // result: written, dropped, failed, skipped
+	)
+
+	// Tenant data erasure
+	ErasureJobs = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_erasure_jobs_total",
+			Help: "Tenant erasure jobs by status transition",
+		},
+		[]string{"status"}, // status: pending, succeeded, failed
+	)
+
+	// Usage reports
+	UsageReports = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_usage_reports_total",
+			Help: "Monthly usage report jobs by status transition",
+		},
+		[]string{"status"}, // status: pending, succeeded, failed, cancelled
+	)
+
+	ErasedEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_erased_events_total",
+			Help: "Total number of events deleted by erasure jobs",
+		},
+		[]string{"target"},
+	)
+
+	// Query result cache
+	QueryCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "parsec_query_cache_requests_total",
+			Help: "Cached queries by result",
+		},
+		[]string{"result"}, // result: hit, miss, error
+	)
+
 	// Panic recovery
 	PanicsRecovered = promauto.NewCounterVec(
 		prometheus.CounterOpts{
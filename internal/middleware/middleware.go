@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"runtime/debug"
@@ -9,8 +13,13 @@ import (
 
 	"github.com/google/uuid"
 
+	"parsec/internal/abuse"
 	"parsec/internal/logger"
 	"parsec/internal/metrics"
+	"parsec/internal/ratelimit"
+	"parsec/internal/rbac"
+	"parsec/internal/signing"
+	"parsec/internal/suspension"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status and size
@@ -34,6 +43,12 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming handlers can flush
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Auth middleware validates the X-API-Key header against an env var
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -72,7 +87,315 @@ func Auth(next http.Handler) http.Handler {
 	})
 }
 
-// Logging middleware logs all HTTP requests with structured logging
+// Authorize authenticates requests with authn and requires perm of the
+// caller, refusing others with 401 or 403 and an audit log entry. PermManage
+// routes only need PermRead for GET and HEAD. The tenant acted on is the
+// {tenant} path value; callers limited to some tenants can't reach routes
+// without one, which act on the whole node, except ingest, whose handlers
+// check each event's tenant against the caller in the context. Responses
+// to callers with an expiring key carry X-API-Key-Expires.
+func Authorize(authn *rbac.Authenticator, perm rbac.Permission) func(http.Handler) http.Handler {
+	return authorize(authn, perm, false)
+}
+
+// AuthorizeScoped is Authorize for routes that act on the tenant named by
+// the X-Scope-OrgID header when the path has none, like the Loki query API.
+// Node-wide routes must not use it, or limited callers could reach them by
+// naming their own tenant.
+func AuthorizeScoped(authn *rbac.Authenticator, perm rbac.Permission) func(http.Handler) http.Handler {
+	return authorize(authn, perm, true)
+}
+
+func authorize(authn *rbac.Authenticator, perm rbac.Permission, scoped bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			need := perm
+			if need == rbac.PermManage && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				need = rbac.PermRead
+			}
+			tenantID := r.PathValue("tenant")
+			if tenantID == "" && scoped {
+				tenantID = r.Header.Get("X-Scope-OrgID")
+			}
+
+			principal, err := authn.Authenticate(r)
+			if err != nil {
+				rbac.Denial(nil, need, tenantID).
+					Str("request_id", r.Header.Get("X-Request-ID")).
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Err(err).
+					Msg("request not authenticated")
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+				return
+			}
+
+			allowed := principal.Can(need, tenantID) ||
+				(need == rbac.PermIngest && tenantID == "" && principal.Has(need))
+			if !allowed {
+				rbac.Denial(principal, need, tenantID).
+					Str("request_id", r.Header.Get("X-Request-ID")).
+					Str("remote_addr", r.RemoteAddr).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("request not authorized")
+				http.Error(w, fmt.Sprintf(`{"error":"role %s may not %s here"}`, principal.Role, need), http.StatusForbidden)
+				return
+			}
+
+			if principal.KeyID != "" && !principal.ExpiresAt.IsZero() {
+				w.Header().Set("X-API-Key-Expires", principal.ExpiresAt.UTC().Format(time.RFC3339))
+			}
+			next.ServeHTTP(w, r.WithContext(rbac.NewContext(r.Context(), principal)))
+		})
+	}
+}
+
+// Abuse counts failed requests (auth errors and invalid payloads) against
+// their API key and client IP, delays requests of tarpitted sources and
+// refuses blocked ones with 429, Retry-After and code "source_blocked". A
+// nil detector disables it. Store errors fail open.
+func Abuse(detector *abuse.Detector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if detector == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, key := detector.Sources(r)
+			block, blocked, delay := detector.Check(ip, key)
+			if blocked {
+				metrics.AbuseActions.WithLabelValues("block").Inc()
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(time.Until(block.Until).Seconds())+1))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(map[string]any{
+					"success": false,
+					"error":   "too many failed requests from this source, try again later",
+					"code":    "source_blocked",
+				})
+				return
+			}
+			if delay > 0 {
+				metrics.AbuseActions.WithLabelValues("tarpit").Inc()
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				}
+			}
+
+			wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(wrapped, r)
+
+			kind, failed := abuse.Classify(wrapped.status)
+			if !failed {
+				return
+			}
+			// Bad credentials say nothing about the key presented, so they
+			// count against the IP
+			source := key
+			if kind == abuse.KindAuth || source == "" {
+				source = ip
+			}
+			if err := detector.Record(r.Context(), source, kind); err != nil {
+				log := logger.Logger.With().
+					Str("request_id", r.Header.Get("X-Request-ID")).
+					Str("source", source).
+					Logger()
+				log.Warn().Err(err).Msg("abuse check failed, not counting request")
+			}
+		})
+	}
+}
+
+// pausedRetryAfter is how long callers of a paused tenant are asked to
+// wait, unless the pause ends sooner
+const pausedRetryAfter = time.Minute
+
+// Suspended refuses requests for tenants whose ingestion is paused (503
+// with Retry-After) or blocked (403), with a "tenant_paused" or
+// "tenant_blocked" code. The tenant is the {tenant} path value or the
+// X-Scope-OrgID header; requests without one are refused when every tenant
+// the caller is limited to is suspended. Other requests go through, and
+// ingest checks each event's tenant. A nil registry disables the check.
+func Suspended(registry *suspension.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if registry == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID := r.PathValue("tenant")
+			if tenantID == "" {
+				tenantID = r.Header.Get("X-Scope-OrgID")
+			}
+
+			var (
+				s         suspension.Suspension
+				suspended bool
+			)
+			if tenantID != "" {
+				s, suspended = registry.Get(tenantID)
+			} else if principal, ok := rbac.FromContext(r.Context()); ok && len(principal.Tenants) > 0 {
+				// Refused only if all are; a block applies if every one is blocked
+				suspended = true
+				for _, t := range principal.Tenants {
+					ts, ok := registry.Get(t)
+					if !ok {
+						suspended = false
+						break
+					}
+					if s.Mode == "" || ts.Mode == suspension.ModePaused {
+						s = ts
+					}
+				}
+			}
+			if !suspended {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			metrics.SuspendedIngestRefused.WithLabelValues(s.TenantID, string(s.Mode), "request").Inc()
+			status := http.StatusForbidden
+			if s.Mode == suspension.ModePaused {
+				retryAfter := pausedRetryAfter
+				if s.Until != nil {
+					retryAfter = min(retryAfter, time.Until(*s.Until))
+				}
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+				status = http.StatusServiceUnavailable
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"error":   s.Error(),
+				"code":    s.Code(),
+			})
+		})
+	}
+}
+
+// RateLimit enforces the limiter's per-caller quota and reports it in
+// X-RateLimit-* headers. A nil limiter disables limiting. Store errors fail
+// open so a state outage never blocks ingestion.
+func RateLimit(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller := ratelimit.CallerID(r)
+			quota, allowed, err := limiter.Allow(r.Context(), caller)
+			if err != nil {
+				log := logger.Logger.With().
+					Str("request_id", r.Header.Get("X-Request-ID")).
+					Str("caller", caller).
+					Logger()
+				log.Warn().Err(err).Msg("rate limit check failed, allowing request")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ratelimit.SetHeaders(w, quota)
+			if !allowed {
+				retryAfter := int(time.Until(quota.Reset).Seconds()) + 1
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+				metrics.RateLimitedRequests.WithLabelValues(r.URL.Path).Inc()
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"success":false,"error":"rate limit exceeded"}`)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Signature verifies HMAC request signatures and rejects replays. A nil
+// verifier disables verification. Bodies larger than maxBody are rejected
+// before hashing.
+func Signature(verifier *signing.Verifier, maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if verifier == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Logger.With().
+				Str("request_id", r.Header.Get("X-Request-ID")).
+				Str("remote_addr", r.RemoteAddr).
+				Str("path", r.URL.Path).
+				Logger()
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			if err != nil {
+				http.Error(w, `{"error":"request body too large"}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			err = verifier.Verify(r.Context(),
+				r.Header.Get(signing.HeaderTimestamp),
+				r.Header.Get(signing.HeaderNonce),
+				r.Header.Get(signing.HeaderSignature),
+				body,
+			)
+
+			result := "valid"
+			switch {
+			case err == nil:
+			case errors.Is(err, signing.ErrMissingSignature):
+				result = "missing"
+			case errors.Is(err, signing.ErrInvalidSignature):
+				result = "invalid"
+			case errors.Is(err, signing.ErrExpired):
+				result = "expired"
+			case errors.Is(err, signing.ErrReplayed):
+				result = "replayed"
+			default:
+				result = "error"
+			}
+			metrics.SignedRequestsTotal.WithLabelValues(result).Inc()
+
+			switch result {
+			case "valid":
+				next.ServeHTTP(w, r)
+			case "error":
+				// Fail closed: without the replay store we cannot vouch for the request
+				log.Error().Err(err).Msg("signature verification unavailable")
+				http.Error(w, `{"error":"signature verification unavailable"}`, http.StatusServiceUnavailable)
+			default:
+				log.Warn().Err(err).Msg("rejected signed request")
+				http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// unmatchedRoute labels requests that no ServeMux pattern routed
+const unmatchedRoute = "unmatched"
+
+// Route returns the ServeMux pattern the request matched (e.g.
+// "/admin/tenants/{tenant}/routes"). Unlike the path, patterns are a fixed
+// set, so they are safe as metric labels.
+func Route(r *http.Request) string {
+	if r.Pattern == "" {
+		return unmatchedRoute
+	}
+	return r.Pattern
+}
+
+// Logging middleware logs all HTTP requests with structured logging.
+// Metrics are recorded by route pattern rather than path, so tenant and
+// job IDs in paths don't each create a series.
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -92,10 +415,12 @@ func Logging(next http.Handler) http.Handler {
 
 		// Log request
 		duration := time.Since(start)
+		route := Route(r)
 		log := logger.Logger.With().
 			Str("request_id", requestID).
 			Str("method", r.Method).
 			Str("path", r.URL.Path).
+			Str("route", route).
 			Int("status", rw.status).
 			Dur("duration_ms", duration).
 			Int("size", rw.size).
@@ -111,13 +436,13 @@ func Logging(next http.Handler) http.Handler {
 		// Record metrics
 		metrics.HTTPRequestsTotal.WithLabelValues(
 			r.Method,
-			r.URL.Path,
+			route,
 			fmt.Sprintf("%d", rw.status),
 		).Inc()
 
 		metrics.HTTPRequestDuration.WithLabelValues(
 			r.Method,
-			r.URL.Path,
+			route,
 			fmt.Sprintf("%d", rw.status),
 		).Observe(duration.Seconds())
 	})
@@ -0,0 +1,273 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/upstream"
+	"parsec/pkg/models"
+)
+
+// Sink receives MQTT events; the ingest handler implements it
+type Sink interface {
+	Submit(ctx context.Context, event *models.LogEvent) error
+}
+
+// MetadataTopic records the topic a message was published to
+const MetadataTopic = "mqtt_topic"
+
+// Template variables that set event fields instead of metadata
+const (
+	varTenant = "tenant"
+	varSource = "source"
+)
+
+// Queue-full backoff bounds
+const (
+	minBackoff = 10 * time.Millisecond
+	maxBackoff = time.Second
+)
+
+// Bridge subscribes to MQTT topics and submits each message as an event.
+// Messages are acknowledged once accepted or rejected, so with QoS 1 or 2
+// and a persistent session they are ingested at least once.
+type Bridge struct {
+	client   paho.Client
+	topics   map[string]byte
+	decoder  *upstream.Decoder
+	template *Template
+	sink     Sink
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a bridge. nodeID names the client when no client ID is
+// configured.
+func New(cfg config.MQTTConfig, nodeID string, sink Sink) (*Bridge, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("mqtt broker is required")
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt QoS %d", cfg.QoS)
+	}
+	topics := make(map[string]byte)
+	for _, topic := range cfg.Topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics[topic] = byte(cfg.QoS)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("mqtt requires at least one topic")
+	}
+
+	decoder, err := upstream.NewDecoder(cfg.Format, cfg.Tenant, cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: %w", err)
+	}
+
+	b := &Bridge{topics: topics, decoder: decoder, sink: sink}
+	if cfg.TopicTemplate != "" {
+		if b.template, err = ParseTemplate(cfg.TopicTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "parsec-" + nodeID
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(cfg.CleanSession).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(time.Second).
+		SetMaxReconnectInterval(30 * time.Second).
+		// Messages are handled one at a time in order, and acknowledged
+		// only after submission
+		SetOrderMatters(true).
+		SetAutoAckDisabled(true).
+		SetOnConnectHandler(b.subscribe).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log := logger.WithComponent("mqtt")
+			log.Warn().Err(err).Msg("mqtt connection lost, reconnecting")
+		})
+
+	if cfg.CAFile != "" || cfg.CertFile != "" || cfg.KeyFile != "" {
+		tlsCfg, err := clientTLS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+
+	b.client = paho.NewClient(opts)
+	return b, nil
+}
+
+// Start connects in the background, retrying until the broker is reachable
+// or Close is called
+func (b *Bridge) Start(ctx context.Context) {
+	b.ctx, b.cancel = context.WithCancel(ctx)
+
+	log := logger.WithComponent("mqtt")
+	token := b.client.Connect()
+	go func() {
+		if token.Wait(); token.Error() != nil {
+			log.Error().Err(token.Error()).Msg("mqtt connect failed")
+		}
+	}()
+}
+
+// Close stops submitting and disconnects. A message waiting on a full
+// queue is left unacknowledged for the broker to redeliver.
+func (b *Bridge) Close() error {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.client.Disconnect(250)
+	return nil
+}
+
+// subscribe (re)subscribes after each connect; a persistent session keeps
+// the subscriptions, but a clean one or a restarted broker does not
+func (b *Bridge) subscribe(client paho.Client) {
+	log := logger.WithComponent("mqtt")
+
+	token := client.SubscribeMultiple(b.topics, b.handle)
+	go func() {
+		if token.Wait(); token.Error() != nil {
+			log.Error().Err(token.Error()).Msg("mqtt subscribe failed")
+			return
+		}
+		log.Info().Int("topics", len(b.topics)).Msg("subscribed to mqtt topics")
+	}()
+}
+
+// handle submits a message, waiting out a full queue. Waiting blocks
+// delivery of later messages, pushing back on the broker; if the queue
+// stays full past the keep-alive the connection drops and unacknowledged
+// messages are redelivered after reconnecting.
+func (b *Bridge) handle(_ paho.Client, msg paho.Message) {
+	log := logger.WithComponent("mqtt")
+
+	event, err := b.decode(msg)
+	if err != nil {
+		metrics.MQTTMessages.WithLabelValues("malformed").Inc()
+		log.Warn().Err(err).Str("topic", msg.Topic()).Msg("skipping malformed mqtt message")
+		msg.Ack()
+		return
+	}
+
+	backoff := minBackoff
+	for {
+		err = b.sink.Submit(b.ctx, event)
+		if !errors.Is(err, handlers.ErrQueueFull) {
+			break
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		// Submit modifies the event, so each attempt gets a fresh one
+		event, _ = b.decode(msg)
+	}
+
+	if err != nil {
+		metrics.MQTTMessages.WithLabelValues("rejected").Inc()
+		log.Warn().Err(err).Str("topic", msg.Topic()).Msg("mqtt message rejected")
+	} else {
+		metrics.MQTTMessages.WithLabelValues("ingested").Inc()
+	}
+	msg.Ack()
+}
+
+// decode converts a message. Tenant and source captured by the topic
+// template take precedence over the payload's, since broker ACLs control
+// who may publish to a topic but not what a device puts in its payload.
+func (b *Bridge) decode(msg paho.Message) (*models.LogEvent, error) {
+	event, err := b.decoder.Parse(msg.Payload())
+	if err != nil {
+		return nil, err
+	}
+
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Metadata == nil {
+		event.Metadata = make(models.Metadata)
+	}
+	event.Metadata[MetadataTopic] = msg.Topic()
+
+	if b.template == nil {
+		return event, nil
+	}
+	vars, ok := b.template.Match(msg.Topic())
+	if !ok {
+		return event, nil
+	}
+	for name, value := range vars {
+		switch name {
+		case varTenant:
+			event.TenantID = value
+		case varSource:
+			event.Source = value
+		default:
+			if len(event.Metadata) < models.MaxMetadataKeys {
+				event.Metadata[name] = value
+			}
+		}
+	}
+	return event, nil
+}
+
+// clientTLS builds the TLS configuration from the CA and client
+// certificate files
+func clientTLS(cfg config.MQTTConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read mqtt CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load mqtt client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
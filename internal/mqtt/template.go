@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template extracts values from topic levels. Each level of the template
+// is a literal, a {name} capturing that level, + matching any level, or a
+// final # matching the remaining levels.
+type Template struct {
+	levels []string
+}
+
+// ParseTemplate parses a topic template such as "devices/{tenant}/{device}/#"
+func ParseTemplate(template string) (*Template, error) {
+	levels := strings.Split(template, "/")
+	seen := make(map[string]bool)
+	for i, level := range levels {
+		switch {
+		case level == "#":
+			if i != len(levels)-1 {
+				return nil, fmt.Errorf("topic template %q: # must be the last level", template)
+			}
+		case strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}"):
+			name := level[1 : len(level)-1]
+			if name == "" || strings.ContainsAny(name, "{}") {
+				return nil, fmt.Errorf("topic template %q: invalid variable %q", template, level)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("topic template %q: duplicate variable %q", template, name)
+			}
+			seen[name] = true
+		case strings.ContainsAny(level, "{}#") || (strings.Contains(level, "+") && level != "+"):
+			return nil, fmt.Errorf("topic template %q: invalid level %q", template, level)
+		}
+	}
+	return &Template{levels: levels}, nil
+}
+
+// Match returns the variables captured from topic, or false if the topic
+// does not fit the template. Empty levels never match a variable.
+func (t *Template) Match(topic string) (map[string]string, bool) {
+	levels := strings.Split(topic, "/")
+	vars := make(map[string]string)
+	for i, want := range t.levels {
+		if want == "#" {
+			return vars, true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		got := levels[i]
+		switch {
+		case want == "+":
+		case strings.HasPrefix(want, "{"):
+			if got == "" {
+				return nil, false
+			}
+			vars[want[1:len(want)-1]] = got
+		case want != got:
+			return nil, false
+		}
+	}
+	if len(levels) != len(t.levels) {
+		return nil, false
+	}
+	return vars, true
+}
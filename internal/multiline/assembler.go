@@ -0,0 +1,260 @@
+package multiline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// MetadataStreamID is the metadata key distinguishing streams of the same
+// source (e.g. stdout/stderr or a container ID)
+const MetadataStreamID = "stream"
+
+// MetadataLineCount records how many lines were merged into an event
+const MetadataLineCount = "multiline_lines"
+
+// Rule describes how to recognize the first line of a multi-line event.
+// Lines that do not match StartPattern are appended to the open event.
+type Rule struct {
+	// TenantID restricts the rule to a tenant ("" or "*" matches all)
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// Source is the normalized source the rule applies to
+	Source string `json:"source"`
+
+	// StartPattern matches lines that begin a new event
+	StartPattern string `json:"start_pattern"`
+
+	// MaxLines caps the number of lines merged into one event
+	MaxLines int `json:"max_lines,omitempty"`
+
+	start *regexp.Regexp
+}
+
+// Compile validates the rule's pattern
+func (r *Rule) Compile() error {
+	if r.Source == "" {
+		return fmt.Errorf("multiline rule: source is required")
+	}
+	re, err := regexp.Compile(r.StartPattern)
+	if err != nil {
+		return fmt.Errorf("multiline rule for %q: %w", r.Source, err)
+	}
+	r.start = re
+	return nil
+}
+
+// matches reports whether the rule applies to the event
+func (r *Rule) matches(event *models.LogEvent) bool {
+	if r.TenantID != "" && r.TenantID != "*" && r.TenantID != event.TenantID {
+		return false
+	}
+	return r.Source == event.Source
+}
+
+// ParseRules parses a JSON array of rules
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse multiline rules: %w", err)
+	}
+	for i := range rules {
+		if err := rules[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// EmitFunc receives events completed by a flush
+type EmitFunc func(event *models.LogEvent)
+
+// Config holds assembler configuration
+type Config struct {
+	Rules        []Rule
+	FlushTimeout time.Duration
+	MaxLines     int
+}
+
+// pending is an event still collecting continuation lines
+type pending struct {
+	event   *models.LogEvent
+	lines   []string
+	size    int
+	rule    *Rule
+	updated time.Time
+}
+
+// Assembler merges continuation lines into single events, keyed by
+// tenant, source and stream
+type Assembler struct {
+	rules        []Rule
+	flushTimeout time.Duration
+	maxLines     int
+
+	mu      sync.Mutex
+	pending map[string]*pending
+}
+
+// NewAssembler creates an assembler. Rules must already be compiled.
+func NewAssembler(cfg Config) *Assembler {
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = 2 * time.Second
+	}
+	if cfg.MaxLines <= 0 {
+		cfg.MaxLines = 500
+	}
+
+	return &Assembler{
+		rules:        cfg.Rules,
+		flushTimeout: cfg.FlushTimeout,
+		maxLines:     cfg.MaxLines,
+		pending:      make(map[string]*pending),
+	}
+}
+
+// Add feeds a validated event into the assembler. It returns the events that
+// are complete and ready to publish, which may include the event itself if
+// no rule applies to its source.
+func (a *Assembler) Add(event *models.LogEvent) []*models.LogEvent {
+	rule := a.ruleFor(event)
+	if rule == nil {
+		return []*models.LogEvent{event}
+	}
+
+	key := streamKey(event)
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ready []*models.LogEvent
+	p, open := a.pending[key]
+
+	if open && !rule.start.MatchString(event.Message) && a.fits(p, event.Message) {
+		// Continuation line: append to the open event
+		p.lines = append(p.lines, event.Message)
+		p.size += len(event.Message) + 1
+		p.updated = now
+		metrics.MultilineLinesMerged.Inc()
+		return nil
+	}
+
+	if open {
+		ready = append(ready, p.finish())
+		delete(a.pending, key)
+	}
+
+	a.pending[key] = &pending{
+		event:   event,
+		lines:   []string{event.Message},
+		size:    len(event.Message),
+		rule:    rule,
+		updated: now,
+	}
+	return ready
+}
+
+// fits reports whether a line can be appended without exceeding limits
+func (a *Assembler) fits(p *pending, line string) bool {
+	maxLines := a.maxLines
+	if p.rule.MaxLines > 0 {
+		maxLines = p.rule.MaxLines
+	}
+	return len(p.lines) < maxLines && p.size+len(line)+1 <= models.MaxMessageLength
+}
+
+// Applies reports whether a reassembly rule covers the event
+func (a *Assembler) Applies(event *models.LogEvent) bool {
+	return a.ruleFor(event) != nil
+}
+
+// ruleFor returns the first rule applying to the event
+func (a *Assembler) ruleFor(event *models.LogEvent) *Rule {
+	for i := range a.rules {
+		if a.rules[i].matches(event) {
+			return &a.rules[i]
+		}
+	}
+	return nil
+}
+
+// Config returns the reassembly rules and limits, for introspection
+func (a *Assembler) Config() any {
+	return struct {
+		Rules        []Rule        `json:"rules"`
+		FlushTimeout time.Duration `json:"flush_timeout"`
+		MaxLines     int           `json:"max_lines"`
+	}{a.rules, a.flushTimeout, a.maxLines}
+}
+
+// Run flushes events idle for longer than the flush timeout until the
+// context is cancelled
+func (a *Assembler) Run(ctx context.Context, emit EmitFunc) {
+	ticker := time.NewTicker(a.flushTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.flush(emit, time.Now().Add(-a.flushTimeout))
+		}
+	}
+}
+
+// FlushAll emits every open event regardless of age (used on shutdown)
+func (a *Assembler) FlushAll(emit EmitFunc) {
+	a.flush(emit, time.Now().Add(time.Hour))
+}
+
+// Pending returns the number of open events
+func (a *Assembler) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// flush emits open events last updated before the cutoff
+func (a *Assembler) flush(emit EmitFunc, cutoff time.Time) {
+	a.mu.Lock()
+	var ready []*models.LogEvent
+	for key, p := range a.pending {
+		if p.updated.Before(cutoff) {
+			ready = append(ready, p.finish())
+			delete(a.pending, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, event := range ready {
+		metrics.MultilineTimeoutFlushes.Inc()
+		emit(event)
+	}
+}
+
+// finish joins the collected lines into the first event
+func (p *pending) finish() *models.LogEvent {
+	if len(p.lines) > 1 {
+		p.event.Message = strings.Join(p.lines, "\n")
+		if p.event.Metadata == nil {
+			p.event.Metadata = make(models.Metadata, 1)
+		}
+		p.event.Metadata[MetadataLineCount] = strconv.Itoa(len(p.lines))
+	}
+	return p.event
+}
+
+// streamKey identifies the stream an event belongs to
+func streamKey(event *models.LogEvent) string {
+	return event.TenantID + "\x00" + event.Source + "\x00" + event.Metadata.Get(MetadataStreamID)
+}
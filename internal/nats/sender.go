@@ -0,0 +1,155 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+)
+
+// maxInFlight bounds the asynchronous publishes awaiting acknowledgement
+const maxInFlight = 1000
+
+// Sender publishes messages to a NATS JetStream stream. Each message is
+// published with its event ID as the message ID, so retries within the
+// stream's duplicate window are deduplicated by the server.
+type Sender struct {
+	cfg  config.NATSConfig
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// Connect dials the NATS servers, ensures the stream exists and returns a
+// sender
+func Connect(ctx context.Context, cfg config.NATSConfig) (*Sender, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("NATS URL is required")
+	}
+
+	conn, err := nats.Connect(cfg.URL, nats.Name("parsec"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s, err := New(ctx, js, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// New creates a sender over a JetStream context, creating the stream over
+// SubjectPrefix + ">" if it does not exist
+func New(ctx context.Context, js jetstream.JetStream, cfg config.NATSConfig) (*Sender, error) {
+	if cfg.Stream == "" || cfg.SubjectPrefix == "" {
+		return nil, errors.New("NATS stream and subject prefix are required")
+	}
+	if cfg.PublishTimeout <= 0 {
+		cfg.PublishTimeout = 5 * time.Second
+	}
+
+	_, err := js.Stream(ctx, cfg.Stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.SubjectPrefix + ">"},
+			Storage:  jetstream.FileStorage,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: %w", cfg.Stream, err)
+	}
+
+	return &Sender{cfg: cfg, js: js}, nil
+}
+
+// Limits bounds the publishes in flight at once
+func (s *Sender) Limits() bus.Limits {
+	return bus.Limits{Messages: maxInFlight}
+}
+
+// Send publishes messages without waiting in between, then collects the
+// acknowledgements
+func (s *Sender) Send(ctx context.Context, msgs []bus.Message) []error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.PublishTimeout)
+	defer cancel()
+
+	errs := make([]error, len(msgs))
+	futures := make([]jetstream.PubAckFuture, len(msgs))
+	for i, msg := range msgs {
+		future, err := s.js.PublishMsgAsync(s.buildMessage(msg))
+		if err != nil {
+			errs[i] = classify(err)
+			continue
+		}
+		futures[i] = future
+	}
+
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs[i] = classify(err)
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	return errs
+}
+
+// classify marks errors a retry cannot fix as permanent
+func classify(err error) error {
+	if errors.Is(err, nats.ErrMaxPayload) {
+		return bus.Permanent(err)
+	}
+	return err
+}
+
+// buildMessage converts a message into a JetStream message; the topic
+// becomes a subject under the configured prefix
+func (s *Sender) buildMessage(m bus.Message) *nats.Msg {
+	msg := nats.NewMsg(s.cfg.SubjectPrefix + m.Topic)
+	msg.Data = m.Value
+	for _, h := range m.Headers {
+		msg.Header.Set(h.Key, string(h.Value))
+	}
+	if len(m.Key) > 0 {
+		msg.Header.Set("partition_key", string(m.Key))
+	}
+
+	// Lets the stream drop duplicates when a retry follows a lost ack
+	if id := msg.Header.Get("event_id"); id != "" {
+		msg.Header.Set(jetstream.MsgIDHeader, id)
+	}
+	return msg
+}
+
+// HealthCheck verifies JetStream is reachable
+func (s *Sender) HealthCheck(ctx context.Context) error {
+	_, err := s.js.AccountInfo(ctx)
+	return err
+}
+
+// Close drains the connection, flushing in-flight publishes
+func (s *Sender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Drain()
+}
@@ -0,0 +1,207 @@
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"parsec/internal/sigv4"
+)
+
+// S3Config holds S3 credentials and addressing
+type S3Config struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint overrides the AWS endpoint (e.g. MinIO) and switches to
+	// path-style addressing
+	Endpoint string
+
+	// Client is the HTTP client (nil = http.DefaultClient)
+	Client *http.Client
+}
+
+// S3ConfigFromEnv reads the standard AWS_* environment variables
+func S3ConfigFromEnv() S3Config {
+	creds := sigv4.CredentialsFromEnv()
+	return S3Config{
+		Region:          sigv4.RegionFromEnv(),
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+}
+
+// S3 is a Store over an S3 bucket, signing requests with AWS Signature V4
+type S3 struct {
+	bucket string
+	cfg    S3Config
+	base   *url.URL
+	signer sigv4.Signer
+}
+
+// NewS3 creates a bucket-backed store
+func NewS3(bucket string, cfg S3Config) (*S3, error) {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	raw := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, cfg.Region)
+	if cfg.Endpoint != "" {
+		raw = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + bucket
+	}
+	base, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	return &S3{
+		bucket: bucket,
+		cfg:    cfg,
+		base:   base,
+		signer: sigv4.Signer{
+			Credentials: sigv4.Credentials{
+				AccessKeyID:     cfg.AccessKeyID,
+				SecretAccessKey: cfg.SecretAccessKey,
+				SessionToken:    cfg.SessionToken,
+			},
+			Region:  cfg.Region,
+			Service: "s3",
+		},
+	}, nil
+}
+
+// objectURL returns the URL of a key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = sigv4.CanonicalURI(&u)
+	return &u
+}
+
+// listBucketResult is the ListObjectsV2 response
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		u := *s.base
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = query.Encode()
+
+		resp, err := s.do(ctx, http.MethodGet, &u, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode S3 listing: %w", err)
+		}
+
+		for _, c := range page.Contents {
+			if !strings.HasSuffix(c.Key, "/") {
+				objects = append(objects, Object{Key: c.Key, Size: c.Size})
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Open streams an object
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put uploads an object in a single request (S3 allows up to 5GB)
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), io.LimitReader(body, size), size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete removes an object; S3 reports success for missing keys
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// SignedURL returns a presigned GET URL (AWS limits ttl to 7 days)
+func (s *S3) SignedURL(key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > 7*24*time.Hour {
+		return "", fmt.Errorf("signed URL ttl must be between 1s and 7 days, got %s", ttl)
+	}
+	return s.signer.Presign(s.objectURL(key), ttl, time.Now().UTC()), nil
+}
+
+// do sends a signed request, returning an error for non-2xx responses
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	s.signer.Sign(req, sigv4.UnsignedPayload, time.Now().UTC())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, u.Path)
+	}
+	return nil, fmt.Errorf("S3 %s %s: %s: %s", method, u.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
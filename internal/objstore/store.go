@@ -0,0 +1,187 @@
+package objstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// Store is a flat key/object namespace backed by a directory or a bucket
+type Store interface {
+	// List returns objects whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]Object, error)
+
+	// Open streams an object
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Uploader stores objects and hands out time-limited download URLs
+type Uploader interface {
+	// Put stores size bytes read from body under key
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+
+	// SignedURL returns a URL that downloads key until ttl elapses
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Bucket is a Store that can also write and delete objects
+type Bucket interface {
+	Store
+	Uploader
+
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Parse resolves a location to a store and key prefix. Locations are
+// s3://bucket/prefix or a local file or directory path.
+func Parse(location string, s3cfg S3Config) (Store, string, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, "", fmt.Errorf("invalid S3 location %q", location)
+		}
+		store, err := NewS3(bucket, s3cfg)
+		return store, prefix, err
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, "", err
+	}
+	if info.IsDir() {
+		return NewDir(location), "", nil
+	}
+	return NewDir(filepath.Dir(location)), filepath.Base(location), nil
+}
+
+// ParseUploader resolves an upload destination: s3://bucket/prefix or a
+// local directory (created on first upload)
+func ParseUploader(location string, s3cfg S3Config) (Uploader, string, error) {
+	return ParseBucket(location, s3cfg)
+}
+
+// ParseBucket resolves a writable location: s3://bucket/prefix or a local
+// directory
+func ParseBucket(location string, s3cfg S3Config) (Bucket, string, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, "", fmt.Errorf("invalid S3 location %q", location)
+		}
+		store, err := NewS3(bucket, s3cfg)
+		return store, prefix, err
+	}
+	return NewDir(location), "", nil
+}
+
+// Dir is a Store over a local directory; keys are slash-separated paths
+// relative to the root
+type Dir struct {
+	root string
+}
+
+// NewDir creates a directory-backed store
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// List walks the directory for regular files under prefix
+func (d *Dir) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil && path == d.root && errors.Is(err, fs.ErrNotExist) {
+			// Nothing has been written yet
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Open opens a file by key
+func (d *Dir) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return f, err
+}
+
+// Put writes a file by key, creating parent directories
+func (d *Dir) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	path := filepath.Join(d.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Delete removes a file by key
+func (d *Dir) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(d.root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SignedURL returns a file:// URL; local files need no signature, so ttl is
+// ignored
+func (d *Dir) SignedURL(key string, ttl time.Duration) (string, error) {
+	path, err := filepath.Abs(filepath.Join(d.root, filepath.FromSlash(key)))
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"parsec/pkg/models"
+	pub "parsec/pkg/pipeline"
+)
+
+// The stage contract is public so services embedding Parsec can write
+// their own stages; the aliases keep this package's names working
+type (
+	Stage  = pub.Stage
+	Result = pub.Result
+)
+
+// ErrDropped is returned when a stage filters an event out
+var ErrDropped = pub.ErrDropped
+
+// StageTrace records a stage's outcome for a single event
+type StageTrace struct {
+	Stage   string `json:"stage"`
+	Changed bool   `json:"changed,omitempty"`
+	Drop    bool   `json:"drop,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Pipeline runs events through an ordered list of stages
+type Pipeline struct {
+	stages []Stage
+	stats  []*Stats
+}
+
+// New creates a pipeline from stages, skipping nil entries
+func New(stages ...Stage) *Pipeline {
+	p := &Pipeline{}
+	for _, s := range stages {
+		if s != nil {
+			p.stages = append(p.stages, s)
+			p.stats = append(p.stats, &Stats{})
+		}
+	}
+	return p
+}
+
+// Stages returns the stage names in order
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Process runs the event through every stage. It stops at the first error,
+// returning it, or at the first drop, returning ErrDropped. Stage counters
+// are not updated for dry runs.
+func (p *Pipeline) Process(ctx context.Context, event *models.LogEvent) ([]StageTrace, error) {
+	dryRun := IsDryRun(ctx)
+	traces := make([]StageTrace, 0, len(p.stages))
+	for i, s := range p.stages {
+		start := time.Now()
+		result, err := s.Process(ctx, event)
+		if !dryRun {
+			p.stats[i].Record(time.Since(start), result, err)
+		}
+
+		trace := StageTrace{
+			Stage:   s.Name(),
+			Changed: result.Changed,
+			Drop:    result.Drop,
+			Detail:  result.Detail,
+		}
+		if err != nil {
+			trace.Error = err.Error()
+			traces = append(traces, trace)
+			return traces, err
+		}
+		traces = append(traces, trace)
+		if result.Drop {
+			return traces, ErrDropped
+		}
+	}
+	return traces, nil
+}
+
+// Run runs the event through every stage like Process, without recording
+// traces; ingestion uses it to keep the per-event path allocation-free
+func (p *Pipeline) Run(ctx context.Context, event *models.LogEvent) error {
+	dryRun := IsDryRun(ctx)
+	for i, s := range p.stages {
+		start := time.Now()
+		result, err := s.Process(ctx, event)
+		if !dryRun {
+			p.stats[i].Record(time.Since(start), result, err)
+		}
+		if err != nil {
+			return err
+		}
+		if result.Drop {
+			return ErrDropped
+		}
+	}
+	return nil
+}
+
+// WithDryRun marks the context as a dry run; stages must not record
+// metrics or mutate shared state
+func WithDryRun(ctx context.Context) context.Context { return pub.WithDryRun(ctx) }
+
+// IsDryRun reports whether the context is a dry run
+func IsDryRun(ctx context.Context) bool { return pub.IsDryRun(ctx) }
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+
+	"parsec/internal/metrics"
+	"parsec/internal/presets"
+	"parsec/pkg/models"
+)
+
+// NormalizeStage applies field normalization and trace context extraction
+type NormalizeStage struct{}
+
+// Name implements Stage
+func (NormalizeStage) Name() string { return "normalize" }
+
+// Process implements Stage
+func (NormalizeStage) Process(ctx context.Context, event *models.LogEvent) (Result, error) {
+	hadTrace := event.TraceID != ""
+	event.Normalize()
+
+	result := Result{Changed: true}
+	if !hadTrace && event.TraceID != "" {
+		result.Detail = "trace_context"
+	}
+	return result, nil
+}
+
+// PresetStage applies the tenant/source format preset (extraction + severity)
+type PresetStage struct {
+	Registry *presets.Registry
+}
+
+// Name implements Stage
+func (PresetStage) Name() string { return "preset" }
+
+// Config implements Configured
+func (s PresetStage) Config() any { return s.Registry.Bindings() }
+
+// Process implements Stage
+func (s PresetStage) Process(ctx context.Context, event *models.LogEvent) (Result, error) {
+	preset, parsed := s.Registry.Apply(event)
+	if preset == "" {
+		return Result{}, nil
+	}
+
+	outcome := "unparsed"
+	if parsed {
+		outcome = "parsed"
+	}
+	if !IsDryRun(ctx) {
+		metrics.IngestPresetMatches.WithLabelValues(preset, outcome).Inc()
+	}
+	return Result{Changed: true, Detail: preset + ":" + outcome}, nil
+}
+
+// TruncateStage keeps the head and tail of over-long messages
+type TruncateStage struct {
+	Policy models.TruncationPolicy
+}
+
+// Name implements Stage
+func (TruncateStage) Name() string { return "truncate" }
+
+// Config implements Configured
+func (s TruncateStage) Config() any { return s.Policy }
+
+// Process implements Stage
+func (s TruncateStage) Process(ctx context.Context, event *models.LogEvent) (Result, error) {
+	if !event.TruncateMessage(s.Policy) {
+		return Result{}, nil
+	}
+	if !IsDryRun(ctx) {
+		metrics.IngestMessagesTruncated.WithLabelValues(event.TenantID).Inc()
+	}
+	return Result{Changed: true}, nil
+}
+
+// ValidateStage validates the event; the internal tenant is never accepted
+// from clients
+type ValidateStage struct{}
+
+// Name implements Stage
+func (ValidateStage) Name() string { return "validate" }
+
+// Process implements Stage
+func (ValidateStage) Process(ctx context.Context, event *models.LogEvent) (Result, error) {
+	if err := event.Validate(); err != nil {
+		return Result{}, err
+	}
+	if event.IsInternal() {
+		return Result{}, models.ErrReservedTenant
+	}
+	return Result{}, nil
+}
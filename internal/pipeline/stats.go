@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts the events a stage has handled. The zero value is ready to use.
+type Stats struct {
+	processed atomic.Uint64
+	changed   atomic.Uint64
+	dropped   atomic.Uint64
+	errors    atomic.Uint64
+	nanos     atomic.Uint64
+}
+
+// Record counts one event
+func (s *Stats) Record(elapsed time.Duration, result Result, err error) {
+	s.processed.Add(1)
+	s.nanos.Add(uint64(elapsed))
+	switch {
+	case err != nil:
+		s.errors.Add(1)
+	case result.Drop:
+		s.dropped.Add(1)
+	case result.Changed:
+		s.changed.Add(1)
+	}
+}
+
+// StatsSnapshot is a point-in-time copy of Stats
+type StatsSnapshot struct {
+	Processed    uint64  `json:"processed"`
+	Changed      uint64  `json:"changed"`
+	Dropped      uint64  `json:"dropped"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyUS float64 `json:"avg_latency_us"`
+}
+
+// Snapshot returns the current counters
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		Processed: s.processed.Load(),
+		Changed:   s.changed.Load(),
+		Dropped:   s.dropped.Load(),
+		Errors:    s.errors.Load(),
+	}
+	if snap.Processed > 0 {
+		snap.AvgLatencyUS = float64(s.nanos.Load()) / float64(snap.Processed) / 1e3
+	}
+	return snap
+}
+
+// Configured is implemented by stages whose configuration can change at
+// runtime, so operators can compare what is active across nodes
+type Configured interface {
+	Config() any
+}
+
+// ConfigHash returns a short, stable hash of a configuration value ("" for nil)
+func ConfigHash(config any) string {
+	if config == nil {
+		return ""
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// StageInfo describes a stage for introspection
+type StageInfo struct {
+	Name       string        `json:"name"`
+	ConfigHash string        `json:"config_hash,omitempty"`
+	Stats      StatsSnapshot `json:"stats"`
+}
+
+// Describe returns the stages in order with their config hashes and counters
+func (p *Pipeline) Describe() []StageInfo {
+	infos := make([]StageInfo, len(p.stages))
+	for i, s := range p.stages {
+		infos[i] = StageInfo{
+			Name:  s.Name(),
+			Stats: p.stats[i].Snapshot(),
+		}
+		if c, ok := s.(Configured); ok {
+			infos[i].ConfigHash = ConfigHash(c.Config())
+		}
+	}
+	return infos
+}
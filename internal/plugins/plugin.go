@@ -0,0 +1,372 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/pkg/models"
+)
+
+// Guest ABI. A plugin module exports its memory and:
+//
+//	parsec_alloc(size i32) i32              reserve size bytes for the input
+//	parsec_process(ptr i32, len i32) i64    process the JSON event at ptr
+//
+// parsec_process returns (out_ptr << 32 | out_len) pointing at a JSON event,
+// 0 to drop the event, or a negative value on error. The output is decoded
+// over the input, so plugins may return only the fields they change.
+const (
+	ExportAlloc   = "parsec_alloc"
+	ExportProcess = "parsec_process"
+)
+
+// Capabilities a plugin may be granted. Imports for capabilities that were
+// not granted are not provided, so such modules fail to load.
+const (
+	// CapabilityLog provides parsec.log(ptr i32, len i32)
+	CapabilityLog = "log"
+
+	// CapabilityWASI provides wasi_snapshot_preview1 with no filesystem,
+	// environment or network access (needed by most toolchains)
+	CapabilityWASI = "wasi"
+)
+
+// MaxOutputBytes bounds the event a plugin may return
+const MaxOutputBytes = 1 << 20
+
+// Plugin errors
+var (
+	ErrMissingExport  = errors.New("plugin does not export the parsec ABI")
+	ErrUnknownCap     = errors.New("unknown plugin capability")
+	ErrPluginFailed   = errors.New("plugin returned an error")
+	ErrOutputTooLarge = errors.New("plugin output too large")
+)
+
+// Spec describes a plugin to load
+type Spec struct {
+	// Name identifies the plugin in stage names and metrics
+	Name string `json:"name"`
+
+	// Path is the .wasm file to load
+	Path string `json:"path"`
+
+	// Tenants restricts the plugin to these tenants (empty = all)
+	Tenants []string `json:"tenants,omitempty"`
+
+	// TimeoutMS is the per-event time budget (default 10ms)
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+
+	// MemoryPages caps guest memory in 64KiB pages (default 256 = 16MiB)
+	MemoryPages uint32 `json:"memory_pages,omitempty"`
+
+	// Capabilities lists the host imports the plugin may use
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// ParseSpecs parses a JSON array of plugin specs
+func ParseSpecs(data []byte) ([]Spec, error) {
+	var specs []Spec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parse plugin specs: %w", err)
+	}
+	for _, s := range specs {
+		if s.Name == "" || s.Path == "" {
+			return nil, fmt.Errorf("parse plugin specs: name and path are required")
+		}
+	}
+	return specs, nil
+}
+
+// Plugin is a loaded WASM processor. It implements pipeline.Stage.
+type Plugin struct {
+	name    string
+	spec    Spec
+	digest  string
+	tenants map[string]bool
+	timeout time.Duration
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	pool     chan api.Module
+}
+
+// Load reads and compiles the plugin at spec.Path
+func Load(ctx context.Context, spec Spec) (*Plugin, error) {
+	wasm, err := os.ReadFile(spec.Path)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+	}
+	return New(ctx, spec, wasm)
+}
+
+// New compiles a plugin from WASM bytes; spec.Path is ignored
+func New(ctx context.Context, spec Spec, wasm []byte) (*Plugin, error) {
+	timeout := time.Duration(spec.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 10 * time.Millisecond
+	}
+	pages := spec.MemoryPages
+	if pages == 0 {
+		pages = 256
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+
+	sum := sha256.Sum256(wasm)
+	p := &Plugin{
+		name:    spec.Name,
+		spec:    spec,
+		digest:  hex.EncodeToString(sum[:]),
+		timeout: timeout,
+		runtime: runtime,
+		pool:    make(chan api.Module, 8),
+	}
+	if len(spec.Tenants) > 0 {
+		p.tenants = make(map[string]bool, len(spec.Tenants))
+		for _, t := range spec.Tenants {
+			p.tenants[t] = true
+		}
+	}
+
+	if err := p.grant(ctx, spec.Capabilities); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+	}
+
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+	}
+	p.compiled = compiled
+
+	// Instantiate once up front so ABI and import errors surface at load time
+	mod, err := p.instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+	}
+	p.release(ctx, mod)
+	return p, nil
+}
+
+// grant instantiates the host modules for the granted capabilities
+func (p *Plugin) grant(ctx context.Context, capabilities []string) error {
+	for _, c := range capabilities {
+		switch c {
+		case CapabilityWASI:
+			if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+				return err
+			}
+		case CapabilityLog:
+			_, err := p.runtime.NewHostModuleBuilder("parsec").
+				NewFunctionBuilder().
+				WithFunc(p.hostLog).
+				Export("log").
+				Instantiate(ctx)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownCap, c)
+		}
+	}
+	return nil
+}
+
+// hostLog implements parsec.log for plugins granted CapabilityLog
+func (p *Plugin) hostLog(ctx context.Context, mod api.Module, ptr, length uint32) {
+	msg, ok := mod.Memory().Read(ptr, length)
+	if !ok {
+		return
+	}
+	log := logger.WithComponent("plugins")
+	log.Info().Str("plugin", p.name).Msg(string(msg))
+}
+
+// instantiate creates a fresh module instance
+func (p *Plugin) instantiate(ctx context.Context) (api.Module, error) {
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, err
+	}
+	if mod.Memory() == nil || mod.ExportedFunction(ExportAlloc) == nil || mod.ExportedFunction(ExportProcess) == nil {
+		mod.Close(ctx)
+		return nil, ErrMissingExport
+	}
+	return mod, nil
+}
+
+// acquire returns an idle instance or creates one. Instances are not safe
+// for concurrent use.
+func (p *Plugin) acquire(ctx context.Context) (api.Module, error) {
+	select {
+	case mod := <-p.pool:
+		return mod, nil
+	default:
+		return p.instantiate(ctx)
+	}
+}
+
+// release returns an instance to the pool, closing it if the pool is full
+func (p *Plugin) release(ctx context.Context, mod api.Module) {
+	select {
+	case p.pool <- mod:
+	default:
+		mod.Close(ctx)
+	}
+}
+
+// Name implements pipeline.Stage
+func (p *Plugin) Name() string { return "plugin:" + p.name }
+
+// Config implements pipeline.Configured: the spec and module digest
+func (p *Plugin) Config() any {
+	return struct {
+		Spec   Spec   `json:"spec"`
+		SHA256 string `json:"sha256"`
+	}{p.spec, p.digest}
+}
+
+// Process implements pipeline.Stage. Plugin failures never reject an event:
+// the event passes through unchanged.
+func (p *Plugin) Process(ctx context.Context, event *models.LogEvent) (pipeline.Result, error) {
+	if p.tenants != nil && !p.tenants[event.TenantID] {
+		return pipeline.Result{}, nil
+	}
+
+	start := time.Now()
+	keep, changed, err := p.call(ctx, event)
+	status := "ok"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		status = "timeout"
+	case err != nil:
+		status = "error"
+	case !keep:
+		status = "dropped"
+	}
+
+	if !pipeline.IsDryRun(ctx) {
+		metrics.PluginCalls.WithLabelValues(p.name, status).Inc()
+		metrics.PluginDuration.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+	}
+
+	if err != nil {
+		log := logger.WithComponent("plugins")
+		log.Warn().
+			Err(err).
+			Str("plugin", p.name).
+			Str("event_id", event.ID).
+			Msg("plugin failed, passing event through")
+		return pipeline.Result{Detail: status}, nil
+	}
+	return pipeline.Result{Drop: !keep, Changed: changed}, nil
+}
+
+// call runs the plugin on the event, updating it in place
+func (p *Plugin) call(ctx context.Context, event *models.LogEvent) (keep, changed bool, err error) {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return true, false, err
+	}
+
+	// Detach from request cancellation; only the plugin's own budget applies,
+	// and it does not include instantiation
+	ctx = context.WithoutCancel(ctx)
+	mod, err := p.acquire(ctx)
+	if err != nil {
+		return true, false, err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	output, err := invoke(callCtx, mod, input)
+	if err != nil {
+		// The instance may be closed or left inconsistent; never reuse it
+		mod.Close(ctx)
+		if callCtx.Err() != nil {
+			err = fmt.Errorf("%w: %v", callCtx.Err(), err)
+		}
+		return true, false, err
+	}
+	p.release(ctx, mod)
+
+	if output == nil {
+		return false, false, nil
+	}
+	if bytes.Equal(output, input) {
+		return true, false, nil
+	}
+
+	// Plugins may not move events between tenants or rename them
+	updated := *event
+	if err := json.Unmarshal(output, &updated); err != nil {
+		return true, false, fmt.Errorf("decode plugin output: %w", err)
+	}
+	updated.ID = event.ID
+	updated.TenantID = event.TenantID
+	*event = updated
+	return true, true, nil
+}
+
+// invoke copies input into the instance and calls parsec_process. A nil
+// result means the event was dropped.
+func invoke(ctx context.Context, mod api.Module, input []byte) ([]byte, error) {
+	res, err := mod.ExportedFunction(ExportAlloc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, fmt.Errorf("%w: alloc returned out of range pointer", ErrPluginFailed)
+	}
+
+	res, err = mod.ExportedFunction(ExportProcess).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+
+	packed := int64(res[0])
+	switch {
+	case packed == 0:
+		return nil, nil
+	case packed < 0:
+		return nil, fmt.Errorf("%w: code %d", ErrPluginFailed, packed)
+	}
+
+	outPtr, outLen := uint32(packed>>32), uint32(packed)
+	if outLen > MaxOutputBytes {
+		return nil, fmt.Errorf("%w: %d bytes", ErrOutputTooLarge, outLen)
+	}
+	output, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("%w: output out of range", ErrPluginFailed)
+	}
+	// Copy out of guest memory before the instance is reused
+	return append([]byte(nil), output...), nil
+}
+
+// Close releases the plugin's runtime and all instances
+func (p *Plugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
@@ -0,0 +1,290 @@
+package presets
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"parsec/pkg/models"
+)
+
+// MetadataFormat records which preset parsed an event
+const MetadataFormat = "log_format"
+
+// Preset bundles extraction patterns, severity mapping and multi-line
+// handling for a well-known log format
+type Preset struct {
+	Name string
+
+	// Patterns are tried in order; named groups become metadata, except
+	// "message" which replaces the message and "level" which feeds Severity
+	Patterns []*regexp.Regexp
+
+	// Parse extracts fields from formats patterns cannot express; nil if
+	// the message is not in the format. Fields follow the pattern rules.
+	Parse func(message string) map[string]string
+
+	// Severity maps extracted fields to a severity ("" if undetermined)
+	Severity func(fields map[string]string) models.Severity
+
+	// DefaultSeverity is used when neither the line nor the client provided
+	// a valid severity (e.g. continuation lines)
+	DefaultSeverity models.Severity
+
+	// MultilineStart matches the first line of an event; empty disables
+	// multi-line reassembly for the preset. Such presets keep the raw line as
+	// the message so the reassembly stage can still recognize start lines.
+	MultilineStart string
+}
+
+var builtin = map[string]*Preset{
+	"nginx": {
+		Name: "nginx",
+		Patterns: []*regexp.Regexp{
+			// combined access log
+			regexp.MustCompile(`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+) (?P<protocol>[^"]+)" (?P<status>\d{3}) (?P<body_bytes_sent>\d+|-) "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)"`),
+			// error log
+			regexp.MustCompile(`^(?P<time>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(?P<level>\w+)\] (?P<pid>\d+)#(?P<tid>\d+): (?:\*(?P<connection>\d+) )?(?P<message>.*)$`),
+		},
+		Severity:        firstOf(levelSeverity(nginxLevels), httpStatusSeverity),
+		DefaultSeverity: models.SeverityInfo,
+	},
+	"envoy": {
+		Name: "envoy",
+		Patterns: []*regexp.Regexp{
+			// default access log format
+			regexp.MustCompile(`^\[(?P<start_time>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+) (?P<protocol>[^"]+)" (?P<status>\d{3}) (?P<response_flags>\S+) (?P<bytes_received>\d+) (?P<bytes_sent>\d+) (?P<duration_ms>\d+) (?P<upstream_service_time>\S+) "(?P<x_forwarded_for>[^"]*)" "(?P<user_agent>[^"]*)" "(?P<request_id>[^"]*)" "(?P<authority>[^"]*)" "(?P<upstream_host>[^"]*)"`),
+			// application log
+			regexp.MustCompile(`^\[(?P<time>[^\]]+)\]\[(?P<thread>\d+)\]\[(?P<level>\w+)\]\[(?P<logger>[^\]]+)\] (?P<message>.*)$`),
+		},
+		Severity:        firstOf(levelSeverity(commonLevels), httpStatusSeverity),
+		DefaultSeverity: models.SeverityInfo,
+	},
+	"postgres": {
+		Name: "postgres",
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`^(?P<time>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?(?: \w+)?) \[(?P<pid>\d+)\](?: (?P<session>[^:]+?))? (?P<level>DEBUG\d?|LOG|INFO|NOTICE|WARNING|ERROR|FATAL|PANIC|STATEMENT|DETAIL|HINT|CONTEXT):\s+(?P<message>.*)$`),
+		},
+		Severity:        levelSeverity(postgresLevels),
+		DefaultSeverity: models.SeverityInfo,
+		MultilineStart:  `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`,
+	},
+	"jvm": {
+		Name: "jvm",
+		Patterns: []*regexp.Regexp{
+			// logback/log4j default layouts
+			regexp.MustCompile(`^(?P<time>\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?)\s+(?:\[(?P<thread>[^\]]+)\]\s+)?(?P<level>TRACE|DEBUG|INFO|WARN|WARNING|ERROR|FATAL)\s+(?:\[(?P<thread_name>[^\]]+)\]\s+)?(?P<logger>[\w.$]+)\s+-?\s*(?P<message>.*)$`),
+		},
+		Severity:        levelSeverity(commonLevels),
+		DefaultSeverity: models.SeverityError, // unmatched lines are usually stack frames
+		MultilineStart:  `^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}`,
+	},
+	"systemd": {
+		Name: "systemd",
+		Patterns: []*regexp.Regexp{
+			// journalctl -o short-iso
+			regexp.MustCompile(`^(?P<time>\d{4}-\d{2}-\d{2}T\S+) (?P<hostname>\S+) (?P<unit>[^\[:\s]+)(?:\[(?P<pid>\d+)\])?: (?P<message>.*)$`),
+		},
+		Severity:        syslogPrioritySeverity,
+		DefaultSeverity: models.SeverityInfo,
+	},
+	"cef": {
+		Name:            "cef",
+		Parse:           parseCEF,
+		Severity:        securitySeverity("severity"),
+		DefaultSeverity: models.SeverityInfo,
+	},
+	"leef": {
+		Name:            "leef",
+		Parse:           parseLEEF,
+		Severity:        securitySeverity("sev"),
+		DefaultSeverity: models.SeverityInfo,
+	},
+}
+
+var commonLevels = map[string]models.Severity{
+	"trace":    models.SeverityDebug,
+	"debug":    models.SeverityDebug,
+	"info":     models.SeverityInfo,
+	"warn":     models.SeverityWarning,
+	"warning":  models.SeverityWarning,
+	"error":    models.SeverityError,
+	"err":      models.SeverityError,
+	"critical": models.SeverityCritical,
+	"fatal":    models.SeverityCritical,
+}
+
+var nginxLevels = map[string]models.Severity{
+	"debug":  models.SeverityDebug,
+	"info":   models.SeverityInfo,
+	"notice": models.SeverityInfo,
+	"warn":   models.SeverityWarning,
+	"error":  models.SeverityError,
+	"crit":   models.SeverityCritical,
+	"alert":  models.SeverityCritical,
+	"emerg":  models.SeverityCritical,
+}
+
+var postgresLevels = map[string]models.Severity{
+	"debug":     models.SeverityDebug,
+	"log":       models.SeverityInfo,
+	"info":      models.SeverityInfo,
+	"notice":    models.SeverityInfo,
+	"statement": models.SeverityInfo,
+	"detail":    models.SeverityInfo,
+	"hint":      models.SeverityInfo,
+	"context":   models.SeverityInfo,
+	"warning":   models.SeverityWarning,
+	"error":     models.SeverityError,
+	"fatal":     models.SeverityCritical,
+	"panic":     models.SeverityCritical,
+}
+
+// Get returns a built-in preset by name
+func Get(name string) (*Preset, bool) {
+	p, ok := builtin[strings.ToLower(name)]
+	return p, ok
+}
+
+// Names returns the names of all built-in presets
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply parses the event message with the preset. Extracted fields are added
+// to Metadata without overwriting client-supplied keys. It returns true if
+// one of the patterns matched.
+func (p *Preset) Apply(e *models.LogEvent) bool {
+	fields := p.extract(e.Message)
+
+	if fields != nil {
+		if e.Metadata == nil {
+			e.Metadata = make(models.Metadata, len(fields)+1)
+		}
+		for k, v := range fields {
+			if k == "message" || v == "" || v == "-" {
+				continue
+			}
+			// Leave room for the format key; security formats can carry
+			// dozens of extension fields
+			if _, exists := e.Metadata[k]; !exists && len(e.Metadata) < models.MaxMetadataKeys-1 {
+				e.Metadata[k] = v
+			}
+		}
+		if msg := strings.TrimSpace(fields["message"]); msg != "" && p.MultilineStart == "" {
+			e.Message = msg
+		}
+		e.Metadata[MetadataFormat] = p.Name
+	}
+
+	if p.Severity != nil {
+		// Extracted fields take precedence over client metadata
+		lookup := make(map[string]string, len(e.Metadata)+len(fields))
+		for k, v := range e.Metadata {
+			lookup[k] = models.Stringify(v)
+		}
+		for k, v := range fields {
+			lookup[k] = v
+		}
+		if sev := p.Severity(lookup); sev != "" {
+			e.Severity = sev
+		}
+	}
+
+	if !e.Severity.IsValid() && p.DefaultSeverity != "" {
+		e.Severity = p.DefaultSeverity
+	}
+
+	return fields != nil
+}
+
+// extract returns named groups from the first matching pattern, or the
+// fields of the preset's parser
+func (p *Preset) extract(message string) map[string]string {
+	if p.Parse != nil {
+		return p.Parse(message)
+	}
+	for _, re := range p.Patterns {
+		match := re.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		fields := make(map[string]string, len(match))
+		for i, name := range re.SubexpNames() {
+			if name != "" && i < len(match) {
+				fields[name] = match[i]
+			}
+		}
+		return fields
+	}
+	return nil
+}
+
+// levelSeverity maps an extracted "level" field through the given table
+func levelSeverity(levels map[string]models.Severity) func(map[string]string) models.Severity {
+	return func(fields map[string]string) models.Severity {
+		level := strings.ToLower(fields["level"])
+		if sev, ok := levels[level]; ok {
+			return sev
+		}
+		// Postgres DEBUG1..DEBUG5
+		if strings.HasPrefix(level, "debug") {
+			return levels["debug"]
+		}
+		return ""
+	}
+}
+
+// httpStatusSeverity maps an HTTP status class to a severity
+func httpStatusSeverity(fields map[string]string) models.Severity {
+	status := fields["status"]
+	if len(status) != 3 {
+		return ""
+	}
+	switch status[0] {
+	case '5':
+		return models.SeverityError
+	case '4':
+		return models.SeverityWarning
+	default:
+		return models.SeverityInfo
+	}
+}
+
+// syslogPrioritySeverity maps a syslog/journald priority (0-7)
+func syslogPrioritySeverity(fields map[string]string) models.Severity {
+	priority, err := strconv.Atoi(fields["priority"])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case priority <= 2:
+		return models.SeverityCritical
+	case priority == 3:
+		return models.SeverityError
+	case priority == 4:
+		return models.SeverityWarning
+	case priority <= 6:
+		return models.SeverityInfo
+	default:
+		return models.SeverityDebug
+	}
+}
+
+// firstOf returns the first non-empty severity from the given mappers
+func firstOf(mappers ...func(map[string]string) models.Severity) func(map[string]string) models.Severity {
+	return func(fields map[string]string) models.Severity {
+		for _, m := range mappers {
+			if sev := m(fields); sev != "" {
+				return sev
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,125 @@
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"parsec/internal/multiline"
+	"parsec/pkg/models"
+)
+
+// Binding selects a preset for a tenant/source pair
+type Binding struct {
+	// TenantID restricts the binding to a tenant ("" or "*" matches all)
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// Source is the normalized source the preset applies to
+	Source string `json:"source"`
+
+	// Preset is the built-in preset name
+	Preset string `json:"preset"`
+}
+
+// matches reports whether the binding applies to the event
+func (b Binding) matches(e *models.LogEvent) bool {
+	if b.TenantID != "" && b.TenantID != "*" && b.TenantID != e.TenantID {
+		return false
+	}
+	return b.Source == e.Source
+}
+
+// ParseBindings parses a JSON array of bindings
+func ParseBindings(data []byte) ([]Binding, error) {
+	var bindings []Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("parse format presets: %w", err)
+	}
+	return bindings, nil
+}
+
+// boundPreset is a binding resolved to its preset
+type boundPreset struct {
+	Binding
+	preset *Preset
+}
+
+// Registry resolves which preset applies to an event
+type Registry struct {
+	bindings []boundPreset
+}
+
+// NewRegistry validates bindings against the built-in presets. Tenant
+// specific bindings take precedence over wildcard ones.
+func NewRegistry(bindings []Binding) (*Registry, error) {
+	r := &Registry{}
+	for _, specific := range []bool{true, false} {
+		for _, b := range bindings {
+			if (b.TenantID != "" && b.TenantID != "*") != specific {
+				continue
+			}
+			if b.Source == "" {
+				return nil, fmt.Errorf("format preset %q: source is required", b.Preset)
+			}
+			p, ok := Get(b.Preset)
+			if !ok {
+				return nil, fmt.Errorf("unknown format preset %q (available: %s)", b.Preset, strings.Join(Names(), ", "))
+			}
+			b.Source = strings.ToLower(b.Source)
+			r.bindings = append(r.bindings, boundPreset{Binding: b, preset: p})
+		}
+	}
+	return r, nil
+}
+
+// Bindings returns the bindings in precedence order
+func (r *Registry) Bindings() []Binding {
+	if r == nil {
+		return nil
+	}
+	bindings := make([]Binding, len(r.bindings))
+	for i, b := range r.bindings {
+		bindings[i] = b.Binding
+	}
+	return bindings
+}
+
+// Apply runs the matching preset, if any, over a normalized event. It returns
+// the preset name ("" if no binding matched) and whether a pattern parsed
+// the message.
+func (r *Registry) Apply(e *models.LogEvent) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	for _, b := range r.bindings {
+		if b.matches(e) {
+			return b.preset.Name, b.preset.Apply(e)
+		}
+	}
+	return "", false
+}
+
+// MultilineRules returns reassembly rules for bindings whose preset has a
+// multi-line start pattern
+func (r *Registry) MultilineRules() ([]multiline.Rule, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	var rules []multiline.Rule
+	for _, b := range r.bindings {
+		if b.preset.MultilineStart == "" {
+			continue
+		}
+		rule := multiline.Rule{
+			TenantID:     b.TenantID,
+			Source:       b.Source,
+			StartPattern: b.preset.MultilineStart,
+		}
+		if err := rule.Compile(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,243 @@
+package presets
+
+import (
+	"strconv"
+	"strings"
+
+	"parsec/pkg/models"
+)
+
+// parseCEF extracts an ArcSight CEF record:
+//
+//	CEF:Version|Vendor|Product|Version|Signature ID|Name|Severity|Extension
+//
+// Anything before "CEF:" (usually a syslog header) is ignored. Extension
+// pairs become fields, with csN/cnN values named by their csNLabel; msg, or
+// else the event name, becomes the message.
+func parseCEF(line string) map[string]string {
+	i := strings.Index(line, "CEF:")
+	if i < 0 {
+		return nil
+	}
+	header, extension, ok := splitHeader(line[i+len("CEF:"):], 7, true)
+	if !ok || !isVersion(header[0]) {
+		return nil
+	}
+
+	fields := map[string]string{
+		"cef_version":    header[0],
+		"device_vendor":  header[1],
+		"device_product": header[2],
+		"device_version": header[3],
+		"signature_id":   header[4],
+		"name":           header[5],
+		"severity":       header[6],
+	}
+
+	ext := cefExtension(extension)
+	for key, value := range ext {
+		if labelled, ok := strings.CutSuffix(key, "Label"); ok {
+			if _, exists := ext[labelled]; exists {
+				continue
+			}
+		}
+		if label := strings.TrimSpace(ext[key+"Label"]); label != "" {
+			key = label
+		}
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+
+	if msg := fields["msg"]; msg != "" {
+		fields["message"] = msg
+		delete(fields, "msg")
+	} else {
+		fields["message"] = fields["name"]
+	}
+	return fields
+}
+
+// cefExtension parses space-separated key=value pairs. Values may contain
+// spaces; a new pair starts at a space followed by a key and an unescaped
+// "=".
+func cefExtension(extension string) map[string]string {
+	type pair struct{ key, start, end int }
+	var pairs []pair
+	for j := 0; j < len(extension); j++ {
+		if extension[j] != '=' || escaped(extension, j) {
+			continue
+		}
+		k := j
+		for k > 0 && isKeyChar(extension[k-1]) {
+			k--
+		}
+		if k == j || (k > 0 && extension[k-1] != ' ') {
+			continue
+		}
+		if n := len(pairs); n > 0 {
+			pairs[n-1].end = k
+		}
+		pairs = append(pairs, pair{key: k, start: j + 1, end: len(extension)})
+	}
+
+	ext := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		key := extension[p.key : p.start-1]
+		ext[key] = unescapeCEF(strings.TrimRight(extension[p.start:p.end], " "))
+	}
+	return ext
+}
+
+// parseLEEF extracts an IBM QRadar LEEF record:
+//
+//	LEEF:1.0|Vendor|Product|Version|EventID|Extension
+//	LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|Extension
+//
+// Extension attributes are separated by tabs, or by the LEEF 2.0 delimiter,
+// given as a character or as hex (x5E or 0x5E).
+func parseLEEF(line string) map[string]string {
+	i := strings.Index(line, "LEEF:")
+	if i < 0 {
+		return nil
+	}
+	rest := line[i+len("LEEF:"):]
+	header, extension, ok := splitHeader(rest, 5, false)
+	if !ok || !isVersion(header[0]) {
+		return nil
+	}
+
+	delimiter := "\t"
+	if strings.HasPrefix(header[0], "2") {
+		if end := strings.IndexByte(extension, '|'); end >= 0 && end <= 4 {
+			if d := leefDelimiter(extension[:end]); d != "" {
+				delimiter = d
+			}
+			extension = extension[end+1:]
+		}
+	}
+
+	fields := map[string]string{
+		"leef_version":   header[0],
+		"device_vendor":  header[1],
+		"device_product": header[2],
+		"device_version": header[3],
+		"event_id":       header[4],
+	}
+	for _, attr := range strings.Split(extension, delimiter) {
+		key, value, ok := strings.Cut(attr, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if _, exists := fields[key]; !exists {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// leefDelimiter decodes a LEEF 2.0 delimiter field
+func leefDelimiter(field string) string {
+	if hex, ok := strings.CutPrefix(strings.TrimPrefix(field, "0"), "x"); ok {
+		if b, err := strconv.ParseUint(hex, 16, 8); err == nil {
+			return string(rune(b))
+		}
+		return ""
+	}
+	if len(field) != 1 {
+		return ""
+	}
+	return field
+}
+
+// splitHeader splits n pipe-delimited header fields off s, returning them
+// and the remainder. CEF escapes pipes and backslashes in header fields;
+// LEEF does not.
+func splitHeader(s string, n int, escapes bool) ([]string, string, bool) {
+	fields := make([]string, 0, n)
+	start := 0
+	for j := 0; j < len(s) && len(fields) < n; j++ {
+		if s[j] != '|' || (escapes && escaped(s, j)) {
+			continue
+		}
+		field := s[start:j]
+		if escapes {
+			field = strings.NewReplacer(`\|`, "|", `\\`, `\`).Replace(field)
+		}
+		fields = append(fields, strings.TrimSpace(field))
+		start = j + 1
+	}
+	if len(fields) < n {
+		return nil, "", false
+	}
+	return fields, s[start:], true
+}
+
+// unescapeCEF decodes \=, \\, \n and \r in an extension value
+func unescapeCEF(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\=`, "=", `\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(value)
+}
+
+// escaped reports whether s[i] is preceded by an odd number of backslashes
+func escaped(s string, i int) bool {
+	n := 0
+	for i > 0 && s[i-1] == '\\' {
+		n++
+		i--
+	}
+	return n%2 == 1
+}
+
+// isKeyChar reports whether c may appear in a CEF extension key
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-' || c == '[' || c == ']'
+}
+
+// isVersion reports whether a header version looks like 0, 1.0 or 2.0
+func isVersion(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, c := range v {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// securitySeverity maps a CEF/LEEF severity field: 0-10, or CEF's Low,
+// Medium, High and Very-High
+func securitySeverity(field string) func(map[string]string) models.Severity {
+	return func(fields map[string]string) models.Severity {
+		value := strings.ToLower(strings.TrimSpace(fields[field]))
+		switch value {
+		case "low":
+			return models.SeverityInfo
+		case "medium":
+			return models.SeverityWarning
+		case "high":
+			return models.SeverityError
+		case "very-high":
+			return models.SeverityCritical
+		}
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 || level > 10 {
+			return ""
+		}
+		switch {
+		case level <= 3:
+			return models.SeverityInfo
+		case level <= 6:
+			return models.SeverityWarning
+		case level <= 8:
+			return models.SeverityError
+		default:
+			return models.SeverityCritical
+		}
+	}
+}
@@ -5,156 +5,2193 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog"
 
+	"parsec/internal/abuse"
+	"parsec/internal/alerts"
+	"parsec/internal/amqp"
+	"parsec/internal/browser"
+	"parsec/internal/bus"
+	"parsec/internal/canary"
+	"parsec/internal/capture"
+	"parsec/internal/coercion"
 	"parsec/internal/config"
+	"parsec/internal/crash"
+	"parsec/internal/discovery"
+	"parsec/internal/docker"
 	"parsec/internal/api"
+	"parsec/internal/encryption"
+	"parsec/internal/erasure"
+	"parsec/internal/export"
+	"parsec/internal/filesink"
+	"parsec/internal/flags"
+	"parsec/internal/forward"
+	"parsec/internal/httpserver"
+	"parsec/internal/jobs"
+	"parsec/internal/journal"
 	"parsec/internal/kafka"
+	"parsec/internal/kinesis"
 	"parsec/internal/logger"
+	"parsec/internal/memguard"
+	"parsec/internal/metapolicy"
 	"parsec/internal/metrics"
 	"parsec/internal/middleware"
-	"parsec/internal/models"
+	"parsec/internal/mqtt"
+	"parsec/internal/multiline"
+	"parsec/internal/nats"
+	"parsec/internal/objstore"
+	"parsec/internal/pipeline"
+	"parsec/internal/plugins"
+	"parsec/internal/presets"
+	"parsec/internal/pubsub"
+	"parsec/internal/querycache"
+	"parsec/internal/queue"
+	"parsec/internal/ratelimit"
+	"parsec/internal/rbac"
+	"parsec/internal/receipts"
+	"parsec/internal/region"
+	"parsec/internal/remotewrite"
+	"parsec/internal/reprocess"
+	"parsec/internal/routing"
+	"parsec/internal/schema"
+	"parsec/internal/scripting"
+	"parsec/internal/selfmon"
+	"parsec/internal/slo"
+	"parsec/internal/sentry"
+	"parsec/internal/signing"
+	"parsec/internal/startup"
+	"parsec/internal/suspension"
+	"parsec/internal/tiers"
+	"parsec/internal/state"
+	"parsec/internal/tail"
+	"parsec/internal/ui"
+	"parsec/internal/uploads"
+	"parsec/internal/upstream"
+	"parsec/internal/usage"
 	"parsec/internal/worker"
+	"parsec/pkg/models"
 )
 
 // Processor is the high-level coordinator for consuming, processing, and alerting.
 type Processor struct {
 	cfg          *config.Config
-	producer     *kafka.Producer
+	nodeID       string
+	started      time.Time
+	rates        *rateMeters
+	producer     bus.Publisher
 	workerPool   *worker.Pool
-	httpServer   *http.Server
+	httpServer   *httpserver.Server
 	envelopeChan chan *models.Envelope
+	overflow     *queue.Overflow
+	budget       *queue.Budget
+	memory       *memguard.Watchdog
+	jobs         *jobs.Scheduler
+	exports      *export.Manager
+	erasures     *erasure.Manager
+	queryCache   *querycache.Cache
+	usage        *usage.Meter
+	usageReports *usage.Reports
+	reprocess    *reprocess.Manager
+	uploads      *uploads.Manager
+	selfMonitor  *selfmon.Hook
+	ingest       *handlers.IngestHandler
+	forwarded    *handlers.ForwardHandler
+	forwardSrv   *forward.Server
+	journal      *journal.Reader
+	tailer       *tail.Tailer
+	containers   *docker.Collector
+	upstream     *upstream.Consumer
+	mqtt         *mqtt.Bridge
+	assembler    *multiline.Assembler
+	presets      *presets.Registry
+	router       *routing.Engine
+	heartbeats   *alerts.HeartbeatMonitor
+	searches     *alerts.SearchMonitor
+	shaper       *kafka.Shaper
+	topicMeta    *kafka.MetadataCache
+	balancer     *kafka.TenantBalancer
+	cipher       *encryption.Cipher
+	scripts      *scripting.Engine
+	metadata     *metapolicy.Engine
+	fieldTypes   *coercion.Engine
+	schemas      *schema.Registry
+	sourceMaps   *browser.SourceMaps
+	geo          *browser.GeoDB
+	plugins      []*plugins.Plugin
+	stateStore   state.StateStore
+	flags        *flags.Manager
+	suspensions  *suspension.Registry
+	tiers        *tiers.Registry
+	abuse        *abuse.Detector
+	discovery    *discovery.Registry
+	authn        *rbac.Authenticator
+	captures     *capture.Recorder
+	slo          *slo.Tracker
+	canary       *canary.Canary
 	wg           sync.WaitGroup
+
+	// emitters are the goroutines emitting events of their own, which stop
+	// before the envelope queue closes
+	emitters sync.WaitGroup
+}
+
+// New constructs a Processor with given config.
+func New(cfg *config.Config) *Processor {
+	nodeID, _ := os.Hostname()
+	if nodeID == "" {
+		nodeID = "unknown"
+	}
+
+	return &Processor{
+		cfg:          cfg,
+		nodeID:       nodeID,
+		started:      time.Now().UTC(),
+		rates:        newRateMeters(),
+		envelopeChan: make(chan *models.Envelope, 1000), // Buffer for 1000 envelopes
+		budget:       queue.NewBudget(cfg.Queue.MaxBytes),
+	}
+}
+
+// Run starts background goroutines and blocks until context cancelled.
+func (p *Processor) Run(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+	log.Info().Str("profile", p.cfg.Profile).Msg("processor starting")
+
+	if err := config.CheckProfile(p.cfg.Profile); err != nil {
+		log.Error().Err(err).Msg("invalid configuration profile")
+		return err
+	}
+	if err := p.checkEnv(); err != nil {
+		log.Error().Err(err).Msg("invalid configuration environment")
+		return err
+	}
+
+	// Write crash reports for panics from here on
+	crash.Init(crash.Config{
+		Dir:        p.cfg.Crash.Dir,
+		LogLines:   p.cfg.Crash.LogLines,
+		ConfigHash: p.cfg.Hash(),
+	})
+
+	// Hold off until dependencies are reachable, rather than failing
+	// requests while they come up
+	if err := p.waitForDependencies(ctx); err != nil {
+		log.Error().Err(err).Msg("dependencies not ready")
+		return fmt.Errorf("dependencies not ready: %w", err)
+	}
+
+	// Load feature flags before anything they may gate
+	p.initFlags(ctx)
+	defer p.stateStore.Close()
+	p.initRouting(ctx)
+	p.initSuspensions(ctx)
+	if err := p.initTiers(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to initialize tenant tiers")
+		return fmt.Errorf("failed to initialize tenant tiers: %w", err)
+	}
+	p.initScripts(ctx)
+	p.initMetadataPolicy(ctx)
+	p.initFieldTypes(ctx)
+	p.initSchemas(ctx)
+	p.initPartitionPins(ctx)
+	if p.cfg.Heartbeat.Enabled {
+		p.initHeartbeats(ctx)
+	}
+
+	// Initialize the message bus publisher
+	if err := p.initProducer(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize producer")
+		return fmt.Errorf("failed to initialize producer: %w", err)
+	}
+	defer p.producer.Close()
+
+	// Track SLOs and canaries from the first publish
+	p.initSLO()
+	if p.cfg.Canary.Enabled {
+		p.initCanary()
+	}
+
+	// Initialize worker pool
+	p.initWorkerPool()
+	p.workerPool.Start()
+	defer p.workerPool.Stop()
+	crash.AddStats("queue", p.queueStats)
+
+	// Initialize queue overflow policy (replays any spilled envelopes)
+	if err := p.initQueue(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize queue overflow policy")
+		return fmt.Errorf("failed to initialize queue overflow policy: %w", err)
+	}
+
+	// Shed load as memory use nears its limit
+	if err := p.initMemory(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize memory watchdog")
+		return fmt.Errorf("failed to initialize memory watchdog: %w", err)
+	}
+
+	// Feed our own warnings and errors back into the pipeline
+	p.initSelfMonitor()
+
+	// Initialize format presets (these may contribute multi-line rules)
+	if err := p.initPresets(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize format presets")
+		return fmt.Errorf("failed to initialize format presets: %w", err)
+	}
+
+	// Load WASM processor plugins
+	if err := p.initPlugins(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to load plugins")
+		return fmt.Errorf("failed to load plugins: %w", err)
+	}
+	defer p.closePlugins()
+
+	// Initialize multi-line reassembly
+	if err := p.initMultiline(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize multi-line reassembly")
+		return fmt.Errorf("failed to initialize multi-line reassembly: %w", err)
+	}
+
+	// Background jobs (exports, erasures, reprocessing, uploads) share one
+	// scheduler
+	p.jobs = jobs.NewScheduler(p.stateStore, jobs.Config{NodeID: p.nodeID})
+
+	// Initialize tenant exports
+	if err := p.initExports(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize exports")
+		return fmt.Errorf("failed to initialize exports: %w", err)
+	}
+
+	// Initialize reprocessing jobs
+	p.initReprocess()
+
+	// Initialize tenant erasure
+	if err := p.initErasure(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize erasure")
+		return fmt.Errorf("failed to initialize erasure: %w", err)
+	}
+
+	// Initialize usage metering
+	if err := p.initUsage(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize usage reports")
+		return fmt.Errorf("failed to initialize usage reports: %w", err)
+	}
+
+	// Initialize browser error reporting
+	if err := p.initBrowser(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize browser error reporting")
+		return fmt.Errorf("failed to initialize browser error reporting: %w", err)
+	}
+
+	// Initialize HTTP server
+	if err := p.initHTTPServer(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize HTTP server")
+		return fmt.Errorf("failed to initialize HTTP server: %w", err)
+	}
+
+	// Start HTTP server in background
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("http_server")
+		log.Info().
+			Str("addr", p.httpServer.Addr()).
+			Bool("tls", p.httpServer.TLS()).
+			Bool("http2", p.cfg.HTTP.HTTP2 && p.httpServer.TLS()).
+			Bool("h2c", p.cfg.HTTP.H2C && !p.httpServer.TLS()).
+			Msg("starting HTTP server")
+		if err := p.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("HTTP server error")
+		}
+	}()
+
+	// Accept grpc forwarding streams from edge nodes
+	if p.cfg.Forward.Server.Addr != "" {
+		if err := p.initForwardServer(); err != nil {
+			log.Error().Err(err).Msg("failed to initialize forward server")
+			return fmt.Errorf("failed to initialize forward server: %w", err)
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("forward_server")
+			log.Info().Str("addr", p.forwardSrv.Addr().String()).Msg("starting forward server")
+			if err := p.forwardSrv.Serve(); err != nil {
+				log.Error().Err(err).Msg("forward server error")
+			}
+		}()
+	}
+
+	// Tail the host's systemd journal
+	if p.cfg.Journal.Enabled {
+		if err := p.initJournal(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to initialize journal input")
+			return fmt.Errorf("failed to initialize journal input: %w", err)
+		}
+	}
+
+	// Tail local log files
+	if len(p.cfg.Tail.Paths) > 0 {
+		if err := p.initTail(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to initialize file tailing")
+			return fmt.Errorf("failed to initialize file tailing: %w", err)
+		}
+	}
+
+	// Collect logs of containers on this host
+	if p.cfg.Docker.Enabled {
+		if err := p.initDocker(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to initialize docker input")
+			return fmt.Errorf("failed to initialize docker input: %w", err)
+		}
+	}
+
+	// Consume raw logs from upstream Kafka topics
+	if len(p.cfg.Upstream.Topics) > 0 {
+		if err := p.initUpstream(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to initialize upstream kafka input")
+			return fmt.Errorf("failed to initialize upstream kafka input: %w", err)
+		}
+	}
+
+	// Receive device messages from an MQTT broker
+	if p.cfg.MQTT.Broker != "" {
+		if err := p.initMQTT(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to initialize mqtt bridge")
+			return fmt.Errorf("failed to initialize mqtt bridge: %w", err)
+		}
+	}
+
+	// Multi-line flush goroutine
+	if p.assembler != nil {
+		p.emitters.Add(1)
+		go func() {
+			defer p.emitters.Done()
+			defer crash.Recover("multiline")
+			p.assembler.Run(ctx, p.ingest.Emit)
+		}()
+	}
+
+	// Spill replay goroutine (stopped in shutdown before the queue closes)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("overflow")
+		p.overflow.Run()
+	}()
+
+	// Feature flag refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("flags")
+		p.flags.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Rotated API key refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("keys")
+		p.authn.Run(ctx, p.cfg.Auth.RefreshInterval)
+	}()
+
+	// Routing rule refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("routing")
+		p.router.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Tenant suspension refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("suspensions")
+		p.suspensions.Run(ctx, p.cfg.Suspensions.RefreshInterval)
+	}()
+
+	// Tenant tier refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("tiers")
+		p.tiers.Run(ctx, p.cfg.Tiers.RefreshInterval)
+	}()
+
+	// Abuse block refresh goroutine
+	if p.abuse != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("abuse")
+			p.abuse.Run(ctx, p.cfg.Abuse.RefreshInterval)
+		}()
+	}
+
+	// Node announcement goroutine for endpoint discovery
+	if p.discovery != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("discovery")
+			p.discovery.Run(ctx)
+		}()
+	}
+
+	// Tenant script hot-reload goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("scripts")
+		p.scripts.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Metadata policy refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("metadata")
+		p.metadata.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Field type rule refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("field_types")
+		p.fieldTypes.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Tenant schema hot-reload goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("schemas")
+		p.schemas.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Partition pin refresh goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("partition_pins")
+		p.balancer.Run(ctx, p.cfg.Flags.RefreshInterval)
+	}()
+
+	// Heartbeat (dead-man's switch) goroutine
+	if p.heartbeats != nil {
+		p.emitters.Add(1)
+		go func() {
+			defer p.emitters.Done()
+			defer crash.Recover("heartbeats")
+			p.heartbeats.Run(ctx, p.cfg.Heartbeat.CheckInterval, p.ingest.Emit)
+		}()
+	}
+
+	// Usage metering and monthly reports
+	if p.usage != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("usage")
+			p.usage.Run(ctx, p.cfg.Usage.FlushInterval)
+		}()
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("usage_reports")
+			p.usageReports.Run(ctx)
+		}()
+	}
+
+	// Scheduled saved searches
+	if p.searches != nil {
+		p.emitters.Add(1)
+		go func() {
+			defer p.emitters.Done()
+			defer crash.Recover("searches")
+			p.searches.Run(ctx, p.cfg.Query.SearchCheckInterval, p.ingest.Emit)
+		}()
+	}
+
+	// SLO gauges and, when enabled, burn rate alerts
+	p.emitters.Add(1)
+	go func() {
+		defer p.emitters.Done()
+		defer crash.Recover("slo")
+		var engine alerts.AlertEngine
+		if p.cfg.SLO.Alerts {
+			engine = alerts.NewNoopEngine()
+		}
+		p.slo.Run(ctx, p.cfg.SLO.CheckInterval, engine, p.ingest.Emit)
+	}()
+
+	// Kafka topic metadata goroutine; warns when the layout holds back
+	// the writers
+	if p.topicMeta != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("kafka_metadata")
+			producer := p.cfg.Kafka.Producer
+			p.topicMeta.Run(ctx, p.cfg.Kafka.MetadataRefresh, max(producer.PoolSize, producer.MaxPoolSize), p.cfg.Kafka.MaxLeaderImbalance)
+		}()
+	}
+
+	// Canary goroutines: one sends, one reads canaries back from Kafka
+	if p.canary != nil {
+		p.emitters.Add(1)
+		go func() {
+			defer p.emitters.Done()
+			defer crash.Recover("canary")
+			p.canary.Run(ctx)
+		}()
+		if p.canary.Stats().Confirm == canary.StageKafka {
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				defer crash.Recover("canary_watch")
+				p.watchCanaries(ctx)
+			}()
+		}
+	}
+
+	// Async ingest goroutine: ingests ?mode=async batches in the background
+	if p.cfg.Receipts.Enabled {
+		p.emitters.Add(1)
+		go func() {
+			defer p.emitters.Done()
+			defer crash.Recover("ingest_async")
+			p.ingest.RunAsync(ctx)
+		}()
+	}
+
+	// Uploads goroutine: removes the data of expired uploads
+	if p.uploads != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("uploads")
+			p.uploads.Run(ctx, time.Hour)
+		}()
+	}
+
+	// Remote-write goroutine: pushes metrics so the backend needn't scrape
+	// every node
+	if p.cfg.RemoteWrite.URL != "" {
+		labels := map[string]string{"instance": p.nodeID}
+		if p.cfg.Region.Name != "" {
+			labels["region"] = p.cfg.Region.Name
+		}
+		pusher := remotewrite.New(prometheus.DefaultGatherer, remotewrite.Config{
+			URL:         p.cfg.RemoteWrite.URL,
+			Interval:    p.cfg.RemoteWrite.Interval,
+			Prefixes:    p.cfg.RemoteWrite.Metrics,
+			Labels:      labels,
+			Username:    p.cfg.RemoteWrite.Username,
+			Password:    p.cfg.RemoteWrite.Password,
+			BearerToken: p.cfg.RemoteWrite.BearerToken,
+		})
+		log.Info().Str("url", p.cfg.RemoteWrite.URL).Dur("interval", p.cfg.RemoteWrite.Interval).Msg("metrics remote write enabled")
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("remote_write")
+			pusher.Run(ctx)
+		}()
+	}
+
+	// Memory watchdog goroutine
+	if p.memory != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer crash.Recover("memguard")
+			p.memory.Run(ctx)
+		}()
+	}
+
+	// Stats reporting goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("stats")
+		p.reportStats(ctx)
+	}()
+
+	// Windowed rate sampling goroutine
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer crash.Recover("rates")
+		p.trackRates(ctx)
+	}()
+
+	// Wait for shutdown signal
+	<-ctx.Done()
+	log.Info().Msg("shutdown signal received")
+
+	// Graceful shutdown
+	return p.shutdown()
+}
+
+// checkEnv looks for KAFKA_* and PARSEC_* variables Parsec doesn't read,
+// which are usually misspellings whose settings would silently fall back
+// to their defaults. Depending on PARSEC_STRICT_CONFIG they are logged or
+// refused.
+func (p *Processor) checkEnv() error {
+	mode := p.cfg.StrictConfig
+	if err := config.CheckStrict(mode); err != nil {
+		return err
+	}
+	if mode == config.StrictOff {
+		return nil
+	}
+
+	unknown := config.UnknownEnv(os.Environ())
+	log := logger.WithComponent("processor")
+	for _, v := range unknown {
+		log.Warn().Str("variable", v.Name).Str("suggestion", v.Suggestion).Msg("unknown configuration variable")
+	}
+	if mode == config.StrictReject && len(unknown) > 0 {
+		names := make([]string, len(unknown))
+		for i, v := range unknown {
+			names[i] = v.String()
+		}
+		return fmt.Errorf("unknown configuration variables: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// waitForDependencies blocks until the dependencies in STARTUP_WAIT_FOR are
+// reachable, or the maximum wait passes
+func (p *Processor) waitForDependencies(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	names, err := startup.ParseDependencies(p.cfg.Startup.WaitFor)
+	if err != nil {
+		return err
+	}
+
+	var deps []startup.Dependency
+	for _, name := range names {
+		switch name {
+		case startup.DependencyKafka:
+			brokers, topic := p.cfg.Kafka.Brokers, p.cfg.Kafka.Topic
+			deps = append(deps, startup.Dependency{Name: name, Check: func(ctx context.Context) error {
+				return kafka.Ping(ctx, brokers, topic)
+			}})
+		case startup.DependencyRedis:
+			deps = append(deps, startup.Dependency{Name: name, Check: startup.RedisCheck(p.cfg.RedisAddr)})
+		case startup.DependencyStorage:
+			check, err := p.storageCheck()
+			if err != nil {
+				return err
+			}
+			if check == nil {
+				log.Warn().Msg("no storage locations configured; not waiting for storage")
+				continue
+			}
+			deps = append(deps, startup.Dependency{Name: name, Check: check})
+		}
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+
+	log.Info().Strs("dependencies", names).Dur("max_wait", p.cfg.Startup.MaxWait).Msg("waiting for dependencies")
+	err = startup.Wait(ctx, startup.Config{
+		MaxWait:        p.cfg.Startup.MaxWait,
+		InitialBackoff: p.cfg.Startup.InitialBackoff,
+		MaxBackoff:     p.cfg.Startup.MaxBackoff,
+		CheckTimeout:   p.cfg.Startup.CheckTimeout,
+	}, deps)
+	if errors.Is(err, startup.ErrTimeout) && p.cfg.Startup.ContinueOnTimeout {
+		log.Warn().Err(err).Msg("starting without all dependencies")
+		return nil
+	}
+	return err
+}
+
+// storageCheck checks every configured object store location: exports,
+// erasure archives and source maps. It is nil when none are configured.
+func (p *Processor) storageCheck() (func(ctx context.Context) error, error) {
+	var locations []string
+	if p.cfg.Export.Location != "" {
+		locations = append(locations, p.cfg.Export.Location)
+	}
+	locations = append(locations, p.cfg.Erasure.ArchiveLocations...)
+	if p.cfg.Browser.SourceMapsLocation != "" {
+		locations = append(locations, p.cfg.Browser.SourceMapsLocation)
+	}
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	checks := make([]func(ctx context.Context) error, len(locations))
+	for i, location := range locations {
+		bucket, prefix, err := objstore.ParseBucket(location, objstore.S3ConfigFromEnv())
+		if err != nil {
+			return nil, fmt.Errorf("storage %s: %w", location, err)
+		}
+		checks[i] = startup.StorageCheck(bucket, prefix)
+	}
+
+	return func(ctx context.Context) error {
+		for i, check := range checks {
+			if err := check(ctx); err != nil {
+				return fmt.Errorf("%s: %w", locations[i], err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// initFlags initializes the state store and feature flag manager
+func (p *Processor) initFlags(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	switch p.cfg.StateBackend {
+	case "noop":
+		p.stateStore = state.NewNoopStore(p.cfg.RedisAddr)
+	default:
+		p.stateStore = state.NewMemoryStore(state.MemoryConfig{})
+	}
+	log.Info().Str("backend", p.cfg.StateBackend).Msg("state store initialized")
+
+	sources := []flags.Source{flags.EnvSource{Value: p.cfg.Flags.Defaults}}
+	if p.cfg.Flags.File != "" {
+		sources = append(sources, flags.FileSource{Path: p.cfg.Flags.File})
+	}
+
+	p.flags = flags.NewManager(p.stateStore, sources...)
+	if err := p.flags.Refresh(ctx); err != nil {
+		log.Warn().Err(err).Msg("feature flags partially loaded")
+	}
+
+	log.Info().Strs("flags", p.flags.Names()).Msg("feature flags loaded")
+}
+
+// initRouting loads tenant routing rules from the shared state store
+func (p *Processor) initRouting(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.router = routing.NewEngine(p.stateStore)
+	p.router.SetRetentionTopics(map[string]string{
+		routing.RetentionShort: p.cfg.Kafka.ShortRetentionTopic,
+		routing.RetentionLong:  p.cfg.Kafka.LongRetentionTopic,
+	})
+	allowed := append([]string{p.cfg.Kafka.Topic, p.cfg.Kafka.ShortRetentionTopic, p.cfg.Kafka.LongRetentionTopic}, p.cfg.Kafka.RouteTopics...)
+	p.router.SetAllowedTopics(allowed, p.cfg.Kafka.TenantTopicPrefix)
+	if err := p.router.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load routing rules")
+	}
+}
+
+// initSuspensions loads paused and blocked tenants from the shared state
+// store
+func (p *Processor) initSuspensions(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.suspensions = suspension.NewRegistry(p.stateStore)
+	if err := p.suspensions.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load tenant suspensions")
+	}
+}
+
+// initTiers loads tenants' service tiers and has the routing engine apply
+// their defaults after tenants' own rules
+func (p *Processor) initTiers(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	cfg := tiers.Config{Default: tiers.Tier(p.cfg.Tiers.Default)}
+	assignments, err := tiers.ParseAssignments(p.cfg.Tiers.Tenants)
+	if err != nil {
+		return err
+	}
+	cfg.Assignments = assignments
+	if p.cfg.Tiers.PoliciesFile != "" {
+		data, err := os.ReadFile(p.cfg.Tiers.PoliciesFile)
+		if err != nil {
+			return err
+		}
+		if cfg.Policies, err = tiers.ParsePolicies(data); err != nil {
+			return err
+		}
+	}
+
+	p.tiers, err = tiers.NewRegistry(p.stateStore, cfg)
+	if err != nil {
+		return err
+	}
+	if err := p.tiers.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load tenant tiers")
+	}
+	p.router.SetDefaults(p.tiers.Rules)
+
+	log.Info().
+		Str("default", p.cfg.Tiers.Default).
+		Int("configured", len(assignments)).
+		Int("assigned", len(p.tiers.List())).
+		Msg("tenant tiers loaded")
+	return nil
+}
+
+// initHeartbeats loads registered heartbeats from the shared state store.
+// Silence is evaluated by the threshold alert engine.
+func (p *Processor) initHeartbeats(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.heartbeats = alerts.NewHeartbeatMonitor(p.stateStore, alerts.NewNoopEngine())
+	if err := p.heartbeats.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load heartbeats")
+	}
+	log.Info().Dur("check_interval", p.cfg.Heartbeat.CheckInterval).Msg("heartbeat alerts enabled")
+}
+
+// initScripts loads tenant scripts from the shared state store
+func (p *Processor) initScripts(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.scripts = scripting.NewEngine(p.stateStore, scripting.Limits{
+		Timeout:       p.cfg.Scripting.Timeout,
+		MemoryBudget:  p.cfg.Scripting.MemoryBudget,
+		MaxViolations: p.cfg.Scripting.MaxViolations,
+	})
+	if err := p.scripts.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load tenant scripts")
+	}
+}
+
+// initMetadataPolicy loads tenant metadata key policies from the shared
+// state store
+func (p *Processor) initMetadataPolicy(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.metadata = metapolicy.NewEngine(p.stateStore, metapolicy.Limits{
+		MaxValueBytes: p.cfg.Ingest.MetadataMaxValueBytes,
+		Deny:          p.cfg.Ingest.MetadataDenyKeys,
+	})
+	if err := p.metadata.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load metadata policies")
+	}
+}
+
+// initFieldTypes loads tenant field type rules from the shared state store
+func (p *Processor) initFieldTypes(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.fieldTypes = coercion.NewEngine(p.stateStore)
+	if err := p.fieldTypes.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load field type rules")
+	}
+}
+
+// initSchemas loads tenant metadata schemas from the shared state store
+func (p *Processor) initSchemas(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.schemas = schema.NewRegistry(p.stateStore)
+	if err := p.schemas.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load tenant schemas")
+	}
+}
+
+// initPartitionPins loads tenant Kafka partition pins from the shared state
+// store
+func (p *Processor) initPartitionPins(ctx context.Context) {
+	log := logger.WithComponent("processor")
+
+	p.balancer = kafka.NewTenantBalancer(p.stateStore)
+	if err := p.balancer.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load partition pins")
+	}
+}
+
+// initProducer initializes the publisher for the configured message bus
+func (p *Processor) initProducer() error {
+	log := logger.WithComponent("processor")
+
+	// Always install the shaper so limits can be set at runtime
+	p.shaper = kafka.NewShaper(kafka.ShaperLimits{
+		MessagesPerSec: p.cfg.Kafka.Producer.ShapeMessagesPerSec,
+		BytesPerSec:    p.cfg.Kafka.Producer.ShapeBytesPerSec,
+	})
+	if p.cfg.Encryption.Keys != "" {
+		keyring, err := encryption.ParseKeyring(p.cfg.Encryption.Keys, p.cfg.Encryption.Tenants)
+		if err != nil {
+			return fmt.Errorf("encryption keys: %w", err)
+		}
+		p.cipher = encryption.NewCipher(keyring)
+		log.Info().Msg("tenant envelope encryption enabled")
+	}
+
+	var err error
+	switch p.cfg.Bus.Backend {
+	case bus.BackendKafka:
+		err = p.initKafkaProducer()
+	case bus.BackendFile:
+		err = p.initFileSink()
+	case bus.BackendForward:
+		err = p.initForwarder()
+	default:
+		err = p.initDispatcher()
+	}
+	if err != nil {
+		return err
+	}
+	return p.initMirror()
+}
+
+// initMirror mirrors envelopes ingested in this region to the remote
+// region's Kafka cluster, when one is configured
+func (p *Processor) initMirror() error {
+	log := logger.WithComponent("processor")
+
+	cfg := p.cfg.Region
+	if len(cfg.MirrorBrokers) == 0 {
+		return nil
+	}
+	if cfg.Name == "" {
+		return errors.New("region mirroring requires a region name")
+	}
+	if cfg.MirrorTopic == "" {
+		cfg.MirrorTopic = p.cfg.Kafka.Topic + "." + cfg.Name
+	}
+
+	// Mirrored copies stay encrypted; the shaper only protects the local
+	// cluster
+	opts := []kafka.ProducerOption{kafka.WithFlags(p.flags)}
+	if p.cipher != nil {
+		opts = append(opts, kafka.WithEncryption(p.cipher))
+	}
+	remote, err := kafka.NewProducer(cfg.MirrorBrokers, cfg.MirrorTopic, p.cfg.Kafka.Producer, opts...)
+	if err != nil {
+		return fmt.Errorf("region mirror: %w", err)
+	}
+
+	p.producer = region.NewMirror(p.producer, remote, cfg)
+	log.Info().
+		Str("region", cfg.Name).
+		Strs("mirror_brokers", cfg.MirrorBrokers).
+		Str("mirror_topic", cfg.MirrorTopic).
+		Msg("region mirroring enabled")
+	return nil
+}
+
+// initKafkaProducer initializes the Kafka producer
+func (p *Processor) initKafkaProducer() error {
+	log := logger.WithComponent("processor")
+
+	opts := []kafka.ProducerOption{
+		kafka.WithFlags(p.flags),
+		kafka.WithShaper(p.shaper),
+		kafka.WithBalancer(p.balancer),
+	}
+	if p.cipher != nil {
+		opts = append(opts, kafka.WithEncryption(p.cipher))
+	}
+
+	producer, err := kafka.NewProducer(
+		p.cfg.Kafka.Brokers,
+		p.cfg.Kafka.Topic,
+		p.cfg.Kafka.Producer,
+		opts...,
+	)
+	if err != nil {
+		return err
+	}
+
+	p.producer = producer
+
+	// Partition layout of every topic the producer writes to
+	p.topicMeta = kafka.NewMetadataCache(p.cfg.Kafka.Brokers,
+		p.cfg.Kafka.Topic, p.cfg.Kafka.ShortRetentionTopic, p.cfg.Kafka.LongRetentionTopic)
+
+	log.Info().
+		Strs("brokers", p.cfg.Kafka.Brokers).
+		Str("topic", p.cfg.Kafka.Topic).
+		Msg("kafka producer initialized")
+	return nil
+}
+
+// initFileSink writes envelopes to local NDJSON files instead of a bus
+func (p *Processor) initFileSink() error {
+	log := logger.WithComponent("processor")
+
+	sink, err := filesink.New(p.cfg.FileSink)
+	if err != nil {
+		return err
+	}
+
+	p.producer = sink
+	log.Info().
+		Str("dir", p.cfg.FileSink.Dir).
+		Bool("compress", p.cfg.FileSink.Compress).
+		Str("fsync", p.cfg.FileSink.Fsync).
+		Msg("file sink initialized")
+	return nil
+}
+
+// initForwarder runs this node in edge mode, forwarding envelopes to a
+// central Parsec through a disk buffer
+func (p *Processor) initForwarder() error {
+	log := logger.WithComponent("processor")
+
+	forwarder, err := forward.New(p.cfg.Forward, p.nodeID)
+	if err != nil {
+		return err
+	}
+
+	p.producer = forwarder
+	log.Info().
+		Str("url", p.cfg.Forward.URL).
+		Str("protocol", p.cfg.Forward.Protocol).
+		Str("buffer_dir", p.cfg.Forward.BufferDir).
+		Msg("edge forwarder initialized")
+	return nil
+}
+
+// initForwardServer listens for grpc streams from edge nodes, queueing
+// their envelopes like /ingest/forward
+func (p *Processor) initForwardServer() error {
+	server, err := forward.NewServer(p.cfg.Forward.Server, p.forwarded, p.stateStore)
+	if err != nil {
+		return err
+	}
+	p.forwardSrv = server
+	return nil
+}
+
+// initJournal starts the systemd journal input, which submits entries
+// through the ingest handler like HTTP events
+func (p *Processor) initJournal(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	reader, err := journal.New(p.cfg.Journal, p.ingest)
+	if err != nil {
+		return err
+	}
+	reader.Start(ctx)
+	p.journal = reader
+
+	log.Info().
+		Strs("units", p.cfg.Journal.Units).
+		Int("min_priority", p.cfg.Journal.MinPriority).
+		Str("cursor_file", p.cfg.Journal.CursorFile).
+		Msg("journal input started")
+	return nil
+}
+
+// initTail starts the file tailing input, which submits lines through the
+// ingest handler and checkpoints offsets in the state store
+func (p *Processor) initTail(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	tailer, err := tail.New(p.cfg.Tail, p.ingest, p.stateStore)
+	if err != nil {
+		return err
+	}
+	tailer.Start(ctx)
+	p.tailer = tailer
+
+	log.Info().
+		Strs("paths", p.cfg.Tail.Paths).
+		Str("tenant", p.cfg.Tail.Tenant).
+		Str("source", p.cfg.Tail.Source).
+		Msg("file tailing started")
+	return nil
+}
+
+// initDocker starts the Docker container log input, which submits lines
+// through the ingest handler and checkpoints them in the state store
+func (p *Processor) initDocker(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	collector, err := docker.New(p.cfg.Docker, p.ingest, p.stateStore)
+	if err != nil {
+		return err
+	}
+	collector.Start(ctx)
+	p.containers = collector
+
+	log.Info().
+		Str("host", p.cfg.Docker.Host).
+		Str("tenant", p.cfg.Docker.Tenant).
+		Msg("docker input started")
+	return nil
+}
+
+// initUpstream starts consuming upstream Kafka topics, whose messages are
+// ingested through the ingest handler and republished as envelopes
+func (p *Processor) initUpstream(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	consumer, err := upstream.New(p.cfg.Upstream, p.cfg.Kafka, p.ingest)
+	if err != nil {
+		return err
+	}
+	consumer.Start(ctx)
+	p.upstream = consumer
+
+	log.Info().
+		Strs("topics", p.cfg.Upstream.Topics).
+		Str("group_id", p.cfg.Upstream.GroupID).
+		Str("format", p.cfg.Upstream.Format).
+		Msg("upstream kafka input started")
+	return nil
+}
+
+// initMQTT subscribes to MQTT topics, whose messages are ingested through
+// the ingest handler
+func (p *Processor) initMQTT(ctx context.Context) error {
+	log := logger.WithComponent("processor")
+
+	bridge, err := mqtt.New(p.cfg.MQTT, p.nodeID, p.ingest)
+	if err != nil {
+		return err
+	}
+	bridge.Start(ctx)
+	p.mqtt = bridge
+
+	log.Info().
+		Str("broker", p.cfg.MQTT.Broker).
+		Strs("topics", p.cfg.MQTT.Topics).
+		Int("qos", p.cfg.MQTT.QoS).
+		Msg("mqtt bridge started")
+	return nil
+}
+
+// initDispatcher publishes through NATS JetStream, Kinesis, Pub/Sub or AMQP with
+// the shared retry and dead-letter handling. The write shaper applies to
+// Kafka only.
+func (p *Processor) initDispatcher() error {
+	log := logger.WithComponent("processor")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// destination is where envelopes for the default topic land
+	var sender bus.Sender
+	var destination string
+	var err error
+	switch p.cfg.Bus.Backend {
+	case bus.BackendNATS:
+		sender, err = nats.Connect(ctx, p.cfg.NATS)
+		destination = p.cfg.NATS.Stream + "/" + p.cfg.NATS.SubjectPrefix + p.cfg.Kafka.Topic
+	case bus.BackendKinesis:
+		sender, err = kinesis.New(p.cfg.Kinesis)
+		destination = p.cfg.Kinesis.Region + "/" + p.cfg.Kinesis.StreamPrefix + p.cfg.Kafka.Topic
+	case bus.BackendPubSub:
+		sender, err = pubsub.New(ctx, p.cfg.PubSub)
+		destination = p.cfg.PubSub.Project + "/" + p.cfg.PubSub.TopicPrefix + p.cfg.Kafka.Topic
+	case bus.BackendAMQP:
+		sender, err = amqp.Connect(p.cfg.AMQP)
+		destination = p.cfg.AMQP.Exchange + "/" + p.cfg.AMQP.RoutingKey
+	default:
+		return fmt.Errorf("unknown bus backend %q (expected kafka, nats, kinesis, pubsub, amqp, file or forward)", p.cfg.Bus.Backend)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.producer = bus.NewDispatcher(p.cfg.Bus.Backend, sender, &bus.Encoder{
+		Topic:             p.cfg.Kafka.Topic,
+		CompressThreshold: p.cfg.Kafka.Producer.EnvelopeCompressThreshold,
+		Flags:             p.flags,
+		Cipher:            p.cipher,
+	}, bus.DispatchConfig{
+		MaxRetries:   p.cfg.Bus.MaxRetries,
+		RetryBackoff: p.cfg.Bus.RetryBackoff,
+		DLQTopic:     p.cfg.Bus.DLQTopic,
+	})
+	log.Info().
+		Str("backend", p.cfg.Bus.Backend).
+		Str("destination", destination).
+		Str("dlq_topic", p.cfg.Bus.DLQTopic).
+		Msg("message bus publisher initialized")
+	return nil
+}
+
+// initSLO creates the SLO tracker
+func (p *Processor) initSLO() {
+	p.slo = slo.NewTracker(slo.Config{
+		AvailabilityTarget: p.cfg.SLO.AvailabilityTarget,
+		LatencyTarget:      p.cfg.SLO.LatencyTarget,
+		LatencyThreshold:   p.cfg.SLO.LatencyThreshold,
+		Window:             p.cfg.SLO.Window,
+		FastBurn:           p.cfg.SLO.FastBurn,
+		SlowBurn:           p.cfg.SLO.SlowBurn,
+		AlertTenant:        p.cfg.SLO.AlertTenant,
+	})
+}
+
+// initCanary creates the canary. Its events are emitted once the ingest
+// handler exists; they are confirmed when read back from Kafka if the bus
+// is Kafka, and when published otherwise. On Kafka they rotate across the
+// main topic's partitions.
+func (p *Processor) initCanary() {
+	log := logger.WithComponent("processor")
+	confirm := canary.StagePublished
+	if p.cfg.Canary.WatchKafka && p.cfg.Bus.Backend == "kafka" {
+		confirm = canary.StageKafka
+	}
+	p.canary = canary.New(canary.Config{
+		NodeID:   p.nodeID,
+		Tenant:   p.cfg.Canary.Tenant,
+		Interval: p.cfg.Canary.Interval,
+		Timeout:  p.cfg.Canary.Timeout,
+		Confirm:  confirm,
+		Partitions: func() int {
+			if p.topicMeta == nil {
+				return 0
+			}
+			return p.topicMeta.Partitions(p.cfg.Kafka.Topic)
+		},
+	}, func(event *models.LogEvent, partition *int) { p.ingest.EmitToPartition(event, partition) })
+	log.Info().
+		Dur("interval", p.cfg.Canary.Interval).
+		Str("confirm", confirm).
+		Msg("canary events enabled")
+}
+
+// published reports the outcome of each worker publish to the SLO tracker
+// and the canary
+func (p *Processor) published(published, failed []*models.Envelope) {
+	p.slo.RecordPublish(published, failed)
+	p.usage.Published(published)
+	if p.canary != nil {
+		p.canary.Published(published, failed)
+	}
+}
+
+// watchCanaries confirms canaries read back from the Kafka topic,
+// reconnecting after read errors until ctx is cancelled
+func (p *Processor) watchCanaries(ctx context.Context) {
+	log := logger.WithComponent("canary")
+	for {
+		err := p.canary.WatchKafka(ctx, p.cfg.Kafka.Brokers, p.cfg.Kafka.Topic)
+		if err == nil {
+			return
+		}
+		log.Warn().Err(err).Msg("canary watch failed, retrying")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.Canary.Interval):
+		}
+	}
+}
+
+// initWorkerPool initializes the worker pool
+func (p *Processor) initWorkerPool() {
+	log := logger.WithComponent("processor")
+	p.workerPool = worker.NewPool(worker.Config{
+		Publisher:     p.producer,
+		EnvelopeChan:  p.envelopeChan,
+		Workers:       p.cfg.Kafka.Producer.PoolSize,
+		BatchSize:     p.cfg.Kafka.Producer.BatchSize,
+		BatchTimeout:  p.cfg.Kafka.Producer.BatchTimeout,
+		Compact:       p.cfg.Kafka.Producer.CompactBatches,
+		CompactLinger: p.cfg.Kafka.Producer.CompactLinger,
+		Budget:        p.budget,
+		OnPublish:     p.published,
+	})
+	log.Info().
+		Int("workers", p.cfg.Kafka.Producer.PoolSize).
+		Bool("compact", p.cfg.Kafka.Producer.CompactBatches).
+		Msg("worker pool initialized")
+}
+
+// initQueue sets up the envelope queue overflow policy
+func (p *Processor) initQueue() error {
+	log := logger.WithComponent("processor")
+
+	overflow, err := queue.New(p.envelopeChan, queue.Config{
+		Policy: queue.Policy(p.cfg.Queue.OverflowPolicy),
+		Grace:  p.cfg.Queue.OverflowGrace,
+		Spill: queue.SpillConfig{
+			Dir:      p.cfg.Queue.SpillDir,
+			MaxBytes: p.cfg.Queue.SpillMaxBytes,
+		},
+		Budget: p.budget,
+	})
+	if err != nil {
+		return err
+	}
+	p.overflow = overflow
+
+	log.Info().
+		Str("policy", string(overflow.Policy())).
+		Dur("grace", p.cfg.Queue.OverflowGrace).
+		Int64("max_bytes", p.cfg.Queue.MaxBytes).
+		Msg("queue overflow policy initialized")
+	return nil
+}
+
+// shrunkQueueDivisor is how much the memory watchdog shrinks the envelope
+// queue: to a quarter of its capacity
+const shrunkQueueDivisor = 4
+
+// initMemory starts the memory watchdog when a memory limit is known
+func (p *Processor) initMemory() error {
+	log := logger.WithComponent("processor")
+
+	memory, err := memguard.New(memguard.Config{
+		Limit:       p.cfg.Memory.LimitBytes,
+		ShrinkQueue: float64(p.cfg.Memory.ShrinkQueuePercent) / 100,
+		RejectDebug: float64(p.cfg.Memory.RejectDebugPercent) / 100,
+		Flush:       float64(p.cfg.Memory.FlushPercent) / 100,
+		Interval:    p.cfg.Memory.CheckInterval,
+	}, memoryShedder{p})
+	if err != nil {
+		return err
+	}
+	if memory == nil {
+		log.Info().Msg("no memory limit set (GOMEMLIMIT or MEMORY_LIMIT_BYTES), memory watchdog disabled")
+		return nil
+	}
+	p.memory = memory
+
+	log.Info().
+		Int64("limit_bytes", memory.Limit()).
+		Int("shrink_queue_percent", p.cfg.Memory.ShrinkQueuePercent).
+		Int("reject_debug_percent", p.cfg.Memory.RejectDebugPercent).
+		Int("flush_percent", p.cfg.Memory.FlushPercent).
+		Msg("memory watchdog initialized")
+	return nil
+}
+
+// memoryShedder sheds load for the memory watchdog
+type memoryShedder struct {
+	p *Processor
+}
+
+// ShrinkQueue caps the envelope queue at a fraction of its capacity
+func (s memoryShedder) ShrinkQueue(shrink bool) {
+	limit := 0
+	if shrink {
+		limit = max(cap(s.p.envelopeChan)/shrunkQueueDivisor, 1)
+	}
+	s.p.overflow.SetLimit(limit)
+}
+
+// Flush publishes the workers' partial batches and releases events held
+// for multi-line reassembly
+func (s memoryShedder) Flush() {
+	s.p.workerPool.Flush()
+	if s.p.assembler != nil && s.p.ingest != nil {
+		s.p.assembler.FlushAll(s.p.ingest.Emit)
+	}
+}
+
+// initExports sets up tenant export jobs when an export location is configured
+func (p *Processor) initExports() error {
+	if p.cfg.Export.Location == "" {
+		return nil
+	}
+
+	log := logger.WithComponent("processor")
+
+	// Exports read events back from Kafka
+	if p.cfg.Bus.Backend != bus.BackendKafka {
+		log.Warn().Str("backend", p.cfg.Bus.Backend).Msg("tenant exports require the kafka bus; disabled")
+		return nil
+	}
+
+	dest, prefix, err := objstore.ParseUploader(p.cfg.Export.Location, objstore.S3ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+
+	source := kafka.NewScanner(p.cfg.Kafka.Brokers,
+		p.cfg.Kafka.Topic,
+		p.cfg.Kafka.ShortRetentionTopic,
+		p.cfg.Kafka.LongRetentionTopic,
+	).WithTenantTopics(p.router.Topics).WithCipher(p.cipher)
+
+	p.exports = export.NewManager(p.stateStore, source, dest, export.Config{
+		Prefix:      prefix,
+		URLTTL:      p.cfg.Export.URLTTL,
+		Concurrency: p.cfg.Export.Concurrency,
+	}).WithScheduler(p.jobs)
+
+	log.Info().Str("location", p.cfg.Export.Location).Msg("tenant exports enabled")
+	return nil
+}
+
+// initReprocess sets up reprocessing jobs over the current tenant pipeline
+// and the message bus
+func (p *Processor) initReprocess() {
+	if !p.cfg.Reprocess.Enabled {
+		return
+	}
+
+	log := logger.WithComponent("processor")
+
+	// Jobs read through temporary Kafka consumer groups
+	if p.cfg.Bus.Backend != bus.BackendKafka {
+		log.Warn().Str("backend", p.cfg.Bus.Backend).Msg("reprocessing requires the kafka bus; disabled")
+		return
+	}
+
+	offsets := kafka.NewGroupOffsets(kafka.BrokerClient(p.cfg.Kafka.Brokers))
+	source := kafka.NewRangeReader(p.cfg.Kafka.Brokers, offsets).WithCipher(p.cipher)
+	p.reprocess = reprocess.NewManager(p.stateStore, source,
+		map[string]*pipeline.Pipeline{reprocess.DefaultPipeline: pipeline.New(p.stages()...)},
+		map[string]bus.Publisher{reprocess.DefaultSink: p.producer},
+		reprocess.Config{
+			GroupPrefix: p.cfg.Reprocess.GroupPrefix,
+			Readers:     p.cfg.Reprocess.Readers,
+			Concurrency: p.cfg.Reprocess.Concurrency,
+		}).WithScheduler(p.jobs)
+
+	log.Info().Int("readers", p.cfg.Reprocess.Readers).Msg("reprocessing enabled")
+}
+
+// initErasure sets up tenant erasure jobs over the export location and any
+// extra archives. Kafka topics cannot delete single records; their events
+// age out with topic retention.
+func (p *Processor) initErasure() error {
+	locations := p.archiveLocations()
+	if len(locations) == 0 {
+		return nil
+	}
+
+	log := logger.WithComponent("processor")
+
+	var targets []erasure.Target
+	for _, location := range locations {
+		bucket, prefix, err := objstore.ParseBucket(location, objstore.S3ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", location, err)
+		}
+		targets = append(targets, erasure.NewArchive(location, bucket, prefix))
+	}
+
+	p.erasures = erasure.NewManager(p.stateStore, targets, erasure.Config{
+		JobTTL:     p.cfg.Erasure.JobTTL,
+		OnFinished: p.invalidateQueries,
+	}).WithScheduler(p.jobs)
+
+	log.Info().Strs("archives", locations).Msg("tenant erasure enabled")
+	return nil
+}
+
+// archiveLocations returns the locations laid out by tenant: the export
+// location and any extra archives
+func (p *Processor) archiveLocations() []string {
+	locations := p.cfg.Erasure.ArchiveLocations
+	if p.cfg.Export.Location != "" {
+		locations = append([]string{p.cfg.Export.Location}, locations...)
+	}
+	return locations
+}
+
+// initUsage sets up usage metering and monthly reports. Tenants' storage
+// footprint is measured over the archive locations.
+func (p *Processor) initUsage() error {
+	if !p.cfg.Usage.Enabled {
+		return nil
+	}
+
+	cfg := usage.Config{Grace: p.cfg.Usage.Grace}
+	if location := p.cfg.Usage.Location; location != "" {
+		dest, prefix, err := objstore.ParseBucket(location, objstore.S3ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("usage report location %s: %w", location, err)
+		}
+		cfg.Dest, cfg.Prefix = dest, prefix
+	}
+	for _, location := range p.archiveLocations() {
+		store, prefix, err := objstore.ParseBucket(location, objstore.S3ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", location, err)
+		}
+		cfg.Archives = append(cfg.Archives, usage.Archive{Store: store, Prefix: prefix})
+	}
+
+	p.usage = usage.NewMeter(p.stateStore)
+	p.usageReports = usage.NewReports(p.stateStore, p.jobs, cfg)
+
+	log := logger.WithComponent("processor")
+	log.Info().Str("location", p.cfg.Usage.Location).Msg("usage reports enabled")
+	return nil
 }
 
-// New constructs a Processor with given config.
-func New(cfg *config.Config) *Processor {
-	return &Processor{
-		cfg:          cfg,
-		envelopeChan: make(chan *models.Envelope, 1000), // Buffer for 1000 envelopes
+// invalidateQueries drops a tenant's cached query results
+func (p *Processor) invalidateQueries(ctx context.Context, tenantID string) {
+	if p.queryCache == nil {
+		return
+	}
+	if err := p.queryCache.Invalidate(ctx, tenantID); err != nil {
+		log := logger.WithComponent("processor")
+		log.Warn().Err(err).Str("tenant_id", tenantID).Msg("failed to invalidate cached queries")
 	}
 }
 
-// Run starts background goroutines and blocks until context cancelled.
-func (p *Processor) Run(ctx context.Context) error {
+// initBrowser sets up source map storage and the geo database for browser
+// error reports
+func (p *Processor) initBrowser() error {
+	if len(p.cfg.Browser.Tenants) == 0 {
+		return nil
+	}
+
 	log := logger.WithComponent("processor")
-	log.Info().Msg("processor starting")
 
-	// Initialize Kafka producer
-	if err := p.initProducer(); err != nil {
-		log.Error().Err(err).Msg("failed to initialize producer")
-		return fmt.Errorf("failed to initialize producer: %w", err)
+	if location := p.cfg.Browser.SourceMapsLocation; location != "" {
+		bucket, prefix, err := objstore.ParseBucket(location, objstore.S3ConfigFromEnv())
+		if err != nil {
+			return fmt.Errorf("source maps %s: %w", location, err)
+		}
+		p.sourceMaps = browser.NewSourceMaps(bucket, prefix)
 	}
-	defer p.producer.Close()
 
-	// Initialize worker pool
-	p.initWorkerPool()
-	p.workerPool.Start()
-	defer p.workerPool.Stop()
+	if path := p.cfg.Browser.GeoIPFile; path != "" {
+		geo, err := browser.LoadGeoDB(path)
+		if err != nil {
+			return fmt.Errorf("geoip %s: %w", path, err)
+		}
+		p.geo = geo
+	}
 
-	// Initialize HTTP server
-	if err := p.initHTTPServer(); err != nil {
-		log.Error().Err(err).Msg("failed to initialize HTTP server")
-		return fmt.Errorf("failed to initialize HTTP server: %w", err)
+	log.Info().
+		Strs("tenants", p.cfg.Browser.Tenants).
+		Bool("source_maps", p.sourceMaps != nil).
+		Int("geo_networks", p.geo.Len()).
+		Msg("browser error reporting enabled")
+	return nil
+}
+
+// initSelfMonitor attaches the self-monitoring log hook when enabled
+func (p *Processor) initSelfMonitor() {
+	if !p.cfg.SelfMonitor.Enabled {
+		return
 	}
 
-	// Start HTTP server in background
-	p.wg.Add(1)
-	go func() {
-		defer p.wg.Done()
-		log.Info().Str("addr", ":8080").Msg("starting HTTP server")
-		if err := p.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Error().Err(err).Msg("HTTP server error")
-		}
-	}()
+	log := logger.WithComponent("processor")
 
-	// Stats reporting goroutine
-	p.wg.Add(1)
-	go func() {
-		defer p.wg.Done()
-		p.reportStats(ctx)
-	}()
+	minLevel, err := zerolog.ParseLevel(p.cfg.SelfMonitor.MinLevel)
+	if err != nil {
+		minLevel = zerolog.WarnLevel
+	}
 
-	// Wait for shutdown signal
-	<-ctx.Done()
-	log.Info().Msg("shutdown signal received")
+	p.selfMonitor = selfmon.NewHook(selfmon.Config{
+		EnvelopeChan:  p.envelopeChan,
+		NodeID:        p.nodeID,
+		MinLevel:      minLevel,
+		RatePerSecond: p.cfg.SelfMonitor.RatePerSecond,
+		DedupeWindow:  p.cfg.SelfMonitor.DedupeWindow,
+	})
+	logger.AddHook(p.selfMonitor)
 
-	// Graceful shutdown
-	return p.shutdown()
+	log.Info().
+		Str("tenant_id", models.InternalTenantID).
+		Str("min_level", minLevel.String()).
+		Msg("self-monitoring enabled")
 }
 
-// initProducer initializes the Kafka producer
-func (p *Processor) initProducer() error {
+// initPresets loads tenant/source format preset bindings
+func (p *Processor) initPresets() error {
 	log := logger.WithComponent("processor")
-	producer, err := kafka.NewProducer(
-		p.cfg.Kafka.Brokers,
-		p.cfg.Kafka.Topic,
-		p.cfg.Kafka.Producer,
-	)
+
+	var bindings []presets.Binding
+	if p.cfg.Ingest.FormatPresets != "" {
+		parsed, err := presets.ParseBindings([]byte(p.cfg.Ingest.FormatPresets))
+		if err != nil {
+			return err
+		}
+		bindings = append(bindings, parsed...)
+	}
+
+	if p.cfg.Ingest.FormatPresetsFile != "" {
+		data, err := os.ReadFile(p.cfg.Ingest.FormatPresetsFile)
+		if err != nil {
+			return err
+		}
+		parsed, err := presets.ParseBindings(data)
+		if err != nil {
+			return err
+		}
+		bindings = append(bindings, parsed...)
+	}
+
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	registry, err := presets.NewRegistry(bindings)
 	if err != nil {
 		return err
 	}
+	p.presets = registry
 
-	p.producer = producer
 	log.Info().
-		Strs("brokers", p.cfg.Kafka.Brokers).
-		Str("topic", p.cfg.Kafka.Topic).
-		Msg("kafka producer initialized")
+		Int("bindings", len(bindings)).
+		Strs("available", presets.Names()).
+		Msg("format presets enabled")
 	return nil
 }
 
-// initWorkerPool initializes the worker pool
-func (p *Processor) initWorkerPool() {
+// initPlugins loads the configured WASM plugins
+func (p *Processor) initPlugins(ctx context.Context) error {
 	log := logger.WithComponent("processor")
-	p.workerPool = worker.NewPool(worker.Config{
-		Publisher:    p.producer,
-		EnvelopeChan: p.envelopeChan,
-		Workers:      p.cfg.Kafka.Producer.PoolSize,
-		BatchSize:    p.cfg.Kafka.Producer.BatchSize,
-		BatchTimeout: p.cfg.Kafka.Producer.BatchTimeout,
+
+	var specs []plugins.Spec
+	if p.cfg.Plugins.Specs != "" {
+		parsed, err := plugins.ParseSpecs([]byte(p.cfg.Plugins.Specs))
+		if err != nil {
+			return err
+		}
+		specs = append(specs, parsed...)
+	}
+
+	if p.cfg.Plugins.SpecsFile != "" {
+		data, err := os.ReadFile(p.cfg.Plugins.SpecsFile)
+		if err != nil {
+			return err
+		}
+		parsed, err := plugins.ParseSpecs(data)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, parsed...)
+	}
+
+	for _, spec := range specs {
+		plugin, err := plugins.Load(ctx, spec)
+		if err != nil {
+			p.closePlugins()
+			return err
+		}
+		p.plugins = append(p.plugins, plugin)
+
+		log.Info().
+			Str("plugin", spec.Name).
+			Str("path", spec.Path).
+			Strs("capabilities", spec.Capabilities).
+			Msg("plugin loaded")
+	}
+	return nil
+}
+
+// closePlugins releases plugin runtimes
+func (p *Processor) closePlugins() {
+	for _, plugin := range p.plugins {
+		plugin.Close(context.Background())
+	}
+	p.plugins = nil
+}
+
+// authenticator loads the API keys and token secret callers authenticate
+// with, and the keys rotated since
+func (p *Processor) authenticator() (*rbac.Authenticator, error) {
+	var keys []rbac.Key
+	if p.cfg.Auth.Keys != "" {
+		parsed, err := rbac.ParseKeys([]byte(p.cfg.Auth.Keys))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed...)
+	}
+
+	if p.cfg.Auth.KeysFile != "" {
+		data, err := os.ReadFile(p.cfg.Auth.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := rbac.ParseKeys(data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed...)
+	}
+
+	authn, err := rbac.NewAuthenticator(rbac.Config{
+		Keys:          keys,
+		APIKey:        p.cfg.Auth.APIKey,
+		JWTSecret:     []byte(p.cfg.Auth.JWTSecret),
+		Store:         p.stateStore,
+		ExpiryWarning: p.cfg.Auth.ExpiryWarning,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := authn.Load(context.Background()); err != nil {
+		log := logger.WithComponent("processor")
+		log.Warn().Err(err).Msg("failed to load rotated API keys")
+	}
+	return authn, nil
+}
+
+// protocols lists the transports and ingest modes this node accepts, as
+// announced to clients
+func (p *Processor) protocols() []string {
+	protocols := []string{"http/1.1"}
+	if p.cfg.HTTP.TLSCertFile != "" && p.cfg.HTTP.HTTP2 {
+		protocols = append(protocols, "h2")
+	}
+	if p.cfg.HTTP.H2C {
+		protocols = append(protocols, "h2c")
+	}
+	if p.cfg.Receipts.Enabled {
+		protocols = append(protocols, "async")
+	}
+	if p.cfg.Uploads.Enabled {
+		protocols = append(protocols, "uploads")
+	}
+	if p.cfg.Forward.Server.Addr != "" {
+		protocols = append(protocols, "forward")
+	}
+	return protocols
+}
+
+// initMultiline loads multi-line rules and creates the assembler if any exist
+func (p *Processor) initMultiline() error {
+	log := logger.WithComponent("processor")
+
+	var rules []multiline.Rule
+	if p.cfg.Multiline.Rules != "" {
+		parsed, err := multiline.ParseRules([]byte(p.cfg.Multiline.Rules))
+		if err != nil {
+			return err
+		}
+		rules = append(rules, parsed...)
+	}
+
+	if p.cfg.Multiline.RulesFile != "" {
+		data, err := os.ReadFile(p.cfg.Multiline.RulesFile)
+		if err != nil {
+			return err
+		}
+		parsed, err := multiline.ParseRules(data)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, parsed...)
+	}
+
+	presetRules, err := p.presets.MultilineRules()
+	if err != nil {
+		return err
+	}
+	rules = append(rules, presetRules...)
+
+	// Tailed files are reassembled per file
+	if len(p.cfg.Tail.Paths) > 0 && p.cfg.Tail.MultilinePattern != "" {
+		rule := multiline.Rule{
+			TenantID:     p.cfg.Tail.Tenant,
+			Source:       p.cfg.Tail.Source,
+			StartPattern: p.cfg.Tail.MultilinePattern,
+		}
+		if err := rule.Compile(); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	p.assembler = multiline.NewAssembler(multiline.Config{
+		Rules:        rules,
+		FlushTimeout: p.cfg.Multiline.FlushTimeout,
+		MaxLines:     p.cfg.Multiline.MaxLines,
 	})
-	log.Info().Int("workers", p.cfg.Kafka.Producer.PoolSize).Msg("worker pool initialized")
+	log.Info().
+		Int("rules", len(rules)).
+		Dur("flush_timeout", p.cfg.Multiline.FlushTimeout).
+		Msg("multi-line reassembly enabled")
+	return nil
+}
+
+// stages returns the tenant-defined pipeline stages: scripts, then plugins
+// in configuration order, then field type coercion and schema validation of
+// the resulting metadata
+func (p *Processor) stages() []pipeline.Stage {
+	stages := []pipeline.Stage{p.scripts}
+	for _, plugin := range p.plugins {
+		stages = append(stages, plugin)
+	}
+	return append(stages, p.fieldTypes, p.schemas)
 }
 
 // initHTTPServer initializes the HTTP server with handlers
 func (p *Processor) initHTTPServer() error {
-	mux := http.NewServeMux()
+	duplicates, err := handlers.ParseDuplicatePolicy(p.cfg.Ingest.DuplicatePolicy)
+	if err != nil {
+		return err
+	}
+
+	// Receipts are kept in the shared state store so any node can answer
+	// for a batch. Async batches report their status through them.
+	var batchReceipts *receipts.Store
+	if p.cfg.Receipts.Enabled {
+		batchReceipts = receipts.NewStore(p.stateStore, []byte(p.cfg.Receipts.SigningKey), p.cfg.Receipts.TTL)
+	}
+
+	// The operator console shows recent events from this node's ingest
+	var feed *ui.Feed
+	if p.cfg.UI.Enabled {
+		feed = ui.NewFeed(ui.FeedConfig{Size: p.cfg.UI.TailSize})
+	}
 
 	// Ingest handler (with middleware)
-	ingestHandler := handlers.NewIngestHandler(handlers.IngestConfig{
+	p.ingest = handlers.NewIngestHandler(handlers.IngestConfig{
 		EnvelopeChan: p.envelopeChan,
-		NodeID:       "",               // Will use hostname
-		MaxBodySize:  10 * 1024 * 1024, // 10MB
+		NodeID:       p.nodeID,
+		Region:       p.cfg.Region.Name,
+		MaxBodySize:  p.cfg.Ingest.MaxBodySize,
+		Truncation: models.TruncationPolicy{
+			Enabled:   p.cfg.Ingest.TruncateMessages,
+			HeadBytes: p.cfg.Ingest.TruncateHeadBytes,
+			TailBytes: p.cfg.Ingest.TruncateTailBytes,
+		},
+		Assembler: p.assembler,
+		Presets:   p.presets,
+		Metadata:  p.metadata,
+		Topic:     p.cfg.Kafka.Topic,
+		Router:    p.router,
+		Overflow:  p.overflow,
+		Stages:    p.stages(),
+
+		MaxEventBytes: p.cfg.Ingest.MaxEventBytes,
+		MaxBatchBytes: p.cfg.Ingest.MaxBatchBytes,
+		Duplicates:    duplicates,
+
+		Heartbeats:  p.heartbeats,
+		Feed:        feed,
+		Suspensions: p.suspensions,
+		Tiers:       p.tiers,
+		Memory:      p.memory,
+		Receipts:    batchReceipts,
+		Async: &handlers.AsyncConfig{
+			MaxBodySize:    p.cfg.Ingest.AsyncMaxBodySize,
+			MaxPending:     p.cfg.Ingest.AsyncMaxPending,
+			MaxStagedBytes: p.cfg.Ingest.AsyncMaxStagedBytes,
+			Workers:        p.cfg.Ingest.AsyncWorkers,
+		},
+	})
+	limiter := ratelimit.NewLimiter(p.stateStore, ratelimit.Config{
+		Limit:  p.cfg.RateLimit.Requests,
+		Window: p.cfg.RateLimit.Window,
+	})
+	verifier := signing.NewVerifier(p.stateStore, signing.Config{
+		Secret:  p.cfg.Signing.Secret,
+		MaxSkew: p.cfg.Signing.MaxSkew,
+	})
+
+	// Requests agents send are sampled while the request_capture flag is on
+	p.captures = capture.NewRecorder(p.flags, capture.Config{
+		PerMinute:    p.cfg.Capture.PerMinute,
+		MaxBodyBytes: p.cfg.Capture.MaxBodyBytes,
+		Size:         p.cfg.Capture.BufferSize,
+	})
+
+	authn, err := p.authenticator()
+	if err != nil {
+		return err
+	}
+	p.authn = authn
+
+	proxies, err := abuse.ParseProxies(p.cfg.Abuse.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	p.abuse = abuse.NewDetector(p.stateStore, abuse.Config{
+		Window:          p.cfg.Abuse.Window,
+		TarpitThreshold: p.cfg.Abuse.TarpitThreshold,
+		TarpitDelay:     p.cfg.Abuse.TarpitDelay,
+		BlockThreshold:  p.cfg.Abuse.BlockThreshold,
+		BlockDuration:   p.cfg.Abuse.BlockDuration,
+		TrustedProxies:  proxies,
 	})
-	mux.Handle("/ingest", middleware.Chain(
-		ingestHandler,
-		middleware.Recovery,
-		middleware.Logging,
-		middleware.Auth,
-	))
+	if p.abuse != nil {
+		if err := p.abuse.Load(context.Background()); err != nil {
+			log := logger.WithComponent("processor")
+			log.Warn().Err(err).Msg("failed to load abuse blocks")
+		}
+	}
+
+	// Route groups, each adding middleware to the one before. Agent
+	// endpoints slow down and refuse sources of failing requests, are
+	// captured and authenticate themselves (or not at all); authed ones
+	// need a key or token with the ingest role, limited ones refuse
+	// suspended tenants and are rate limited, and ingest ones are also
+	// signed and count towards the availability SLO.
+	// Admin endpoints need a reading role to look and a managing one to
+	// change anything, and are never captured. Scoped ones also take the
+	// tenant from X-Scope-OrgID, for the Loki API.
+	router := httpserver.NewRouter()
+	signedBody := p.cfg.Ingest.MaxBodySize
+	if p.cfg.Receipts.Enabled {
+		// Async batches may be larger than sync ones
+		signedBody = max(signedBody, p.cfg.Ingest.AsyncMaxBodySize)
+	}
+	agents := router.Group(middleware.Recovery, middleware.Logging, middleware.Abuse(p.abuse), p.captures.Middleware)
+	authed := agents.Group(middleware.Authorize(authn, rbac.PermIngest))
+	limited := authed.Group(middleware.Suspended(p.suspensions), middleware.RateLimit(limiter))
+	ingest := limited.Group(middleware.Signature(verifier, signedBody), p.slo.Middleware)
+	admin := router.Group(middleware.Recovery, middleware.Logging, middleware.Authorize(authn, rbac.PermManage))
+	scoped := router.Group(middleware.Recovery, middleware.Logging, middleware.AuthorizeScoped(authn, rbac.PermManage))
+
+	ingest.Handle("/ingest", p.ingest)
+
+	// Envelopes forwarded by edge nodes
+	p.forwarded = handlers.NewForwardHandler(p.ingest)
+	ingest.Handle("/ingest/forward", p.forwarded)
+
+	// Preferred ingest endpoints for SDKs
+	if p.cfg.Discovery.Enabled {
+		regions, err := discovery.ParseRegions(p.cfg.Discovery.Regions)
+		if err != nil {
+			return err
+		}
+		p.discovery = discovery.NewRegistry(p.stateStore, discovery.Config{
+			Self: discovery.Node{
+				ID:        p.nodeID,
+				Region:    p.cfg.Region.Name,
+				URL:       p.cfg.Discovery.URL,
+				Protocols: p.protocols(),
+			},
+			Load:     p.forwarded.Pressure,
+			Interval: p.cfg.Discovery.Interval,
+			Regions:  regions,
+		})
+		authed.Handle("/discover", handlers.NewDiscoverHandler(p.discovery))
+	}
+
+	// Resumable uploads of large dumps, ingested as background jobs
+	if p.cfg.Uploads.Enabled {
+		p.uploads, err = uploads.NewManager(p.stateStore, p.ingest.IngestLines, uploads.Config{
+			Dir:      p.cfg.Uploads.Dir,
+			NodeID:   p.nodeID,
+			MaxBytes: p.cfg.Uploads.MaxBytes,
+			TTL:      p.cfg.Uploads.TTL,
+		})
+		if err != nil {
+			return err
+		}
+		p.uploads.WithScheduler(p.jobs)
+
+		uploadsHandler := handlers.NewUploadsHandler(p.uploads, p.cfg.Ingest.MaxBodySize)
+		ingest.Handle("/uploads", uploadsHandler)
+		ingest.Handle("/uploads/{id}", uploadsHandler)
+		ingest.Handle("/uploads/{id}/commit", uploadsHandler)
+	}
+
+	// Receipts of ingest batches, for agents reconciling what was accepted
+	if batchReceipts != nil {
+		authed.Handle("/batches/{id}", handlers.NewBatchesHandler(batchReceipts))
+	}
+
+	// Windows events posted by Windows Event Forwarding collectors
+	ingest.Handle("/ingest/windows", handlers.NewWindowsHandler(p.ingest, p.cfg.Ingest.WindowsTenant))
+
+	// JavaScript error reports from browsers. sendBeacon cannot send an API
+	// key, so the endpoint is limited to the configured tenants instead.
+	if len(p.cfg.Browser.Tenants) > 0 {
+		agents.Handle("/ingest/browser", handlers.NewBrowserHandler(p.ingest, handlers.BrowserConfig{
+			Tenants:           p.cfg.Browser.Tenants,
+			SourceMaps:        p.sourceMaps,
+			Geo:               p.geo,
+			TrustForwardedFor: p.cfg.Browser.TrustForwardedFor,
+		}))
+	}
+
+	// Sentry SDK envelopes, authenticated by the DSN's public key
+	if p.cfg.Sentry.Projects != "" {
+		projects, err := sentry.ParseProjects(p.cfg.Sentry.Projects)
+		if err != nil {
+			return fmt.Errorf("invalid sentry projects: %w", err)
+		}
+		agents.Handle("/api/{project}/envelope/", handlers.NewSentryHandler(p.ingest, projects))
+	}
+
+	// Agents register sources they expect to keep sending
+	if p.heartbeats != nil {
+		heartbeats := handlers.NewHeartbeatHandler(p.heartbeats)
+		limited.Handle("/heartbeats/{tenant}", heartbeats)
+		limited.Handle("/heartbeats/{tenant}/{source}", heartbeats)
+	}
+
+	// Caller quota introspection (does not consume quota)
+	authed.Handle("/limits", handlers.NewLimitsHandler(limiter))
+
+	// Dry run shares the ingest stages but never publishes
+	authed.Handle("/ingest/dry-run", handlers.NewDryRunHandler(p.ingest))
+
+	// Feature flag admin
+	admin.Handle("/admin/flags", handlers.NewFlagsHandler(p.flags))
+
+	// Kafka write shaper
+	admin.Handle("/admin/shaper", handlers.NewShaperHandler(p.shaper))
+
+	// Resolved configuration with value sources, secrets redacted
+	admin.Handle("/admin/config", handlers.NewConfigHandler(p.cfg))
+
+	// Blocked and tarpitted sources of failing requests
+	if p.abuse != nil {
+		abuseHandler := handlers.NewAbuseHandler(p.abuse)
+		admin.Handle("/admin/abuse", abuseHandler)
+		admin.Handle("/admin/abuse/{source}", abuseHandler)
+	}
+
+	// Tenant ingestion pause and block
+	suspensions := handlers.NewSuspensionHandler(p.suspensions)
+	admin.Handle("/admin/suspensions", suspensions)
+	admin.Handle("/admin/tenants/{tenant}/suspension", suspensions)
+
+	// Tenant service tiers
+	tierHandler := handlers.NewTiersHandler(p.tiers)
+	admin.Handle("/admin/tiers", tierHandler)
+	admin.Handle("/admin/tenants/{tenant}/tier", tierHandler)
+
+	// API key listing and rotation
+	keys := handlers.NewKeysHandler(authn, p.cfg.Auth.RotationOverlap)
+	admin.Handle("/admin/keys", keys)
+	admin.Handle("/admin/keys/{id}/rotate", keys)
+
+	// Active stage graph, counters and config hashes
+	admin.Handle("/admin/pipeline", handlers.NewPipelineHandler(p.ingest))
+
+	// Tenant routing rules admin
+	admin.Handle("/admin/tenants/{tenant}/routes", handlers.NewRoutingHandler(p.router))
+
+	// Tenant Kafka partition pin admin
+	admin.Handle("/admin/tenants/{tenant}/partitions", handlers.NewPartitionsHandler(p.balancer))
+
+	// Consumer group offset reset admin
+	admin.Handle("/admin/consumer-groups/{group}/offsets",
+		handlers.NewOffsetsHandler(kafka.NewGroupOffsets(kafka.BrokerClient(p.cfg.Kafka.Brokers)), p.cfg.Kafka.Topic))
+
+	// Tenant scripts admin
+	admin.Handle("/admin/tenants/{tenant}/script", handlers.NewScriptHandler(p.scripts))
+
+	// Tenant metadata policy admin
+	admin.Handle("/admin/tenants/{tenant}/metadata-policy", handlers.NewMetadataPolicyHandler(p.metadata))
+
+	// Tenant field type rules admin
+	admin.Handle("/admin/tenants/{tenant}/field-types", handlers.NewFieldTypeHandler(p.fieldTypes))
+
+	// Tenant metadata schemas admin
+	admin.Handle("/admin/tenants/{tenant}/schema", handlers.NewSchemaHandler(p.schemas))
+
+	// Tenant source maps for browser reports
+	if p.sourceMaps != nil {
+		admin.Handle("/admin/tenants/{tenant}/sourcemaps", handlers.NewSourceMapHandler(p.sourceMaps))
+	}
+
+	// Sampled agent requests
+	admin.Handle("/admin/captures", handlers.NewCapturesHandler(p.captures))
+
+	// Background jobs of every kind
+	jobsAdmin := handlers.NewJobsHandler(p.jobs)
+	admin.Handle("/admin/jobs", jobsAdmin)
+	admin.Handle("/admin/jobs/{id}", jobsAdmin)
+
+	// Monthly usage reports for billing
+	if p.usageReports != nil {
+		reports := handlers.NewUsageReportsHandler(p.usageReports)
+		admin.Handle("/admin/usage-reports", reports)
+		admin.Handle("/admin/usage-reports/{month}", reports)
+	}
+
+	// Reprocessing jobs
+	reprocessJobs := handlers.NewReprocessHandler(p.reprocess)
+	admin.Handle("/admin/reprocess", reprocessJobs)
+	admin.Handle("/admin/reprocess/{id}", reprocessJobs)
+
+	// Tenant data exports
+	exports := handlers.NewExportHandler(p.exports)
+	admin.Handle("/admin/tenants/{tenant}/exports", exports)
+	admin.Handle("/admin/tenants/{tenant}/exports/{id}", exports)
+
+	// Tenant data erasure (right to erasure)
+	erasures := handlers.NewErasureHandler(p.erasures)
+	admin.Handle("/admin/tenants/{tenant}/erasures", erasures)
+	admin.Handle("/admin/tenants/{tenant}/erasures/{id}", erasures)
+
+	// Loki-compatible query API, so Grafana's Loki datasource can explore
+	// events. It reads them back from Kafka like exports do.
+	if p.cfg.Query.Enabled {
+		if p.cfg.Bus.Backend != bus.BackendKafka {
+			log := logger.WithComponent("processor")
+			log.Warn().Str("backend", p.cfg.Bus.Backend).Msg("the query API requires the kafka bus; disabled")
+		} else {
+			source := kafka.NewScanner(p.cfg.Kafka.Brokers,
+				p.cfg.Kafka.Topic,
+				p.cfg.Kafka.ShortRetentionTopic,
+				p.cfg.Kafka.LongRetentionTopic,
+			).WithTenantTopics(p.router.Topics).WithCipher(p.cipher)
+
+			if p.cfg.Query.CacheTTL > 0 {
+				p.queryCache = querycache.New(p.stateStore, querycache.Config{
+					TTL:         p.cfg.Query.CacheTTL,
+					Bucket:      p.cfg.Query.CacheBucket,
+					MaxBytes:    p.cfg.Query.CacheMaxBytes,
+					LoadTimeout: p.cfg.Query.CacheLoadTimeout,
+				})
+			}
+			loki := handlers.NewLokiHandler(source, handlers.LokiConfig{
+				MaxLimit: p.cfg.Query.MaxLimit,
+				MaxRange: p.cfg.Query.MaxRange,
+				Cache:    p.queryCache,
+				OnQuery:  p.usage.Query,
+			})
+			scoped.HandleFunc("GET /loki/api/v1/labels", loki.Labels)
+			scoped.HandleFunc("GET /loki/api/v1/label/{name}/values", loki.LabelValues)
+			scoped.HandleFunc("GET /loki/api/v1/query_range", loki.QueryRange)
+			scoped.HandleFunc("GET /loki/api/v1/query", loki.Query)
+
+			// Saved searches run on the query API and alert like heartbeats
+			p.searches = alerts.NewSearchMonitor(p.stateStore, alerts.NewNoopEngine(), loki)
+			searches := handlers.NewSearchHandler(p.searches)
+			admin.Handle("/searches/{tenant}", searches)
+			admin.Handle("/searches/{tenant}/{name}", searches)
+		}
+	}
+
+	// Operator console. The page itself is public; its data needs the API
+	// key, which the page asks for.
+	if feed != nil {
+		console := handlers.NewUIHandler(feed, p.heartbeats, p.slo)
+		router.Handle("GET /ui/", ui.Assets("/ui/"))
+		admin.HandleFunc("GET /ui/api/tail", console.Tail)
+		admin.HandleFunc("GET /ui/api/errors", console.Errors)
+		admin.HandleFunc("GET /ui/api/alerts", console.Alerts)
+	}
 
 	// Health check
-	mux.HandleFunc("/health", p.healthHandler)
+	router.HandleFunc("GET /health", p.healthHandler)
 
 	// Stats endpoint
-	mux.HandleFunc("/stats", p.statsHandler)
+	router.HandleFunc("GET /stats", p.statsHandler)
+
+	// Error budgets and burn rates
+	router.HandleFunc("GET /slo", p.sloHandler)
 
 	// Prometheus metrics endpoint
-	mux.Handle("/metrics", promhttp.Handler())
+	router.Handle("GET /metrics", promhttp.Handler())
 
 	// Initialize queue capacity metric
 	metrics.WorkerQueueCapacity.Set(float64(cap(p.envelopeChan)))
 
-	p.httpServer = &http.Server{
-		Addr:         ":8080",
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	server, err := httpserver.New(p.cfg.HTTP, router)
+	if err != nil {
+		return err
 	}
+	p.httpServer = server
 
 	return nil
 }
@@ -172,8 +2209,55 @@ func (p *Processor) shutdown() error {
 	if err := p.httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("HTTP server shutdown error")
 	}
+	if p.forwardSrv != nil {
+		// Edge nodes resend anything not yet acknowledged
+		p.forwardSrv.Close()
+	}
+	if p.journal != nil {
+		// The cursor is saved; entries not yet submitted are re-read
+		if err := p.journal.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to save journal cursor")
+		}
+	}
+	if p.tailer != nil {
+		// Offsets are saved; lines not yet submitted are re-read
+		p.tailer.Close()
+	}
+	if p.containers != nil {
+		p.containers.Close()
+	}
+	if p.upstream != nil {
+		// Offsets of handled messages are committed on close
+		if err := p.upstream.Close(); err != nil {
+			log.Error().Err(err).Msg("upstream kafka consumer close error")
+		}
+	}
+	if p.mqtt != nil {
+		// Unacknowledged messages are redelivered by the broker
+		p.mqtt.Close()
+	}
 
-	// 2. Close envelope channel to signal no more incoming envelopes
+	// Running background jobs are marked failed: exports and reprocessing
+	// can be requested again, and erasing again is safe
+	if p.jobs != nil {
+		p.jobs.Close()
+	}
+
+	// 2. Close envelope channel to signal no more incoming envelopes, once
+	// the goroutines emitting events (alerts, canaries, multi-line flushes,
+	// async batches) have seen the cancelled context and returned
+	p.emitters.Wait()
+	if p.assembler != nil {
+		log.Info().Int("pending", p.assembler.Pending()).Msg("flushing multi-line events")
+		p.assembler.FlushAll(p.ingest.Emit)
+	}
+	if p.selfMonitor != nil {
+		p.selfMonitor.Close()
+	}
+	p.ingest.Stop()
+	if err := p.overflow.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to close spill file")
+	}
 	log.Info().Msg("closing envelope channel")
 	close(p.envelopeChan)
 
@@ -192,7 +2276,7 @@ func (p *Processor) shutdown() error {
 	}
 
 	// 4. Close producer
-	log.Info().Msg("closing kafka producer")
+	log.Info().Msg("closing message bus publisher")
 	if err := p.producer.Close(); err != nil {
 		log.Error().Err(err).Msg("producer close error")
 	}
@@ -233,12 +2317,28 @@ func (p *Processor) reportStats(ctx context.Context) {
 	}
 }
 
+// queueStats reports the envelope queue and pipeline counters for crash
+// reports
+func (p *Processor) queueStats() any {
+	workerStats := p.workerPool.Stats()
+	producerStats := p.producer.Stats()
+	return map[string]any{
+		"queue_size":       len(p.envelopeChan),
+		"queue_capacity":   cap(p.envelopeChan),
+		"queue_bytes":      p.budget.Used(),
+		"worker_processed": workerStats.Processed,
+		"worker_failed":    workerStats.Failed,
+		"producer_sent":    producerStats.MessagesSent,
+		"producer_failed":  producerStats.MessagesFailed,
+	}
+}
+
 // healthHandler handles health check requests
 func (p *Processor) healthHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	// Check Kafka connectivity
+	// Check message bus connectivity
 	if err := p.producer.HealthCheck(ctx); err != nil {
 		http.Error(w, fmt.Sprintf("unhealthy: %v", err), http.StatusServiceUnavailable)
 		return
@@ -248,35 +2348,3 @@ func (p *Processor) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status":"healthy","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
 }
-
-// statsHandler returns current statistics
-func (p *Processor) statsHandler(w http.ResponseWriter, r *http.Request) {
-	workerStats := p.workerPool.Stats()
-	producerStats := p.producer.Stats()
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{
-		"worker": {
-			"processed": %d,
-			"failed": %d
-		},
-		"producer": {
-			"messages_sent": %d,
-			"messages_failed": %d,
-			"bytes_written": %d
-		},
-		"channel": {
-			"buffered": %d,
-			"capacity": %d
-		}
-	}`,
-		workerStats.Processed,
-		workerStats.Failed,
-		producerStats.MessagesSent,
-		producerStats.MessagesFailed,
-		producerStats.BytesWritten,
-		len(p.envelopeChan),
-		cap(p.envelopeChan),
-	)
-}
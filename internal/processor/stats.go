@@ -0,0 +1,321 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"parsec/internal/batch"
+	"parsec/internal/canary"
+	"parsec/internal/kafka"
+	"parsec/internal/metrics"
+	"parsec/internal/rates"
+	"parsec/internal/worker"
+)
+
+// defaultStatsTenants is how many of the busiest tenants /stats reports
+// unless ?top= says otherwise
+const defaultStatsTenants = 10
+
+// StatsSnapshot is the processor's state as reported by /stats
+type StatsSnapshot struct {
+	NodeID        string    `json:"node_id"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+
+	Worker   WorkerSnapshot   `json:"worker"`
+	Producer ProducerSnapshot `json:"producer"`
+	Channel  ChannelSnapshot  `json:"channel"`
+	Rates    RatesSnapshot    `json:"rates"`
+
+	// Tenants are the busiest tenants by events published or failed
+	Tenants []worker.TenantStats `json:"tenants"`
+
+	// Topics is the partition layout of the Kafka topics written to
+	Topics []kafka.TopicMetadata `json:"topics,omitempty"`
+
+	// Canary reports synthetic events when CANARY_ENABLED is set
+	Canary *canary.Stats `json:"canary,omitempty"`
+}
+
+// WorkerSnapshot reports the worker pool
+type WorkerSnapshot struct {
+	Processed uint64              `json:"processed"`
+	Failed    uint64              `json:"failed"`
+	Workers   []batch.WorkerStats `json:"workers"`
+}
+
+// ProducerSnapshot reports the message bus producer; Writers is only set
+// for the Kafka producer's writer pool
+type ProducerSnapshot struct {
+	MessagesSent   uint64              `json:"messages_sent"`
+	MessagesFailed uint64              `json:"messages_failed"`
+	BytesWritten   uint64              `json:"bytes_written"`
+	Writers        []kafka.WriterStats `json:"writers,omitempty"`
+}
+
+// ChannelSnapshot reports the envelope queue with its high watermarks.
+// Byte figures are 0 unless QUEUE_MAX_BYTES bounds the queue.
+type ChannelSnapshot struct {
+	Buffered int `json:"buffered"`
+	Capacity int `json:"capacity"`
+	Peak     int `json:"peak"`
+
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	PeakBytes int64 `json:"peak_bytes"`
+}
+
+// RatesSnapshot reports per-second rates averaged over 1, 5 and 15
+// minutes. Ingest counts events the ingest handler queued for the workers;
+// publish and failures count messages the producer wrote or failed to.
+type RatesSnapshot struct {
+	IngestEvents  rates.Rates `json:"ingest_events"`
+	IngestBytes   rates.Rates `json:"ingest_bytes"`
+	PublishEvents rates.Rates `json:"publish_events"`
+	PublishBytes  rates.Rates `json:"publish_bytes"`
+	Failures      rates.Rates `json:"failures"`
+}
+
+// rateMeters average the counters behind RatesSnapshot
+type rateMeters struct {
+	ingestEvents, ingestBytes   *rates.Meter
+	publishEvents, publishBytes *rates.Meter
+	failures                    *rates.Meter
+}
+
+// newRateMeters creates meters ticked every rates.Interval
+func newRateMeters() *rateMeters {
+	return &rateMeters{
+		ingestEvents:  rates.NewMeter(rates.Interval),
+		ingestBytes:   rates.NewMeter(rates.Interval),
+		publishEvents: rates.NewMeter(rates.Interval),
+		publishBytes:  rates.NewMeter(rates.Interval),
+		failures:      rates.NewMeter(rates.Interval),
+	}
+}
+
+// snapshot returns the current rates
+func (m *rateMeters) snapshot() RatesSnapshot {
+	return RatesSnapshot{
+		IngestEvents:  m.ingestEvents.Rates(),
+		IngestBytes:   m.ingestBytes.Rates(),
+		PublishEvents: m.publishEvents.Rates(),
+		PublishBytes:  m.publishBytes.Rates(),
+		Failures:      m.failures.Rates(),
+	}
+}
+
+// rateStream is a rate with its name in metrics and text stats
+type rateStream struct {
+	name  string
+	rates rates.Rates
+}
+
+// streams lists the snapshot's rates by name
+func (s RatesSnapshot) streams() []rateStream {
+	return []rateStream{
+		{"ingest_events", s.IngestEvents},
+		{"ingest_bytes", s.IngestBytes},
+		{"publish_events", s.PublishEvents},
+		{"publish_bytes", s.PublishBytes},
+		{"failures", s.Failures},
+	}
+}
+
+// trackRates samples the counters every rates.Interval, updating the
+// meters and the rate gauges
+func (p *Processor) trackRates(ctx context.Context) {
+	ticker := time.NewTicker(rates.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.tickRates()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tickRates feeds the counters' totals to the meters
+func (p *Processor) tickRates() {
+	var ingested, ingestedBytes uint64
+	if p.ingest != nil {
+		ingested, ingestedBytes = p.ingest.Accepted()
+	}
+	producerStats := p.producer.Stats()
+
+	m := p.rates
+	m.ingestEvents.Tick(ingested)
+	m.ingestBytes.Tick(ingestedBytes)
+	m.publishEvents.Tick(producerStats.MessagesSent)
+	m.publishBytes.Tick(producerStats.BytesWritten)
+	m.failures.Tick(producerStats.MessagesFailed)
+
+	for _, stream := range m.snapshot().streams() {
+		for i, v := range stream.rates.Values() {
+			metrics.RatePerSecond.WithLabelValues(stream.name, rates.Windows[i]).Set(v)
+		}
+	}
+}
+
+// writerStatser is implemented by producers with a writer pool
+type writerStatser interface {
+	WriterStats() []kafka.WriterStats
+}
+
+// Stats takes a snapshot of the processor's state with the top busiest
+// tenants
+func (p *Processor) Stats(top int) StatsSnapshot {
+	workerStats := p.workerPool.Stats()
+	producerStats := p.producer.Stats()
+
+	s := StatsSnapshot{
+		NodeID:        p.nodeID,
+		StartedAt:     p.started,
+		UptimeSeconds: time.Since(p.started).Seconds(),
+		Worker: WorkerSnapshot{
+			Processed: workerStats.Processed,
+			Failed:    workerStats.Failed,
+			Workers:   workerStats.Workers,
+		},
+		Producer: ProducerSnapshot{
+			MessagesSent:   producerStats.MessagesSent,
+			MessagesFailed: producerStats.MessagesFailed,
+			BytesWritten:   producerStats.BytesWritten,
+		},
+		Channel: ChannelSnapshot{
+			Buffered:  len(p.envelopeChan),
+			Capacity:  cap(p.envelopeChan),
+			Bytes:     p.budget.Used(),
+			MaxBytes:  p.budget.Max(),
+			PeakBytes: p.budget.Peak(),
+		},
+		Rates:   p.rates.snapshot(),
+		Tenants: p.workerPool.TopTenants(top),
+	}
+	if p.overflow != nil {
+		s.Channel.Peak = p.overflow.Peak()
+	}
+	if ws, ok := p.producer.(writerStatser); ok {
+		s.Producer.Writers = ws.WriterStats()
+	}
+	if p.topicMeta != nil {
+		s.Topics = p.topicMeta.Topics()
+	}
+	if p.canary != nil {
+		canaryStats := p.canary.Stats()
+		s.Canary = &canaryStats
+	}
+	return s
+}
+
+// WriteText writes the snapshot as "name value" lines, for shells and
+// scripts without a JSON parser
+func (s StatsSnapshot) WriteText(w io.Writer) error {
+	lines := [][2]any{
+		{"node_id", s.NodeID},
+		{"uptime_seconds", int64(s.UptimeSeconds)},
+		{"worker.processed", s.Worker.Processed},
+		{"worker.failed", s.Worker.Failed},
+	}
+	for _, ws := range s.Worker.Workers {
+		prefix := "worker.workers." + strconv.Itoa(ws.ID)
+		lines = append(lines,
+			[2]any{prefix + ".batches", ws.Batches},
+			[2]any{prefix + ".items", ws.Items})
+	}
+	lines = append(lines,
+		[2]any{"producer.messages_sent", s.Producer.MessagesSent},
+		[2]any{"producer.messages_failed", s.Producer.MessagesFailed},
+		[2]any{"producer.bytes_written", s.Producer.BytesWritten})
+	for _, ws := range s.Producer.Writers {
+		prefix := "producer.writers." + strconv.Itoa(ws.ID)
+		lines = append(lines,
+			[2]any{prefix + ".writes", ws.Writes},
+			[2]any{prefix + ".errors", ws.Errors},
+			[2]any{prefix + ".messages", ws.Messages})
+	}
+	lines = append(lines,
+		[2]any{"channel.buffered", s.Channel.Buffered},
+		[2]any{"channel.capacity", s.Channel.Capacity},
+		[2]any{"channel.peak", s.Channel.Peak},
+		[2]any{"channel.bytes", s.Channel.Bytes},
+		[2]any{"channel.max_bytes", s.Channel.MaxBytes},
+		[2]any{"channel.peak_bytes", s.Channel.PeakBytes})
+	for _, stream := range s.Rates.streams() {
+		for i, v := range stream.rates.Values() {
+			lines = append(lines, [2]any{"rates." + stream.name + "." + rates.Windows[i], strconv.FormatFloat(v, 'f', 2, 64)})
+		}
+	}
+	for _, t := range s.Topics {
+		prefix := "topics." + t.Topic
+		lines = append(lines,
+			[2]any{prefix + ".partitions", t.Partitions},
+			[2]any{prefix + ".leader_imbalance", strconv.FormatFloat(t.LeaderImbalance, 'f', 2, 64)},
+			[2]any{prefix + ".under_replicated", t.UnderReplicated})
+	}
+	if c := s.Canary; c != nil {
+		lines = append(lines,
+			[2]any{"canary.sent", c.Sent},
+			[2]any{"canary.delivered", c.Delivered},
+			[2]any{"canary.lost", c.Lost},
+			[2]any{"canary.pending", c.Pending},
+			[2]any{"canary.last_latency_ms", strconv.FormatFloat(c.LastLatencyMS, 'f', 1, 64)})
+	}
+	for _, t := range s.Tenants {
+		prefix := "tenants." + t.TenantID
+		lines = append(lines,
+			[2]any{prefix + ".processed", t.Processed},
+			[2]any{prefix + ".failed", t.Failed})
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%s %v\n", line[0], line[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statsHandler returns current statistics as JSON, or as text lines with
+// ?format=text; ?top=N sets how many tenants are reported
+func (p *Processor) statsHandler(w http.ResponseWriter, r *http.Request) {
+	top := defaultStatsTenants
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "top must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+	snapshot := p.Stats(top)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(snapshot)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		snapshot.WriteText(w)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+	}
+}
+
+// sloHandler reports the service level objectives with their error
+// budgets and burn rates as JSON
+func (p *Processor) sloHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p.slo.Snapshot(time.Now()))
+}
@@ -0,0 +1,197 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+)
+
+// Pub/Sub quotas
+const (
+	maxMessages = 1000
+
+	// maxRequestBytes stays under the 10 MB request quota once values are
+	// base64-encoded
+	maxRequestBytes = 7 << 20
+
+	// maxAttributeValue is the longest attribute value Pub/Sub accepts
+	maxAttributeValue = 1024
+)
+
+// Scope is the OAuth scope needed to publish
+const Scope = "https://www.googleapis.com/auth/pubsub"
+
+// Sender publishes messages to Pub/Sub topics named TopicPrefix + topic
+// through the REST API. Headers become message attributes.
+type Sender struct {
+	cfg      config.PubSubConfig
+	endpoint string
+	client   *http.Client
+}
+
+// New creates a sender authenticated with Application Default Credentials.
+// When PUBSUB_EMULATOR_HOST is set it talks to the emulator without
+// credentials, like the Google client libraries.
+func New(ctx context.Context, cfg config.PubSubConfig) (*Sender, error) {
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = 10 * time.Second
+	}
+
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" && cfg.Endpoint == "" {
+		cfg.Endpoint = "http://" + host
+		return NewWithClient(cfg, &http.Client{Timeout: cfg.RequestTimeout})
+	}
+
+	tokens, err := google.DefaultTokenSource(ctx, Scope)
+	if err != nil {
+		return nil, fmt.Errorf("pubsub credentials: %w", err)
+	}
+	client := oauth2.NewClient(context.Background(), tokens)
+	client.Timeout = cfg.RequestTimeout
+	return NewWithClient(cfg, client)
+}
+
+// NewWithClient creates a sender using client to authenticate requests
+func NewWithClient(cfg config.PubSubConfig, client *http.Client) (*Sender, error) {
+	if cfg.Project == "" {
+		return nil, errors.New("pubsub project is required")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://pubsub.googleapis.com"
+	}
+	return &Sender{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+	}, nil
+}
+
+// Limits returns the publish request quotas
+func (s *Sender) Limits() bus.Limits {
+	return bus.Limits{Messages: maxMessages, Bytes: maxRequestBytes}
+}
+
+type pubsubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type publishRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+
+// Send publishes messages with one request per topic. Pub/Sub accepts or
+// rejects a request as a whole, so every message in it shares the outcome.
+func (s *Sender) Send(ctx context.Context, msgs []bus.Message) []error {
+	errs := make([]error, len(msgs))
+
+	byTopic := make(map[string][]int)
+	var topics []string
+	for i, msg := range msgs {
+		topic := s.cfg.TopicPrefix + msg.Topic
+		if _, ok := byTopic[topic]; !ok {
+			topics = append(topics, topic)
+		}
+		byTopic[topic] = append(byTopic[topic], i)
+	}
+
+	for _, topic := range topics {
+		idx := byTopic[topic]
+		req := publishRequest{Messages: make([]pubsubMessage, len(idx))}
+		for j, i := range idx {
+			req.Messages[j] = buildMessage(msgs[i])
+		}
+
+		path := "/v1/projects/" + url.PathEscape(s.cfg.Project) + "/topics/" + url.PathEscape(topic) + ":publish"
+		err := s.call(ctx, http.MethodPost, path, req)
+		for _, i := range idx {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// buildMessage converts a message; the partition key is kept as an
+// attribute since ordering keys require publisher-side ordering
+func buildMessage(m bus.Message) pubsubMessage {
+	msg := pubsubMessage{Data: m.Value, Attributes: make(map[string]string, len(m.Headers)+1)}
+	for _, h := range m.Headers {
+		msg.Attributes[h.Key] = truncate(string(h.Value))
+	}
+	if len(m.Key) > 0 {
+		msg.Attributes["partition_key"] = truncate(string(m.Key))
+	}
+	return msg
+}
+
+func truncate(s string) string {
+	if len(s) > maxAttributeValue {
+		return s[:maxAttributeValue]
+	}
+	return s
+}
+
+// call sends a REST request, marking client errors other than throttling
+// as permanent
+func (s *Sender) call(ctx context.Context, method, path string, in any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return bus.Permanent(err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("pubsub %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+		return bus.Permanent(err)
+	}
+	return err
+}
+
+// HealthCheck verifies the credentials and project by listing one topic
+func (s *Sender) HealthCheck(ctx context.Context) error {
+	return s.call(ctx, http.MethodGet, "/v1/projects/"+url.PathEscape(s.cfg.Project)+"/topics?pageSize=1", nil)
+}
+
+// Close releases idle connections
+func (s *Sender) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package querycache keeps the results of hot queries in the StateStore for
+// a few seconds, so dashboards refreshing the same panels at once run each
+// query against storage once. Queries are keyed by their normalized form
+// and time range rounded to a bucket, so "the last hour" asked a few
+// seconds apart shares an entry. Each tenant's entries carry a generation
+// which Invalidate bumps, e.g. when an erasure removes the tenant's data.
+package querycache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// keyPrefix prefixes cached results and tenant generations
+const keyPrefix = "parsec:querycache:"
+
+// Config holds cache settings
+type Config struct {
+	// TTL is how long a result is served from the cache (0 = 15s)
+	TTL time.Duration
+
+	// Bucket is what query times are rounded down to (0 = 10s)
+	Bucket time.Duration
+
+	// MaxBytes bounds the size of a cached result; larger ones are
+	// returned but not kept (0 = 1MB)
+	MaxBytes int
+
+	// LoadTimeout bounds a load shared by concurrent misses, which runs
+	// on when the caller that started it is cancelled (0 = 30s)
+	LoadTimeout time.Duration
+}
+
+// Cache caches query results shared through the StateStore
+type Cache struct {
+	store state.StateStore
+	cfg   Config
+
+	// loads runs one query per key at a time on this node
+	loads singleflight.Group
+}
+
+// New creates a cache keeping results in store
+func New(store state.StateStore, cfg Config) *Cache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 15 * time.Second
+	}
+	if cfg.Bucket <= 0 {
+		cfg.Bucket = 10 * time.Second
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 1 << 20
+	}
+	if cfg.LoadTimeout <= 0 {
+		cfg.LoadTimeout = 30 * time.Second
+	}
+	return &Cache{store: store, cfg: cfg}
+}
+
+// Bucket rounds a query time down to the cache's bucket, for keys
+func (c *Cache) Bucket(t time.Time) string {
+	return strconv.FormatInt(t.Truncate(c.cfg.Bucket).UnixNano(), 10)
+}
+
+// Key joins the parts of a query, e.g. its normalized form, range and
+// limit, into a cache key
+func Key(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// Do returns the cached result of a tenant's query, or loads and caches it.
+// Concurrent misses of a key on this node share one load, which is detached
+// from the caller that started it, so a client going away doesn't fail the
+// others; each caller still returns once its own ctx is done. Failed loads
+// are not cached, and a failing store only costs the cache.
+func (c *Cache) Do(ctx context.Context, tenantID, key string, load func(context.Context) ([]byte, error)) ([]byte, error) {
+	gen, err := c.store.Incr(ctx, generationKey(tenantID), 0)
+	if err != nil {
+		metrics.QueryCacheRequests.WithLabelValues("error").Inc()
+		return load(ctx)
+	}
+	sum := sha256.Sum256([]byte(key))
+	entry := keyPrefix + "result:" + tenantID + ":" + strconv.FormatInt(gen, 10) + ":" + hex.EncodeToString(sum[:16])
+
+	if data, err := c.store.Get(ctx, entry); err == nil && len(data) > 0 {
+		metrics.QueryCacheRequests.WithLabelValues("hit").Inc()
+		return data, nil
+	}
+
+	metrics.QueryCacheRequests.WithLabelValues("miss").Inc()
+	loaded := c.loads.DoChan(entry, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.LoadTimeout)
+		defer cancel()
+
+		data, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 && len(data) <= c.cfg.MaxBytes {
+			c.store.SetNX(ctx, entry, data, c.cfg.TTL)
+		}
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-loaded:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	}
+}
+
+// Invalidate drops a tenant's cached results, which then expire unread
+func (c *Cache) Invalidate(ctx context.Context, tenantID string) error {
+	_, err := c.store.Incr(ctx, generationKey(tenantID), 1)
+	return err
+}
+
+// generationKey is the StateStore key of a tenant's cache generation
+func generationKey(tenantID string) string {
+	return keyPrefix + "gen:" + tenantID
+}
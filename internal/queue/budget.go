@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"sync/atomic"
+
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Budget bounds the bytes of the envelopes buffered between ingest and
+// publishing: in the queue and in worker batches. The queue's capacity
+// bounds the envelope count, but not memory when events are large.
+// Envelopes are charged when queued and released once published or
+// dropped. A nil Budget is unbounded.
+type Budget struct {
+	max  int64
+	used atomic.Int64
+
+	// peak is the most bytes charged at once
+	peak atomic.Int64
+}
+
+// NewBudget creates a budget of max bytes; max <= 0 returns nil (unbounded)
+func NewBudget(max int64) *Budget {
+	if max <= 0 {
+		return nil
+	}
+	metrics.QueueMaxBytes.Set(float64(max))
+	return &Budget{max: max}
+}
+
+// Acquire charges the envelope's event size, recording it in
+// envelope.Bytes, and reports whether it fit. An envelope always fits an
+// empty budget, so an event larger than the whole budget still gets
+// through on its own.
+func (b *Budget) Acquire(envelope *models.Envelope) bool {
+	if b == nil {
+		return true
+	}
+	size := int64(envelope.Event.Size())
+	for {
+		used := b.used.Load()
+		if used > 0 && used+size > b.max {
+			metrics.QueueBytesExceeded.Inc()
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+size) {
+			envelope.Bytes = size
+			metrics.QueueBytes.Set(float64(used + size))
+			b.raisePeak(used + size)
+			return true
+		}
+	}
+}
+
+// reserve charges bytes for envelopes queued later, reporting whether they
+// fit like Acquire does
+func (b *Budget) reserve(size int64) bool {
+	if b == nil {
+		return true
+	}
+	for {
+		used := b.used.Load()
+		if used > 0 && used+size > b.max {
+			metrics.QueueBytesExceeded.Inc()
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+size) {
+			metrics.QueueBytes.Set(float64(used + size))
+			b.raisePeak(used + size)
+			return true
+		}
+	}
+}
+
+// add charges (or, when negative, releases) bytes not tied to an envelope
+func (b *Budget) add(size int64) {
+	if b == nil || size == 0 {
+		return
+	}
+	used := b.used.Add(size)
+	metrics.QueueBytes.Set(float64(used))
+	b.raisePeak(used)
+}
+
+// charge charges the envelope whether or not it fits, for eviction
+// policies that release another envelope in exchange
+func (b *Budget) charge(envelope *models.Envelope) {
+	if b == nil {
+		return
+	}
+	envelope.Bytes = int64(envelope.Event.Size())
+	used := b.used.Add(envelope.Bytes)
+	metrics.QueueBytes.Set(float64(used))
+	b.raisePeak(used)
+}
+
+// raisePeak records used bytes if they are the most seen
+func (b *Budget) raisePeak(used int64) {
+	for {
+		peak := b.peak.Load()
+		if used <= peak || b.peak.CompareAndSwap(peak, used) {
+			return
+		}
+	}
+}
+
+// Release returns the bytes charged for envelopes
+func (b *Budget) Release(envelopes ...*models.Envelope) {
+	if b == nil {
+		return
+	}
+	var size int64
+	for _, envelope := range envelopes {
+		size += envelope.Bytes
+		envelope.Bytes = 0
+	}
+	if size > 0 {
+		metrics.QueueBytes.Set(float64(b.used.Add(-size)))
+	}
+}
+
+// Used returns the bytes currently charged
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// Peak returns the most bytes charged at once since the budget was created
+func (b *Budget) Peak() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.peak.Load()
+}
+
+// Max returns the byte limit (0 = unbounded)
+func (b *Budget) Max() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.max
+}
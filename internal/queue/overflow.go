@@ -0,0 +1,312 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Policy decides what happens once the envelope queue has stayed full for
+// longer than the grace period
+type Policy string
+
+const (
+	// PolicyReject refuses the incoming envelope (drop-newest)
+	PolicyReject Policy = "reject"
+
+	// PolicyDropOldest evicts the oldest queued envelope to make room
+	PolicyDropOldest Policy = "drop_oldest"
+
+	// PolicyDropLowestSeverity evicts the least severe envelope, which may
+	// be the incoming one; among equals the oldest goes first
+	PolicyDropLowestSeverity Policy = "drop_lowest_severity"
+
+	// PolicySpill writes the incoming envelope to disk and replays it once
+	// the queue drains
+	PolicySpill Policy = "spill"
+)
+
+// ParsePolicy validates a policy name ("" = reject)
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return PolicyReject, nil
+	case PolicyReject, PolicyDropOldest, PolicyDropLowestSeverity, PolicySpill:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown queue overflow policy %q", name)
+	}
+}
+
+// Config holds overflow handling settings
+type Config struct {
+	Policy Policy
+
+	// Grace is how long the queue may stay full before the policy applies;
+	// until then incoming envelopes are rejected
+	Grace time.Duration
+
+	// Spill configures PolicySpill
+	Spill SpillConfig
+
+	// Budget bounds the bytes of queued envelopes; once exhausted the queue
+	// counts as full. nil bounds only the envelope count.
+	Budget *Budget
+}
+
+// Overflow enqueues envelopes, applying the policy when consumers fall
+// behind. Envelopes order is best effort while the policy is active.
+type Overflow struct {
+	ch     chan *models.Envelope
+	policy Policy
+	grace  time.Duration
+	spill  *Spill
+	budget *Budget
+
+	// fullSince is when the queue was first seen full (unix nanos, 0 = not full)
+	fullSince atomic.Int64
+
+	// slow is set once the queue has stayed full past the grace period
+	slow atomic.Bool
+
+	// limit caps the queue below its capacity (0 = no cap)
+	limit atomic.Int64
+
+	// peak is the longest the queue has been after an Offer
+	peak atomic.Int64
+
+	// reserved is the room claimed by reservations and not yet used
+	reserved atomic.Int64
+
+	// mu serializes evictions so concurrent producers don't drain twice
+	mu sync.Mutex
+}
+
+// New creates an overflow handler for the channel. PolicySpill opens the
+// spill file and replays any envelopes left from a previous run.
+func New(ch chan *models.Envelope, cfg Config) (*Overflow, error) {
+	policy, err := ParsePolicy(string(cfg.Policy))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Grace <= 0 {
+		cfg.Grace = time.Second
+	}
+
+	o := &Overflow{
+		ch:     ch,
+		policy: policy,
+		grace:  cfg.Grace,
+		budget: cfg.Budget,
+	}
+	if policy == PolicySpill {
+		cfg.Spill.Budget = cfg.Budget
+		o.spill, err = OpenSpill(ch, cfg.Spill)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// Policy returns the active policy
+func (o *Overflow) Policy() Policy { return o.policy }
+
+// Offer enqueues an envelope without blocking and reports whether it was
+// accepted (queued or spilled)
+func (o *Overflow) Offer(envelope *models.Envelope) bool {
+	if !o.overLimit() && o.budget.Acquire(envelope) {
+		select {
+		case o.ch <- envelope:
+			o.drained()
+			o.raisePeak()
+			return true
+		default:
+			o.budget.Release(envelope)
+		}
+	}
+
+	if !o.saturated() {
+		metrics.QueueOverflowDecisions.WithLabelValues(string(PolicyReject), "rejected").Inc()
+		return false
+	}
+
+	switch o.policy {
+	case PolicyDropOldest:
+		return o.dropOldest(envelope)
+	case PolicyDropLowestSeverity:
+		return o.dropLowestSeverity(envelope)
+	case PolicySpill:
+		if err := o.spill.Write(envelope); err != nil {
+			metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "spill_failed").Inc()
+			return false
+		}
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "spilled").Inc()
+		return true
+	default:
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "rejected").Inc()
+		return false
+	}
+}
+
+// SetLimit treats the queue as full once it holds n envelopes, so fewer
+// are buffered (e.g. under memory pressure); 0 restores the full capacity
+func (o *Overflow) SetLimit(n int) {
+	o.limit.Store(int64(n))
+}
+
+// Peak returns the most envelopes the queue has held, as seen by Offer
+func (o *Overflow) Peak() int {
+	return int(o.peak.Load())
+}
+
+// raisePeak records the queue length if it is the longest seen
+func (o *Overflow) raisePeak() {
+	n := int64(len(o.ch))
+	for {
+		peak := o.peak.Load()
+		if n <= peak || o.peak.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+// overLimit reports whether the queue has reached the limit set by SetLimit,
+// or its capacity, counting the room reserved for atomic batches
+func (o *Overflow) overLimit() bool {
+	n := int64(len(o.ch)) + o.reserved.Load()
+	limit := o.limit.Load()
+	return (limit > 0 && n >= limit) || n >= int64(cap(o.ch))
+}
+
+// saturated records that the queue is full and reports whether it has been
+// full for longer than the grace period (a slow consumer)
+func (o *Overflow) saturated() bool {
+	now := time.Now().UnixNano()
+	if o.fullSince.CompareAndSwap(0, now) {
+		return false
+	}
+	fullFor := time.Duration(now - o.fullSince.Load())
+	if fullFor < o.grace {
+		return false
+	}
+
+	if o.slow.CompareAndSwap(false, true) {
+		metrics.QueueSlowConsumer.Set(1)
+		log := logger.WithComponent("queue")
+		log.Warn().
+			Str("policy", string(o.policy)).
+			Dur("full_for", fullFor).
+			Int("capacity", cap(o.ch)).
+			Msg("slow consumer detected, applying overflow policy")
+	}
+	return true
+}
+
+// drained clears the full marker after a successful send
+func (o *Overflow) drained() {
+	if o.fullSince.Load() != 0 {
+		o.fullSince.Store(0)
+	}
+	if o.slow.CompareAndSwap(true, false) {
+		metrics.QueueSlowConsumer.Set(0)
+		log := logger.WithComponent("queue")
+		log.Info().Str("policy", string(o.policy)).Msg("queue drained, overflow policy inactive")
+	}
+}
+
+// dropOldest evicts the head of the queue and enqueues the envelope
+func (o *Overflow) dropOldest(envelope *models.Envelope) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	select {
+	case evicted := <-o.ch:
+		o.budget.Release(evicted)
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "evicted").Inc()
+	default:
+	}
+
+	// Charged in exchange for the evicted envelope, even if larger
+	o.budget.charge(envelope)
+	select {
+	case o.ch <- envelope:
+		return true
+	default:
+		o.budget.Release(envelope)
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "rejected").Inc()
+		return false
+	}
+}
+
+// dropLowestSeverity drains the queue, evicts the least severe envelope
+// (possibly the incoming one) and requeues the rest
+func (o *Overflow) dropLowestSeverity(envelope *models.Envelope) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	queued := make([]*models.Envelope, 0, cap(o.ch)+1)
+drain:
+	for {
+		select {
+		case e := <-o.ch:
+			queued = append(queued, e)
+		default:
+			break drain
+		}
+	}
+	// Charged in exchange for the victim, even if larger
+	o.budget.charge(envelope)
+	queued = append(queued, envelope)
+
+	lowest := 0
+	for i, e := range queued {
+		if e.Event.Severity.Rank() < queued[lowest].Event.Severity.Rank() {
+			lowest = i
+		}
+	}
+	victim := queued[lowest]
+	queued = append(queued[:lowest], queued[lowest+1:]...)
+	o.budget.Release(victim)
+
+	accepted := victim != envelope
+	for _, e := range queued {
+		select {
+		case o.ch <- e:
+		default:
+			// Other producers refilled the queue meanwhile
+			if e == envelope {
+				accepted = false
+			}
+			o.budget.Release(e)
+			metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "evicted").Inc()
+		}
+	}
+
+	if accepted {
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "evicted").Inc()
+	} else {
+		metrics.QueueOverflowDecisions.WithLabelValues(string(o.policy), "rejected").Inc()
+	}
+	return accepted
+}
+
+// Run replays spilled envelopes until Close is called (no-op for other policies)
+func (o *Overflow) Run() {
+	if o.spill != nil {
+		o.spill.Run()
+	}
+}
+
+// Close stops spill replay; it must be called before the channel is closed
+func (o *Overflow) Close() error {
+	if o.spill != nil {
+		return o.spill.Close()
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"sync"
+
+	"parsec/pkg/models"
+)
+
+// Reservation is room claimed in the queue, and in its byte budget, for a
+// batch that must be queued whole or not at all (atomic ingest)
+type Reservation struct {
+	o *Overflow
+
+	mu    sync.Mutex
+	slots int64
+	bytes int64
+}
+
+// Reserve claims room for n envelopes of bytes in total, reporting nil if
+// they don't all fit now. The overflow policy doesn't apply: nothing is
+// evicted or spilled to make room. Envelopes are then queued with Put,
+// and Release hands back what wasn't used.
+func (o *Overflow) Reserve(n int, bytes int64) *Reservation {
+	capacity := int64(cap(o.ch))
+	if limit := o.limit.Load(); limit > 0 {
+		capacity = min(capacity, limit)
+	}
+	// Claimed first and checked after, so concurrent reservations can't
+	// both see the same free room
+	reserved := o.reserved.Add(int64(n))
+	if int64(len(o.ch))+reserved > capacity {
+		o.reserved.Add(-int64(n))
+		return nil
+	}
+	if !o.budget.reserve(bytes) {
+		o.reserved.Add(-int64(n))
+		return nil
+	}
+	return &Reservation{o: o, slots: int64(n), bytes: bytes}
+}
+
+// Put queues an envelope in reserved room, charging its bytes to the
+// reservation. It reports false once every slot is used. Should another
+// producer have taken the slot meanwhile, Put waits for the workers to
+// free one rather than break up the batch.
+func (r *Reservation) Put(envelope *models.Envelope) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.slots == 0 {
+		return false
+	}
+
+	size := int64(envelope.Event.Size())
+	if b := r.o.budget; b != nil {
+		// Charged from the reserved bytes; an envelope larger than them
+		// (e.g. a reassembled multi-line event) is charged the rest
+		envelope.Bytes = size
+		if size <= r.bytes {
+			r.bytes -= size
+		} else {
+			b.add(size - r.bytes)
+			r.bytes = 0
+		}
+	}
+	select {
+	case r.o.ch <- envelope:
+	default:
+		r.o.ch <- envelope
+	}
+	r.slots--
+	r.o.reserved.Add(-1)
+	r.o.drained()
+	r.o.raisePeak()
+	return true
+}
+
+// Release hands back the room not used by Put. It is safe to call more
+// than once.
+func (r *Reservation) Release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.o.reserved.Add(-r.slots)
+	r.o.budget.add(-r.bytes)
+	r.slots, r.bytes = 0, 0
+}
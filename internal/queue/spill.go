@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// SpillFile is the file name used inside the spill directory
+const SpillFile = "envelopes.jsonl"
+
+// ErrSpillFull is returned when the spill file has reached its size cap
+var ErrSpillFull = errors.New("spill file full")
+
+// SpillConfig holds spill-to-disk settings
+type SpillConfig struct {
+	// Dir holds the spill file
+	Dir string
+
+	// MaxBytes caps the spill file size (0 = 256MB)
+	MaxBytes int64
+
+	// ReplayInterval is how often the queue is checked for room (0 = 100ms)
+	ReplayInterval time.Duration
+
+	// Budget is charged for replayed envelopes, and replay pauses while it
+	// is exhausted; nil leaves them uncharged
+	Budget *Budget
+}
+
+// Spill appends envelopes to a JSON-lines file and feeds them back into the
+// queue once it is at most half full. The file is truncated when fully
+// replayed, and leftovers from a previous run are replayed on start.
+type Spill struct {
+	ch       chan *models.Envelope
+	cfg      SpillConfig
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	offset   int64
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	started  atomic.Bool
+}
+
+// OpenSpill opens (or creates) the spill file
+func OpenSpill(ch chan *models.Envelope, cfg SpillConfig) (*Spill, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("spill policy requires a spill directory")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 256 << 20
+	}
+	if cfg.ReplayInterval <= 0 {
+		cfg.ReplayInterval = 100 * time.Millisecond
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spill dir: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(cfg.Dir, SpillFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open spill file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat spill file: %w", err)
+	}
+
+	return &Spill{
+		ch:   ch,
+		cfg:  cfg,
+		file: file,
+		size: info.Size(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Write appends an envelope to the spill file
+func (s *Spill) Write(envelope *models.Envelope) error {
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(line)) > s.cfg.MaxBytes {
+		return ErrSpillFull
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Pending returns the number of spilled bytes not yet replayed
+func (s *Spill) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size - s.offset
+}
+
+// Run replays spilled envelopes until Close is called
+func (s *Spill) Run() {
+	if !s.started.CompareAndSwap(false, true) {
+		return
+	}
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if len(s.ch) > cap(s.ch)/2 {
+				continue
+			}
+			if err := s.Replay(); err != nil {
+				log := logger.WithComponent("queue")
+				log.Error().Err(err).Msg("failed to replay spilled envelopes")
+			}
+		}
+	}
+}
+
+// Replay moves spilled envelopes into the queue until it is full or the
+// file is drained, then truncates a drained file
+func (s *Spill) Replay() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offset >= s.size {
+		return nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.offset, s.size-s.offset))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var envelope models.Envelope
+		if err := json.Unmarshal(line, &envelope); err != nil || envelope.Event == nil {
+			// Skip corrupt lines rather than wedging replay
+			s.offset += int64(len(line))
+			metrics.QueueOverflowDecisions.WithLabelValues(string(PolicySpill), "spill_failed").Inc()
+			continue
+		}
+
+		if !s.cfg.Budget.Acquire(&envelope) {
+			return nil
+		}
+		select {
+		case s.ch <- &envelope:
+			s.offset += int64(len(line))
+			metrics.QueueOverflowDecisions.WithLabelValues(string(PolicySpill), "replayed").Inc()
+		default:
+			s.cfg.Budget.Release(&envelope)
+			return nil
+		}
+	}
+
+	if s.offset < s.size {
+		// Trailing partial line from an interrupted write
+		s.offset = s.size
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	s.size, s.offset = 0, 0
+	return nil
+}
+
+// Close stops replay and closes the file. Unreplayed envelopes stay on disk
+// and are replayed on the next start.
+func (s *Spill) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	if !s.started.CompareAndSwap(false, true) {
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offset > 0 && s.offset < s.size {
+		if err := s.compact(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	return s.file.Close()
+}
+
+// compact rewrites the file without the already replayed prefix
+func (s *Spill) compact() error {
+	rest := make([]byte, s.size-s.offset)
+	if _, err := s.file.ReadAt(rest, s.offset); err != nil && err != io.EOF {
+		return err
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.Write(rest); err != nil {
+		return err
+	}
+	s.size, s.offset = int64(len(rest)), 0
+	return nil
+}
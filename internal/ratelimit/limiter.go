@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"parsec/internal/state"
+)
+
+// keyPrefix namespaces rate limit counters in the StateStore
+const keyPrefix = "parsec:ratelimit:"
+
+// Config holds rate limit settings
+type Config struct {
+	// Limit is the number of requests allowed per window (0 disables limiting)
+	Limit int
+
+	// Window is the fixed window length
+	Window time.Duration
+}
+
+// Quota is a caller's state in the current window
+type Quota struct {
+	Caller    string    `json:"caller"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Window    string    `json:"window"`
+}
+
+// Limiter enforces a fixed-window request quota per caller. Counters live in
+// the StateStore so limits are shared by nodes using the same store.
+type Limiter struct {
+	store  state.StateStore
+	limit  int
+	window time.Duration
+}
+
+// NewLimiter creates a limiter, or returns nil if cfg.Limit is not positive
+func NewLimiter(store state.StateStore, cfg Config) *Limiter {
+	if cfg.Limit <= 0 {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	return &Limiter{
+		store:  store,
+		limit:  cfg.Limit,
+		window: cfg.Window,
+	}
+}
+
+// Allow counts a request and reports whether it is within the quota
+func (l *Limiter) Allow(ctx context.Context, caller string) (Quota, bool, error) {
+	start, reset := l.bounds()
+	key := l.key(caller, start)
+
+	count, err := l.store.Incr(ctx, key, 1)
+	if err != nil {
+		return l.quota(caller, 0, reset), true, err
+	}
+	if count == 1 {
+		// Keep the counter slightly past the window to tolerate clock skew
+		if _, err := l.store.Expire(ctx, key, 2*l.window); err != nil {
+			return l.quota(caller, count, reset), true, err
+		}
+	}
+	return l.quota(caller, count, reset), count <= int64(l.limit), nil
+}
+
+// Peek returns the caller's quota without counting a request
+func (l *Limiter) Peek(ctx context.Context, caller string) (Quota, error) {
+	start, reset := l.bounds()
+
+	data, err := l.store.Get(ctx, l.key(caller, start))
+	if err != nil || len(data) == 0 {
+		return l.quota(caller, 0, reset), err
+	}
+	count, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return l.quota(caller, 0, reset), fmt.Errorf("parse rate limit counter: %w", err)
+	}
+	return l.quota(caller, count, reset), nil
+}
+
+// bounds returns the start and end of the current window
+func (l *Limiter) bounds() (time.Time, time.Time) {
+	start := time.Now().Truncate(l.window)
+	return start, start.Add(l.window)
+}
+
+func (l *Limiter) key(caller string, start time.Time) string {
+	return keyPrefix + caller + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+func (l *Limiter) quota(caller string, count int64, reset time.Time) Quota {
+	remaining := l.limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Quota{
+		Caller:    caller,
+		Limit:     l.limit,
+		Remaining: remaining,
+		Reset:     reset,
+		Window:    l.window.String(),
+	}
+}
+
+// CallerID identifies the caller of a request by a hash of its API key or
+// bearer token, so credentials never appear in the store or responses
+func CallerID(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && key == "" {
+		key = token
+	}
+	if key == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:8])
+}
+
+// SetHeaders writes the X-RateLimit-* headers. Reset is a Unix timestamp.
+func SetHeaders(w http.ResponseWriter, q Quota) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(q.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(q.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(q.Reset.Unix(), 10))
+}
@@ -0,0 +1,100 @@
+// Package rates turns monotonic counters into per-second rates averaged
+// over the last 1, 5 and 15 minutes, the way load averages are: each
+// counter is sampled at a fixed interval and folded into exponentially
+// weighted moving averages.
+package rates
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Interval is how often meters are meant to be ticked
+const Interval = 5 * time.Second
+
+// Windows the averages cover, named as they are reported
+var Windows = []string{"1m", "5m", "15m"}
+
+// Rates are per-second rates averaged over each window
+type Rates struct {
+	M1  float64 `json:"1m"`
+	M5  float64 `json:"5m"`
+	M15 float64 `json:"15m"`
+}
+
+// Values returns the rates in the order of Windows
+func (r Rates) Values() []float64 {
+	return []float64{r.M1, r.M5, r.M15}
+}
+
+// ewma is an exponentially weighted moving average of a per-second rate
+type ewma struct {
+	alpha float64
+	rate  float64
+}
+
+// newEWMA creates an average over window for samples taken every interval
+func newEWMA(window, interval time.Duration) ewma {
+	return ewma{alpha: 1 - math.Exp(-interval.Seconds()/window.Seconds())}
+}
+
+// Meter averages the rate at which a counter grows
+type Meter struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	last  uint64
+	ticks int
+	m1    ewma
+	m5    ewma
+	m15   ewma
+}
+
+// NewMeter creates a meter ticked every interval (0 = Interval)
+func NewMeter(interval time.Duration) *Meter {
+	if interval <= 0 {
+		interval = Interval
+	}
+	return &Meter{
+		interval: interval,
+		m1:       newEWMA(time.Minute, interval),
+		m5:       newEWMA(5*time.Minute, interval),
+		m15:      newEWMA(15*time.Minute, interval),
+	}
+}
+
+// Tick samples the counter's current total. The first tick only sets the
+// baseline; the second seeds every average with the rate it sees, so a
+// freshly started node doesn't report rates ramping up from zero.
+func (m *Meter) Tick(total uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A counter that went backwards was reset; count from its new total
+	var delta uint64
+	if total >= m.last {
+		delta = total - m.last
+	}
+	m.last = total
+	m.ticks++
+	if m.ticks == 1 {
+		return
+	}
+
+	rate := float64(delta) / m.interval.Seconds()
+	for _, e := range []*ewma{&m.m1, &m.m5, &m.m15} {
+		if m.ticks == 2 {
+			e.rate = rate
+		} else {
+			e.rate += e.alpha * (rate - e.rate)
+		}
+	}
+}
+
+// Rates returns the current averages
+func (m *Meter) Rates() Rates {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Rates{M1: m.m1.rate, M5: m.m5.rate, M15: m.m15.rate}
+}
@@ -0,0 +1,56 @@
+package rbac
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// contextKey keys the principal in request contexts
+type contextKey struct{}
+
+// NewContext returns ctx carrying the request's principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of a request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Permits reports whether the principal in ctx has perm on tenantID's
+// resources. Work without a principal, such as events from built-in inputs,
+// is permitted.
+func Permits(ctx context.Context, perm Permission, tenantID string) bool {
+	p, ok := FromContext(ctx)
+	return !ok || p.Can(perm, tenantID)
+}
+
+// Denial counts a refusal and starts its audit log entry, which callers
+// complete with request details and send. p is nil for unauthenticated
+// requests.
+func Denial(p *Principal, perm Permission, tenantID string) *zerolog.Event {
+	reason := "forbidden"
+	if p == nil {
+		reason = "unauthenticated"
+	}
+	metrics.AuthzDenials.WithLabelValues(string(perm), reason).Inc()
+
+	log := logger.WithComponent("rbac")
+	event := log.Warn().
+		Bool("audit", true).
+		Str("permission", string(perm)).
+		Str("reason", reason)
+	if tenantID != "" {
+		event = event.Str("tenant_id", tenantID)
+	}
+	if p != nil {
+		event = event.Str("principal", p.Name).Str("role", string(p.Role))
+	}
+	return event
+}
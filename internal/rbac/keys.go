@@ -0,0 +1,352 @@
+package rbac
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// KeysStoreKey is the StateStore key holding rotated keys
+const KeysStoreKey = "parsec:keys"
+
+// recordRetention is how long records of expired rotated keys are kept, so
+// their callers are told the key expired rather than that it is unknown
+const recordRetention = 24 * time.Hour
+
+// expiryLogInterval bounds how often the use of one expiring key is logged
+const expiryLogInterval = time.Hour
+
+// ErrUnknownKey is returned when rotating an ID no unexpired key has
+var ErrUnknownKey = errors.New("no unexpired API key with this ID")
+
+// keyRecord is a key issued by a rotation, or the expiry set on a key it
+// replaced. Only the key's hash is kept.
+type keyRecord struct {
+	Hash      string    `json:"hash"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Tenants   []string  `json:"tenants,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// KeyInfo describes an API key without its secret
+type KeyInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      Role       `json:"role"`
+	Tenants   []string   `json:"tenants,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+
+	// Expiring is set within the expiry warning window
+	Expiring bool `json:"expiring,omitempty"`
+
+	// Rotated is set for keys issued by a rotation rather than configured
+	Rotated bool `json:"rotated,omitempty"`
+}
+
+// Rotation is the outcome of rotating a key. Key is only ever shown here.
+type Rotation struct {
+	ID        string     `json:"id"`
+	Key       string     `json:"key"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// PreviousExpireAt is when the keys replaced stop working
+	PreviousExpireAt time.Time `json:"previous_expire_at"`
+}
+
+// rebuild replaces the key table with the configured keys and records,
+// and publishes each ID's expiry. A record of a configured key can only
+// bring its expiry forward.
+func (a *Authenticator) rebuild(records []keyRecord) {
+	keys := a.table(records)
+
+	// An ID stays usable until its last key expires
+	now := time.Now()
+	last := make(map[string]time.Time)
+	for _, p := range keys {
+		if p.KeyID == "" || (!p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt)) {
+			continue
+		}
+		if at, seen := last[p.KeyID]; !seen || (!at.IsZero() && (p.ExpiresAt.IsZero() || p.ExpiresAt.After(at))) {
+			last[p.KeyID] = p.ExpiresAt
+		}
+	}
+	metrics.AuthKeyExpiry.Reset()
+	for id, at := range last {
+		if !at.IsZero() {
+			metrics.AuthKeyExpiry.WithLabelValues(id).Set(float64(at.Unix()))
+		}
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.records = records
+	a.mu.Unlock()
+}
+
+// table returns the key table of the configured keys and records
+func (a *Authenticator) table(records []keyRecord) map[[sha256.Size]byte]*Principal {
+	keys := make(map[[sha256.Size]byte]*Principal, len(a.configured)+len(records))
+	for sum, k := range a.configured {
+		keys[sum] = &Principal{Name: k.Name, Role: k.Role, Tenants: k.Tenants, KeyID: k.id(), ExpiresAt: k.ExpiresAt}
+	}
+	for _, rec := range records {
+		sum, ok := decodeHash(rec.Hash)
+		if !ok {
+			continue
+		}
+		if p, ok := keys[sum]; ok {
+			if !rec.ExpiresAt.IsZero() && (p.ExpiresAt.IsZero() || rec.ExpiresAt.Before(p.ExpiresAt)) {
+				p.ExpiresAt = rec.ExpiresAt
+			}
+			continue
+		}
+		keys[sum] = &Principal{Name: rec.Name, Role: rec.Role, Tenants: rec.Tenants, KeyID: rec.ID, ExpiresAt: rec.ExpiresAt}
+	}
+	return keys
+}
+
+// decodeHash parses a hex SHA-256 hash
+func decodeHash(s string) ([sha256.Size]byte, bool) {
+	var sum [sha256.Size]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return sum, false
+	}
+	copy(sum[:], b)
+	return sum, true
+}
+
+// expiring counts a request made with a key inside its warning window, and
+// logs it at most once an hour per key ID
+func (a *Authenticator) expiring(p *Principal, now time.Time) {
+	metrics.AuthExpiringKeyRequests.WithLabelValues(p.KeyID).Inc()
+
+	a.warnMu.Lock()
+	last, logged := a.warned[p.KeyID]
+	if logged && now.Sub(last) < expiryLogInterval {
+		a.warnMu.Unlock()
+		return
+	}
+	a.warned[p.KeyID] = now
+	a.warnMu.Unlock()
+
+	log := logger.WithComponent("rbac")
+	log.Warn().
+		Str("key_id", p.KeyID).
+		Str("principal", p.Name).
+		Time("expires_at", p.ExpiresAt).
+		Msg("API key expires soon; rotate it and move callers to the new key")
+}
+
+// Load replaces the rotated keys with those in the store
+func (a *Authenticator) Load(ctx context.Context) error {
+	if a.store == nil {
+		return nil
+	}
+	data, err := state.NewVersioned(a.store, KeysStoreKey).Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the keys rotated here, as a store that
+		// keeps nothing would drop them
+		return err
+	}
+	records, err := parseRecords(data)
+	if err != nil {
+		return err
+	}
+	a.rebuild(records)
+	return nil
+}
+
+// parseRecords parses the stored rotated keys
+func parseRecords(data []byte) ([]keyRecord, error) {
+	var records []keyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid rotated keys in store: %w", err)
+	}
+	return records, nil
+}
+
+// Run reloads rotated keys periodically until the context is cancelled, so
+// rotations on other nodes take effect here
+func (a *Authenticator) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log := logger.WithComponent("rbac")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload rotated API keys")
+			}
+		}
+	}
+}
+
+// Rotate issues a new key with the role and tenants of the key with the
+// given ID, and makes the ID's current keys expire after overlap, or at
+// their own expiry if sooner. The new key expires after lifetime (0 =
+// never).
+func (a *Authenticator) Rotate(ctx context.Context, id string, overlap, lifetime time.Duration) (*Rotation, error) {
+	a.rotating.Lock()
+	defer a.rotating.Unlock()
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := base64.RawURLEncoding.EncodeToString(secret)
+
+	var (
+		rotated  []keyRecord
+		issued   keyRecord
+		retireAt time.Time
+	)
+	change := func(current []keyRecord) error {
+		now := time.Now()
+		retireAt = now.Add(overlap)
+		rotated, issued = nil, keyRecord{}
+
+		var template *Principal
+		retire := make(map[[sha256.Size]byte]*Principal)
+		for sum, p := range a.table(current) {
+			if id == "" || p.KeyID != id || (!p.ExpiresAt.IsZero() && !now.Before(p.ExpiresAt)) {
+				continue
+			}
+			if template == nil || (!template.ExpiresAt.IsZero() && (p.ExpiresAt.IsZero() || p.ExpiresAt.After(template.ExpiresAt))) {
+				template = p
+			}
+			if p.ExpiresAt.IsZero() || p.ExpiresAt.After(retireAt) {
+				retire[sum] = p
+			}
+		}
+		if template == nil {
+			return ErrUnknownKey
+		}
+
+		rotated = make([]keyRecord, 0, len(current)+len(retire)+1)
+		for _, rec := range current {
+			sum, ok := decodeHash(rec.Hash)
+			if !ok || retire[sum] != nil {
+				continue
+			}
+			_, configured := a.configured[sum]
+			if !configured && !rec.ExpiresAt.IsZero() && now.Sub(rec.ExpiresAt) > recordRetention {
+				continue
+			}
+			rotated = append(rotated, rec)
+		}
+		for sum, p := range retire {
+			rotated = append(rotated, keyRecord{
+				Hash:      hex.EncodeToString(sum[:]),
+				ID:        p.KeyID,
+				Name:      p.Name,
+				Role:      p.Role,
+				Tenants:   p.Tenants,
+				ExpiresAt: retireAt,
+			})
+		}
+
+		sum := sha256.Sum256([]byte(key))
+		issued = keyRecord{
+			Hash:    hex.EncodeToString(sum[:]),
+			ID:      id,
+			Name:    template.Name,
+			Role:    template.Role,
+			Tenants: template.Tenants,
+		}
+		if lifetime > 0 {
+			issued.ExpiresAt = now.Add(lifetime)
+		}
+		rotated = append(rotated, issued)
+		return nil
+	}
+
+	a.mu.RLock()
+	local := a.records
+	a.mu.RUnlock()
+
+	if a.store == nil {
+		if err := change(local); err != nil {
+			return nil, err
+		}
+	} else {
+		// Applied to the latest stored records, again if another node
+		// rotates meanwhile, so no rotation is lost
+		err := state.NewVersioned(a.store, KeysStoreKey).Update(ctx, func(data []byte) ([]byte, error) {
+			current := local
+			if len(data) > 0 {
+				var err error
+				if current, err = parseRecords(data); err != nil {
+					return nil, err
+				}
+			}
+			if err := change(current); err != nil {
+				return nil, err
+			}
+			return json.Marshal(rotated)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.rebuild(rotated)
+
+	rotation := &Rotation{ID: id, Key: key, PreviousExpireAt: retireAt}
+	if lifetime > 0 {
+		rotation.ExpiresAt = &issued.ExpiresAt
+	}
+	return rotation, nil
+}
+
+// Keys describes every API key, sorted by ID and expiry
+func (a *Authenticator) Keys() []KeyInfo {
+	now := time.Now()
+
+	a.mu.RLock()
+	out := make([]KeyInfo, 0, len(a.keys))
+	for sum, p := range a.keys {
+		_, configured := a.configured[sum]
+		info := KeyInfo{ID: p.KeyID, Name: p.Name, Role: p.Role, Tenants: p.Tenants, Rotated: !configured}
+		if !p.ExpiresAt.IsZero() {
+			expiresAt := p.ExpiresAt
+			info.ExpiresAt = &expiresAt
+			info.Expired = !now.Before(expiresAt)
+			info.Expiring = !info.Expired && a.warning > 0 && expiresAt.Sub(now) <= a.warning
+		}
+		out = append(out, info)
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ID != out[j].ID {
+			return out[i].ID < out[j].ID
+		}
+		// Keys that never expire last
+		if out[i].ExpiresAt == nil || out[j].ExpiresAt == nil {
+			return out[j].ExpiresAt == nil && out[i].ExpiresAt != nil
+		}
+		return out[i].ExpiresAt.Before(*out[j].ExpiresAt)
+	})
+	return out
+}
@@ -0,0 +1,285 @@
+// Package rbac authenticates API callers and decides what they may do.
+// Callers present an API key (X-API-Key) or an HS256 JWT (Authorization:
+// Bearer), either of which carries a role and optionally the tenants it is
+// limited to:
+//
+//	ingest        send events
+//	read-only     read admin state and query events
+//	tenant-admin  send events, read, and manage its tenants' settings
+//	operator      everything, for every tenant
+//
+// A role limited to tenants can only act on resources of those tenants;
+// node-wide resources (feature flags, the pipeline, jobs) need an unlimited
+// role.
+//
+// API keys may expire, and are rotated with an overlap window in which the
+// old and the new key both work; see Rotate.
+package rbac
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/state"
+)
+
+// Role is a named set of permissions
+type Role string
+
+const (
+	RoleIngest      Role = "ingest"
+	RoleReadOnly    Role = "read-only"
+	RoleTenantAdmin Role = "tenant-admin"
+	RoleOperator    Role = "operator"
+)
+
+// Permission is something a request needs to be allowed
+type Permission string
+
+const (
+	// PermIngest sends events
+	PermIngest Permission = "ingest"
+
+	// PermRead reads admin state and stored events
+	PermRead Permission = "read"
+
+	// PermManage changes settings and starts jobs
+	PermManage Permission = "manage"
+)
+
+// permissions are what each role may do
+var permissions = map[Role][]Permission{
+	RoleIngest:      {PermIngest},
+	RoleReadOnly:    {PermRead},
+	RoleTenantAdmin: {PermIngest, PermRead, PermManage},
+	RoleOperator:    {PermIngest, PermRead, PermManage},
+}
+
+// DefaultAPIKey is accepted as an operator key when no credentials are
+// configured, so development setups work out of the box
+const DefaultAPIKey = "test-api-key-123"
+
+var (
+	// ErrNoCredentials is returned for requests without an API key or token
+	ErrNoCredentials = errors.New("missing X-API-Key header or bearer token")
+
+	// ErrInvalidCredentials is returned for unknown keys and invalid tokens
+	ErrInvalidCredentials = errors.New("invalid API key or token")
+
+	// ErrExpiredCredentials is returned for keys past their expiry
+	ErrExpiredCredentials = errors.New("API key has expired")
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Name identifies the caller in audit logs: the key's name or the
+	// token's subject
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+
+	// Tenants limits the caller to these tenants (empty = all)
+	Tenants []string `json:"tenants,omitempty"`
+
+	// KeyID is the ID of the API key the caller presented, empty for tokens
+	KeyID string `json:"key_id,omitempty"`
+
+	// ExpiresAt is when the caller's key stops working (zero = never)
+	ExpiresAt time.Time `json:"-"`
+}
+
+// Has reports whether the principal's role grants perm, for some tenants
+// at least
+func (p *Principal) Has(perm Permission) bool {
+	return slices.Contains(permissions[p.Role], perm)
+}
+
+// Can reports whether the principal has perm on tenantID's resources, or
+// on node-wide resources when tenantID is empty
+func (p *Principal) Can(perm Permission, tenantID string) bool {
+	if !p.Has(perm) {
+		return false
+	}
+	if len(p.Tenants) == 0 {
+		return true
+	}
+	return tenantID != "" && slices.Contains(p.Tenants, tenantID)
+}
+
+// Covers reports whether the principal's scope includes that of a key with
+// role and tenants: every permission of the role, on every tenant of the key
+func (p *Principal) Covers(role Role, tenants []string) bool {
+	for _, perm := range permissions[role] {
+		if !p.Has(perm) {
+			return false
+		}
+	}
+	if len(p.Tenants) == 0 {
+		return true
+	}
+	if len(tenants) == 0 {
+		return false
+	}
+	for _, t := range tenants {
+		if !slices.Contains(p.Tenants, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Key is an API key with the role it grants
+type Key struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+
+	// ID names the key for rotation, defaulting to Name. Several keys may
+	// share an ID while callers move from one to another.
+	ID      string   `json:"id,omitempty"`
+	Role    Role     `json:"role"`
+	Tenants []string `json:"tenants,omitempty"`
+
+	// ExpiresAt is when the key stops working (zero = never)
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// id returns the key's ID
+func (k Key) id() string {
+	if k.ID != "" {
+		return k.ID
+	}
+	return k.Name
+}
+
+// ParseKeys parses a JSON array of keys
+func ParseKeys(data []byte) ([]Key, error) {
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Config holds the credentials an Authenticator accepts
+type Config struct {
+	// Keys are API keys with their roles
+	Keys []Key
+
+	// APIKey is a single operator key, as set by API_KEY before roles
+	// existed
+	APIKey string
+
+	// JWTSecret verifies HS256 bearer tokens; tokens are refused without it
+	JWTSecret []byte
+
+	// Store keeps rotated keys, shared with other nodes; nil keeps them in
+	// memory
+	Store state.StateStore
+
+	// ExpiryWarning is how long before its expiry a key's use is counted
+	// and logged, so callers can be moved off it (0 = never)
+	ExpiryWarning time.Duration
+}
+
+// Authenticator identifies callers from their credentials
+type Authenticator struct {
+	configured map[[sha256.Size]byte]Key
+	secret     []byte
+	store      state.StateStore
+	warning    time.Duration
+
+	// rotating serializes rotations, which read and write the store
+	rotating sync.Mutex
+
+	mu      sync.RWMutex
+	keys    map[[sha256.Size]byte]*Principal
+	records []keyRecord
+
+	warnMu sync.Mutex
+	warned map[string]time.Time
+}
+
+// NewAuthenticator creates an authenticator. With no credentials configured
+// at all it accepts DefaultAPIKey as an operator key.
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{
+		configured: make(map[[sha256.Size]byte]Key),
+		secret:     cfg.JWTSecret,
+		store:      cfg.Store,
+		warning:    cfg.ExpiryWarning,
+		warned:     make(map[string]time.Time),
+	}
+
+	keys := cfg.Keys
+	if cfg.APIKey != "" {
+		keys = append(keys, Key{Key: cfg.APIKey, Name: "api-key", Role: RoleOperator})
+	}
+	if len(keys) == 0 && len(cfg.JWTSecret) == 0 {
+		keys = append(keys, Key{Key: DefaultAPIKey, Name: "api-key", Role: RoleOperator})
+	}
+
+	for _, k := range keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("API key %q: key is empty", k.Name)
+		}
+		if err := validRole(k.Role, k.Tenants); err != nil {
+			return nil, fmt.Errorf("API key %q: %w", k.Name, err)
+		}
+		sum := sha256.Sum256([]byte(k.Key))
+		if _, dup := a.configured[sum]; dup {
+			return nil, fmt.Errorf("API key %q: key is used twice", k.Name)
+		}
+		k.Key = ""
+		a.configured[sum] = k
+	}
+	a.rebuild(nil)
+	return a, nil
+}
+
+// validRole checks a role exists and, for tenant admins, names tenants
+func validRole(role Role, tenants []string) error {
+	if _, ok := permissions[role]; !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if role == RoleTenantAdmin && len(tenants) == 0 {
+		return errors.New("tenant-admin needs tenants")
+	}
+	return nil
+}
+
+// Authenticate identifies the caller of a request
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		// Keys are looked up by hash, so lookups don't leak key prefixes
+		a.mu.RLock()
+		principal, ok := a.keys[sha256.Sum256([]byte(key))]
+		a.mu.RUnlock()
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		if !principal.ExpiresAt.IsZero() {
+			now := time.Now()
+			if !now.Before(principal.ExpiresAt) {
+				return nil, ErrExpiredCredentials
+			}
+			if a.warning > 0 && principal.ExpiresAt.Sub(now) <= a.warning {
+				a.expiring(principal, now)
+			}
+		}
+		return principal, nil
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if len(a.secret) == 0 {
+			return nil, ErrInvalidCredentials
+		}
+		return a.verifyToken(token, time.Now())
+	}
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,167 @@
+// Package receipts keeps signed receipts of ingest batches. A receipt
+// records what became of every event in a batch, under the server's batch
+// ID and the client's own reference, so agents can reconcile what was
+// actually accepted long after the response was lost or discarded. Batches
+// ingested asynchronously have a pending receipt until they are processed.
+package receipts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"parsec/internal/state"
+)
+
+// keyPrefix prefixes receipts in the StateStore, by batch ID
+const keyPrefix = "parsec:receipts:"
+
+// MaxRefLength bounds a client batch reference
+const MaxRefLength = 256
+
+// ErrNotFound is returned for a batch without a receipt (never received,
+// or expired)
+var ErrNotFound = errors.New("batch receipt not found")
+
+// Batch statuses
+const (
+	BatchPending   = "pending"
+	BatchCompleted = "completed"
+	BatchFailed    = "failed"
+)
+
+// Event dispositions
+const (
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+	StatusDropped  = "dropped"
+)
+
+// Disposition is what became of one event of a batch
+type Disposition struct {
+	Index   int    `json:"index"`
+	EventID string `json:"event_id,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Receipt records the outcome of an ingest batch
+type Receipt struct {
+	BatchID string `json:"batch_id"`
+
+	// BatchRef is the client's reference for the batch, if it sent one
+	BatchRef string `json:"batch_ref,omitempty"`
+
+	// Tenants are the tenants of the batch's events its sender may ingest
+	// for, or the sender's own while it is pending; only keys covering them
+	// all can read the receipt
+	Tenants []string `json:"tenants,omitempty"`
+
+	Node       string    `json:"node"`
+	ReceivedAt time.Time `json:"received_at"`
+
+	// Status is pending until an async batch is processed; Error says why
+	// a batch failed as a whole
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Dropped  int           `json:"dropped"`
+	Events   []Disposition `json:"events"`
+
+	// Signature is the hex HMAC-SHA256 of the receipt's JSON encoding
+	// without it
+	Signature string `json:"signature,omitempty"`
+}
+
+// Store signs receipts and keeps them in the shared state store, so any
+// node can answer for a batch
+type Store struct {
+	store state.StateStore
+	key   []byte
+	ttl   time.Duration
+}
+
+// NewStore creates a receipt store keeping receipts for ttl (0 = 7 days),
+// signed with key (empty = unsigned)
+func NewStore(store state.StateStore, key []byte, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	return &Store{store: store, key: key, ttl: ttl}
+}
+
+// Sign sets the receipt's signature
+func (s *Store) Sign(r *Receipt) error {
+	if len(s.key) == 0 {
+		return nil
+	}
+	sig, err := sign(s.key, *r)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// Verify reports whether r was signed with key
+func Verify(key []byte, r Receipt) bool {
+	want, err := sign(key, r)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(want), []byte(r.Signature))
+}
+
+// sign returns the signature of r's encoding without its signature
+func sign(key []byte, r Receipt) (string, error) {
+	r.Signature = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Save signs and keeps a receipt until the TTL passes, replacing any
+// earlier receipt of the batch
+func (s *Store) Save(ctx context.Context, r *Receipt) error {
+	if err := s.Sign(r); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := keyPrefix + r.BatchID
+	if err := s.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = s.store.Expire(ctx, key, s.ttl)
+	return err
+}
+
+// Get returns the receipt of a batch
+func (s *Store) Get(ctx context.Context, batchID string) (*Receipt, error) {
+	data, err := s.store.Get(ctx, keyPrefix+batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var r Receipt
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
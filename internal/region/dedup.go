@@ -0,0 +1,123 @@
+package region
+
+import (
+	"context"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+const (
+	// dedupKeyPrefix prefixes event IDs in the state store
+	dedupKeyPrefix = "parsec:dedup:"
+
+	// leaseTTL bounds how long a consumer may hold an event it is
+	// handling; a consumer that dies mid-way releases it by expiry
+	leaseTTL = 30 * time.Second
+
+	// leasePoll is how often a copy waiting on another consumer's lease
+	// checks again
+	leasePoll = 50 * time.Millisecond
+)
+
+// Lease states stored under an event's key
+const (
+	statePending = "pending"
+	stateDone    = "done"
+)
+
+// Deduplicator drops envelopes that were already handled. In an
+// active-active setup one event can be consumed twice in a region: from
+// the local topic and mirrored from the remote one, or after a client
+// retried against both regions.
+//
+// A copy first takes a lease on the event ID with SetNX, so concurrent
+// consumers never both handle it. Another copy arriving meanwhile waits for
+// the lease to resolve: it is dropped once the holder succeeds, and takes
+// over if the holder fails or dies, so a failure never loses the event.
+type Deduplicator struct {
+	store state.StateStore
+	ttl   time.Duration
+}
+
+// NewDeduplicator remembers handled event IDs for ttl
+func NewDeduplicator(store state.StateStore, ttl time.Duration) *Deduplicator {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Deduplicator{store: store, ttl: ttl}
+}
+
+// Wrap returns a handler that passes each event to next at most once.
+// When the state store is unavailable events are handled anyway: a
+// duplicate is preferred to a loss.
+func (d *Deduplicator) Wrap(next func(ctx context.Context, envelope *models.Envelope) error) func(ctx context.Context, envelope *models.Envelope) error {
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		key := dedupKeyPrefix + envelope.Event.TenantID + ":" + envelope.Event.ID
+
+		claimed, err := d.claim(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log := logger.WithComponent("dedup")
+			log.Warn().Err(err).Str("event_id", envelope.Event.ID).Msg("dedup unavailable, handling event")
+			return next(ctx, envelope)
+		}
+		if !claimed {
+			metrics.RegionDuplicates.WithLabelValues(envelope.Region).Inc()
+			return nil
+		}
+
+		if err := next(ctx, envelope); err != nil {
+			// Let another copy (or a redelivery) handle it
+			d.store.Expire(context.WithoutCancel(ctx), key, 0)
+			return err
+		}
+		d.complete(ctx, key)
+		return nil
+	}
+}
+
+// claim takes the event's lease, waiting while another consumer holds it.
+// It reports false once the event has been handled.
+func (d *Deduplicator) claim(ctx context.Context, key string) (bool, error) {
+	for {
+		ok, err := d.store.SetNX(ctx, key, []byte(statePending), leaseTTL)
+		if err != nil || ok {
+			return ok, err
+		}
+
+		value, err := d.store.Get(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if string(value) == stateDone {
+			return false, nil
+		}
+
+		// Pending elsewhere, or released since SetNX
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(leasePoll):
+		}
+	}
+}
+
+// complete marks the event handled for the dedup TTL
+func (d *Deduplicator) complete(ctx context.Context, key string) {
+	ctx = context.WithoutCancel(ctx)
+	err := d.store.Set(ctx, key, []byte(stateDone))
+	if err == nil {
+		// Set clears the lease's TTL
+		_, err = d.store.Expire(ctx, key, d.ttl)
+	}
+	if err != nil {
+		log := logger.WithComponent("dedup")
+		log.Warn().Err(err).Str("key", key).Msg("failed to record handled event")
+	}
+}
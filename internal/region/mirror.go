@@ -0,0 +1,174 @@
+package region
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+const (
+	// mirrorTimeout bounds each batch written to the remote cluster
+	mirrorTimeout = 30 * time.Second
+
+	// drainTimeout bounds how long Close waits for queued envelopes
+	drainTimeout = 10 * time.Second
+)
+
+// Mirror is the active-active write policy: envelopes are published to the
+// local region's bus, which alone decides success, and those ingested in
+// this region are mirrored to a topic on the remote region's cluster in the
+// background. Envelopes that were themselves mirrored in (stamped with
+// another region) are not mirrored back.
+type Mirror struct {
+	local     bus.Publisher
+	remote    bus.Publisher
+	region    string
+	topic     string
+	batchSize int
+
+	// mu guards queue against Close
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *models.Envelope
+	done   chan struct{}
+}
+
+// NewMirror wraps the local publisher, mirroring to cfg.MirrorTopic through
+// remote
+func NewMirror(local, remote bus.Publisher, cfg config.RegionConfig) *Mirror {
+	if cfg.MirrorQueueSize <= 0 {
+		cfg.MirrorQueueSize = 10000
+	}
+	if cfg.MirrorBatchSize <= 0 {
+		cfg.MirrorBatchSize = 500
+	}
+
+	m := &Mirror{
+		local:     local,
+		remote:    remote,
+		region:    cfg.Name,
+		topic:     cfg.MirrorTopic,
+		batchSize: cfg.MirrorBatchSize,
+		queue:     make(chan *models.Envelope, cfg.MirrorQueueSize),
+		done:      make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Publish publishes an envelope locally, then queues it for mirroring
+func (m *Mirror) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return m.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+// PublishBatch publishes envelopes locally, then queues those ingested in
+// this region for mirroring. Envelopes the local bus rejected are not
+// mirrored; the caller retries them.
+func (m *Mirror) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	if err := m.local.PublishBatch(ctx, envelopes); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil
+	}
+	for _, envelope := range envelopes {
+		if envelope.Region != "" && envelope.Region != m.region {
+			continue
+		}
+		mirrored := *envelope
+		mirrored.Region = m.region
+		mirrored.Topic = m.topic
+
+		select {
+		case m.queue <- &mirrored:
+		default:
+			metrics.RegionMirrorEnvelopes.WithLabelValues("dropped").Inc()
+		}
+	}
+	metrics.RegionMirrorQueued.Set(float64(len(m.queue)))
+	return nil
+}
+
+// run mirrors queued envelopes in batches until the queue is closed
+func (m *Mirror) run() {
+	defer close(m.done)
+
+	batch := make([]*models.Envelope, 0, m.batchSize)
+	for envelope := range m.queue {
+		batch = append(batch[:0], envelope)
+	fill:
+		for len(batch) < m.batchSize {
+			select {
+			case envelope, ok := <-m.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, envelope)
+			default:
+				break fill
+			}
+		}
+		m.flush(batch)
+	}
+}
+
+// flush writes a batch to the remote cluster; a failed batch is counted
+// and dropped, since the local copy is already durable
+func (m *Mirror) flush(batch []*models.Envelope) {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+
+	if err := m.remote.PublishBatch(ctx, batch); err != nil {
+		log := logger.WithComponent("region_mirror")
+		log.Warn().Err(err).Int("envelopes", len(batch)).Str("topic", m.topic).Msg("failed to mirror envelopes")
+		metrics.RegionMirrorEnvelopes.WithLabelValues("failed").Add(float64(len(batch)))
+	} else {
+		metrics.RegionMirrorEnvelopes.WithLabelValues("mirrored").Add(float64(len(batch)))
+	}
+	metrics.RegionMirrorQueued.Set(float64(len(m.queue)))
+}
+
+// HealthCheck reports the local bus only; the remote region being down
+// does not stop ingest
+func (m *Mirror) HealthCheck(ctx context.Context) error {
+	return m.local.HealthCheck(ctx)
+}
+
+// Stats returns the local publisher's statistics
+func (m *Mirror) Stats() bus.Stats {
+	return m.local.Stats()
+}
+
+// Close drains the mirror queue for a while, then closes both publishers
+func (m *Mirror) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.queue)
+	m.mu.Unlock()
+
+	select {
+	case <-m.done:
+	case <-time.After(drainTimeout):
+		log := logger.WithComponent("region_mirror")
+		log.Warn().Int("pending", len(m.queue)).Msg("mirror queue not drained before shutdown")
+	}
+
+	if err := m.remote.Close(); err != nil {
+		log := logger.WithComponent("region_mirror")
+		log.Warn().Err(err).Msg("failed to close remote publisher")
+	}
+	return m.local.Close()
+}
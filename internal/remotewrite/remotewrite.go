@@ -0,0 +1,282 @@
+// Package remotewrite pushes Parsec's metrics to a Prometheus remote-write
+// endpoint (Prometheus, Mimir, Cortex, Thanos receive), so the series
+// derived from logs reach the metrics backend without it scraping every
+// node. Each push sends the current value of every selected series, with
+// the node's external labels added so nodes don't overwrite each other.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// Config holds remote-write settings
+type Config struct {
+	// URL is the remote-write endpoint, e.g. http://mimir:9009/api/v1/push
+	URL string
+
+	// Interval is how often metrics are pushed (0 = 30s)
+	Interval time.Duration
+
+	// Prefixes selects the metrics pushed by name (empty = all)
+	Prefixes []string
+
+	// Labels are added to every series, e.g. instance=<node>; a series'
+	// own label of the same name wins
+	Labels map[string]string
+
+	// Username and Password set basic auth; BearerToken sets a bearer token
+	Username    string
+	Password    string
+	BearerToken string
+
+	// Client is the HTTP client (nil = 10s timeout client)
+	Client *http.Client
+}
+
+// Pusher periodically pushes gathered metrics to a remote-write endpoint
+type Pusher struct {
+	gatherer prometheus.Gatherer
+	cfg      Config
+}
+
+// New creates a pusher of the metrics gathered from gatherer
+func New(gatherer prometheus.Gatherer, cfg Config) *Pusher {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Pusher{gatherer: gatherer, cfg: cfg}
+}
+
+// Run pushes metrics every interval until ctx is cancelled, then pushes a
+// last time so the final counts aren't lost
+func (p *Pusher) Run(ctx context.Context) {
+	log := logger.WithComponent("remotewrite")
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			if err := p.Push(final); err != nil {
+				log.Warn().Err(err).Msg("final metrics push failed")
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := p.Push(ctx); err != nil {
+				log.Warn().Err(err).Str("url", p.cfg.URL).Msg("metrics push failed")
+			}
+		}
+	}
+}
+
+// Push gathers the selected metrics and sends them in one write request
+func (p *Pusher) Push(ctx context.Context) error {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		metrics.RemoteWritePushes.WithLabelValues("failed").Inc()
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+
+	body, series := Encode(families, p.cfg.Prefixes, p.cfg.Labels, time.Now())
+	if series == 0 {
+		return nil
+	}
+	if err := p.send(ctx, snappy.Encode(nil, body)); err != nil {
+		metrics.RemoteWritePushes.WithLabelValues("failed").Inc()
+		return err
+	}
+	metrics.RemoteWritePushes.WithLabelValues("sent").Inc()
+	metrics.RemoteWriteSeries.Add(float64(series))
+	return nil
+}
+
+// send posts a compressed write request
+func (p *Pusher) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "parsec-remote-write")
+	switch {
+	case p.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	case p.cfg.Username != "":
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// label is a series label
+type label struct {
+	name, value string
+}
+
+// Encode builds a remote-write WriteRequest (before compression) of the
+// families whose names start with one of prefixes, stamped at now. It
+// returns the request and the number of series in it. Histograms and
+// summaries are sent as their classic _bucket/quantile, _sum and _count
+// series.
+func Encode(families []*dto.MetricFamily, prefixes []string, external map[string]string, now time.Time) ([]byte, int) {
+	ts := now.UnixMilli()
+	var (
+		buf    []byte
+		series int
+	)
+	add := func(name string, base []label, extra *label, value float64, at int64) {
+		labels := make([]label, 0, len(base)+len(external)+2)
+		labels = append(labels, label{"__name__", name})
+		labels = append(labels, base...)
+		if extra != nil {
+			labels = append(labels, *extra)
+		}
+		for k, v := range external {
+			if !hasLabel(labels, k) {
+				labels = append(labels, label{k, v})
+			}
+		}
+		sort.Slice(labels, func(a, b int) bool { return labels[a].name < labels[b].name })
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, appendSeries(nil, labels, value, at))
+		series++
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		if !selected(name, prefixes) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			base := make([]label, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				base = append(base, label{l.GetName(), l.GetValue()})
+			}
+			at := ts
+			if m.TimestampMs != nil {
+				at = m.GetTimestampMs()
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, base, nil, m.GetCounter().GetValue(), at)
+			case dto.MetricType_GAUGE:
+				add(name, base, nil, m.GetGauge().GetValue(), at)
+			case dto.MetricType_UNTYPED:
+				add(name, base, nil, m.GetUntyped().GetValue(), at)
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				inf := false
+				for _, b := range h.GetBucket() {
+					inf = inf || math.IsInf(b.GetUpperBound(), +1)
+					add(name+"_bucket", base, &label{"le", formatFloat(b.GetUpperBound())}, float64(b.GetCumulativeCount()), at)
+				}
+				if !inf {
+					add(name+"_bucket", base, &label{"le", "+Inf"}, float64(h.GetSampleCount()), at)
+				}
+				add(name+"_sum", base, nil, h.GetSampleSum(), at)
+				add(name+"_count", base, nil, float64(h.GetSampleCount()), at)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, base, &label{"quantile", formatFloat(q.GetQuantile())}, q.GetValue(), at)
+				}
+				add(name+"_sum", base, nil, s.GetSampleSum(), at)
+				add(name+"_count", base, nil, float64(s.GetSampleCount()), at)
+			}
+		}
+	}
+	return buf, series
+}
+
+// appendSeries encodes a TimeSeries of one sample:
+//
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func appendSeries(b []byte, labels []label, value float64, at int64) []byte {
+	for _, l := range labels {
+		var msg []byte
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendString(msg, l.name)
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendString(msg, l.value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, msg)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(at))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, sample)
+}
+
+// selected reports whether a metric name starts with one of prefixes
+func selected(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabel reports whether labels include name
+func hasLabel(labels []label, name string) bool {
+	for _, l := range labels {
+		if l.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFloat formats a bucket bound or quantile the way Prometheus does
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
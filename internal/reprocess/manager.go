@@ -0,0 +1,397 @@
+package reprocess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/bus"
+	"parsec/internal/jobs"
+	"parsec/internal/kafka"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// Source reads a stretch of a topic through a temporary consumer group;
+// *kafka.RangeReader implements it
+type Source interface {
+	Read(ctx context.Context, spec kafka.RangeSpec, fn func(*models.Envelope) error) error
+}
+
+// Config holds reprocessing settings
+type Config struct {
+	// GroupPrefix is prepended to job IDs to name their consumer groups
+	// (default "parsec-reprocess-")
+	GroupPrefix string
+
+	// Readers is the default number of parallel consumers per job (0 = 4)
+	Readers int
+
+	// Concurrency bounds jobs running at once (0 = 1)
+	Concurrency int
+
+	// ProgressInterval is how often running jobs record progress (0 = 5s)
+	ProgressInterval time.Duration
+
+	// JobTTL is how long job records are kept (0 = 7 days)
+	JobTTL time.Duration
+}
+
+// Manager runs reprocessing jobs on a job scheduler and tracks them in the
+// StateStore so any node can report a job's progress
+type Manager struct {
+	store     state.StateStore
+	source    Source
+	pipelines map[string]*pipeline.Pipeline
+	sinks     map[string]bus.Publisher
+	cfg       Config
+
+	// jobs runs the reprocessing; ownJobs is set when the manager created it
+	jobs    *jobs.Scheduler
+	ownJobs bool
+}
+
+// NewManager creates a reprocessing manager over the named pipelines and
+// sinks requests can choose from
+func NewManager(store state.StateStore, source Source, pipelines map[string]*pipeline.Pipeline, sinks map[string]bus.Publisher, cfg Config) *Manager {
+	if cfg.GroupPrefix == "" {
+		cfg.GroupPrefix = "parsec-reprocess-"
+	}
+	if cfg.Readers <= 0 {
+		cfg.Readers = 4
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.ProgressInterval <= 0 {
+		cfg.ProgressInterval = 5 * time.Second
+	}
+	if cfg.JobTTL <= 0 {
+		cfg.JobTTL = 7 * 24 * time.Hour
+	}
+
+	m := &Manager{
+		store:     store,
+		source:    source,
+		pipelines: pipelines,
+		sinks:     sinks,
+		cfg:       cfg,
+	}
+	m.jobs, m.ownJobs = jobs.NewScheduler(store, jobs.Config{}), true
+	m.jobs.SetLimit(jobs.KindReprocess, cfg.Concurrency)
+	return m
+}
+
+// WithScheduler runs jobs on a shared scheduler, which its owner closes
+func (m *Manager) WithScheduler(s *jobs.Scheduler) *Manager {
+	m.jobs, m.ownJobs = s, false
+	s.SetLimit(jobs.KindReprocess, m.cfg.Concurrency)
+	return m
+}
+
+// jobKey is the StateStore key of a job
+func jobKey(id string) string {
+	return "parsec:reprocess:" + id
+}
+
+// Create validates the request, records a pending job and starts it
+func (m *Manager) Create(ctx context.Context, req Request) (*Job, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if m.pipelines[req.Pipeline] == nil {
+		return nil, fmt.Errorf("%w: unknown pipeline %q", ErrInvalidRequest, req.Pipeline)
+	}
+	if m.sinks[req.Sink] == nil {
+		return nil, fmt.Errorf("%w: unknown sink %q", ErrInvalidRequest, req.Sink)
+	}
+	if req.Readers == 0 {
+		req.Readers = m.cfg.Readers
+	}
+	req.From, req.To = req.From.UTC(), req.To.UTC()
+
+	id := uuid.New().String()
+	job := &Job{
+		ID:        id,
+		Request:   req,
+		Group:     m.cfg.GroupPrefix + id,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := m.save(ctx, job); err != nil {
+		return nil, err
+	}
+	metrics.ReprocessJobs.WithLabelValues(StatusPending).Inc()
+
+	// The job runs on its own copy so the caller's view stays stable
+	created := *job
+	progress := &counters{}
+	_, err := m.jobs.Submit(ctx, jobs.Task{
+		ID:       job.ID,
+		Kind:     jobs.KindReprocess,
+		TenantID: req.TenantID,
+		Detail:   "/admin/reprocess/" + job.ID,
+		Run: func(ctx context.Context, report func(jobs.Progress)) error {
+			return m.run(ctx, job, progress, report)
+		},
+		Finish: func(err error) { m.finish(job, progress, err) },
+	})
+	if err != nil {
+		m.finish(job, progress, err)
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Get returns a job with its last recorded progress
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := m.store.Get(ctx, jobKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("parse reprocess job: %w", err)
+	}
+	return &job, nil
+}
+
+// Close cancels running jobs, marking them failed, and waits for them. A
+// shared scheduler is left to its owner.
+func (m *Manager) Close() {
+	if m.ownJobs {
+		m.jobs.Close()
+	}
+}
+
+// counters are a running job's progress, updated by the readers
+type counters struct {
+	total, read, skipped, written, dropped, failed atomic.Int64
+
+	// mu guards the job record between the progress recorder and finish
+	mu sync.Mutex
+}
+
+// snapshot copies the counters into progress
+func (c *counters) snapshot() Progress {
+	p := Progress{
+		Total:   c.total.Load(),
+		Read:    c.read.Load(),
+		Skipped: c.skipped.Load(),
+		Written: c.written.Load(),
+		Dropped: c.dropped.Load(),
+		Failed:  c.failed.Load(),
+	}
+	if p.Total > 0 {
+		p.Percent = min(100, float64(p.Read)*100/float64(p.Total))
+	}
+	return p
+}
+
+// run executes a job once the scheduler starts it, recording progress
+// every ProgressInterval
+func (m *Manager) run(ctx context.Context, job *Job, progress *counters, report func(jobs.Progress)) error {
+	log := logger.WithComponent("reprocess").With().Str("job_id", job.ID).Logger()
+
+	progress.mu.Lock()
+	started := time.Now().UTC()
+	job.Status, job.StartedAt = StatusRunning, &started
+	err := m.save(ctx, job)
+	progress.mu.Unlock()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to record reprocess job status")
+	}
+
+	// The recorder stops before run returns, so it can't overwrite the
+	// outcome the scheduler has finish record
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(m.cfg.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p := progress.snapshot()
+				report(jobs.Progress{Done: p.Read, Total: p.Total, Unit: "messages"})
+
+				progress.mu.Lock()
+				job.Progress = p
+				err := m.save(ctx, job)
+				progress.mu.Unlock()
+				if err != nil {
+					log.Warn().Err(err).Msg("failed to record reprocess job progress")
+				}
+			}
+		}
+	}()
+
+	return m.reprocess(ctx, job, progress)
+}
+
+// reprocess reads the job's range, running kept events through the
+// pipeline and writing them to the sink
+func (m *Manager) reprocess(ctx context.Context, job *Job, progress *counters) error {
+	p, sink := m.pipelines[job.Pipeline], m.sinks[job.Sink]
+	pace := newPacer(job.RatePerSecond)
+
+	spec := kafka.RangeSpec{
+		Group:   job.Group,
+		Topic:   job.Topic,
+		From:    job.From,
+		Readers: job.Readers,
+		Started: func(total int64) { progress.total.Store(total) },
+	}
+	return m.source.Read(ctx, spec, func(envelope *models.Envelope) error {
+		if err := pace.wait(ctx); err != nil {
+			return err
+		}
+		progress.read.Add(1)
+
+		e := envelope.Event
+		if e == nil || (job.TenantID != "" && e.TenantID != job.TenantID) ||
+			e.Timestamp.Before(job.From) || !e.Timestamp.Before(job.To) {
+			progress.skipped.Add(1)
+			metrics.ReprocessedEvents.WithLabelValues("skipped").Inc()
+			return nil
+		}
+
+		if err := p.Run(ctx, e); err != nil {
+			if errors.Is(err, pipeline.ErrDropped) {
+				progress.dropped.Add(1)
+				metrics.ReprocessedEvents.WithLabelValues("dropped").Inc()
+			} else {
+				progress.failed.Add(1)
+				metrics.ReprocessedEvents.WithLabelValues("failed").Inc()
+			}
+			return nil
+		}
+
+		if job.TargetTopic != "" {
+			envelope.Topic = job.TargetTopic
+		}
+		// A sink that can't take events fails the job rather than
+		// silently losing the rest of the range
+		if err := sink.Publish(ctx, envelope); err != nil {
+			progress.failed.Add(1)
+			metrics.ReprocessedEvents.WithLabelValues("failed").Inc()
+			return fmt.Errorf("write to sink %s: %w", job.Sink, err)
+		}
+		progress.written.Add(1)
+		metrics.ReprocessedEvents.WithLabelValues("written").Inc()
+		return nil
+	})
+}
+
+// finish records the job's outcome
+func (m *Manager) finish(job *Job, progress *counters, err error) {
+	log := logger.WithComponent("reprocess").With().Str("job_id", job.ID).Logger()
+
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+	job.Progress = progress.snapshot()
+	job.Status = StatusSucceeded
+	switch {
+	case errors.Is(err, jobs.ErrCancelled):
+		job.Status, job.Error = StatusCancelled, err.Error()
+	case err != nil:
+		job.Status, job.Error = StatusFailed, err.Error()
+	}
+	metrics.ReprocessJobs.WithLabelValues(job.Status).Inc()
+
+	// The job context may be cancelled; the final status must still land
+	if saveErr := m.save(context.Background(), job); saveErr != nil {
+		log.Error().Err(saveErr).Msg("failed to record reprocess job result")
+	}
+
+	event := log.Info()
+	if job.Status == StatusFailed {
+		event = log.Error().Err(err)
+	}
+	event.
+		Str("status", job.Status).
+		Str("topic", job.Topic).
+		Int64("read", job.Progress.Read).
+		Int64("written", job.Progress.Written).
+		Int64("dropped", job.Progress.Dropped).
+		Int64("failed", job.Progress.Failed).
+		Msg("reprocess finished")
+}
+
+// save writes a job record with the job TTL
+func (m *Manager) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	key := jobKey(job.ID)
+	if err := m.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = m.store.Expire(ctx, key, m.cfg.JobTTL)
+	return err
+}
+
+// pacer spaces events evenly to stay within a rate shared by all readers
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newPacer creates a pacer for ratePerSecond (0 = unlimited)
+func newPacer(ratePerSecond float64) *pacer {
+	if ratePerSecond <= 0 {
+		return &pacer{}
+	}
+	return &pacer{interval: time.Duration(float64(time.Second) / ratePerSecond)}
+}
+
+// wait blocks until the next event is due
+func (p *pacer) wait(ctx context.Context) error {
+	if p.interval == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	due := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
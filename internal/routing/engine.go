@@ -0,0 +1,268 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding all tenants' routing rules, as a
+// versioned value (see state.Versioned)
+const StoreKey = "parsec:routing"
+
+// Engine holds per-tenant routing rules, shared across nodes via the StateStore
+type Engine struct {
+	shared *state.Versioned
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu    sync.RWMutex
+	rules map[string][]Rule
+
+	// retentionTopics maps retention tiers to topics, set at startup
+	retentionTopics map[string]string
+
+	// defaults returns rules applied after a tenant's own, set at startup
+	defaults func(tenantID string) []Rule
+
+	// topics and tenantTopicPrefix restrict route actions' topics, set at
+	// startup; unrestricted until set
+	topics            map[string]bool
+	tenantTopicPrefix string
+	restricted        bool
+}
+
+// NewEngine creates a routing engine backed by the given store (may be nil)
+func NewEngine(store state.StateStore) *Engine {
+	e := &Engine{rules: make(map[string][]Rule)}
+	if store != nil {
+		e.shared = state.NewVersioned(store, StoreKey)
+	}
+	return e
+}
+
+// SetRetentionTopics maps retention tiers to topics. Events assigned a tier
+// without an explicit route are published to the tier's topic. Call before
+// the engine is shared.
+func (e *Engine) SetRetentionTopics(topics map[string]string) {
+	e.retentionTopics = make(map[string]string, len(topics))
+	for tier, topic := range topics {
+		if topic != "" {
+			e.retentionTopics[tier] = topic
+		}
+	}
+}
+
+// SetAllowedTopics restricts the topics route actions may send events to:
+// those listed, and for each tenant those starting with tenantPrefix with
+// {tenant} replaced by its ID (e.g. "logs.{tenant}."; "" = none). Call
+// before the engine is shared.
+func (e *Engine) SetAllowedTopics(topics []string, tenantPrefix string) {
+	e.topics = make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		if topic != "" {
+			e.topics[topic] = true
+		}
+	}
+	e.tenantTopicPrefix = tenantPrefix
+	e.restricted = true
+}
+
+// topicAllowed reports whether a tenant's route actions may send events to
+// topic
+func (e *Engine) topicAllowed(tenantID, topic string) bool {
+	if !e.restricted || e.topics[topic] {
+		return true
+	}
+	if e.tenantTopicPrefix == "" {
+		return false
+	}
+	prefix := strings.ReplaceAll(e.tenantTopicPrefix, "{tenant}", tenantID)
+	return strings.HasPrefix(topic, prefix) && len(topic) > len(prefix)
+}
+
+// SetDefaults supplies rules evaluated after each tenant's own, e.g. its
+// service tier's, which fill in what the tenant's rules leave unset. Call
+// before the engine is shared.
+func (e *Engine) SetDefaults(defaults func(tenantID string) []Rule) {
+	e.defaults = defaults
+}
+
+// Evaluate returns the routing decision for an event
+func (e *Engine) Evaluate(event *models.LogEvent) Decision {
+	if e == nil {
+		return Decision{}
+	}
+
+	e.mu.RLock()
+	rules := e.rules[event.TenantID]
+	e.mu.RUnlock()
+
+	var defaults []Rule
+	if e.defaults != nil {
+		defaults = e.defaults(event.TenantID)
+	}
+	if len(rules) == 0 && len(defaults) == 0 {
+		return Decision{}
+	}
+
+	d := Evaluate(rules, event)
+	if !d.Drop && len(defaults) > 0 {
+		d.fill(Evaluate(defaults, event))
+	}
+	if d.Topic == "" && d.Retention != "" {
+		d.Topic = e.retentionTopics[d.Retention]
+	}
+	return d
+}
+
+// Rules returns a tenant's rules
+func (e *Engine) Rules(tenantID string) []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules[tenantID]...)
+}
+
+// Topics returns the topics a tenant's route rules send events to
+func (e *Engine) Topics(tenantID string) []string {
+	var topics []string
+	for _, rule := range e.Rules(tenantID) {
+		if rule.Action == ActionRoute {
+			topics = append(topics, rule.Topic)
+		}
+	}
+	return topics
+}
+
+// Config returns every tenant's rules, for introspection
+func (e *Engine) Config() any {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rules := make(map[string][]Rule, len(e.rules))
+	for tenantID, r := range e.rules {
+		rules[tenantID] = append([]Rule(nil), r...)
+	}
+	return rules
+}
+
+// SetRules validates and replaces a tenant's rules. An empty list removes them.
+func (e *Engine) SetRules(ctx context.Context, tenantID string, rules []Rule) error {
+	if len(rules) > MaxRulesPerTenant {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyRules, len(rules), MaxRulesPerTenant)
+	}
+	for i := range rules {
+		rules[i].normalize()
+		if err := rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if rules[i].Action == ActionRoute && !e.topicAllowed(tenantID, rules[i].Topic) {
+			return fmt.Errorf("rule %d: %w: %q", i, ErrTopicNotAllowed, rules[i].Topic)
+		}
+	}
+
+	e.writing.Lock()
+	defer e.writing.Unlock()
+
+	apply := func(data []byte) (map[string][]Rule, error) {
+		current := make(map[string][]Rule)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse routing rules: %w", err)
+			}
+		} else {
+			e.mu.RLock()
+			for id, r := range e.rules {
+				current[id] = r
+			}
+			e.mu.RUnlock()
+		}
+		if len(rules) == 0 {
+			delete(current, tenantID)
+		} else {
+			current[tenantID] = rules
+		}
+		return current, nil
+	}
+
+	var next map[string][]Rule
+	if e.shared == nil {
+		next, _ = apply(nil)
+	} else {
+		// Applied to the stored rules, again if another node changed them
+		// meanwhile, so every tenant's change is kept
+		err := e.shared.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if next, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(next)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	e.rules = next
+	e.mu.Unlock()
+	return nil
+}
+
+// Load replaces the in-memory rules with those in the store
+func (e *Engine) Load(ctx context.Context) error {
+	if e.shared == nil {
+		return nil
+	}
+
+	data, err := e.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the rules set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	rules := make(map[string][]Rule)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse routing rules: %w", err)
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Run reloads rules periodically so changes made on other nodes propagate
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("routing")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload routing rules")
+			}
+		}
+	}
+}
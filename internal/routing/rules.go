@@ -0,0 +1,307 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strings"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+// Action is what a rule does with a matching event
+type Action string
+
+const (
+	ActionRoute    Action = "route"
+	ActionPriority Action = "set_priority"
+	ActionDrop     Action = "drop"
+	ActionSample   Action = "sample"
+
+	// ActionRetention assigns a retention tier (e.g. DEBUG/INFO to short)
+	// and/or a retention hint (e.g. audit events for 7 years)
+	ActionRetention Action = "set_retention"
+
+	// ActionPartition writes events to one Kafka partition, e.g. to move a
+	// tenant off a partition being drained
+	ActionPartition Action = "set_partition"
+)
+
+// Priorities accepted by set_priority
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Retention tiers accepted by set_retention. Each tier maps to its own topic
+// and storage partition.
+const (
+	RetentionShort = "short"
+	RetentionLong  = "long"
+)
+
+// Rule validation errors
+var (
+	ErrUnknownAction    = errors.New("unknown rule action")
+	ErrMissingTopic     = errors.New("route action requires a topic")
+	ErrTopicNotAllowed  = errors.New("topic is not allowed for route actions")
+	ErrInvalidPriority  = errors.New("priority must be high, normal or low")
+	ErrInvalidRetention = errors.New("retention must be short or long")
+	ErrMissingRetention = errors.New("set_retention action requires a retention tier or a ttl")
+	ErrInvalidSample    = errors.New("sample_rate must be between 0 and 1")
+	ErrInvalidPartition = errors.New("set_partition action requires a partition of 0 or more")
+	ErrInvalidSource    = errors.New("invalid source pattern")
+	ErrTooManyRules     = errors.New("too many routing rules")
+)
+
+// MaxRulesPerTenant bounds per-event evaluation cost
+const MaxRulesPerTenant = 100
+
+// Match selects events. All non-empty conditions must hold.
+type Match struct {
+	// Severities matches any of the listed severities
+	Severities []models.Severity `json:"severity,omitempty"`
+
+	// MaxSeverity matches events at or below this severity (e.g. INFO)
+	MaxSeverity models.Severity `json:"max_severity,omitempty"`
+
+	// Source is a glob pattern (path.Match syntax) on the normalized source
+	Source string `json:"source,omitempty"`
+
+	// Metadata requires each key to equal the value ("*" = key present);
+	// dotted keys ("http.status") match nested fields
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Rule is a single routing rule
+type Rule struct {
+	Name   string `json:"name,omitempty"`
+	Match  Match  `json:"match"`
+	Action Action `json:"action"`
+
+	// Topic for route actions
+	Topic string `json:"topic,omitempty"`
+
+	// Priority for set_priority actions
+	Priority string `json:"priority,omitempty"`
+
+	// SampleRate is the fraction of matching events kept by sample actions
+	SampleRate float64 `json:"sample_rate,omitempty"`
+
+	// Retention tier for set_retention actions
+	Retention string `json:"retention,omitempty"`
+
+	// TTL is the retention hint of set_retention actions, e.g. "7y" or
+	// "3d" (see models.ParseRetention)
+	TTL string `json:"ttl,omitempty"`
+
+	// Partition for set_partition actions
+	Partition *int `json:"partition,omitempty"`
+}
+
+// Validate checks a rule is well-formed
+func (r *Rule) Validate() error {
+	if r.Match.Source != "" {
+		if _, err := path.Match(r.Match.Source, ""); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidSource, r.Match.Source)
+		}
+	}
+	for _, sev := range r.Match.Severities {
+		if !sev.IsValid() {
+			return fmt.Errorf("%w: %q", models.ErrInvalidSeverity, sev)
+		}
+	}
+	if r.Match.MaxSeverity != "" && !r.Match.MaxSeverity.IsValid() {
+		return fmt.Errorf("%w: %q", models.ErrInvalidSeverity, r.Match.MaxSeverity)
+	}
+
+	switch r.Action {
+	case ActionRoute:
+		if r.Topic == "" {
+			return ErrMissingTopic
+		}
+	case ActionPriority:
+		switch r.Priority {
+		case PriorityHigh, PriorityNormal, PriorityLow:
+		default:
+			return ErrInvalidPriority
+		}
+	case ActionSample:
+		if r.SampleRate <= 0 || r.SampleRate > 1 {
+			return ErrInvalidSample
+		}
+	case ActionRetention:
+		if r.Retention == "" && r.TTL == "" {
+			return ErrMissingRetention
+		}
+		switch r.Retention {
+		case "", RetentionShort, RetentionLong:
+		default:
+			return ErrInvalidRetention
+		}
+		if r.TTL != "" {
+			if _, err := models.ParseRetention(r.TTL); err != nil {
+				return fmt.Errorf("%w: %q", err, r.TTL)
+			}
+		}
+	case ActionPartition:
+		if r.Partition == nil || *r.Partition < 0 {
+			return ErrInvalidPartition
+		}
+	case ActionDrop:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAction, r.Action)
+	}
+	return nil
+}
+
+// normalize upper-cases severities and lower-cases sources/metadata keys to
+// match normalized events
+func (r *Rule) normalize() {
+	for i, sev := range r.Match.Severities {
+		r.Match.Severities[i] = models.Severity(strings.ToUpper(string(sev)))
+	}
+	r.Match.MaxSeverity = models.Severity(strings.ToUpper(string(r.Match.MaxSeverity)))
+	r.Match.Source = strings.ToLower(r.Match.Source)
+	r.Retention = strings.ToLower(r.Retention)
+	if len(r.Match.Metadata) > 0 {
+		normalized := make(map[string]string, len(r.Match.Metadata))
+		for k, v := range r.Match.Metadata {
+			normalized[strings.ToLower(k)] = v
+		}
+		r.Match.Metadata = normalized
+	}
+}
+
+// matches reports whether the event satisfies the rule's conditions
+func (m *Match) matches(e *models.LogEvent) bool {
+	if len(m.Severities) > 0 {
+		found := false
+		for _, sev := range m.Severities {
+			if sev == e.Severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if m.MaxSeverity != "" && e.Severity.Rank() > m.MaxSeverity.Rank() {
+		return false
+	}
+
+	if m.Source != "" {
+		if ok, _ := path.Match(m.Source, e.Source); !ok {
+			return false
+		}
+	}
+
+	for k, want := range m.Metadata {
+		got, ok := e.Metadata.Lookup(k)
+		if !ok || (want != "*" && models.Stringify(got) != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Decision is the outcome of evaluating a tenant's rules against an event
+type Decision struct {
+	Drop      bool   `json:"drop"`
+	Topic     string `json:"topic,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+	Retention string `json:"retention,omitempty"`
+
+	// RetentionSeconds is the retention hint of the first matching rule
+	// with a ttl
+	RetentionSeconds int64 `json:"retention_seconds,omitempty"`
+
+	Partition *int     `json:"partition,omitempty"`
+	Matched   []string `json:"matched,omitempty"`
+}
+
+// Evaluate applies rules in order. Drop and failed samples stop evaluation;
+// the first matching route, priority, retention tier, retention hint and
+// partition win.
+func Evaluate(rules []Rule, e *models.LogEvent) Decision {
+	var d Decision
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Match.matches(e) {
+			continue
+		}
+
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+		d.Matched = append(d.Matched, name)
+
+		switch rule.Action {
+		case ActionDrop:
+			d.Drop = true
+			return d
+		case ActionSample:
+			if !sampled(e.ID, rule.SampleRate) {
+				d.Drop = true
+				return d
+			}
+		case ActionRoute:
+			if d.Topic == "" {
+				d.Topic = rule.Topic
+			}
+		case ActionPriority:
+			if d.Priority == "" {
+				d.Priority = rule.Priority
+			}
+		case ActionRetention:
+			if d.Retention == "" {
+				d.Retention = rule.Retention
+			}
+			if d.RetentionSeconds == 0 && rule.TTL != "" {
+				if ttl, err := models.ParseRetention(rule.TTL); err == nil {
+					d.RetentionSeconds = int64(ttl / time.Second)
+				}
+			}
+		case ActionPartition:
+			if d.Partition == nil {
+				d.Partition = rule.Partition
+			}
+		}
+	}
+	return d
+}
+
+// fill sets what d leaves unset from a decision of lower precedence
+func (d *Decision) fill(from Decision) {
+	d.Drop = d.Drop || from.Drop
+	if d.Topic == "" {
+		d.Topic = from.Topic
+	}
+	if d.Priority == "" {
+		d.Priority = from.Priority
+	}
+	if d.Retention == "" {
+		d.Retention = from.Retention
+	}
+	if d.RetentionSeconds == 0 {
+		d.RetentionSeconds = from.RetentionSeconds
+	}
+	if d.Partition == nil {
+		d.Partition = from.Partition
+	}
+	d.Matched = append(d.Matched, from.Matched...)
+}
+
+// sampled keeps a stable fraction of events keyed by event ID, so client
+// retries of the same event get the same decision
+func sampled(eventID string, rate float64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(eventID))
+	return float64(h.Sum32()%10000) < rate*10000
+}
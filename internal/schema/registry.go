@@ -0,0 +1,406 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding all tenants' metadata schemas, as a
+// versioned value (see state.Versioned)
+const StoreKey = "parsec:schemas"
+
+// MaxSchemaBytes bounds the size of a tenant schema document
+const MaxSchemaBytes = 64 << 10
+
+// MetadataViolation is the metadata key set on events that fail validation
+// in flag mode
+const MetadataViolation = "schema_violation"
+
+// maxReported bounds the number of violations listed in an error message
+const maxReported = 3
+
+// Mode selects what happens to events that fail validation
+type Mode string
+
+const (
+	// ModeReject rejects the event with a validation error
+	ModeReject Mode = "reject"
+	// ModeFlag accepts the event and records the violation in its metadata
+	ModeFlag Mode = "flag"
+)
+
+var (
+	// ErrInvalidSchema is returned for schemas that fail to compile
+	ErrInvalidSchema = errors.New("invalid schema")
+
+	// ErrInvalidMode is returned for modes other than reject and flag
+	ErrInvalidMode = errors.New("mode must be reject or flag")
+
+	// ErrViolation is returned for events rejected by their tenant's schema
+	ErrViolation = errors.New("metadata does not match tenant schema")
+)
+
+// Schema is a tenant's JSON Schema for event metadata, validated against the
+// metadata object with its nested values (required, properties, pattern,
+// enum, additionalProperties, ...).
+type Schema struct {
+	TenantID  string          `json:"tenant_id"`
+	Schema    json.RawMessage `json:"schema"`
+	Mode      Mode            `json:"mode"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// compiled is a tenant schema ready for validation
+type compiled struct {
+	schema    Schema
+	validator *jsonschema.Schema
+}
+
+// Registry validates event metadata against per-tenant schemas as a
+// pipeline stage. Schemas are shared across nodes via the StateStore and
+// hot-reloaded by Run.
+type Registry struct {
+	shared *state.Versioned
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu       sync.RWMutex
+	compiled map[string]*compiled
+}
+
+// NewRegistry creates a schema registry backed by the given store (may be nil)
+func NewRegistry(store state.StateStore) *Registry {
+	r := &Registry{compiled: make(map[string]*compiled)}
+	if store != nil {
+		r.shared = state.NewVersioned(store, StoreKey)
+	}
+	return r
+}
+
+// Name implements pipeline.Stage
+func (r *Registry) Name() string { return "schema" }
+
+// Process implements pipeline.Stage. Events of tenants without a schema
+// pass through unchanged.
+func (r *Registry) Process(ctx context.Context, event *models.LogEvent) (pipeline.Result, error) {
+	if r == nil {
+		return pipeline.Result{}, nil
+	}
+
+	r.mu.RLock()
+	c := r.compiled[event.TenantID]
+	r.mu.RUnlock()
+
+	if c == nil {
+		return pipeline.Result{}, nil
+	}
+
+	dryRun := pipeline.IsDryRun(ctx)
+
+	instance := map[string]any(event.Metadata)
+	if instance == nil {
+		instance = map[string]any{}
+	}
+
+	err := c.validator.Validate(instance)
+	if err == nil {
+		if !dryRun {
+			metrics.SchemaValidations.WithLabelValues(event.TenantID, "valid").Inc()
+		}
+		return pipeline.Result{}, nil
+	}
+
+	reason := describe(err)
+	if c.schema.Mode == ModeFlag {
+		if !dryRun {
+			metrics.SchemaValidations.WithLabelValues(event.TenantID, "flagged").Inc()
+		}
+		if event.Metadata == nil {
+			event.Metadata = make(models.Metadata, 1)
+		}
+		event.Metadata[MetadataViolation] = reason
+		return pipeline.Result{Changed: true, Detail: "flagged"}, nil
+	}
+
+	if !dryRun {
+		metrics.SchemaValidations.WithLabelValues(event.TenantID, "rejected").Inc()
+	}
+	return pipeline.Result{Detail: "rejected"}, fmt.Errorf("%w: %s", ErrViolation, reason)
+}
+
+// describe flattens a validation error into a one-line summary of its
+// first few violations
+func describe(err error) string {
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err.Error()
+	}
+
+	var reasons []string
+	var walk func(unit jsonschema.OutputUnit)
+	walk = func(unit jsonschema.OutputUnit) {
+		if unit.Error != nil && len(unit.Errors) == 0 {
+			location := unit.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			reasons = append(reasons, location+": "+unit.Error.String())
+		}
+		for _, child := range unit.Errors {
+			walk(child)
+		}
+	}
+	walk(*verr.BasicOutput())
+
+	if len(reasons) == 0 {
+		return strings.ReplaceAll(verr.Error(), "\n", " ")
+	}
+	if len(reasons) > maxReported {
+		reasons = append(reasons[:maxReported], fmt.Sprintf("and %d more", len(reasons)-maxReported))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Config implements pipeline.Configured: the schema of each tenant
+func (r *Registry) Config() any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemas := make(map[string]Schema, len(r.compiled))
+	for tenantID, c := range r.compiled {
+		schemas[tenantID] = c.schema
+	}
+	return schemas
+}
+
+// Get returns a tenant's schema
+func (r *Registry) Get(tenantID string) (Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.compiled[tenantID]
+	if !ok {
+		return Schema{}, false
+	}
+	return c.schema, true
+}
+
+// Set compiles and activates a tenant's schema, replacing any previous one
+func (r *Registry) Set(ctx context.Context, tenantID string, s Schema) (Schema, error) {
+	s.TenantID = tenantID
+	if s.Mode == "" {
+		s.Mode = ModeReject
+	}
+	s.UpdatedAt = time.Now().UTC()
+
+	c, err := compile(s)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	err = r.update(ctx, func(schemas map[string]Schema) {
+		schemas[tenantID] = s
+	}, func() {
+		r.compiled[tenantID] = c
+	})
+	if err != nil {
+		return Schema{}, err
+	}
+	return s, nil
+}
+
+// Delete removes a tenant's schema, reporting whether it had one
+func (r *Registry) Delete(ctx context.Context, tenantID string) (bool, error) {
+	var existed bool
+	err := r.update(ctx, func(schemas map[string]Schema) {
+		_, existed = schemas[tenantID]
+		delete(schemas, tenantID)
+	}, nil)
+	return existed, err
+}
+
+// update applies change to the latest schemas, in the store when there is
+// one, then activates them. activate, if set, runs first under the lock.
+func (r *Registry) update(ctx context.Context, change func(map[string]Schema), activate func()) error {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+
+	apply := func(data []byte) (map[string]Schema, error) {
+		current := make(map[string]Schema)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse schemas: %w", err)
+			}
+		} else {
+			r.mu.RLock()
+			for tenantID, c := range r.compiled {
+				current[tenantID] = c.schema
+			}
+			r.mu.RUnlock()
+		}
+		change(current)
+		return current, nil
+	}
+
+	var schemas map[string]Schema
+	if r.shared == nil {
+		var err error
+		if schemas, err = apply(nil); err != nil {
+			return err
+		}
+	} else {
+		// Applied to the stored schemas, again if another node changed them
+		// meanwhile, so every tenant's change is kept
+		err := r.shared.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if schemas, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(schemas)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if activate != nil {
+		activate()
+	}
+	r.replace(schemas)
+	return nil
+}
+
+// Load replaces the in-memory schemas with those in the store. Unchanged
+// schemas are not recompiled; schemas that fail to compile keep their last
+// good version.
+func (r *Registry) Load(ctx context.Context) error {
+	if r.shared == nil {
+		return nil
+	}
+
+	data, err := r.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the schemas set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	schemas := make(map[string]Schema)
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return fmt.Errorf("parse schemas: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replace(schemas)
+	return nil
+}
+
+// replace swaps in schemas, compiling those that changed. The caller holds
+// r.mu.
+func (r *Registry) replace(schemas map[string]Schema) {
+	log := logger.WithComponent("schema")
+
+	next := make(map[string]*compiled, len(schemas))
+	for tenantID, s := range schemas {
+		if c := r.compiled[tenantID]; c != nil && c.schema.UpdatedAt.Equal(s.UpdatedAt) {
+			next[tenantID] = c
+			continue
+		}
+
+		c, err := compile(s)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("tenant_id", tenantID).
+				Msg("failed to compile tenant schema, keeping previous version")
+			if c := r.compiled[tenantID]; c != nil {
+				next[tenantID] = c
+			}
+			continue
+		}
+		next[tenantID] = c
+	}
+
+	r.compiled = next
+}
+
+// Run reloads schemas periodically so changes made on other nodes propagate
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("schema")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload tenant schemas")
+			}
+		}
+	}
+}
+
+// compile validates the mode and compiles the schema document
+func compile(s Schema) (*compiled, error) {
+	if s.Mode != ModeReject && s.Mode != ModeFlag {
+		return nil, ErrInvalidMode
+	}
+	if len(s.Schema) == 0 {
+		return nil, fmt.Errorf("%w: schema is required", ErrInvalidSchema)
+	}
+	if len(s.Schema) > MaxSchemaBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidSchema, MaxSchemaBytes)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(s.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	loc := "parsec://schemas/" + url.PathEscape(s.TenantID) + ".json"
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	// Schemas must be self-contained: never fetch files or URLs
+	compiler.UseLoader(noLoader{})
+	if err := compiler.AddResource(loc, doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	validator, err := compiler.Compile(loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	return &compiled{schema: s, validator: validator}, nil
+}
+
+// noLoader refuses external $ref resolution
+type noLoader struct{}
+
+func (noLoader) Load(loc string) (any, error) {
+	return nil, fmt.Errorf("external reference %q not allowed", loc)
+}
@@ -0,0 +1,385 @@
+package scripting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/pipeline"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding all tenants' script versions, as a
+// versioned value (see state.Versioned)
+const StoreKey = "parsec:scripts"
+
+// MaxVersions is the number of versions kept per tenant for rollback
+const MaxVersions = 10
+
+// ErrVersionNotFound is returned when rolling back to an unknown version
+var ErrVersionNotFound = errors.New("script version not found")
+
+// Limits bounds the cost of running tenant scripts
+type Limits struct {
+	// Timeout is the per-event time budget. Expressions cannot be interrupted,
+	// so overruns count as violations rather than aborting the event.
+	Timeout time.Duration
+
+	// MemoryBudget caps allocations per evaluation (expr VM units)
+	MemoryBudget uint
+
+	// MaxViolations disables a script after this many overruns or errors
+	MaxViolations int
+}
+
+// Status is a tenant's script state as reported to admins
+type Status struct {
+	TenantID       string   `json:"tenant_id"`
+	Current        *Script  `json:"current,omitempty"`
+	History        []Script `json:"history"`
+	Disabled       bool     `json:"disabled"`
+	DisabledReason string   `json:"disabled_reason,omitempty"`
+}
+
+// active is the compiled current version of a tenant's script
+type active struct {
+	*program
+	violations atomic.Int32
+	disabled   atomic.Pointer[string]
+}
+
+// Engine runs per-tenant scripts as a pipeline stage. Versions are shared
+// across nodes via the StateStore and hot-reloaded by Run.
+type Engine struct {
+	shared *state.Versioned
+	limits Limits
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu       sync.RWMutex
+	versions map[string][]Script
+	active   map[string]*active
+}
+
+// NewEngine creates a script engine backed by the given store (may be nil)
+func NewEngine(store state.StateStore, limits Limits) *Engine {
+	if limits.Timeout <= 0 {
+		limits.Timeout = 5 * time.Millisecond
+	}
+	if limits.MemoryBudget == 0 {
+		limits.MemoryBudget = 100_000
+	}
+	if limits.MaxViolations <= 0 {
+		limits.MaxViolations = 3
+	}
+
+	e := &Engine{
+		limits:   limits,
+		versions: make(map[string][]Script),
+		active:   make(map[string]*active),
+	}
+	if store != nil {
+		e.shared = state.NewVersioned(store, StoreKey)
+	}
+	return e
+}
+
+// Name implements pipeline.Stage
+func (e *Engine) Name() string { return "script" }
+
+// Process implements pipeline.Stage. Script errors never reject an event:
+// the event passes through unchanged and the error counts as a violation.
+func (e *Engine) Process(ctx context.Context, event *models.LogEvent) (pipeline.Result, error) {
+	if e == nil {
+		return pipeline.Result{}, nil
+	}
+
+	e.mu.RLock()
+	a := e.active[event.TenantID]
+	e.mu.RUnlock()
+
+	if a == nil || a.disabled.Load() != nil {
+		return pipeline.Result{}, nil
+	}
+
+	dryRun := pipeline.IsDryRun(ctx)
+	detail := fmt.Sprintf("v%d", a.script.Version)
+
+	start := time.Now()
+	keep, changed, err := a.run(event, e.limits.MemoryBudget)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		if !dryRun {
+			metrics.ScriptExecutions.WithLabelValues(event.TenantID, "error").Inc()
+			e.violation(event.TenantID, a, err.Error())
+		}
+		return pipeline.Result{Detail: detail + ":error"}, nil
+	}
+
+	if !dryRun {
+		status := "ok"
+		if !keep {
+			status = "filtered"
+		}
+		metrics.ScriptExecutions.WithLabelValues(event.TenantID, status).Inc()
+		if elapsed > e.limits.Timeout {
+			e.violation(event.TenantID, a, fmt.Sprintf("exceeded time budget: %s > %s", elapsed, e.limits.Timeout))
+		}
+	}
+
+	return pipeline.Result{Drop: !keep, Changed: changed, Detail: detail}, nil
+}
+
+// violation records a limit overrun and disables the script once it has
+// happened too often
+func (e *Engine) violation(tenantID string, a *active, reason string) {
+	if int(a.violations.Add(1)) < e.limits.MaxViolations {
+		return
+	}
+	if !a.disabled.CompareAndSwap(nil, &reason) {
+		return
+	}
+
+	metrics.ScriptExecutions.WithLabelValues(tenantID, "disabled").Inc()
+	log := logger.WithComponent("scripting")
+	log.Warn().
+		Str("tenant_id", tenantID).
+		Int("version", a.script.Version).
+		Str("reason", reason).
+		Msg("tenant script disabled after repeated violations")
+}
+
+// Config implements pipeline.Configured: the active script of each tenant
+func (e *Engine) Config() any {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	active := make(map[string]Script, len(e.active))
+	for tenantID, a := range e.active {
+		if a.disabled.Load() == nil {
+			active[tenantID] = a.script
+		}
+	}
+	return active
+}
+
+// Status returns a tenant's current script and history
+func (e *Engine) Status(tenantID string) Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	status := Status{
+		TenantID: tenantID,
+		History:  append([]Script{}, e.versions[tenantID]...),
+	}
+	if a := e.active[tenantID]; a != nil {
+		current := a.script
+		status.Current = &current
+		if reason := a.disabled.Load(); reason != nil {
+			status.Disabled = true
+			status.DisabledReason = *reason
+		}
+	}
+	return status
+}
+
+// Set compiles and activates a new version of a tenant's script
+func (e *Engine) Set(ctx context.Context, tenantID string, script Script) (Script, error) {
+	p, err := compile(script)
+	if err != nil {
+		return Script{}, err
+	}
+
+	err = e.update(ctx, func(versions map[string][]Script) {
+		history := versions[tenantID]
+		p.script.Version = 1
+		if n := len(history); n > 0 {
+			p.script.Version = history[n-1].Version + 1
+		}
+		p.script.UpdatedAt = time.Now().UTC()
+
+		history = append(history, p.script)
+		if len(history) > MaxVersions {
+			history = history[len(history)-MaxVersions:]
+		}
+		versions[tenantID] = history
+	}, func() {
+		e.active[tenantID] = &active{program: p}
+	})
+	if err != nil {
+		return Script{}, err
+	}
+	return p.script, nil
+}
+
+// Rollback activates a copy of an earlier version as the newest version
+func (e *Engine) Rollback(ctx context.Context, tenantID string, version int) (Script, error) {
+	e.mu.RLock()
+	var found *Script
+	for _, s := range e.versions[tenantID] {
+		if s.Version == version {
+			s := s
+			found = &s
+			break
+		}
+	}
+	e.mu.RUnlock()
+
+	if found == nil {
+		return Script{}, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	return e.Set(ctx, tenantID, Script{Filter: found.Filter, Transform: found.Transform})
+}
+
+// Delete removes a tenant's script and its history
+func (e *Engine) Delete(ctx context.Context, tenantID string) error {
+	return e.update(ctx, func(versions map[string][]Script) {
+		delete(versions, tenantID)
+	}, nil)
+}
+
+// update applies change to the latest versions, in the store when there is
+// one, then activates them. activate, if set, runs first under the lock.
+func (e *Engine) update(ctx context.Context, change func(map[string][]Script), activate func()) error {
+	e.writing.Lock()
+	defer e.writing.Unlock()
+
+	apply := func(data []byte) (map[string][]Script, error) {
+		current := make(map[string][]Script)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse scripts: %w", err)
+			}
+		} else {
+			e.mu.RLock()
+			for tenantID, history := range e.versions {
+				current[tenantID] = append([]Script{}, history...)
+			}
+			e.mu.RUnlock()
+		}
+		change(current)
+		return current, nil
+	}
+
+	var versions map[string][]Script
+	if e.shared == nil {
+		var err error
+		if versions, err = apply(nil); err != nil {
+			return err
+		}
+	} else {
+		// Applied to the stored versions, again if another node changed
+		// them meanwhile, so every tenant's change is kept
+		err := e.shared.Update(ctx, func(data []byte) ([]byte, error) {
+			var err error
+			if versions, err = apply(data); err != nil {
+				return nil, err
+			}
+			return json.Marshal(versions)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if activate != nil {
+		activate()
+	}
+	e.replace(versions)
+	return nil
+}
+
+// Load replaces the in-memory versions with those in the store. Scripts whose
+// current version is unchanged keep their violation state; scripts that fail
+// to compile keep running their last good version.
+func (e *Engine) Load(ctx context.Context) error {
+	if e.shared == nil {
+		return nil
+	}
+
+	data, err := e.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		// Nothing stored keeps the scripts set here, as a store that keeps
+		// nothing would drop them
+		return err
+	}
+
+	versions := make(map[string][]Script)
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return fmt.Errorf("parse scripts: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.replace(versions)
+	return nil
+}
+
+// replace swaps in versions and compiles the current version of each tenant
+// whose script changed. The caller holds e.mu.
+func (e *Engine) replace(versions map[string][]Script) {
+	log := logger.WithComponent("scripting")
+
+	next := make(map[string]*active, len(versions))
+	for tenantID, history := range versions {
+		if len(history) == 0 {
+			continue
+		}
+		current := history[len(history)-1]
+
+		if a := e.active[tenantID]; a != nil && a.script.Version == current.Version {
+			next[tenantID] = a
+			continue
+		}
+
+		p, err := compile(current)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("tenant_id", tenantID).
+				Int("version", current.Version).
+				Msg("failed to compile tenant script, keeping previous version")
+			if a := e.active[tenantID]; a != nil {
+				next[tenantID] = a
+			}
+			continue
+		}
+		next[tenantID] = &active{program: p}
+	}
+
+	e.versions = versions
+	e.active = next
+}
+
+// Run reloads scripts periodically so changes made on other nodes propagate
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("scripting")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload tenant scripts")
+			}
+		}
+	}
+}
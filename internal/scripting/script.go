@@ -0,0 +1,195 @@
+package scripting
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"parsec/pkg/models"
+)
+
+// Script validation errors
+var (
+	ErrEmptyScript    = errors.New("script requires a filter or transform expression")
+	ErrCompile        = errors.New("script does not compile")
+	ErrScriptTooLarge = errors.New("script source too large")
+	ErrInvalidResult  = errors.New("transform must return a map of field updates")
+	ErrUnknownField   = errors.New("transform sets an unknown field")
+)
+
+// MaxSourceBytes bounds the size of each expression
+const MaxSourceBytes = 4096
+
+// MaxNodes bounds the compiled size of each expression
+const MaxNodes = 1000
+
+// Script is a tenant's filter and transform expressions (expr-lang syntax).
+//
+// Filter must evaluate to a bool; events for which it is false are dropped.
+// Transform must evaluate to a map of field updates, e.g.
+//
+//	{"severity": "ERROR", "metadata.team": "payments"}
+//
+// Settable fields are message, severity, source, trace_id, span_id and
+// metadata.<key>; a nil metadata value removes the key.
+type Script struct {
+	Version   int       `json:"version"`
+	Filter    string    `json:"filter,omitempty"`
+	Transform string    `json:"transform,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Env is the event as seen by expressions
+type Env struct {
+	ID        string         `expr:"id"`
+	TenantID  string         `expr:"tenant_id"`
+	Timestamp time.Time      `expr:"timestamp"`
+	Severity  string         `expr:"severity"`
+	Source    string         `expr:"source"`
+	Message   string         `expr:"message"`
+	Metadata  map[string]any `expr:"metadata"`
+	TraceID   string         `expr:"trace_id"`
+	SpanID    string         `expr:"span_id"`
+}
+
+// newEnv copies the event's fields into an expression environment
+func newEnv(e *models.LogEvent) Env {
+	metadata := map[string]any(e.Metadata)
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	return Env{
+		ID:        e.ID,
+		TenantID:  e.TenantID,
+		Timestamp: e.Timestamp,
+		Severity:  string(e.Severity),
+		Source:    e.Source,
+		Message:   e.Message,
+		Metadata:  metadata,
+		TraceID:   e.TraceID,
+		SpanID:    e.SpanID,
+	}
+}
+
+// program is a compiled script
+type program struct {
+	script    Script
+	filter    *vm.Program
+	transform *vm.Program
+}
+
+// compile validates and compiles a script
+func compile(s Script) (*program, error) {
+	if strings.TrimSpace(s.Filter) == "" && strings.TrimSpace(s.Transform) == "" {
+		return nil, ErrEmptyScript
+	}
+	if len(s.Filter) > MaxSourceBytes || len(s.Transform) > MaxSourceBytes {
+		return nil, fmt.Errorf("%w: max %d bytes", ErrScriptTooLarge, MaxSourceBytes)
+	}
+
+	p := &program{script: s}
+	var err error
+	if strings.TrimSpace(s.Filter) != "" {
+		p.filter, err = expr.Compile(s.Filter, expr.Env(Env{}), expr.AsBool(), expr.MaxNodes(MaxNodes))
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter: %v", ErrCompile, err)
+		}
+	}
+	if strings.TrimSpace(s.Transform) != "" {
+		p.transform, err = expr.Compile(s.Transform, expr.Env(Env{}), expr.MaxNodes(MaxNodes))
+		if err != nil {
+			return nil, fmt.Errorf("%w: transform: %v", ErrCompile, err)
+		}
+	}
+	return p, nil
+}
+
+// run evaluates the script against the event. It reports whether the event
+// is kept and whether it was modified. The event is only modified if every
+// expression succeeds.
+func (p *program) run(e *models.LogEvent, memoryBudget uint) (keep, changed bool, err error) {
+	env := newEnv(e)
+	machine := vm.VM{MemoryBudget: memoryBudget}
+
+	if p.filter != nil {
+		out, err := machine.Run(p.filter, env)
+		if err != nil {
+			return true, false, fmt.Errorf("filter: %w", err)
+		}
+		if keep, _ := out.(bool); !keep {
+			return false, false, nil
+		}
+	}
+
+	if p.transform == nil {
+		return true, false, nil
+	}
+
+	out, err := machine.Run(p.transform, env)
+	if err != nil {
+		return true, false, fmt.Errorf("transform: %w", err)
+	}
+	if out == nil {
+		return true, false, nil
+	}
+	updates, ok := out.(map[string]any)
+	if !ok {
+		return true, false, fmt.Errorf("%w, got %T", ErrInvalidResult, out)
+	}
+	if err := applyUpdates(e, updates); err != nil {
+		return true, false, err
+	}
+	return true, len(updates) > 0, nil
+}
+
+// applyUpdates validates every update before writing any of them
+func applyUpdates(e *models.LogEvent, updates map[string]any) error {
+	for field := range updates {
+		switch field {
+		case "message", "severity", "source", "trace_id", "span_id":
+		default:
+			if !strings.HasPrefix(field, "metadata.") || len(field) == len("metadata.") {
+				return fmt.Errorf("%w: %q", ErrUnknownField, field)
+			}
+		}
+	}
+
+	for field, value := range updates {
+		v := ""
+		if value != nil {
+			v = fmt.Sprint(value)
+		}
+		switch field {
+		case "message":
+			e.Message = v
+		case "severity":
+			e.Severity = models.Severity(strings.ToUpper(v))
+		case "source":
+			e.Source = strings.ToLower(v)
+		case "trace_id":
+			e.TraceID = v
+		case "span_id":
+			e.SpanID = v
+		default:
+			key := strings.ToLower(strings.TrimPrefix(field, "metadata."))
+			if value == nil {
+				delete(e.Metadata, key)
+				continue
+			}
+			if e.Metadata == nil {
+				e.Metadata = make(models.Metadata)
+			}
+			// Structured values are kept; anything else is stored as text
+			if (models.Metadata{key: value}).Validate() == nil {
+				e.Metadata[key] = value
+			} else {
+				e.Metadata[key] = v
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package selfmon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Source is the source name stamped on internal log events
+const Source = "parsec"
+
+// MarkerKey is the metadata key marking events emitted by the hook, so logs
+// about handling them can be told apart
+const MarkerKey = "selfmon"
+
+// handlingKey marks contexts handling only events emitted by the hook
+type handlingKey struct{}
+
+// Emitted reports whether an envelope carries an event emitted by the hook
+func Emitted(envelope *models.Envelope) bool {
+	return envelope != nil && envelope.Event != nil &&
+		envelope.Event.TenantID == models.InternalTenantID && envelope.Event.Metadata[MarkerKey] == true
+}
+
+// Handling returns ctx marked as handling envelopes, if all of them were
+// emitted by the hook. Logs written with the marked context (via
+// zerolog's Event.Ctx) are not republished, so failing to publish internal
+// events doesn't produce more of them.
+func Handling(ctx context.Context, envelopes ...*models.Envelope) context.Context {
+	if len(envelopes) == 0 {
+		return ctx
+	}
+	for _, envelope := range envelopes {
+		if !Emitted(envelope) {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, handlingKey{}, true)
+}
+
+// handling reports whether ctx was marked by Handling
+func handling(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(handlingKey{}) != nil
+}
+
+// Config holds self-monitoring hook configuration
+type Config struct {
+	EnvelopeChan  chan<- *models.Envelope
+	NodeID        string
+	MinLevel      zerolog.Level
+	RatePerSecond int
+	DedupeWindow  time.Duration
+}
+
+// Hook is a zerolog hook that republishes Parsec's own logs as LogEvents
+// under the reserved internal tenant.
+//
+// Loop protection: the hook never blocks, ignores logs about handling its
+// own events (see Handling), rate limits its output and suppresses repeats
+// of the same message within the dedupe window. A failing pipeline
+// therefore produces a bounded trickle of internal events instead of
+// feeding on itself.
+type Hook struct {
+	envelopeChan chan<- *models.Envelope
+	nodeID       string
+	minLevel     zerolog.Level
+	dedupeWindow time.Duration
+
+	mu       sync.Mutex
+	closed   bool
+	tokens   float64
+	rate     float64
+	lastFill time.Time
+	lastSeen map[string]time.Time
+}
+
+// NewHook creates a new self-monitoring hook
+func NewHook(cfg Config) *Hook {
+	if cfg.RatePerSecond <= 0 {
+		cfg.RatePerSecond = 10
+	}
+	if cfg.MinLevel < zerolog.WarnLevel {
+		cfg.MinLevel = zerolog.WarnLevel
+	}
+
+	return &Hook{
+		envelopeChan: cfg.EnvelopeChan,
+		nodeID:       cfg.NodeID,
+		minLevel:     cfg.MinLevel,
+		dedupeWindow: cfg.DedupeWindow,
+		tokens:       float64(cfg.RatePerSecond),
+		rate:         float64(cfg.RatePerSecond),
+		lastFill:     time.Now(),
+		lastSeen:     make(map[string]time.Time),
+	}
+}
+
+// Run implements zerolog.Hook
+func (h *Hook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if level < h.minLevel || level == zerolog.NoLevel || message == "" {
+		return
+	}
+
+	// Logs about handling our own events would feed on themselves
+	if handling(e.GetCtx()) {
+		metrics.SelfMonitorEventsTotal.WithLabelValues("reentrant").Inc()
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		metrics.SelfMonitorEventsTotal.WithLabelValues("closed").Inc()
+		return
+	}
+
+	now := time.Now()
+	if h.suppressed(message, now) {
+		metrics.SelfMonitorEventsTotal.WithLabelValues("suppressed").Inc()
+		return
+	}
+
+	if !h.take(now) {
+		metrics.SelfMonitorEventsTotal.WithLabelValues("rate_limited").Inc()
+		return
+	}
+
+	event := &models.LogEvent{
+		ID:        uuid.New().String(),
+		TenantID:  models.InternalTenantID,
+		Timestamp: now.UTC(),
+		Severity:  severityFor(level),
+		Source:    Source,
+		Message:   message,
+		Metadata: models.Metadata{
+			"level":   level.String(),
+			"node":    h.nodeID,
+			MarkerKey: true,
+		},
+	}
+
+	select {
+	case h.envelopeChan <- models.NewEnvelope(event, h.nodeID):
+		metrics.SelfMonitorEventsTotal.WithLabelValues("enqueued").Inc()
+	default:
+		metrics.SelfMonitorEventsTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close stops the hook from emitting events. It must be called before the
+// envelope channel is closed.
+func (h *Hook) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+}
+
+// suppressed reports whether the message was already emitted within the
+// dedupe window, recording it otherwise
+func (h *Hook) suppressed(message string, now time.Time) bool {
+	if h.dedupeWindow <= 0 {
+		return false
+	}
+
+	if last, ok := h.lastSeen[message]; ok && now.Sub(last) < h.dedupeWindow {
+		return true
+	}
+
+	// Keep the map bounded by pruning expired entries
+	if len(h.lastSeen) >= 1024 {
+		for msg, seen := range h.lastSeen {
+			if now.Sub(seen) >= h.dedupeWindow {
+				delete(h.lastSeen, msg)
+			}
+		}
+	}
+
+	h.lastSeen[message] = now
+	return false
+}
+
+// take consumes a token from the rate limiter
+func (h *Hook) take(now time.Time) bool {
+	h.tokens += now.Sub(h.lastFill).Seconds() * h.rate
+	if h.tokens > h.rate {
+		h.tokens = h.rate
+	}
+	h.lastFill = now
+
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// severityFor maps a zerolog level to a LogEvent severity
+func severityFor(level zerolog.Level) models.Severity {
+	switch level {
+	case zerolog.WarnLevel:
+		return models.SeverityWarning
+	case zerolog.ErrorLevel:
+		return models.SeverityError
+	default:
+		return models.SeverityCritical
+	}
+}
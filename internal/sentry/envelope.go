@@ -0,0 +1,143 @@
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Item types carrying log data; other items (transactions, sessions,
+// attachments, client reports, ...) are skipped
+const (
+	ItemEvent = "event"
+	ItemLog   = "log"
+)
+
+var ErrInvalidEnvelope = errors.New("invalid sentry envelope")
+
+// Header is the envelope header line
+type Header struct {
+	EventID string `json:"event_id"`
+	DSN     string `json:"dsn"`
+	SentAt  string `json:"sent_at"`
+}
+
+// PublicKey returns the key in the header's DSN
+// (https://<key>@host/<project>), used by SDKs sending through a tunnel
+func (h Header) PublicKey() string {
+	if h.DSN == "" {
+		return ""
+	}
+	u, err := url.Parse(h.DSN)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	return u.User.Username()
+}
+
+// Item is one envelope item
+type Item struct {
+	Type    string
+	Payload []byte
+}
+
+// itemHeader is an item's header line
+type itemHeader struct {
+	Type   string `json:"type"`
+	Length *int   `json:"length"`
+}
+
+// Envelope is a parsed Sentry envelope
+// (https://develop.sentry.dev/sdk/envelopes/)
+type Envelope struct {
+	Header Header
+	Items  []Item
+}
+
+// ParseEnvelope splits an envelope into its header and items. Each item's
+// payload runs for the length in its header or, without one, to the end
+// of the line.
+func ParseEnvelope(body []byte) (*Envelope, error) {
+	line, rest := nextLine(body)
+	env := &Envelope{}
+	if err := json.Unmarshal(line, &env.Header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidEnvelope, err)
+	}
+
+	for n := 1; len(bytes.TrimSpace(rest)) > 0; n++ {
+		line, rest = nextLine(rest)
+		var header itemHeader
+		if err := json.Unmarshal(line, &header); err != nil {
+			return nil, fmt.Errorf("%w: item %d header: %v", ErrInvalidEnvelope, n, err)
+		}
+		if header.Type == "" {
+			return nil, fmt.Errorf("%w: item %d has no type", ErrInvalidEnvelope, n)
+		}
+
+		var payload []byte
+		if header.Length != nil {
+			length := *header.Length
+			if length < 0 || length > len(rest) {
+				return nil, fmt.Errorf("%w: item %d length %d exceeds the envelope", ErrInvalidEnvelope, n, length)
+			}
+			payload, rest = rest[:length], rest[length:]
+			rest = bytes.TrimPrefix(rest, []byte("\n"))
+		} else {
+			payload, rest = nextLine(rest)
+		}
+		env.Items = append(env.Items, Item{Type: header.Type, Payload: payload})
+	}
+	return env, nil
+}
+
+// nextLine splits off the first line, without its newline
+func nextLine(b []byte) (line, rest []byte) {
+	line, rest, _ = bytes.Cut(b, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), rest
+}
+
+// Project is a Sentry project accepted by Parsec: the tenant its events
+// belong to and the DSN public key SDKs must send
+type Project struct {
+	Tenant string
+	Key    string
+}
+
+// ParseProjects parses "project=tenant:key,..." entries, where project is
+// the numeric ID at the end of the DSN and key its public key
+func ParseProjects(s string) (map[string]Project, error) {
+	projects := make(map[string]Project)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, value, ok := strings.Cut(entry, "=")
+		tenant, key, hasKey := strings.Cut(value, ":")
+		id, tenant, key = strings.TrimSpace(id), strings.TrimSpace(tenant), strings.TrimSpace(key)
+		if !ok || !hasKey || id == "" || tenant == "" || key == "" {
+			return nil, errors.New("sentry project must be project=tenant:key: " + entry)
+		}
+		projects[id] = Project{Tenant: tenant, Key: key}
+	}
+	return projects, nil
+}
+
+// AuthKey returns the public key from an X-Sentry-Auth header
+// ("Sentry sentry_key=<key>, sentry_version=7, ...")
+func AuthKey(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) >= 7 && strings.EqualFold(header[:7], "sentry ") {
+		header = header[7:]
+	}
+	for _, field := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		if name == "sentry_key" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,407 @@
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/pkg/models"
+)
+
+// Source is the source of events that don't name a logger
+const Source = "sentry"
+
+// maxFrames bounds the stack frames rendered into a message per exception
+const maxFrames = 50
+
+// Event is the subset of the Sentry event payload
+// (https://develop.sentry.dev/sdk/event-payloads/) that Parsec keeps
+type Event struct {
+	EventID     string                         `json:"event_id"`
+	Timestamp   Timestamp                      `json:"timestamp"`
+	Level       string                         `json:"level"`
+	Logger      string                         `json:"logger"`
+	Platform    string                         `json:"platform"`
+	ServerName  string                         `json:"server_name"`
+	Release     string                         `json:"release"`
+	Environment string                         `json:"environment"`
+	Transaction string                         `json:"transaction"`
+	Message     Message                        `json:"message"`
+	LogEntry    Message                        `json:"logentry"`
+	Exception   Exceptions                     `json:"exception"`
+	Tags        Tags                           `json:"tags"`
+	User        map[string]any                 `json:"user"`
+	Extra       map[string]any                 `json:"extra"`
+	Contexts    eventContexts                  `json:"contexts"`
+	SDK         struct{ Name, Version string } `json:"sdk"`
+}
+
+// eventContexts holds the contexts Parsec reads
+type eventContexts struct {
+	Trace struct {
+		TraceID string `json:"trace_id"`
+		SpanID  string `json:"span_id"`
+	} `json:"trace"`
+}
+
+// Timestamp is a Sentry timestamp: Unix seconds or an RFC 3339 string
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON accepts both forms
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		ts, err := models.ParseTimestamp(s)
+		if err != nil {
+			return err
+		}
+		t.Time = ts
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s", data)
+	}
+	whole, frac := math.Modf(seconds)
+	t.Time = time.Unix(int64(whole), int64(frac*1e9)).UTC()
+	return nil
+}
+
+// Message is a message string or a logentry object; the formatted text is
+// preferred over the format string
+type Message struct {
+	Text string
+}
+
+// UnmarshalJSON accepts both forms
+func (m *Message) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &m.Text)
+	}
+	var entry struct {
+		Formatted string `json:"formatted"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	m.Text = entry.Formatted
+	if m.Text == "" {
+		m.Text = entry.Message
+	}
+	return nil
+}
+
+// Exception is one exception of an event
+type Exception struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Module     string `json:"module"`
+	Stacktrace struct {
+		Frames []Frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// Frame is a stack frame; Sentry lists frames oldest first
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	Colno    int    `json:"colno"`
+}
+
+// Exceptions is an event's exceptions, as {"values": [...]} or a bare
+// array. Chained exceptions are listed cause first.
+type Exceptions []Exception
+
+// UnmarshalJSON accepts both forms
+func (e *Exceptions) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]Exception)(e))
+	}
+	var values struct {
+		Values []Exception `json:"values"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*e = values.Values
+	return nil
+}
+
+// Tags is an event's tags, as an object or an array of [key, value] pairs
+type Tags map[string]string
+
+// UnmarshalJSON accepts both forms
+func (t *Tags) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		var pairs [][2]any
+		if err := json.Unmarshal(data, &pairs); err != nil {
+			return err
+		}
+		*t = make(Tags, len(pairs))
+		for _, pair := range pairs {
+			(*t)[tagString(pair[0])] = tagString(pair[1])
+		}
+		return nil
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	*t = make(Tags, len(values))
+	for k, v := range values {
+		(*t)[k] = tagString(v)
+	}
+	return nil
+}
+
+// tagString renders a tag key or value; SDKs send strings, but numbers and
+// bools turn up too
+func tagString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ParseEvent decodes an event item's payload
+func ParseEvent(payload []byte) (*Event, error) {
+	event := new(Event)
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("invalid sentry event: %w", err)
+	}
+	return event, nil
+}
+
+// LogEvent converts the event. The message is the log message or, for
+// errors, the exception and its stack trace (most recent call first); the
+// logger becomes the source, and tags, release, environment, user and the
+// like become metadata. fallbackID and sentAt, from the envelope header,
+// stand in for a missing event ID and timestamp.
+func (e *Event) LogEvent(tenant, fallbackID string, sentAt time.Time) *models.LogEvent {
+	event := &models.LogEvent{
+		ID:        e.EventID,
+		TenantID:  tenant,
+		Timestamp: e.Timestamp.Time,
+		Severity:  Severity(e.Level),
+		Source:    e.Logger,
+		Message:   e.message(),
+		Metadata:  make(models.Metadata),
+		TraceID:   e.Contexts.Trace.TraceID,
+		SpanID:    e.Contexts.Trace.SpanID,
+	}
+	if event.ID == "" {
+		event.ID = fallbackID
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = sentAt
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Source == "" {
+		event.Source = Source
+	}
+
+	for key, value := range map[string]string{
+		"platform":    e.Platform,
+		"server_name": e.ServerName,
+		"release":     e.Release,
+		"environment": e.Environment,
+		"transaction": e.Transaction,
+	} {
+		if value != "" {
+			event.Metadata[key] = value
+		}
+	}
+	if len(e.Tags) > 0 {
+		tags := make(map[string]any, len(e.Tags))
+		for k, v := range e.Tags {
+			tags[k] = v
+		}
+		event.Metadata["tags"] = tags
+	}
+	if len(e.User) > 0 {
+		event.Metadata["user"] = e.User
+	}
+	if len(e.Extra) > 0 {
+		event.Metadata["extra"] = e.Extra
+	}
+	if n := len(e.Exception); n > 0 {
+		event.Metadata["exception_type"] = e.Exception[n-1].Type
+	}
+	if e.SDK.Name != "" {
+		event.Metadata["sdk"] = strings.TrimSuffix(e.SDK.Name+"/"+e.SDK.Version, "/")
+	}
+	return event
+}
+
+// message renders the log message and exceptions
+func (e *Event) message() string {
+	var b strings.Builder
+	text := e.LogEntry.Text
+	if text == "" {
+		text = e.Message.Text
+	}
+	b.WriteString(text)
+
+	// The last exception is the one raised; earlier ones caused it
+	for i := len(e.Exception) - 1; i >= 0; i-- {
+		exc := e.Exception[i]
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		if i < len(e.Exception)-1 {
+			b.WriteString("Caused by: ")
+		}
+		b.WriteString(exc.Type)
+		if exc.Value != "" {
+			if exc.Type != "" {
+				b.WriteString(": ")
+			}
+			b.WriteString(exc.Value)
+		}
+
+		frames := exc.Stacktrace.Frames
+		for j := len(frames) - 1; j >= 0 && j >= len(frames)-maxFrames; j-- {
+			b.WriteString("\n    at ")
+			writeFrame(&b, frames[j])
+		}
+	}
+	return b.String()
+}
+
+// writeFrame renders a frame as "function (file:line:column)"
+func writeFrame(b *strings.Builder, f Frame) {
+	function := f.Function
+	if function == "" {
+		function = f.Module
+	}
+	file := f.Filename
+	if file == "" {
+		file = f.AbsPath
+	}
+	if function != "" {
+		b.WriteString(function)
+		b.WriteString(" (")
+	}
+	b.WriteString(file)
+	if f.Lineno > 0 {
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Lineno))
+		if f.Colno > 0 {
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(f.Colno))
+		}
+	}
+	if function != "" {
+		b.WriteByte(')')
+	}
+}
+
+// Severity maps a Sentry level. Events without one are errors, as in Sentry.
+func Severity(level string) models.Severity {
+	switch strings.ToLower(level) {
+	case "fatal":
+		return models.SeverityCritical
+	case "warning", "warn":
+		return models.SeverityWarning
+	case "info", "log":
+		return models.SeverityInfo
+	case "debug", "trace":
+		return models.SeverityDebug
+	default:
+		return models.SeverityError
+	}
+}
+
+// logItems is the payload of a log item
+type logItems struct {
+	Items []LogRecord `json:"items"`
+}
+
+// LogRecord is one record of a log item, sent by SDKs with logging enabled
+// (https://develop.sentry.dev/sdk/telemetry/logs/)
+type LogRecord struct {
+	Timestamp  Timestamp                  `json:"timestamp"`
+	TraceID    string                     `json:"trace_id"`
+	Level      string                     `json:"level"`
+	Body       string                     `json:"body"`
+	Attributes map[string]json.RawMessage `json:"attributes"`
+}
+
+// ParseLogs decodes a log item's payload
+func ParseLogs(payload []byte) ([]LogRecord, error) {
+	var logs logItems
+	if err := json.Unmarshal(payload, &logs); err != nil {
+		return nil, fmt.Errorf("invalid sentry logs: %w", err)
+	}
+	return logs.Items, nil
+}
+
+// LogEvent converts the record. Attributes ({"value": ..., "type": ...})
+// become metadata; sentry.release and sentry.environment are renamed like
+// an event's release and environment.
+func (l *LogRecord) LogEvent(tenant string, sentAt time.Time) *models.LogEvent {
+	event := &models.LogEvent{
+		ID:        uuid.NewString(),
+		TenantID:  tenant,
+		Timestamp: l.Timestamp.Time,
+		Severity:  Severity(l.Level),
+		Source:    Source,
+		Message:   l.Body,
+		Metadata:  make(models.Metadata, len(l.Attributes)),
+		TraceID:   l.TraceID,
+	}
+	if l.Level == "" {
+		event.Severity = models.SeverityInfo
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = sentAt
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	for key, raw := range l.Attributes {
+		var attr struct {
+			Value any `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &attr); err != nil || attr.Value == nil {
+			continue
+		}
+		switch key {
+		case "sentry.release":
+			key = "release"
+		case "sentry.environment":
+			key = "environment"
+		}
+		event.Metadata[key] = attr.Value
+	}
+	return event
+}
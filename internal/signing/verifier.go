@@ -0,0 +1,113 @@
+package signing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"parsec/internal/state"
+)
+
+// Request headers carrying the signature
+const (
+	HeaderTimestamp = "X-Parsec-Timestamp"
+	HeaderNonce     = "X-Parsec-Nonce"
+	HeaderSignature = "X-Parsec-Signature"
+)
+
+// signaturePrefix identifies the algorithm in HeaderSignature
+const signaturePrefix = "sha256="
+
+// keyPrefix namespaces seen signatures in the StateStore
+const keyPrefix = "parsec:replay:"
+
+// Verification errors
+var (
+	ErrMissingSignature = errors.New("missing signature headers")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("signature timestamp outside allowed window")
+	ErrReplayed         = errors.New("request already seen")
+)
+
+// Config holds signature verification settings
+type Config struct {
+	// Secret is the shared HMAC key
+	Secret string
+
+	// MaxSkew is how far the signed timestamp may be from the server clock
+	MaxSkew time.Duration
+}
+
+// Verifier checks HMAC-SHA256 request signatures and rejects replays by
+// remembering each signature for as long as its timestamp stays valid
+type Verifier struct {
+	secret  []byte
+	maxSkew time.Duration
+	store   state.StateStore
+}
+
+// NewVerifier creates a verifier, or returns nil if no secret is configured
+func NewVerifier(store state.StateStore, cfg Config) *Verifier {
+	if cfg.Secret == "" {
+		return nil
+	}
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = 5 * time.Minute
+	}
+	return &Verifier{
+		secret:  []byte(cfg.Secret),
+		maxSkew: cfg.MaxSkew,
+		store:   store,
+	}
+}
+
+// Sign returns the signature header value for a request:
+// sha256=hex(HMAC-SHA256(secret, timestamp + "." + nonce + "." + body))
+func Sign(secret []byte, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and records it so the same request is
+// rejected if seen again within the allowed window
+func (v *Verifier) Verify(ctx context.Context, timestamp, nonce, signature string, body []byte) error {
+	if timestamp == "" || nonce == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidSignature)
+	}
+	skew := time.Since(time.Unix(secs, 0))
+	if skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrExpired
+	}
+
+	expected := Sign(v.secret, timestamp, nonce, body)
+	if !strings.HasPrefix(signature, signaturePrefix) || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	// The signature is only valid while the timestamp is within the skew on
+	// either side, so remembering it for twice the skew covers every replay
+	fresh, err := v.store.SetNX(ctx, keyPrefix+strings.TrimPrefix(signature, signaturePrefix), []byte(nonce), 2*v.maxSkew)
+	if err != nil {
+		return fmt.Errorf("record signature: %w", err)
+	}
+	if !fresh {
+		return ErrReplayed
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package slo
+
+import "time"
+
+// bucket counts the events of one slot of a series
+type bucket struct {
+	slot        int64
+	good, total uint64
+}
+
+// series counts good and total events in fixed-resolution buckets, long
+// enough to sum any window up to len(buckets) * res
+type series struct {
+	res     time.Duration
+	buckets []bucket
+}
+
+// newSeries creates a series covering span at resolution res
+func newSeries(res, span time.Duration) *series {
+	n := int(span / res)
+	if n < 1 {
+		n = 1
+	}
+	return &series{res: res, buckets: make([]bucket, n)}
+}
+
+// add counts events at now
+func (s *series) add(now time.Time, good, total uint64) {
+	slot := now.UnixNano() / int64(s.res)
+	b := &s.buckets[slot%int64(len(s.buckets))]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+	b.good += good
+	b.total += total
+}
+
+// sum totals the events of the window ending at now. The window is
+// rounded up to whole buckets, so the current bucket always counts.
+func (s *series) sum(now time.Time, window time.Duration) (good, total uint64) {
+	last := now.UnixNano() / int64(s.res)
+	n := int64((window + s.res - 1) / s.res)
+	if n > int64(len(s.buckets)) {
+		n = int64(len(s.buckets))
+	}
+	for slot := last - n + 1; slot <= last; slot++ {
+		b := s.buckets[slot%int64(len(s.buckets))]
+		if b.slot == slot {
+			good += b.good
+			total += b.total
+		}
+	}
+	return good, total
+}
@@ -0,0 +1,392 @@
+// Package slo tracks the processor's service level objectives: the share
+// of ingest requests served without a server error, and the share of
+// events published within a latency threshold of being received. Each
+// objective has an error budget over a rolling window; how fast recent
+// failures spend it is reported as burn rates, which can raise alerts.
+// Tracking is per node.
+package slo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/alerts"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Objective names
+const (
+	Availability   = "ingest_availability"
+	PublishLatency = "publish_latency"
+)
+
+// AlertSource is the source of SLO alert events
+const AlertSource = "parsec-slo"
+
+// Alert levels, recorded in the slo_alert metadata key. A fast burn spends
+// the whole budget in days, a slow burn in about a week.
+const (
+	AlertFastBurn  = "fast_burn"
+	AlertSlowBurn  = "slow_burn"
+	AlertRecovered = "recovered"
+)
+
+// burnWindow is a window burn rates are reported over
+type burnWindow struct {
+	name string
+	d    time.Duration
+}
+
+// BurnWindows are reported in /slo and the burn rate gauge. Fast burn
+// alerts need both the 1h and 5m rates over the threshold, slow burn ones
+// the 6h and 30m rates, so an alert clears soon after the burn stops.
+var BurnWindows = []burnWindow{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// Config holds SLO targets and alert thresholds
+type Config struct {
+	// AvailabilityTarget is the share of ingest requests to serve without
+	// a 5xx response (0 = 0.999)
+	AvailabilityTarget float64
+
+	// LatencyTarget is the share of events to publish within
+	// LatencyThreshold of being received (0 = 0.99)
+	LatencyTarget    float64
+	LatencyThreshold time.Duration // 0 = 1s
+
+	// Window is the rolling window error budgets cover (0 = 30 days)
+	Window time.Duration
+
+	// FastBurn and SlowBurn are the burn rates that raise alerts
+	// (0 = 14.4 and 6)
+	FastBurn float64
+	SlowBurn float64
+
+	// AlertTenant receives alert events
+	AlertTenant string
+}
+
+// objective is one SLO with its counts at minute resolution for burn
+// rates and hour resolution for the budget
+type objective struct {
+	name    string
+	target  float64
+	minutes *series
+	hours   *series
+	alert   string
+}
+
+// Status reports an objective
+type Status struct {
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
+
+	// Good and Total count events over the window; SLI is their ratio
+	// (1 without events)
+	Good  uint64  `json:"good"`
+	Total uint64  `json:"total"`
+	SLI   float64 `json:"sli"`
+
+	// BudgetRemaining is the share of the window's error budget left;
+	// negative once it is overspent
+	BudgetRemaining float64 `json:"error_budget_remaining"`
+
+	// BurnRates is how many times faster than sustainable the budget was
+	// spent over each of BurnWindows
+	BurnRates map[string]float64 `json:"burn_rates"`
+
+	// Alert is the open alert level, if any
+	Alert string `json:"alert,omitempty"`
+}
+
+// Snapshot reports every objective
+type Snapshot struct {
+	Window           string   `json:"window"`
+	LatencyThreshold string   `json:"latency_threshold"`
+	Objectives       []Status `json:"objectives"`
+}
+
+// Tracker records events against the objectives
+type Tracker struct {
+	cfg Config
+
+	mu           sync.Mutex
+	availability *objective
+	latency      *objective
+}
+
+// NewTracker creates a tracker
+func NewTracker(cfg Config) *Tracker {
+	if cfg.AvailabilityTarget <= 0 || cfg.AvailabilityTarget >= 1 {
+		cfg.AvailabilityTarget = 0.999
+	}
+	if cfg.LatencyTarget <= 0 || cfg.LatencyTarget >= 1 {
+		cfg.LatencyTarget = 0.99
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = time.Second
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * 24 * time.Hour
+	}
+	if cfg.FastBurn <= 0 {
+		cfg.FastBurn = 14.4
+	}
+	if cfg.SlowBurn <= 0 {
+		cfg.SlowBurn = 6
+	}
+
+	return &Tracker{
+		cfg:          cfg,
+		availability: newObjective(Availability, cfg.AvailabilityTarget, cfg.Window),
+		latency:      newObjective(PublishLatency, cfg.LatencyTarget, cfg.Window),
+	}
+}
+
+// newObjective creates an objective with series long enough for the
+// longest burn window and the budget window
+func newObjective(name string, target float64, window time.Duration) *objective {
+	return &objective{
+		name:    name,
+		target:  target,
+		minutes: newSeries(time.Minute, BurnWindows[len(BurnWindows)-1].d),
+		hours:   newSeries(time.Hour, window),
+	}
+}
+
+// record counts events against an objective
+func (t *Tracker) record(o *objective, now time.Time, good, total uint64) {
+	if total == 0 {
+		return
+	}
+	t.mu.Lock()
+	o.minutes.add(now, good, total)
+	o.hours.add(now, good, total)
+	t.mu.Unlock()
+
+	metrics.SLOEvents.WithLabelValues(o.name, "good").Add(float64(good))
+	metrics.SLOEvents.WithLabelValues(o.name, "bad").Add(float64(total - good))
+}
+
+// RecordRequest counts an ingest response; server errors are bad
+func (t *Tracker) RecordRequest(status int) {
+	var good uint64
+	if status < 500 {
+		good = 1
+	}
+	t.record(t.availability, time.Now(), good, 1)
+}
+
+// RecordPublish counts published and failed envelopes. Published ones
+// are good if they were received within the latency threshold; failed
+// ones are always bad.
+func (t *Tracker) RecordPublish(published, failed []*models.Envelope) {
+	now := time.Now()
+	var good uint64
+	for _, envelope := range published {
+		if now.Sub(envelope.ReceivedAt) <= t.cfg.LatencyThreshold {
+			good++
+		}
+	}
+	t.record(t.latency, now, good, uint64(len(published)+len(failed)))
+}
+
+// statusWriter records the status a handler responds with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware counts the responses of the routes it wraps against the
+// availability objective
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// A panic is answered with a 500 by the recovery middleware
+			if v := recover(); v != nil {
+				t.RecordRequest(http.StatusInternalServerError)
+				panic(v)
+			}
+			t.RecordRequest(sw.status)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// burn is how many times faster than sustainable an objective's budget
+// was spent over a window
+func (o *objective) burn(now time.Time, window time.Duration) float64 {
+	good, total := o.minutes.sum(now, window)
+	if total == 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / (1 - o.target)
+}
+
+// status reports an objective; the caller holds mu
+func (o *objective) status(now time.Time, window time.Duration) Status {
+	s := Status{
+		Name:            o.name,
+		Target:          o.target,
+		SLI:             1,
+		BudgetRemaining: 1,
+		BurnRates:       make(map[string]float64, len(BurnWindows)),
+		Alert:           o.alert,
+	}
+	s.Good, s.Total = o.hours.sum(now, window)
+	if s.Total > 0 {
+		s.SLI = float64(s.Good) / float64(s.Total)
+		s.BudgetRemaining = 1 - (1-s.SLI)/(1-o.target)
+	}
+	for _, w := range BurnWindows {
+		s.BurnRates[w.name] = o.burn(now, w.d)
+	}
+	return s
+}
+
+// Snapshot reports the objectives at now
+func (t *Tracker) Snapshot(now time.Time) Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Snapshot{
+		Window:           t.cfg.Window.String(),
+		LatencyThreshold: t.cfg.LatencyThreshold.String(),
+		Objectives: []Status{
+			t.availability.status(now, t.cfg.Window),
+			t.latency.status(now, t.cfg.Window),
+		},
+	}
+}
+
+// Run updates the SLO gauges every interval until ctx is cancelled. With
+// an engine, it also evaluates burn rates and passes alert events to emit.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration, engine alerts.AlertEngine, emit func(*models.LogEvent)) {
+	log := logger.WithComponent("slo")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Check(ctx, time.Now(), engine, emit); err != nil {
+				log.Warn().Err(err).Msg("slo check failed")
+			}
+		}
+	}
+}
+
+// Check updates the gauges and, with an engine, raises or resolves alerts
+// at now
+func (t *Tracker) Check(ctx context.Context, now time.Time, engine alerts.AlertEngine, emit func(*models.LogEvent)) error {
+	snapshot := t.Snapshot(now)
+	for _, s := range snapshot.Objectives {
+		metrics.SLOBudgetRemaining.WithLabelValues(s.Name).Set(s.BudgetRemaining)
+		for _, w := range BurnWindows {
+			metrics.SLOBurnRate.WithLabelValues(s.Name, w.name).Set(s.BurnRates[w.name])
+		}
+	}
+	if engine == nil {
+		return nil
+	}
+
+	for i, o := range []*objective{t.availability, t.latency} {
+		level, err := t.level(ctx, engine, snapshot.Objectives[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", o.name, err)
+		}
+
+		t.mu.Lock()
+		previous := o.alert
+		o.alert = level
+		t.mu.Unlock()
+
+		switch {
+		case level == previous:
+		case level == AlertFastBurn || (level == AlertSlowBurn && previous == ""):
+			emit(t.alertEvent(snapshot.Objectives[i], level, now))
+		case level == "":
+			emit(t.alertEvent(snapshot.Objectives[i], AlertRecovered, now))
+		}
+	}
+	return nil
+}
+
+// level has the engine evaluate an objective's burn rates, returning the
+// alert level they call for ("" for none)
+func (t *Tracker) level(ctx context.Context, engine alerts.AlertEngine, s Status) (string, error) {
+	for _, check := range []struct {
+		level      string
+		threshold  float64
+		long, fast string
+	}{
+		{AlertFastBurn, t.cfg.FastBurn, "1h", "5m"},
+		{AlertSlowBurn, t.cfg.SlowBurn, "6h", "30m"},
+	} {
+		burn := min(s.BurnRates[check.long], s.BurnRates[check.fast])
+		firing, err := engine.Evaluate(ctx, alerts.Rule{Name: s.Name + "_" + check.level, Threshold: check.threshold}, burn)
+		if err != nil || firing {
+			return check.level, err
+		}
+	}
+	return "", nil
+}
+
+// alertEvent builds an alert event in the alert tenant
+func (t *Tracker) alertEvent(s Status, level string, now time.Time) *models.LogEvent {
+	severity := models.SeverityInfo
+	message := fmt.Sprintf("%s is no longer burning its error budget", s.Name)
+	switch level {
+	case AlertFastBurn:
+		severity = models.SeverityCritical
+		message = fmt.Sprintf("%s is burning its error budget %.1fx too fast over the last hour", s.Name, s.BurnRates["1h"])
+	case AlertSlowBurn:
+		severity = models.SeverityWarning
+		message = fmt.Sprintf("%s is burning its error budget %.1fx too fast over the last 6 hours", s.Name, s.BurnRates["6h"])
+	}
+
+	metrics.SLOAlerts.WithLabelValues(s.Name, level).Inc()
+	return &models.LogEvent{
+		ID:        uuid.NewString(),
+		TenantID:  t.cfg.AlertTenant,
+		Timestamp: now.UTC(),
+		Severity:  severity,
+		Source:    AlertSource,
+		Message:   message,
+		Metadata: models.Metadata{
+			"slo":                    s.Name,
+			"slo_alert":              level,
+			"slo_target":             s.Target,
+			"burn_rate_1h":           s.BurnRates["1h"],
+			"burn_rate_6h":           s.BurnRates["6h"],
+			"error_budget_remaining": s.BudgetRemaining,
+		},
+	}
+}
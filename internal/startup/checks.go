@@ -0,0 +1,59 @@
+package startup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+
+	"parsec/internal/objstore"
+)
+
+// probeKey is opened to check a bucket; it is not expected to exist
+const probeKey = ".parsec-startup-probe"
+
+// RedisCheck checks that a Redis server answers PING at addr. Any reply,
+// including an authentication error, means the server is up.
+func RedisCheck(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+			return err
+		}
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if len(reply) == 0 || (reply[0] != '+' && reply[0] != '-') {
+			return fmt.Errorf("unexpected reply %q", reply)
+		}
+		return nil
+	}
+}
+
+// StorageCheck checks that a bucket answers requests under prefix, by
+// opening a key that should not exist
+func StorageCheck(bucket objstore.Store, prefix string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		r, err := bucket.Open(ctx, path.Join(prefix, probeKey))
+		if err == nil {
+			r.Close()
+			return nil
+		}
+		if errors.Is(err, objstore.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,157 @@
+// Package startup gates processor startup on its dependencies being
+// reachable, so a cold-starting cluster doesn't see requests rejected (and
+// envelopes dead-lettered) while Kafka, Redis or storage are still coming up.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// Dependency names
+const (
+	DependencyKafka   = "kafka"
+	DependencyRedis   = "redis"
+	DependencyStorage = "storage"
+)
+
+// defaultBackoff is the first delay when Config.InitialBackoff is unset
+const defaultBackoff = 500 * time.Millisecond
+
+// ErrTimeout is returned when dependencies are still unreachable after the
+// maximum wait
+var ErrTimeout = errors.New("dependencies not reachable")
+
+// Dependency is something the processor needs before it reports ready
+type Dependency struct {
+	Name string
+
+	// Check returns nil once the dependency is reachable
+	Check func(ctx context.Context) error
+}
+
+// Config bounds the wait
+type Config struct {
+	// MaxWait is how long to wait for all dependencies (0 = forever)
+	MaxWait time.Duration
+
+	// InitialBackoff is the delay after the first failed check, doubled
+	// after each further failure up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// CheckTimeout bounds each check
+	CheckTimeout time.Duration
+}
+
+// ParseDependencies parses a comma-separated list of dependency names
+func ParseDependencies(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case DependencyKafka, DependencyRedis, DependencyStorage:
+			names = append(names, name)
+		default:
+			return nil, fmt.Errorf("unknown startup dependency %q (want kafka, redis or storage)", name)
+		}
+	}
+	return names, nil
+}
+
+// Wait checks deps until all are reachable, backing off between rounds.
+// Reachable dependencies are not checked again. It returns ErrTimeout,
+// naming the unreachable dependencies, once MaxWait has passed, or the
+// context's error if it is cancelled first.
+func Wait(ctx context.Context, cfg Config, deps []Dependency) error {
+	log := logger.WithComponent("startup")
+	if len(deps) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	if cfg.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxWait)
+		defer cancel()
+	}
+
+	pending := make(map[string]Dependency, len(deps))
+	for _, dep := range deps {
+		pending[dep.Name] = dep
+		metrics.StartupDependencyReady.WithLabelValues(dep.Name).Set(0)
+	}
+
+	backoff := cfg.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		failures := make(map[string]error)
+		for name, dep := range pending {
+			if err := check(ctx, cfg.CheckTimeout, dep); err != nil {
+				failures[name] = err
+				continue
+			}
+			delete(pending, name)
+			metrics.StartupDependencyReady.WithLabelValues(name).Set(1)
+			log.Info().Str("dependency", name).Int("attempt", attempt).Dur("waited", time.Since(start)).Msg("dependency reachable")
+		}
+		if len(pending) == 0 {
+			metrics.StartupWaitSeconds.Set(time.Since(start).Seconds())
+			return nil
+		}
+
+		for name, err := range failures {
+			log.Warn().Err(err).Str("dependency", name).Int("attempt", attempt).Dur("retry_in", backoff).Msg("waiting for dependency")
+		}
+
+		select {
+		case <-ctx.Done():
+			metrics.StartupWaitSeconds.Set(time.Since(start).Seconds())
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %s", ErrTimeout, cfg.MaxWait, describe(failures))
+			}
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if cfg.MaxBackoff > 0 {
+			backoff = min(backoff, cfg.MaxBackoff)
+		}
+	}
+}
+
+// check runs one check with its own timeout
+func check(ctx context.Context, timeout time.Duration, dep Dependency) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return dep.Check(ctx)
+}
+
+// describe lists failures in name order
+func describe(failures map[string]error) string {
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + failures[name].Error()
+	}
+	return strings.Join(parts, "; ")
+}
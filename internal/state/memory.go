@@ -0,0 +1,288 @@
+package state
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryConfig holds in-memory store settings
+type MemoryConfig struct {
+	// CleanupInterval controls how often expired keys are evicted. Expired
+	// keys are never returned, so this only bounds memory.
+	CleanupInterval time.Duration
+
+	// MaxWindowEntries caps the occurrences kept per window key; the oldest
+	// are discarded first
+	MaxWindowEntries int
+}
+
+// entry is a stored value or sliding window
+type entry struct {
+	value   []byte
+	window  []int64 // occurrence times in unix nanoseconds, ascending
+	expires time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// MemoryStore is a StateStore for single-node deployments without Redis.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	maxWindow int
+
+	mu   sync.Mutex
+	data map[string]*entry
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMemoryStore creates an in-memory store and starts its eviction loop
+func NewMemoryStore(cfg MemoryConfig) *MemoryStore {
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = time.Minute
+	}
+	if cfg.MaxWindowEntries <= 0 {
+		cfg.MaxWindowEntries = 100000
+	}
+
+	s := &MemoryStore{
+		maxWindow: cfg.MaxWindowEntries,
+		data:      make(map[string]*entry),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.evictLoop(cfg.CleanupInterval)
+	return s
+}
+
+// lookup returns the live entry for key, removing it if expired. Callers
+// must hold mu.
+func (s *MemoryStore) lookup(key string, now time.Time) *entry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// Get implements StateStore
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return nil, nil
+	}
+	if e.window != nil {
+		return nil, ErrWrongType
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+// Set implements StateStore
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = &entry{value: append([]byte(nil), value...)}
+	return nil
+}
+
+// Incr implements StateStore. The TTL of an existing key is kept.
+func (s *MemoryStore) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		e = &entry{}
+		s.data[key] = e
+	}
+	if e.window != nil {
+		return 0, ErrWrongType
+	}
+
+	var current int64
+	if len(e.value) > 0 {
+		v, err := strconv.ParseInt(string(e.value), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		current = v
+	}
+
+	current += delta
+	e.value = strconv.AppendInt(e.value[:0], current, 10)
+	return current, nil
+}
+
+// Expire implements StateStore. A non-positive TTL deletes the key.
+func (s *MemoryStore) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.lookup(key, now)
+	if e == nil {
+		return false, nil
+	}
+	if ttl <= 0 {
+		delete(s.data, key)
+		return true, nil
+	}
+	e.expires = now.Add(ttl)
+	return true, nil
+}
+
+// GetSet implements StateStore
+func (s *MemoryStore) GetSet(ctx context.Context, key string, value []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var previous []byte
+	if e := s.lookup(key, time.Now()); e != nil {
+		if e.window != nil {
+			return nil, ErrWrongType
+		}
+		previous = e.value
+	}
+
+	s.data[key] = &entry{value: append([]byte(nil), value...)}
+	return previous, nil
+}
+
+// SetNX implements StateStore
+func (s *MemoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.lookup(key, now) != nil {
+		return false, nil
+	}
+
+	e := &entry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.data[key] = e
+	return true, nil
+}
+
+// WindowAdd implements StateStore. The key expires one window after its
+// latest occurrence.
+func (s *MemoryStore) WindowAdd(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		e = &entry{window: []int64{}}
+		s.data[key] = e
+	}
+	if e.window == nil {
+		return 0, ErrWrongType
+	}
+
+	// Insert in order; occurrences usually arrive in order, so this is
+	// normally an append
+	ts := at.UnixNano()
+	i := sort.Search(len(e.window), func(i int) bool { return e.window[i] > ts })
+	e.window = append(e.window, 0)
+	copy(e.window[i+1:], e.window[i:])
+	e.window[i] = ts
+
+	if over := len(e.window) - s.maxWindow; over > 0 {
+		e.window = append(e.window[:0], e.window[over:]...)
+	}
+
+	if latest := time.Unix(0, e.window[len(e.window)-1]).Add(window); latest.After(e.expires) {
+		e.expires = latest
+	}
+	return s.trim(e, at, window), nil
+}
+
+// WindowCount implements StateStore
+func (s *MemoryStore) WindowCount(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return 0, nil
+	}
+	if e.window == nil {
+		return 0, ErrWrongType
+	}
+	return s.trim(e, at, window), nil
+}
+
+// trim discards occurrences at or before at-window and counts those up to at
+func (s *MemoryStore) trim(e *entry, at time.Time, window time.Duration) int64 {
+	start := at.Add(-window).UnixNano()
+	end := at.UnixNano()
+
+	first := sort.Search(len(e.window), func(i int) bool { return e.window[i] > start })
+	e.window = append(e.window[:0], e.window[first:]...)
+
+	last := sort.Search(len(e.window), func(i int) bool { return e.window[i] > end })
+	return int64(last)
+}
+
+// Len returns the number of stored keys, including expired keys not yet evicted
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data)
+}
+
+// evictLoop removes expired keys until Close is called
+func (s *MemoryStore) evictLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.evict(time.Now())
+		}
+	}
+}
+
+// evict removes every expired key
+func (s *MemoryStore) evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, e := range s.data {
+		if e.expired(now) {
+			delete(s.data, key)
+		}
+	}
+}
+
+// Close stops the eviction loop
+func (s *MemoryStore) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+		<-s.done
+	}
+	return nil
+}
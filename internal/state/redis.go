@@ -1,11 +1,43 @@
 package state
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
-// StateStore is a minimal interface for ephemeral state (e.g., windows, counters)
+// State errors
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrWrongType  = errors.New("operation against a key holding the wrong kind of value")
+)
+
+// StateStore is a minimal interface for ephemeral state (e.g., windows, counters).
+// Semantics follow Redis so implementations are interchangeable: missing keys
+// read as nil, and a zero TTL means no expiry.
 type StateStore interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Set(ctx context.Context, key string, value []byte) error
+
+	// Incr adds delta to the integer at key (missing = 0) and returns the result
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+
+	// Expire sets a key's TTL, reporting whether the key exists
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// GetSet sets a value and returns the previous one; any TTL is cleared
+	GetSet(ctx context.Context, key string, value []byte) ([]byte, error)
+
+	// SetNX sets a value only if the key does not exist, reporting whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// WindowAdd records an occurrence at time at in a sliding window and
+	// returns the number of occurrences within (at-window, at]
+	WindowAdd(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error)
+
+	// WindowCount returns the number of occurrences within (at-window, at]
+	WindowCount(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error)
+
 	Close() error
 }
 
@@ -15,4 +47,22 @@ func NewNoopStore(addr string) StateStore { return &noopStore{} }
 
 func (n *noopStore) Get(ctx context.Context, key string) ([]byte, error)     { return nil, nil }
 func (n *noopStore) Set(ctx context.Context, key string, value []byte) error { return nil }
-func (n *noopStore) Close() error                                            { return nil }
+func (n *noopStore) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return delta, nil
+}
+func (n *noopStore) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return false, nil
+}
+func (n *noopStore) GetSet(ctx context.Context, key string, value []byte) ([]byte, error) {
+	return nil, nil
+}
+func (n *noopStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+func (n *noopStore) WindowAdd(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	return 1, nil
+}
+func (n *noopStore) WindowCount(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	return 0, nil
+}
+func (n *noopStore) Close() error { return nil }
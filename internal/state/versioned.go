@@ -0,0 +1,112 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrConflict is returned when a versioned change kept losing to changes
+// made at the same time elsewhere
+var ErrConflict = errors.New("value changed concurrently, try again")
+
+// versionAttempts bounds how often a change is retried on a newer value
+const versionAttempts = 10
+
+// versionRetention is how long a replaced version stays readable for nodes
+// that looked up the previous head
+const versionRetention = time.Minute
+
+// Versioned is a value shared by nodes that change it read-modify-write,
+// such as a JSON map, without their changes overwriting each other. Each
+// change is written as the next version, claimed with SetNX; a change
+// whose version another node claimed first is applied again to that node's
+// value. Version 0 is the plain key, so values written with Set stay
+// readable.
+type Versioned struct {
+	store StateStore
+	key   string
+}
+
+// NewVersioned returns the versioned value at key
+func NewVersioned(store StateStore, key string) *Versioned {
+	return &Versioned{store: store, key: key}
+}
+
+// versionKey is the key holding version n
+func (v *Versioned) versionKey(n int64) string {
+	if n == 0 {
+		return v.key
+	}
+	return v.key + ":v" + strconv.FormatInt(n, 10)
+}
+
+// Get returns the latest value, nil if none was written
+func (v *Versioned) Get(ctx context.Context) ([]byte, error) {
+	_, data, err := v.latest(ctx)
+	return data, err
+}
+
+// latest returns the latest version and its value. The head counts the
+// changes made, so it never moves back, but may lag behind versions
+// written by a node that stopped before counting its change; those are
+// found by looking ahead.
+func (v *Versioned) latest(ctx context.Context) (int64, []byte, error) {
+	head, err := v.store.Get(ctx, v.key+":head")
+	if err != nil {
+		return 0, nil, err
+	}
+	n, _ := strconv.ParseInt(string(head), 10, 64)
+	data, err := v.store.Get(ctx, v.versionKey(n))
+	if err != nil {
+		return 0, nil, err
+	}
+	for {
+		next, err := v.store.Get(ctx, v.versionKey(n+1))
+		if err != nil {
+			return 0, nil, err
+		}
+		if next == nil {
+			break
+		}
+		n, data = n+1, next
+	}
+	if data == nil && n > 0 {
+		// Expired under a head lagging too far; reading it as empty would
+		// let a change overwrite newer versions
+		return 0, nil, fmt.Errorf("%s: version %d is missing", v.key, n)
+	}
+	return n, data, nil
+}
+
+// Update writes change's result on the latest value (nil if none) as the
+// next version. change may be called again, on a newer value, if another
+// node changed it meanwhile.
+func (v *Versioned) Update(ctx context.Context, change func(current []byte) ([]byte, error)) error {
+	for attempt := 0; attempt < versionAttempts; attempt++ {
+		n, current, err := v.latest(ctx)
+		if err != nil {
+			return err
+		}
+		next, err := change(current)
+		if err != nil {
+			return err
+		}
+		claimed, err := v.store.SetNX(ctx, v.versionKey(n+1), next, 0)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		// Best effort: readers look ahead of a lagging head, and an old
+		// version left without expiry only costs its space
+		v.store.Expire(ctx, v.versionKey(n), versionRetention)
+		v.store.Incr(ctx, v.key+":head", 1)
+		return nil
+	}
+	return fmt.Errorf("%s: %w", v.key, ErrConflict)
+}
@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+)
+
+// ErrBufferFull is returned when the buffer is at its memory bound and the
+// backend cannot drain it
+var ErrBufferFull = errors.New("storage buffer full")
+
+// BufferConfig holds write buffering settings
+type BufferConfig struct {
+	// MaxRows flushes once this many rows are buffered (0 = 1000)
+	MaxRows int
+
+	// MaxBytes bounds buffered payload bytes (0 = 8MB)
+	MaxBytes int
+
+	// FlushInterval flushes buffered rows at least this often (0 = 1s)
+	FlushInterval time.Duration
+
+	// ShutdownTimeout bounds the final flush on Close (0 = 10s)
+	ShutdownTimeout time.Duration
+
+	// SpillPath receives rows still unflushed at shutdown; they are
+	// reloaded and flushed first on the next start ("" = no spill)
+	SpillPath string
+}
+
+// row is a single buffered Persist call
+type row struct {
+	Key     string `json:"key"`
+	Payload []byte `json:"payload"`
+}
+
+// BufferedWriter batches Persist calls in front of an Aggregator. Rows are
+// delivered at least once: a failed flush keeps them buffered and rows left
+// at shutdown are spilled to disk.
+type BufferedWriter struct {
+	inner Aggregator
+	cfg   BufferConfig
+
+	mu    sync.Mutex
+	rows  []row
+	bytes int
+
+	// reloaded is set while rows from the spill file are not yet flushed;
+	// the file is only removed once they are
+	reloaded bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	started   atomic.Bool
+	closeOnce sync.Once
+}
+
+// NewBufferedWriter wraps inner and reloads rows spilled by a previous run
+func NewBufferedWriter(inner Aggregator, cfg BufferConfig) (*BufferedWriter, error) {
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = 1000
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 8 * 1024 * 1024
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 10 * time.Second
+	}
+
+	w := &BufferedWriter{
+		inner: inner,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if err := w.loadSpill(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Persist buffers a row, flushing synchronously when the buffer is full
+func (w *BufferedWriter) Persist(ctx context.Context, key string, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.bytes+len(payload) > w.cfg.MaxBytes && len(w.rows) > 0 {
+		if err := w.flushLocked(ctx, "size"); err != nil {
+			return fmt.Errorf("%w: %v", ErrBufferFull, err)
+		}
+	}
+
+	w.rows = append(w.rows, row{Key: key, Payload: payload})
+	w.bytes += len(payload)
+	metrics.StorageBufferedRows.Set(float64(len(w.rows)))
+
+	if len(w.rows) >= w.cfg.MaxRows {
+		// The row is buffered either way; a failed flush is retried later
+		if err := w.flushLocked(ctx, "size"); err != nil {
+			log := logger.WithComponent("storage")
+			log.Warn().Err(err).Int("rows", len(w.rows)).Msg("storage flush failed, keeping rows buffered")
+		}
+	}
+	return nil
+}
+
+// Flush writes all buffered rows to the backend
+func (w *BufferedWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked(ctx, "interval")
+}
+
+// Buffered returns the number of rows awaiting a flush
+func (w *BufferedWriter) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.rows)
+}
+
+// flushLocked persists rows in order, keeping any not yet written on error
+func (w *BufferedWriter) flushLocked(ctx context.Context, reason string) error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+
+	for i, r := range w.rows {
+		if err := w.inner.Persist(ctx, r.Key, r.Payload); err != nil {
+			w.rows = w.rows[i:]
+			w.bytes = 0
+			for _, rest := range w.rows {
+				w.bytes += len(rest.Payload)
+			}
+			metrics.StorageBufferedRows.Set(float64(len(w.rows)))
+			metrics.StorageFlushes.WithLabelValues(reason, "failed").Inc()
+			return err
+		}
+	}
+
+	w.rows = w.rows[:0]
+	w.bytes = 0
+	metrics.StorageBufferedRows.Set(0)
+	metrics.StorageFlushes.WithLabelValues(reason, "success").Inc()
+
+	if w.reloaded {
+		w.reloaded = false
+		if err := os.Remove(w.cfg.SpillPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log := logger.WithComponent("storage")
+			log.Warn().Err(err).Str("path", w.cfg.SpillPath).Msg("failed to remove flushed spill file")
+		}
+	}
+	return nil
+}
+
+// Run flushes on the configured interval until Close is called
+func (w *BufferedWriter) Run() {
+	if !w.started.CompareAndSwap(false, true) {
+		return
+	}
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.Flush(context.Background()); err != nil {
+				log := logger.WithComponent("storage")
+				log.Warn().Err(err).Msg("periodic storage flush failed")
+			}
+		}
+	}
+}
+
+// Close stops the flush loop, flushes remaining rows within the shutdown
+// timeout, spills whatever is left and closes the backend
+func (w *BufferedWriter) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		if !w.started.CompareAndSwap(false, true) {
+			<-w.done
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.cfg.ShutdownTimeout)
+		defer cancel()
+
+		w.mu.Lock()
+		flushErr := w.flushLocked(ctx, "shutdown")
+		if flushErr != nil {
+			err = w.spillLocked()
+			if err == nil {
+				log := logger.WithComponent("storage")
+				log.Warn().Err(flushErr).Int("rows", len(w.rows)).Str("path", w.cfg.SpillPath).
+					Msg("shutdown flush failed, spilled unflushed rows")
+			}
+		}
+		w.mu.Unlock()
+
+		if closeErr := w.inner.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// spillLocked rewrites the spill file with the buffered rows, which include
+// any reloaded from it
+func (w *BufferedWriter) spillLocked() error {
+	if w.cfg.SpillPath == "" {
+		return fmt.Errorf("%d unflushed rows lost: no spill path configured", len(w.rows))
+	}
+
+	f, err := os.OpenFile(w.cfg.SpillPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spill file: %w", err)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, r := range w.rows {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return fmt.Errorf("write spill file: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync spill file: %w", err)
+	}
+
+	metrics.StorageSpilledRows.Add(float64(len(w.rows)))
+	w.rows, w.bytes, w.reloaded = nil, 0, false
+	metrics.StorageBufferedRows.Set(0)
+	return f.Close()
+}
+
+// loadSpill buffers rows from a previous run's spill file. The file stays
+// until they are flushed, so a crash before then loses nothing.
+func (w *BufferedWriter) loadSpill() error {
+	if w.cfg.SpillPath == "" {
+		return nil
+	}
+
+	f, err := os.Open(w.cfg.SpillPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open spill file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), w.cfg.MaxBytes+1024)
+	for scanner.Scan() {
+		var r row
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn final line from a crash mid-spill
+			continue
+		}
+		w.rows = append(w.rows, r)
+		w.bytes += len(r.Payload)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read spill file: %w", err)
+	}
+
+	if len(w.rows) == 0 {
+		return os.Remove(w.cfg.SpillPath)
+	}
+
+	log := logger.WithComponent("storage")
+	log.Info().Int("rows", len(w.rows)).Msg("reloaded spilled storage rows")
+	w.reloaded = true
+	metrics.StorageBufferedRows.Set(float64(len(w.rows)))
+	return nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BatchColumnsDDL returns the statements adding the batch columns to an
+// events table created before they existed
+func BatchColumnsDDL(base string) []string {
+	return []string{
+		fmt.Sprintf(`ALTER TABLE %s
+    ADD COLUMN IF NOT EXISTS batch_id String,
+    ADD COLUMN IF NOT EXISTS batch_index UInt32`, base),
+		fmt.Sprintf(`ALTER TABLE %s ADD INDEX IF NOT EXISTS idx_batch_id batch_id TYPE bloom_filter GRANULARITY 1`, base),
+	}
+}
+
+// Migrations returns every schema migration for an events table: the
+// rollups, the batch columns, then the per-row retention
+func Migrations(base string) []Migration {
+	migrations := RollupMigrations(base)
+	migrations = append(migrations, Migration{Version: len(migrations) + 1, Statements: BatchColumnsDDL(base)})
+	return append(migrations, Migration{
+		Version:    len(migrations) + 1,
+		Statements: RetentionColumnsDDL(base, DefaultRetentionPolicy().LongTTL),
+	})
+}
+
+// EventFilter selects a tenant's events
+type EventFilter struct {
+	TenantID string
+
+	// From and To bound the event timestamps (zero = unbounded)
+	From, To time.Time
+
+	// BatchID selects the events of one ingest request
+	BatchID string
+
+	// Search selects the events whose message contains it, case-sensitive.
+	// Its whole words are also matched with hasToken, which a SearchIndex
+	// answers without scanning the messages.
+	Search string
+
+	// Limit caps the rows returned (0 = 1000)
+	Limit int
+}
+
+// EventQuery returns the query and args reading the events matching f,
+// newest first, or in their order within the batch when f names one
+func EventQuery(base string, f EventFilter) (string, []any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT * FROM %s WHERE tenant_id = ?", base)
+	args := []any{f.TenantID}
+
+	if !f.From.IsZero() {
+		b.WriteString(" AND timestamp >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		b.WriteString(" AND timestamp < ?")
+		args = append(args, f.To.UTC())
+	}
+	if f.Search != "" {
+		for _, token := range searchTokens(f.Search) {
+			b.WriteString(" AND hasToken(message, ?)")
+			args = append(args, token)
+		}
+		b.WriteString(" AND position(message, ?) > 0")
+		args = append(args, f.Search)
+	}
+	if f.BatchID != "" {
+		b.WriteString(" AND batch_id = ? ORDER BY batch_index")
+		args = append(args, f.BatchID)
+	} else {
+		b.WriteString(" ORDER BY timestamp DESC")
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	fmt.Fprintf(&b, " LIMIT %d", limit)
+	return b.String(), args
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"parsec/pkg/models"
+)
+
+// MetadataColumns returns an event's metadata as stored: flattened to dotted
+// keys for the metadata Map(String, String) column, where it can be indexed
+// and filtered, and as JSON for the metadata_json column, which keeps
+// objects and arrays for queries that need the structure (JSONExtract).
+// Metadata without nested values is stored flat only.
+func MetadataColumns(m models.Metadata) (flat map[string]string, raw string, err error) {
+	flat = m.Flatten()
+	if !isNested(m) {
+		return flat, "", nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+	return flat, string(data), nil
+}
+
+// isNested reports whether any top-level value is an object or array
+func isNested(m models.Metadata) bool {
+	for _, v := range m {
+		switch v.(type) {
+		case map[string]any, []any:
+			return true
+		}
+	}
+	return false
+}
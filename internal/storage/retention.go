@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention tiers, matching the routing set_retention action and the
+// "retention" Kafka header
+const (
+	TierShort = "short"
+	TierLong  = "long"
+)
+
+// Partition is the table and TTL a tier's events are stored with
+type Partition struct {
+	Table string
+	TTL   time.Duration
+}
+
+// RetentionPolicy maps retention tiers to TTLs. Untiered events keep the
+// base table and the long TTL.
+type RetentionPolicy struct {
+	ShortTTL time.Duration
+	LongTTL  time.Duration
+}
+
+// DefaultRetentionPolicy keeps short-tier events for 7 days and everything
+// else for 90
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		ShortTTL: 7 * 24 * time.Hour,
+		LongTTL:  90 * 24 * time.Hour,
+	}
+}
+
+// PartitionFor returns where events of a tier go, e.g. logs_short for the
+// short tier of the logs table
+func (p RetentionPolicy) PartitionFor(table, tier string) Partition {
+	switch tier {
+	case TierShort:
+		return Partition{Table: table + "_" + TierShort, TTL: p.ShortTTL}
+	case TierLong:
+		return Partition{Table: table + "_" + TierLong, TTL: p.LongTTL}
+	default:
+		return Partition{Table: table, TTL: p.LongTTL}
+	}
+}
+
+// Place returns where an event goes and the TTL of its row. A retention
+// hint (RetentionSeconds, 0 = none) overrides the tier's TTL, and places
+// an untiered event in the tier whose TTL covers it: the short partition
+// for hints up to ShortTTL, the long one beyond. Storage writes the TTL to
+// the row's retention_seconds column.
+func (p RetentionPolicy) Place(table, tier string, hintSeconds int64) Partition {
+	hint := time.Duration(hintSeconds) * time.Second
+	if tier == "" && hint > 0 {
+		tier = TierLong
+		if hint <= p.ShortTTL {
+			tier = TierShort
+		}
+	}
+
+	partition := p.PartitionFor(table, tier)
+	if hint > 0 {
+		partition.TTL = hint
+	}
+	return partition
+}
+
+// RetentionColumnsDDL returns the statements adding the retention_seconds
+// column to an events table and expiring each row after it, or after
+// fallback for rows without a hint
+func RetentionColumnsDDL(table string, fallback time.Duration) []string {
+	return []string{
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS retention_seconds UInt32 DEFAULT 0`, table),
+		fmt.Sprintf(`ALTER TABLE %s MODIFY TTL toDateTime(timestamp) + toIntervalSecond(if(retention_seconds = 0, %d, retention_seconds))`,
+			table, int64(fallback/time.Second)),
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Conn is the subset of a ClickHouse client needed to manage rollups. The
+// ClickHouse backend implements it once it lands.
+type Conn interface {
+	Exec(ctx context.Context, query string, args ...any) error
+
+	// QueryInt runs a query returning a single integer
+	QueryInt(ctx context.Context, query string, args ...any) (int64, error)
+}
+
+// Rollup is a materialized per-interval count by tenant, severity and source
+type Rollup struct {
+	// Name suffixes the rollup table, e.g. logs_rollup_1m
+	Name string
+
+	// Interval is the bucket width (one minute or one hour)
+	Interval time.Duration
+
+	// TTL bounds how long buckets are kept
+	TTL time.Duration
+}
+
+// DefaultRollups are the per-minute and per-hour rollups Parsec manages
+var DefaultRollups = []Rollup{
+	{Name: "1m", Interval: time.Minute, TTL: 30 * 24 * time.Hour},
+	{Name: "1h", Interval: time.Hour, TTL: 400 * 24 * time.Hour},
+}
+
+// Table returns the rollup's target table for a base table
+func (r Rollup) Table(base string) string {
+	return base + "_rollup_" + r.Name
+}
+
+// bucketFunc returns the ClickHouse function truncating timestamps to the interval
+func (r Rollup) bucketFunc() string {
+	if r.Interval >= time.Hour {
+		return "toStartOfHour"
+	}
+	return "toStartOfMinute"
+}
+
+// DDL returns the statements creating the rollup table and the materialized
+// view that feeds it from the base table
+func (r Rollup) DDL(base string) []string {
+	table := r.Table(base)
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    bucket DateTime,
+    tenant_id LowCardinality(String),
+    severity LowCardinality(String),
+    source LowCardinality(String),
+    events UInt64
+) ENGINE = SummingMergeTree(events)
+ORDER BY (tenant_id, bucket, severity, source)
+TTL bucket + INTERVAL %d DAY`, table, int(r.TTL.Hours()/24)),
+		fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s_mv TO %s AS
+SELECT %s(timestamp) AS bucket, tenant_id, severity, source, count() AS events
+FROM %s
+GROUP BY bucket, tenant_id, severity, source`, table, table, r.bucketFunc(), base),
+	}
+}
+
+// Migration is a numbered set of schema statements
+type Migration struct {
+	Version    int
+	Statements []string
+}
+
+// RollupMigrations returns the schema migrations for the default rollups.
+// New rollups are appended as new versions; existing versions never change.
+func RollupMigrations(base string) []Migration {
+	migrations := make([]Migration, 0, len(DefaultRollups))
+	for i, r := range DefaultRollups {
+		migrations = append(migrations, Migration{Version: i + 1, Statements: r.DDL(base)})
+	}
+	return migrations
+}
+
+// migrationsTable records applied migration versions
+const migrationsTable = "parsec_schema_migrations"
+
+// Migrate applies migrations newer than the highest recorded version, in
+// order, and returns the resulting version
+func Migrate(ctx context.Context, conn Conn, migrations []Migration) (int, error) {
+	err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+migrationsTable+` (
+    version UInt32,
+    applied_at DateTime DEFAULT now()
+) ENGINE = MergeTree ORDER BY version`)
+	if err != nil {
+		return 0, fmt.Errorf("create migrations table: %w", err)
+	}
+
+	current, err := conn.QueryInt(ctx, `SELECT max(version) FROM `+migrationsTable)
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+
+	version := int(current)
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		for _, stmt := range m.Statements {
+			if err := conn.Exec(ctx, stmt); err != nil {
+				return version, fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+		}
+		if err := conn.Exec(ctx, `INSERT INTO `+migrationsTable+` (version) VALUES (?)`, m.Version); err != nil {
+			return version, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		version = m.Version
+	}
+	return version, nil
+}
+
+// RollupFor picks the coarsest rollup that still gives at least minBuckets
+// buckets over the range, so long ranges read hourly rows
+func RollupFor(from, to time.Time, minBuckets int) Rollup {
+	chosen := DefaultRollups[0]
+	for _, r := range DefaultRollups[1:] {
+		if to.Sub(from)/r.Interval >= time.Duration(minBuckets) {
+			chosen = r
+		}
+	}
+	return chosen
+}
+
+// RollupQuery returns the query and args counting a tenant's events per
+// bucket, severity and source from a rollup table. Scaffolding: Conn can't
+// return rows yet, so nothing reads the rollups until the ClickHouse
+// backend lands; stats queries should then use RollupFor and this.
+func RollupQuery(base string, r Rollup, tenantID string, from, to time.Time) (string, []any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT bucket, severity, source, sum(events) AS events FROM %s", r.Table(base))
+	b.WriteString(" WHERE tenant_id = ? AND bucket >= ? AND bucket < ?")
+	b.WriteString(" GROUP BY bucket, severity, source ORDER BY bucket")
+	return b.String(), []any{tenantID, from.UTC(), to.UTC()}
+}
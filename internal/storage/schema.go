@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"parsec/internal/logger"
+)
+
+// Schema describes the events table Prepare keeps up to date
+type Schema struct {
+	// Table is the base events table, e.g. logs
+	Table string
+
+	// SearchIndex, if set, is added to the table for message search
+	SearchIndex *SearchIndex
+}
+
+// Prepare brings the events table's schema up to date, applying pending
+// Migrations and adding the search index if asked, and returns the
+// resulting version. Every node may run it on startup: applied versions
+// are skipped, the statements are idempotent and an existing index is
+// left alone.
+func Prepare(ctx context.Context, conn Conn, s Schema) (int, error) {
+	log := logger.WithComponent("storage")
+
+	version, err := Migrate(ctx, conn, Migrations(s.Table))
+	if err != nil {
+		return version, fmt.Errorf("migrate %s: %w", s.Table, err)
+	}
+	if s.SearchIndex != nil {
+		added, err := EnsureSearchIndex(ctx, conn, s.Table, *s.SearchIndex)
+		if err != nil {
+			return version, fmt.Errorf("%s: %w", s.Table, err)
+		}
+		if added {
+			log.Info().Str("table", s.Table).Msg("search index added, rebuilding it for existing rows")
+		}
+	}
+	return version, nil
+}
+
+// Open connects to a storage backend by name: clickhouse or postgres
+func Open(backend, dsn string) (Aggregator, error) {
+	switch backend {
+	case "clickhouse":
+		return NewClickHouse(dsn)
+	case "postgres":
+		return NewPostgres(dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// searchIndexName names the token bloom filter index on event messages
+const searchIndexName = "idx_message_tokens"
+
+// SearchIndex is an optional token bloom filter (tokenbf_v1) index on event
+// messages. ClickHouse splits messages into words on non-alphanumeric
+// characters and keeps a bloom filter of them per granule, so a search
+// skips granules lacking one of its whole words instead of scanning every
+// message.
+type SearchIndex struct {
+	// SizeBytes is the size of each bloom filter
+	SizeBytes int
+
+	// Hashes is the number of hash functions of the filters
+	Hashes int
+
+	// Granularity is how many table granules one filter covers
+	Granularity int
+}
+
+// DefaultSearchIndex suits messages of a few dozen words
+func DefaultSearchIndex() SearchIndex {
+	return SearchIndex{SizeBytes: 10240, Hashes: 3, Granularity: 4}
+}
+
+// DDL returns the statements adding the index to an events table and
+// building it for existing rows
+func (s SearchIndex) DDL(base string) []string {
+	return []string{
+		fmt.Sprintf(`ALTER TABLE %s ADD INDEX IF NOT EXISTS %s message TYPE tokenbf_v1(%d, %d, 0) GRANULARITY %d`,
+			base, searchIndexName, s.SizeBytes, s.Hashes, s.Granularity),
+		fmt.Sprintf(`ALTER TABLE %s MATERIALIZE INDEX %s`, base, searchIndexName),
+	}
+}
+
+// EnsureSearchIndex adds the index to an events table unless it has it. It
+// is not a numbered migration since deployments opt in, and rebuilding the
+// index rewrites every part, so it reports whether it did.
+func EnsureSearchIndex(ctx context.Context, conn Conn, base string, s SearchIndex) (bool, error) {
+	count, err := conn.QueryInt(ctx, `SELECT count() FROM system.data_skipping_indices
+WHERE database = currentDatabase() AND table = ? AND name = ?`, base, searchIndexName)
+	if err != nil {
+		return false, fmt.Errorf("read search index: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+	for _, stmt := range s.DDL(base) {
+		if err := conn.Exec(ctx, stmt); err != nil {
+			return false, fmt.Errorf("add search index: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// searchTokens returns the words of a substring search that are whole
+// words of any message containing it: those not touching the ends of the
+// search, which may be parts of longer words. Words are split like
+// tokenbf_v1 splits them; bytes of multibyte characters count as letters.
+func searchTokens(search string) []string {
+	isWord := func(c byte) bool {
+		return c >= 0x80 || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+
+	var tokens []string
+	for i := 0; i < len(search); {
+		if !isWord(search[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(search) && isWord(search[i]) {
+			i++
+		}
+		if start > 0 && i < len(search) {
+			tokens = append(tokens, search[start:i])
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,272 @@
+// Package suspension keeps the tenants whose ingestion is paused or
+// blocked, e.g. for billing delinquency or abuse. Suspensions are kept in
+// the StateStore, as a versioned value so changes made at once don't
+// overwrite each other, and reloaded every few seconds.
+//
+// A paused tenant is asked to retry later, so agents keep buffering; a
+// blocked tenant is refused outright.
+package suspension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+)
+
+// StoreKey is the StateStore key holding every tenant's suspension
+const StoreKey = "parsec:suspensions"
+
+// Mode is how a tenant's ingestion is suspended
+type Mode string
+
+const (
+	// ModePaused refuses events with a retryable error
+	ModePaused Mode = "paused"
+
+	// ModeBlocked refuses events for good
+	ModeBlocked Mode = "blocked"
+)
+
+// ErrInvalidMode is returned for modes other than paused and blocked
+var ErrInvalidMode = errors.New(`mode must be "paused" or "blocked"`)
+
+// Suspension is a tenant's ingestion pause or block
+type Suspension struct {
+	TenantID string `json:"tenant_id"`
+	Mode     Mode   `json:"mode"`
+	Reason   string `json:"reason,omitempty"`
+
+	// By names who suspended the tenant, for the audit trail
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since"`
+
+	// Until lifts the suspension automatically (nil = until lifted)
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// active reports whether the suspension is in force at now
+func (s Suspension) active(now time.Time) bool {
+	return s.Until == nil || now.Before(*s.Until)
+}
+
+// Code is the error code refused requests and events carry, e.g.
+// "tenant_paused"
+func (s Suspension) Code() string {
+	return "tenant_" + string(s.Mode)
+}
+
+// Error describes the refusal to the tenant's callers
+func (s Suspension) Error() string {
+	if s.Mode == ModeBlocked {
+		return "ingestion is blocked for this tenant"
+	}
+	return "ingestion is paused for this tenant, try again later"
+}
+
+// Registry holds the suspended tenants
+type Registry struct {
+	shared *state.Versioned
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu          sync.RWMutex
+	suspensions map[string]Suspension
+}
+
+// NewRegistry creates a registry backed by store (may be nil)
+func NewRegistry(store state.StateStore) *Registry {
+	r := &Registry{suspensions: make(map[string]Suspension)}
+	if store != nil {
+		r.shared = state.NewVersioned(store, StoreKey)
+	}
+	return r
+}
+
+// Get returns a tenant's suspension if it is in force. It is called for
+// every request and event, so it only touches memory. A nil registry
+// suspends nobody.
+func (r *Registry) Get(tenantID string) (Suspension, bool) {
+	if r == nil || tenantID == "" {
+		return Suspension{}, false
+	}
+
+	r.mu.RLock()
+	s, ok := r.suspensions[tenantID]
+	r.mu.RUnlock()
+
+	if !ok || !s.active(time.Now()) {
+		return Suspension{}, false
+	}
+	return s, true
+}
+
+// List returns the suspensions in force, sorted by tenant
+func (r *Registry) List() []Suspension {
+	now := time.Now()
+
+	r.mu.RLock()
+	out := make([]Suspension, 0, len(r.suspensions))
+	for _, s := range r.suspensions {
+		if s.active(now) {
+			out = append(out, s)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].TenantID < out[j].TenantID })
+	return out
+}
+
+// Suspend pauses or blocks a tenant, replacing any earlier suspension
+func (r *Registry) Suspend(ctx context.Context, s Suspension) (Suspension, error) {
+	if s.Mode != ModePaused && s.Mode != ModeBlocked {
+		return Suspension{}, ErrInvalidMode
+	}
+	if s.Since.IsZero() {
+		s.Since = time.Now().UTC()
+	}
+
+	err := r.update(ctx, func(suspensions map[string]Suspension) {
+		suspensions[s.TenantID] = s
+	})
+	return s, err
+}
+
+// Lift resumes a tenant's ingestion, reporting whether it was suspended
+func (r *Registry) Lift(ctx context.Context, tenantID string) (bool, error) {
+	var existed bool
+	err := r.update(ctx, func(suspensions map[string]Suspension) {
+		var s Suspension
+		s, existed = suspensions[tenantID]
+		existed = existed && s.active(time.Now())
+		delete(suspensions, tenantID)
+	})
+	return existed, err
+}
+
+// update applies change to the latest suspensions, dropping expired ones,
+// and saves them. A store without suspensions (or one that keeps nothing)
+// starts from those in memory.
+func (r *Registry) update(ctx context.Context, change func(map[string]Suspension)) error {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+
+	apply := func(data []byte) (map[string]Suspension, error) {
+		current := make(map[string]Suspension)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return nil, fmt.Errorf("parse suspensions: %w", err)
+			}
+		} else {
+			r.mu.RLock()
+			for tenantID, s := range r.suspensions {
+				current[tenantID] = s
+			}
+			r.mu.RUnlock()
+		}
+
+		now := time.Now()
+		for tenantID, s := range current {
+			if !s.active(now) {
+				delete(current, tenantID)
+			}
+		}
+		change(current)
+		return current, nil
+	}
+
+	if r.shared == nil {
+		suspensions, err := apply(nil)
+		if err != nil {
+			return err
+		}
+		r.replace(suspensions)
+		return nil
+	}
+
+	// Applied to the stored suspensions, again if another node changed
+	// them meanwhile, so its change is kept
+	var suspensions map[string]Suspension
+	err := r.shared.Update(ctx, func(data []byte) ([]byte, error) {
+		var err error
+		if suspensions, err = apply(data); err != nil {
+			return nil, err
+		}
+		return json.Marshal(suspensions)
+	})
+	if err != nil {
+		return err
+	}
+	r.replace(suspensions)
+	return nil
+}
+
+// replace swaps in a new set of suspensions and updates the gauge
+func (r *Registry) replace(suspensions map[string]Suspension) {
+	r.mu.Lock()
+	r.suspensions = suspensions
+	r.mu.Unlock()
+
+	counts := map[Mode]int{ModePaused: 0, ModeBlocked: 0}
+	now := time.Now()
+	for _, s := range suspensions {
+		if s.active(now) {
+			counts[s.Mode]++
+		}
+	}
+	for mode, n := range counts {
+		metrics.TenantsSuspended.WithLabelValues(string(mode)).Set(float64(n))
+	}
+}
+
+// Load replaces the in-memory suspensions with those in the store. A store
+// without any (or one that keeps nothing) leaves them as they are.
+func (r *Registry) Load(ctx context.Context) error {
+	if r.shared == nil {
+		return nil
+	}
+
+	data, err := r.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	suspensions := make(map[string]Suspension)
+	if err := json.Unmarshal(data, &suspensions); err != nil {
+		return fmt.Errorf("parse suspensions: %w", err)
+	}
+	r.replace(suspensions)
+	return nil
+}
+
+// Run reloads suspensions periodically so changes made on other nodes
+// take effect here within interval
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("suspension")
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload suspensions")
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/multiline"
+	"parsec/pkg/models"
+)
+
+// MetadataFile is the metadata key holding the path an event was read from
+const MetadataFile = "file"
+
+// tailNamespace derives stable event IDs from a file's identity and a
+// line's offset, so a line re-read after a restart keeps its ID
+var tailNamespace = uuid.MustParse("a3b1f0c2-7e4d-4c59-8f0a-2d6e9b1c5f38")
+
+// fileID identifies a file across renames
+type fileID struct {
+	dev, ino uint64
+}
+
+func (id fileID) String() string {
+	return strconv.FormatUint(id.dev, 10) + ":" + strconv.FormatUint(id.ino, 10)
+}
+
+// checkpointKey is the state store key of a file's checkpoint
+func checkpointKey(id fileID) string {
+	return "parsec:tail:" + id.String()
+}
+
+// checkpoint is the state stored per file
+type checkpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+// file is an open file being tailed
+type file struct {
+	id   fileID
+	path string
+	f    *os.File
+
+	// offset is the read position; committed is the end of the last
+	// submitted line and saved the offset last checkpointed
+	offset    int64
+	committed int64
+	saved     int64
+
+	// partial holds bytes read past the last complete line
+	partial []byte
+}
+
+// open starts tailing a file. Its checkpoint is used when it is still
+// valid; otherwise a file found at startup starts at its end unless
+// ReadFromHead, and a file appearing later starts at its beginning.
+func (t *Tailer) open(ctx context.Context, path string, id fileID, size int64, initial bool) {
+	log := logger.WithComponent("tail")
+
+	start := int64(0)
+	if initial && !t.cfg.ReadFromHead {
+		start = size
+	}
+	if cp, err := t.loadCheckpoint(ctx, id); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to load tail checkpoint")
+	} else if cp != nil && cp.Offset <= size {
+		start = cp.Offset
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to open file")
+		return
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		log.Warn().Err(err).Str("path", path).Msg("failed to seek file")
+		return
+	}
+
+	t.files[id] = &file{
+		id:        id,
+		path:      path,
+		f:         f,
+		offset:    start,
+		committed: start,
+		saved:     -1,
+	}
+	log.Info().
+		Str("path", path).
+		Int64("offset", start).
+		Msg("tailing file")
+}
+
+// loadCheckpoint reads a file's checkpoint (nil = none)
+func (t *Tailer) loadCheckpoint(ctx context.Context, id fileID) (*checkpoint, error) {
+	data, err := t.store.Get(ctx, checkpointKey(id))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// read reads a file to its current end, submitting complete lines
+func (t *Tailer) read(ctx context.Context, f *file) {
+	for ctx.Err() == nil {
+		n, err := f.f.Read(t.buf)
+		if n > 0 {
+			f.offset += int64(n)
+			f.partial = append(f.partial, t.buf[:n]...)
+			t.lines(ctx, f)
+		}
+		if err != nil || n == 0 {
+			return
+		}
+	}
+}
+
+// lines submits the complete lines in f.partial. Lines longer than
+// MaxLineBytes are split.
+func (t *Tailer) lines(ctx context.Context, f *file) {
+	consumed := 0
+	for {
+		rest := f.partial[consumed:]
+		n := bytes.IndexByte(rest, '\n')
+		var line []byte
+		switch {
+		case n >= 0 && n <= t.cfg.MaxLineBytes:
+			line = rest[:n]
+			n++
+		case len(rest) >= t.cfg.MaxLineBytes:
+			line = rest[:t.cfg.MaxLineBytes]
+			n = len(line)
+		default:
+			f.partial = f.partial[:copy(f.partial, rest)]
+			return
+		}
+
+		if !t.submit(ctx, f, line) {
+			f.partial = f.partial[:copy(f.partial, rest)]
+			return
+		}
+		consumed += n
+		f.committed += int64(n)
+	}
+}
+
+// submit sends a line to the sink, waiting out a full queue. It returns
+// false if ctx ended first, leaving the line to be read again.
+func (t *Tailer) submit(ctx context.Context, f *file, line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(bytes.TrimSpace(line)) == 0 {
+		return true
+	}
+
+	backoff := minSubmitBackoff
+	for {
+		err := t.sink.Submit(ctx, t.event(f, line))
+		if errors.Is(err, handlers.ErrQueueFull) {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxSubmitBackoff)
+			continue
+		}
+
+		if err != nil {
+			metrics.TailLines.WithLabelValues("rejected").Inc()
+			log := logger.WithComponent("tail")
+			log.Warn().Err(err).Str("path", f.path).Msg("tailed line rejected")
+		} else {
+			metrics.TailLines.WithLabelValues("ingested").Inc()
+		}
+		return true
+	}
+}
+
+// event builds the event for a line. The path is the multi-line stream,
+// so continuation lines are only merged within a file.
+func (t *Tailer) event(f *file, line []byte) *models.LogEvent {
+	id := f.id.String() + ":" + strconv.FormatInt(f.committed, 10)
+	return &models.LogEvent{
+		ID:        uuid.NewSHA1(tailNamespace, []byte(id)).String(),
+		TenantID:  t.cfg.Tenant,
+		Timestamp: time.Now().UTC(),
+		Severity:  models.SeverityInfo,
+		Source:    t.cfg.Source,
+		Message:   string(line),
+		Metadata: models.Metadata{
+			MetadataFile:               f.path,
+			multiline.MetadataStreamID: f.path,
+		},
+	}
+}
+
+// truncated restarts a file that was truncated in place (copytruncate)
+func (t *Tailer) truncated(f *file) bool {
+	info, err := f.f.Stat()
+	if err != nil || info.Size() >= f.offset {
+		return false
+	}
+	if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+
+	log := logger.WithComponent("tail")
+	log.Info().Str("path", f.path).Msg("file truncated, reading from the beginning")
+	metrics.TailRotations.WithLabelValues("truncated").Inc()
+	f.offset, f.committed, f.partial = 0, 0, f.partial[:0]
+	return true
+}
+
+// finish stops tailing a file that was removed or rotated away: a last
+// line without a newline is submitted, the file closed and its checkpoint
+// dropped so a new file reusing the inode starts from the beginning
+func (t *Tailer) finish(ctx context.Context, f *file) {
+	if len(f.partial) > 0 && t.submit(ctx, f, f.partial) {
+		f.committed += int64(len(f.partial))
+		f.partial = f.partial[:0]
+	}
+	f.f.Close()
+	delete(t.files, f.id)
+
+	if _, err := t.store.Expire(ctx, checkpointKey(f.id), 0); err != nil {
+		log := logger.WithComponent("tail")
+		log.Warn().Err(err).Str("path", f.path).Msg("failed to drop tail checkpoint")
+	}
+}
+
+// save writes a file's checkpoint if it moved
+func (t *Tailer) save(ctx context.Context, f *file) error {
+	if f.committed == f.saved {
+		return nil
+	}
+	data, err := json.Marshal(checkpoint{Path: f.path, Offset: f.committed})
+	if err != nil {
+		return err
+	}
+	if err := t.store.Set(ctx, checkpointKey(f.id), data); err != nil {
+		return err
+	}
+	f.saved = f.committed
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package tail
+
+import (
+	"hash/fnv"
+	"os"
+)
+
+// identify falls back to the path where inodes are not available, so
+// renamed files are read again from the beginning
+func identify(path string, _ os.FileInfo) fileID {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return fileID{ino: h.Sum64()}
+}
@@ -0,0 +1,218 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// Sink receives tailed events; the ingest handler implements it
+type Sink interface {
+	Submit(ctx context.Context, event *models.LogEvent) error
+}
+
+// Queue-full backoff bounds
+const (
+	minSubmitBackoff = 10 * time.Millisecond
+	maxSubmitBackoff = time.Second
+)
+
+// Tailer follows files matching glob patterns and submits each line as a
+// LogEvent. Files are tracked by inode: a rotated file is read to its end
+// while its replacement is picked up from the beginning, and a file
+// truncated in place is read again from the start. Offsets are checkpointed
+// in the state store, so lines are submitted at least once.
+type Tailer struct {
+	cfg   config.TailConfig
+	sink  Sink
+	store state.StateStore
+
+	// Only touched by the run goroutine
+	files map[fileID]*file
+	buf   []byte
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a tailer
+func New(cfg config.TailConfig, sink Sink, store state.StateStore) (*Tailer, error) {
+	var paths []string
+	for _, pattern := range cfg.Paths {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("tail path %q: %w", pattern, err)
+		}
+		paths = append(paths, pattern)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("tail requires at least one path")
+	}
+	if cfg.Tenant == "" || cfg.Source == "" {
+		return nil, errors.New("tail tenant and source are required")
+	}
+	cfg.Paths = paths
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 250 * time.Millisecond
+	}
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = 10 * time.Second
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = 5 * time.Second
+	}
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = 1024 * 1024
+	}
+
+	return &Tailer{
+		cfg:   cfg,
+		sink:  sink,
+		store: store,
+		files: make(map[fileID]*file),
+		buf:   make([]byte, 64*1024),
+	}, nil
+}
+
+// Start tails the files in the background until Close
+func (t *Tailer) Start(ctx context.Context) {
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.done = make(chan struct{})
+
+	// Files present at startup are opened before Start returns, so lines
+	// written afterwards are never skipped
+	t.scan(ctx, true)
+
+	go func() {
+		defer close(t.done)
+		t.run(ctx)
+	}()
+}
+
+// Close stops tailing, checkpoints every open file and closes them
+func (t *Tailer) Close() error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+	<-t.done
+	return nil
+}
+
+// run reads the files until ctx is cancelled
+func (t *Tailer) run(ctx context.Context) {
+	poll := time.NewTicker(t.cfg.PollInterval)
+	defer poll.Stop()
+	rescan := time.NewTicker(t.cfg.RescanInterval)
+	defer rescan.Stop()
+	save := time.NewTicker(t.cfg.CheckpointInterval)
+	defer save.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.closeAll()
+			return
+		case <-poll.C:
+			if t.poll(ctx) {
+				t.scan(ctx, false)
+			}
+		case <-rescan.C:
+			t.scan(ctx, false)
+		case <-save.C:
+			t.checkpoint(ctx)
+		}
+	}
+}
+
+// scan expands the globs, opening new files and finishing those that are
+// gone. A file renamed within the globs keeps being tailed under its new
+// path.
+func (t *Tailer) scan(ctx context.Context, initial bool) {
+	seen := make(map[fileID]bool)
+	for _, pattern := range t.cfg.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			id := identify(path, info)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			if f, ok := t.files[id]; ok {
+				f.path = path
+				continue
+			}
+			t.open(ctx, path, id, info.Size(), initial)
+		}
+	}
+
+	for id, f := range t.files {
+		if seen[id] {
+			continue
+		}
+		// Rotated away or removed: read what was written before
+		t.read(ctx, f)
+		log := logger.WithComponent("tail")
+		log.Info().Str("path", f.path).Msg("file rotated or removed, closing")
+		metrics.TailRotations.WithLabelValues("rotated").Inc()
+		t.finish(ctx, f)
+	}
+
+	metrics.TailFilesOpen.Set(float64(len(t.files)))
+}
+
+// poll reads every open file. It reports whether a file's path now holds
+// a different file, so the caller rescans at once instead of waiting.
+func (t *Tailer) poll(ctx context.Context) bool {
+	rotated := false
+	for _, f := range t.files {
+		t.read(ctx, f)
+		if t.truncated(f) {
+			t.read(ctx, f)
+		}
+
+		info, err := os.Stat(f.path)
+		if err != nil || identify(f.path, info) != f.id {
+			rotated = true
+		}
+	}
+	return rotated
+}
+
+// checkpoint saves the offsets that moved
+func (t *Tailer) checkpoint(ctx context.Context) {
+	for _, f := range t.files {
+		if err := t.save(ctx, f); err != nil {
+			log := logger.WithComponent("tail")
+			log.Error().Err(err).Str("path", f.path).Msg("failed to write tail checkpoint")
+		}
+	}
+}
+
+// closeAll checkpoints and closes every file on shutdown
+func (t *Tailer) closeAll() {
+	t.checkpoint(context.Background())
+	for id, f := range t.files {
+		f.f.Close()
+		delete(t.files, id)
+	}
+	metrics.TailFilesOpen.Set(0)
+}
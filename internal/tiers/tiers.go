@@ -0,0 +1,585 @@
+// Package tiers assigns tenants a service tier (bronze, silver or gold)
+// whose policy supplies the defaults of the per-tenant knobs: the ingest
+// rate limit, queue priority, retention, DEBUG sampling and Kafka acks.
+// Onboarding a customer is then one assignment instead of a routing rule
+// per knob, and a tenant's own routing rules still win over its tier.
+//
+// Assignments made through the admin API are kept in the StateStore, as a
+// versioned value so changes made at once don't overwrite each other, and
+// reloaded every few seconds; they take precedence over those in the
+// configuration, which take precedence over the default tier.
+package tiers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/routing"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// StoreKey is the StateStore key holding the tenants assigned a tier at
+// runtime
+const StoreKey = "parsec:tiers"
+
+// Tier is a tenant's service tier
+type Tier string
+
+const (
+	Bronze Tier = "bronze"
+	Silver Tier = "silver"
+	Gold   Tier = "gold"
+)
+
+// Kafka acknowledgement levels a tier publishes with
+const (
+	AcksNone   = "none"
+	AcksLeader = "leader"
+	AcksAll    = "all"
+)
+
+var (
+	ErrUnknownTier  = errors.New("tier must be bronze, silver or gold")
+	ErrInvalidAcks  = errors.New(`acks must be "none", "leader" or "all"`)
+	ErrInvalidRate  = errors.New("events_per_second must not be negative")
+	ErrNotAssigned  = errors.New("tenant is not assigned a tier")
+	ErrStaticTier   = errors.New("tenant's tier is set in the configuration")
+	ErrInvalidTiers = errors.New("invalid tenant tiers")
+)
+
+// Tiers lists the tiers, lowest first
+var Tiers = []Tier{Bronze, Silver, Gold}
+
+// valid reports whether t is a known tier
+func (t Tier) valid() bool {
+	return t == Bronze || t == Silver || t == Gold
+}
+
+// Policy is what a tier's tenants get unless their own rules say otherwise
+type Policy struct {
+	// EventsPerSecond caps the tenant's events ingested by each node
+	// (0 = unlimited)
+	EventsPerSecond float64 `json:"events_per_second,omitempty"`
+
+	// Priority is the queue priority of the tenant's events (high, normal
+	// or low)
+	Priority string `json:"priority,omitempty"`
+
+	// Retention is the retention tier (short or long) and TTL the
+	// retention hint (e.g. "90d") of the tenant's events
+	Retention string `json:"retention,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+
+	// DebugSampleRate is the fraction of DEBUG events kept (0 = all)
+	DebugSampleRate float64 `json:"debug_sample_rate,omitempty"`
+
+	// Acks is how many Kafka replicas must acknowledge the tenant's events
+	// (none, leader or all; "" = the producer's setting)
+	Acks string `json:"acks,omitempty"`
+}
+
+// DefaultPolicies returns the built-in tier policies
+func DefaultPolicies() map[Tier]Policy {
+	return map[Tier]Policy{
+		Bronze: {
+			EventsPerSecond: 500,
+			Priority:        routing.PriorityLow,
+			Retention:       routing.RetentionShort,
+			DebugSampleRate: 0.1,
+			Acks:            AcksLeader,
+		},
+		Silver: {
+			EventsPerSecond: 5000,
+			Priority:        routing.PriorityNormal,
+			DebugSampleRate: 0.5,
+			Acks:            AcksLeader,
+		},
+		Gold: {
+			Priority:  routing.PriorityHigh,
+			Retention: routing.RetentionLong,
+			Acks:      AcksAll,
+		},
+	}
+}
+
+// Rules returns the policy's routing defaults as rules, evaluated after a
+// tenant's own
+func (p Policy) Rules(tier Tier) []routing.Rule {
+	var rules []routing.Rule
+	if p.Priority != "" {
+		rules = append(rules, routing.Rule{
+			Name:     "tier:" + string(tier) + ":priority",
+			Action:   routing.ActionPriority,
+			Priority: p.Priority,
+		})
+	}
+	if p.Retention != "" || p.TTL != "" {
+		rules = append(rules, routing.Rule{
+			Name:      "tier:" + string(tier) + ":retention",
+			Action:    routing.ActionRetention,
+			Retention: strings.ToLower(p.Retention),
+			TTL:       p.TTL,
+		})
+	}
+	if p.DebugSampleRate > 0 && p.DebugSampleRate < 1 {
+		rules = append(rules, routing.Rule{
+			Name:       "tier:" + string(tier) + ":sample",
+			Match:      routing.Match{Severities: []models.Severity{models.SeverityDebug}},
+			Action:     routing.ActionSample,
+			SampleRate: p.DebugSampleRate,
+		})
+	}
+	return rules
+}
+
+// Validate checks a tier's policy is well-formed
+func (p Policy) Validate(tier Tier) error {
+	if p.EventsPerSecond < 0 {
+		return ErrInvalidRate
+	}
+	if p.DebugSampleRate < 0 || p.DebugSampleRate > 1 {
+		return routing.ErrInvalidSample
+	}
+	switch p.Acks {
+	case "", AcksNone, AcksLeader, AcksAll:
+	default:
+		return ErrInvalidAcks
+	}
+	for _, rule := range p.Rules(tier) {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParsePolicies reads tier policies from JSON, e.g. {"gold": {...}}. Tiers
+// left out keep their built-in policy.
+func ParsePolicies(data []byte) (map[Tier]Policy, error) {
+	var policies map[Tier]Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("parse tier policies: %w", err)
+	}
+	return policies, nil
+}
+
+// ParseAssignments reads tenant=tier pairs, e.g. "acme=gold,globex=silver"
+func ParseAssignments(s string) (map[string]Tier, error) {
+	assignments := make(map[string]Tier)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		tenantID, tier, ok := strings.Cut(pair, "=")
+		if !ok || tenantID == "" {
+			return nil, fmt.Errorf("%w: %q: expected tenant=tier", ErrInvalidTiers, pair)
+		}
+		t := Tier(strings.ToLower(strings.TrimSpace(tier)))
+		if !t.valid() {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, ErrUnknownTier)
+		}
+		assignments[strings.TrimSpace(tenantID)] = t
+	}
+	return assignments, nil
+}
+
+// Config holds tier settings
+type Config struct {
+	// Policies override the built-in policies of the tiers they list
+	Policies map[Tier]Policy
+
+	// Assignments are tenants' tiers from the configuration
+	Assignments map[string]Tier
+
+	// Default is the tier of tenants not assigned one ("" = none, so their
+	// knobs keep the global settings)
+	Default Tier
+}
+
+// Assignment is a tenant's tier
+type Assignment struct {
+	TenantID string `json:"tenant_id"`
+	Tier     Tier   `json:"tier"`
+
+	// Static marks assignments from the configuration, which the admin
+	// API can override but not remove
+	Static bool `json:"static,omitempty"`
+
+	// By names who assigned the tier, for the audit trail
+	By    string     `json:"by,omitempty"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Registry holds the tier policies and tenants' tiers
+type Registry struct {
+	shared   *state.Versioned
+	policies map[Tier]Policy
+	rules    map[Tier][]routing.Rule
+	static   map[string]Tier
+	fallback Tier
+
+	// writing serializes changes, which read and write the store
+	writing sync.Mutex
+
+	mu       sync.RWMutex
+	assigned map[string]Assignment
+
+	// limiters hold the rate of tenants seen lately; full buckets are
+	// swept, as a new one would behave the same
+	limitMu  sync.Mutex
+	limiters map[string]*bucket
+	swept    time.Time
+}
+
+// sweepInterval is how often full rate limit buckets are dropped
+const sweepInterval = time.Second
+
+// NewRegistry creates a registry backed by store (may be nil), checking the
+// configured policies and assignments
+func NewRegistry(store state.StateStore, cfg Config) (*Registry, error) {
+	policies := DefaultPolicies()
+	for tier, policy := range cfg.Policies {
+		if !tier.valid() {
+			return nil, fmt.Errorf("policy %q: %w", tier, ErrUnknownTier)
+		}
+		policies[tier] = policy
+	}
+
+	r := &Registry{
+		policies: policies,
+		rules:    make(map[Tier][]routing.Rule, len(policies)),
+		static:   make(map[string]Tier, len(cfg.Assignments)),
+		assigned: make(map[string]Assignment),
+		limiters: make(map[string]*bucket),
+	}
+	for tier, policy := range policies {
+		if err := policy.Validate(tier); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", tier, err)
+		}
+		r.rules[tier] = policy.Rules(tier)
+	}
+	for tenantID, tier := range cfg.Assignments {
+		if !tier.valid() {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, ErrUnknownTier)
+		}
+		r.static[tenantID] = tier
+	}
+	if cfg.Default != "" && !cfg.Default.valid() {
+		return nil, fmt.Errorf("default tier: %w", ErrUnknownTier)
+	}
+	r.fallback = cfg.Default
+	if store != nil {
+		r.shared = state.NewVersioned(store, StoreKey)
+	}
+	r.count()
+	return r, nil
+}
+
+// Tier returns a tenant's tier. It is called for every event, so it only
+// touches memory. A nil registry tiers nobody.
+func (r *Registry) Tier(tenantID string) (Tier, bool) {
+	if r == nil || tenantID == "" {
+		return "", false
+	}
+
+	r.mu.RLock()
+	a, ok := r.assigned[tenantID]
+	r.mu.RUnlock()
+	if ok {
+		return a.Tier, true
+	}
+	if tier, ok := r.static[tenantID]; ok {
+		return tier, true
+	}
+	return r.fallback, r.fallback != ""
+}
+
+// Policy returns a tier's policy
+func (r *Registry) Policy(tier Tier) (Policy, bool) {
+	policy, ok := r.policies[tier]
+	return policy, ok
+}
+
+// Policies returns every tier's policy
+func (r *Registry) Policies() map[Tier]Policy {
+	out := make(map[Tier]Policy, len(r.policies))
+	for tier, policy := range r.policies {
+		out[tier] = policy
+	}
+	return out
+}
+
+// Rules returns the routing defaults of a tenant's tier, for the routing
+// engine to apply after the tenant's own rules
+func (r *Registry) Rules(tenantID string) []routing.Rule {
+	tier, ok := r.Tier(tenantID)
+	if !ok {
+		return nil
+	}
+	return r.rules[tier]
+}
+
+// Acks returns the Kafka acknowledgement level of a tenant's events ("" =
+// the producer's setting)
+func (r *Registry) Acks(tenantID string) string {
+	tier, ok := r.Tier(tenantID)
+	if !ok {
+		return ""
+	}
+	return r.policies[tier].Acks
+}
+
+// Allow takes one of a tenant's events from its tier's rate on this node,
+// reporting whether the event is within it
+func (r *Registry) Allow(tenantID string) bool {
+	tier, ok := r.Tier(tenantID)
+	if !ok {
+		return true
+	}
+	rate := r.policies[tier].EventsPerSecond
+	if rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	r.limitMu.Lock()
+	defer r.limitMu.Unlock()
+	if now.Sub(r.swept) >= sweepInterval {
+		r.sweep(now)
+	}
+	b, ok := r.limiters[tenantID]
+	if !ok {
+		b = &bucket{tokens: rate, lastFill: now}
+		r.limiters[tenantID] = b
+	}
+	return b.take(rate, now)
+}
+
+// sweep drops the buckets that have refilled, so tenants no longer sending
+// (or made-up tenant IDs) don't hold memory. Called with limitMu held.
+func (r *Registry) sweep(now time.Time) {
+	for tenantID, b := range r.limiters {
+		if b.full(now) {
+			delete(r.limiters, tenantID)
+		}
+	}
+	r.swept = now
+}
+
+// Limited returns how many tenants' rate limit buckets are held
+func (r *Registry) Limited() int {
+	r.limitMu.Lock()
+	defer r.limitMu.Unlock()
+	return len(r.limiters)
+}
+
+// List returns every tenant assigned a tier, sorted by tenant. Tenants on
+// the default tier are not listed.
+func (r *Registry) List() []Assignment {
+	r.mu.RLock()
+	out := make([]Assignment, 0, len(r.assigned)+len(r.static))
+	for _, a := range r.assigned {
+		out = append(out, a)
+	}
+	for tenantID, tier := range r.static {
+		if _, ok := r.assigned[tenantID]; !ok {
+			out = append(out, Assignment{TenantID: tenantID, Tier: tier, Static: true})
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].TenantID < out[j].TenantID })
+	return out
+}
+
+// Default returns the tier of tenants not assigned one ("" = none)
+func (r *Registry) Default() Tier {
+	return r.fallback
+}
+
+// Assign puts a tenant on a tier, replacing any earlier assignment
+func (r *Registry) Assign(ctx context.Context, a Assignment) (Assignment, error) {
+	a.Tier = Tier(strings.ToLower(string(a.Tier)))
+	if !a.Tier.valid() {
+		return Assignment{}, ErrUnknownTier
+	}
+	a.Static = false
+	if a.Since == nil {
+		now := time.Now().UTC()
+		a.Since = &now
+	}
+
+	err := r.update(ctx, func(assigned map[string]Assignment) {
+		assigned[a.TenantID] = a
+	})
+	return a, err
+}
+
+// Unassign removes a tenant's runtime assignment, returning it to its
+// configured or the default tier
+func (r *Registry) Unassign(ctx context.Context, tenantID string) error {
+	var existed bool
+	err := r.update(ctx, func(assigned map[string]Assignment) {
+		_, existed = assigned[tenantID]
+		delete(assigned, tenantID)
+	})
+	if err != nil {
+		return err
+	}
+	if !existed {
+		if _, static := r.static[tenantID]; static {
+			return ErrStaticTier
+		}
+		return ErrNotAssigned
+	}
+	return nil
+}
+
+// update applies change to the latest assignments and saves them. A store
+// without assignments (or one that keeps nothing) starts from those in
+// memory.
+func (r *Registry) update(ctx context.Context, change func(map[string]Assignment)) error {
+	r.writing.Lock()
+	defer r.writing.Unlock()
+
+	apply := func(data []byte) (map[string]Assignment, error) {
+		assigned := make(map[string]Assignment)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &assigned); err != nil {
+				return nil, fmt.Errorf("parse tier assignments: %w", err)
+			}
+		} else {
+			r.mu.RLock()
+			for tenantID, a := range r.assigned {
+				assigned[tenantID] = a
+			}
+			r.mu.RUnlock()
+		}
+		change(assigned)
+		return assigned, nil
+	}
+
+	if r.shared == nil {
+		assigned, err := apply(nil)
+		if err != nil {
+			return err
+		}
+		r.replace(assigned)
+		return nil
+	}
+
+	// Applied to the stored assignments, again if another node changed
+	// them meanwhile, so its change is kept
+	var assigned map[string]Assignment
+	err := r.shared.Update(ctx, func(data []byte) ([]byte, error) {
+		var err error
+		if assigned, err = apply(data); err != nil {
+			return nil, err
+		}
+		return json.Marshal(assigned)
+	})
+	if err != nil {
+		return err
+	}
+	r.replace(assigned)
+	return nil
+}
+
+// replace swaps in a new set of assignments
+func (r *Registry) replace(assigned map[string]Assignment) {
+	r.mu.Lock()
+	r.assigned = assigned
+	r.mu.Unlock()
+	r.count()
+}
+
+// count updates the gauge of tenants by tier
+func (r *Registry) count() {
+	counts := make(map[Tier]int, len(Tiers))
+	for _, tier := range Tiers {
+		counts[tier] = 0
+	}
+	for _, a := range r.List() {
+		counts[a.Tier]++
+	}
+	for tier, n := range counts {
+		metrics.TenantTiers.WithLabelValues(string(tier)).Set(float64(n))
+	}
+}
+
+// Load replaces the in-memory assignments with those in the store. A store
+// without any (or one that keeps nothing) leaves them as they are.
+func (r *Registry) Load(ctx context.Context) error {
+	if r.shared == nil {
+		return nil
+	}
+
+	data, err := r.shared.Get(ctx)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	assigned := make(map[string]Assignment)
+	if err := json.Unmarshal(data, &assigned); err != nil {
+		return fmt.Errorf("parse tier assignments: %w", err)
+	}
+	r.replace(assigned)
+	return nil
+}
+
+// Run reloads assignments periodically so changes made on other nodes
+// take effect here within interval
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("tiers")
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to reload tier assignments")
+			}
+		}
+	}
+}
+
+// bucket is a token bucket holding up to one second of a tenant's rate, or
+// one event for rates below one a second
+type bucket struct {
+	tokens   float64
+	rate     float64
+	lastFill time.Time
+}
+
+// take refills the bucket at rate and takes a token if there is one
+func (b *bucket) take(rate float64, now time.Time) bool {
+	b.tokens = min(b.tokens+now.Sub(b.lastFill).Seconds()*rate, max(rate, 1))
+	b.rate = rate
+	b.lastFill = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has refilled by now
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.lastFill).Seconds()*b.rate >= max(b.rate, 1)
+}
@@ -0,0 +1,215 @@
+package ui
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+// FeedConfig holds the sizes of a feed's buffers
+type FeedConfig struct {
+	// Size is how many recent events are kept for the tail (0 = 500)
+	Size int
+
+	// ErrorsPerTenant is how many recent errors are kept per tenant (0 = 50)
+	ErrorsPerTenant int
+
+	// MaxTenants bounds the tenants errors are kept for; the one whose last
+	// error is oldest makes room for a new one (0 = 200)
+	MaxTenants int
+
+	// Buffer is how many events a slow tail subscriber may fall behind
+	// before events are dropped for it (0 = 256)
+	Buffer int
+}
+
+// Entry is an ingested event as shown by the UI. It copies the fields the
+// UI needs so the event can go on through the pipeline.
+type Entry struct {
+	Received  time.Time       `json:"received"`
+	ID        string          `json:"id"`
+	TenantID  string          `json:"tenant_id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Severity  models.Severity `json:"severity"`
+	Source    string          `json:"source"`
+	Message   string          `json:"message"`
+}
+
+// TenantErrors is a tenant's recent ERROR and CRITICAL events
+type TenantErrors struct {
+	TenantID string    `json:"tenant_id"`
+	Count    uint64    `json:"count"`
+	Last     time.Time `json:"last"`
+
+	// Recent holds the latest errors, newest first
+	Recent []Entry `json:"recent"`
+}
+
+// subscriber is a live tail of one tenant, or all of them
+type subscriber struct {
+	tenantID string
+	ch       chan Entry
+}
+
+// Feed keeps recent ingested events in memory for the UI: a ring of the
+// latest events, the latest errors of each tenant, and live tails.
+// Observe is called for every event, so it only copies into buffers.
+type Feed struct {
+	cfg FeedConfig
+
+	mu     sync.Mutex
+	ring   []Entry
+	next   int
+	errors map[string]*TenantErrors
+	subs   map[*subscriber]struct{}
+}
+
+// NewFeed creates an empty feed
+func NewFeed(cfg FeedConfig) *Feed {
+	if cfg.Size <= 0 {
+		cfg.Size = 500
+	}
+	if cfg.ErrorsPerTenant <= 0 {
+		cfg.ErrorsPerTenant = 50
+	}
+	if cfg.MaxTenants <= 0 {
+		cfg.MaxTenants = 200
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 256
+	}
+	return &Feed{
+		cfg:    cfg,
+		ring:   make([]Entry, 0, cfg.Size),
+		errors: make(map[string]*TenantErrors),
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+// Observe records an ingested event. A nil feed records nothing.
+func (f *Feed) Observe(event *models.LogEvent) {
+	if f == nil {
+		return
+	}
+	entry := Entry{
+		Received:  time.Now(),
+		ID:        event.ID,
+		TenantID:  event.TenantID,
+		Timestamp: event.Timestamp,
+		Severity:  event.Severity,
+		Source:    event.Source,
+		Message:   event.Message,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.ring) < f.cfg.Size {
+		f.ring = append(f.ring, entry)
+	} else {
+		f.ring[f.next] = entry
+	}
+	f.next = (f.next + 1) % f.cfg.Size
+
+	if entry.Severity == models.SeverityError || entry.Severity == models.SeverityCritical {
+		f.recordError(entry)
+	}
+
+	for sub := range f.subs {
+		if sub.tenantID != "" && sub.tenantID != entry.TenantID {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default:
+			// A slow tail misses events rather than holding up ingest
+		}
+	}
+}
+
+// recordError adds an error to its tenant's; the caller holds mu
+func (f *Feed) recordError(entry Entry) {
+	te, ok := f.errors[entry.TenantID]
+	if !ok {
+		if len(f.errors) >= f.cfg.MaxTenants {
+			var oldest *TenantErrors
+			for _, other := range f.errors {
+				if oldest == nil || other.Last.Before(oldest.Last) {
+					oldest = other
+				}
+			}
+			delete(f.errors, oldest.TenantID)
+		}
+		te = &TenantErrors{TenantID: entry.TenantID}
+		f.errors[entry.TenantID] = te
+	}
+
+	te.Count++
+	te.Last = entry.Received
+	if len(te.Recent) < f.cfg.ErrorsPerTenant {
+		te.Recent = append(te.Recent, Entry{})
+	}
+	copy(te.Recent[1:], te.Recent)
+	te.Recent[0] = entry
+}
+
+// Recent returns up to limit of the latest events, of one tenant when
+// tenantID is set, oldest first
+func (f *Feed) Recent(tenantID string, limit int) []Entry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.recent(tenantID, limit)
+}
+
+// recent implements Recent; the caller holds mu
+func (f *Feed) recent(tenantID string, limit int) []Entry {
+	entries := []Entry{}
+	for i := 0; i < len(f.ring) && len(entries) < limit; i++ {
+		// Walk back from the newest
+		entry := f.ring[(f.next-1-i+2*len(f.ring))%len(f.ring)]
+		if tenantID == "" || entry.TenantID == tenantID {
+			entries = append(entries, entry)
+		}
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// Errors returns the recent errors of each tenant, the tenant with the
+// latest error first
+func (f *Feed) Errors() []TenantErrors {
+	f.mu.Lock()
+	list := make([]TenantErrors, 0, len(f.errors))
+	for _, te := range f.errors {
+		c := *te
+		c.Recent = append([]Entry(nil), te.Recent...)
+		list = append(list, c)
+	}
+	f.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Last.After(list[j].Last) })
+	return list
+}
+
+// Subscribe starts a live tail of events, of one tenant when tenantID is
+// set. It returns up to backlog recent events, oldest first, and the
+// channel of the events observed after them. Call cancel to stop the tail;
+// the channel is not closed.
+func (f *Feed) Subscribe(tenantID string, backlog int) (recent []Entry, events <-chan Entry, cancel func()) {
+	sub := &subscriber{tenantID: tenantID, ch: make(chan Entry, f.cfg.Buffer)}
+
+	f.mu.Lock()
+	recent = f.recent(tenantID, backlog)
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+
+	return recent, sub.ch, func() {
+		f.mu.Lock()
+		delete(f.subs, sub)
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,200 @@
+// Parsec operator console. Polls /stats, /slo-backed alerts and recent
+// errors, and streams the live tail; /ui/api requests carry the API key,
+// kept for the browser session only.
+"use strict";
+
+const POLL_MS = 5000;
+const MAX_TAIL_LINES = 1000;
+
+const $ = (id) => document.getElementById(id);
+
+let apiKey = sessionStorage.getItem("parsec-api-key") || "";
+let tail = null;
+let paused = false;
+
+function api(path, init = {}) {
+  const headers = Object.assign({ "X-API-Key": apiKey }, init.headers);
+  return fetch(path, Object.assign({}, init, { headers }));
+}
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function row(cells) {
+  const tr = el("tr");
+  for (const [text, className] of cells) tr.appendChild(el("td", text, className));
+  return tr;
+}
+
+function fixed(n, digits = 1) {
+  return Number(n || 0).toFixed(digits);
+}
+
+function bytes(n) {
+  const units = ["B", "KB", "MB", "GB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) { n /= 1024; i++; }
+  return fixed(n, i ? 1 : 0) + " " + units[i];
+}
+
+function duration(seconds) {
+  const d = Math.floor(seconds / 86400);
+  const h = Math.floor((seconds % 86400) / 3600);
+  const m = Math.floor((seconds % 3600) / 60);
+  return (d ? d + "d " : "") + h + "h " + m + "m";
+}
+
+function time(ts) {
+  return ts ? new Date(ts).toLocaleTimeString() : "never";
+}
+
+async function refreshStats() {
+  const resp = await fetch("/stats?top=0");
+  if (!resp.ok) return;
+  const s = await resp.json();
+
+  $("node").textContent = s.node_id;
+  $("queue").textContent = s.channel.buffered + " / " + s.channel.capacity + " (peak " + s.channel.peak + ")";
+  $("queue-bytes").textContent = s.channel.max_bytes ? bytes(s.channel.bytes) + " / " + bytes(s.channel.max_bytes) : "unbounded";
+  $("ingest-rate").textContent = fixed(s.rates.ingest_events["1m"]);
+  $("publish-rate").textContent = fixed(s.rates.publish_events["1m"]);
+  $("failure-rate").textContent = fixed(s.rates.failures["1m"]);
+  $("failure-rate").className = s.rates.failures["1m"] > 0 ? "alert" : "";
+  $("sent").textContent = s.producer.messages_sent;
+  $("failed").textContent = s.producer.messages_failed;
+  $("uptime").textContent = duration(s.uptime_seconds);
+}
+
+async function refreshAlerts() {
+  const resp = await api("/ui/api/alerts");
+  if (!resp.ok) return;
+  const state = await resp.json();
+
+  $("objectives").replaceChildren(...state.objectives.map((o) => row([
+    [o.name],
+    [fixed(o.sli * 100, 3) + "%"],
+    [fixed(o.error_budget_remaining * 100) + "%", o.error_budget_remaining < 0 ? "alert" : ""],
+    [o.alert || "ok", o.alert ? "alert" : "ok"],
+  ])));
+
+  const heartbeats = state.heartbeats.length ? state.heartbeats.map((h) => row([
+    [h.tenant_id],
+    [h.source],
+    [h.interval],
+    [time(h.last_seen)],
+    [h.missing ? "missing" : "ok", h.missing ? "missing" : "ok"],
+  ])) : [row([["no heartbeats registered", "muted"]])];
+  $("heartbeats").replaceChildren(...heartbeats);
+}
+
+async function refreshErrors() {
+  const resp = await api("/ui/api/errors");
+  if (!resp.ok) return;
+  const { tenants } = await resp.json();
+
+  if (!tenants.length) {
+    $("error-tenants").replaceChildren(el("p", "No errors since this node started.", "muted"));
+    return;
+  }
+  $("error-tenants").replaceChildren(...tenants.map((t) => {
+    const details = el("details");
+    const summary = el("summary");
+    summary.append(el("strong", t.tenant_id), " — " + t.count + " errors, last at " + time(t.last));
+    const list = el("ol");
+    for (const e of t.recent) list.appendChild(line(e));
+    details.append(summary, list);
+    return details;
+  }));
+}
+
+function line(e) {
+  const li = el("li");
+  li.append(
+    el("span", new Date(e.timestamp).toISOString(), "muted"),
+    el("span", e.tenant_id),
+    el("span", e.severity, e.severity),
+    el("span", e.source, "muted"),
+    e.message,
+  );
+  return li;
+}
+
+function addTailLine(e) {
+  const filter = $("tail-filter").value;
+  if (filter && !e.message.includes(filter) && !e.source.includes(filter)) return;
+
+  const lines = $("tail-lines");
+  const follow = lines.scrollTop + lines.clientHeight >= lines.scrollHeight - 4;
+  lines.appendChild(line(e));
+  while (lines.childElementCount > MAX_TAIL_LINES) lines.firstChild.remove();
+  if (follow) lines.scrollTop = lines.scrollHeight;
+}
+
+// startTail streams /ui/api/tail with fetch rather than EventSource, which
+// can't send the API key header
+async function startTail() {
+  if (tail) tail.abort();
+  const controller = new AbortController();
+  tail = controller;
+  $("tail-lines").replaceChildren();
+
+  const tenant = $("tail-tenant").value.trim();
+  const query = tenant ? "?tenant=" + encodeURIComponent(tenant) : "";
+  try {
+    const resp = await api("/ui/api/tail" + query, { signal: controller.signal });
+    if (!resp.ok) {
+      $("tail-status").textContent = resp.status === 401 ? "enter a valid API key" : "tail failed: " + resp.status;
+      return;
+    }
+    $("tail-status").textContent = "streaming";
+
+    const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffered = "";
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buffered += value;
+      let end;
+      while ((end = buffered.indexOf("\n\n")) >= 0) {
+        const message = buffered.slice(0, end);
+        buffered = buffered.slice(end + 2);
+        if (message.startsWith("data: ") && !paused) addTailLine(JSON.parse(message.slice(6)));
+      }
+    }
+    $("tail-status").textContent = "disconnected";
+  } catch (err) {
+    if (err.name !== "AbortError") $("tail-status").textContent = "disconnected";
+  }
+}
+
+function refresh() {
+  refreshStats().catch(() => {});
+  if (apiKey) {
+    refreshAlerts().catch(() => {});
+    refreshErrors().catch(() => {});
+  }
+}
+
+$("key-form").addEventListener("submit", (ev) => {
+  ev.preventDefault();
+  apiKey = $("key").value;
+  sessionStorage.setItem("parsec-api-key", apiKey);
+  refresh();
+  startTail();
+});
+
+$("tail-tenant").addEventListener("change", startTail);
+
+$("tail-toggle").addEventListener("click", () => {
+  paused = !paused;
+  $("tail-toggle").textContent = paused ? "Resume" : "Pause";
+});
+
+$("key").value = apiKey;
+refresh();
+if (apiKey) startTail();
+setInterval(refresh, POLL_MS);
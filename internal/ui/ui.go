@@ -0,0 +1,25 @@
+// Package ui is a small operator console embedded in the binary, for
+// standalone deployments without Grafana: a live tail of ingested events,
+// recent errors by tenant, queue and producer stats, and alert state. The
+// page is static and reads /stats and /slo plus the /ui/api endpoints,
+// sending the API key the operator enters.
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Assets serves the console's files under prefix, e.g. /ui/
+func Assets(prefix string) http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// static is embedded at build time, so this can't happen
+		panic(err)
+	}
+	return http.StripPrefix(prefix, http.FileServer(http.FS(files)))
+}
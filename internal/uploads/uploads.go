@@ -0,0 +1,626 @@
+// Package uploads accepts very large NDJSON dumps in resumable chunks. A
+// client creates an upload, appends chunks at explicit offsets (resending
+// any chunk that failed from the offset the server reports), then commits
+// it; the committed file is ingested in the background as a job, in
+// batches, through the same pipeline as /ingest. Upload data is kept on
+// the local disk of the node that created the upload, so every request for
+// an upload must reach that node; upload records live in the StateStore so
+// any node can report them.
+package uploads
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/jobs"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/rbac"
+	"parsec/internal/state"
+)
+
+// keyPrefix prefixes upload records in the StateStore, by upload ID
+const keyPrefix = "parsec:uploads:"
+
+// dataSuffix names an upload's data file in the upload directory
+const dataSuffix = ".ndjson"
+
+// maxErrors bounds the line errors kept in an upload record
+const maxErrors = 100
+
+// Upload statuses
+const (
+	StatusOpen      = "open"
+	StatusIngesting = "ingesting"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusAborted   = "aborted"
+)
+
+// Upload errors
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrWrongNode      = errors.New("upload is held by another node")
+	ErrNotOpen        = errors.New("upload is no longer open")
+	ErrOffsetMismatch = errors.New("offset does not match the upload")
+	ErrTooLarge       = errors.New("upload exceeds its size")
+	ErrIncomplete     = errors.New("upload is smaller than its declared size")
+	ErrEmpty          = errors.New("upload is empty")
+	ErrFinished       = errors.New("upload already finished")
+)
+
+// LineError is an event of an upload that was rejected, by line number
+// (from 1)
+type LineError struct {
+	Line    int64  `json:"line"`
+	EventID string `json:"event_id,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Upload is the record of a resumable upload
+type Upload struct {
+	ID   string `json:"id"`
+	Node string `json:"node"`
+
+	// Size is the size the client declared, if it did (0 = unknown)
+	Size int64 `json:"size,omitempty"`
+
+	// Offset is the number of bytes received, where the next chunk starts
+	Offset int64  `json:"offset"`
+	Status string `json:"status"`
+
+	// Lines counts the events read once ingestion started; the others
+	// count their outcomes. Errors lists the first rejected lines.
+	Lines    int64       `json:"lines"`
+	Accepted int64       `json:"accepted"`
+	Rejected int64       `json:"rejected"`
+	Dropped  int64       `json:"dropped"`
+	Errors   []LineError `json:"errors,omitempty"`
+
+	// Principal created the upload; its events are checked against the
+	// principal's tenants when ingested
+	Principal *rbac.Principal `json:"principal,omitempty"`
+
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Finished reports whether the upload has reached a final status
+func (u *Upload) Finished() bool {
+	return u.Status == StatusCompleted || u.Status == StatusFailed || u.Status == StatusAborted
+}
+
+// Result is the outcome of ingesting one batch of lines; error indexes are
+// positions in the batch
+type Result struct {
+	Accepted int
+	Rejected int
+	Dropped  int
+	Errors   []LineError
+}
+
+// Sink ingests a batch of NDJSON lines under batchID
+type Sink func(ctx context.Context, batchID string, lines [][]byte) Result
+
+// Config holds upload settings
+type Config struct {
+	// Dir holds the data of uploads in progress
+	Dir string
+
+	// NodeID is recorded on uploads created on this node
+	NodeID string
+
+	// MaxBytes bounds an upload's size (0 = 5GB)
+	MaxBytes int64
+
+	// TTL is how long an upload is kept after its last change (0 = 24h)
+	TTL time.Duration
+
+	// BatchSize is the number of lines ingested per batch (0 = 500)
+	BatchSize int
+
+	// MaxLineBytes bounds a line of the upload (0 = 1MB)
+	MaxLineBytes int
+
+	// Concurrency bounds uploads ingested at once (0 = 1)
+	Concurrency int
+}
+
+// Manager keeps resumable uploads and ingests them once committed
+type Manager struct {
+	store state.StateStore
+	sink  Sink
+	cfg   Config
+
+	// locks serializes changes to each upload
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+
+	// jobs ingests committed uploads; ownJobs is set when the manager
+	// created it
+	jobs    *jobs.Scheduler
+	ownJobs bool
+}
+
+// NewManager creates an upload manager, creating the upload directory
+func NewManager(store state.StateStore, sink Sink, cfg Config) (*Manager, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 5 * 1024 * 1024 * 1024
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = 1024 * 1024
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create upload directory: %w", err)
+	}
+
+	m := &Manager{
+		store: store,
+		sink:  sink,
+		cfg:   cfg,
+		locks: make(map[string]*sync.Mutex),
+	}
+	m.jobs, m.ownJobs = jobs.NewScheduler(store, jobs.Config{NodeID: cfg.NodeID}), true
+	m.jobs.SetLimit(jobs.KindUpload, cfg.Concurrency)
+	return m, nil
+}
+
+// WithScheduler ingests uploads on a shared scheduler, which its owner
+// closes
+func (m *Manager) WithScheduler(s *jobs.Scheduler) *Manager {
+	m.jobs, m.ownJobs = s, false
+	s.SetLimit(jobs.KindUpload, m.cfg.Concurrency)
+	return m
+}
+
+// Close cancels uploads being ingested, marking them failed, and waits for
+// them. A shared scheduler is left to its owner.
+func (m *Manager) Close() {
+	if m.ownJobs {
+		m.jobs.Close()
+	}
+}
+
+// uploadKey is the StateStore key of an upload
+func uploadKey(id string) string {
+	return keyPrefix + id
+}
+
+// path is the data file of an upload
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.cfg.Dir, id+dataSuffix)
+}
+
+// lock locks an upload, returning its unlock function
+func (m *Manager) lock(id string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		m.locks[id] = l
+	}
+	m.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// forget drops the lock of a finished upload
+func (m *Manager) forget(id string) {
+	m.mu.Lock()
+	delete(m.locks, id)
+	m.mu.Unlock()
+}
+
+// Create starts an upload of size bytes (0 = unknown), ingested later as
+// the principal in ctx, if any
+func (m *Manager) Create(ctx context.Context, size int64) (*Upload, error) {
+	if size < 0 || size > m.cfg.MaxBytes {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, m.cfg.MaxBytes)
+	}
+
+	now := time.Now().UTC()
+	upload := &Upload{
+		ID:        uuid.New().String(),
+		Node:      m.cfg.NodeID,
+		Size:      size,
+		Status:    StatusOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if principal, ok := rbac.FromContext(ctx); ok {
+		upload.Principal = principal
+	}
+
+	file, err := os.OpenFile(m.path(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create upload file: %w", err)
+	}
+	file.Close()
+
+	if err := m.save(ctx, upload); err != nil {
+		os.Remove(m.path(upload.ID))
+		return nil, err
+	}
+	metrics.UploadsTotal.WithLabelValues("created").Inc()
+	return upload, nil
+}
+
+// Get returns an upload's record
+func (m *Manager) Get(ctx context.Context, id string) (*Upload, error) {
+	data, err := m.store.Get(ctx, uploadKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("parse upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// local returns an open upload held by this node
+func (m *Manager) local(ctx context.Context, id string) (*Upload, error) {
+	upload, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Node != m.cfg.NodeID {
+		return upload, fmt.Errorf("%w (%s)", ErrWrongNode, upload.Node)
+	}
+	if upload.Status != StatusOpen {
+		return upload, ErrNotOpen
+	}
+	return upload, nil
+}
+
+// Append writes a chunk read from r at offset, which must be the upload's
+// current offset. A chunk that can't be read in full is discarded, so the
+// client resends it from the same offset. The upload is returned with
+// errors about its state, so callers can report its offset.
+func (m *Manager) Append(ctx context.Context, id string, offset int64, r io.Reader) (*Upload, error) {
+	defer m.lock(id)()
+
+	upload, err := m.local(ctx, id)
+	if err != nil {
+		return upload, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	limit := m.cfg.MaxBytes
+	if upload.Size > 0 {
+		limit = upload.Size
+	}
+
+	file, err := os.OpenFile(m.path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return upload, fmt.Errorf("open upload file: %w", err)
+	}
+	defer file.Close()
+
+	// Bytes past the recorded offset are from a chunk that never completed
+	if err := file.Truncate(upload.Offset); err != nil {
+		return upload, fmt.Errorf("truncate upload file: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return upload, err
+	}
+
+	n, err := io.Copy(file, io.LimitReader(r, limit-upload.Offset+1))
+	switch {
+	case err != nil:
+	case upload.Offset+n > limit:
+		err = fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, limit)
+	default:
+		// The offset is only recorded once the chunk is durable
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(upload.Offset)
+		return upload, err
+	}
+
+	upload.Offset += n
+	upload.UpdatedAt = time.Now().UTC()
+	if err := m.save(ctx, upload); err != nil {
+		upload.Offset -= n
+		file.Truncate(upload.Offset)
+		return upload, err
+	}
+	metrics.UploadBytes.Add(float64(n))
+	return upload, nil
+}
+
+// Commit closes an upload and queues it for ingestion
+func (m *Manager) Commit(ctx context.Context, id string) (*Upload, error) {
+	defer m.lock(id)()
+
+	upload, err := m.local(ctx, id)
+	if err != nil {
+		return upload, err
+	}
+	if upload.Offset == 0 {
+		return upload, ErrEmpty
+	}
+	if upload.Size > 0 && upload.Offset != upload.Size {
+		return upload, ErrIncomplete
+	}
+
+	upload.Status = StatusIngesting
+	upload.UpdatedAt = time.Now().UTC()
+	if err := m.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	metrics.UploadsTotal.WithLabelValues("committed").Inc()
+
+	// The job works on its own copy so the caller's view stays stable
+	job := *upload
+	_, err = m.jobs.Submit(ctx, jobs.Task{
+		ID:     upload.ID,
+		Kind:   jobs.KindUpload,
+		Detail: "/uploads/" + upload.ID,
+		Run: func(ctx context.Context, report func(jobs.Progress)) error {
+			return m.ingest(ctx, &job, report)
+		},
+		Finish: func(err error) { m.finish(&job, err) },
+	})
+	if err != nil {
+		m.finish(&job, err)
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Abort discards an open upload, or cancels one being ingested (events
+// already ingested stay ingested)
+func (m *Manager) Abort(ctx context.Context, id string) (*Upload, error) {
+	unlock := m.lock(id)
+
+	upload, err := m.Get(ctx, id)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if upload.Finished() {
+		unlock()
+		return upload, ErrFinished
+	}
+	if upload.Node != m.cfg.NodeID {
+		unlock()
+		return upload, fmt.Errorf("%w (%s)", ErrWrongNode, upload.Node)
+	}
+
+	if upload.Status == StatusIngesting {
+		// The job records the outcome when it stops
+		unlock()
+		if _, err := m.jobs.Cancel(ctx, id); err != nil && !errors.Is(err, jobs.ErrJobFinished) {
+			return upload, err
+		}
+		return upload, nil
+	}
+
+	defer unlock()
+	now := time.Now().UTC()
+	upload.Status, upload.UpdatedAt, upload.CompletedAt = StatusAborted, now, &now
+	if err := m.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	os.Remove(m.path(id))
+	m.forget(id)
+	metrics.UploadsTotal.WithLabelValues(StatusAborted).Inc()
+	return upload, nil
+}
+
+// ingest reads a committed upload's lines and ingests them in batches,
+// recording the running totals after each batch
+func (m *Manager) ingest(ctx context.Context, upload *Upload, report func(jobs.Progress)) error {
+	log := logger.WithComponent("uploads").With().Str("upload_id", upload.ID).Logger()
+	if upload.Principal != nil {
+		ctx = rbac.NewContext(ctx, upload.Principal)
+	}
+
+	file, err := os.Open(m.path(upload.ID))
+	if err != nil {
+		return fmt.Errorf("open upload file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), m.cfg.MaxLineBytes)
+
+	var (
+		read    int64
+		line    int64
+		lines   = make([][]byte, 0, m.cfg.BatchSize)
+		numbers = make([]int64, 0, m.cfg.BatchSize)
+		batch   int
+	)
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		batch++
+		result := m.sink(ctx, upload.ID+"-"+strconv.Itoa(batch), lines)
+		upload.Accepted += int64(result.Accepted)
+		upload.Rejected += int64(result.Rejected)
+		upload.Dropped += int64(result.Dropped)
+		for _, e := range result.Errors {
+			if len(upload.Errors) == maxErrors {
+				break
+			}
+			if e.Line >= 0 && e.Line < int64(len(numbers)) {
+				e.Line = numbers[e.Line]
+			}
+			upload.Errors = append(upload.Errors, e)
+		}
+		lines, numbers = lines[:0], numbers[:0]
+
+		upload.UpdatedAt = time.Now().UTC()
+		if err := m.save(ctx, upload); err != nil {
+			log.Warn().Err(err).Msg("failed to record upload progress")
+		}
+		report(jobs.Progress{Done: read, Total: upload.Offset, Unit: "bytes"})
+	}
+
+	for scanner.Scan() {
+		line++
+		read += int64(len(scanner.Bytes())) + 1
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// The scanner reuses its buffer
+		lines = append(lines, bytes.Clone(text))
+		numbers = append(numbers, line)
+		upload.Lines++
+		if len(lines) == m.cfg.BatchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		flush()
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d exceeds %d bytes", line+1, m.cfg.MaxLineBytes)
+		}
+		return fmt.Errorf("read upload: %w", err)
+	}
+	flush()
+	return ctx.Err()
+}
+
+// finish records an upload's outcome and removes its data
+func (m *Manager) finish(upload *Upload, err error) {
+	log := logger.WithComponent("uploads")
+
+	now := time.Now().UTC()
+	upload.UpdatedAt, upload.CompletedAt = now, &now
+	switch {
+	case errors.Is(err, jobs.ErrCancelled):
+		upload.Status, upload.Error = StatusAborted, err.Error()
+	case err != nil:
+		upload.Status, upload.Error = StatusFailed, err.Error()
+	default:
+		upload.Status = StatusCompleted
+	}
+	metrics.UploadsTotal.WithLabelValues(upload.Status).Inc()
+
+	// The job context may be cancelled; the final status must still land
+	if saveErr := m.save(context.Background(), upload); saveErr != nil {
+		log.Error().Err(saveErr).Str("upload_id", upload.ID).Msg("failed to record upload result")
+	}
+	os.Remove(m.path(upload.ID))
+	m.forget(upload.ID)
+
+	event := log.Info()
+	if upload.Status == StatusFailed {
+		event = log.Error().Err(err)
+	}
+	event.
+		Str("upload_id", upload.ID).
+		Str("status", upload.Status).
+		Int64("bytes", upload.Offset).
+		Int64("lines", upload.Lines).
+		Int64("accepted", upload.Accepted).
+		Int64("rejected", upload.Rejected).
+		Msg("upload finished")
+}
+
+// Run removes the data of expired uploads every interval until ctx is
+// cancelled. Uploads this node was ingesting when it stopped are marked
+// failed first, as their jobs died with it.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	m.sweep(ctx, true)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sweep(ctx, false)
+		}
+	}
+}
+
+// sweep removes data files whose upload record has expired or finished,
+// and on startup fails uploads left ingesting
+func (m *Manager) sweep(ctx context.Context, startup bool) {
+	log := logger.WithComponent("uploads")
+
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if err != nil {
+		log.Warn().Err(err).Str("dir", m.cfg.Dir).Msg("failed to list uploads")
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), dataSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		unlock := m.lock(id)
+		upload, err := m.Get(ctx, id)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			os.Remove(m.path(id))
+			m.forget(id)
+			log.Info().Str("upload_id", id).Msg("removed expired upload")
+		case err != nil:
+			log.Warn().Err(err).Str("upload_id", id).Msg("failed to read upload")
+		case upload.Finished():
+			os.Remove(m.path(id))
+			m.forget(id)
+		case startup && upload.Status == StatusIngesting && upload.Node == m.cfg.NodeID:
+			m.finish(upload, errors.New("node restarted while the upload was being ingested"))
+		}
+		unlock()
+	}
+}
+
+// save writes an upload record with the upload TTL
+func (m *Manager) save(ctx context.Context, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	key := uploadKey(upload.ID)
+	if err := m.store.Set(ctx, key, data); err != nil {
+		return err
+	}
+	_, err = m.store.Expire(ctx, key, m.cfg.TTL)
+	return err
+}
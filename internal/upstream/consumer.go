@@ -0,0 +1,198 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/pkg/models"
+)
+
+// Sink receives upstream events; the ingest handler implements it
+type Sink interface {
+	Submit(ctx context.Context, event *models.LogEvent) error
+}
+
+// Queue-full and read-error backoff bounds
+const (
+	minBackoff = 10 * time.Millisecond
+	maxBackoff = time.Second
+)
+
+// Consumer reads upstream topics as a consumer group and submits each
+// message as an event. Offsets are committed once a message is accepted or
+// rejected, so messages are ingested at least once.
+type Consumer struct {
+	reader  *kafka.Reader
+	decoder *Decoder
+	sink    Sink
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a consumer. kafkaCfg supplies the default brokers and the
+// topics Parsec publishes to, which cannot be consumed from the same
+// cluster without feeding Parsec its own output.
+func New(cfg config.UpstreamConfig, kafkaCfg config.KafkaConfig, sink Sink) (*Consumer, error) {
+	var topics []string
+	for _, topic := range cfg.Topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("upstream requires at least one topic")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("upstream group ID is required")
+	}
+
+	brokers := cfg.Brokers
+	if len(brokers) == 0 {
+		brokers = kafkaCfg.Brokers
+		own := map[string]bool{kafkaCfg.Topic: true, kafkaCfg.ShortRetentionTopic: true, kafkaCfg.LongRetentionTopic: true}
+		for _, topic := range topics {
+			if own[topic] {
+				return nil, fmt.Errorf("upstream topic %q is one Parsec publishes to", topic)
+			}
+		}
+	}
+
+	var startOffset int64
+	switch cfg.StartOffset {
+	case "", "latest":
+		startOffset = kafka.LastOffset
+	case "earliest":
+		startOffset = kafka.FirstOffset
+	default:
+		return nil, fmt.Errorf("unknown upstream start offset %q", cfg.StartOffset)
+	}
+
+	decoder, err := NewDecoder(cfg.Format, cfg.Tenant, cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		GroupID:     cfg.GroupID,
+		GroupTopics: topics,
+		StartOffset: startOffset,
+		MinBytes:    kafkaCfg.Consumer.MinBytes,
+		MaxBytes:    kafkaCfg.Consumer.MaxBytes,
+		MaxWait:     kafkaCfg.Consumer.MaxWait,
+
+		// Commits are batched in the background
+		CommitInterval: time.Second,
+	})
+
+	return &Consumer{reader: reader, decoder: decoder, sink: sink}, nil
+}
+
+// Start consumes in the background until Close
+func (c *Consumer) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.consume(ctx)
+	}()
+}
+
+// Close stops consuming and commits the offsets of handled messages
+func (c *Consumer) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+	return c.reader.Close()
+}
+
+// consume fetches, submits and commits messages until ctx is cancelled
+func (c *Consumer) consume(ctx context.Context) {
+	log := logger.WithComponent("upstream")
+	backoff := minBackoff
+
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to fetch upstream message")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+
+		if !c.handle(ctx, msg) {
+			return
+		}
+		if err := c.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("topic", msg.Topic).Msg("failed to commit upstream offset")
+		}
+	}
+}
+
+// handle decodes and submits a message, waiting out a full queue. It
+// returns false if ctx ended before the message was handled.
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) bool {
+	log := logger.WithComponent("upstream")
+
+	event, err := c.decoder.Decode(msg)
+	if err != nil {
+		metrics.UpstreamMessages.WithLabelValues(msg.Topic, "malformed").Inc()
+		log.Warn().
+			Err(err).
+			Str("topic", msg.Topic).
+			Int("partition", msg.Partition).
+			Int64("offset", msg.Offset).
+			Msg("skipping malformed upstream message")
+		return true
+	}
+
+	backoff := minBackoff
+	for {
+		err = c.sink.Submit(ctx, event)
+		if !errors.Is(err, handlers.ErrQueueFull) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		// Submit modifies the event, so each attempt gets a fresh one
+		event, _ = c.decoder.Decode(msg)
+	}
+
+	if err != nil {
+		metrics.UpstreamMessages.WithLabelValues(msg.Topic, "rejected").Inc()
+		log.Warn().
+			Err(err).
+			Str("topic", msg.Topic).
+			Int64("offset", msg.Offset).
+			Msg("upstream message rejected")
+		return true
+	}
+	metrics.UpstreamMessages.WithLabelValues(msg.Topic, "ingested").Inc()
+	return true
+}
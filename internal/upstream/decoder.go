@@ -0,0 +1,287 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"parsec/pkg/models"
+)
+
+// Message formats
+const (
+	FormatAuto = "auto"
+	FormatJSON = "json"
+	FormatRaw  = "raw"
+)
+
+// Metadata keys recording where a message was consumed from
+const (
+	MetadataTopic     = "kafka_topic"
+	MetadataPartition = "kafka_partition"
+	MetadataOffset    = "kafka_offset"
+)
+
+// upstreamNamespace derives stable event IDs from message positions, so a
+// message redelivered after a restart keeps its ID
+var upstreamNamespace = uuid.MustParse("5c2f8e1a-9b3d-4a6e-8c7f-1e0d2b4a6c83")
+
+var (
+	ErrEmptyMessage = errors.New("upstream message is empty")
+	ErrNotObject    = errors.New("upstream message is not a JSON object")
+	ErrNoMessage    = errors.New("upstream JSON has no message field")
+)
+
+// Field names accepted for each event field, in order of preference
+var (
+	messageFields   = []string{"message", "msg", "log"}
+	timestampFields = []string{"timestamp", "@timestamp", "time", "ts"}
+	severityFields  = []string{"severity", "level", "lvl"}
+	sourceFields    = []string{"source", "service"}
+	tenantFields    = []string{"tenant_id", "tenant"}
+)
+
+// levels maps common level names to severities
+var levels = map[string]models.Severity{
+	"trace":    models.SeverityDebug,
+	"debug":    models.SeverityDebug,
+	"info":     models.SeverityInfo,
+	"notice":   models.SeverityInfo,
+	"warn":     models.SeverityWarning,
+	"warning":  models.SeverityWarning,
+	"error":    models.SeverityError,
+	"err":      models.SeverityError,
+	"critical": models.SeverityCritical,
+	"crit":     models.SeverityCritical,
+	"fatal":    models.SeverityCritical,
+	"panic":    models.SeverityCritical,
+	"alert":    models.SeverityCritical,
+	"emerg":    models.SeverityCritical,
+}
+
+// Decoder converts upstream Kafka messages to LogEvents
+type Decoder struct {
+	format string
+	tenant string
+	source string
+}
+
+// NewDecoder creates a decoder. Events without a tenant or source get the
+// given ones; an empty source means the topic name.
+func NewDecoder(format, tenant, source string) (*Decoder, error) {
+	switch format {
+	case "":
+		format = FormatAuto
+	case FormatAuto, FormatJSON, FormatRaw:
+	default:
+		return nil, fmt.Errorf("unknown upstream format %q", format)
+	}
+	if tenant == "" {
+		return nil, errors.New("upstream tenant is required")
+	}
+	return &Decoder{format: format, tenant: tenant, source: source}, nil
+}
+
+// Decode converts a Kafka message. Fields the message lacks default to the
+// decoder's tenant and source, the Kafka timestamp and an ID derived from
+// the message's position.
+func (d *Decoder) Decode(msg kafka.Message) (*models.LogEvent, error) {
+	event, err := d.Parse(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.ID == "" {
+		position := msg.Topic + "/" + strconv.Itoa(msg.Partition) + "/" + strconv.FormatInt(msg.Offset, 10)
+		event.ID = uuid.NewSHA1(upstreamNamespace, []byte(position)).String()
+	}
+	if event.Source == "" {
+		event.Source = msg.Topic
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = msg.Time.UTC()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	if event.Metadata == nil {
+		event.Metadata = make(models.Metadata, 3)
+	}
+	event.Metadata[MetadataTopic] = msg.Topic
+	event.Metadata[MetadataPartition] = strconv.Itoa(msg.Partition)
+	event.Metadata[MetadataOffset] = strconv.FormatInt(msg.Offset, 10)
+	return event, nil
+}
+
+// Parse converts a message payload. JSON objects map their well-known
+// fields (message/msg/log, level, timestamp, ...) onto the event and keep
+// the rest as metadata; raw values become the message. The decoder's
+// tenant and source fill in for missing ones; the ID and timestamp are left
+// empty when the payload has none.
+func (d *Decoder) Parse(payload []byte) (*models.LogEvent, error) {
+	value := bytes.TrimSpace(payload)
+	if len(value) == 0 {
+		return nil, ErrEmptyMessage
+	}
+
+	event := &models.LogEvent{Severity: models.SeverityInfo}
+	switch {
+	case d.format == FormatRaw:
+		event.Message = string(value)
+	case d.format == FormatJSON || value[0] == '{':
+		if err := decodeJSON(value, event); err != nil {
+			if d.format == FormatJSON {
+				return nil, err
+			}
+			// auto: not an event after all, keep the line
+			*event = models.LogEvent{Severity: models.SeverityInfo, Message: string(value)}
+		}
+	default:
+		event.Message = string(value)
+	}
+
+	if event.TenantID == "" {
+		event.TenantID = d.tenant
+	}
+	if event.Source == "" {
+		event.Source = d.source
+	}
+	return event, nil
+}
+
+// decodeJSON maps a JSON object onto event
+func decodeJSON(value []byte, event *models.LogEvent) error {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		return ErrNotObject
+	}
+
+	message, ok := take(fields, messageFields)
+	if !ok {
+		return ErrNoMessage
+	}
+	event.Message = text(message)
+
+	event.ID = takeString(fields, "id")
+	event.TenantID = takeString(fields, tenantFields...)
+	event.Source = takeString(fields, sourceFields...)
+	event.TraceID = takeString(fields, "trace_id")
+	event.SpanID = takeString(fields, "span_id")
+
+	if level, ok := take(fields, severityFields); ok {
+		event.Severity = severity(text(level))
+	}
+	if ts, ok := take(fields, timestampFields); ok {
+		event.Timestamp = timestamp(ts)
+	}
+
+	// Explicit metadata first, then the remaining fields in key order.
+	// Values keep their JSON structure.
+	metadata := make(models.Metadata)
+	if nested, ok := fields["metadata"].(map[string]any); ok {
+		for k, v := range nested {
+			metadata[k] = v
+		}
+		delete(fields, "metadata")
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Leave room for the position keys
+		if len(metadata) >= models.MaxMetadataKeys-3 {
+			break
+		}
+		if _, exists := metadata[k]; !exists && fields[k] != nil {
+			metadata[k] = fields[k]
+		}
+	}
+	if len(metadata) > 0 {
+		event.Metadata = metadata
+	}
+	return nil
+}
+
+// take removes and returns the first present field of names
+func take(fields map[string]any, names []string) (any, bool) {
+	for _, name := range names {
+		if v, ok := fields[name]; ok && v != nil {
+			for _, n := range names {
+				delete(fields, n)
+			}
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// takeString removes and returns the first present field as a string
+func takeString(fields map[string]any, names ...string) string {
+	v, ok := take(fields, names)
+	if !ok {
+		return ""
+	}
+	return text(v)
+}
+
+// text renders a JSON value as a string; objects and arrays stay JSON
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// severity maps a level name (any case) to a severity; unknown levels are
+// INFO
+func severity(level string) models.Severity {
+	if s, ok := levels[strings.ToLower(strings.TrimSpace(level))]; ok {
+		return s
+	}
+	return models.SeverityInfo
+}
+
+// timestamp parses a timestamp string, or Unix seconds or milliseconds. An
+// unparseable timestamp is left zero so the Kafka timestamp is used.
+func timestamp(v any) time.Time {
+	switch v := v.(type) {
+	case string:
+		ts, err := models.ParseTimestamp(v)
+		if err != nil {
+			return time.Time{}
+		}
+		return ts.UTC()
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}
+		}
+		if f > 1e12 {
+			return time.UnixMilli(int64(f)).UTC()
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)).UTC()
+	default:
+		return time.Time{}
+	}
+}
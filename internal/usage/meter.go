@@ -0,0 +1,240 @@
+// Package usage meters what each tenant uses, for billing: the events and
+// bytes published, and the queries run. Every node counts in memory and
+// adds its counts to per-month totals in the StateStore every few seconds.
+// Once a month has ended, one node rolls its totals up into a report with
+// each tenant's storage footprint, kept in the store and exported as CSV
+// and JSON.
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"parsec/internal/logger"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// keyPrefix prefixes the monthly totals and tenant lists
+const keyPrefix = "parsec:usage:"
+
+// MonthLayout formats months in keys, reports and URLs, e.g. 2024-06
+const MonthLayout = "2006-01"
+
+// Counted quantities, suffixing the monthly total keys
+const (
+	counterEvents  = "events"
+	counterBytes   = "bytes"
+	counterQueries = "queries"
+)
+
+// counts is what a tenant used in a month on this node since the last flush
+type counts struct {
+	events, bytes, queries int64
+}
+
+// meterKey groups counts by month and tenant
+type meterKey struct {
+	month, tenantID string
+}
+
+// Meter counts tenants' usage on this node. A nil Meter counts nothing.
+type Meter struct {
+	store state.StateStore
+
+	mu     sync.Mutex
+	counts map[meterKey]*counts
+}
+
+// NewMeter creates a meter adding its counts to store
+func NewMeter(store state.StateStore) *Meter {
+	return &Meter{store: store, counts: make(map[meterKey]*counts)}
+}
+
+// Month returns the month of t, as keys and reports name it
+func Month(t time.Time) string {
+	return t.UTC().Format(MonthLayout)
+}
+
+// Published counts published envelopes against their tenants. It is called
+// for every publish, so it only touches memory.
+func (m *Meter) Published(envelopes []*models.Envelope) {
+	if m == nil || len(envelopes) == 0 {
+		return
+	}
+	month := Month(time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, envelope := range envelopes {
+		if envelope.Event == nil {
+			continue
+		}
+		c := m.get(month, envelope.Event.TenantID)
+		c.events++
+		c.bytes += int64(envelope.Event.Size())
+	}
+}
+
+// Query counts a query run for a tenant
+func (m *Meter) Query(tenantID string) {
+	if m == nil {
+		return
+	}
+	month := Month(time.Now())
+
+	m.mu.Lock()
+	m.get(month, tenantID).queries++
+	m.mu.Unlock()
+}
+
+// get returns a tenant's counts for a month; the caller holds mu
+func (m *Meter) get(month, tenantID string) *counts {
+	key := meterKey{month: month, tenantID: tenantID}
+	c, ok := m.counts[key]
+	if !ok {
+		c = &counts{}
+		m.counts[key] = c
+	}
+	return c
+}
+
+// Flush adds the counts since the last flush to the monthly totals. Counts
+// that fail to be added are kept for the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.counts
+	m.counts = make(map[meterKey]*counts, len(pending))
+	m.mu.Unlock()
+
+	// Tenants are listed first, so no total goes unreported
+	months := make(map[string][]string)
+	for key := range pending {
+		months[key.month] = append(months[key.month], key.tenantID)
+	}
+	for month, ids := range months {
+		if err := m.addTenants(ctx, month, ids); err != nil {
+			for key, c := range pending {
+				m.restore(key, c)
+			}
+			return err
+		}
+	}
+
+	var failed error
+	for key, c := range pending {
+		if failed == nil {
+			failed = m.add(ctx, key, c)
+		}
+		if failed != nil {
+			m.restore(key, c)
+		}
+	}
+	return failed
+}
+
+// add adds one tenant's counts to its monthly totals
+func (m *Meter) add(ctx context.Context, key meterKey, c *counts) error {
+	for counter, n := range map[string]*int64{counterEvents: &c.events, counterBytes: &c.bytes, counterQueries: &c.queries} {
+		if *n == 0 {
+			continue
+		}
+		if _, err := m.store.Incr(ctx, totalKey(key.month, key.tenantID, counter), *n); err != nil {
+			return err
+		}
+		// Zeroed so a later failure doesn't restore what was added
+		*n = 0
+	}
+	return nil
+}
+
+// restore returns unflushed counts to the meter
+func (m *Meter) restore(key meterKey, c *counts) {
+	m.mu.Lock()
+	into := m.get(key.month, key.tenantID)
+	into.events += c.events
+	into.bytes += c.bytes
+	into.queries += c.queries
+	m.mu.Unlock()
+}
+
+// addTenants adds tenants to a month's list, which reports are built from.
+// Nodes flushing at once each add theirs as a new version of the list.
+func (m *Meter) addTenants(ctx context.Context, month string, ids []string) error {
+	known, err := tenants(ctx, m.store, month)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(ids, func(id string) bool { return !slices.Contains(known, id) }) {
+		return nil
+	}
+	return state.NewVersioned(m.store, tenantsKey(month)).Update(ctx, func(current []byte) ([]byte, error) {
+		var listed []string
+		if len(current) > 0 {
+			if err := json.Unmarshal(current, &listed); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range ids {
+			if !slices.Contains(listed, id) {
+				listed = append(listed, id)
+			}
+		}
+		slices.Sort(listed)
+		return json.Marshal(listed)
+	})
+}
+
+// Run flushes the counts every interval until ctx is cancelled, then
+// flushes once more
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	log := logger.WithComponent("usage")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+			if err := m.Flush(flushCtx); err != nil {
+				log.Warn().Err(err).Msg("failed to flush usage on shutdown")
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				log.Warn().Err(err).Msg("failed to flush usage")
+			}
+		}
+	}
+}
+
+// tenants reads the tenants with usage in a month
+func tenants(ctx context.Context, store state.StateStore, month string) ([]string, error) {
+	data, err := state.NewVersioned(store, tenantsKey(month)).Get(ctx)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// totalKey is the StateStore key of a tenant's monthly total of counter
+func totalKey(month, tenantID, counter string) string {
+	return keyPrefix + month + ":" + tenantID + ":" + counter
+}
+
+// tenantsKey is the StateStore key listing a month's tenants
+func tenantsKey(month string) string {
+	return keyPrefix + month + ":tenants"
+}
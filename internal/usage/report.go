@@ -0,0 +1,436 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/internal/jobs"
+	"parsec/internal/logger"
+	"parsec/internal/metrics"
+	"parsec/internal/objstore"
+	"parsec/internal/state"
+)
+
+// Report statuses, following the report's job
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// StateStore keys of reports: each report, the months reported, and the
+// claim of the node rolling a month up
+const (
+	reportPrefix = "parsec:usage:report:"
+	reportsKey   = "parsec:usage:reports"
+	claimPrefix  = "parsec:usage:claim:"
+)
+
+var (
+	ErrInvalidMonth   = errors.New("month must be the current or a past month, as YYYY-MM")
+	ErrReportNotFound = errors.New("usage report not found")
+	ErrReportRunning  = errors.New("usage report is already being generated")
+)
+
+// TenantUsage is what a tenant used in a month
+type TenantUsage struct {
+	TenantID string `json:"tenant_id"`
+	Events   int64  `json:"events"`
+	Bytes    int64  `json:"bytes"`
+
+	// StorageBytes is the size of the tenant's archived objects when the
+	// report was generated
+	StorageBytes int64 `json:"storage_bytes"`
+	Queries      int64 `json:"queries"`
+}
+
+// Report is a month's usage by tenant
+type Report struct {
+	Month  string `json:"month"`
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Tenants is empty in report listings
+	Tenants []TenantUsage `json:"tenants,omitempty"`
+
+	// Objects are the exported CSV and JSON keys
+	Objects []string `json:"objects,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// finished reports whether the report's job has ended
+func (r *Report) finished() bool {
+	return r.Status == StatusSucceeded || r.Status == StatusFailed || r.Status == StatusCancelled
+}
+
+// WriteCSV writes the report's tenants as CSV, one row per tenant
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "tenant_id", "events", "bytes", "storage_bytes", "queries"})
+	for _, t := range r.Tenants {
+		cw.Write([]string{
+			r.Month,
+			csvCell(t.TenantID),
+			strconv.FormatInt(t.Events, 10),
+			strconv.FormatInt(t.Bytes, 10),
+			strconv.FormatInt(t.StorageBytes, 10),
+			strconv.FormatInt(t.Queries, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell keeps a value from being read as a formula when the CSV is opened
+// in a spreadsheet, by quoting it with a leading ' if it starts like one
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Archive is a location laid out by tenant, as exports write it, whose
+// objects count towards tenants' storage footprint
+type Archive struct {
+	Store  objstore.Store
+	Prefix string
+}
+
+// Config holds report settings
+type Config struct {
+	// Dest is where reports are exported as CSV and JSON, under
+	// <Prefix>usage/<month>; nil keeps them in the store only
+	Dest   objstore.Uploader
+	Prefix string
+
+	// Archives are measured for each tenant's storage footprint
+	Archives []Archive
+
+	// Grace is how long after a month ends its report is generated, so
+	// every node has flushed its counts (0 = 1h)
+	Grace time.Duration
+
+	// CheckInterval is how often nodes check for a month to report
+	// (0 = 5m)
+	CheckInterval time.Duration
+}
+
+// Reports rolls monthly totals up into reports, as background jobs
+type Reports struct {
+	store state.StateStore
+	jobs  *jobs.Scheduler
+	cfg   Config
+}
+
+// NewReports creates a report generator running its jobs on scheduler
+func NewReports(store state.StateStore, scheduler *jobs.Scheduler, cfg Config) *Reports {
+	if cfg.Grace <= 0 {
+		cfg.Grace = time.Hour
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 5 * time.Minute
+	}
+	scheduler.SetLimit(jobs.KindUsage, 1)
+	return &Reports{store: store, jobs: scheduler, cfg: cfg}
+}
+
+// Generate starts generating a month's report, replacing any earlier one.
+// The current month may be reported, with its usage so far.
+func (r *Reports) Generate(ctx context.Context, month string) (*Report, error) {
+	start, err := time.Parse(MonthLayout, month)
+	if err != nil || start.After(time.Now()) {
+		return nil, ErrInvalidMonth
+	}
+	if existing, err := r.Get(ctx, month); err == nil && !existing.finished() {
+		return nil, ErrReportRunning
+	} else if err != nil && !errors.Is(err, ErrReportNotFound) {
+		return nil, err
+	}
+
+	report := &Report{
+		Month:     month,
+		JobID:     uuid.New().String(),
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := r.save(ctx, report); err != nil {
+		return nil, err
+	}
+	if err := r.index(ctx, month); err != nil {
+		return nil, err
+	}
+	metrics.UsageReports.WithLabelValues(StatusPending).Inc()
+
+	// The job runs on its own copy so the caller's view stays stable
+	created := *report
+	_, err = r.jobs.Submit(ctx, jobs.Task{
+		ID:     report.JobID,
+		Kind:   jobs.KindUsage,
+		Detail: "/admin/usage-reports/" + month,
+		Run: func(ctx context.Context, progress func(jobs.Progress)) error {
+			return r.run(ctx, report, progress)
+		},
+		Finish: func(err error) { r.finish(report, err) },
+	})
+	if err != nil {
+		r.finish(report, err)
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Get returns a month's report
+func (r *Reports) Get(ctx context.Context, month string) (*Report, error) {
+	data, err := r.store.Get(ctx, reportPrefix+month)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrReportNotFound
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse usage report: %w", err)
+	}
+	return &report, nil
+}
+
+// List returns the reports without their tenants, newest month first
+func (r *Reports) List(ctx context.Context) ([]Report, error) {
+	months, err := r.months(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(months))
+	for _, month := range months {
+		report, err := r.Get(ctx, month)
+		if errors.Is(err, ErrReportNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.Tenants = nil
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// Run checks for a month to report every check interval until ctx is
+// cancelled
+func (r *Reports) Run(ctx context.Context) {
+	log := logger.WithComponent("usage")
+	ticker := time.NewTicker(r.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Check(ctx, time.Now()); err != nil {
+				log.Warn().Err(err).Msg("usage report check failed")
+			}
+		}
+	}
+}
+
+// Check generates the report of the month before now once its grace has
+// passed, unless it exists. Only the first node to check does.
+func (r *Reports) Check(ctx context.Context, now time.Time) error {
+	current := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	if now.Before(current.Add(r.cfg.Grace)) {
+		return nil
+	}
+	month := Month(current.AddDate(0, -1, 0))
+
+	if _, err := r.Get(ctx, month); !errors.Is(err, ErrReportNotFound) {
+		return err
+	}
+	claimed, err := r.store.SetNX(ctx, claimPrefix+month, []byte(month), 24*time.Hour)
+	if err != nil || !claimed {
+		return err
+	}
+	_, err = r.Generate(ctx, month)
+	return err
+}
+
+// run builds and exports a report once the scheduler starts it
+func (r *Reports) run(ctx context.Context, report *Report, progress func(jobs.Progress)) error {
+	report.Status = StatusRunning
+	if err := r.save(ctx, report); err != nil {
+		log := logger.WithComponent("usage")
+		log.Warn().Err(err).Str("month", report.Month).Msg("failed to record usage report status")
+	}
+
+	ids, err := tenants(ctx, r.store, report.Month)
+	if err != nil {
+		return fmt.Errorf("read tenants: %w", err)
+	}
+	report.Tenants = make([]TenantUsage, 0, len(ids))
+	for i, id := range ids {
+		usage, err := r.tenantUsage(ctx, report.Month, id)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+		report.Tenants = append(report.Tenants, usage)
+		progress(jobs.Progress{Done: int64(i + 1), Total: int64(len(ids)), Unit: "tenants"})
+	}
+	return r.export(ctx, report)
+}
+
+// tenantUsage reads a tenant's monthly totals and measures its archives
+func (r *Reports) tenantUsage(ctx context.Context, month, tenantID string) (TenantUsage, error) {
+	usage := TenantUsage{TenantID: tenantID}
+	for counter, total := range map[string]*int64{counterEvents: &usage.Events, counterBytes: &usage.Bytes, counterQueries: &usage.Queries} {
+		data, err := r.store.Get(ctx, totalKey(month, tenantID, counter))
+		if err != nil {
+			return usage, err
+		}
+		if len(data) > 0 {
+			if *total, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+				return usage, fmt.Errorf("parse %s: %w", counter, err)
+			}
+		}
+	}
+
+	for _, archive := range r.cfg.Archives {
+		objects, err := archive.Store.List(ctx, archive.Prefix+tenantID+"/")
+		if err != nil {
+			return usage, fmt.Errorf("list archive: %w", err)
+		}
+		for _, obj := range objects {
+			usage.StorageBytes += obj.Size
+		}
+	}
+	return usage, nil
+}
+
+// export uploads the report as CSV and JSON
+func (r *Reports) export(ctx context.Context, report *Report) error {
+	if r.cfg.Dest == nil {
+		return nil
+	}
+
+	var csvBody bytes.Buffer
+	if err := report.WriteCSV(&csvBody); err != nil {
+		return err
+	}
+	jsonBody, err := json.Marshal(struct {
+		Month   string        `json:"month"`
+		Tenants []TenantUsage `json:"tenants"`
+	}{report.Month, report.Tenants})
+	if err != nil {
+		return err
+	}
+
+	base := r.cfg.Prefix + "usage/" + report.Month
+	for _, object := range []struct {
+		key  string
+		body []byte
+	}{
+		{base + ".csv", csvBody.Bytes()},
+		{base + ".json", jsonBody},
+	} {
+		if err := r.cfg.Dest.Put(ctx, object.key, bytes.NewReader(object.body), int64(len(object.body))); err != nil {
+			return fmt.Errorf("upload %s: %w", object.key, err)
+		}
+		report.Objects = append(report.Objects, object.key)
+	}
+	return nil
+}
+
+// finish records the report's outcome
+func (r *Reports) finish(report *Report, err error) {
+	log := logger.WithComponent("usage")
+
+	now := time.Now().UTC()
+	report.CompletedAt = &now
+	report.Status = StatusSucceeded
+	switch {
+	case errors.Is(err, jobs.ErrCancelled):
+		report.Status, report.Error = StatusCancelled, err.Error()
+	case err != nil:
+		report.Status, report.Error = StatusFailed, err.Error()
+	}
+	metrics.UsageReports.WithLabelValues(report.Status).Inc()
+
+	// The job context may be cancelled; the final status must still land
+	if saveErr := r.save(context.Background(), report); saveErr != nil {
+		log.Error().Err(saveErr).Str("month", report.Month).Msg("failed to record usage report")
+	}
+
+	event := log.Info()
+	if report.Status == StatusFailed {
+		event = log.Error().Err(err)
+	}
+	event.
+		Str("month", report.Month).
+		Str("job_id", report.JobID).
+		Str("status", report.Status).
+		Int("tenants", len(report.Tenants)).
+		Strs("objects", report.Objects).
+		Msg("usage report finished")
+}
+
+// save writes a report; reports are kept for billing disputes
+func (r *Reports) save(ctx context.Context, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return r.store.Set(ctx, reportPrefix+report.Month, data)
+}
+
+// months reads the reported months, newest first
+func (r *Reports) months(ctx context.Context) ([]string, error) {
+	data, err := state.NewVersioned(r.store, reportsKey).Get(ctx)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var months []string
+	if err := json.Unmarshal(data, &months); err != nil {
+		return nil, err
+	}
+	return months, nil
+}
+
+// index adds a month to the reported months
+func (r *Reports) index(ctx context.Context, month string) error {
+	months, err := r.months(ctx)
+	if err != nil || slices.Contains(months, month) {
+		return err
+	}
+	return state.NewVersioned(r.store, reportsKey).Update(ctx, func(current []byte) ([]byte, error) {
+		var months []string
+		if len(current) > 0 {
+			if err := json.Unmarshal(current, &months); err != nil {
+				return nil, err
+			}
+		}
+		if slices.Contains(months, month) {
+			return current, nil
+		}
+		months = append(months, month)
+		slices.Sort(months)
+		slices.Reverse(months)
+		return json.Marshal(months)
+	})
+}
@@ -0,0 +1,197 @@
+package winevent
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"parsec/pkg/models"
+)
+
+// Metadata keys taken from the System element
+const (
+	MetadataChannel  = "channel"
+	MetadataEventID  = "event_id"
+	MetadataComputer = "computer"
+	MetadataRecordID = "record_id"
+	MetadataTask     = "task"
+	MetadataOpcode   = "opcode"
+	MetadataKeywords = "keywords"
+	MetadataUserSID  = "user_sid"
+)
+
+// auditFailure is the Security log's "Audit Failure" keyword bit
+const auditFailure = 0x10000000000000
+
+// eventNamespace derives stable IDs from the computer, channel and record
+// ID, so an event forwarded twice keeps its ID
+var eventNamespace = uuid.MustParse("9e3b7c1d-2f4a-4b8e-a6d5-0c7f1e2d3b4a")
+
+var ErrNoEvents = errors.New("no Windows events in body")
+
+// Event is the Windows event schema
+// (http://schemas.microsoft.com/win/2004/08/events/event), as rendered by
+// Windows Event Forwarding and wevtutil
+type Event struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     string `xml:"EventID"`
+		Level       string `xml:"Level"`
+		Task        string `xml:"Task"`
+		Opcode      string `xml:"Opcode"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID string `xml:"EventRecordID"`
+		Correlation   struct {
+			ActivityID string `xml:"ActivityID,attr"`
+		} `xml:"Correlation"`
+		Channel  string `xml:"Channel"`
+		Computer string `xml:"Computer"`
+		Security struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+// Decode reads every Event element in r, whether it holds a single event,
+// an <Events> batch or concatenated events
+func Decode(r io.Reader) ([]*Event, error) {
+	dec := xml.NewDecoder(r)
+	var events []*Event
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid event XML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Event" {
+			continue
+		}
+		event := new(Event)
+		if err := dec.DecodeElement(event, &start); err != nil {
+			return nil, fmt.Errorf("invalid event XML: %w", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil, ErrNoEvents
+	}
+	return events, nil
+}
+
+// LogEvent converts the event. The provider becomes the source and the
+// rendered message the message; events forwarded without rendering get a
+// message built from the event ID and data. Channel, event ID and the
+// named EventData values become metadata.
+func (e *Event) LogEvent(tenant string) *models.LogEvent {
+	sys := &e.System
+
+	event := &models.LogEvent{
+		TenantID:  tenant,
+		Timestamp: e.timestamp(),
+		Severity:  e.severity(),
+		Source:    sys.Provider.Name,
+		Message:   strings.TrimSpace(e.RenderingInfo.Message),
+		Metadata:  make(models.Metadata),
+	}
+	if event.Source == "" {
+		event.Source = sys.Channel
+	}
+
+	if sys.EventRecordID != "" {
+		key := sys.Computer + "/" + sys.Channel + "/" + sys.EventRecordID
+		event.ID = uuid.NewSHA1(eventNamespace, []byte(key)).String()
+	} else {
+		event.ID = uuid.New().String()
+	}
+
+	for key, value := range map[string]string{
+		MetadataChannel:  sys.Channel,
+		MetadataEventID:  strings.TrimSpace(sys.EventID),
+		MetadataComputer: sys.Computer,
+		MetadataRecordID: sys.EventRecordID,
+		MetadataTask:     sys.Task,
+		MetadataOpcode:   sys.Opcode,
+		MetadataKeywords: sys.Keywords,
+		MetadataUserSID:  sys.Security.UserID,
+	} {
+		if value != "" {
+			event.Metadata[key] = value
+		}
+	}
+	if activity := sys.Correlation.ActivityID; activity != "" {
+		event.TraceID = strings.Trim(activity, "{}")
+	}
+
+	var pairs []string
+	for i, data := range e.EventData.Data {
+		name := data.Name
+		if name == "" {
+			name = "data_" + strconv.Itoa(i)
+		}
+		value := strings.TrimSpace(data.Value)
+		pairs = append(pairs, name+"="+value)
+		if _, exists := event.Metadata[name]; !exists && len(event.Metadata) < models.MaxMetadataKeys {
+			event.Metadata[name] = value
+		}
+	}
+
+	if event.Message == "" {
+		event.Message = strings.TrimSpace("event " + event.Metadata.Get(MetadataEventID) + " " + strings.Join(pairs, " "))
+	}
+	return event
+}
+
+// timestamp parses TimeCreated, falling back to now
+func (e *Event) timestamp() time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, e.System.TimeCreated.SystemTime)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return ts.UTC()
+}
+
+// severity maps the event level. Security audit events are logged at
+// level 0 (LogAlways); audit failures are raised to WARNING.
+func (e *Event) severity() models.Severity {
+	switch strings.TrimSpace(e.System.Level) {
+	case "1":
+		return models.SeverityCritical
+	case "2":
+		return models.SeverityError
+	case "3":
+		return models.SeverityWarning
+	case "5":
+		return models.SeverityDebug
+	}
+
+	keywords, err := strconv.ParseUint(strings.TrimPrefix(e.System.Keywords, "0x"), 16, 64)
+	if err == nil && keywords&auditFailure != 0 {
+		return models.SeverityWarning
+	}
+	return models.SeverityInfo
+}
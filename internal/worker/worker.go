@@ -2,14 +2,20 @@ package worker
 
 import (
 	"context"
-	"runtime/debug"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
+	"parsec/internal/batch"
 	"parsec/internal/logger"
 	"parsec/internal/metrics"
-	"parsec/internal/models"
+	"parsec/internal/queue"
+	"parsec/internal/selfmon"
+	"parsec/pkg/models"
 )
 
 // Publisher defines the interface for publishing envelopes
@@ -21,18 +27,26 @@ type Publisher interface {
 // Pool manages a pool of workers that consume envelopes and publish to Kafka
 type Pool struct {
 	publisher    Publisher
-	envelopeChan chan *models.Envelope
+	budget       *queue.Budget
+	batcher      *batch.Batcher[*models.Envelope]
 	workers      int
 	batchSize    int
 	batchTimeout time.Duration
-
-	wg     sync.WaitGroup
-	ctx    context.Context
-	cancel context.CancelFunc
+	compact      bool
+	onPublish    func(published, failed []*models.Envelope)
 
 	// Metrics
 	processed atomic.Uint64
 	failed    atomic.Uint64
+
+	// publishDurations and queueWaits are each worker's observers, then
+	// the aggregator's, labelled once so publishing doesn't look them up
+	publishDurations []prometheus.Observer
+	queueWaits       []prometheus.Observer
+
+	// tenants counts published and failed events per tenant
+	tenantsMu sync.Mutex
+	tenants   map[string]*TenantStats
 }
 
 // Config holds worker pool configuration
@@ -42,33 +56,101 @@ type Config struct {
 	Workers      int
 	BatchSize    int
 	BatchTimeout time.Duration
+
+	// Compact merges the partial batches workers flush on timeout into
+	// batches of up to BatchSize before publishing
+	Compact bool
+
+	// CompactLinger is how long the aggregator waits for more partial
+	// batches (default BatchTimeout)
+	CompactLinger time.Duration
+
+	// Budget is released for envelopes once they are published (or fail
+	// to be); nil when buffered bytes aren't bounded
+	Budget *queue.Budget
+
+	// OnPublish, when set, is called with the envelopes each publish
+	// delivered and those that finally failed, after any individual retry
+	OnPublish func(published, failed []*models.Envelope)
 }
 
 // NewPool creates a new worker pool
 func NewPool(cfg Config) *Pool {
-	if cfg.Workers <= 0 {
-		cfg.Workers = 4
+	p := &Pool{
+		publisher: cfg.Publisher,
+		budget:    cfg.Budget,
+		compact:   cfg.Compact,
+		onPublish: cfg.OnPublish,
+		tenants:   make(map[string]*TenantStats),
+	}
+	p.batcher = batch.New(batch.Config[*models.Envelope]{
+		Name:          "worker",
+		Input:         cfg.EnvelopeChan,
+		Workers:       cfg.Workers,
+		Size:          cfg.BatchSize,
+		Timeout:       cfg.BatchTimeout,
+		Flush:         p.publishBatch,
+		Compact:       cfg.Compact,
+		CompactLinger: cfg.CompactLinger,
+		OnCompact:     metrics.WorkerBatchesCompacted.Inc,
+		OnTake:        p.took,
+	})
+	p.workers, p.batchSize, p.batchTimeout = p.batcher.Workers(), p.batcher.Size(), p.batcher.Timeout()
+
+	for id := 0; id <= p.workers; id++ {
+		label := strconv.Itoa(id)
+		if id == p.workers {
+			label = "aggregator"
+		}
+		p.publishDurations = append(p.publishDurations, metrics.WorkerBatchPublishDuration.WithLabelValues(label))
+		p.queueWaits = append(p.queueWaits, metrics.WorkerQueueWait.WithLabelValues(label))
 	}
-	if cfg.BatchSize <= 0 {
-		cfg.BatchSize = 100
+	return p
+}
+
+// slot returns the index of a worker's observers
+func (p *Pool) slot(id int) int {
+	if id < 0 || id >= p.workers {
+		return p.workers
 	}
-	if cfg.BatchTimeout <= 0 {
-		cfg.BatchTimeout = 100 * time.Millisecond
+	return id
+}
+
+// flusher returns the index of the observers of the worker delivering a
+// batch
+func (p *Pool) flusher(ctx context.Context) int {
+	id, ok := batch.WorkerID(ctx)
+	if !ok {
+		return p.workers
 	}
+	return p.slot(id)
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
+// took stamps an envelope as taken by worker id and records how long it
+// waited in the worker's histogram
+func (p *Pool) took(id int, envelope *models.Envelope) {
+	now := time.Now().UTC()
+	envelope.Timings.Dequeued = now
+	if !envelope.ReceivedAt.IsZero() {
+		p.queueWaits[p.slot(id)].Observe(max(now.Sub(envelope.ReceivedAt), 0).Seconds())
+	}
+}
 
-	return &Pool{
-		publisher:    cfg.Publisher,
-		envelopeChan: cfg.EnvelopeChan,
-		workers:      cfg.Workers,
-		batchSize:    cfg.BatchSize,
-		batchTimeout: cfg.BatchTimeout,
-		ctx:          ctx,
-		cancel:       cancel,
+// stampPublished marks envelopes as handed to the bus
+func stampPublished(envelopes []*models.Envelope) {
+	now := time.Now().UTC()
+	for _, envelope := range envelopes {
+		envelope.Timings.Published = now
 	}
 }
 
+// Flush asks every worker, and the aggregator, to publish the envelopes
+// they are batching now rather than on timeout. It doesn't wait for the
+// publishes.
+func (p *Pool) Flush() {
+	p.batcher.Flush()
+}
+
 // Start begins processing envelopes
 func (p *Pool) Start() {
 	log := logger.WithComponent("worker_pool")
@@ -76,108 +158,46 @@ func (p *Pool) Start() {
 		Int("workers", p.workers).
 		Int("batch_size", p.batchSize).
 		Dur("batch_timeout", p.batchTimeout).
+		Bool("compact", p.compact).
 		Msg("starting worker pool")
 
-	for i := 0; i < p.workers; i++ {
-		p.wg.Add(1)
-		go p.worker(i)
-	}
+	p.batcher.Start()
 }
 
 // Stop gracefully stops all workers
 func (p *Pool) Stop() {
 	log := logger.WithComponent("worker_pool")
 	log.Info().Msg("stopping worker pool")
-	p.cancel()
-	p.wg.Wait()
+	p.batcher.Stop()
 	log.Info().Msg("worker pool stopped")
 }
 
-// worker processes envelopes from the channel
-func (p *Pool) worker(id int) {
-	defer p.wg.Done()
-
-	log := logger.WithComponent("worker").With().Int("worker_id", id).Logger()
-
-	// Panic recovery
-	defer func() {
-		if r := recover(); r != nil {
-			stack := debug.Stack()
-			log.Error().
-				Interface("panic", r).
-				Bytes("stack", stack).
-				Msg("worker panic recovered")
-			metrics.PanicsRecovered.WithLabelValues("worker").Inc()
-		}
-	}()
-
-	log.Info().Msg("worker started")
-	defer log.Info().Msg("worker stopped")
-
-	batch := make([]*models.Envelope, 0, p.batchSize)
-	timer := time.NewTimer(p.batchTimeout)
-	defer timer.Stop()
-
-	for {
-		select {
-		case <-p.ctx.Done():
-			// Flush remaining batch before exiting
-			if len(batch) > 0 {
-				p.publishBatch(batch)
-			}
-			return
-
-		case envelope, ok := <-p.envelopeChan:
-			if !ok {
-				// Channel closed, flush and exit
-				if len(batch) > 0 {
-					p.publishBatch(batch)
-				}
-				return
-			}
-
-			batch = append(batch, envelope)
-
-			// Publish when batch is full
-			if len(batch) >= p.batchSize {
-				p.publishBatch(batch)
-				batch = batch[:0] // Reset batch
-				timer.Reset(p.batchTimeout)
-			}
-
-		case <-timer.C:
-			// Publish on timeout if we have any messages
-			if len(batch) > 0 {
-				p.publishBatch(batch)
-				batch = batch[:0]
-			}
-			timer.Reset(p.batchTimeout)
-		}
-	}
-}
-
 // publishBatch publishes a batch of envelopes
-func (p *Pool) publishBatch(batch []*models.Envelope) {
+func (p *Pool) publishBatch(parent context.Context, batch []*models.Envelope) {
 	if len(batch) == 0 {
 		return
 	}
+	defer p.budget.Release(batch...)
 
 	log := logger.WithComponent("worker")
 	start := time.Now()
 
-	// Create a timeout context for the publish operation
-	ctx, cancel := context.WithTimeout(p.ctx, 10*time.Second)
+	// Create a timeout context for the publish operation, marked so that
+	// failing to publish self-monitoring events doesn't log more of them
+	ctx, cancel := context.WithTimeout(selfmon.Handling(parent, batch...), 10*time.Second)
 	defer cancel()
 
 	log.Debug().Int("batch_size", len(batch)).Msg("publishing batch to kafka")
 
+	stampPublished(batch)
 	err := p.publisher.PublishBatch(ctx, batch)
 	duration := time.Since(start)
 
-	metrics.WorkerBatchPublishDuration.Observe(duration.Seconds())
+	p.publishDurations[p.flusher(parent)].Observe(duration.Seconds())
 
 	if err != nil {
 		log.Error().
+			Ctx(ctx).
 			Err(err).
 			Int("batch_size", len(batch)).
 			Dur("duration", duration).
@@ -187,7 +207,7 @@ func (p *Pool) publishBatch(batch []*models.Envelope) {
 		metrics.WorkerFailedTotal.Add(float64(len(batch)))
 
 		// Fallback: try publishing individually
-		p.publishIndividually(batch)
+		p.publishIndividually(parent, batch)
 	} else {
 		log.Info().
 			Int("batch_size", len(batch)).
@@ -196,25 +216,31 @@ func (p *Pool) publishBatch(batch []*models.Envelope) {
 
 		p.processed.Add(uint64(len(batch)))
 		metrics.WorkerProcessedTotal.Add(float64(len(batch)))
+		p.countTenants(batch, nil)
+		p.published(batch, nil)
 	}
 }
 
 // publishIndividually tries to publish each envelope separately (fallback)
-func (p *Pool) publishIndividually(batch []*models.Envelope) {
+func (p *Pool) publishIndividually(parent context.Context, batch []*models.Envelope) {
 	log := logger.WithComponent("worker")
-	log.Warn().Int("count", len(batch)).Msg("attempting individual publish for failed batch")
+	log.Warn().Ctx(selfmon.Handling(parent, batch...)).Int("count", len(batch)).Msg("attempting individual publish for failed batch")
 
 	for _, envelope := range batch {
-		ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+		ctx, cancel := context.WithTimeout(selfmon.Handling(parent, envelope), 5*time.Second)
+		stampPublished([]*models.Envelope{envelope})
 		err := p.publisher.Publish(ctx, envelope)
 		cancel()
 
 		if err != nil {
 			log.Error().
+				Ctx(ctx).
 				Err(err).
 				Str("event_id", envelope.Event.ID).
 				Str("tenant_id", envelope.Event.TenantID).
 				Msg("failed to publish envelope individually")
+			p.countTenants(nil, envelope)
+			p.published(nil, []*models.Envelope{envelope})
 		} else {
 			log.Debug().
 				Str("event_id", envelope.Event.ID).
@@ -223,20 +249,85 @@ func (p *Pool) publishIndividually(batch []*models.Envelope) {
 			// Don't count twice - subtract from failed, add to processed
 			p.failed.Add(^uint64(0)) // Subtract 1
 			p.processed.Add(1)
+			p.countTenants([]*models.Envelope{envelope}, nil)
+			p.published([]*models.Envelope{envelope}, nil)
 		}
 	}
 }
 
+// published reports a publish's outcome to OnPublish
+func (p *Pool) published(published, failed []*models.Envelope) {
+	if p.onPublish != nil {
+		p.onPublish(published, failed)
+	}
+}
+
+// countTenants counts published envelopes and a failed one against their
+// tenants
+func (p *Pool) countTenants(published []*models.Envelope, failed *models.Envelope) {
+	p.tenantsMu.Lock()
+	defer p.tenantsMu.Unlock()
+	for _, envelope := range published {
+		p.tenant(envelope.Event.TenantID).Processed++
+	}
+	if failed != nil {
+		p.tenant(failed.Event.TenantID).Failed++
+	}
+}
+
+// tenant returns a tenant's counts; the caller holds tenantsMu
+func (p *Pool) tenant(id string) *TenantStats {
+	t, ok := p.tenants[id]
+	if !ok {
+		t = &TenantStats{TenantID: id}
+		p.tenants[id] = t
+	}
+	return t
+}
+
 // Stats returns worker pool statistics
 func (p *Pool) Stats() Stats {
 	return Stats{
 		Processed: p.processed.Load(),
 		Failed:    p.failed.Load(),
+		Workers:   p.batcher.Stats(),
 	}
 }
 
+// TopTenants returns the n tenants with the most events, busiest first
+func (p *Pool) TopTenants(n int) []TenantStats {
+	p.tenantsMu.Lock()
+	tenants := make([]TenantStats, 0, len(p.tenants))
+	for _, t := range p.tenants {
+		tenants = append(tenants, *t)
+	}
+	p.tenantsMu.Unlock()
+
+	sort.Slice(tenants, func(i, j int) bool {
+		a, b := tenants[i].Processed+tenants[i].Failed, tenants[j].Processed+tenants[j].Failed
+		if a != b {
+			return a > b
+		}
+		return tenants[i].TenantID < tenants[j].TenantID
+	})
+	if n >= 0 && len(tenants) > n {
+		tenants = tenants[:n]
+	}
+	return tenants
+}
+
 // Stats holds worker pool metrics
 type Stats struct {
 	Processed uint64
 	Failed    uint64
+
+	// Workers holds each batching worker's delivery statistics
+	Workers []batch.WorkerStats
+}
+
+// TenantStats counts a tenant's events
+type TenantStats struct {
+	TenantID  string `json:"tenant_id"`
+	Processed uint64 `json:"processed"`
+	Failed    uint64 `json:"failed"`
 }
@@ -0,0 +1,33 @@
+// Package bus defines how Parsec hands envelopes to a message bus. Services
+// embedding Parsec components implement Publisher to supply their own bus,
+// or accept one to reuse Parsec's.
+//
+// This package is covered by Parsec's API stability guarantee: exported
+// identifiers are not removed or changed incompatibly within a major
+// version. Methods are added to Publisher only in a new major version.
+package bus
+
+import (
+	"context"
+
+	"parsec/pkg/models"
+)
+
+// Publisher delivers envelopes to a message bus
+type Publisher interface {
+	Publish(ctx context.Context, envelope *models.Envelope) error
+	PublishBatch(ctx context.Context, envelopes []*models.Envelope) error
+
+	// HealthCheck reports whether the bus is reachable
+	HealthCheck(ctx context.Context) error
+
+	Stats() Stats
+	Close() error
+}
+
+// Stats holds publisher counters
+type Stats struct {
+	MessagesSent   uint64
+	MessagesFailed uint64
+	BytesWritten   uint64
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Envelope wraps a LogEvent with internal metadata for processing
+type Envelope struct {
+	// Original event
+	Event *LogEvent `json:"event"`
+
+	// Internal processing metadata
+	ReceivedAt   time.Time `json:"received_at"`
+	IngestNode   string    `json:"ingest_node"`
+	Region       string    `json:"region,omitempty"` // region the event was ingested in
+	BatchID      string    `json:"batch_id,omitempty"`
+	BatchIndex   int       `json:"batch_index,omitempty"`
+	RetryCount   int       `json:"retry_count"`
+	PartitionKey string    `json:"partition_key"`
+
+	// Routing overrides set by tenant routing rules
+	Topic    string `json:"topic,omitempty"`
+	Priority string `json:"priority,omitempty"`
+
+	// Retention tier ("short" or "long"); storage partitions by it
+	Retention string `json:"retention,omitempty"`
+
+	// RetentionSeconds is how long storage should keep the event, from a
+	// routing rule or the client (0 = the tier's TTL)
+	RetentionSeconds int64 `json:"retention_seconds,omitempty"`
+
+	// Partition writes the envelope to one Kafka partition instead of the
+	// tenant's (nil = balanced as usual)
+	Partition *int `json:"partition,omitempty"`
+
+	// Acks is how many Kafka replicas must acknowledge the envelope: none,
+	// leader or all ("" = the producer's setting). It is set by the
+	// tenant's tier at ingest and not carried past the producer.
+	Acks string `json:"-"`
+
+	// Timings records when the envelope reached each stage
+	Timings Timings `json:"timings"`
+
+	// Bytes is the event size charged against the queue's byte budget
+	// while the envelope is buffered (0 = not charged)
+	Bytes int64 `json:"-"`
+}
+
+// NewEnvelope creates a new envelope wrapping a log event
+func NewEnvelope(event *LogEvent, ingestNode string) *Envelope {
+	e := &Envelope{}
+	e.Wrap(event, ingestNode)
+	return e
+}
+
+// Wrap resets the envelope to wrap a log event, for callers that allocate
+// envelopes themselves
+func (e *Envelope) Wrap(event *LogEvent, ingestNode string) {
+	now := time.Now().UTC()
+	*e = Envelope{
+		Event:        event,
+		ReceivedAt:   now,
+		IngestNode:   ingestNode,
+		RetryCount:   0,
+		PartitionKey: event.TenantID, // partition by tenant for ordering
+		Timings:      Timings{Received: now},
+	}
+}
+
+// WithBatch sets batch metadata on the envelope
+func (e *Envelope) WithBatch(batchID string, index int) *Envelope {
+	e.BatchID = batchID
+	e.BatchIndex = index
+	return e
+}
+
+// Timings records when an envelope reached each stage on its way to
+// storage, so latency can be attributed to the stage that added it. Stages
+// not reached yet are zero and left out of the JSON.
+type Timings struct {
+	// Received is when the ingest node accepted the event
+	Received time.Time
+
+	// Dequeued is when a worker took the envelope off the queue
+	Dequeued time.Time
+
+	// Published is when the worker handed the envelope's batch to the bus
+	Published time.Time
+
+	// Persisted is when a consumer's handler finished storing it
+	Persisted time.Time
+}
+
+// timingsJSON is Timings with unreached stages omitted
+type timingsJSON struct {
+	Received  *time.Time `json:"received,omitempty"`
+	Dequeued  *time.Time `json:"dequeued,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	Persisted *time.Time `json:"persisted,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Timings) MarshalJSON() ([]byte, error) {
+	stage := func(at time.Time) *time.Time {
+		if at.IsZero() {
+			return nil
+		}
+		return &at
+	}
+	return json.Marshal(timingsJSON{
+		Received:  stage(t.Received),
+		Dequeued:  stage(t.Dequeued),
+		Published: stage(t.Published),
+		Persisted: stage(t.Persisted),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Timings) UnmarshalJSON(data []byte) error {
+	var raw timingsJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = Timings{}
+	if raw.Received != nil {
+		t.Received = *raw.Received
+	}
+	if raw.Dequeued != nil {
+		t.Dequeued = *raw.Dequeued
+	}
+	if raw.Published != nil {
+		t.Published = *raw.Published
+	}
+	if raw.Persisted != nil {
+		t.Persisted = *raw.Persisted
+	}
+	return nil
+}
+
+// QueueWait is how long the envelope was buffered before a worker took it
+// (0 = not taken yet)
+func (t Timings) QueueWait() time.Duration {
+	if t.Received.IsZero() || t.Dequeued.IsZero() {
+		return 0
+	}
+	return t.Dequeued.Sub(t.Received)
+}
+
+// Stages returns how long the envelope spent reaching each stage from the
+// one before, keyed by the stage reached, for the stages it has reached
+func (t Timings) Stages() map[string]time.Duration {
+	stages := make(map[string]time.Duration, 3)
+	prev := t.Received
+	for _, s := range []struct {
+		name string
+		at   time.Time
+	}{
+		{"dequeued", t.Dequeued},
+		{"published", t.Published},
+		{"persisted", t.Persisted},
+	} {
+		if s.at.IsZero() {
+			continue
+		}
+		if !prev.IsZero() {
+			stages[s.name] = max(s.at.Sub(prev), 0)
+		}
+		prev = s.at
+	}
+	return stages
+}
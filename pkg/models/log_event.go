@@ -1,3 +1,9 @@
+// Package models holds the log events Parsec ingests and the envelopes it
+// buffers and publishes them in.
+//
+// This package is covered by Parsec's API stability guarantee: exported
+// identifiers are not removed or changed incompatibly within a major
+// version, and JSON field names only change in a new major version.
 package models
 
 import (
@@ -36,8 +42,12 @@ type LogEvent struct {
 	// Log message content
 	Message string `json:"message"`
 
-	// Optional structured metadata
-	Metadata map[string]string `json:"metadata,omitempty"`
+	// Optional structured metadata; values may be nested objects and arrays
+	Metadata Metadata `json:"metadata,omitempty"`
+
+	// Optional typed copies of metadata values (int64, float64 or bool),
+	// set by tenant field type rules for numeric aggregation downstream
+	TypedMetadata map[string]any `json:"typed_metadata,omitempty"`
 
 	// Optional trace ID for distributed tracing
 	TraceID string `json:"trace_id,omitempty"`
@@ -58,11 +68,15 @@ var (
 	ErrEmptyMessage     = errors.New("message cannot be empty")
 	ErrMessageTooLong   = errors.New("message exceeds maximum length")
 	ErrTooManyMetadata  = errors.New("too many metadata keys")
+	ErrReservedTenant   = errors.New("tenant ID is reserved for internal use")
 )
 
 const (
 	MaxMessageLength = 65536 // 64KB max message size
 	MaxMetadataKeys  = 50
+
+	// InternalTenantID is the reserved tenant used for Parsec's own logs
+	InternalTenantID = "_parsec"
 )
 
 // Validate checks if the LogEvent has all required fields and valid values
@@ -103,6 +117,10 @@ func (e *LogEvent) Validate() error {
 		return ErrTooManyMetadata
 	}
 
+	if err := e.Metadata.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -115,3 +133,26 @@ func (s Severity) IsValid() bool {
 		return false
 	}
 }
+
+// IsInternal reports whether the event belongs to the reserved internal tenant
+func (e *LogEvent) IsInternal() bool {
+	return e.TenantID == InternalTenantID
+}
+
+// Rank orders severities from DEBUG (0) to CRITICAL (4); invalid severities rank -1
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityDebug:
+		return 0
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityError:
+		return 3
+	case SeverityCritical:
+		return 4
+	default:
+		return -1
+	}
+}
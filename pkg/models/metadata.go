@@ -0,0 +1,227 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata errors
+var (
+	ErrMetadataTooDeep  = errors.New("metadata nested too deeply")
+	ErrMetadataTooLarge = errors.New("metadata exceeds maximum size")
+	ErrInvalidMetadata  = errors.New("unsupported metadata value")
+)
+
+const (
+	// MaxMetadataDepth bounds nesting below the top-level keys
+	MaxMetadataDepth = 8
+
+	// MaxMetadataBytes bounds the approximate encoded size of all metadata
+	MaxMetadataBytes = 64 * 1024
+)
+
+// Metadata is structured event metadata. Values are what encoding/json
+// produces: strings, numbers, bools, nil, []any and map[string]any, so
+// objects and arrays keep their structure. Most keys hold strings; Get
+// returns any value in string form.
+type Metadata map[string]any
+
+// Get returns the string form of a top-level value ("" if missing)
+func (m Metadata) Get(key string) string {
+	v, ok := m[key]
+	if !ok {
+		return ""
+	}
+	return Stringify(v)
+}
+
+// Lookup returns the value at a dotted path such as "http.status" or
+// "tags.0". A top-level key containing dots is matched first, so metadata
+// flattened by older clients is still found.
+func (m Metadata) Lookup(path string) (any, bool) {
+	if v, ok := m[path]; ok {
+		return v, true
+	}
+
+	var current any = map[string]any(m)
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			v, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case Metadata:
+			v, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Flatten returns the metadata as dotted keys and string values, for
+// storage backends with flat columns: {"http":{"status":200}} becomes
+// {"http.status":"200"} and array elements are keyed by index. Empty
+// objects and arrays are kept as "{}" and "[]".
+func (m Metadata) Flatten() map[string]string {
+	flat := make(map[string]string, len(m))
+	for k, v := range m {
+		flattenInto(flat, k, v)
+	}
+	return flat
+}
+
+func flattenInto(flat map[string]string, prefix string, v any) {
+	switch node := v.(type) {
+	case map[string]any:
+		if len(node) == 0 {
+			flat[prefix] = "{}"
+			return
+		}
+		for k, child := range node {
+			flattenInto(flat, prefix+"."+k, child)
+		}
+	case []any:
+		if len(node) == 0 {
+			flat[prefix] = "[]"
+			return
+		}
+		for i, child := range node {
+			flattenInto(flat, prefix+"."+strconv.Itoa(i), child)
+		}
+	default:
+		flat[prefix] = Stringify(v)
+	}
+}
+
+// Keys returns the top-level keys in sorted order
+func (m Metadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks value types, nesting depth and size
+func (m Metadata) Validate() error {
+	size := 0
+	for k, v := range m {
+		n, err := valueSize(v, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		size += len(k) + n
+	}
+	if size > MaxMetadataBytes {
+		return ErrMetadataTooLarge
+	}
+	return nil
+}
+
+// valueSize approximates the encoded size of a value, checking its type
+// and depth
+func valueSize(v any, depth int) (int, error) {
+	switch node := v.(type) {
+	case string:
+		return len(node) + 2, nil
+	case nil, bool, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return 8, nil
+	case map[string]any:
+		if depth >= MaxMetadataDepth {
+			return 0, ErrMetadataTooDeep
+		}
+		size := 2
+		for k, child := range node {
+			n, err := valueSize(child, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			size += len(k) + n + 4
+		}
+		return size, nil
+	case []any:
+		if depth >= MaxMetadataDepth {
+			return 0, ErrMetadataTooDeep
+		}
+		size := 2
+		for _, child := range node {
+			n, err := valueSize(child, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			size += n + 1
+		}
+		return size, nil
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrInvalidMetadata, v)
+	}
+}
+
+// Stringify returns the string form of a metadata value: strings as is,
+// numbers and bools as in JSON, nil as "" and objects and arrays as JSON
+func Stringify(v any) string {
+	switch node := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return node
+	case bool:
+		return strconv.FormatBool(node)
+	case json.Number:
+		return node.String()
+	case float64:
+		return formatFloat(node)
+	case float32:
+		return formatFloat(float64(node))
+	case int:
+		return strconv.Itoa(node)
+	case int64:
+		return strconv.FormatInt(node, 10)
+	default:
+		data, err := json.Marshal(node)
+		if err != nil {
+			return fmt.Sprint(node)
+		}
+		return string(data)
+	}
+}
+
+// formatFloat formats like encoding/json: plain notation except for very
+// large or small magnitudes
+func formatFloat(f float64) string {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// StringMetadata converts string metadata, e.g. from headers or labels
+func StringMetadata(m map[string]string) Metadata {
+	if m == nil {
+		return nil
+	}
+	metadata := make(Metadata, len(m))
+	for k, v := range m {
+		metadata[k] = v
+	}
+	return metadata
+}
@@ -20,6 +20,7 @@ var SupportedTimestampFormats = []string{
 // - lower-cases Source
 // - trims Message
 // - ensures Timestamp is valid
+// - extracts trace context from traceparent/B3 values if unset
 func (e *LogEvent) Normalize() {
 	// Lower-case the source/service name
 	e.Source = strings.ToLower(strings.TrimSpace(e.Source))
@@ -38,14 +39,36 @@ func (e *LogEvent) Normalize() {
 	e.TraceID = strings.TrimSpace(e.TraceID)
 	e.SpanID = strings.TrimSpace(e.SpanID)
 
-	// Normalize metadata keys to lowercase
-	if e.Metadata != nil {
-		normalized := make(map[string]string, len(e.Metadata))
+	// Normalize top-level metadata keys to lowercase and trim string
+	// values; nested values keep their keys. An already normalized map is
+	// kept as is.
+	if e.Metadata != nil && !metadataNormalized(e.Metadata) {
+		normalized := make(Metadata, len(e.Metadata))
 		for k, v := range e.Metadata {
-			normalized[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			if s, ok := v.(string); ok {
+				v = strings.TrimSpace(s)
+			}
+			normalized[strings.ToLower(strings.TrimSpace(k))] = v
 		}
 		e.Metadata = normalized
 	}
+
+	// Populate trace/span IDs from embedded trace context
+	e.ExtractTraceContext()
+}
+
+// metadataNormalized reports whether every key is trimmed and lower-case
+// and every string value trimmed
+func metadataNormalized(metadata Metadata) bool {
+	for k, v := range metadata {
+		if strings.TrimSpace(k) != k || strings.ToLower(k) != k {
+			return false
+		}
+		if s, ok := v.(string); ok && strings.TrimSpace(s) != s {
+			return false
+		}
+	}
+	return true
 }
 
 // ParseTimestamp attempts to parse a timestamp string into time.Time
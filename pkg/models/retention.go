@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxRetention bounds retention hints, so they fit storage's TTL columns
+const MaxRetention = 100 * 365 * 24 * time.Hour
+
+// ErrInvalidRetention is returned for malformed or out of range retention
+// hints
+var ErrInvalidRetention = errors.New("retention must be a duration such as 72h, 3d, 2w or 7y, up to 100y")
+
+// retentionUnits are the units ParseRetention accepts beyond Go's
+var retentionUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// ParseRetention parses a retention hint: a whole number of days, weeks or
+// years ("3d", "2w", "7y") or a Go duration ("72h"), rounded to seconds
+func ParseRetention(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidRetention
+	}
+
+	var d time.Duration
+	if unit, ok := retentionUnits[s[len(s)-1]]; ok {
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil || n <= 0 || n > int64(MaxRetention/unit) {
+			return 0, ErrInvalidRetention
+		}
+		d = time.Duration(n) * unit
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, ErrInvalidRetention
+		}
+	}
+
+	d = d.Round(time.Second)
+	if d <= 0 || d > MaxRetention {
+		return 0, ErrInvalidRetention
+	}
+	return d, nil
+}
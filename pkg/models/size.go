@@ -0,0 +1,175 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Fixed parts of an event's JSON encoding
+const (
+	sizeObject       = len(`{"id":,"tenant_id":,"timestamp":,"severity":,"source":,"message":}`)
+	sizeMetadata     = len(`,"metadata":`)
+	sizeTypedMeta    = len(`,"typed_metadata":`)
+	sizeTraceID      = len(`,"trace_id":`)
+	sizeSpanID       = len(`,"span_id":`)
+	sizeTimestampMax = len(`"2006-01-02T15:04:05.999999999-07:00"`)
+)
+
+// Size returns the canonical size of the event: the length in bytes of its
+// JSON encoding, as published to Kafka. It is computed without encoding the
+// event, so it is cheap enough to call for every ingested event.
+func (e *LogEvent) Size() int {
+	size := sizeObject +
+		stringSize(e.ID) +
+		stringSize(e.TenantID) +
+		timeSize(e.Timestamp) +
+		stringSize(string(e.Severity)) +
+		stringSize(e.Source) +
+		stringSize(e.Message)
+
+	if len(e.Metadata) > 0 {
+		size += sizeMetadata + objectSize(e.Metadata)
+	}
+	if len(e.TypedMetadata) > 0 {
+		size += sizeTypedMeta + objectSize(e.TypedMetadata)
+	}
+	if e.TraceID != "" {
+		size += sizeTraceID + stringSize(e.TraceID)
+	}
+	if e.SpanID != "" {
+		size += sizeSpanID + stringSize(e.SpanID)
+	}
+	return size
+}
+
+// stringSize is the length of s as a quoted JSON string, escaped the way
+// encoding/json escapes it (including HTML characters)
+func stringSize(s string) int {
+	size := 2
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\' || b == '\b' || b == '\f' || b == '\n' || b == '\r' || b == '\t':
+				size += 2
+			case b < 0x20 || b == '<' || b == '>' || b == '&':
+				size += 6 // \u00XX
+			default:
+				size++
+			}
+			i++
+			continue
+		}
+
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			size += len(string(utf8.RuneError)) // invalid bytes become U+FFFD
+		case r == '\u2028' || r == '\u2029':
+			size += 6
+		default:
+			size += n
+		}
+		i += n
+	}
+	return size
+}
+
+// timeSize is the length of t encoded as a quoted RFC 3339 timestamp
+func timeSize(t time.Time) int {
+	var buf [sizeTimestampMax]byte
+	return len(t.AppendFormat(buf[:0], time.RFC3339Nano)) + 2
+}
+
+// objectSize is the length of a metadata object's JSON encoding
+func objectSize[M ~map[string]any](m M) int {
+	if m == nil {
+		return len("null")
+	}
+	size := 2 + len(m) // braces, and a colon per key
+	if len(m) > 1 {
+		size += len(m) - 1 // commas
+	}
+	for k, v := range m {
+		size += stringSize(k) + valueJSONSize(v)
+	}
+	return size
+}
+
+// valueJSONSize is the length of a metadata value's JSON encoding
+func valueJSONSize(v any) int {
+	switch node := v.(type) {
+	case nil:
+		return len("null")
+	case string:
+		return stringSize(node)
+	case bool:
+		if node {
+			return len("true")
+		}
+		return len("false")
+	case float64:
+		return floatSize(node, 64)
+	case float32:
+		return floatSize(float64(node), 32)
+	case int:
+		return intSize(int64(node))
+	case int64:
+		return intSize(node)
+	case int32:
+		return intSize(int64(node))
+	case json.Number:
+		if node == "" {
+			return len("0")
+		}
+		return len(node)
+	case map[string]any:
+		return objectSize(node)
+	case Metadata:
+		return objectSize(node)
+	case []any:
+		if node == nil {
+			return len("null")
+		}
+		size := 2
+		if len(node) > 1 {
+			size += len(node) - 1
+		}
+		for _, child := range node {
+			size += valueJSONSize(child)
+		}
+		return size
+	default:
+		data, _ := json.Marshal(node)
+		return len(data)
+	}
+}
+
+// intSize is the number of digits (and sign) in n
+func intSize(n int64) int {
+	var buf [20]byte
+	return len(strconv.AppendInt(buf[:0], n, 10))
+}
+
+// floatSize mirrors encoding/json's float formatting: plain notation except
+// for very small or large magnitudes, with a short exponent
+func floatSize(f float64, bits int) int {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	var buf [32]byte
+	b := strconv.AppendFloat(buf[:0], f, format, -1, bits)
+	n := len(b)
+	if format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+		n-- // e-09 is written as e-9
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Metadata keys carrying trace context (keys are lower-cased by Normalize)
+const (
+	MetadataTraceparent = "traceparent"
+	MetadataB3          = "b3"
+	MetadataB3TraceID   = "x-b3-traceid"
+	MetadataB3SpanID    = "x-b3-spanid"
+)
+
+var (
+	// W3C trace context: version-traceid-parentid-flags
+	traceparentPattern = regexp.MustCompile(`(?i)\b([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})\b`)
+
+	// B3 single header inside a message, e.g. "b3=80f198ee56343ba8-e457b5a2e4d86bd1-1"
+	b3MessagePattern = regexp.MustCompile(`(?i)\bb3[=:]\s*"?([0-9a-f]{16}(?:[0-9a-f]{16})?-[0-9a-f]{16}(?:-[01d](?:-[0-9a-f]{16})?)?)`)
+
+	hexPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+)
+
+// ExtractTraceContext fills TraceID and SpanID from W3C traceparent or B3
+// values found in Metadata or Message when the dedicated fields are empty.
+// Values that fail format validation are ignored. It returns true if the
+// trace context was populated.
+func (e *LogEvent) ExtractTraceContext() bool {
+	if e.TraceID != "" {
+		return false
+	}
+
+	candidates := []func() (string, string, bool){
+		func() (string, string, bool) { return parseTraceparent(e.Metadata.Get(MetadataTraceparent)) },
+		func() (string, string, bool) { return parseB3Single(e.Metadata.Get(MetadataB3)) },
+		func() (string, string, bool) {
+			return validB3Pair(e.Metadata.Get(MetadataB3TraceID), e.Metadata.Get(MetadataB3SpanID))
+		},
+		func() (string, string, bool) {
+			return parseTraceparent(traceparentPattern.FindString(e.Message))
+		},
+		func() (string, string, bool) {
+			match := b3MessagePattern.FindStringSubmatch(e.Message)
+			if match == nil {
+				return "", "", false
+			}
+			return parseB3Single(match[1])
+		},
+	}
+
+	for _, extract := range candidates {
+		traceID, spanID, ok := extract()
+		if !ok {
+			continue
+		}
+		e.TraceID = traceID
+		if e.SpanID == "" {
+			e.SpanID = spanID
+		}
+		return true
+	}
+	return false
+}
+
+// parseTraceparent validates a W3C traceparent value
+func parseTraceparent(value string) (string, string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	match := traceparentPattern.FindStringSubmatch(value)
+	if match == nil || match[0] != value {
+		return "", "", false
+	}
+
+	version, traceID, spanID := match[1], match[2], match[3]
+	if version == "ff" || allZeros(traceID) || allZeros(spanID) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// parseB3Single validates a B3 single-header value: traceid-spanid[-sampled[-parentspanid]]
+func parseB3Single(value string) (string, string, bool) {
+	if value == "" {
+		return "", "", false
+	}
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(value)), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return "", "", false
+	}
+	return validB3Pair(parts[0], parts[1])
+}
+
+// validB3Pair validates B3 trace (64 or 128 bit) and span (64 bit) IDs
+func validB3Pair(traceID, spanID string) (string, string, bool) {
+	traceID = strings.ToLower(strings.TrimSpace(traceID))
+	spanID = strings.ToLower(strings.TrimSpace(spanID))
+
+	if len(traceID) != 16 && len(traceID) != 32 {
+		return "", "", false
+	}
+	if len(spanID) != 16 {
+		return "", "", false
+	}
+	if !hexPattern.MatchString(traceID) || !hexPattern.MatchString(spanID) {
+		return "", "", false
+	}
+	if allZeros(traceID) || allZeros(spanID) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// allZeros reports whether a hex ID is all zeros (invalid in both formats)
+func allZeros(id string) bool {
+	return strings.Trim(id, "0") == ""
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MetadataOriginalLength records the pre-truncation message length in bytes
+const MetadataOriginalLength = "original_message_length"
+
+// TruncationPolicy controls how over-long messages are handled.
+// When disabled, over-long messages fail validation with ErrMessageTooLong.
+type TruncationPolicy struct {
+	Enabled bool
+
+	// HeadBytes is how much of the start of the message to keep
+	HeadBytes int
+
+	// TailBytes is how much of the end of the message to keep
+	TailBytes int
+}
+
+// TruncateMessage shortens Message to fit MaxMessageLength, keeping the head
+// and tail with a marker in between. It returns true if the message changed.
+func (e *LogEvent) TruncateMessage(policy TruncationPolicy) bool {
+	if !policy.Enabled || len(e.Message) <= MaxMessageLength {
+		return false
+	}
+
+	original := len(e.Message)
+	head, tail := policy.HeadBytes, policy.TailBytes
+	if head < 0 {
+		head = 0
+	}
+	if tail < 0 {
+		tail = 0
+	}
+
+	// Leave room for the marker; shrink the head first if the policy overshoots.
+	// The original length bounds the truncated count, so it sizes the marker.
+	if over := head + tail + len(truncationMarker(original)) - MaxMessageLength; over > 0 {
+		head -= over
+		if head < 0 {
+			tail += head
+			head = 0
+		}
+	}
+
+	headEnd := runeStart(e.Message, head)
+	tailStart := nextRuneStart(e.Message, original-tail)
+	e.Message = e.Message[:headEnd] + truncationMarker(tailStart-headEnd) + e.Message[tailStart:]
+
+	if e.Metadata == nil {
+		e.Metadata = make(Metadata, 1)
+	}
+	e.Metadata[MetadataOriginalLength] = strconv.Itoa(original)
+	return true
+}
+
+// truncationMarker is inserted where bytes were removed
+func truncationMarker(removed int) string {
+	return fmt.Sprintf("\n...[truncated %d bytes]...\n", removed)
+}
+
+// runeStart moves i back to the start of the UTF-8 rune containing it
+func runeStart(s string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(s) {
+		return len(s)
+	}
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// nextRuneStart moves i forward to the start of the next UTF-8 rune
+func nextRuneStart(s string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,50 @@
+// Package pipeline defines the contract for ingest pipeline stages, so
+// services embedding Parsec can write stages of their own and run Parsec's.
+//
+// This package is covered by Parsec's API stability guarantee: exported
+// identifiers are not removed or changed incompatibly within a major
+// version. Methods are added to Stage only in a new major version.
+package pipeline
+
+import (
+	"context"
+	"errors"
+
+	"parsec/pkg/models"
+)
+
+// ErrDropped is returned when a stage filters an event out
+var ErrDropped = errors.New("event dropped by pipeline stage")
+
+// Result describes what a stage did with an event
+type Result struct {
+	// Changed is true if the stage modified the event
+	Changed bool
+
+	// Drop filters the event out; later stages are skipped
+	Drop bool
+
+	// Detail is a short description for dry runs (e.g. the preset name)
+	Detail string
+}
+
+// Stage is one step of the ingest pipeline. Stages modify the event in
+// place and return an error to reject it.
+type Stage interface {
+	Name() string
+	Process(ctx context.Context, event *models.LogEvent) (Result, error)
+}
+
+type dryRunKey struct{}
+
+// WithDryRun marks the context as a dry run; stages must not record
+// metrics or mutate shared state
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether the context is a dry run
+func IsDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
@@ -0,0 +1,176 @@
+package abuse_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/abuse"
+	"parsec/internal/state"
+)
+
+func TestDetector_TarpitThenBlock(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	d := abuse.NewDetector(store, abuse.Config{
+		Window:          time.Minute,
+		TarpitThreshold: 3,
+		TarpitDelay:     time.Second,
+		BlockThreshold:  5,
+		BlockDuration:   time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := d.Record(ctx, "key-broken", abuse.KindValidation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, blocked, delay := d.Check("ip-10.0.0.1", "key-broken"); blocked || delay != 0 {
+		t.Fatalf("below thresholds: blocked %v, delay %v", blocked, delay)
+	}
+
+	d.Record(ctx, "key-broken", abuse.KindValidation)
+	if _, blocked, delay := d.Check("ip-10.0.0.1", "key-broken"); blocked || delay != time.Second {
+		t.Fatalf("over tarpit threshold: blocked %v, delay %v", blocked, delay)
+	}
+	if _, _, delay := d.Check("ip-10.0.0.2", "key-healthy"); delay != 0 {
+		t.Error("other sources should not be tarpitted")
+	}
+
+	d.Record(ctx, "key-broken", abuse.KindValidation)
+	d.Record(ctx, "key-broken", abuse.KindValidation)
+	block, blocked, _ := d.Check("ip-10.0.0.1", "key-broken")
+	if !blocked || block.Source != "key-broken" || block.Kind != abuse.KindValidation || block.Failures != 5 {
+		t.Fatalf("over block threshold: %+v, %v", block, blocked)
+	}
+
+	// Blocks are shared with other nodes through the store
+	other := abuse.NewDetector(store, abuse.Config{BlockThreshold: 5})
+	if err := other.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, blocked, _ := other.Check("key-broken"); !blocked {
+		t.Error("block not shared through the store")
+	}
+
+	existed, err := other.Clear(ctx, "key-broken")
+	if err != nil || !existed {
+		t.Fatalf("clear: %v, %v", existed, err)
+	}
+	d.Load(ctx)
+	if len(d.Blocks()) != 0 {
+		t.Errorf("block not cleared: %+v", d.Blocks())
+	}
+
+	// Clearing forgets the failures, so one more doesn't block again
+	d.Clear(ctx, "key-broken")
+	d.Record(ctx, "key-broken", abuse.KindValidation)
+	if _, blocked, delay := d.Check("key-broken"); blocked || delay != 0 {
+		t.Errorf("after clear: blocked %v, delay %v", blocked, delay)
+	}
+}
+
+func TestNewDetector_Disabled(t *testing.T) {
+	if d := abuse.NewDetector(state.NewNoopStore(""), abuse.Config{}); d != nil {
+		t.Error("expected no detector without thresholds")
+	}
+}
+
+func TestDetector_SourcesBehindTrustedProxies(t *testing.T) {
+	proxies, err := abuse.ParseProxies([]string{"10.0.0.0/8", " 192.168.1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := abuse.ParseProxies([]string{"lb.internal"}); err == nil {
+		t.Error("expected an error for a hostname")
+	}
+	detector := abuse.NewDetector(nil, abuse.Config{BlockThreshold: 1, TrustedProxies: proxies})
+
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		// Direct clients are counted by their own address, whatever they claim
+		{"203.0.113.7:1000", "198.51.100.1", "ip-203.0.113.7"},
+		// Behind the load balancer, the client it saw
+		{"10.1.2.3:1000", "198.51.100.1", "ip-198.51.100.1"},
+		// Hops before the last untrusted one are the client's to forge
+		{"10.1.2.3:1000", "1.2.3.4, 198.51.100.1, 192.168.1.5", "ip-198.51.100.1"},
+		// Without a forwarded client, the proxy itself
+		{"10.1.2.3:1000", "", "ip-10.1.2.3"},
+		{"10.1.2.3:1000", "not-an-ip", "ip-10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/ingest", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if ip, _ := detector.Sources(r); ip != tt.want {
+			t.Errorf("%s via %q: got %s, want %s", tt.remote, tt.forwarded, ip, tt.want)
+		}
+	}
+}
+
+// forgetfulStore counts failure windows but keeps no values, like the noop
+// store does
+type forgetfulStore struct {
+	state.StateStore
+}
+
+func (forgetfulStore) Get(ctx context.Context, key string) ([]byte, error) { return nil, nil }
+
+func (forgetfulStore) Set(ctx context.Context, key string, value []byte) error { return nil }
+
+func (forgetfulStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func TestDetector_EmptyStoreKeepsBlocks(t *testing.T) {
+	ctx := context.Background()
+	memory := state.NewMemoryStore(state.MemoryConfig{})
+	defer memory.Close()
+
+	d := abuse.NewDetector(forgetfulStore{memory}, abuse.Config{BlockThreshold: 1, BlockDuration: time.Minute})
+	if err := d.Record(ctx, "key-broken", abuse.KindValidation); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, blocked, _ := d.Check("key-broken"); !blocked {
+		t.Error("reloading an empty store lifted the block")
+	}
+}
+
+func TestDetector_ConcurrentNodesKeepEachOthersBlocks(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		node := abuse.NewDetector(store, abuse.Config{BlockThreshold: 1, BlockDuration: time.Minute})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := node.Record(ctx, fmt.Sprintf("key-%d", i), abuse.KindValidation); err != nil {
+				t.Errorf("Record: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reader := abuse.NewDetector(store, abuse.Config{BlockThreshold: 1})
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reader.Blocks()); n != 8 {
+		t.Errorf("expected 8 blocks, got %d", n)
+	}
+}
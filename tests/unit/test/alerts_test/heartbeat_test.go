@@ -0,0 +1,185 @@
+package alerts_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// collector records emitted alert events
+type collector struct {
+	events []*models.LogEvent
+}
+
+func (c *collector) emit(event *models.LogEvent) {
+	c.events = append(c.events, event)
+}
+
+func register(t *testing.T, m *alerts.HeartbeatMonitor, tenant, source, interval string) {
+	t.Helper()
+	if _, err := m.Register(context.Background(), alerts.Heartbeat{TenantID: tenant, Source: source, Interval: interval}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeartbeat_AlertsOnceAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	nodeA := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	nodeB := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	register(t, nodeA, "acme", "Billing-Agent", "1m")
+
+	// Node B learns of the registration on its next check
+	alerted := &collector{}
+	now := time.Now()
+	for _, m := range []*alerts.HeartbeatMonitor{nodeA, nodeB} {
+		if err := m.Check(ctx, now.Add(30*time.Second), alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerted.events) != 0 {
+		t.Fatalf("expected no alert within the interval, got %d", len(alerted.events))
+	}
+
+	// Silent past the interval: exactly one alert
+	for _, m := range []*alerts.HeartbeatMonitor{nodeA, nodeB, nodeA} {
+		if err := m.Check(ctx, now.Add(2*time.Minute), alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerted.events) != 1 {
+		t.Fatalf("expected one alert, got %d", len(alerted.events))
+	}
+	alert := alerted.events[0]
+	if alert.TenantID != "acme" || alert.Source != alerts.HeartbeatSource || alert.Severity != models.SeverityCritical {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+	if alert.Metadata["heartbeat_source"] != "billing-agent" || alert.Metadata["heartbeat_status"] != alerts.StatusMissing {
+		t.Errorf("unexpected alert metadata: %v", alert.Metadata)
+	}
+	if alert.ID == "" || alert.Metadata.Get("last_seen") == "" {
+		t.Errorf("expected an ID and last-seen time: %+v", alert)
+	}
+
+	statuses, err := nodeB.Status(ctx, "acme")
+	if err != nil || len(statuses) != 1 || !statuses[0].Missing {
+		t.Fatalf("expected the source to be reported missing, got %+v, %v", statuses, err)
+	}
+
+	// An event on node B resolves it, once
+	nodeB.Observe(&models.LogEvent{TenantID: "acme", Source: "billing-agent"})
+	for _, m := range []*alerts.HeartbeatMonitor{nodeB, nodeA} {
+		if err := m.Check(ctx, time.Now(), alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerted.events) != 2 {
+		t.Fatalf("expected a recovery event, got %d events", len(alerted.events))
+	}
+	recovered := alerted.events[1]
+	if recovered.Severity != models.SeverityInfo || recovered.Metadata["heartbeat_status"] != alerts.StatusRecovered {
+		t.Errorf("unexpected recovery: %+v", recovered)
+	}
+	if statuses, _ := nodeA.Status(ctx, "acme"); len(statuses) != 1 || statuses[0].Missing || statuses[0].LastSeen == nil {
+		t.Errorf("expected the source to be healthy, got %+v", statuses)
+	}
+}
+
+func TestHeartbeat_ObserveIgnoresUnregistered(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	m := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	register(t, m, "acme", "api", "10s")
+
+	// Other tenants' events with the same source do not count
+	m.Observe(&models.LogEvent{TenantID: "other", Source: "api"})
+	alerted := &collector{}
+	if err := m.Check(ctx, time.Now().Add(time.Minute), alerted.emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerted.events) != 1 {
+		t.Fatalf("expected an alert, got %d", len(alerted.events))
+	}
+	if statuses, _ := m.Status(ctx, "other"); len(statuses) != 0 {
+		t.Errorf("expected no heartbeats for other tenants, got %+v", statuses)
+	}
+}
+
+func TestHeartbeat_Unregister(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	m := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	register(t, m, "acme", "api", "10s")
+
+	existed, err := m.Unregister(ctx, "acme", "API")
+	if err != nil || !existed {
+		t.Fatalf("expected the heartbeat to be removed, got %v, %v", existed, err)
+	}
+	if existed, _ := m.Unregister(ctx, "acme", "api"); existed {
+		t.Error("expected a second removal to find nothing")
+	}
+
+	alerted := &collector{}
+	if err := m.Check(ctx, time.Now().Add(time.Hour), alerted.emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerted.events) != 0 {
+		t.Errorf("expected no alerts after removal, got %d", len(alerted.events))
+	}
+}
+
+func TestHeartbeat_NodesKeepEachOthersRegistrations(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	// Neither node has loaded the other's heartbeat before registering its own
+	nodeA := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	nodeB := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	register(t, nodeA, "acme", "api", "10s")
+	register(t, nodeB, "globex", "api", "10s")
+
+	reader := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"acme", "globex"} {
+		if statuses, _ := reader.Status(ctx, tenantID); len(statuses) != 1 {
+			t.Errorf("%s: heartbeat lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the heartbeats registered here
+	noop := alerts.NewHeartbeatMonitor(state.NewNoopStore(""), alerts.NewNoopEngine())
+	register(t, noop, "acme", "api", "10s")
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if statuses, _ := noop.Status(ctx, "acme"); len(statuses) != 1 {
+		t.Error("reloading an empty store dropped the heartbeat")
+	}
+}
+
+func TestHeartbeat_RejectsInvalid(t *testing.T) {
+	m := alerts.NewHeartbeatMonitor(state.NewMemoryStore(state.MemoryConfig{}), alerts.NewNoopEngine())
+	ctx := context.Background()
+
+	tests := []struct {
+		heartbeat alerts.Heartbeat
+		want      error
+	}{
+		{alerts.Heartbeat{Source: "api", Interval: "1m"}, alerts.ErrInvalidHeartbeat},
+		{alerts.Heartbeat{TenantID: "acme", Interval: "1m"}, alerts.ErrInvalidHeartbeat},
+		{alerts.Heartbeat{TenantID: "acme", Source: "api", Interval: "5s"}, alerts.ErrInvalidInterval},
+		{alerts.Heartbeat{TenantID: "acme", Source: "api", Interval: "often"}, alerts.ErrInvalidInterval},
+	}
+	for _, tt := range tests {
+		if _, err := m.Register(ctx, tt.heartbeat); !errors.Is(err, tt.want) {
+			t.Errorf("%+v: expected %v, got %v", tt.heartbeat, tt.want, err)
+		}
+	}
+}
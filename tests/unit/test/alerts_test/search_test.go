@@ -0,0 +1,188 @@
+package alerts_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// fakeCounter returns a set count and records the ranges it counted
+type fakeCounter struct {
+	count  int
+	err    error
+	ranges [][2]time.Time
+}
+
+func (c *fakeCounter) Count(ctx context.Context, tenantID, query string, from, to time.Time) (int, error) {
+	c.ranges = append(c.ranges, [2]time.Time{from, to})
+	return c.count, c.err
+}
+
+func TestSearch_Validation(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	m := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), &fakeCounter{})
+
+	tests := []struct {
+		search alerts.SavedSearch
+		want   error
+	}{
+		{alerts.SavedSearch{TenantID: "acme", Query: `{source="api"}`, Every: "5m"}, alerts.ErrInvalidSearch},
+		{alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{source="api"} | json`, Every: "5m"}, alerts.ErrInvalidSearchQuery},
+		{alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{tenant="globex"}`, Every: "5m"}, alerts.ErrInvalidSearchQuery},
+		{alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{source="api"}`, Every: "30s"}, alerts.ErrInvalidSearchInterval},
+		{alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{source="api"}`, Every: "5m", Condition: "equal"}, alerts.ErrInvalidCondition},
+		{alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{source="api"}`, Every: "5m", Threshold: -1}, alerts.ErrInvalidCondition},
+	}
+	for _, tt := range tests {
+		if _, err := m.Save(context.Background(), tt.search); !errors.Is(err, tt.want) {
+			t.Errorf("Save(%+v) = %v, want %v", tt.search, err, tt.want)
+		}
+	}
+
+	saved, err := m.Save(context.Background(), alerts.SavedSearch{TenantID: "acme", Name: " Timeouts ", Query: `{source="api"}`, Every: "300s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "timeouts" || saved.Every != "5m0s" || saved.Condition != alerts.ConditionAbove {
+		t.Errorf("unexpected saved search %+v", saved)
+	}
+}
+
+func TestSearch_AlertsOncePerPeriodAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	counter := &fakeCounter{count: 12}
+	nodeA := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), counter)
+	nodeB := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), counter)
+	if _, err := nodeA.Save(ctx, alerts.SavedSearch{TenantID: "acme", Name: "timeouts", Query: `{source="api"} |= "timeout"`, Every: "5m", Threshold: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both nodes check during a period; it is counted and alerted once
+	now := time.Date(2024, 6, 1, 12, 7, 30, 0, time.UTC)
+	alerted := &collector{}
+	for _, m := range []*alerts.SearchMonitor{nodeA, nodeB, nodeA} {
+		if err := m.Check(ctx, now, alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(counter.ranges) != 1 || len(alerted.events) != 1 {
+		t.Fatalf("expected one run and one alert, got %d runs and %d alerts", len(counter.ranges), len(alerted.events))
+	}
+	from, to := counter.ranges[0][0], counter.ranges[0][1]
+	if !from.Equal(now.Truncate(5*time.Minute).Add(-5*time.Minute)) || !to.Equal(now.Truncate(5*time.Minute)) {
+		t.Errorf("expected the last complete period, got %s..%s", from, to)
+	}
+	alert := alerted.events[0]
+	if alert.TenantID != "acme" || alert.Source != alerts.SearchSource || alert.Severity != models.SeverityError ||
+		alert.Metadata["search_status"] != alerts.StatusFiring || alert.Metadata["search_count"] != "12" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+
+	// Still above in the next period: no new alert
+	next := now.Add(5 * time.Minute)
+	if err := nodeB.Check(ctx, next, alerted.emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(counter.ranges) != 2 || len(alerted.events) != 1 {
+		t.Fatalf("expected a second run without a new alert, got %d runs and %d alerts", len(counter.ranges), len(alerted.events))
+	}
+
+	// Back under the threshold: one resolution
+	counter.count = 3
+	for _, m := range []*alerts.SearchMonitor{nodeA, nodeB} {
+		if err := m.Check(ctx, next.Add(5*time.Minute), alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerted.events) != 2 || alerted.events[1].Metadata["search_status"] != alerts.StatusResolved {
+		t.Fatalf("expected a resolution, got %+v", alerted.events)
+	}
+
+	statuses, err := nodeB.Status(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Firing || statuses[0].LastCount == nil || *statuses[0].LastCount != 3 {
+		t.Errorf("unexpected status %+v", statuses)
+	}
+}
+
+func TestSearch_BelowAndRetriesFailedRuns(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	counter := &fakeCounter{err: errors.New("scan failed")}
+	m := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), counter)
+	if _, err := m.Save(ctx, alerts.SavedSearch{TenantID: "acme", Name: "logins", Query: `{source="auth"}`, Every: "1m", Condition: alerts.ConditionBelow, Threshold: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 30, 0, time.UTC)
+	alerted := &collector{}
+	if err := m.Check(ctx, now, alerted.emit); err == nil {
+		t.Fatal("expected the count's error")
+	}
+
+	// The failed period is run again, and too few events alert
+	counter.err, counter.count = nil, 2
+	if err := m.Check(ctx, now, alerted.emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(counter.ranges) != 2 || len(alerted.events) != 1 || alerted.events[0].Metadata["search_status"] != alerts.StatusFiring {
+		t.Errorf("expected a retried run and an alert, got %d runs and %+v", len(counter.ranges), alerted.events)
+	}
+
+	// Deleting the search drops its state
+	if existed, err := m.Delete(ctx, "acme", "Logins"); err != nil || !existed {
+		t.Fatalf("Delete = %v, %v", existed, err)
+	}
+	if statuses, err := m.Status(ctx, "acme"); err != nil || len(statuses) != 0 {
+		t.Errorf("expected no searches, got %+v, %v", statuses, err)
+	}
+}
+
+func TestSearch_NodesKeepEachOthersSearches(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	search := func(tenantID string) alerts.SavedSearch {
+		return alerts.SavedSearch{TenantID: tenantID, Name: "timeouts", Query: `{source="api"}`, Every: "5m"}
+	}
+
+	// Neither node has loaded the other's search before saving its own
+	nodeA := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), &fakeCounter{})
+	nodeB := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), &fakeCounter{})
+	if _, err := nodeA.Save(ctx, search("acme")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nodeB.Save(ctx, search("globex")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), &fakeCounter{})
+	for _, tenantID := range []string{"acme", "globex"} {
+		if statuses, err := reader.Status(ctx, tenantID); err != nil || len(statuses) != 1 {
+			t.Errorf("%s: search lost to another node's write (%v)", tenantID, err)
+		}
+	}
+
+	// A store that keeps nothing leaves the searches saved here in place
+	noop := alerts.NewSearchMonitor(state.NewNoopStore(""), alerts.NewNoopEngine(), &fakeCounter{})
+	if _, err := noop.Save(ctx, search("acme")); err != nil {
+		t.Fatal(err)
+	}
+	if statuses, err := noop.Status(ctx, "acme"); err != nil || len(statuses) != 1 {
+		t.Errorf("reloading an empty store dropped the search: %+v, %v", statuses, err)
+	}
+}
@@ -0,0 +1,186 @@
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqpgo "github.com/rabbitmq/amqp091-go"
+
+	"parsec/internal/amqp"
+	"parsec/internal/bus"
+	"parsec/internal/config"
+)
+
+type published struct {
+	exchange string
+	key      string
+	msg      amqpgo.Publishing
+}
+
+// fakeChannel confirms publishes, nacking the first nacks of them
+type fakeChannel struct {
+	mu        sync.Mutex
+	declared  string
+	confirms  chan amqpgo.Confirmation
+	closed    chan *amqpgo.Error
+	published []published
+	seq       uint64
+	nacks     int
+	silent    bool // never confirm
+}
+
+func (f *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqpgo.Table) error {
+	f.declared = name + ":" + kind
+	return nil
+}
+
+func (f *fakeChannel) Confirm(noWait bool) error { return nil }
+
+func (f *fakeChannel) NotifyPublish(c chan amqpgo.Confirmation) chan amqpgo.Confirmation {
+	f.confirms = c
+	return c
+}
+
+func (f *fakeChannel) NotifyClose(c chan *amqpgo.Error) chan *amqpgo.Error {
+	f.closed = c
+	return c
+}
+
+func (f *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqpgo.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	if f.silent {
+		return nil
+	}
+	ack := f.nacks == 0
+	if !ack {
+		f.nacks--
+	} else {
+		f.published = append(f.published, published{exchange, key, msg})
+	}
+	f.confirms <- amqpgo.Confirmation{DeliveryTag: f.seq, Ack: ack}
+	return nil
+}
+
+func (f *fakeChannel) Close() error { return nil }
+
+// dialer hands out the given channels in order
+func dialer(channels ...*fakeChannel) (amqp.Dialer, *int) {
+	dials := 0
+	return func() (amqp.Channel, error) {
+		if dials >= len(channels) {
+			return nil, errors.New("connection refused")
+		}
+		dials++
+		return channels[dials-1], nil
+	}, &dials
+}
+
+func amqpConfig() config.AMQPConfig {
+	return config.AMQPConfig{
+		Exchange:       "parsec",
+		ExchangeType:   "topic",
+		RoutingKey:     "{topic}.{tenant}.{severity}",
+		PublishTimeout: 50 * time.Millisecond,
+	}
+}
+
+func message(id, tenant, severity string) bus.Message {
+	return bus.Message{
+		Topic: "logs",
+		Key:   []byte(tenant),
+		Value: []byte(`{"event":{}}`),
+		Headers: []bus.Header{
+			{Key: "tenant_id", Value: []byte(tenant)},
+			{Key: "event_id", Value: []byte(id)},
+			{Key: "severity", Value: []byte(severity)},
+			{Key: bus.HeaderContentEncoding, Value: []byte(bus.EncodingGzip)},
+		},
+	}
+}
+
+func TestSender_PublishesWithRoutingKey(t *testing.T) {
+	ch := &fakeChannel{}
+	dial, _ := dialer(ch)
+	s, err := amqp.New(amqpConfig(), dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.declared != "parsec:topic" {
+		t.Errorf("expected topic exchange parsec, got %q", ch.declared)
+	}
+
+	errs := s.Send(context.Background(), []bus.Message{message("a", "acme", "ERROR"), message("b", "acme.eu", "")})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ch.published) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(ch.published))
+	}
+	first, second := ch.published[0], ch.published[1]
+	if first.exchange != "parsec" || first.key != "logs.acme.error" {
+		t.Errorf("unexpected routing %s/%s", first.exchange, first.key)
+	}
+	// Dots in values must not add routing key words
+	if second.key != "logs.acme_eu.none" {
+		t.Errorf("unexpected routing key %q", second.key)
+	}
+	if first.msg.MessageId != "a" || first.msg.ContentEncoding != bus.EncodingGzip ||
+		first.msg.DeliveryMode != amqpgo.Persistent || first.msg.Headers["partition_key"] != "acme" {
+		t.Errorf("unexpected publishing %+v", first.msg)
+	}
+}
+
+func TestSender_ReportsNacksAndTimeouts(t *testing.T) {
+	ch := &fakeChannel{nacks: 1}
+	dial, _ := dialer(ch)
+	s, err := amqp.New(amqpConfig(), dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := s.Send(context.Background(), []bus.Message{message("a", "acme", "INFO"), message("b", "acme", "INFO")})
+	if !errors.Is(errs[0], amqp.ErrNacked) || errs[1] != nil {
+		t.Errorf("expected the first message to be nacked, got %v", errs)
+	}
+
+	ch.silent = true
+	errs = s.Send(context.Background(), []bus.Message{message("c", "acme", "INFO")})
+	if !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("expected an unconfirmed message to time out, got %v", errs[0])
+	}
+}
+
+func TestSender_ReconnectsAfterClose(t *testing.T) {
+	first, second := &fakeChannel{}, &fakeChannel{}
+	dial, dials := dialer(first, second)
+	s, err := amqp.New(amqpConfig(), dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The broker closes the channel; the next send dials again
+	first.closed <- &amqpgo.Error{Code: amqpgo.ConnectionForced, Reason: "broker restart"}
+	errs := s.Send(context.Background(), []bus.Message{message("a", "acme", "INFO")})
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if *dials != 2 || len(second.published) != 1 {
+		t.Errorf("expected the message on a new channel, dials=%d", *dials)
+	}
+
+	// While the broker is unreachable every message fails and is retried later
+	second.closed <- &amqpgo.Error{Code: amqpgo.ConnectionForced}
+	errs = s.Send(context.Background(), []bus.Message{message("b", "acme", "INFO")})
+	if errs[0] == nil {
+		t.Error("expected an error while the broker is down")
+	}
+}
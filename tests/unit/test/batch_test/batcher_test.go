@@ -0,0 +1,299 @@
+package batch_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/batch"
+)
+
+// sink records each batch flushed
+type sink struct {
+	mu      sync.Mutex
+	batches [][]int
+}
+
+func (s *sink) flush(ctx context.Context, items []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The batcher reuses the slice
+	s.batches = append(s.batches, append([]int(nil), items...))
+}
+
+func (s *sink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizes := make([]int, len(s.batches))
+	for i, b := range s.batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+func (s *sink) total() int {
+	total := 0
+	for _, n := range s.sizes() {
+		total += n
+	}
+	return total
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatcher_FlushesFullBatches(t *testing.T) {
+	in := make(chan int, 100)
+	s := &sink{}
+	b := batch.New(batch.Config[int]{
+		Input:   in,
+		Workers: 1,
+		Size:    10,
+		Timeout: time.Hour,
+		Flush:   s.flush,
+	})
+	b.Start()
+	defer b.Stop()
+
+	for i := 0; i < 30; i++ {
+		in <- i
+	}
+	waitFor(t, func() bool { return s.total() == 30 })
+
+	sizes := s.sizes()
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 10 || sizes[2] != 10 {
+		t.Errorf("flushed batches %v, want [10 10 10]", sizes)
+	}
+	// A single worker keeps the input order
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.batches[1] {
+		if v != 10+i {
+			t.Fatalf("second batch %v is out of order", s.batches[1])
+		}
+	}
+}
+
+func TestBatcher_FlushesPartialBatchOnTimeout(t *testing.T) {
+	in := make(chan int, 10)
+	s := &sink{}
+	b := batch.New(batch.Config[int]{
+		Input:   in,
+		Workers: 2,
+		Size:    100,
+		Timeout: 10 * time.Millisecond,
+		Flush:   s.flush,
+	})
+	b.Start()
+	defer b.Stop()
+
+	in <- 1
+	in <- 2
+	waitFor(t, func() bool { return s.total() == 2 })
+}
+
+func TestBatcher_ForcedFlush(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		in := make(chan int, 10)
+		s := &sink{}
+		b := batch.New(batch.Config[int]{
+			Input:         in,
+			Workers:       2,
+			Size:          100,
+			Timeout:       time.Hour,
+			Flush:         s.flush,
+			Compact:       compact,
+			CompactLinger: time.Hour,
+		})
+		b.Start()
+
+		for i := 0; i < 5; i++ {
+			in <- i
+		}
+		waitFor(t, func() bool { return len(in) == 0 })
+		// Let the workers append what they received
+		time.Sleep(10 * time.Millisecond)
+
+		b.Flush()
+		waitFor(t, func() bool { return s.total() == 5 })
+		b.Stop()
+	}
+}
+
+func TestBatcher_StopFlushesEverything(t *testing.T) {
+	in := make(chan int, 100)
+	s := &sink{}
+	var compacted sync.WaitGroup
+	compacted.Add(1)
+	var once sync.Once
+	b := batch.New(batch.Config[int]{
+		Input:         in,
+		Workers:       4,
+		Size:          100,
+		Timeout:       10 * time.Millisecond,
+		Flush:         s.flush,
+		Compact:       true,
+		CompactLinger: time.Hour,
+		OnCompact:     func() { once.Do(compacted.Done) },
+	})
+	b.Start()
+
+	for i := 0; i < 7; i++ {
+		in <- i
+	}
+	// The partial batches sit with the aggregator until Stop
+	compacted.Wait()
+	b.Stop()
+	b.Stop() // safe to repeat
+
+	if got := s.total(); got != 7 {
+		t.Errorf("flushed %d items, want 7", got)
+	}
+}
+
+func TestBatcher_StopsWhenInputCloses(t *testing.T) {
+	in := make(chan int, 10)
+	s := &sink{}
+	b := batch.New(batch.Config[int]{
+		Input:   in,
+		Workers: 3,
+		Size:    100,
+		Timeout: time.Hour,
+		Flush:   s.flush,
+	})
+	b.Start()
+
+	in <- 1
+	in <- 2
+	in <- 3
+	close(in)
+	waitFor(t, func() bool { return s.total() == 3 })
+	b.Stop()
+}
+
+func TestBatcher_Defaults(t *testing.T) {
+	b := batch.New(batch.Config[string]{Flush: func(context.Context, []string) {}})
+	if b.Workers() != 4 || b.Size() != 100 || b.Timeout() != 100*time.Millisecond {
+		t.Errorf("unexpected defaults: %d workers, size %d, timeout %s", b.Workers(), b.Size(), b.Timeout())
+	}
+}
+
+func TestBatcher_Stats(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		in := make(chan int, 100)
+		s := &sink{}
+		b := batch.New(batch.Config[int]{
+			Input:   in,
+			Workers: 2,
+			Size:    5,
+			Timeout: time.Hour,
+			Flush:   s.flush,
+			Compact: compact,
+		})
+		b.Start()
+
+		for i := 0; i < 20; i++ {
+			in <- i
+		}
+		waitFor(t, func() bool { return s.total() == 20 })
+		b.Stop()
+
+		stats := b.Stats()
+		want := 2
+		if compact {
+			want = 3
+		}
+		if len(stats) != want {
+			t.Fatalf("compact=%v: expected %d entries, got %+v", compact, want, stats)
+		}
+		if compact && stats[2].ID != -1 {
+			t.Errorf("expected the aggregator last, got %+v", stats[2])
+		}
+		var batches, items uint64
+		for i, ws := range stats[:2] {
+			if ws.ID != i {
+				t.Errorf("expected worker %d, got %+v", i, ws)
+			}
+			batches += ws.Batches
+			items += ws.Items
+			if ws.Batches > 0 && ws.LastFlush == nil {
+				t.Errorf("expected a last flush time, got %+v", ws)
+			}
+		}
+		if batches != 4 || items != 20 {
+			t.Errorf("compact=%v: expected 4 batches of 20 items, got %d of %d", compact, batches, items)
+		}
+	}
+}
+
+func TestBatcher_ReportsWorkerIDs(t *testing.T) {
+	in := make(chan int, 100)
+	var (
+		mu       sync.Mutex
+		flushers = make(map[int]int)
+		takers   = make(map[int]int)
+	)
+	b := batch.New(batch.Config[int]{
+		Input:         in,
+		Workers:       2,
+		Size:          5,
+		Timeout:       10 * time.Millisecond,
+		Compact:       true,
+		CompactLinger: 10 * time.Millisecond,
+		Flush: func(ctx context.Context, items []int) {
+			id, ok := batch.WorkerID(ctx)
+			if !ok {
+				t.Error("flush without a worker ID")
+			}
+			mu.Lock()
+			flushers[id] += len(items)
+			mu.Unlock()
+		},
+		OnTake: func(worker int, item int) {
+			mu.Lock()
+			takers[worker]++
+			mu.Unlock()
+		},
+	})
+	b.Start()
+	defer b.Stop()
+
+	// Full batches are delivered by workers, the timed-out rest by the
+	// aggregator
+	for i := 0; i < 12; i++ {
+		in <- i
+	}
+	total := func(m map[int]int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, v := range m {
+			n += v
+		}
+		return n
+	}
+	waitFor(t, func() bool { return total(flushers) == 12 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for id := range flushers {
+		if id != 0 && id != 1 && id != batch.Aggregator {
+			t.Errorf("unexpected worker ID %d", id)
+		}
+	}
+	if takers[0]+takers[1] != 12 || len(takers) > 2 {
+		t.Errorf("unexpected items taken per worker %v", takers)
+	}
+	if _, ok := batch.WorkerID(context.Background()); ok {
+		t.Error("worker ID outside of a flush")
+	}
+}
@@ -0,0 +1,254 @@
+package browser_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"parsec/internal/browser"
+	"parsec/internal/objstore"
+)
+
+// appMap maps app.min.js: generated 1:1 to src/app.ts 1:1, generated 1:11
+// to handleClick at 1:11, and generated line 2 to src/app.ts line 2
+const appMap = `{"version":3,"file":"app.min.js","sources":["src/app.ts"],"names":["handleClick"],"mappings":"AAAA,UAAUA;AACA"}`
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		header string
+		want   browser.UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Safari/537.36",
+			browser.UserAgent{Browser: "Chrome", BrowserVersion: "120.0.6099.71", OS: "Windows", OSVersion: "10", Device: browser.DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61",
+			browser.UserAgent{Browser: "Edge", BrowserVersion: "120.0.2210.61", OS: "Windows", OSVersion: "10", Device: browser.DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			browser.UserAgent{Browser: "Safari", BrowserVersion: "17.1.2", OS: "iOS", OSVersion: "17.1.2", Device: browser.DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			browser.UserAgent{Browser: "Firefox", BrowserVersion: "121.0", OS: "macOS", OSVersion: "10.15", Device: browser.DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			browser.UserAgent{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", OSVersion: "14", Device: browser.DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			browser.UserAgent{Device: browser.DeviceBot},
+		},
+		{"", browser.UserAgent{}},
+	}
+
+	for _, tt := range tests {
+		if got := browser.ParseUserAgent(tt.header); got != tt.want {
+			t.Errorf("ParseUserAgent(%q) = %+v, want %+v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGeoDB_Lookup(t *testing.T) {
+	db, err := browser.ReadGeoDB(strings.NewReader(`network,country,region,city
+# comments and blank lines are skipped
+
+203.0.113.0/24,AU,NSW,Sydney
+203.0.0.0/16,AU
+2001:db8::/32,DE,BE,Berlin
+`))
+	if err != nil {
+		t.Fatalf("ReadGeoDB: %v", err)
+	}
+	if db.Len() != 3 {
+		t.Errorf("expected 3 networks, got %d", db.Len())
+	}
+
+	tests := []struct {
+		addr string
+		want browser.Location
+		ok   bool
+	}{
+		{"203.0.113.9", browser.Location{Country: "AU", Region: "NSW", City: "Sydney"}, true},
+		{"203.0.7.1", browser.Location{Country: "AU"}, true},
+		{"::ffff:203.0.113.9", browser.Location{Country: "AU", Region: "NSW", City: "Sydney"}, true},
+		{"2001:db8::1", browser.Location{Country: "DE", Region: "BE", City: "Berlin"}, true},
+		{"198.51.100.1", browser.Location{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(netip.MustParseAddr(tt.addr))
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v, %v", tt.addr, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	var none *browser.GeoDB
+	if _, ok := none.Lookup(netip.MustParseAddr("203.0.113.9")); ok {
+		t.Error("expected a nil GeoDB to find nothing")
+	}
+
+	for _, bad := range []string{"not-a-network,AU", "203.0.113.0/24", "203.0.113.0/24,"} {
+		if _, err := browser.ReadGeoDB(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestSourceMap_Lookup(t *testing.T) {
+	m, err := browser.ParseSourceMap([]byte(appMap))
+	if err != nil {
+		t.Fatalf("ParseSourceMap: %v", err)
+	}
+
+	tests := []struct {
+		line, column int
+		want         browser.Position
+		ok           bool
+	}{
+		{1, 1, browser.Position{Source: "src/app.ts", Line: 1, Column: 1}, true},
+		{1, 5, browser.Position{Source: "src/app.ts", Line: 1, Column: 1}, true},
+		{1, 11, browser.Position{Source: "src/app.ts", Line: 1, Column: 11, Name: "handleClick"}, true},
+		{1, 40, browser.Position{Source: "src/app.ts", Line: 1, Column: 11, Name: "handleClick"}, true},
+		{2, 3, browser.Position{Source: "src/app.ts", Line: 2, Column: 11}, true},
+		{3, 1, browser.Position{}, false},
+		{0, 1, browser.Position{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := m.Lookup(tt.line, tt.column)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%d, %d) = %+v, %v; want %+v, %v", tt.line, tt.column, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	rooted, err := browser.ParseSourceMap([]byte(`{"version":3,"sourceRoot":"webpack:///","sources":["app.ts"],"names":[],"mappings":"AAAA"}`))
+	if err != nil {
+		t.Fatalf("ParseSourceMap: %v", err)
+	}
+	if pos, _ := rooted.Lookup(1, 1); pos.Source != "webpack:///app.ts" {
+		t.Errorf("expected sourceRoot to be applied, got %q", pos.Source)
+	}
+}
+
+func TestParseSourceMap_Invalid(t *testing.T) {
+	for _, doc := range []string{
+		`not json`,
+		`{"version":2,"sources":[],"mappings":""}`,
+		`{"version":3,"sections":[{}]}`,
+		`{"version":3,"sources":["a.js"],"mappings":"AA!A"}`,
+		`{"version":3,"sources":["a.js"],"mappings":"ACAA"}`,
+		`{"version":3,"sources":["a.js"],"names":[],"mappings":"AAAAA"}`,
+		`{"version":3,"sources":["a.js"],"mappings":"AAA"}`,
+		`{"version":3,"sources":["a.js"],"mappings":"g"}`,
+	} {
+		if _, err := browser.ParseSourceMap([]byte(doc)); !errors.Is(err, browser.ErrInvalidSourceMap) {
+			t.Errorf("%s: expected ErrInvalidSourceMap, got %v", doc, err)
+		}
+	}
+}
+
+func TestParseStack(t *testing.T) {
+	chrome := `TypeError: Cannot read properties of undefined (reading 'id')
+    at handleClick (https://example.com/static/app.min.js:1:11)
+    at https://example.com/static/app.min.js?v=3:2:5
+    at async Promise.all (index 0)`
+	want := []browser.Frame{
+		{Function: "handleClick", File: "https://example.com/static/app.min.js", Line: 1, Column: 11},
+		{File: "https://example.com/static/app.min.js?v=3", Line: 2, Column: 5},
+	}
+	if got := browser.ParseStack(chrome); !equalFrames(got, want) {
+		t.Errorf("chrome: got %+v, want %+v", got, want)
+	}
+
+	gecko := `handleClick@https://example.com/static/app.min.js:1:11
+@https://example.com/static/app.min.js:2:5
+`
+	if got := browser.ParseStack(gecko); !equalFrames(got, want[:1]) || len(got) != 2 || got[1].Function != "" {
+		t.Errorf("gecko: got %+v", got)
+	}
+
+	formatted := browser.FormatStack(want)
+	if formatted != "    at handleClick (https://example.com/static/app.min.js:1:11)\n    at https://example.com/static/app.min.js?v=3:2:5" {
+		t.Errorf("unexpected formatted stack:\n%s", formatted)
+	}
+
+	long := strings.Repeat("    at f (https://example.com/a.js:1:1)\n", browser.MaxFrames+10)
+	if got := browser.ParseStack(long); len(got) != browser.MaxFrames {
+		t.Errorf("expected %d frames, got %d", browser.MaxFrames, len(got))
+	}
+}
+
+func TestSourceMaps_Symbolicate(t *testing.T) {
+	ctx := context.Background()
+	maps := browser.NewSourceMaps(objstore.NewDir(t.TempDir()), "maps")
+
+	if err := maps.Put(ctx, "acme", "1.2.0", "app.min.js", []byte(appMap)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := maps.Put(ctx, "acme", "1.2.0", "vendor.js", []byte(`{"version":1}`)); !errors.Is(err, browser.ErrInvalidSourceMap) {
+		t.Errorf("expected ErrInvalidSourceMap, got %v", err)
+	}
+	if err := maps.Put(ctx, "acme", "..", "app.min.js", []byte(appMap)); !errors.Is(err, browser.ErrInvalidName) {
+		t.Errorf("expected ErrInvalidName, got %v", err)
+	}
+
+	infos, err := maps.List(ctx, "acme")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Release != "1.2.0" || infos[0].File != "app.min.js" || infos[0].Size != int64(len(appMap)) {
+		t.Errorf("unexpected source maps: %+v", infos)
+	}
+
+	// The map is found by the script's file name, ignoring the query
+	frames := []browser.Frame{
+		{Function: "a", File: "https://example.com/static/app.min.js?v=3", Line: 1, Column: 11},
+		{File: "https://example.com/static/other.js", Line: 1, Column: 1},
+	}
+	if n := maps.Symbolicate(ctx, "acme", "1.2.0", frames); n != 1 {
+		t.Errorf("expected 1 symbolicated frame, got %d", n)
+	}
+	if frames[0] != (browser.Frame{Function: "handleClick", File: "src/app.ts", Line: 1, Column: 11, Symbolicated: true}) {
+		t.Errorf("unexpected symbolicated frame: %+v", frames[0])
+	}
+	if frames[1].Symbolicated {
+		t.Error("expected the unmapped script to be left alone")
+	}
+
+	// Other releases and tenants have their own maps
+	other := []browser.Frame{{File: "app.min.js", Line: 1, Column: 11}}
+	if n := maps.Symbolicate(ctx, "acme", "1.3.0", other); n != 0 {
+		t.Error("expected no map for another release")
+	}
+	if n := maps.Symbolicate(ctx, "globex", "1.2.0", other); n != 0 {
+		t.Error("expected no map for another tenant")
+	}
+
+	if err := maps.Delete(ctx, "acme", "1.2.0", "app.min.js"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n := maps.Symbolicate(ctx, "acme", "1.2.0", []browser.Frame{{File: "app.min.js", Line: 1, Column: 11}}); n != 0 {
+		t.Error("expected the deleted map to be gone")
+	}
+
+	var none *browser.SourceMaps
+	if n := none.Symbolicate(ctx, "acme", "1.2.0", frames); n != 0 {
+		t.Error("expected a nil store to symbolicate nothing")
+	}
+}
+
+func equalFrames(got, want []browser.Frame) bool {
+	if len(got) < len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
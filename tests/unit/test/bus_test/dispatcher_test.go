@@ -0,0 +1,189 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/pkg/models"
+)
+
+// fakeSender records each Send call and fails messages by event ID
+type fakeSender struct {
+	limits bus.Limits
+
+	mu        sync.Mutex
+	calls     [][]bus.Message
+	transient map[string]int // event ID -> failures left
+	reject    map[string]bool
+}
+
+func (f *fakeSender) Send(ctx context.Context, msgs []bus.Message) []error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, msgs)
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		id := header(msg, "event_id")
+		switch {
+		case f.reject[id] && msg.Topic != "dlq":
+			errs[i] = bus.Permanent(errors.New("invalid message"))
+		case f.transient[id] > 0:
+			f.transient[id]--
+			errs[i] = errors.New("throttled")
+		}
+	}
+	return errs
+}
+
+func (f *fakeSender) Limits() bus.Limits                    { return f.limits }
+func (f *fakeSender) HealthCheck(ctx context.Context) error { return nil }
+func (f *fakeSender) Close() error                          { return nil }
+
+// topics counts the messages sent to each topic, including retries
+func (f *fakeSender) topics() map[string]int {
+	counts := make(map[string]int)
+	for _, call := range f.calls {
+		for _, msg := range call {
+			counts[msg.Topic]++
+		}
+	}
+	return counts
+}
+
+func header(msg bus.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func envelopes(ids ...string) []*models.Envelope {
+	out := make([]*models.Envelope, len(ids))
+	for i, id := range ids {
+		out[i] = &models.Envelope{
+			Event:        &models.LogEvent{ID: id, TenantID: "acme", Timestamp: time.Now(), Message: "boom"},
+			PartitionKey: "acme",
+		}
+	}
+	return out
+}
+
+func dispatcher(sender bus.Sender, dlq string) *bus.Dispatcher {
+	return bus.NewDispatcher("test", sender, &bus.Encoder{Topic: "logs"}, bus.DispatchConfig{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+		DLQTopic:     dlq,
+	})
+}
+
+func TestDispatcher_SplitsByLimits(t *testing.T) {
+	sender := &fakeSender{limits: bus.Limits{Messages: 2}}
+	d := dispatcher(sender, "")
+
+	if err := d.PublishBatch(context.Background(), envelopes("a", "b", "c", "d", "e")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.calls) != 3 {
+		t.Fatalf("expected 3 requests of at most 2 messages, got %d", len(sender.calls))
+	}
+	if stats := d.Stats(); stats.MessagesSent != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDispatcher_RetriesOnlyFailedMessages(t *testing.T) {
+	sender := &fakeSender{transient: map[string]int{"b": 2}}
+	d := dispatcher(sender, "")
+
+	if err := d.PublishBatch(context.Background(), envelopes("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.calls) != 3 || len(sender.calls[1]) != 1 || len(sender.calls[2]) != 1 {
+		t.Errorf("expected retries of the failed message alone, got %d calls", len(sender.calls))
+	}
+
+	// Failing past the retry budget reports the undelivered count
+	sender.transient = map[string]int{"d": 10}
+	err := d.PublishBatch(context.Background(), envelopes("d"))
+	if err == nil || !strings.Contains(err.Error(), "1 of 1") {
+		t.Fatalf("expected an undelivered message, got %v", err)
+	}
+	if stats := d.Stats(); stats.MessagesSent != 3 || stats.MessagesFailed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDispatcher_DeadLettersRejectedMessages(t *testing.T) {
+	sender := &fakeSender{reject: map[string]bool{"b": true}}
+	d := dispatcher(sender, "dlq")
+
+	if err := d.PublishBatch(context.Background(), envelopes("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rejected messages are not retried, only readdressed
+	topics := sender.topics()
+	if topics["logs"] != 2 || topics["dlq"] != 1 {
+		t.Fatalf("unexpected topics %v", topics)
+	}
+	letter := sender.calls[len(sender.calls)-1][0]
+	if header(letter, bus.HeaderDLQTopic) != "logs" || header(letter, bus.HeaderDLQError) != "invalid message" {
+		t.Errorf("unexpected dead-letter headers %v", letter.Headers)
+	}
+	if header(letter, "event_id") != "b" {
+		t.Errorf("expected the original headers to be kept, got %v", letter.Headers)
+	}
+
+	// Without a DLQ topic, a rejection is a failure
+	d = dispatcher(&fakeSender{reject: map[string]bool{"b": true}}, "")
+	if err := d.PublishBatch(context.Background(), envelopes("b")); err == nil {
+		t.Error("expected rejected message to fail without a DLQ topic")
+	}
+}
+
+func TestDispatcher_FailsOversizeMessages(t *testing.T) {
+	sender := &fakeSender{limits: bus.Limits{Bytes: 64}}
+	d := dispatcher(sender, "dlq")
+
+	if err := d.PublishBatch(context.Background(), envelopes("a")); err == nil {
+		t.Fatal("expected oversize message to fail")
+	}
+	if len(sender.calls) != 0 {
+		t.Errorf("expected oversize message not to be sent, got %d calls", len(sender.calls))
+	}
+}
+
+func TestDispatcher_Closed(t *testing.T) {
+	d := dispatcher(&fakeSender{}, "")
+	d.Close()
+	if err := d.Publish(context.Background(), envelopes("a")[0]); !errors.Is(err, bus.ErrPublisherClosed) {
+		t.Errorf("expected ErrPublisherClosed, got %v", err)
+	}
+}
+
+func TestRecord_RoundTrip(t *testing.T) {
+	msg := bus.Message{
+		Value:   []byte{0x1f, 0x8b, 0x00},
+		Headers: []bus.Header{{Key: bus.HeaderContentEncoding, Value: []byte(bus.EncodingGzip)}},
+	}
+
+	data, err := bus.MarshalRecord(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bus.UnmarshalRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Value) != string(msg.Value) || header(got, bus.HeaderContentEncoding) != bus.EncodingGzip {
+		t.Errorf("unexpected record %+v", got)
+	}
+}
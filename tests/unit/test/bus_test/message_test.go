@@ -0,0 +1,32 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/pkg/models"
+)
+
+func TestEncoder_BatchHeaders(t *testing.T) {
+	e := &bus.Encoder{Topic: "logs"}
+	envelope := models.NewEnvelope(&models.LogEvent{ID: "a", TenantID: "acme", Timestamp: time.Now()}, "node-1")
+
+	msg, err := e.Encode(context.Background(), envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header(msg, "batch_id") != "" || header(msg, "batch_index") != "" {
+		t.Errorf("expected no batch headers outside a batch, got %v", msg.Headers)
+	}
+
+	envelope.WithBatch("batch-1", 3)
+	msg, err = e.Encode(context.Background(), envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header(msg, "batch_id") != "batch-1" || header(msg, "batch_index") != "3" {
+		t.Errorf("unexpected batch headers %v", msg.Headers)
+	}
+}
@@ -0,0 +1,145 @@
+package canary_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/canary"
+	"parsec/pkg/models"
+)
+
+// collector records emitted canary events and their partitions
+type collector struct {
+	events     []*models.LogEvent
+	partitions []*int
+}
+
+func (c *collector) emit(event *models.LogEvent, partition *int) {
+	c.events = append(c.events, event)
+	c.partitions = append(c.partitions, partition)
+}
+
+func envelopes(events ...*models.LogEvent) []*models.Envelope {
+	var list []*models.Envelope
+	for _, e := range events {
+		list = append(list, models.NewEnvelope(e, "node-a"))
+	}
+	return list
+}
+
+func TestCanary_SendAndConfirmOnPublish(t *testing.T) {
+	sent := &collector{}
+	c := canary.New(canary.Config{NodeID: "node-a", Tenant: "system"}, sent.emit)
+
+	now := time.Now()
+	c.Send(now)
+	if len(sent.events) != 1 {
+		t.Fatalf("expected one canary event, got %d", len(sent.events))
+	}
+	event := sent.events[0]
+	if event.Source != canary.Source || event.TenantID != "system" || event.Metadata[canary.MetaNode] != "node-a" {
+		t.Errorf("unexpected canary event %+v", event)
+	}
+
+	// Other events published alongside are ignored
+	other := &models.LogEvent{ID: "evt-1", TenantID: "acme", Source: "app"}
+	c.Published(envelopes(other, event), nil)
+
+	stats := c.Stats()
+	if stats.Sent != 1 || stats.Delivered != 1 || stats.Pending != 0 || stats.LastDelivered == nil {
+		t.Errorf("expected the canary delivered, got %+v", stats)
+	}
+	if stats.Confirm != canary.StagePublished {
+		t.Errorf("expected confirmation on publish by default, got %s", stats.Confirm)
+	}
+	if sent.partitions[0] != nil {
+		t.Errorf("expected no partition without a partition count, got %d", *sent.partitions[0])
+	}
+}
+
+func TestCanary_RotatesPartitions(t *testing.T) {
+	sent := &collector{}
+	count := 3
+	c := canary.New(canary.Config{NodeID: "node-a", Partitions: func() int { return count }}, sent.emit)
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		c.Send(now)
+	}
+	// The topic grows; rotation continues across the new count
+	count = 5
+	c.Send(now)
+
+	want := []int{0, 1, 2, 0, 4}
+	for i, p := range sent.partitions {
+		if p == nil || *p != want[i] {
+			t.Fatalf("canary %d: got partition %v, want %d", i, p, want[i])
+		}
+		if got := sent.events[i].Metadata[canary.MetaPartition]; got != want[i] {
+			t.Errorf("canary %d: metadata partition %v, want %d", i, got, want[i])
+		}
+	}
+}
+
+func TestCanary_KafkaConfirmAndLoss(t *testing.T) {
+	sent := &collector{}
+	c := canary.New(canary.Config{NodeID: "node-a", Timeout: time.Minute, Confirm: canary.StageKafka}, sent.emit)
+
+	start := time.Now()
+	c.Send(start)
+	c.Send(start)
+	first, second := sent.events[0], sent.events[1]
+
+	// Publishing alone doesn't confirm a canary watched in Kafka
+	c.Published(envelopes(first, second), nil)
+	if stats := c.Stats(); stats.Delivered != 0 || stats.Pending != 2 {
+		t.Fatalf("expected both canaries pending, got %+v", stats)
+	}
+
+	c.Observe(canary.StageKafka, first.ID, start.Add(250*time.Millisecond))
+	c.Observe(canary.StageKafka, "someone-elses-event", start.Add(time.Second))
+
+	// Before the timeout nothing is lost; after it the second canary is
+	c.Expire(start.Add(30 * time.Second))
+	c.Expire(start.Add(2 * time.Minute))
+
+	stats := c.Stats()
+	if stats.Delivered != 1 || stats.Lost != 1 || stats.Pending != 0 {
+		t.Errorf("expected one delivered and one lost, got %+v", stats)
+	}
+	if stats.LastLatencyMS != 250 {
+		t.Errorf("expected a 250ms latency, got %v", stats.LastLatencyMS)
+	}
+
+	// A canary seen after being counted lost stays lost
+	c.Observe(canary.StageKafka, second.ID, start.Add(3*time.Minute))
+	if stats := c.Stats(); stats.Delivered != 1 {
+		t.Errorf("expected the late canary ignored, got %+v", stats)
+	}
+}
+
+func TestStoredHandler(t *testing.T) {
+	failure := errors.New("insert failed")
+	var handled int
+	h := canary.StoredHandler(func(ctx context.Context, envelope *models.Envelope) error {
+		handled++
+		if envelope.Event.TenantID == "broken" {
+			return failure
+		}
+		return nil
+	})
+
+	event := &models.LogEvent{ID: "c1", TenantID: "system", Source: canary.Source, Timestamp: time.Now()}
+	if err := h(context.Background(), models.NewEnvelope(event, "node-a")); err != nil {
+		t.Fatal(err)
+	}
+	broken := &models.LogEvent{ID: "c2", TenantID: "broken", Source: canary.Source, Timestamp: time.Now()}
+	if err := h(context.Background(), models.NewEnvelope(broken, "node-a")); !errors.Is(err, failure) {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+	if handled != 2 {
+		t.Errorf("expected both envelopes handled, got %d", handled)
+	}
+}
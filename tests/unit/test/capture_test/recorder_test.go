@@ -0,0 +1,128 @@
+package capture_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/capture"
+	"parsec/internal/flags"
+)
+
+// serve sends a request through the recorder to a handler that reads the
+// body when read is set
+func serve(rec *capture.Recorder, body string, read bool, headers map[string]string) {
+	h := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if read {
+			io.ReadAll(r.Body)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid timestamp"}`)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/ingest?api_key=k&atomic=true", strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func enable(t *testing.T, rule flags.Rule) *flags.Manager {
+	t.Helper()
+	m := flags.NewManager(nil)
+	if err := m.Set(context.Background(), flags.RequestCapture, rule); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRecorder_CapturesEnabledTenantsRedacted(t *testing.T) {
+	rec := capture.NewRecorder(enable(t, flags.Rule{Tenants: map[string]bool{"acme": true}}), capture.Config{})
+
+	serve(rec, `{"tenant_id":"acme","message":"login by bob@example.com","metadata":{"password":"hunter2"}}`, true,
+		map[string]string{"X-API-Key": "secret-key", "User-Agent": "agent/1.2"})
+	serve(rec, `{"tenant_id":"globex","message":"hello"}`, true, nil)
+
+	captures := rec.List("", 0)
+	if len(captures) != 1 {
+		t.Fatalf("expected only acme's request, got %+v", captures)
+	}
+	c := captures[0]
+	if c.TenantID != "acme" || c.Status != http.StatusBadRequest || c.ResponseBody != `{"error":"invalid timestamp"}` {
+		t.Errorf("unexpected capture %+v", c)
+	}
+	if strings.Contains(c.RequestBody, "hunter2") || strings.Contains(c.RequestBody, "bob@example.com") {
+		t.Errorf("expected the body redacted, got %s", c.RequestBody)
+	}
+	if !strings.Contains(c.RequestBody, `"message":"login by [REDACTED]"`) {
+		t.Errorf("expected the rest of the body kept, got %s", c.RequestBody)
+	}
+	if c.Headers["X-Api-Key"] != capture.Redacted || c.Headers["User-Agent"] != "agent/1.2" {
+		t.Errorf("unexpected headers %+v", c.Headers)
+	}
+	if strings.Contains(c.Query, "api_key=k") || !strings.Contains(c.Query, "atomic=true") {
+		t.Errorf("expected the api_key parameter redacted, got %s", c.Query)
+	}
+}
+
+func TestRecorder_OffByDefault(t *testing.T) {
+	rec := capture.NewRecorder(flags.NewManager(nil), capture.Config{})
+	serve(rec, `{"tenant_id":"acme"}`, true, nil)
+	if n := len(rec.List("", 0)); n != 0 {
+		t.Errorf("expected no captures without the flag, got %d", n)
+	}
+}
+
+func TestRecorder_QuotaCapAndRing(t *testing.T) {
+	rec := capture.NewRecorder(enable(t, flags.Rule{Enabled: true}), capture.Config{
+		PerMinute:    2,
+		MaxBodyBytes: 24,
+		Size:         3,
+	})
+
+	for i := 0; i < 3; i++ {
+		serve(rec, `{"tenant_id":"acme","message":"a long message over the cap"}`, true, nil)
+	}
+	// Unread bodies are still captured
+	serve(rec, `{"tenant_id":"globex"}`, false, nil)
+	serve(rec, `{"tenant_id":"initech"}`, true, nil)
+
+	acme := rec.List("acme", 0)
+	if len(acme) != 1 {
+		t.Fatalf("expected acme's quota of 2, one pushed out of the ring, got %+v", acme)
+	}
+	if len(acme[0].RequestBody) != 24 || !acme[0].RequestTruncated {
+		t.Errorf("expected the body cut at 24 bytes, got %q", acme[0].RequestBody)
+	}
+
+	all := rec.List("", 0)
+	if len(all) != 3 || all[0].TenantID != "initech" || all[1].TenantID != "globex" {
+		t.Errorf("expected the newest 3 captures, newest first, got %+v", all)
+	}
+	if all[1].RequestBody != `{"tenant_id":"globex"}` {
+		t.Errorf("expected the unread body captured, got %q", all[1].RequestBody)
+	}
+	if limited := rec.List("", 1); len(limited) != 1 {
+		t.Errorf("expected 1 capture, got %d", len(limited))
+	}
+
+	rec.Clear()
+	if n := len(rec.List("", 0)); n != 0 {
+		t.Errorf("expected no captures after Clear, got %d", n)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`card 4111 1111 1111 1111 used`, `card [REDACTED] used`},
+		{`"timestamp_ms":1700000000001`, `"timestamp_ms":1700000000001`},
+		{`Authorization: Bearer abc.def-ghi`, `Authorization: [REDACTED]`},
+		{`{"auth_token": "x\"y", "level":"info"}`, `{"auth_token": "[REDACTED]", "level":"info"}`},
+	} {
+		if got := capture.RedactBody(tc.in); got != tc.want {
+			t.Errorf("RedactBody(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
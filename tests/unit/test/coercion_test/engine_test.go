@@ -0,0 +1,190 @@
+package coercion_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"parsec/internal/coercion"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func event(tenant string, metadata models.Metadata) *models.LogEvent {
+	return &models.LogEvent{ID: "evt-1", TenantID: tenant, Source: "api", Message: "ok", Metadata: metadata}
+}
+
+func TestEngine_CoercesFields(t *testing.T) {
+	engine := coercion.NewEngine(nil)
+	ctx := context.Background()
+	err := engine.SetRules(ctx, "acme", []coercion.Rule{
+		{Field: "Latency_MS", Type: "float"},
+		{Field: "status", Type: coercion.TypeInt},
+		{Field: "success", Type: coercion.TypeBool},
+		{Field: "retries", Type: coercion.TypeInt},
+	})
+	if err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+
+	e := event("acme", models.Metadata{
+		"latency_ms": " 12.50",
+		"status":     "200.0",
+		"success":    "YES",
+		"retries":    "many",
+		"path":       "/orders",
+	})
+	result, err := engine.Process(ctx, e)
+	if err != nil || !result.Changed {
+		t.Fatalf("unexpected result: %+v, %v", result, err)
+	}
+
+	want := map[string]any{"latency_ms": 12.5, "status": int64(200), "success": true}
+	if len(e.TypedMetadata) != len(want) {
+		t.Fatalf("unexpected typed metadata: %v", e.TypedMetadata)
+	}
+	for key, value := range want {
+		if e.TypedMetadata[key] != value {
+			t.Errorf("typed %s = %#v, want %#v", key, e.TypedMetadata[key], value)
+		}
+	}
+
+	// String values are rewritten in canonical form; failures are kept as is
+	for key, value := range map[string]string{"latency_ms": "12.5", "status": "200", "success": "true", "retries": "many"} {
+		if e.Metadata[key] != value {
+			t.Errorf("metadata %s = %q, want %q", key, e.Metadata[key], value)
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		TypedMetadata map[string]any `json:"typed_metadata"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.TypedMetadata["success"] != true {
+		t.Errorf("expected typed metadata in the event JSON, got %s", data)
+	}
+
+	// Other tenants are unaffected
+	other := event("other", models.Metadata{"status": "200"})
+	if result, _ := engine.Process(ctx, other); result.Changed || other.TypedMetadata != nil {
+		t.Error("rules leaked across tenants")
+	}
+}
+
+func TestRule_Coerce(t *testing.T) {
+	tests := []struct {
+		rule  coercion.Rule
+		value string
+		want  any
+		ok    bool
+	}{
+		{coercion.Rule{Type: coercion.TypeInt}, "-7", int64(-7), true},
+		{coercion.Rule{Type: coercion.TypeInt}, "1e3", int64(1000), true},
+		{coercion.Rule{Type: coercion.TypeInt}, "1.5", nil, false},
+		{coercion.Rule{Type: coercion.TypeInt}, "1e30", nil, false},
+		{coercion.Rule{Type: coercion.TypeFloat}, "3", 3.0, true},
+		{coercion.Rule{Type: coercion.TypeFloat}, "NaN", nil, false},
+		{coercion.Rule{Type: coercion.TypeFloat}, "+Inf", nil, false},
+		{coercion.Rule{Type: coercion.TypeBool}, "off", false, true},
+		{coercion.Rule{Type: coercion.TypeBool}, "maybe", nil, false},
+	}
+	for _, tt := range tests {
+		got, _, err := tt.rule.Coerce(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%s %q: got %#v, %v", tt.rule.Type, tt.value, got, err)
+		}
+	}
+}
+
+func TestEngine_RejectsInvalidRules(t *testing.T) {
+	engine := coercion.NewEngine(nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		rules []coercion.Rule
+		want  error
+	}{
+		{[]coercion.Rule{{Type: coercion.TypeInt}}, coercion.ErrMissingField},
+		{[]coercion.Rule{{Field: "a", Type: "timestamp"}}, coercion.ErrUnknownType},
+		{[]coercion.Rule{{Field: "a", Type: "int"}, {Field: "A", Type: "bool"}}, coercion.ErrDuplicateRule},
+		{make([]coercion.Rule, coercion.MaxRulesPerTenant+1), coercion.ErrTooManyRules},
+	}
+	for _, tt := range tests {
+		if err := engine.SetRules(ctx, "acme", tt.rules); !errors.Is(err, tt.want) {
+			t.Errorf("expected %v, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestEngine_SharedAcrossNodes(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	ctx := context.Background()
+	nodeA := coercion.NewEngine(store)
+	nodeB := coercion.NewEngine(store)
+
+	if err := nodeA.SetRules(ctx, "acme", []coercion.Rule{{Field: "bytes", Type: coercion.TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e := event("acme", models.Metadata{"bytes": "512"})
+	nodeB.Process(ctx, e)
+	if e.TypedMetadata["bytes"] != int64(512) {
+		t.Errorf("expected node B to apply the rules, got %v", e.TypedMetadata)
+	}
+
+	if err := nodeA.SetRules(ctx, "acme", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rules := nodeB.Rules("acme"); len(rules) != 0 {
+		t.Errorf("expected the rules to be cleared, got %v", rules)
+	}
+}
+
+func TestEngine_NodesKeepEachOthersRules(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	rules := func() []coercion.Rule { return []coercion.Rule{{Field: "status", Type: coercion.TypeInt}} }
+
+	// Neither node has loaded the other's rules before setting its own
+	a := coercion.NewEngine(store)
+	b := coercion.NewEngine(store)
+	if err := a.SetRules(ctx, "acme", rules()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetRules(ctx, "globex", rules()); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := coercion.NewEngine(store)
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"acme", "globex"} {
+		if len(reader.Rules(tenantID)) != 1 {
+			t.Errorf("%s: rules lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the rules set here in place
+	noop := coercion.NewEngine(state.NewNoopStore(""))
+	if err := noop.SetRules(ctx, "acme", rules()); err != nil {
+		t.Fatal(err)
+	}
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(noop.Rules("acme")) != 1 {
+		t.Error("reloading an empty store dropped the rules")
+	}
+}
@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"testing"
+
+	"parsec/internal/config"
+)
+
+func TestUnknownEnv(t *testing.T) {
+	environ := []string{
+		"KAFKA_BATCHSIZE=500",
+		"KAFKA_BROKERS=kafka:9092",
+		"PARSEC_PROFIL=dev",
+		"PARSEC_PROFILE=dev",
+		"kafka_topic=x",
+		"KAFKA_SOMETHING_ELSE_ENTIRELY=1",
+		"HOME=/root",
+		"PATH=/usr/bin",
+	}
+
+	unknown := config.UnknownEnv(environ)
+	want := []config.UnknownVar{
+		{Name: "KAFKA_BATCHSIZE", Suggestion: "KAFKA_BATCH_SIZE"},
+		{Name: "KAFKA_SOMETHING_ELSE_ENTIRELY"},
+		{Name: "PARSEC_PROFIL", Suggestion: "PARSEC_PROFILE"},
+	}
+	if len(unknown) != len(want) {
+		t.Fatalf("expected %v, got %v", want, unknown)
+	}
+	for i := range want {
+		if unknown[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], unknown[i])
+		}
+	}
+}
+
+func TestKnownEnv(t *testing.T) {
+	known := make(map[string]bool)
+	for _, name := range config.KnownEnv() {
+		known[name] = true
+	}
+	for _, name := range []string{"KAFKA_BROKERS", "KAFKA_BATCH_SIZE", "PARSEC_PROFILE", "PARSEC_STRICT_CONFIG", "REDIS_ADDR"} {
+		if !known[name] {
+			t.Errorf("expected %s to be known", name)
+		}
+	}
+}
+
+func TestUnknownVar_String(t *testing.T) {
+	v := config.UnknownVar{Name: "KAFKA_BATCHSIZE", Suggestion: "KAFKA_BATCH_SIZE"}
+	if got := v.String(); got != "KAFKA_BATCHSIZE (did you mean KAFKA_BATCH_SIZE?)" {
+		t.Errorf("unexpected %q", got)
+	}
+	if got := (config.UnknownVar{Name: "KAFKA_X"}).String(); got != "KAFKA_X" {
+		t.Errorf("unexpected %q", got)
+	}
+}
+
+func TestFromEnv_StrictConfig(t *testing.T) {
+	if got := config.FromEnv().StrictConfig; got != config.StrictWarn {
+		t.Errorf("expected warn by default, got %q", got)
+	}
+
+	t.Setenv("PARSEC_STRICT_CONFIG", "reject")
+	if got := config.FromEnv().StrictConfig; got != config.StrictReject {
+		t.Errorf("expected reject, got %q", got)
+	}
+}
+
+func TestCheckStrict(t *testing.T) {
+	for _, mode := range []string{config.StrictOff, config.StrictWarn, config.StrictReject} {
+		if err := config.CheckStrict(mode); err != nil {
+			t.Errorf("%s: unexpected error %v", mode, err)
+		}
+	}
+	if err := config.CheckStrict("strict"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/config"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "parsec.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+# Kafka
+KAFKA_BROKERS=file:9092
+export KAFKA_TOPIC="file-topic"
+KAFKA_BATCH_SIZE=300
+REDIS_ADDR='file-redis:6379'
+`)
+	t.Setenv("KAFKA_TOPIC", "env-topic")
+	t.Setenv("KAFKA_BATCH_SIZE", "400")
+
+	cfg, err := config.Load("processor", []string{"--config", path, "--kafka-batch-size=500", "--log-level", "debug"}, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Flags beat the environment, which beats the file
+	if cfg.Kafka.Producer.BatchSize != 500 {
+		t.Errorf("expected the flag's batch size, got %d", cfg.Kafka.Producer.BatchSize)
+	}
+	if cfg.Kafka.Topic != "env-topic" {
+		t.Errorf("expected the environment's topic, got %s", cfg.Kafka.Topic)
+	}
+	if len(cfg.Kafka.Brokers) != 1 || cfg.Kafka.Brokers[0] != "file:9092" {
+		t.Errorf("expected the file's brokers, got %v", cfg.Kafka.Brokers)
+	}
+	if cfg.RedisAddr != "file-redis:6379" {
+		t.Errorf("expected the unquoted file value, got %s", cfg.RedisAddr)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("expected debug logging, got %s", cfg.LogLevel)
+	}
+
+	// Everything else keeps its default
+	if cfg.Kafka.Producer.BatchTimeout != config.Default().Kafka.Producer.BatchTimeout {
+		t.Errorf("unexpected batch timeout %s", cfg.Kafka.Producer.BatchTimeout)
+	}
+}
+
+func TestLoad_ProfileFlag(t *testing.T) {
+	cfg, err := config.Load("processor", []string{"--profile=dev", "--kafka-batch-timeout-ms=250"}, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Profile != config.ProfileDev || cfg.Kafka.Producer.BatchSize != 10 {
+		t.Errorf("expected the dev profile, got %q with batch size %d", cfg.Profile, cfg.Kafka.Producer.BatchSize)
+	}
+	if cfg.Kafka.Producer.BatchTimeout != 250*time.Millisecond {
+		t.Errorf("expected the flag to override the profile, got %s", cfg.Kafka.Producer.BatchTimeout)
+	}
+}
+
+func TestLoad_EmptyFlagRestoresDefault(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC", "env-topic")
+
+	cfg, err := config.Load("processor", []string{"--kafka-topic="}, io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Kafka.Topic != config.Default().Kafka.Topic {
+		t.Errorf("expected the default topic, got %s", cfg.Kafka.Topic)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	if _, err := config.Load("processor", []string{"--kafka-batchsize=10"}, io.Discard); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+	if _, err := config.Load("processor", []string{"extra"}, io.Discard); err == nil {
+		t.Error("expected an error for a positional argument")
+	}
+	if _, err := config.Load("processor", []string{"-h"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+	if _, err := config.Load("processor", []string{"--config", filepath.Join(t.TempDir(), "missing.env")}, io.Discard); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestReadFile_UnknownSetting(t *testing.T) {
+	path := writeConfigFile(t, "KAFKA_BATCHSIZE=10\n")
+	_, err := config.ReadFile(path)
+	if err == nil || !strings.Contains(err.Error(), "did you mean KAFKA_BATCH_SIZE?") {
+		t.Errorf("expected a suggestion, got %v", err)
+	}
+
+	path = writeConfigFile(t, "KAFKA_BROKERS\n")
+	if _, err := config.ReadFile(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("expected a line error, got %v", err)
+	}
+}
+
+func TestFlagName(t *testing.T) {
+	cases := map[string]string{
+		"KAFKA_BROKERS":        "kafka-brokers",
+		"PARSEC_PROFILE":       "profile",
+		"PARSEC_STRICT_CONFIG": "strict-config",
+		"LOG_LEVEL":            "log-level",
+	}
+	for env, want := range cases {
+		if got := config.FlagName(env); got != want {
+			t.Errorf("%s: expected %s, got %s", env, want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"parsec/internal/config"
+)
+
+func TestFromEnv_Profile(t *testing.T) {
+	t.Setenv("PARSEC_PROFILE", config.ProfileProdHighThroughput)
+	t.Setenv("KAFKA_POOL_SIZE", "12")
+
+	cfg := config.FromEnv()
+	if cfg.Profile != config.ProfileProdHighThroughput {
+		t.Errorf("expected the profile to be recorded, got %q", cfg.Profile)
+	}
+	if cfg.Kafka.Producer.BatchSize != 1000 || cfg.Kafka.Producer.Compression != "zstd" {
+		t.Errorf("expected the profile's batching, got %d %s", cfg.Kafka.Producer.BatchSize, cfg.Kafka.Producer.Compression)
+	}
+	if cfg.Startup.WaitFor != "kafka" {
+		t.Errorf("expected the profile to wait for kafka, got %q", cfg.Startup.WaitFor)
+	}
+
+	// Environment variables override the profile
+	if cfg.Kafka.Producer.PoolSize != 12 {
+		t.Errorf("expected KAFKA_POOL_SIZE to override the profile, got %d", cfg.Kafka.Producer.PoolSize)
+	}
+
+	// Settings the profile leaves alone keep their defaults
+	if cfg.Kafka.Topic != config.Default().Kafka.Topic {
+		t.Errorf("unexpected topic %s", cfg.Kafka.Topic)
+	}
+}
+
+func TestFromEnv_UnknownProfile(t *testing.T) {
+	t.Setenv("PARSEC_PROFILE", "turbo")
+
+	cfg := config.FromEnv()
+	if cfg.Profile != "turbo" {
+		t.Errorf("expected the unknown profile to be kept for reporting, got %q", cfg.Profile)
+	}
+	if err := config.CheckProfile(cfg.Profile); err == nil {
+		t.Error("expected the unknown profile to be rejected")
+	}
+	if cfg.Kafka.Producer.BatchSize != config.Default().Kafka.Producer.BatchSize {
+		t.Error("expected defaults for an unknown profile")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	names := config.ProfileNames()
+	if len(names) != 3 {
+		t.Fatalf("expected 3 profiles, got %v", names)
+	}
+	for _, name := range names {
+		cfg := config.Default()
+		if err := cfg.ApplyProfile(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if cfg.Profile != name || cfg.Kafka.Producer.BatchSize <= 0 || cfg.Kafka.Producer.PoolSize <= 0 {
+			t.Errorf("%s: unexpected producer settings %+v", name, cfg.Kafka.Producer)
+		}
+	}
+
+	cfg := config.Default()
+	if err := cfg.ApplyProfile(config.ProfileDev); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Kafka.Producer.BatchTimeout != 10*time.Millisecond || cfg.Kafka.Producer.Compression != "none" {
+		t.Errorf("unexpected dev producer settings %+v", cfg.Kafka.Producer)
+	}
+	if err := config.CheckProfile(""); err != nil {
+		t.Errorf("expected no profile to be valid: %v", err)
+	}
+}
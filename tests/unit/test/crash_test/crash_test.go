@@ -0,0 +1,119 @@
+package crash_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"parsec/internal/crash"
+	"parsec/internal/logger"
+)
+
+func readReport(t *testing.T, path string) crash.Report {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report crash.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	return report
+}
+
+func TestWrite(t *testing.T) {
+	logger.Init("info")
+	for i := 0; i < 5; i++ {
+		logger.Logger.Info().Int("n", i).Msg("before the crash")
+	}
+
+	dir := filepath.Join(t.TempDir(), "crash")
+	crash.Init(crash.Config{Dir: dir, LogLines: 3, ConfigHash: "abc123"})
+	crash.AddStats("queue", func() any { return map[string]int{"queue_size": 42} })
+	crash.AddStats("broken", func() any { panic("no stats") })
+
+	path, err := crash.Write("workers", "boom", []byte("goroutine 1 [running]:"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("expected the report in %s, got %s", dir, path)
+	}
+
+	report := readReport(t, path)
+	if report.Goroutine != "workers" || report.Panic != "boom" || report.ConfigHash != "abc123" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if !strings.Contains(report.Stack, "goroutine 1") {
+		t.Errorf("expected the stack, got %q", report.Stack)
+	}
+	if report.PID != os.Getpid() || report.Memory.Goroutines == 0 {
+		t.Errorf("expected process details, got pid %d and %+v", report.PID, report.Memory)
+	}
+
+	queue, ok := report.Stats["queue"].(map[string]any)
+	if !ok || queue["queue_size"] != float64(42) {
+		t.Errorf("expected queue stats, got %v", report.Stats)
+	}
+	if broken, _ := report.Stats["broken"].(string); !strings.HasPrefix(broken, "unavailable") {
+		t.Errorf("expected the failing source to be marked unavailable, got %v", report.Stats["broken"])
+	}
+
+	// The last lines, oldest first
+	if len(report.Logs) != 3 || !strings.Contains(report.Logs[2], `"n":4`) || !strings.Contains(report.Logs[0], `"n":2`) {
+		t.Errorf("expected the last 3 log lines, got %v", report.Logs)
+	}
+}
+
+func TestWrite_Disabled(t *testing.T) {
+	crash.Init(crash.Config{})
+	path, err := crash.Write("main", "boom", nil)
+	if err != nil || path != "" {
+		t.Errorf("expected no report, got %q, %v", path, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	logger.Init("info")
+	dir := t.TempDir()
+	crash.Init(crash.Config{Dir: dir, LogLines: 10})
+
+	// Recover writes the report, then panics again with the same value
+	var repanicked any
+	func() {
+		defer func() { repanicked = recover() }()
+		defer crash.Recover("http_server")
+		panic("handler exploded")
+	}()
+	if repanicked != "handler exploded" {
+		t.Errorf("expected the panic to continue, got %v", repanicked)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one report, got %v, %v", entries, err)
+	}
+	report := readReport(t, filepath.Join(dir, entries[0].Name()))
+	if report.Goroutine != "http_server" || report.Panic != "handler exploded" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if !strings.Contains(report.Stack, "TestRecover") {
+		t.Errorf("expected the panicking stack, got %s", report.Stack)
+	}
+}
+
+func TestRecover_NoPanic(t *testing.T) {
+	dir := t.TempDir()
+	crash.Init(crash.Config{Dir: dir})
+	func() {
+		defer crash.Recover("main")
+	}()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no report, got %v", entries)
+	}
+}
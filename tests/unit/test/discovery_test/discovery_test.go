@@ -0,0 +1,115 @@
+package discovery_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"parsec/internal/discovery"
+	"parsec/internal/state"
+)
+
+func TestParseRegions(t *testing.T) {
+	regions, err := discovery.ParseRegions(" eu-west=https://eu.ingest.example.com/ , us-east=https://us.ingest.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions["eu-west"] != "https://eu.ingest.example.com" || regions["us-east"] != "https://us.ingest.example.com" {
+		t.Errorf("unexpected regions %v", regions)
+	}
+
+	if _, err := discovery.ParseRegions("eu-west"); err == nil {
+		t.Error("expected error for entry without url")
+	}
+	if regions, err := discovery.ParseRegions(""); err != nil || len(regions) != 0 {
+		t.Errorf("empty spec: %v, %v", regions, err)
+	}
+}
+
+func TestRegistry_Discover(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	regions := map[string]string{
+		"eu-west":  "https://eu.ingest.example.com",
+		"us-east":  "https://us.ingest.example.com",
+		"ap-south": "https://ap.ingest.example.com",
+	}
+	node := func(id, region string, load float64) *discovery.Registry {
+		return discovery.NewRegistry(store, discovery.Config{
+			Self:     discovery.Node{ID: id, Region: region, URL: "https://" + id + ".example.com/", Protocols: []string{"http/1.1"}},
+			Load:     func() float64 { return load },
+			Interval: time.Minute,
+			Regions:  regions,
+		})
+	}
+	busy := node("eu-1", "eu-west", 0.9)
+	idle := node("eu-2", "eu-west", 0.1)
+	far := node("us-1", "us-east", 0)
+	for _, r := range []*discovery.Registry{busy, idle, far} {
+		if err := r.Announce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := busy.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The node's own region is preferred, least loaded first
+	answer := busy.Discover("", 0)
+	if len(answer.Endpoints) != 3 {
+		t.Fatalf("expected 3 endpoints, got %+v", answer.Endpoints)
+	}
+	if got := []string{answer.Endpoints[0].ID, answer.Endpoints[1].ID, answer.Endpoints[2].ID}; got[0] != "eu-2" || got[1] != "eu-1" || got[2] != "us-1" {
+		t.Errorf("unexpected ranking %v", got)
+	}
+	if answer.Endpoints[0].URL != "https://eu-2.example.com" || answer.TTLSeconds != 180 {
+		t.Errorf("unexpected answer %+v", answer)
+	}
+	if answer.Regions[0].Region != "eu-west" || answer.Regions[1].Region != "ap-south" {
+		t.Errorf("unexpected region order %+v", answer.Regions)
+	}
+
+	// A client naming its region gets that region's nodes and entry point
+	answer = busy.Discover("us-east", 1)
+	if len(answer.Endpoints) != 1 || answer.Endpoints[0].ID != "us-1" {
+		t.Errorf("unexpected endpoints for us-east %+v", answer.Endpoints)
+	}
+	if answer.Regions[0].Region != "us-east" || answer.Regions[1].Region != "eu-west" {
+		t.Errorf("unexpected region order for us-east %+v", answer.Regions)
+	}
+
+	// Withdrawn nodes are no longer offered
+	if err := far.Withdraw(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := busy.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range busy.Discover("us-east", 0).Endpoints {
+		if n.ID == "us-1" {
+			t.Error("withdrawn node still offered")
+		}
+	}
+}
+
+func TestRegistry_NoURLIsNotAnnounced(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	registry := discovery.NewRegistry(store, discovery.Config{Self: discovery.Node{ID: "node-1"}})
+	if err := registry.Announce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if answer := registry.Discover("", 0); len(answer.Endpoints) != 0 {
+		t.Errorf("node without url announced: %+v", answer.Endpoints)
+	}
+	if local := registry.Local("http://10.0.0.1:8080"); local.ID != "node-1" || local.URL != "http://10.0.0.1:8080" {
+		t.Errorf("unexpected local node %+v", local)
+	}
+}
@@ -0,0 +1,269 @@
+package docker_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/config"
+	"parsec/internal/docker"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+const (
+	appID = "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+	ttyID = "f6e5d4c3b2a1f6e5d4c3b2a1f6e5d4c3b2a1f6e5d4c3b2a1f6e5d4c3b2a1f6e5"
+)
+
+// frame encodes a multiplexed log frame
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+// fakeDocker serves the container list, inspect and log endpoints on a
+// unix socket. Log streams end after their canned output, as if the
+// containers stopped.
+type fakeDocker struct {
+	mu     sync.Mutex
+	ids    []string
+	since  map[string][]string
+	server *httptest.Server
+	host   string
+}
+
+func newFakeDocker(t *testing.T, ids ...string) *fakeDocker {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeDocker{ids: ids, since: make(map[string][]string), host: "unix://" + socket}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var list []map[string]string
+		for _, id := range f.ids {
+			list = append(list, map[string]string{"Id": id, "State": "running"})
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		details := map[string]any{"Id": r.PathValue("id")}
+		switch r.PathValue("id") {
+		case appID:
+			details["Name"] = "/billing-api"
+			details["Config"] = map[string]any{
+				"Image":  "billing:1.4",
+				"Labels": map[string]string{"parsec.tenant": "billing", "team": "payments", "version": "1.4"},
+			}
+		case ttyID:
+			details["Name"] = "/console"
+			details["Config"] = map[string]any{"Image": "busybox", "Tty": true}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(details)
+	})
+	mux.HandleFunc("GET /containers/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.since[r.PathValue("id")] = append(f.since[r.PathValue("id")], r.URL.Query().Get("since"))
+		f.mu.Unlock()
+
+		switch r.PathValue("id") {
+		case appID:
+			w.Write(frame(1, "2024-05-01T10:00:00.000000001Z started\n"))
+			w.Write(frame(2, "2024-05-01T10:00:01.000000002Z conn"))
+			w.Write(frame(2, "ection refused\n"))
+		case ttyID:
+			w.Write([]byte("2024-05-01T10:00:02.5Z $ ls\r\n"))
+		}
+	})
+
+	f.server = httptest.NewUnstartedServer(mux)
+	f.server.Listener = ln
+	f.server.Start()
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// waitLogs waits until a container's logs were requested n times
+func (f *fakeDocker) waitLogs(t *testing.T, id string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		got := len(f.since[id])
+		f.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d log requests", n)
+}
+
+// sink records submitted events
+type sink struct {
+	mu     sync.Mutex
+	events map[string]*models.LogEvent
+}
+
+func (s *sink) Submit(_ context.Context, event *models.LogEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.events == nil {
+		s.events = make(map[string]*models.LogEvent)
+	}
+	s.events[event.Message] = event
+	return nil
+}
+
+func (s *sink) wait(t *testing.T, n int) map[string]*models.LogEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		if len(s.events) >= n {
+			s.mu.Unlock()
+			return s.events
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d events", n)
+	return nil
+}
+
+func testConfig(host string) config.DockerConfig {
+	cfg := config.Default().Docker
+	cfg.Enabled = true
+	cfg.Host = host
+	cfg.ReadFromHead = true
+	cfg.DiscoveryInterval = time.Hour
+	return cfg
+}
+
+func TestCollector_FollowsContainers(t *testing.T) {
+	fake := newFakeDocker(t, appID, ttyID)
+
+	s := &sink{}
+	collector, err := docker.New(testConfig(fake.host), s, state.NewMemoryStore(state.MemoryConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.Start(context.Background())
+	defer collector.Close()
+
+	events := s.wait(t, 3)
+
+	started := events["started"]
+	if started == nil {
+		t.Fatalf("missing stdout line: %v", events)
+	}
+	if started.TenantID != "billing" || started.Source != "billing-api" || started.Severity != models.SeverityInfo {
+		t.Errorf("unexpected stdout event: %+v", started)
+	}
+	if !started.Timestamp.Equal(time.Date(2024, 5, 1, 10, 0, 0, 1, time.UTC)) {
+		t.Errorf("unexpected timestamp %s", started.Timestamp)
+	}
+	for key, want := range map[string]string{
+		docker.MetadataContainerID:           appID[:12],
+		docker.MetadataImage:                 "billing:1.4",
+		docker.MetadataStream:                docker.Stdout,
+		docker.LabelPrefix + "team":          "payments",
+		docker.LabelPrefix + "version":       "1.4",
+		docker.LabelPrefix + "parsec.tenant": "billing",
+	} {
+		if started.Metadata[key] != want {
+			t.Errorf("metadata %s = %q, want %q", key, started.Metadata[key], want)
+		}
+	}
+
+	// A stderr line split across frames is joined
+	refused := events["connection refused"]
+	if refused == nil || refused.Severity != models.SeverityError || refused.Metadata[docker.MetadataStream] != docker.Stderr {
+		t.Errorf("unexpected stderr event: %+v", refused)
+	}
+
+	// TTY containers stream raw stdout
+	ls := events["$ ls"]
+	if ls == nil || ls.TenantID != "system" || ls.Source != "console" {
+		t.Errorf("unexpected tty event: %+v", ls)
+	}
+}
+
+func TestCollector_ResumesFromCheckpoint(t *testing.T) {
+	fake := newFakeDocker(t, appID)
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	first := &sink{}
+	collector, err := docker.New(testConfig(fake.host), first, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.Start(context.Background())
+	first.wait(t, 2)
+	collector.Close()
+
+	// The second run asks only for lines after the last one submitted
+	// and skips lines at that exact timestamp
+	s := &sink{}
+	collector, err = docker.New(testConfig(fake.host), s, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.Start(context.Background())
+	fake.waitLogs(t, appID, 2)
+	time.Sleep(50 * time.Millisecond)
+	collector.Close()
+
+	fake.mu.Lock()
+	since := fake.since[appID]
+	fake.mu.Unlock()
+	if len(since) != 2 || since[0] != "" || since[1] != "1714557601.000000002" {
+		t.Errorf("unexpected since parameters: %q", since)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) != 0 {
+		t.Errorf("expected no lines to be re-submitted, got %d", len(s.events))
+	}
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	cfg := config.Default().Docker
+	cfg.StderrSeverity = "LOUD"
+	if _, err := docker.New(cfg, &sink{}, store); err == nil {
+		t.Error("expected error for invalid severity")
+	}
+
+	cfg = config.Default().Docker
+	cfg.Host = "ssh://host"
+	if _, err := docker.New(cfg, &sink{}, store); err == nil {
+		t.Error("expected error for unsupported host")
+	}
+}
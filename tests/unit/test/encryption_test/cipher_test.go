@@ -0,0 +1,85 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"parsec/internal/encryption"
+)
+
+const (
+	key1 = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=" // 32 bytes
+	key2 = "AAECAwQFBgcICQoLDA0ODw=="                     // 16 bytes
+)
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		tenants string
+		wantErr bool
+	}{
+		{"valid", "k1=" + key1 + ", k2=" + key2, "acme=k1,globex=k2", false},
+		{"empty", "", "", false},
+		{"missing separator", "k1", "", true},
+		{"bad base64", "k1=not base64!", "", true},
+		{"bad key size", "k1=AAEC", "", true},
+		{"tenant with unknown key", "k1=" + key1, "acme=k9", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := encryption.ParseKeyring(tt.keys, tt.tenants)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCipher_SealOpen(t *testing.T) {
+	keyring, err := encryption.ParseKeyring("k1="+key1+",k2="+key2, "acme=k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := encryption.NewCipher(keyring)
+	ctx := context.Background()
+	plaintext := []byte(`{"message":"card 4111"}`)
+
+	sealed, keyID, err := c.Seal(ctx, "acme", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != "k1" || bytes.Contains(sealed, []byte("4111")) {
+		t.Fatalf("expected ciphertext under k1, got key %q", keyID)
+	}
+
+	// Nonces are random, so sealing twice differs
+	again, _, _ := c.Seal(ctx, "acme", plaintext)
+	if bytes.Equal(sealed, again) {
+		t.Error("expected distinct ciphertexts")
+	}
+
+	opened, err := c.Open(ctx, keyID, "acme", sealed)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %q, %v", opened, err)
+	}
+
+	// The tenant is authenticated, so the payload does not open for another
+	if _, err := c.Open(ctx, keyID, "globex", sealed); err == nil {
+		t.Error("expected failure opening under another tenant")
+	}
+	if _, err := c.Open(ctx, "k9", "acme", sealed); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+	if _, err := c.Open(ctx, keyID, "acme", sealed[:4]); !errors.Is(err, encryption.ErrCiphertextTooShort) {
+		t.Errorf("expected ErrCiphertextTooShort, got %v", err)
+	}
+
+	// Tenants without a key pass through unencrypted
+	out, keyID, err := c.Seal(ctx, "globex", plaintext)
+	if err != nil || keyID != "" || !bytes.Equal(out, plaintext) {
+		t.Errorf("Seal() for unencrypted tenant = %q, %q, %v", out, keyID, err)
+	}
+}
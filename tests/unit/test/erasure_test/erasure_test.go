@@ -0,0 +1,269 @@
+package erasure_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"parsec/internal/erasure"
+	"parsec/internal/export"
+	"parsec/internal/objstore"
+	"parsec/internal/state"
+)
+
+func line(id, tenant, user string) string {
+	b, _ := json.Marshal(map[string]any{
+		"id":        id,
+		"tenant_id": tenant,
+		"message":   "m" + id,
+		"metadata":  map[string]string{"user_id": user},
+	})
+	return string(b) + "\n"
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+// ids returns the event IDs in an NDJSON file, gunzipping if needed
+func ids(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		var buf bytes.Buffer
+		buf.ReadFrom(gz)
+		data = buf.Bytes()
+	}
+
+	var out []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var e struct{ ID string }
+		json.Unmarshal(scanner.Bytes(), &e)
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func wait(t *testing.T, m *erasure.Manager, tenantID, id string) *erasure.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), tenantID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == erasure.StatusSucceeded || job.Status == erasure.StatusFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("erasure did not finish")
+	return nil
+}
+
+func TestArchive_SubjectErasure(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "acme/a.ndjson.gz"), gzipped(t, line("1", "acme", "42")+line("2", "acme", "7")))
+	writeFile(t, filepath.Join(dir, "acme/b.ndjson"), []byte(line("3", "acme", "42")))
+	writeFile(t, filepath.Join(dir, "acme/c.ndjson"), []byte(line("4", "acme", "7")))
+	writeFile(t, filepath.Join(dir, "other/d.ndjson"), []byte(line("5", "other", "42")))
+
+	var parquetFile bytes.Buffer
+	w := parquet.NewGenericWriter[export.Row](&parquetFile)
+	w.Write([]export.Row{
+		{ID: "6", TenantID: "acme", Metadata: map[string]string{"user_id": "42"}},
+		{ID: "7", TenantID: "acme", Metadata: map[string]string{"user_id": "7"}},
+	})
+	w.Close()
+	writeFile(t, filepath.Join(dir, "acme/e.parquet"), parquetFile.Bytes())
+
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	m := erasure.NewManager(store, []erasure.Target{erasure.NewArchive("exports", objstore.NewDir(dir), "")}, erasure.Config{})
+	defer m.Close()
+
+	job, err := m.Create(context.Background(), "acme", erasure.Request{
+		Subject:     &erasure.Subject{Key: "user_id", Value: "42"},
+		RequestedBy: "legal@example.com",
+		Reference:   "GDPR-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != erasure.StatusPending || len(job.Targets) != 1 {
+		t.Errorf("unexpected new job: %+v", job)
+	}
+
+	done := wait(t, m, "acme", job.ID)
+	if done.Status != erasure.StatusSucceeded || done.Deleted != 3 {
+		t.Fatalf("unexpected job: %+v", done)
+	}
+	if target := done.Targets[0]; target.Scanned != 4 || target.Deleted != 3 || target.Status != erasure.StatusSucceeded {
+		t.Errorf("unexpected target progress: %+v", target)
+	}
+	if done.RequestedBy != "legal@example.com" || done.Reference != "GDPR-1" || done.StartedAt == nil || done.CompletedAt == nil {
+		t.Errorf("audit fields missing: %+v", done)
+	}
+
+	if got := ids(t, filepath.Join(dir, "acme/a.ndjson.gz")); strings.Join(got, ",") != "2" {
+		t.Errorf("a.ndjson.gz kept %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "acme/b.ndjson")); !os.IsNotExist(err) {
+		t.Error("expected emptied object to be deleted")
+	}
+	if got := ids(t, filepath.Join(dir, "acme/c.ndjson")); strings.Join(got, ",") != "4" {
+		t.Errorf("c.ndjson kept %v", got)
+	}
+	if got := ids(t, filepath.Join(dir, "other/d.ndjson")); strings.Join(got, ",") != "5" {
+		t.Errorf("another tenant's archive changed: %v", got)
+	}
+
+	rows, err := parquet.ReadFile[export.Row](filepath.Join(dir, "acme/e.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ID != "7" {
+		t.Errorf("parquet kept %+v", rows)
+	}
+}
+
+// fakeConn records statements and returns a fixed count
+type fakeConn struct {
+	count int64
+	execs []string
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.execs = append(c.execs, query)
+	return nil
+}
+
+func (c *fakeConn) QueryInt(ctx context.Context, query string, args ...any) (int64, error) {
+	return c.count, nil
+}
+
+func TestTables_Erase(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject *erasure.Subject
+		execs   int
+	}{
+		{"subject", &erasure.Subject{Key: "user_id", Value: "42"}, 3},
+		{"tenant", nil, 5}, // base, short, long plus both rollups
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{count: 2}
+			var last erasure.Progress
+			err := erasure.NewTables(conn, "logs").Erase(context.Background(),
+				erasure.Scope{TenantID: "acme", Subject: tt.subject},
+				func(p erasure.Progress) { last = p })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conn.execs) != tt.execs || last.Deleted != 6 {
+				t.Errorf("got %d statements, %d deleted: %v", len(conn.execs), last.Deleted, conn.execs)
+			}
+			for _, q := range conn.execs {
+				if !strings.HasPrefix(q, "DELETE FROM logs") {
+					t.Errorf("unexpected statement %q", q)
+				}
+			}
+		})
+	}
+}
+
+// failingTarget always errors
+type failingTarget struct{}
+
+func (failingTarget) Name() string { return "broken" }
+func (failingTarget) Erase(ctx context.Context, scope erasure.Scope, progress func(erasure.Progress)) error {
+	return errors.New("unreachable")
+}
+
+func TestManager_ValidationAndFailures(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	if _, err := erasure.NewManager(store, nil, erasure.Config{}).Create(context.Background(), "acme",
+		erasure.Request{RequestedBy: "legal"}); !errors.Is(err, erasure.ErrNoTargets) {
+		t.Errorf("expected ErrNoTargets, got %v", err)
+	}
+
+	conn := &fakeConn{count: 1}
+	finished := make(chan string, 1)
+	m := erasure.NewManager(store, []erasure.Target{failingTarget{}, erasure.NewTables(conn, "logs")}, erasure.Config{
+		OnFinished: func(ctx context.Context, tenantID string) { finished <- tenantID },
+	})
+	defer m.Close()
+
+	tests := []struct {
+		req  erasure.Request
+		want error
+	}{
+		{erasure.Request{}, erasure.ErrMissingRequester},
+		{erasure.Request{RequestedBy: "legal", Subject: &erasure.Subject{Key: "user_id"}}, erasure.ErrInvalidSubject},
+	}
+	for _, tt := range tests {
+		if _, err := m.Create(context.Background(), "acme", tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("Create(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+	}
+
+	job, err := m.Create(context.Background(), "acme", erasure.Request{RequestedBy: "legal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := wait(t, m, "acme", job.ID)
+
+	// The failing target does not stop the others
+	if done.Status != erasure.StatusFailed || !strings.Contains(done.Error, "broken") {
+		t.Errorf("unexpected job: %+v", done)
+	}
+	if done.Targets[0].Status != erasure.StatusFailed || done.Targets[1].Status != erasure.StatusSucceeded || done.Deleted != 3 {
+		t.Errorf("unexpected targets: %+v", done.Targets)
+	}
+
+	// Failed jobs may still have erased data, so they are reported too
+	select {
+	case tenantID := <-finished:
+		if tenantID != "acme" {
+			t.Errorf("OnFinished called for %q", tenantID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("OnFinished was not called")
+	}
+
+	if _, err := m.Get(context.Background(), "other", job.ID); !errors.Is(err, erasure.ErrJobNotFound) {
+		t.Errorf("Get() for another tenant = %v", err)
+	}
+}
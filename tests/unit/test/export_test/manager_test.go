@@ -0,0 +1,191 @@
+package export_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/export"
+	"parsec/internal/importer"
+	"parsec/internal/objstore"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+var base = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeSource serves fixed events, filtering like a real source
+type fakeSource struct {
+	events []*models.LogEvent
+	err    error
+}
+
+func (s *fakeSource) Scan(ctx context.Context, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, e := range s.events {
+		if e.TenantID == tenantID && !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func events() *fakeSource {
+	return &fakeSource{events: []*models.LogEvent{
+		{ID: "1", TenantID: "acme", Timestamp: base, Severity: models.SeverityInfo, Source: "api", Message: "one"},
+		{ID: "2", TenantID: "acme", Timestamp: base.Add(time.Hour), Severity: models.SeverityError, Source: "api", Message: "two", Metadata: models.Metadata{"k": "v"}},
+		{ID: "3", TenantID: "other", Timestamp: base, Severity: models.SeverityInfo, Source: "api", Message: "not ours"},
+		{ID: "4", TenantID: "acme", Timestamp: base.Add(48 * time.Hour), Severity: models.SeverityInfo, Source: "api", Message: "out of range"},
+	}}
+}
+
+// wait polls until the job leaves pending/running
+func wait(t *testing.T, m *export.Manager, tenantID, id string) *export.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), tenantID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == export.StatusSucceeded || job.Status == export.StatusFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("export did not finish")
+	return nil
+}
+
+func TestManager_NDJSONExport(t *testing.T) {
+	dir := t.TempDir()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	m := export.NewManager(store, events(), objstore.NewDir(dir), export.Config{Prefix: "exports/"})
+	defer m.Close()
+
+	job, err := m.Create(context.Background(), "acme", export.Request{From: base, To: base.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != export.StatusPending || job.Format != export.FormatNDJSON {
+		t.Errorf("unexpected new job: %+v", job)
+	}
+
+	done := wait(t, m, "acme", job.ID)
+	if done.Status != export.StatusSucceeded || done.Events != 2 {
+		t.Fatalf("unexpected job: %+v", done)
+	}
+	if !strings.HasPrefix(done.URL, "file://") || done.URLExpiresAt == nil {
+		t.Errorf("expected signed URL, got %q", done.URL)
+	}
+
+	f, err := os.Open(filepath.Join(dir, done.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var e models.LogEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, ",") != "1,2" {
+		t.Errorf("exported %v", ids)
+	}
+
+	// Jobs are scoped to their tenant
+	if _, err := m.Get(context.Background(), "other", job.ID); !errors.Is(err, export.ErrJobNotFound) {
+		t.Errorf("Get() for another tenant = %v", err)
+	}
+}
+
+func TestManager_ParquetExportIsReimportable(t *testing.T) {
+	dir := t.TempDir()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	m := export.NewManager(store, events(), objstore.NewDir(dir), export.Config{})
+	defer m.Close()
+
+	job, err := m.Create(context.Background(), "acme", export.Request{
+		From: base, To: base.Add(24 * time.Hour), Format: export.FormatParquet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := wait(t, m, "acme", job.ID)
+	if done.Status != export.StatusSucceeded {
+		t.Fatalf("job failed: %s", done.Error)
+	}
+
+	f, err := os.Open(filepath.Join(dir, done.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := importer.NewParquetReader(f, done.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records.Next()
+	second, err := records.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != "2" || second.Metadata["k"] != "v" || second.Timestamp != base.Add(time.Hour).Format(time.RFC3339Nano) {
+		t.Errorf("unexpected record: %+v", second)
+	}
+}
+
+func TestManager_FailedAndInvalidJobs(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	m := export.NewManager(store, &fakeSource{err: errors.New("kafka unavailable")}, objstore.NewDir(t.TempDir()), export.Config{})
+	defer m.Close()
+
+	tests := []struct {
+		req  export.Request
+		want error
+	}{
+		{export.Request{From: base, To: base}, export.ErrInvalidRange},
+		{export.Request{To: base}, export.ErrInvalidRange},
+		{export.Request{From: base, To: base.Add(time.Hour), Format: "csv"}, export.ErrInvalidFormat},
+	}
+	for _, tt := range tests {
+		if _, err := m.Create(context.Background(), "acme", tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("Create(%+v) = %v, want %v", tt.req, err, tt.want)
+		}
+	}
+
+	job, err := m.Create(context.Background(), "acme", export.Request{From: base, To: base.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := wait(t, m, "acme", job.ID)
+	if done.Status != export.StatusFailed || !strings.Contains(done.Error, "kafka unavailable") || done.URL != "" {
+		t.Errorf("unexpected job: %+v", done)
+	}
+}
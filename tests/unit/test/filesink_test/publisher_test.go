@@ -0,0 +1,196 @@
+package filesink_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/config"
+	"parsec/internal/filesink"
+	"parsec/internal/importer"
+	"parsec/pkg/models"
+)
+
+func sinkConfig(dir string) config.FileSinkConfig {
+	return config.FileSinkConfig{
+		Dir:           dir,
+		MaxBytes:      1 << 20,
+		MaxAge:        time.Hour,
+		Compress:      true,
+		Fsync:         filesink.FsyncAlways,
+		FsyncInterval: time.Second,
+	}
+}
+
+func envelopes(n int) []*models.Envelope {
+	out := make([]*models.Envelope, n)
+	for i := range out {
+		out[i] = models.NewEnvelope(&models.LogEvent{
+			ID:        fmt.Sprintf("evt-%d", i),
+			TenantID:  "acme",
+			Timestamp: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			Severity:  models.SeverityInfo,
+			Source:    "laptop",
+			Message:   strings.Repeat("x", 200),
+		}, "node-1")
+	}
+	return out
+}
+
+// readAll replays every completed file through the importer's reader
+func readAll(t *testing.T, dir string) (files []string, ids []string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	sort.Strings(matches)
+	for _, path := range matches {
+		files = append(files, filepath.Base(path))
+		if strings.HasSuffix(path, ".part") {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := importer.NewNDJSONReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			event, err := records.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			ids = append(ids, event.ID)
+		}
+		f.Close()
+	}
+	return files, ids
+}
+
+func TestPublisher_WritesReplayableFiles(t *testing.T) {
+	dir := t.TempDir()
+	p, err := filesink.New(sinkConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PublishBatch(context.Background(), envelopes(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The open file keeps its .part suffix until it is completed
+	files, _ := readAll(t, dir)
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".ndjson.gz.part") {
+		t.Fatalf("expected one in-progress file, got %v", files)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, ids := readAll(t, dir)
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".ndjson.gz") {
+		t.Fatalf("expected one completed file, got %v", files)
+	}
+	if strings.Join(ids, ",") != "evt-0,evt-1,evt-2" {
+		t.Errorf("unexpected events %v", ids)
+	}
+	if stats := p.Stats(); stats.MessagesSent != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPublisher_RotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	cfg := sinkConfig(dir)
+	cfg.Compress = false
+	cfg.MaxBytes = 1024
+	p, err := filesink.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, envelope := range envelopes(10) {
+		if err := p.Publish(context.Background(), envelope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	files, ids := readAll(t, dir)
+	if len(files) < 3 {
+		t.Errorf("expected several rotated files, got %v", files)
+	}
+	for _, name := range files {
+		info, _ := os.Stat(filepath.Join(dir, name))
+		if info.Size() > 1024 {
+			t.Errorf("%s is %d bytes, over the limit", name, info.Size())
+		}
+	}
+	if len(ids) != 10 {
+		t.Errorf("expected 10 events across files, got %d", len(ids))
+	}
+}
+
+func TestPublisher_RotatesByAge(t *testing.T) {
+	dir := t.TempDir()
+	cfg := sinkConfig(dir)
+	cfg.MaxAge = 20 * time.Millisecond
+	p, err := filesink.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.PublishBatch(context.Background(), envelopes(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// An idle file is completed once it is old enough
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		files, ids := readAll(t, dir)
+		if len(files) == 1 && !strings.HasSuffix(files[0], ".part") && len(ids) == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file not rotated by age: %v", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublisher_RecoversPartFiles(t *testing.T) {
+	dir := t.TempDir()
+	left := filepath.Join(dir, "parsec-20240101T000000.000000000Z.ndjson.part")
+	if err := os.WriteFile(left, []byte(`{"event":{"id":"evt-old","tenant_id":"acme"}}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := filesink.New(sinkConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	files, ids := readAll(t, dir)
+	if len(files) != 1 || strings.HasSuffix(files[0], ".part") || len(ids) != 1 || ids[0] != "evt-old" {
+		t.Errorf("expected the leftover file to be finalized, got %v %v", files, ids)
+	}
+}
+
+func TestPublisher_RejectsUnknownFsyncPolicy(t *testing.T) {
+	cfg := sinkConfig(t.TempDir())
+	cfg.Fsync = "sometimes"
+	if _, err := filesink.New(cfg); err == nil {
+		t.Error("expected error for unknown fsync policy")
+	}
+}
@@ -0,0 +1,152 @@
+package flags_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"parsec/internal/flags"
+	"parsec/internal/state"
+)
+
+func TestManager_EnvSource(t *testing.T) {
+	m := flags.NewManager(nil, flags.EnvSource{Value: "async_producer, sampling=false"})
+	if err := m.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	if !m.Enabled(flags.AsyncProducer, "") {
+		t.Error("expected async_producer enabled globally")
+	}
+	if m.Enabled(flags.Sampling, "tenant-1") {
+		t.Error("expected sampling disabled")
+	}
+	if m.Enabled(flags.NewCodec, "") {
+		t.Error("unknown flags should default to disabled")
+	}
+}
+
+func TestManager_FileSourceTenantRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.json")
+	content := `{"new_codec": {"enabled": false, "tenants": {"tenant-a": true}}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := flags.NewManager(nil,
+		flags.EnvSource{Value: "new_codec=true"},
+		flags.FileSource{Path: path},
+	)
+	if err := m.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	if !m.Enabled(flags.NewCodec, "tenant-a") {
+		t.Error("expected tenant override to enable new_codec")
+	}
+	if m.Enabled(flags.NewCodec, "tenant-b") {
+		t.Error("expected file rule to override env default")
+	}
+}
+
+func TestManager_PercentRolloutIsStable(t *testing.T) {
+	m := flags.NewManager(nil)
+	if err := m.Set(context.Background(), flags.Sampling, flags.Rule{Percent: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled := 0
+	for i := 0; i < 200; i++ {
+		tenant := "tenant-" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		first := m.Enabled(flags.Sampling, tenant)
+		if first != m.Enabled(flags.Sampling, tenant) {
+			t.Fatalf("rollout not stable for %s", tenant)
+		}
+		if first {
+			enabled++
+		}
+	}
+
+	if enabled == 0 || enabled == 200 {
+		t.Errorf("expected partial rollout, got %d/200 enabled", enabled)
+	}
+}
+
+func TestManager_RuntimeOverridesPersist(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	m := flags.NewManager(store, flags.EnvSource{Value: "sampling=false"})
+	if err := m.Set(context.Background(), flags.Sampling, flags.Rule{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another node sharing the store picks up the override
+	other := flags.NewManager(store, flags.EnvSource{Value: "sampling=false"})
+	if err := other.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Enabled(flags.Sampling, "tenant-1") {
+		t.Error("expected stored override to take precedence")
+	}
+}
+
+func TestManager_ConcurrentNodesKeepEachOthersOverrides(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	// Nodes overriding different flags at once don't undo each other
+	all := []flags.Flag{flags.AsyncProducer, flags.NewCodec, flags.Sampling, flags.EnvelopeCompression, flags.RequestCapture}
+	var wg sync.WaitGroup
+	for _, flag := range all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := flags.NewManager(store).Set(ctx, flag, flags.Rule{Enabled: true}); err != nil {
+				t.Errorf("Set %s: %v", flag, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reader := flags.NewManager(store)
+	if err := reader.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range all {
+		if !reader.Enabled(flag, "") {
+			t.Errorf("override of %s lost", flag)
+		}
+	}
+}
+
+func TestManager_DeleteOverride(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	m := flags.NewManager(store, flags.EnvSource{Value: "sampling=false"})
+	if err := m.Set(ctx, flags.Sampling, flags.Rule{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted through another node, which hasn't loaded it yet
+	other := flags.NewManager(store, flags.EnvSource{Value: "sampling=false"})
+	if err := other.Delete(ctx, flags.Sampling); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := other.Delete(ctx, flags.Sampling); !errors.Is(err, flags.ErrNoOverride) {
+		t.Errorf("deleting twice: got %v", err)
+	}
+
+	if err := m.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.Enabled(flags.Sampling, "") {
+		t.Error("expected the configured rule once the override is deleted")
+	}
+}
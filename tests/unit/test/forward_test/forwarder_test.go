@@ -0,0 +1,181 @@
+package forward_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/forward"
+	"parsec/pkg/models"
+)
+
+func forwardConfig(url, dir string) config.ForwardConfig {
+	return config.ForwardConfig{
+		URL:           url,
+		APIKey:        "key",
+		BufferDir:     dir,
+		BatchSize:     4,
+		FlushInterval: 10 * time.Millisecond,
+		RetryBackoff:  5 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		Timeout:       time.Second,
+	}
+}
+
+func envelopes(from, n int) []*models.Envelope {
+	out := make([]*models.Envelope, n)
+	for i := range out {
+		out[i] = models.NewEnvelope(&models.LogEvent{
+			ID:        fmt.Sprintf("evt-%d", from+i),
+			TenantID:  "acme",
+			Timestamp: time.Now(),
+			Severity:  models.SeverityInfo,
+			Message:   "hello from the edge",
+		}, "edge-1")
+		out[i].Topic = "logs-edge"
+	}
+	return out
+}
+
+// central serves the real forward handler over a queue of the given size
+func central(t *testing.T, queue int) (*httptest.Server, chan *models.Envelope, *atomic.Bool) {
+	t.Helper()
+	ch := make(chan *models.Envelope, queue)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "central"})
+	h := handlers.NewForwardHandler(ingest)
+
+	down := &atomic.Bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("X-API-Key") != "key" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch, down
+}
+
+// receive collects n envelopes from the central queue
+func receive(t *testing.T, ch chan *models.Envelope, n int) []*models.Envelope {
+	t.Helper()
+	var got []*models.Envelope
+	timeout := time.After(3 * time.Second)
+	for len(got) < n {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("received %d of %d envelopes", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestForwarder_ForwardsEnvelopesInOrder(t *testing.T) {
+	srv, ch, _ := central(t, 100)
+	f, err := forward.New(forwardConfig(srv.URL, t.TempDir()), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, ch, 10)
+	for i, e := range got {
+		if e.Event.ID != fmt.Sprintf("evt-%d", i) {
+			t.Fatalf("envelope %d out of order: %s", i, e.Event.ID)
+		}
+	}
+	// Routing decided at the edge is kept
+	if got[0].Topic != "logs-edge" || got[0].IngestNode != "edge-1" {
+		t.Errorf("unexpected envelope %+v", got[0])
+	}
+}
+
+func TestForwarder_ResendsWhatCentralCouldNotQueue(t *testing.T) {
+	srv, ch, _ := central(t, 3)
+	f, err := forward.New(forwardConfig(srv.URL, t.TempDir()), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Draining the small queue lets the remainder through, without duplicates
+	got := receive(t, ch, 8)
+	seen := make(map[string]bool)
+	for _, e := range got {
+		if seen[e.Event.ID] {
+			t.Fatalf("duplicate envelope %s", e.Event.ID)
+		}
+		seen[e.Event.ID] = true
+	}
+}
+
+func TestForwarder_BuffersAcrossRestarts(t *testing.T) {
+	srv, ch, down := central(t, 100)
+	dir := t.TempDir()
+	down.Store(true)
+
+	f, err := forward.New(forwardConfig(srv.URL, dir), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PublishBatch(context.Background(), envelopes(0, 5)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	f.Close()
+
+	// The central node comes back after the edge restarted
+	down.Store(false)
+	f, err = forward.New(forwardConfig(srv.URL, dir), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.PublishBatch(context.Background(), envelopes(5, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, ch, 6)
+	if got[0].Event.ID != "evt-0" || got[5].Event.ID != "evt-5" {
+		t.Errorf("unexpected order %s..%s", got[0].Event.ID, got[5].Event.ID)
+	}
+}
+
+func TestForwarder_RefusesWhenBufferFull(t *testing.T) {
+	srv, _, down := central(t, 100)
+	down.Store(true)
+
+	cfg := forwardConfig(srv.URL, t.TempDir())
+	cfg.BufferMaxBytes = 512
+	f, err := forward.New(cfg, "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 10)); err != forward.ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+	if err := f.HealthCheck(context.Background()); err != nil {
+		t.Errorf("expected healthy with room left, got %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package forward_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/forward"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// pki holds PEM files for a CA, a server certificate and a client
+// certificate for edge-1
+type pki struct {
+	ca, serverCert, serverKey, clientCert, clientKey string
+}
+
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, dir, name string) (issuer, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	path := filepath.Join(dir, name+".pem")
+	writePEM(t, path, "CERTIFICATE", der)
+	return issuer{cert: cert, key: key}, path
+}
+
+// issue writes a leaf certificate and key signed by ca
+func (ca issuer) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newPKI(t *testing.T) pki {
+	t.Helper()
+	dir := t.TempDir()
+	ca, caPath := newCA(t, dir, "parsec-ca")
+	p := pki{ca: caPath}
+	p.serverCert, p.serverKey = ca.issue(t, dir, "central", x509.ExtKeyUsageServerAuth)
+	p.clientCert, p.clientKey = ca.issue(t, dir, "edge-1", x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+// grpcCentral runs a forward server over the real forward handler and a
+// queue of the given size
+func grpcCentral(t *testing.T, p pki, queue int, store state.StateStore) (*forward.Server, chan *models.Envelope) {
+	t.Helper()
+	ch := make(chan *models.Envelope, queue)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "central"})
+
+	srv, err := forward.NewServer(config.ForwardServerConfig{
+		Addr:         "127.0.0.1:0",
+		CertFile:     p.serverCert,
+		KeyFile:      p.serverKey,
+		ClientCAFile: p.ca,
+		Window:       4,
+	}, handlers.NewForwardHandler(ingest), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func grpcConfig(p pki, addr, dir string) config.ForwardConfig {
+	cfg := forwardConfig(addr, dir)
+	cfg.Protocol = forward.ProtocolGRPC
+	cfg.CertFile = p.clientCert
+	cfg.KeyFile = p.clientKey
+	cfg.CAFile = p.ca
+	return cfg
+}
+
+// expectNone fails if anything reaches the central queue for a while
+func expectNone(t *testing.T, ch chan *models.Envelope) {
+	t.Helper()
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected envelope %s", e.Event.ID)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestStream_ForwardsEnvelopesInOrder(t *testing.T) {
+	p := newPKI(t)
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	srv, ch := grpcCentral(t, p, 100, store)
+
+	f, err := forward.New(grpcConfig(p, srv.Addr().String(), t.TempDir()), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 30)); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range receive(t, ch, 30) {
+		if e.Event.ID != fmt.Sprintf("evt-%d", i) {
+			t.Fatalf("envelope %d out of order: %s", i, e.Event.ID)
+		}
+	}
+
+	// The resume token is kept under the node's certificate name
+	deadline := time.Now().Add(time.Second)
+	for {
+		token, _ := store.Get(context.Background(), "parsec:forward:resume:edge-1")
+		if token != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no resume token stored for edge-1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStream_BackpressureResendsWithoutDuplicates(t *testing.T) {
+	p := newPKI(t)
+	srv, ch := grpcCentral(t, p, 3, state.NewMemoryStore(state.MemoryConfig{}))
+
+	f, err := forward.New(grpcConfig(p, srv.Addr().String(), t.TempDir()), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 25)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Draining the small queue slowly keeps refusing batches part way
+	var got []*models.Envelope
+	timeout := time.After(10 * time.Second)
+	for len(got) < 25 {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+			time.Sleep(5 * time.Millisecond)
+		case <-timeout:
+			t.Fatalf("received %d of 25 envelopes", len(got))
+		}
+	}
+	for i, e := range got {
+		if e.Event.ID != fmt.Sprintf("evt-%d", i) {
+			t.Fatalf("envelope %d: got %s", i, e.Event.ID)
+		}
+	}
+	expectNone(t, ch)
+
+	if stats := f.Stats(); stats.MessagesSent != 25 {
+		t.Errorf("MessagesSent = %d, want 25", stats.MessagesSent)
+	}
+}
+
+func TestStream_ResumeTokenSkipsAcknowledgedLines(t *testing.T) {
+	p := newPKI(t)
+	srv, ch := grpcCentral(t, p, 100, state.NewMemoryStore(state.MemoryConfig{}))
+
+	// Buffer envelopes while the central node is unreachable
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := lis.Addr().String()
+	lis.Close()
+
+	dir := t.TempDir()
+	f, err := forward.New(grpcConfig(p, dead, dir), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PublishBatch(context.Background(), envelopes(0, 5)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// A copy of the buffer stands in for an edge that crashed before
+	// committing what the central node acknowledged
+	stale := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(stale, entry.Name()), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err = forward.New(grpcConfig(p, srv.Addr().String(), dir), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch, 5)
+	f.Close()
+
+	f, err = forward.New(grpcConfig(p, srv.Addr().String(), stale), "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	expectNone(t, ch)
+
+	if err := f.Publish(context.Background(), envelopes(5, 1)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, ch, 1); got[0].Event.ID != "evt-5" {
+		t.Errorf("got %s, want evt-5", got[0].Event.ID)
+	}
+	expectNone(t, ch)
+}
+
+func TestStream_RejectsUnknownClientCertificates(t *testing.T) {
+	p := newPKI(t)
+	srv, ch := grpcCentral(t, p, 100, state.NewMemoryStore(state.MemoryConfig{}))
+
+	// A client certificate from another CA
+	dir := t.TempDir()
+	rogue, _ := newCA(t, dir, "rogue-ca")
+	cert, key := rogue.issue(t, dir, "edge-1", x509.ExtKeyUsageClientAuth)
+	cfg := grpcConfig(p, srv.Addr().String(), t.TempDir())
+	cfg.CertFile, cfg.KeyFile = cert, key
+
+	f, err := forward.New(cfg, "edge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := f.PublishBatch(context.Background(), envelopes(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	expectNone(t, ch)
+	if stats := f.Stats(); stats.MessagesSent != 0 {
+		t.Errorf("MessagesSent = %d, want 0", stats.MessagesSent)
+	}
+}
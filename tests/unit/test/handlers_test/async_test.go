@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/receipts"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// asyncBody is a batch of n events
+func asyncBody(n int) string {
+	events := make([]string, n)
+	for i := range events {
+		events[i] = fmt.Sprintf(`{"id": "evt-%d", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "m"}`, i)
+	}
+	return `{"batch_ref": "upload-1", "events": [` + strings.Join(events, ",") + `]}`
+}
+
+func postAsync(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ingest?mode=async", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func getReceipt(t *testing.T, store *receipts.Store, id string) receipts.Receipt {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/batches/{id}", handlers.NewBatchesHandler(store))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/batches/"+id, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for batch %s, got %d: %s", id, w.Code, w.Body.String())
+	}
+	var r receipts.Receipt
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestIngestHandler_AsyncBatch(t *testing.T) {
+	// A queue much smaller than the batch: async ingest waits for room
+	ch := make(chan *models.Envelope, 4)
+	store := receipts.NewStore(state.NewMemoryStore(state.MemoryConfig{}), nil, 0)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan:  ch,
+		NodeID:        "test-node",
+		MaxBatchBytes: 512, // async batches aren't bound by it
+		Receipts:      store,
+		Async:         &handlers.AsyncConfig{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.RunAsync(ctx)
+
+	w := postAsync(handler, asyncBody(50))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp handlers.AsyncResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.BatchID == "" || resp.Status != receipts.BatchPending || w.Header().Get("Location") != resp.StatusURL {
+		t.Errorf("unexpected async response %+v", resp)
+	}
+
+	received := 0
+	deadline := time.After(5 * time.Second)
+	for received < 50 {
+		select {
+		case <-ch:
+			received++
+		case <-deadline:
+			t.Fatalf("received %d of 50 events", received)
+		}
+	}
+
+	var r receipts.Receipt
+	for r.Status != receipts.BatchCompleted {
+		r = getReceipt(t, store, resp.BatchID)
+		select {
+		case <-deadline:
+			t.Fatalf("batch still %s", r.Status)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if r.Accepted != 50 || r.Rejected != 0 || r.BatchRef != "upload-1" || len(r.Events) != 50 || r.CompletedAt == nil {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+}
+
+func TestIngestHandler_AsyncStagingAndShutdown(t *testing.T) {
+	store := receipts.NewStore(state.NewMemoryStore(state.MemoryConfig{}), nil, 0)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+		Receipts:     store,
+		Async:        &handlers.AsyncConfig{MaxPending: 1},
+	})
+
+	first := postAsync(handler, asyncBody(2))
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", first.Code)
+	}
+	id := first.Header().Get("X-Batch-Id")
+	if r := getReceipt(t, store, id); r.Status != receipts.BatchPending {
+		t.Errorf("expected a pending receipt, got %+v", r)
+	}
+
+	// Staging holds one batch
+	if w := postAsync(handler, asyncBody(2)); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After, got %d", w.Code)
+	}
+
+	// Shutting down before the batch was ingested fails it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.RunAsync(ctx)
+	if r := getReceipt(t, store, id); r.Status != receipts.BatchFailed || r.Error == "" {
+		t.Errorf("expected the staged batch failed at shutdown, got %+v", r)
+	}
+}
+
+func TestIngestHandler_AsyncRequiresReceipts(t *testing.T) {
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+		Async:        &handlers.AsyncConfig{},
+	})
+	if w := postAsync(handler, asyncBody(1)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without receipts, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest?mode=later", bytes.NewBufferString(asyncBody(1)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mode, got %d", w.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/rbac"
+	"parsec/internal/receipts"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func TestIngestHandler_BatchReceipts(t *testing.T) {
+	key := []byte("receipt-key")
+	store := receipts.NewStore(state.NewMemoryStore(state.MemoryConfig{}), key, 0)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+		Receipts:     store,
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/batches/{id}", handlers.NewBatchesHandler(store))
+
+	body := `{
+        "batch_ref": "agent-7/0042",
+        "events": [
+            {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "first"},
+            {"id": "", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "no ID"},
+            {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "copy"}
+        ]
+    }`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	receipt := resp.Receipt
+	if receipt == nil {
+		t.Fatalf("expected a receipt, got %s", w.Body.String())
+	}
+	if receipt.BatchRef != "agent-7/0042" || receipt.BatchID == "" || w.Header().Get("X-Batch-Id") != receipt.BatchID {
+		t.Errorf("unexpected receipt identity %+v", receipt)
+	}
+
+	want := []string{receipts.StatusAccepted, receipts.StatusRejected, receipts.StatusDropped}
+	if len(receipt.Events) != len(want) {
+		t.Fatalf("expected %d dispositions, got %+v", len(want), receipt.Events)
+	}
+	for i, status := range want {
+		if receipt.Events[i].Status != status {
+			t.Errorf("event %d: got %s, want %s", i, receipt.Events[i].Status, status)
+		}
+	}
+	if receipt.Events[0].EventID != "evt-1" || receipt.Events[2].Error == "" {
+		t.Errorf("unexpected dispositions %+v", receipt.Events)
+	}
+	if !receipts.Verify(key, *receipt) {
+		t.Error("expected the receipt signature to verify")
+	}
+
+	// The same receipt can be fetched later
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/batches/"+receipt.BatchID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var stored receipts.Receipt
+	if err := json.Unmarshal(w.Body.Bytes(), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Signature != receipt.Signature || !receipts.Verify(key, stored) {
+		t.Errorf("stored receipt doesn't match: %+v", stored)
+	}
+
+	// A tampered receipt fails verification
+	stored.Events[1].Status = receipts.StatusAccepted
+	if receipts.Verify(key, stored) {
+		t.Error("expected a tampered receipt to fail verification")
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/batches/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown batch, got %d", w.Code)
+	}
+}
+
+func TestBatchesHandler_ScopedToTenants(t *testing.T) {
+	store := receipts.NewStore(state.NewMemoryStore(state.MemoryConfig{}), nil, 0)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+		Receipts:     store,
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/batches/{id}", handlers.NewBatchesHandler(store))
+
+	acme := &rbac.Principal{Name: "acme-agents", Role: rbac.RoleIngest, Tenants: []string{"acme"}}
+	globex := &rbac.Principal{Name: "globex-agents", Role: rbac.RoleIngest, Tenants: []string{"globex"}}
+	shared := &rbac.Principal{Name: "collector", Role: rbac.RoleIngest}
+
+	// The event for a tenant the key can't ingest for doesn't make the
+	// batch that tenant's
+	body := `[
+        {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "ours"},
+        {"id": "evt-2", "tenant_id": "globex", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "not ours"}
+    ]`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req = req.WithContext(rbac.NewContext(req.Context(), acme))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	batchID := w.Header().Get("X-Batch-Id")
+	if batchID == "" {
+		t.Fatalf("expected a batch ID, got %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		principal *rbac.Principal
+		want      int
+	}{
+		{acme, http.StatusOK},
+		{shared, http.StatusOK},
+		{globex, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/batches/"+batchID, nil)
+		req = req.WithContext(rbac.NewContext(req.Context(), tt.principal))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.principal.Name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestIngestHandler_NoReceiptsByDefault(t *testing.T) {
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+	})
+
+	body := `{"batch_ref": "ref-1", "events": [{"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "m"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Receipt != nil || w.Header().Get("X-Batch-Id") != "" {
+		t.Errorf("expected no receipt, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/browser"
+	"parsec/internal/objstore"
+	"parsec/pkg/models"
+)
+
+const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Safari/537.36"
+
+func postBrowser(handler http.Handler, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", chromeUA)
+	req.RemoteAddr = "203.0.113.9:51234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestBrowserHandler_SymbolicatesBeacon(t *testing.T) {
+	ctx := context.Background()
+	maps := browser.NewSourceMaps(objstore.NewDir(t.TempDir()), "")
+	sourceMap := `{"version":3,"sources":["src/app.ts"],"names":["handleClick"],"mappings":"AAAA,UAAUA;AACA"}`
+	if err := maps.Put(ctx, "web", "1.2.0", "app.min.js", []byte(sourceMap)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	geo, err := browser.ReadGeoDB(strings.NewReader("203.0.113.0/24,AU,NSW,Sydney\n"))
+	if err != nil {
+		t.Fatalf("ReadGeoDB: %v", err)
+	}
+
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	handler := handlers.NewBrowserHandler(ingest, handlers.BrowserConfig{Tenants: []string{"web"}, SourceMaps: maps, Geo: geo})
+
+	// sendBeacon sends strings as text/plain
+	report := `{"type":"TypeError","message":"x is undefined","release":"1.2.0","url":"https://example.com/cart",
+		"stack":"TypeError: x is undefined\n    at a (https://example.com/static/app.min.js?v=3:1:11)\n    at https://example.com/static/vendor.js:4:2"}`
+	w := postBrowser(handler, "/ingest/browser?tenant=web", "text/plain;charset=UTF-8", report)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("expected CORS to allow any origin")
+	}
+
+	event := (<-ch).Event
+	if event.TenantID != "web" || event.Source != handlers.BrowserSource || event.Severity != models.SeverityError || event.ID == "" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	wantMessage := "TypeError: x is undefined\n    at handleClick (src/app.ts:1:11)\n    at https://example.com/static/vendor.js:4:2"
+	if event.Message != wantMessage {
+		t.Errorf("unexpected message:\n%s", event.Message)
+	}
+
+	if event.Metadata["release"] != "1.2.0" || event.Metadata["url"] != "https://example.com/cart" ||
+		event.Metadata["user_agent"] != chromeUA || event.Metadata["symbolicated"] != true {
+		t.Errorf("unexpected metadata: %v", event.Metadata)
+	}
+	if b, _ := event.Metadata["browser"].(map[string]any); b["name"] != "Chrome" || b["version"] != "120.0.6099.71" {
+		t.Errorf("unexpected browser metadata: %v", event.Metadata["browser"])
+	}
+	if event.Metadata["device"] != browser.DeviceDesktop {
+		t.Errorf("unexpected device: %v", event.Metadata["device"])
+	}
+	if g, _ := event.Metadata["geo"].(map[string]any); g["country"] != "AU" || g["city"] != "Sydney" {
+		t.Errorf("unexpected geo metadata: %v", event.Metadata["geo"])
+	}
+}
+
+func TestBrowserHandler_Batch(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	handler := handlers.NewBrowserHandler(ingest, handlers.BrowserConfig{Tenants: []string{"web"}})
+
+	w := postBrowser(handler, "/ingest/browser?tenant=web", "application/json",
+		`[{"message":"first","level":"WARNING"},{"message":"second","source":"checkout"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Accepted != 2 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+	if first := (<-ch).Event; first.Severity != models.SeverityWarning || first.Message != "first" {
+		t.Errorf("unexpected first event: %s %q", first.Severity, first.Message)
+	}
+	if second := (<-ch).Event; second.Source != "checkout" {
+		t.Errorf("expected the reported source, got %s", second.Source)
+	}
+}
+
+func TestBrowserHandler_Rejects(t *testing.T) {
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: make(chan *models.Envelope, 10), NodeID: "test-node"})
+	handler := handlers.NewBrowserHandler(ingest, handlers.BrowserConfig{Tenants: []string{"web"}})
+
+	if w := postBrowser(handler, "/ingest/browser?tenant=other", "text/plain", `{"message":"x"}`); w.Code != http.StatusForbidden {
+		t.Errorf("unlisted tenant: expected 403, got %d", w.Code)
+	}
+	if w := postBrowser(handler, "/ingest/browser", "text/plain", `{"message":"x"}`); w.Code != http.StatusForbidden {
+		t.Errorf("no tenant: expected 403, got %d", w.Code)
+	}
+	if w := postBrowser(handler, "/ingest/browser?tenant=web", "application/xml", `{"message":"x"}`); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("xml: expected 415, got %d", w.Code)
+	}
+	if w := postBrowser(handler, "/ingest/browser?tenant=web", "text/plain", `[]`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: expected 400, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, "/ingest/browser?tenant=web", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("preflight: expected 204 with CORS headers, got %d", w.Code)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/config"
+)
+
+func TestConfigHandler(t *testing.T) {
+	cfg := config.Default()
+	cfg.Kafka.Producer.BatchSize = 500
+	cfg.Signing.Secret = "hunter2"
+	handler := handlers.NewConfigHandler(cfg)
+
+	get := func(target string) handlers.ConfigResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", target, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "hunter2") {
+			t.Fatalf("%s: secret leaked: %s", target, w.Body.String())
+		}
+		var resp handlers.ConfigResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	all := get("/admin/config")
+	if len(all.Settings) < 100 {
+		t.Errorf("expected every setting, got %d", len(all.Settings))
+	}
+
+	producer := get("/admin/config?prefix=kafka.producer")
+	for _, s := range producer.Settings {
+		if !strings.HasPrefix(s.Key, "kafka.producer.") {
+			t.Errorf("unexpected setting %s for the prefix", s.Key)
+		}
+	}
+
+	changed := get("/admin/config?source=env")
+	if len(changed.Settings) != 2 {
+		t.Fatalf("expected 2 changed settings, got %+v", changed.Settings)
+	}
+	if changed.Settings[0].Key != "kafka.producer.batch_size" || changed.Settings[0].Value != float64(500) {
+		t.Errorf("unexpected setting %+v", changed.Settings[0])
+	}
+	if changed.Settings[1].Key != "signing.secret" || changed.Settings[1].Value != config.Redacted {
+		t.Errorf("unexpected setting %+v", changed.Settings[1])
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/config", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
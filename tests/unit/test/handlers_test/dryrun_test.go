@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+func TestDryRunHandler_DoesNotPublish(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Topic:        "log-events",
+	})
+	handler := handlers.NewDryRunHandler(ingest)
+
+	body := `[
+        {
+            "id": "evt-1",
+            "tenant_id": "tenant-1",
+            "timestamp": "2024-01-15T10:30:00Z",
+            "severity": "warn",
+            "source": "API",
+            "message": "slow",
+            "metadata": {"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+        },
+        {
+            "id": "evt-2",
+            "tenant_id": "tenant-1",
+            "timestamp": "2024-01-15T10:30:00Z",
+            "severity": "INFO",
+            "source": "api",
+            "message": ""
+        }
+    ]`
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/dry-run", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp handlers.DryRunResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp.Accepted != 0 || resp.Rejected != 2 || len(resp.Results) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// WARN is not a valid severity, so the first event is rejected after normalization
+	first := resp.Results[0]
+	if first.Accepted || first.Error != models.ErrInvalidSeverity.Error() {
+		t.Errorf("expected invalid severity rejection, got %+v", first)
+	}
+
+	second := resp.Results[1]
+	if second.Accepted || second.Error != models.ErrEmptyMessage.Error() {
+		t.Errorf("expected empty message rejection, got %+v", second)
+	}
+
+	if len(ch) != 0 {
+		t.Errorf("dry run must not publish, got %d envelopes", len(ch))
+	}
+}
+
+func TestDryRunHandler_ReportsRouting(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Topic:        "log-events",
+	})
+	handler := handlers.NewDryRunHandler(ingest)
+
+	body := `{"id": "evt-1", "tenant_id": "tenant-1", "timestamp": "2024-01-15T10:30:00Z",
+        "severity": "warning", "source": "API", "message": "slow b3=463ac35c9f6413ad-a2fb4a1d1a96d312"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/dry-run", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.DryRunResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Accepted != 1 {
+		t.Fatalf("expected 1 accepted, got %+v", resp)
+	}
+
+	result := resp.Results[0]
+	if result.Routing == nil || result.Routing.Topic != "log-events" || result.Routing.PartitionKey != "tenant-1" {
+		t.Errorf("unexpected routing: %+v", result.Routing)
+	}
+	if result.Envelope == nil || result.Envelope.Event.Source != "api" || result.Envelope.Event.TraceID != "463ac35c9f6413ad" {
+		t.Errorf("expected normalized envelope, got %+v", result.Envelope)
+	}
+
+	found := false
+	for _, stage := range result.Stages {
+		if stage == "trace_context" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected trace_context stage, got %v", result.Stages)
+	}
+}
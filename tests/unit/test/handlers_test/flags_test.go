@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/flags"
+	"parsec/internal/state"
+)
+
+func TestFlagsHandler_DeleteOverride(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	manager := flags.NewManager(store, flags.EnvSource{Value: "sampling=false"})
+	if err := manager.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.NewFlagsHandler(manager)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/admin/flags", `{"flag":"sampling","rule":{"enabled":true}}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 setting the flag, got %d", w.Code)
+	}
+	if !manager.Enabled(flags.Sampling, "") {
+		t.Fatal("override not applied")
+	}
+
+	w := do(http.MethodDelete, "/admin/flags?flag=sampling", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 removing the override, got %d: %s", w.Code, w.Body.String())
+	}
+	var snapshot map[flags.Flag]flags.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if rule, ok := snapshot[flags.Sampling]; !ok || rule.Enabled {
+		t.Errorf("expected the configured rule back, got %+v", snapshot)
+	}
+
+	if w := do(http.MethodDelete, "/admin/flags?flag=sampling", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 removing it twice, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/admin/flags", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a flag, got %d", w.Code)
+	}
+}
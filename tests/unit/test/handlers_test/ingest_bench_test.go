@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+// benchBody is a typical sidecar event
+const benchBody = `{"id":"evt-7f3a","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"checkout","message":"order placed","metadata":{"region":"eu"}}`
+
+// replayBody serves the same body to every request without allocating
+type replayBody struct{ bytes.Reader }
+
+func (b *replayBody) Close() error { return nil }
+
+// discardWriter is a ResponseWriter that keeps no output
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(status int)      { w.status = status }
+
+func benchmarkIngest(b *testing.B, body string) {
+	// Production logs at info; the handler's debug lines must cost nothing
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	// Room for every envelope, so no consumer competes with the handler
+	ch := make(chan *models.Envelope, b.N*10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "bench-node"})
+
+	payload := []byte(body)
+	rb := &replayBody{}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/ingest", rb)
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(payload))
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Reset(payload)
+		req.Body = rb
+		handler.ServeHTTP(w, req)
+		if w.status != http.StatusOK {
+			b.Fatalf("status %d", w.status)
+		}
+	}
+}
+
+func BenchmarkIngest_SingleEvent(b *testing.B) {
+	benchmarkIngest(b, benchBody)
+}
+
+func BenchmarkIngest_SingleEventNoMetadata(b *testing.B) {
+	benchmarkIngest(b, `{"id":"evt-7f3a","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"checkout","message":"order placed"}`)
+}
+
+func BenchmarkIngest_WrappedSingleEvent(b *testing.B) {
+	benchmarkIngest(b, `{"event":`+benchBody+`}`)
+}
+
+func BenchmarkIngest_Batch10(b *testing.B) {
+	batch := "[" + benchBody
+	for i := 1; i < 10; i++ {
+		batch += "," + benchBody
+	}
+	benchmarkIngest(b, batch+"]")
+}
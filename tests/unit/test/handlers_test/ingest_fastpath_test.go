@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+// ingestOne posts body and returns the status and the envelope queued, if any
+func ingestOne(t *testing.T, body string) (int, *models.Envelope) {
+	t.Helper()
+	ch := make(chan *models.Envelope, 1)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	select {
+	case envelope := <-ch:
+		return w.Code, envelope
+	default:
+		return w.Code, nil
+	}
+}
+
+// The single-event decoder must agree with the general decoder, which an
+// array of one event always goes through
+func TestIngestHandler_SingleEventMatchesGeneralPath(t *testing.T) {
+	cases := map[string]string{
+		"plain":         `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"info","source":"API","message":"ok"}`,
+		"whitespace":    "{\n  \"id\" : \"evt-1\" ,\t\"tenant_id\":\"acme\", \"timestamp\":\"2024-01-15T10:30:00Z\",\"severity\":\"INFO\",\"source\":\"api\",\"message\":\" ok \" }\n",
+		"escapes":       `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"a\nb \"q\" é 😀 \/"}`,
+		"utf8":          `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"héllo wörld"}`,
+		"invalid utf8":  "{\"id\":\"evt-1\",\"tenant_id\":\"acme\",\"timestamp\":\"2024-01-15T10:30:00Z\",\"severity\":\"INFO\",\"source\":\"api\",\"message\":\"bad \xff byte\"}",
+		"nulls":         `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok","trace_id":null,"metadata":null}`,
+		"metadata":      `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok","metadata":{" Region ":" eu ","traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}`,
+		"unknown":       `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok","extra":{"n":1}}`,
+		"duplicate":     `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"first","message":"second"}`,
+		"timestamp":     `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15 10:30:00","severity":"INFO","source":"api","message":"ok"}`,
+		"bad timestamp": `{"id":"evt-1","tenant_id":"acme","timestamp":"yesterday","severity":"INFO","source":"api","message":"ok"}`,
+		"invalid":       `{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"LOUD","source":"api","message":"ok"}`,
+	}
+
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			status, got := ingestOne(t, body)
+			wantStatus, want := ingestOne(t, "["+body+"]")
+
+			if status != wantStatus {
+				t.Fatalf("status %d, general path %d", status, wantStatus)
+			}
+			if (got == nil) != (want == nil) {
+				t.Fatalf("queued %v, general path %v", got != nil, want != nil)
+			}
+			if got != nil && !reflect.DeepEqual(got.Event, want.Event) {
+				t.Errorf("event %+v\ngeneral path %+v", got.Event, want.Event)
+			}
+		})
+	}
+}
+
+func TestIngestHandler_WrappedSingleEvent(t *testing.T) {
+	status, envelope := ingestOne(t, `{"event":{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok"}}`)
+	if status != http.StatusOK || envelope == nil {
+		t.Fatalf("status %d, envelope %v", status, envelope)
+	}
+	if envelope.BatchID == "" || envelope.PartitionKey != "acme" || envelope.IngestNode != "test-node" {
+		t.Errorf("envelope not filled in: %+v", envelope)
+	}
+}
+
+func TestIngestHandler_MalformedSingleEvent(t *testing.T) {
+	for _, body := range []string{
+		`{"tenant_id":"acme","message":"no id"}`,
+		`{"id":"evt-1","tenant_id":"acme"} trailing`,
+		`{"id":"evt-1","tenant_id":"acme"`,
+		`{"id":"evt-1","message":"ctrl` + "\x01" + `"}`,
+		`{"event":{"id":"evt-1"},"events":[]}`,
+	} {
+		if status, _ := ingestOne(t, body); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, status)
+		}
+	}
+}
+
+func TestIngestHandler_SingleEventAllocations(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	ch := make(chan *models.Envelope, 1)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	payload := []byte(`{"id":"evt-1","tenant_id":"acme","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok"}`)
+
+	rb := &replayBody{}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/ingest", rb)
+	req.ContentLength = int64(len(payload))
+	w := &discardWriter{header: make(http.Header)}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		rb.Reset(payload)
+		req.Body = rb
+		handler.ServeHTTP(w, req)
+		<-ch
+	})
+	// The body, and the event allocated with its envelope
+	if allocs > 2 {
+		t.Errorf("%.1f allocations per single event, want at most 2", allocs)
+	}
+}
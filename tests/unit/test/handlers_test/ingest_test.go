@@ -2,14 +2,20 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"parsec/internal/api"
-	"parsec/internal/models"
+	"parsec/internal/queue"
+	"parsec/internal/rbac"
+	"parsec/internal/routing"
+	"parsec/internal/suspension"
+	"parsec/pkg/models"
 )
 
 func TestIngestHandler_SingleEvent(t *testing.T) {
@@ -180,3 +186,471 @@ func TestIngestHandler_MethodNotAllowed(t *testing.T) {
 		t.Errorf("expected 405, got %d", w.Code)
 	}
 }
+
+func TestIngestHandler_NestedMetadata(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+	})
+
+	body := `{
+        "id": "evt-1",
+        "tenant_id": "tenant-1",
+        "timestamp": "2024-01-15T10:30:00Z",
+        "severity": "info",
+        "source": "api",
+        "message": "Request processed",
+        "metadata": {"Region": "eu", "http": {"status": 200, "Route": "/orders"}, "tags": ["a", "b"]}
+    }`
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	metadata := (<-ch).Event.Metadata
+	if metadata.Get("region") != "eu" {
+		t.Errorf("expected top-level keys to be normalized, got %v", metadata)
+	}
+	for path, want := range map[string]string{"http.status": "200", "http.Route": "/orders", "tags.1": "b"} {
+		if v, ok := metadata.Lookup(path); !ok || models.Stringify(v) != want {
+			t.Errorf("%s = %v, want %s", path, v, want)
+		}
+	}
+	flat := metadata.Flatten()
+	if len(flat) != 5 || flat["http.status"] != "200" || flat["tags.0"] != "a" {
+		t.Errorf("unexpected flattened metadata: %v", flat)
+	}
+}
+
+func TestIngestHandler_RejectsDeepMetadata(t *testing.T) {
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: make(chan *models.Envelope, 10),
+		NodeID:       "test-node",
+	})
+
+	nested := `"leaf"`
+	for i := 0; i <= models.MaxMetadataDepth; i++ {
+		nested = `{"a":` + nested + `}`
+	}
+	body := `{"id":"evt-1","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"info",` +
+		`"source":"api","message":"deep","metadata":{"deep":` + nested + `}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Rejected != 1 {
+		t.Fatalf("expected the event to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIngestHandler_SizeLimits(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan:  ch,
+		NodeID:        "test-node",
+		MaxEventBytes: 400,
+		MaxBatchBytes: 1000,
+	})
+
+	event := func(id string, messageBytes int) string {
+		return `{"id":"` + id + `","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z",` +
+			`"severity":"INFO","source":"api","message":"` + strings.Repeat("x", messageBytes) + `"}`
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// An oversized event is rejected on its own; the rest of the batch is kept
+	w := post(`[` + event("big", 500) + `,` + event("small", 10) + `]`)
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Accepted != 1 || resp.Rejected != 1 || resp.Errors[0].EventID != "big" ||
+		!strings.Contains(resp.Errors[0].Error, handlers.ErrEventTooLarge.Error()) {
+		t.Errorf("expected only the big event to be rejected, got %+v", resp)
+	}
+	if got := (<-ch).Event.ID; got != "small" {
+		t.Errorf("expected the small event to be enqueued, got %s", got)
+	}
+
+	// Events under the per-event limit can still add up to too much
+	events := make([]string, 4)
+	for i := range events {
+		events[i] = event("evt", 200)
+	}
+	if w := post(`[` + strings.Join(events, ",") + `]`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized batch, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A single event is a batch of one
+	if w := post(event("huge", 1200)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a single event over the batch limit, got %d", w.Code)
+	}
+	if len(ch) != 0 {
+		t.Errorf("expected rejected batches not to be enqueued, got %d envelopes", len(ch))
+	}
+}
+
+func TestIngestHandler_AtomicBatch(t *testing.T) {
+	valid := func(id string) string {
+		return `{"id":"` + id + `","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z",` +
+			`"severity":"INFO","source":"api","message":"ok"}`
+	}
+	invalid := `{"id":"bad","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api"}`
+
+	post := func(handler http.Handler, target, body string) (int, handlers.IngestResponse) {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp handlers.IngestResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	// One invalid event rejects the whole batch
+	status, resp := post(handler, "/ingest?atomic=true", `[`+valid("a")+`,`+invalid+`]`)
+	if status != http.StatusBadRequest || resp.Accepted != 0 || resp.Rejected != 2 {
+		t.Errorf("expected the batch to be rejected, got %d: %+v", status, resp)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].EventID != "bad" {
+		t.Errorf("expected an error for the invalid event only, got %+v", resp.Errors)
+	}
+	if len(ch) != 0 {
+		t.Fatalf("expected nothing enqueued, got %d envelopes", len(ch))
+	}
+
+	// Without the option the valid event is kept
+	if status, _ := post(handler, "/ingest", `[`+valid("a")+`,`+invalid+`]`); status != http.StatusMultiStatus {
+		t.Errorf("expected partial success without atomic, got %d", status)
+	}
+	<-ch
+
+	status, resp = post(handler, "/ingest?atomic=true", `[`+valid("a")+`,`+valid("b")+`]`)
+	if status != http.StatusOK || resp.Accepted != 2 || len(ch) != 2 {
+		t.Errorf("expected a valid batch to be accepted, got %d: %+v", status, resp)
+	}
+
+	if status, _ := post(handler, "/ingest?atomic=maybe", `[`+valid("a")+`]`); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid atomic parameter, got %d", status)
+	}
+}
+
+func TestIngestHandler_AtomicBatchQueueFull(t *testing.T) {
+	ch := make(chan *models.Envelope, 1)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	event := func(id string) string {
+		return `{"id":"` + id + `","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok"}`
+	}
+	req := httptest.NewRequest(http.MethodPost, "/ingest?atomic=1", bytes.NewBufferString(`[`+event("a")+`,`+event("b")+`]`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Accepted != 0 || resp.Rejected != 2 || len(resp.Errors) != 2 || resp.Errors[0].Error != handlers.QueueFullError {
+		t.Errorf("expected the batch to be refused as a whole, got %+v", resp)
+	}
+	if len(ch) != 0 {
+		t.Errorf("expected nothing enqueued, got %d envelopes", len(ch))
+	}
+}
+
+func TestIngestHandler_AtomicBatchWithOverflow(t *testing.T) {
+	event := func(id string) string {
+		return `{"id":"` + id + `","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok"}`
+	}
+	post := func(handler http.Handler, body string) handlers.IngestResponse {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest?atomic=true", bytes.NewBufferString(body)))
+		var resp handlers.IngestResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	// Two free slots for a batch of three: none is queued, even though
+	// the overflow policy would take events one at a time
+	ch := make(chan *models.Envelope, 3)
+	overflow, err := queue.New(ch, queue.Config{Policy: queue.PolicyDropOldest, Grace: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node", Overflow: overflow})
+	ch <- &models.Envelope{Event: &models.LogEvent{ID: "queued"}}
+	resp := post(handler, `[`+event("a")+`,`+event("b")+`,`+event("c")+`]`)
+	if resp.Accepted != 0 || resp.Rejected != 3 || len(resp.Errors) != 3 || resp.Errors[0].Error != handlers.QueueFullError {
+		t.Errorf("expected the batch to be refused as a whole, got %+v", resp)
+	}
+	if len(ch) != 1 {
+		t.Errorf("expected nothing enqueued, got %d envelopes", len(ch)-1)
+	}
+
+	// A batch that fits is queued whole and leaves no room reserved
+	if resp := post(handler, `[`+event("a")+`,`+event("b")+`]`); resp.Accepted != 2 || len(ch) != 3 {
+		t.Errorf("expected the batch queued, got %+v with %d envelopes", resp, len(ch))
+	}
+	<-ch
+	if !overflow.Offer(&models.Envelope{Event: &models.LogEvent{ID: "after"}}) {
+		t.Error("expected the unused reservation to be released")
+	}
+
+	// The byte budget is reserved for the whole batch too
+	ch = make(chan *models.Envelope, 10)
+	sample := &models.LogEvent{ID: "a", TenantID: "tenant-1", Severity: "INFO", Source: "api", Message: "ok"}
+	budget := queue.NewBudget(int64(sample.Size()) * 3)
+	overflow, err = queue.New(ch, queue.Config{Policy: queue.PolicyReject, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node", Overflow: overflow})
+	if !overflow.Offer(&models.Envelope{Event: sample}) {
+		t.Fatal("expected room for one event")
+	}
+	used := budget.Used()
+	if resp := post(handler, `[`+event("a")+`,`+event("b")+`,`+event("c")+`]`); resp.Accepted != 0 || len(ch) != 1 {
+		t.Errorf("expected the batch refused for the byte budget, got %+v with %d envelopes", resp, len(ch))
+	}
+	if budget.Used() != used {
+		t.Errorf("expected the reserved bytes released, %d used, want %d", budget.Used(), used)
+	}
+}
+
+func TestIngestHandler_DuplicateIDs(t *testing.T) {
+	event := func(id, message string) string {
+		return `{"id":"` + id + `","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z",` +
+			`"severity":"INFO","source":"api","message":"` + message + `"}`
+	}
+	body := `[` + event("a", "first") + `,` + event("b", "other") + `,` + event("a", "second") + `,` + event("a", "third") + `]`
+
+	tests := []struct {
+		policy    handlers.DuplicatePolicy
+		accepted  int
+		rejected  int
+		dropped   int
+		kept      string
+		errorsFor []int
+	}{
+		{handlers.DuplicateKeepFirst, 2, 0, 2, "first", []int{2, 3}},
+		{handlers.DuplicateKeepLast, 2, 0, 2, "third", []int{0, 2}},
+		{handlers.DuplicateReject, 1, 3, 0, "", []int{0, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ch := make(chan *models.Envelope, 10)
+			handler := handlers.NewIngestHandler(handlers.IngestConfig{
+				EnvelopeChan: ch,
+				NodeID:       "test-node",
+				Duplicates:   tt.policy,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			var resp handlers.IngestResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Accepted != tt.accepted || resp.Rejected != tt.rejected || resp.Dropped != tt.dropped {
+				t.Fatalf("got %d accepted, %d rejected, %d dropped: %+v", resp.Accepted, resp.Rejected, resp.Dropped, resp)
+			}
+
+			if len(resp.Errors) != len(tt.errorsFor) {
+				t.Fatalf("expected errors for %v, got %+v", tt.errorsFor, resp.Errors)
+			}
+			for n, e := range resp.Errors {
+				if e.Index != tt.errorsFor[n] || e.EventID != "a" || e.DuplicateOf == nil || *e.DuplicateOf == e.Index {
+					t.Errorf("unexpected error %+v", e)
+				}
+			}
+
+			kept := ""
+			for len(ch) > 0 {
+				if envelope := <-ch; envelope.Event.ID == "a" {
+					kept = envelope.Event.Message
+				}
+			}
+			if kept != tt.kept {
+				t.Errorf("kept %q, want %q", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	if p, err := handlers.ParseDuplicatePolicy(""); err != nil || p != handlers.DuplicateKeepFirst {
+		t.Errorf("expected keep_first by default, got %q, %v", p, err)
+	}
+	if _, err := handlers.ParseDuplicatePolicy("keep-some"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestIngestHandler_TenantLimitedCaller(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+	})
+	principal := &rbac.Principal{Name: "acme-agents", Role: rbac.RoleIngest, Tenants: []string{"acme"}}
+
+	body := `[
+        {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "ours"},
+        {"id": "evt-2", "tenant_id": "globex", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "not ours"}
+    ]`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req = req.WithContext(rbac.NewContext(req.Context(), principal))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Accepted != 1 || resp.Rejected != 1 || len(resp.Errors) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Errors[0].EventID != "evt-2" || resp.Errors[0].Error != handlers.ErrTenantNotAllowed.Error() {
+		t.Errorf("unexpected error %+v", resp.Errors[0])
+	}
+	if len(ch) != 1 || (<-ch).Event.TenantID != "acme" {
+		t.Error("expected only acme's event queued")
+	}
+
+	// Forwarding carries every tenant's events
+	forward := handlers.NewForwardHandler(handler)
+	req = httptest.NewRequest(http.MethodPost, "/ingest/forward", strings.NewReader("{}\n"))
+	req = req.WithContext(rbac.NewContext(req.Context(), principal))
+	w = httptest.NewRecorder()
+	forward.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("forward with a tenant-limited key: expected 403, got %d", w.Code)
+	}
+}
+
+func TestIngestHandler_SuspendedTenant(t *testing.T) {
+	registry := suspension.NewRegistry(nil)
+	if _, err := registry.Suspend(context.Background(), suspension.Suspension{TenantID: "globex", Mode: suspension.ModeBlocked}); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Suspensions:  registry,
+	})
+
+	body := `[
+        {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "fine"},
+        {"id": "evt-2", "tenant_id": "globex", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "blocked"}
+    ]`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body)))
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Accepted != 1 || resp.Rejected != 1 || len(resp.Errors) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Errors[0].EventID != "evt-2" || resp.Errors[0].Code != "tenant_blocked" {
+		t.Errorf("unexpected error %+v", resp.Errors[0])
+	}
+	if len(ch) != 1 || (<-ch).Event.TenantID != "acme" {
+		t.Error("expected only acme's event queued")
+	}
+}
+
+func TestIngestHandler_RetentionHints(t *testing.T) {
+	router := routing.NewEngine(nil)
+	err := router.SetRules(context.Background(), "acme", []routing.Rule{
+		{Name: "debug", Match: routing.Match{MaxSeverity: models.SeverityDebug}, Action: routing.ActionRetention, TTL: "3d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Router:       router,
+	})
+
+	// The client's hint applies unless a routing rule sets one
+	body := `[
+        {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "audit", "message": "role granted"},
+        {"id": "evt-2", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "DEBUG", "source": "audit", "message": "cache miss"}
+    ]`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("X-Parsec-Retention", "7y")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || len(ch) != 2 {
+		t.Fatalf("expected both events queued, got %d: %s", w.Code, w.Body.String())
+	}
+	if e := <-ch; e.RetentionSeconds != 7*365*24*3600 {
+		t.Errorf("expected the client's 7 year hint, got %d", e.RetentionSeconds)
+	}
+	if e := <-ch; e.RetentionSeconds != 3*24*3600 {
+		t.Errorf("expected the rule's 3 day hint, got %d", e.RetentionSeconds)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("X-Parsec-Retention", "forever")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || len(ch) != 0 {
+		t.Errorf("expected an invalid hint refused, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIngestHandler_EmitAfterStop(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	handler.Emit(&models.LogEvent{ID: "before", TenantID: "tenant-1", Message: "flushed"})
+	if len(ch) != 1 {
+		t.Fatalf("expected the event queued before Stop, got %d", len(ch))
+	}
+
+	// Once stopped the queue may be closed: late events are dropped, not sent
+	handler.Stop()
+	close(ch)
+	handler.Emit(&models.LogEvent{ID: "after", TenantID: "tenant-1", Message: "late alert"})
+	if !handler.Stopped() {
+		t.Error("expected the handler to report it stopped")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(
+		`{"id":"req","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"late"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("expected a request after Stop to be refused, got %d", w.Code)
+	}
+}
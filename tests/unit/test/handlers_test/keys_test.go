@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/rbac"
+)
+
+func TestKeysHandler_RotateNeedsCoveringRole(t *testing.T) {
+	authn, err := rbac.NewAuthenticator(rbac.Config{Keys: []rbac.Key{
+		{Key: "ops", Name: "oncall", Role: rbac.RoleOperator},
+		{Key: "acme-admin", Name: "acme-admins", Role: rbac.RoleTenantAdmin, Tenants: []string{"acme"}},
+		{Key: "acme-ingest", Name: "acme-agents", Role: rbac.RoleIngest, Tenants: []string{"acme"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	h := handlers.NewKeysHandler(authn, time.Hour)
+	mux.Handle("/admin/keys", h)
+	mux.Handle("/admin/keys/{id}/rotate", h)
+
+	rotate := func(caller, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/admin/keys/"+id+"/rotate", nil)
+		r.Header.Set("X-API-Key", caller)
+		principal, err := authn.Authenticate(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r.WithContext(rbac.NewContext(r.Context(), principal)))
+		return w
+	}
+
+	// Tenant admins can't rotate the operator key, nor even their own
+	for _, id := range []string{"oncall", "acme-admins", "acme-agents"} {
+		if w := rotate("acme-admin", id); w.Code != http.StatusForbidden {
+			t.Errorf("tenant admin rotating %s: expected 403, got %d: %s", id, w.Code, w.Body.String())
+		}
+	}
+
+	if w := rotate("ops", "nobody"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown key, got %d", w.Code)
+	}
+	w := rotate("ops", "acme-agents")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("operator rotating: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var rotation rbac.Rotation
+	if err := json.Unmarshal(w.Body.Bytes(), &rotation); err != nil || rotation.Key == "" {
+		t.Errorf("unexpected rotation %s: %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,267 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/querycache"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+var lokiBase = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// lokiSource serves fixed events, filtering by tenant and range like the
+// Kafka scanner
+type lokiSource struct {
+	events []*models.LogEvent
+}
+
+func (s *lokiSource) Scan(ctx context.Context, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error {
+	for _, e := range s.events {
+		if e.TenantID == tenantID && !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newLokiMux() *http.ServeMux {
+	at := func(minutes int) time.Time { return lokiBase.Add(time.Duration(minutes) * time.Minute) }
+	source := &lokiSource{events: []*models.LogEvent{
+		{ID: "1", TenantID: "acme", Timestamp: at(1), Severity: models.SeverityInfo, Source: "api", Message: "started"},
+		{ID: "2", TenantID: "acme", Timestamp: at(3), Severity: models.SeverityError, Source: "api", Message: "request timeout"},
+		{ID: "3", TenantID: "acme", Timestamp: at(2), Severity: models.SeverityError, Source: "worker", Message: "job timeout"},
+		{ID: "4", TenantID: "acme", Timestamp: at(4), Severity: models.SeverityInfo, Source: "api", Message: "request ok"},
+		{ID: "5", TenantID: "globex", Timestamp: at(2), Severity: models.SeverityError, Source: "billing", Message: "not ours"},
+	}}
+
+	h := handlers.NewLokiHandler(source, handlers.LokiConfig{MaxLimit: 10, MaxRange: 24 * time.Hour})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /loki/api/v1/labels", h.Labels)
+	mux.HandleFunc("GET /loki/api/v1/label/{name}/values", h.LabelValues)
+	mux.HandleFunc("GET /loki/api/v1/query_range", h.QueryRange)
+	mux.HandleFunc("GET /loki/api/v1/query", h.Query)
+	return mux
+}
+
+func lokiRequest(mux http.Handler, path, tenant string, params url.Values) *httptest.ResponseRecorder {
+	if params.Get("start") == "" {
+		params.Set("start", strconv.FormatInt(lokiBase.UnixNano(), 10))
+		params.Set("end", strconv.FormatInt(lokiBase.Add(time.Hour).Unix(), 10))
+	}
+	req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+type lokiQueryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func TestLokiHandler_QueryRange(t *testing.T) {
+	mux := newLokiMux()
+
+	w := lokiRequest(mux, "/loki/api/v1/query_range", "acme", url.Values{"query": {`{level="error"} |= "timeout"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp lokiQueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "success" || resp.Data.ResultType != "streams" || len(resp.Data.Result) != 2 {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+
+	// Backward by default: the newest line's stream comes first
+	first, second := resp.Data.Result[0], resp.Data.Result[1]
+	if first.Stream["source"] != "api" || first.Stream["level"] != "error" || first.Values[0][1] != "request timeout" {
+		t.Errorf("unexpected first stream %+v", first)
+	}
+	if first.Values[0][0] != strconv.FormatInt(lokiBase.Add(3*time.Minute).UnixNano(), 10) {
+		t.Errorf("unexpected timestamp %s", first.Values[0][0])
+	}
+	if second.Stream["source"] != "worker" || second.Values[0][1] != "job timeout" {
+		t.Errorf("unexpected second stream %+v", second)
+	}
+}
+
+func TestLokiHandler_QueryRangeLimitAndDirection(t *testing.T) {
+	mux := newLokiMux()
+
+	// The tenant can be matched in the selector instead of the header
+	params := url.Values{"query": {`{tenant="acme", source="api"}`}, "limit": {"2"}, "direction": {"forward"}}
+	w := lokiRequest(mux, "/loki/api/v1/query_range", "", params)
+	var resp lokiQueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+
+	var lines []string
+	for _, stream := range resp.Data.Result {
+		for _, v := range stream.Values {
+			lines = append(lines, v[1])
+		}
+	}
+	if len(lines) != 2 || lines[0] != "started" || lines[1] != "request timeout" {
+		t.Errorf("expected the two oldest api lines, got %v", lines)
+	}
+}
+
+func TestLokiHandler_Labels(t *testing.T) {
+	mux := newLokiMux()
+
+	w := lokiRequest(mux, "/loki/api/v1/labels", "acme", url.Values{})
+	if w.Body.String() != `{"status":"success","data":["level","source"]}`+"\n" {
+		t.Errorf("unexpected labels %s", w.Body.String())
+	}
+
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	w = lokiRequest(mux, "/loki/api/v1/label/source/values", "acme", url.Values{})
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 2 || resp.Data[0] != "api" || resp.Data[1] != "worker" {
+		t.Errorf("unexpected source values %s", w.Body.String())
+	}
+
+	w = lokiRequest(mux, "/loki/api/v1/label/level/values", "acme", url.Values{"query": {`{source="worker"}`}})
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 1 || resp.Data[0] != "error" {
+		t.Errorf("unexpected level values %s", w.Body.String())
+	}
+}
+
+func TestLokiHandler_Errors(t *testing.T) {
+	mux := newLokiMux()
+	query := `{source="api"}`
+
+	tests := []struct {
+		name   string
+		path   string
+		tenant string
+		params url.Values
+	}{
+		{"no tenant", "/loki/api/v1/query_range", "", url.Values{"query": {query}}},
+		{"tenant mismatch", "/loki/api/v1/query_range", "acme", url.Values{"query": {`{tenant="globex"}`}}},
+		{"metric query", "/loki/api/v1/query_range", "acme", url.Values{"query": {`rate({source="api"}[1m])`}}},
+		{"parser stage", "/loki/api/v1/query_range", "acme", url.Values{"query": {query + ` | json`}}},
+		{"limit over max", "/loki/api/v1/query_range", "acme", url.Values{"query": {query}, "limit": {"11"}}},
+		{"bad direction", "/loki/api/v1/query_range", "acme", url.Values{"query": {query}, "direction": {"sideways"}}},
+		{"range over max", "/loki/api/v1/query_range", "acme", url.Values{"query": {query}, "start": {"0"}, "end": {"172800"}}},
+		{"bad start", "/loki/api/v1/query_range", "acme", url.Values{"query": {query}, "start": {"yesterday"}}},
+		{"instant query", "/loki/api/v1/query", "acme", url.Values{"query": {query}}},
+		{"bad selector", "/loki/api/v1/label/level/values", "acme", url.Values{"query": {"{"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := lokiRequest(mux, tt.path, tt.tenant, tt.params); w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// countingSource counts the scans of a source
+type countingSource struct {
+	lokiSource
+	scans int
+}
+
+func (s *countingSource) Scan(ctx context.Context, tenantID string, from, to time.Time, fn func(*models.LogEvent) error) error {
+	s.scans++
+	return s.lokiSource.Scan(ctx, tenantID, from, to, fn)
+}
+
+func TestLokiHandler_CachesResults(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{TTL: time.Minute, Bucket: time.Minute})
+
+	source := &countingSource{lokiSource: lokiSource{events: []*models.LogEvent{
+		{ID: "1", TenantID: "acme", Timestamp: lokiBase.Add(time.Minute), Severity: models.SeverityError, Source: "api", Message: "request timeout"},
+	}}}
+	h := handlers.NewLokiHandler(source, handlers.LokiConfig{MaxLimit: 10, Cache: cache})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /loki/api/v1/query_range", h.QueryRange)
+	mux.HandleFunc("GET /loki/api/v1/label/{name}/values", h.LabelValues)
+
+	query := func(selector string, end time.Time) string {
+		params := url.Values{
+			"query": {selector},
+			"start": {strconv.FormatInt(lokiBase.UnixNano(), 10)},
+			"end":   {strconv.FormatInt(end.UnixNano(), 10)},
+		}
+		w := lokiRequest(mux, "/loki/api/v1/query_range", "acme", params)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// The same query, spelled differently and ending a moment later, is
+	// served from the cache
+	end := lokiBase.Add(time.Hour)
+	first := query(`{source="api", level="error"}`, end)
+	second := query(`{level="error",source="api"}`, end.Add(time.Second))
+	if source.scans != 1 || first != second {
+		t.Fatalf("expected 1 scan and equal results, got %d scans:\n%s\n%s", source.scans, first, second)
+	}
+
+	// Other queries and ranges are scanned
+	query(`{source="api"}`, end)
+	query(`{source="api", level="error"}`, end.Add(time.Hour))
+	w := lokiRequest(mux, "/loki/api/v1/label/source/values", "acme", url.Values{})
+	if w.Code != http.StatusOK || source.scans != 4 {
+		t.Fatalf("expected 4 scans, got %d (%d: %s)", source.scans, w.Code, w.Body.String())
+	}
+
+	// Invalidating the tenant drops its cached results
+	if err := cache.Invalidate(context.Background(), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	query(`{source="api", level="error"}`, end)
+	if source.scans != 5 {
+		t.Errorf("expected a scan after invalidation, got %d scans", source.scans)
+	}
+}
+
+func TestLokiHandler_Count(t *testing.T) {
+	source := &lokiSource{events: []*models.LogEvent{
+		{ID: "1", TenantID: "acme", Timestamp: lokiBase.Add(time.Minute), Severity: models.SeverityError, Source: "api", Message: "request timeout"},
+		{ID: "2", TenantID: "acme", Timestamp: lokiBase.Add(2 * time.Minute), Severity: models.SeverityError, Source: "api", Message: "job timeout"},
+		{ID: "3", TenantID: "acme", Timestamp: lokiBase.Add(time.Hour), Severity: models.SeverityError, Source: "api", Message: "late timeout"},
+		{ID: "4", TenantID: "globex", Timestamp: lokiBase.Add(time.Minute), Severity: models.SeverityError, Source: "api", Message: "other timeout"},
+	}}
+	h := handlers.NewLokiHandler(source, handlers.LokiConfig{})
+	ctx := context.Background()
+
+	count, err := h.Count(ctx, "acme", `{tenant="acme", source="api"} |= "timeout"`, lokiBase, lokiBase.Add(time.Hour))
+	if err != nil || count != 2 {
+		t.Errorf("Count = %d, %v; want 2", count, err)
+	}
+	if _, err := h.Count(ctx, "acme", `{tenant="globex"}`, lokiBase, lokiBase.Add(time.Hour)); err == nil {
+		t.Error("expected error for a query matching another tenant")
+	}
+}
@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/memguard"
+	"parsec/pkg/models"
+)
+
+type noopShedder struct{}
+
+func (noopShedder) ShrinkQueue(bool) {}
+func (noopShedder) Flush()           {}
+
+func TestIngestHandler_ShedsDebugUnderMemoryPressure(t *testing.T) {
+	var used atomic.Uint64
+	memory, err := memguard.New(memguard.Config{
+		Limit:       100,
+		ShrinkQueue: 0.8,
+		RejectDebug: 0.9,
+		Flush:       0.95,
+		Usage:       used.Load,
+	}, noopShedder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	used.Store(92)
+	memory.Check()
+
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Memory:       memory,
+	})
+
+	body := `{"events": [
+		{"id": "evt-1", "tenant_id": "tenant-1", "timestamp": "2024-01-15T10:30:00Z", "severity": "debug", "source": "api", "message": "verbose"},
+		{"id": "evt-2", "tenant_id": "tenant-1", "timestamp": "2024-01-15T10:30:00Z", "severity": "error", "source": "api", "message": "failed"}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Accepted != 1 || resp.Rejected != 1 {
+		t.Fatalf("expected the debug event to be shed, got %+v", resp)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].EventID != "evt-1" || resp.Errors[0].Error != handlers.ErrMemoryPressure.Error() {
+		t.Errorf("unexpected errors %+v", resp.Errors)
+	}
+	if len(ch) != 1 || (<-ch).Event.ID != "evt-2" {
+		t.Error("expected only the error event to be queued")
+	}
+
+	// Once memory recovers, debug events are accepted again
+	used.Store(50)
+	memory.Check()
+	event := &models.LogEvent{ID: "evt-3", TenantID: "tenant-1", Timestamp: time.Now(), Severity: models.SeverityDebug, Source: "api", Message: "verbose"}
+	if err := handler.Submit(req.Context(), event); err != nil {
+		t.Errorf("expected the debug event to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+const negotiateEvent = `{"id":"evt-1","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api","message":"ok"}`
+
+const negotiateInvalid = `{"id":"evt-2","tenant_id":"tenant-1","timestamp":"2024-01-15T10:30:00Z","severity":"INFO","source":"api"}`
+
+func negotiatePost(t *testing.T, target, body string, header http.Header) (*httptest.ResponseRecorder, chan *models.Envelope) {
+	t.Helper()
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w, ch
+}
+
+func TestIngestHandler_MsgpackResponse(t *testing.T) {
+	w, _ := negotiatePost(t, "/ingest", negotiateEvent, http.Header{"Accept": {"application/msgpack"}})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/msgpack" {
+		t.Fatalf("got %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	want := []byte{0x83, 0xa7}
+	want = append(want, "success"...)
+	want = append(want, 0xc3, 0xa8)
+	want = append(want, "accepted"...)
+	want = append(want, 0x01, 0xa8)
+	want = append(want, "rejected"...)
+	want = append(want, 0x00)
+	if !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("body = %x, want %x", w.Body.Bytes(), want)
+	}
+}
+
+func TestIngestHandler_ProtobufResponse(t *testing.T) {
+	w, _ := negotiatePost(t, "/ingest", `[`+negotiateEvent+`,`+negotiateInvalid+`]`,
+		http.Header{"Accept": {"application/json;q=0.5, application/x-protobuf"}})
+	if w.Code != http.StatusMultiStatus || w.Header().Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("got %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	fields := map[protowire.Number]uint64{}
+	var errorMsg []byte
+	b := w.Body.Bytes()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %x", w.Body.Bytes())
+		}
+		b = b[n:]
+		if typ == protowire.BytesType {
+			errorMsg, n = protowire.ConsumeBytes(b)
+		} else {
+			fields[num], n = protowire.ConsumeVarint(b)
+		}
+		if n < 0 {
+			t.Fatalf("bad field %d: %x", num, w.Body.Bytes())
+		}
+		b = b[n:]
+	}
+
+	if fields[1] != 0 || fields[2] != 1 || fields[3] != 1 {
+		t.Errorf("unexpected counts %v", fields)
+	}
+	// The error message carries index 1 and the event ID
+	if !bytes.Contains(errorMsg, []byte("evt-2")) || errorMsg[0] != 0x08 || errorMsg[1] != 0x01 {
+		t.Errorf("unexpected error message %x", errorMsg)
+	}
+}
+
+func TestIngestHandler_CompactResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		target string
+		header http.Header
+	}{
+		"prefer header": {"/ingest", http.Header{"Prefer": {"respond-async, return=minimal"}}},
+		"query":         {"/ingest?compact=true", nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w, _ := negotiatePost(t, tc.target, `[`+negotiateEvent+`,`+negotiateInvalid+`]`, tc.header)
+
+			var resp handlers.IngestResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if w.Code != http.StatusMultiStatus || resp.Accepted != 1 || resp.Rejected != 1 || resp.Errors != nil {
+				t.Errorf("expected counts only, got %d: %s", w.Code, w.Body.String())
+			}
+			if w.Header().Get("Preference-Applied") != "return=minimal" {
+				t.Error("expected Preference-Applied to be set")
+			}
+		})
+	}
+}
+
+func TestIngestHandler_NotAcceptable(t *testing.T) {
+	w, ch := negotiatePost(t, "/ingest", negotiateEvent, http.Header{"Accept": {"text/html, application/msgpack;q=0"}})
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406, got %d", w.Code)
+	}
+	if len(ch) != 0 {
+		t.Error("expected the event not to be ingested")
+	}
+}
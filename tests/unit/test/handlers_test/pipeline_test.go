@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/pkg/models"
+)
+
+func TestPipelineHandler_DescribesStages(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Topic:        "log-events",
+	})
+
+	body := `[
+        {"id": "evt-1", "tenant_id": "tenant-1", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "ok"},
+        {"id": "evt-2", "tenant_id": "tenant-1", "timestamp": "2024-01-15T10:30:00Z", "severity": "bogus", "source": "api", "message": "bad"}
+    ]`
+	ingest.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body)))
+
+	// Dry runs must not count towards stage statistics
+	handlers.NewDryRunHandler(ingest).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/ingest/dry-run", bytes.NewBufferString(body)))
+
+	w := httptest.NewRecorder()
+	handlers.NewPipelineHandler(ingest).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/pipeline", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp handlers.PipelineResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp.NodeID != "test-node" || resp.ConfigHash == "" {
+		t.Errorf("unexpected node info: %+v", resp)
+	}
+
+	want := []string{"normalize", "preset", "truncate", "validate", "route", "publish"}
+	if len(resp.Stages) != len(want) {
+		t.Fatalf("expected stages %v, got %+v", want, resp.Stages)
+	}
+	stages := make(map[string]handlers.PipelineStage)
+	for i, stage := range resp.Stages {
+		if stage.Name != want[i] {
+			t.Errorf("stage %d: expected %s, got %s", i, want[i], stage.Name)
+		}
+		stages[stage.Name] = stage
+	}
+
+	if s := stages["normalize"]; s.Next != "preset" || s.Stats.Processed != 2 {
+		t.Errorf("unexpected normalize stage: %+v", s)
+	}
+	if s := stages["validate"]; s.Stats.Processed != 2 || s.Stats.Errors != 1 {
+		t.Errorf("unexpected validate stats: %+v", s.Stats)
+	}
+	if s := stages["publish"]; s.Stats.Processed != 1 || s.Next != "" || s.ConfigHash == "" {
+		t.Errorf("unexpected publish stage: %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.NewPipelineHandler(ingest).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/pipeline", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
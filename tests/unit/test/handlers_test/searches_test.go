@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/api"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+// staticCounter counts every query the same
+type staticCounter int
+
+func (c staticCounter) Count(ctx context.Context, tenantID, query string, from, to time.Time) (int, error) {
+	return int(c), nil
+}
+
+func TestSearchHandler(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	monitor := alerts.NewSearchMonitor(store, alerts.NewNoopEngine(), staticCounter(4))
+
+	mux := http.NewServeMux()
+	h := handlers.NewSearchHandler(monitor)
+	mux.Handle("/searches/{tenant}", h)
+	mux.Handle("/searches/{tenant}/{name}", h)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, "/searches/acme/timeouts", `{"query":"{source=\"api\"} |= \"timeout\"","every":"10s"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a short interval, got %d", w.Code)
+	}
+	w := do(http.MethodPut, "/searches/acme/timeouts", `{"query":"{source=\"api\"} |= \"timeout\"","every":"5m","threshold":3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	alerted := 0
+	if err := monitor.Check(context.Background(), time.Now(), func(*models.LogEvent) { alerted++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	w = do(http.MethodGet, "/searches/acme", "")
+	var list handlers.SearchList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if alerted != 1 || len(list.Searches) != 1 || !list.Searches[0].Firing || *list.Searches[0].LastCount != 4 {
+		t.Errorf("expected a firing search counting 4, got %d alerts and %s", alerted, w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/searches/acme/timeouts", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/searches/acme/timeouts", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/sentry"
+	"parsec/pkg/models"
+)
+
+const sentryEnvelope = `{"event_id":"fc6d8c0c43fc4630ad850ee518f1b9d0","sent_at":"2024-06-10T06:13:20Z"}
+{"type":"event"}
+{"event_id":"fc6d8c0c43fc4630ad850ee518f1b9d0","level":"warning","logger":"checkout","message":"cart is empty","tags":{"region":"eu"}}
+{"type":"session"}
+{"status":"ok"}
+{"type":"log","item_count":1}
+{"items":[{"level":"info","body":"checkout started"}]}
+`
+
+func newSentryHandler() (http.Handler, chan *models.Envelope) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	return handlers.NewSentryHandler(ingest, map[string]sentry.Project{"42": {Tenant: "web", Key: "pubkey"}}), ch
+}
+
+func postSentry(handler http.Handler, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("/api/{project}/envelope/", handler)
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestSentryHandler_Envelope(t *testing.T) {
+	handler, ch := newSentryHandler()
+
+	w := postSentry(handler, "/api/42/envelope/", []byte(sentryEnvelope), http.Header{
+		"X-Sentry-Auth": {"Sentry sentry_version=7, sentry_key=pubkey, sentry_client=sentry.python/2.1.0"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	event := (<-ch).Event
+	if event.TenantID != "web" || event.Source != "checkout" || event.Severity != models.SeverityWarning || event.Message != "cart is empty" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if tags, _ := event.Metadata["tags"].(map[string]any); tags["region"] != "eu" {
+		t.Errorf("unexpected tags: %v", event.Metadata["tags"])
+	}
+
+	record := (<-ch).Event
+	if record.Message != "checkout started" || record.Severity != models.SeverityInfo || record.Source != sentry.Source {
+		t.Errorf("unexpected log record: %+v", record)
+	}
+	select {
+	case extra := <-ch:
+		t.Errorf("expected the session to be dropped, got %+v", extra.Event)
+	default:
+	}
+}
+
+func TestSentryHandler_KeyFromQueryAndGzip(t *testing.T) {
+	handler, ch := newSentryHandler()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(sentryEnvelope))
+	gz.Close()
+
+	w := postSentry(handler, "/api/42/envelope/?sentry_key=pubkey&sentry_version=7", buf.Bytes(), http.Header{
+		"Content-Encoding": {"gzip"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if event := (<-ch).Event; event.Message != "cart is empty" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestSentryHandler_Rejects(t *testing.T) {
+	handler, _ := newSentryHandler()
+	auth := http.Header{"X-Sentry-Auth": {"Sentry sentry_key=pubkey"}}
+
+	if w := postSentry(handler, "/api/7/envelope/", []byte(sentryEnvelope), auth); w.Code != http.StatusNotFound {
+		t.Errorf("unknown project: expected 404, got %d", w.Code)
+	}
+	if w := postSentry(handler, "/api/42/envelope/", []byte(sentryEnvelope), http.Header{"X-Sentry-Auth": {"Sentry sentry_key=wrong"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong key: expected 401, got %d", w.Code)
+	}
+	if w := postSentry(handler, "/api/42/envelope/", []byte(sentryEnvelope), nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("no key: expected 401, got %d", w.Code)
+	}
+	if w := postSentry(handler, "/api/42/envelope/", []byte("{}\n{\"type\":\"event\"}\nnot json\n"), auth); w.Code != http.StatusBadRequest {
+		t.Errorf("bad event: expected 400, got %d", w.Code)
+	}
+	if w := postSentry(handler, "/api/42/envelope/", []byte(sentryEnvelope), http.Header{
+		"X-Sentry-Auth": {"Sentry sentry_key=pubkey"}, "Content-Encoding": {"br"},
+	}); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported encoding: expected 400, got %d", w.Code)
+	}
+}
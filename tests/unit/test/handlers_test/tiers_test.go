@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/api"
+	"parsec/internal/routing"
+	"parsec/internal/state"
+	"parsec/internal/tiers"
+	"parsec/pkg/models"
+)
+
+func TestIngestHandler_TenantTiers(t *testing.T) {
+	registry, err := tiers.NewRegistry(nil, tiers.Config{
+		Policies:    map[tiers.Tier]tiers.Policy{tiers.Bronze: {EventsPerSecond: 1, Priority: routing.PriorityLow, Acks: tiers.AcksLeader}},
+		Assignments: map[string]tiers.Tier{"acme": tiers.Bronze, "initech": tiers.Gold},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := routing.NewEngine(nil)
+	router.SetDefaults(registry.Rules)
+
+	ch := make(chan *models.Envelope, 10)
+	handler := handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		Router:       router,
+		Tiers:        registry,
+	})
+
+	body := `[
+        {"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "first"},
+        {"id": "evt-2", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "over the rate"},
+        {"id": "evt-3", "tenant_id": "initech", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "gold"}
+    ]`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewBufferString(body)))
+
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 1 || len(resp.Errors) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Errors[0].EventID != "evt-2" || resp.Errors[0].Code != "tenant_rate_limited" {
+		t.Errorf("unexpected error %+v", resp.Errors[0])
+	}
+
+	bronze, gold := <-ch, <-ch
+	if bronze.Priority != routing.PriorityLow || bronze.Acks != tiers.AcksLeader {
+		t.Errorf("bronze envelope priority %q acks %q", bronze.Priority, bronze.Acks)
+	}
+	if gold.Priority != routing.PriorityHigh || gold.Acks != tiers.AcksAll {
+		t.Errorf("gold envelope priority %q acks %q", gold.Priority, gold.Acks)
+	}
+}
+
+func TestTiersHandler(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	registry, err := tiers.NewRegistry(store, tiers.Config{Assignments: map[string]tiers.Tier{"initech": tiers.Gold}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	h := handlers.NewTiersHandler(registry)
+	mux.Handle("/admin/tiers", h)
+	mux.Handle("/admin/tenants/{tenant}/tier", h)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodPut, "/admin/tenants/acme/tier", `{"tier":"platinum"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown tier, got %d", w.Code)
+	}
+	w := do(http.MethodPut, "/admin/tenants/acme/tier", `{"tier":"silver"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status handlers.TierStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if status.Tier != tiers.Silver || status.Policy == nil || status.Assignment == nil || status.Assignment.Static {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	var list handlers.TierList
+	if err := json.Unmarshal(do(http.MethodGet, "/admin/tiers", "").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Policies) != 3 || len(list.Tenants) != 2 || list.Tenants[0].TenantID != "acme" || !list.Tenants[1].Static {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	if w := do(http.MethodDelete, "/admin/tenants/acme/tier", ""); w.Code != http.StatusOK {
+		t.Errorf("expected 200 removing the assignment, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/admin/tenants/acme/tier", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 removing it twice, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/admin/tenants/initech/tier", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 removing a configured tier, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/admin/tiers", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/api"
+	"parsec/internal/slo"
+	"parsec/internal/state"
+	"parsec/internal/ui"
+	"parsec/pkg/models"
+)
+
+func newUIMux(t *testing.T, feed *ui.Feed) *http.ServeMux {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+	heartbeats := alerts.NewHeartbeatMonitor(store, alerts.NewNoopEngine())
+	if _, err := heartbeats.Register(context.Background(), alerts.Heartbeat{TenantID: "acme", Source: "cron", Interval: "5m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlers.NewUIHandler(feed, heartbeats, slo.NewTracker(slo.Config{}))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ui/api/tail", h.Tail)
+	mux.HandleFunc("GET /ui/api/errors", h.Errors)
+	mux.HandleFunc("GET /ui/api/alerts", h.Alerts)
+	return mux
+}
+
+func uiEvent(id, tenant string, severity models.Severity) *models.LogEvent {
+	return &models.LogEvent{ID: id, TenantID: tenant, Timestamp: time.Now(), Severity: severity, Source: "api", Message: "message " + id}
+}
+
+func TestUIHandler_Tail(t *testing.T) {
+	feed := ui.NewFeed(ui.FeedConfig{})
+	feed.Observe(uiEvent("1", "acme", models.SeverityInfo))
+	feed.Observe(uiEvent("2", "globex", models.SeverityInfo))
+
+	server := httptest.NewServer(newUIMux(t, feed))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/ui/api/tail?tenant=acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+	next := func() ui.Entry {
+		t.Helper()
+		select {
+		case line := <-lines:
+			var e ui.Entry
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatal(err)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event streamed")
+		}
+		return ui.Entry{}
+	}
+
+	// The backlog first, then events as they are observed
+	if e := next(); e.ID != "1" {
+		t.Errorf("expected backlog event 1, got %+v", e)
+	}
+	feed.Observe(uiEvent("3", "globex", models.SeverityInfo))
+	feed.Observe(uiEvent("4", "acme", models.SeverityError))
+	if e := next(); e.ID != "4" || e.Severity != models.SeverityError || e.Message != "message 4" {
+		t.Errorf("expected live event 4, got %+v", e)
+	}
+}
+
+func TestUIHandler_ErrorsAndAlerts(t *testing.T) {
+	feed := ui.NewFeed(ui.FeedConfig{})
+	feed.Observe(uiEvent("1", "acme", models.SeverityError))
+	mux := newUIMux(t, feed)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/api/errors", nil))
+	var errs struct {
+		Tenants []ui.TenantErrors `json:"tenants"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &errs); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs.Tenants) != 1 || errs.Tenants[0].TenantID != "acme" || errs.Tenants[0].Recent[0].ID != "1" {
+		t.Errorf("unexpected errors %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/api/alerts", nil))
+	var state handlers.AlertState
+	if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Objectives) == 0 || len(state.Heartbeats) != 1 || state.Heartbeats[0].Source != "cron" {
+		t.Errorf("unexpected alert state %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/api/tail?backlog=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative backlog: expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/state"
+	"parsec/internal/uploads"
+	"parsec/pkg/models"
+)
+
+func newUploadsMux(t *testing.T, ch chan *models.Envelope, maxChunk int64) *http.ServeMux {
+	t.Helper()
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+
+	manager, err := uploads.NewManager(store, ingest.IngestLines, uploads.Config{Dir: t.TempDir(), NodeID: "test-node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.Close)
+
+	h := handlers.NewUploadsHandler(manager, maxChunk)
+	mux := http.NewServeMux()
+	mux.Handle("/uploads", h)
+	mux.Handle("/uploads/{id}", h)
+	mux.Handle("/uploads/{id}/commit", h)
+	return mux
+}
+
+func uploadRequest(mux http.Handler, method, path, offset, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if offset != "" {
+		req.Header.Set("Upload-Offset", offset)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func decodeUpload(t *testing.T, w *httptest.ResponseRecorder) uploads.Upload {
+	t.Helper()
+	var u uploads.Upload
+	if err := json.Unmarshal(w.Body.Bytes(), &u); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return u
+}
+
+func TestUploadsHandler_ResumableUpload(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	mux := newUploadsMux(t, ch, 0)
+
+	w := uploadRequest(mux, http.MethodPost, "/uploads", "", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	id := decodeUpload(t, w).ID
+	if w.Header().Get("Location") != "/uploads/"+id {
+		t.Errorf("location = %q", w.Header().Get("Location"))
+	}
+
+	first := `{"id": "evt-1", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "one"}` + "\n"
+	offset := strconv.Itoa(len(first))
+	w = uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "0", first)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != offset {
+		t.Fatalf("append: %d offset %s: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+
+	// A chunk sent again after a lost response is refused with the offset
+	w = uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "0", first)
+	if w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != offset {
+		t.Fatalf("expected 409 with offset %s, got %d offset %s", offset, w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// An envelope, a line that isn't JSON and an invalid event
+	rest := `{"event": {"id": "evt-2", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "two"}}` + "\n" +
+		"not json\n" +
+		`{"id": "evt-3", "tenant_id": "acme", "timestamp": "yesterday", "severity": "INFO", "source": "api", "message": "three"}` + "\n"
+	w = uploadRequest(mux, http.MethodPatch, "/uploads/"+id, offset, rest)
+	if w.Code != http.StatusOK {
+		t.Fatalf("append: %d: %s", w.Code, w.Body.String())
+	}
+
+	w = uploadRequest(mux, http.MethodPost, "/uploads/"+id+"/commit", "", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var u uploads.Upload
+	deadline := time.Now().Add(5 * time.Second)
+	for !u.Finished() {
+		if time.Now().After(deadline) {
+			t.Fatalf("upload still %s", u.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+		u = decodeUpload(t, uploadRequest(mux, http.MethodGet, "/uploads/"+id, "", ""))
+	}
+
+	if u.Status != uploads.StatusCompleted || u.Lines != 4 || u.Accepted != 2 || u.Rejected != 2 {
+		t.Fatalf("unexpected upload %+v", u)
+	}
+	if len(u.Errors) != 2 || u.Errors[0].Line != 3 || u.Errors[1].Line != 4 || u.Errors[1].EventID != "evt-3" {
+		t.Errorf("unexpected errors %+v", u.Errors)
+	}
+	if len(ch) != 2 {
+		t.Fatalf("expected 2 events queued, got %d", len(ch))
+	}
+	if env := <-ch; env.Event.ID != "evt-1" || !strings.HasPrefix(env.BatchID, id+"-") {
+		t.Errorf("unexpected envelope %s in batch %s", env.Event.ID, env.BatchID)
+	}
+
+	// Finished uploads take no more chunks
+	w = uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "0", "x")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestUploadsHandler_Errors(t *testing.T) {
+	mux := newUploadsMux(t, make(chan *models.Envelope, 10), 8)
+
+	if w := uploadRequest(mux, http.MethodGet, "/uploads/missing", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing upload: expected 404, got %d", w.Code)
+	}
+	if w := uploadRequest(mux, http.MethodPost, "/uploads", "", "{"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad create body: expected 400, got %d", w.Code)
+	}
+
+	id := decodeUpload(t, uploadRequest(mux, http.MethodPost, "/uploads", "", `{"size": 4}`)).ID
+	if w := uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "", "x"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing offset: expected 400, got %d", w.Code)
+	}
+	if w := uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "0", "123456789"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunk over the limit: expected 413, got %d", w.Code)
+	}
+	if w := uploadRequest(mux, http.MethodPatch, "/uploads/"+id, "0", "12345"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunk past the declared size: expected 413, got %d", w.Code)
+	}
+	if w := uploadRequest(mux, http.MethodPost, "/uploads/"+id+"/commit", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("empty commit: expected 400, got %d", w.Code)
+	}
+	if w := uploadRequest(mux, http.MethodGet, "/uploads/"+id+"/commit", "", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET commit: expected 405, got %d", w.Code)
+	}
+
+	w := uploadRequest(mux, http.MethodDelete, "/uploads/"+id, "", "")
+	if w.Code != http.StatusOK || decodeUpload(t, w).Status != uploads.StatusAborted {
+		t.Errorf("abort: %d %s", w.Code, w.Body.String())
+	}
+	if w := uploadRequest(mux, http.MethodDelete, "/uploads/"+id, "", ""); w.Code != http.StatusConflict {
+		t.Errorf("second abort: expected 409, got %d", w.Code)
+	}
+}
+
+func TestIngestHandler_IngestLinesWaitsForRoom(t *testing.T) {
+	ch := make(chan *models.Envelope, 1)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+
+	lines := make([][]byte, 3)
+	for i := range lines {
+		lines[i] = []byte(`{"id": "evt-` + string(rune('1'+i)) + `", "tenant_id": "acme", "timestamp": "2024-01-15T10:30:00Z", "severity": "INFO", "source": "api", "message": "m"}`)
+	}
+
+	done := make(chan uploads.Result)
+	go func() { done <- ingest.IngestLines(context.Background(), "upload-1", lines) }()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of 3 events", i)
+		}
+	}
+	if result := <-done; result.Accepted != 3 || result.Rejected != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
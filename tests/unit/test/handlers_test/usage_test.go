@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/jobs"
+	"parsec/internal/state"
+	"parsec/internal/usage"
+)
+
+func TestUsageReportsHandler(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	scheduler := jobs.NewScheduler(store, jobs.Config{NodeID: "node-1"})
+	defer scheduler.Close()
+
+	mux := http.NewServeMux()
+	h := handlers.NewUsageReportsHandler(usage.NewReports(store, scheduler, usage.Config{}))
+	mux.Handle("/admin/usage-reports", h)
+	mux.Handle("/admin/usage-reports/{month}", h)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/admin/usage-reports/2024-13"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid month, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/admin/usage-reports/2024-06"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 before generating, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/admin/usage-reports/2024-06"); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := do(http.MethodGet, "/admin/usage-reports/2024-06")
+		if strings.Contains(w.Body.String(), `"status":"succeeded"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("report did not succeed: %s", w.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	w := do(http.MethodGet, "/admin/usage-reports/2024-06?format=csv")
+	if w.Header().Get("Content-Type") != "text/csv" || !strings.HasPrefix(w.Body.String(), "month,tenant_id,") {
+		t.Errorf("expected a CSV report, got %q", w.Body.String())
+	}
+	if w := do(http.MethodGet, "/admin/usage-reports"); !strings.Contains(w.Body.String(), `"month":"2024-06"`) {
+		t.Errorf("expected the report listed, got %s", w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/admin/usage-reports/2024-06"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/winevent"
+	"parsec/pkg/models"
+)
+
+const windowsEvents = `<Events>
+<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Microsoft-Windows-Security-Auditing" Guid="{54849625-5478-4994-a5ba-3e3b0328c30d}"/>
+    <EventID>4625</EventID>
+    <Level>0</Level>
+    <Task>12544</Task>
+    <Keywords>0x8010000000000000</Keywords>
+    <TimeCreated SystemTime="2024-01-15T10:30:00.1234567Z"/>
+    <EventRecordID>98231</EventRecordID>
+    <Correlation ActivityID="{0D3E1B7C-2A4F-4B8E-A6D5-0C7F1E2D3B4A}"/>
+    <Channel>Security</Channel>
+    <Computer>dc01.corp.local</Computer>
+    <Security/>
+  </System>
+  <EventData>
+    <Data Name="TargetUserName">alice</Data>
+    <Data Name="IpAddress">10.0.0.7</Data>
+  </EventData>
+  <RenderingInfo Culture="en-US">
+    <Message>An account failed to log on.</Message>
+  </RenderingInfo>
+</Event>
+<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Service Control Manager"/>
+    <EventID Qualifiers="49152">7034</EventID>
+    <Level>2</Level>
+    <TimeCreated SystemTime="2024-01-15T10:31:00Z"/>
+    <EventRecordID>5512</EventRecordID>
+    <Channel>System</Channel>
+    <Computer>web01.corp.local</Computer>
+  </System>
+  <EventData>
+    <Data>Print Spooler</Data>
+    <Data>1</Data>
+  </EventData>
+</Event>
+</Events>`
+
+func postWindows(t *testing.T, handler http.Handler, target string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestWindowsHandler_MapsEvents(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	handler := handlers.NewWindowsHandler(ingest, "system")
+
+	w := postWindows(t, handler, "/ingest/windows?tenant=corp", []byte(windowsEvents), false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp handlers.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Accepted != 2 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	logon := (<-ch).Event
+	if logon.TenantID != "corp" || logon.Source != "microsoft-windows-security-auditing" {
+		t.Errorf("unexpected tenant/source: %s %s", logon.TenantID, logon.Source)
+	}
+	if logon.Message != "An account failed to log on." || logon.Severity != models.SeverityWarning {
+		t.Errorf("expected an audit failure warning, got %s %q", logon.Severity, logon.Message)
+	}
+	if !logon.Timestamp.Equal(time.Date(2024, 1, 15, 10, 30, 0, 123456700, time.UTC)) {
+		t.Errorf("unexpected timestamp %s", logon.Timestamp)
+	}
+	for key, want := range map[string]string{
+		winevent.MetadataChannel:  "Security",
+		winevent.MetadataEventID:  "4625",
+		winevent.MetadataComputer: "dc01.corp.local",
+		winevent.MetadataRecordID: "98231",
+		"targetusername":          "alice",
+		"ipaddress":               "10.0.0.7",
+	} {
+		if logon.Metadata[key] != want {
+			t.Errorf("metadata %s = %q, want %q", key, logon.Metadata[key], want)
+		}
+	}
+
+	// Without rendering info the message is built from the event data
+	crash := (<-ch).Event
+	if crash.Severity != models.SeverityError || crash.Message != "event 7034 data_0=Print Spooler data_1=1" {
+		t.Errorf("unexpected unrendered event: %s %q", crash.Severity, crash.Message)
+	}
+	if crash.TenantID != "corp" || crash.Source != "service control manager" {
+		t.Errorf("unexpected tenant/source: %s %s", crash.TenantID, crash.Source)
+	}
+
+	// Forwarding the same events again keeps their IDs
+	postWindows(t, handler, "/ingest/windows?tenant=corp", []byte(windowsEvents), false)
+	if again := (<-ch).Event; again.ID != logon.ID {
+		t.Error("expected a stable ID for the same record")
+	}
+	<-ch
+}
+
+func TestWindowsHandler_DefaultTenantAndGzip(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	handler := handlers.NewWindowsHandler(ingest, "windows")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(windowsEvents))
+	gz.Close()
+
+	w := postWindows(t, handler, "/ingest/windows", buf.Bytes(), true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if event := (<-ch).Event; event.TenantID != "windows" {
+		t.Errorf("expected the default tenant, got %s", event.TenantID)
+	}
+}
+
+func TestWindowsHandler_RejectsBadBodies(t *testing.T) {
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: make(chan *models.Envelope, 1), NodeID: "test-node"})
+	handler := handlers.NewWindowsHandler(ingest, "system")
+
+	for _, body := range []string{"<Events></Events>", "<Event><System>", "not xml"} {
+		if w := postWindows(t, handler, "/ingest/windows", []byte(body), false); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/windows", bytes.NewBufferString(windowsEvents))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d", w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/httpserver"
+)
+
+// tag records the middleware a request passed through in a header
+func tag(name string) httpserver.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRouter_GroupsComposeMiddleware(t *testing.T) {
+	router := httpserver.NewRouter()
+	public := router.Group(tag("recovery"), tag("logging"))
+	admin := public.Group(tag("auth"))
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("tenant")))
+	})
+	public.Handle("/public", echo)
+	admin.Handle("GET /admin/tenants/{tenant}", echo)
+	router.Handle("/bare", echo)
+
+	for _, tc := range []struct {
+		method, path, trace, body string
+		status                    int
+	}{
+		{http.MethodGet, "/public", "recovery,logging", "", http.StatusOK},
+		{http.MethodGet, "/admin/tenants/acme", "recovery,logging,auth", "acme", http.StatusOK},
+		{http.MethodGet, "/bare", "", "", http.StatusOK},
+		{http.MethodPost, "/admin/tenants/acme", "", "", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, rec.Code, tc.status)
+		}
+		if trace := strings.Join(rec.Header().Values("X-Trace"), ","); trace != tc.trace {
+			t.Errorf("%s %s: middleware %q, want %q", tc.method, tc.path, trace, tc.trace)
+		}
+		if tc.status == http.StatusOK && rec.Body.String() != tc.body {
+			t.Errorf("%s %s: body %q, want %q", tc.method, tc.path, rec.Body.String(), tc.body)
+		}
+	}
+}
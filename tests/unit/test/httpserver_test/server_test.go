@@ -0,0 +1,227 @@
+package httpserver_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"parsec/internal/config"
+	"parsec/internal/httpserver"
+)
+
+// protoHandler answers with the request's protocol
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Proto)
+})
+
+func testConfig() config.HTTPConfig {
+	return config.HTTPConfig{
+		Addr:                 "127.0.0.1:0",
+		HTTP2:                true,
+		MaxConcurrentStreams: 16,
+		KeepAlives:           true,
+		IdleTimeout:          time.Minute,
+		ReadTimeout:          5 * time.Second,
+		WriteTimeout:         5 * time.Second,
+		TCPKeepAlive:         15 * time.Second,
+	}
+}
+
+// start serves cfg and returns the listen address
+func start(t *testing.T, cfg config.HTTPConfig) string {
+	t.Helper()
+	srv, err := httpserver.New(cfg, protoHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "parsec"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestServer_H2C(t *testing.T) {
+	cfg := testConfig()
+	cfg.H2C = true
+	addr := start(t, cfg)
+
+	// HTTP/2 with prior knowledge over plain TCP
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	if proto := get(t, client, "http://"+addr+"/"); proto != "HTTP/2.0" {
+		t.Errorf("h2c request served as %s", proto)
+	}
+
+	// HTTP/1.1 clients still work
+	if proto := get(t, http.DefaultClient, "http://"+addr+"/"); proto != "HTTP/1.1" {
+		t.Errorf("plain request served as %s", proto)
+	}
+}
+
+func TestServer_TLSNegotiatesHTTP2(t *testing.T) {
+	cfg := testConfig()
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeCert(t)
+	addr := start(t, cfg)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	if proto := get(t, client, "https://"+addr+"/"); proto != "HTTP/2.0" {
+		t.Errorf("TLS request served as %s", proto)
+	}
+}
+
+func TestServer_HTTP2Disabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.HTTP2 = false
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeCert(t)
+	addr := start(t, cfg)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	if proto := get(t, client, "https://"+addr+"/"); proto != "HTTP/1.1" {
+		t.Errorf("request served as %s with HTTP/2 disabled", proto)
+	}
+}
+
+func TestServer_KeepAlive(t *testing.T) {
+	for _, keepAlives := range []bool{true, false} {
+		cfg := testConfig()
+		cfg.KeepAlives = keepAlives
+		addr := start(t, cfg)
+
+		client := &http.Client{Transport: &http.Transport{}}
+		reused := false
+		for i := 0; i < 2; i++ {
+			trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+			req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, "http://"+addr+"/", nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if reused != keepAlives {
+			t.Errorf("keep-alives %v: second request reused connection = %v", keepAlives, reused)
+		}
+	}
+}
+
+func TestServer_RejectsCertWithoutKey(t *testing.T) {
+	cfg := testConfig()
+	cfg.TLSCertFile = "cert.pem"
+	if _, err := httpserver.New(cfg, protoHandler); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+}
+
+func TestServer_H2CShutdownClosesConnections(t *testing.T) {
+	cfg := testConfig()
+	cfg.H2C = true
+	srv, err := httpserver.New(cfg, protoHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	get(t, client, "http://"+ln.Addr().String()+"/")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if _, err := client.Get("http://" + ln.Addr().String() + "/"); err == nil {
+		t.Error("request succeeded after shutdown")
+	}
+}
@@ -0,0 +1,192 @@
+package importer_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/importer"
+	"parsec/internal/objstore"
+	"parsec/pkg/models"
+)
+
+// ingestServer runs the real ingest handler and returns its envelope queue
+func ingestServer(t *testing.T) (*httptest.Server, chan *models.Envelope) {
+	t.Helper()
+	ch := make(chan *models.Envelope, 100)
+	srv := httptest.NewServer(handlers.NewIngestHandler(handlers.IngestConfig{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func ndjson(ids ...string) []byte {
+	var b bytes.Buffer
+	for _, id := range ids {
+		fmt.Fprintf(&b, `{"id":%q,"tenant_id":"acme","timestamp":"2021-03-04T05:06:07Z","severity":"INFO","source":"legacy","message":"archived %s"}`+"\n", id, id)
+	}
+	return b.Bytes()
+}
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func drain(ch chan *models.Envelope) []*models.Envelope {
+	var out []*models.Envelope
+	for len(ch) > 0 {
+		out = append(out, <-ch)
+	}
+	return out
+}
+
+func TestImporter_NDJSONAndResume(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "2021-03-04.ndjson.gz"), gzipped(ndjson("a1", "a2", "a3")), 0o644)
+	os.WriteFile(filepath.Join(dir, "2021-03-05.ndjson"), ndjson("b1", "b2"), 0o644)
+
+	srv, ch := ingestServer(t)
+	cpPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp, err := importer.LoadCheckpoint(cpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imp := importer.New(importer.Config{Target: srv.URL, BatchSize: 2}, cp)
+	stats, err := imp.Run(context.Background(), objstore.NewDir(dir), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Records != 5 || stats.Accepted != 5 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	envelopes := drain(ch)
+	if len(envelopes) != 5 {
+		t.Fatalf("got %d envelopes", len(envelopes))
+	}
+	want := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, e := range envelopes {
+		if !e.Event.Timestamp.Equal(want) {
+			t.Errorf("event %s timestamp %s, want original %s", e.Event.ID, e.Event.Timestamp, want)
+		}
+	}
+
+	// A rerun with the same checkpoint has nothing left to do
+	cp, _ = importer.LoadCheckpoint(cpPath)
+	stats, err = importer.New(importer.Config{Target: srv.URL}, cp).Run(context.Background(), objstore.NewDir(dir), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Skipped != 2 || stats.Records != 0 || len(ch) != 0 {
+		t.Errorf("rerun re-imported: %+v", stats)
+	}
+}
+
+func TestImporter_ResumesPartialObject(t *testing.T) {
+	dir := t.TempDir()
+	data := ndjson("c1", "c2", "c3")
+	os.WriteFile(filepath.Join(dir, "c.ndjson"), data, 0o644)
+
+	cp, _ := importer.LoadCheckpoint("")
+	cp.Update("c.ndjson", importer.FileProgress{Size: int64(len(data)), Records: 2})
+
+	srv, ch := ingestServer(t)
+	if _, err := importer.New(importer.Config{Target: srv.URL}, cp).Run(context.Background(), objstore.NewDir(dir), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes := drain(ch)
+	if len(envelopes) != 1 || envelopes[0].Event.ID != "c3" {
+		t.Errorf("expected only c3 to be imported, got %d envelopes", len(envelopes))
+	}
+}
+
+// archivedRow is a Parquet row in the layout the old stack exported
+type archivedRow struct {
+	ID        string            `parquet:"id"`
+	TenantID  string            `parquet:"tenant_id"`
+	Timestamp time.Time         `parquet:"timestamp,timestamp(millisecond)"`
+	Severity  string            `parquet:"severity"`
+	Source    string            `parquet:"source"`
+	Message   string            `parquet:"message"`
+	Metadata  map[string]string `parquet:"metadata"`
+}
+
+func TestImporter_Parquet(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[archivedRow](&buf)
+	_, err := w.Write([]archivedRow{
+		{ID: "p1", TenantID: "acme", Timestamp: ts, Severity: "ERROR", Source: "billing", Message: "charge failed", Metadata: map[string]string{"region": "eu"}},
+		{ID: "p2", TenantID: "acme", Timestamp: ts, Severity: "INFO", Source: "billing", Message: "charge ok"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "events.parquet"), buf.Bytes(), 0o644)
+
+	srv, ch := ingestServer(t)
+	cp, _ := importer.LoadCheckpoint("")
+	stats, err := importer.New(importer.Config{Target: srv.URL}, cp).Run(context.Background(), objstore.NewDir(dir), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accepted != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	first := drain(ch)[0].Event
+	if first.ID != "p1" || !first.Timestamp.Equal(ts) || first.Metadata["region"] != "eu" {
+		t.Errorf("unexpected event: %+v", first)
+	}
+}
+
+func TestImporter_RetriesRateLimited(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "r.ndjson"), ndjson("r1"), 0o644)
+
+	ch := make(chan *models.Envelope, 10)
+	ingest := handlers.NewIngestHandler(handlers.IngestConfig{EnvelopeChan: ch, NodeID: "test-node"})
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		ingest.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cp, _ := importer.LoadCheckpoint("")
+	stats, err := importer.New(importer.Config{Target: srv.URL}, cp).Run(context.Background(), objstore.NewDir(dir), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || stats.Accepted != 1 {
+		t.Errorf("calls = %d, stats = %+v", calls.Load(), stats)
+	}
+}
@@ -0,0 +1,247 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"parsec/internal/jobs"
+	"parsec/internal/state"
+)
+
+func newScheduler(t *testing.T, store state.StateStore) *jobs.Scheduler {
+	t.Helper()
+	s := jobs.NewScheduler(store, jobs.Config{
+		NodeID:           "node-1",
+		ProgressInterval: time.Millisecond,
+		CancelPoll:       5 * time.Millisecond,
+	})
+	t.Cleanup(s.Close)
+	return s
+}
+
+func memoryStore(t *testing.T) state.StateStore {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// outcome collects the error a task finished with
+type outcome struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newOutcome() *outcome { return &outcome{done: make(chan struct{})} }
+
+func (o *outcome) finish(err error) {
+	o.once.Do(func() {
+		o.err = err
+		close(o.done)
+	})
+}
+
+func (o *outcome) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case <-o.done:
+		return o.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("task did not finish")
+		return nil
+	}
+}
+
+// blocking runs until its context is cancelled
+func blocking(id, kind string, o *outcome) jobs.Task {
+	return jobs.Task{
+		ID:   id,
+		Kind: kind,
+		Run: func(ctx context.Context, report func(jobs.Progress)) error {
+			report(jobs.Progress{Done: 1, Unit: "events"})
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Finish: o.finish,
+	}
+}
+
+// waitStatus polls a record until it has status
+func waitStatus(t *testing.T, s *jobs.Scheduler, id, status string) *jobs.Record {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec, err := s.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Status == status {
+			return rec
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatalf("job %s never reached %s", id, status)
+	return nil
+}
+
+func TestScheduler_RunsAndLists(t *testing.T) {
+	s := newScheduler(t, memoryStore(t))
+
+	for _, task := range []struct{ id, kind, tenant string }{
+		{"a", jobs.KindExport, "acme"},
+		{"b", jobs.KindErasure, "acme"},
+		{"c", jobs.KindExport, "other"},
+	} {
+		o := newOutcome()
+		rec, err := s.Submit(context.Background(), jobs.Task{
+			ID:       task.id,
+			Kind:     task.kind,
+			TenantID: task.tenant,
+			Run: func(ctx context.Context, report func(jobs.Progress)) error {
+				report(jobs.Progress{Done: 10, Total: 10, Unit: "events"})
+				return nil
+			},
+			Finish: o.finish,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Status != jobs.StatusPending {
+			t.Errorf("expected a pending record, got %+v", rec)
+		}
+		if err := o.wait(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := waitStatus(t, s, "c", jobs.StatusSucceeded)
+	if rec.Node != "node-1" || rec.Progress.Done != 10 || rec.StartedAt == nil || rec.CompletedAt == nil {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	all, err := s.List(context.Background(), jobs.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].ID != "c" || all[2].ID != "a" {
+		t.Errorf("expected newest first, got %+v", all)
+	}
+	exports, _ := s.List(context.Background(), jobs.Filter{Kind: jobs.KindExport, TenantID: "acme"})
+	if len(exports) != 1 || exports[0].ID != "a" {
+		t.Errorf("unexpected filtered list %+v", exports)
+	}
+	limited, _ := s.List(context.Background(), jobs.Filter{Limit: 2})
+	if len(limited) != 2 {
+		t.Errorf("expected 2 records, got %d", len(limited))
+	}
+}
+
+func TestScheduler_LimitsConcurrencyPerKind(t *testing.T) {
+	s := newScheduler(t, memoryStore(t))
+	s.SetLimit(jobs.KindReprocess, 2)
+
+	var active, peak atomic.Int32
+	release := make(chan struct{})
+	var outcomes []*outcome
+	for _, id := range []string{"1", "2", "3", "4"} {
+		o := newOutcome()
+		outcomes = append(outcomes, o)
+		_, err := s.Submit(context.Background(), jobs.Task{
+			ID:   id,
+			Kind: jobs.KindReprocess,
+			Run: func(ctx context.Context, report func(jobs.Progress)) error {
+				n := active.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				<-release
+				active.Add(-1)
+				return nil
+			},
+			Finish: o.finish,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for _, o := range outcomes {
+		o.wait(t)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("expected at most 2 jobs at once, saw %d", peak.Load())
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	store := memoryStore(t)
+	s := newScheduler(t, store)
+
+	o := newOutcome()
+	if _, err := s.Submit(context.Background(), blocking("running", jobs.KindExport, o)); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, "running", jobs.StatusRunning)
+
+	if _, err := s.Cancel(context.Background(), "running"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.wait(t); !errors.Is(err, jobs.ErrCancelled) {
+		t.Errorf("expected the task to finish with ErrCancelled, got %v", err)
+	}
+	rec := waitStatus(t, s, "running", jobs.StatusCancelled)
+	if rec.Progress.Done != 1 {
+		t.Errorf("expected the last progress to be kept, got %+v", rec.Progress)
+	}
+
+	if _, err := s.Cancel(context.Background(), "running"); !errors.Is(err, jobs.ErrJobFinished) {
+		t.Errorf("expected ErrJobFinished, got %v", err)
+	}
+	if _, err := s.Cancel(context.Background(), "missing"); !errors.Is(err, jobs.ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+
+	// A cancellation made on another node reaches the running one
+	o = newOutcome()
+	if _, err := s.Submit(context.Background(), blocking("remote", jobs.KindExport, o)); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, s, "remote", jobs.StatusRunning)
+	other := newScheduler(t, store)
+	if _, err := other.Cancel(context.Background(), "remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.wait(t); !errors.Is(err, jobs.ErrCancelled) {
+		t.Errorf("expected the remote cancellation to stop the task, got %v", err)
+	}
+}
+
+func TestScheduler_CloseFailsJobs(t *testing.T) {
+	store := memoryStore(t)
+	s := jobs.NewScheduler(store, jobs.Config{})
+
+	running, pending := newOutcome(), newOutcome()
+	s.Submit(context.Background(), blocking("running", jobs.KindErasure, running))
+	waitStatus(t, s, "running", jobs.StatusRunning)
+	s.Submit(context.Background(), blocking("pending", jobs.KindErasure, pending))
+
+	s.Close()
+	for _, o := range []*outcome{running, pending} {
+		if err := o.wait(t); err == nil || errors.Is(err, jobs.ErrCancelled) {
+			t.Errorf("expected shutdown to fail the job, got %v", err)
+		}
+	}
+	if rec, _ := s.Get(context.Background(), "pending"); rec.Status != jobs.StatusFailed || rec.StartedAt != nil {
+		t.Errorf("unexpected record %+v", rec)
+	}
+}
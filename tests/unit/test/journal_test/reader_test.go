@@ -0,0 +1,209 @@
+package journal_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/journal"
+	"parsec/pkg/models"
+)
+
+// entries is journalctl -o json output; the last MESSAGE is not UTF-8
+const entries = `{"__CURSOR":"s=1;i=1","__REALTIME_TIMESTAMP":"1700000000000000","MESSAGE":"nginx started","PRIORITY":"6","_SYSTEMD_UNIT":"nginx.service","_PID":"412","_HOSTNAME":"web-1","_TRANSPORT":"stdout"}
+{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1700000001000000","MESSAGE":"disk failing","PRIORITY":"2","SYSLOG_IDENTIFIER":"kernel"}
+not json
+{"__CURSOR":"s=1;i=3","__REALTIME_TIMESTAMP":"1700000002000000","MESSAGE":[104,105,255],"PRIORITY":"4","_SYSTEMD_UNIT":"cron.service"}
+`
+
+// fakeJournalctl writes a script that records its arguments, prints the
+// entries and then follows forever
+func fakeJournalctl(t *testing.T, dir string) (path, argsFile string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, "entries.json"), []byte(entries), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	argsFile = filepath.Join(dir, "args")
+	path = filepath.Join(dir, "journalctl")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" >> " + argsFile + "\n" +
+		"cat " + filepath.Join(dir, "entries.json") + "\n" +
+		"exec sleep 60\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, argsFile
+}
+
+// sink records submitted events; the first queueFull submissions fail
+type sink struct {
+	mu        sync.Mutex
+	events    []*models.LogEvent
+	queueFull int
+}
+
+func (s *sink) Submit(_ context.Context, event *models.LogEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queueFull > 0 {
+		s.queueFull--
+		return handlers.ErrQueueFull
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *sink) wait(t *testing.T, n int) []*models.LogEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		if len(s.events) >= n {
+			events := append([]*models.LogEvent(nil), s.events...)
+			s.mu.Unlock()
+			return events
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d events", n)
+	return nil
+}
+
+func testConfig(dir, journalctl string) config.JournalConfig {
+	cfg := config.Default().Journal
+	cfg.Enabled = true
+	cfg.JournalctlPath = journalctl
+	cfg.CursorFile = filepath.Join(dir, "journal.cursor")
+	cfg.UnitTenants = "nginx.service=web"
+	cfg.Units = []string{"nginx.service", "cron.service"}
+	return cfg
+}
+
+func TestReader_ConvertsEntries(t *testing.T) {
+	dir := t.TempDir()
+	journalctl, _ := fakeJournalctl(t, dir)
+
+	s := &sink{queueFull: 2}
+	reader, err := journal.New(testConfig(dir, journalctl), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Start(context.Background())
+	defer reader.Close()
+
+	events := s.wait(t, 3)
+
+	nginx := events[0]
+	if nginx.TenantID != "web" || nginx.Source != "nginx" || nginx.Severity != models.SeverityInfo {
+		t.Errorf("unexpected nginx event: %+v", nginx)
+	}
+	if nginx.Message != "nginx started" {
+		t.Errorf("unexpected message %q", nginx.Message)
+	}
+	if !nginx.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected timestamp %s", nginx.Timestamp)
+	}
+	if nginx.Metadata["unit"] != "nginx.service" || nginx.Metadata["pid"] != "412" || nginx.Metadata["host"] != "web-1" {
+		t.Errorf("unexpected metadata %v", nginx.Metadata)
+	}
+
+	kernel := events[1]
+	if kernel.TenantID != "system" || kernel.Source != "kernel" || kernel.Severity != models.SeverityCritical {
+		t.Errorf("unexpected kernel event: %+v", kernel)
+	}
+
+	cron := events[2]
+	if cron.Severity != models.SeverityWarning || cron.Message != "hi�" {
+		t.Errorf("unexpected cron event: %+v", cron)
+	}
+
+	if events[0].ID == events[1].ID || events[0].ID == "" {
+		t.Errorf("expected distinct IDs, got %s and %s", events[0].ID, events[1].ID)
+	}
+}
+
+func TestReader_ResumesAfterCursor(t *testing.T) {
+	dir := t.TempDir()
+	journalctl, argsFile := fakeJournalctl(t, dir)
+	cfg := testConfig(dir, journalctl)
+
+	s := &sink{}
+	reader, err := journal.New(cfg, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Start(context.Background())
+	first := s.wait(t, 3)
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := os.ReadFile(cfg.CursorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(cursor)) != "s=1;i=3" {
+		t.Errorf("expected last cursor to be saved, got %q", cursor)
+	}
+
+	// A new reader resumes after the saved cursor
+	s2 := &sink{}
+	reader, err = journal.New(cfg, s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Start(context.Background())
+	second := s2.wait(t, 3)
+	reader.Close()
+
+	if first[0].ID != second[0].ID {
+		t.Error("expected a re-read entry to keep its ID")
+	}
+
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 journalctl runs, got %d", len(runs))
+	}
+	for _, arg := range []string{"--follow", "--output=json", "--priority=6", "--lines=0", "--unit=nginx.service", "--unit=cron.service"} {
+		if !strings.Contains(runs[0], arg) {
+			t.Errorf("first run missing %s: %s", arg, runs[0])
+		}
+	}
+	if !strings.Contains(runs[1], "--after-cursor=s=1;i=3") {
+		t.Errorf("second run should resume after the cursor: %s", runs[1])
+	}
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	cfg := config.Default().Journal
+
+	bad := cfg
+	bad.UnitTenants = "nginx.service"
+	if _, err := journal.New(bad, &sink{}); err == nil {
+		t.Error("expected error for malformed unit tenants")
+	}
+
+	bad = cfg
+	bad.MinPriority = 8
+	if _, err := journal.New(bad, &sink{}); err == nil {
+		t.Error("expected error for out of range priority")
+	}
+
+	bad = cfg
+	bad.Tenant = ""
+	if _, err := journal.New(bad, &sink{}); err == nil {
+		t.Error("expected error for missing tenant")
+	}
+}
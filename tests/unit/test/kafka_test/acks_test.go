@@ -0,0 +1,56 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+
+	"parsec/internal/config"
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+func TestProducer_AcksLevelsUseTheirOwnWriters(t *testing.T) {
+	factory := &writerFactory{make: func(id int) *fakeWriter { return &fakeWriter{} }}
+	producer, err := kafka.NewProducer([]string{"fake:9092"}, "logs", config.ProducerConfig{
+		PoolSize:     1,
+		RequiredAcks: -1,
+	}, kafka.WithWriterFactory(factory.newWriter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader := poolEnvelope()
+	leader.Acks = "leader"
+	all := poolEnvelope()
+	all.Acks = "all"
+	if err := producer.PublishBatch(context.Background(), []*models.Envelope{poolEnvelope(), leader, all, poolEnvelope()}); err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	if err := producer.Publish(context.Background(), leader); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// "all" is the producer's own level, so only "leader" gets a writer
+	writers := factory.created()
+	if len(writers) != 2 {
+		t.Fatalf("%d writers created, want the pool's and one for leader acks", len(writers))
+	}
+	if n := writers[0].writes.Load(); n != 1 {
+		t.Errorf("pool writer wrote %d times, want 1", n)
+	}
+	if n := writers[1].writes.Load(); n != 2 {
+		t.Errorf("leader acks writer wrote %d times, want 2", n)
+	}
+	if producer.PoolSize() != 1 {
+		t.Errorf("pool size = %d, want 1", producer.PoolSize())
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range writers {
+		if !w.closed.Load() {
+			t.Errorf("writer %d not closed", w.id)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/kafka"
+	"parsec/internal/state"
+)
+
+func partitions(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+func TestTenantBalancer_MatchesHashWithoutPins(t *testing.T) {
+	b := kafka.NewTenantBalancer(nil)
+	hash := &kafkago.Hash{}
+	for i := 0; i < 200; i++ {
+		msg := kafkago.Message{Key: []byte(fmt.Sprintf("tenant-%d", i))}
+		if got, want := b.Balance(msg, partitions(12)...), hash.Balance(msg, partitions(12)...); got != want {
+			t.Fatalf("tenant-%d: got partition %d, kafka.Hash gives %d", i, got, want)
+		}
+	}
+}
+
+func TestTenantBalancer_IsolatesPinnedTenants(t *testing.T) {
+	ctx := context.Background()
+	b := kafka.NewTenantBalancer(nil)
+	if err := b.SetPin(ctx, "noisy", &kafka.PartitionRange{First: 8, Last: 11}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		shared := b.Balance(kafkago.Message{Key: []byte(fmt.Sprintf("tenant-%d", i))}, partitions(12)...)
+		if shared >= 8 {
+			t.Fatalf("tenant-%d hashed to pinned partition %d", i, shared)
+		}
+		seen[shared] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("expected other tenants spread over 8 shared partitions, got %v", seen)
+	}
+
+	pinned := b.Balance(kafkago.Message{Key: []byte("noisy")}, partitions(12)...)
+	if pinned < 8 || pinned > 11 {
+		t.Errorf("pinned tenant went to partition %d, want 8-11", pinned)
+	}
+
+	// A topic without the pinned partitions falls back to hashing across all
+	if got := b.Balance(kafkago.Message{Key: []byte("noisy")}, partitions(4)...); got < 0 || got > 3 {
+		t.Errorf("expected a partition of the smaller topic, got %d", got)
+	}
+
+	// Unpinning restores plain hashing
+	if err := b.SetPin(ctx, "noisy", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Pin("noisy"); ok {
+		t.Error("expected the tenant to be unpinned")
+	}
+}
+
+func TestTenantBalancer_PartitionOverride(t *testing.T) {
+	ctx := context.Background()
+	b := kafka.NewTenantBalancer(nil)
+	if err := b.SetPin(ctx, "noisy", &kafka.PartitionRange{First: 8, Last: 11}); err != nil {
+		t.Fatal(err)
+	}
+	target := func(tenant, partition string) kafkago.Message {
+		return kafkago.Message{
+			Key:     []byte(tenant),
+			Headers: []kafkago.Header{{Key: kafka.HeaderPartition, Value: []byte(partition)}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		msg  kafkago.Message
+		want func(int) bool
+	}{
+		{"unpinned tenant to a pinned partition", target("acme", "9"), func(p int) bool { return p == 9 }},
+		{"pinned tenant within its range", target("noisy", "10"), func(p int) bool { return p == 10 }},
+		{"pinned tenant outside its range", target("noisy", "2"), func(p int) bool { return p >= 8 && p <= 11 }},
+		{"missing partition", target("acme", "40"), func(p int) bool { return p < 8 }},
+		{"malformed partition", target("acme", "two"), func(p int) bool { return p < 8 }},
+	}
+	for _, tt := range tests {
+		if got := b.Balance(tt.msg, partitions(12)...); !tt.want(got) {
+			t.Errorf("%s: got partition %d", tt.name, got)
+		}
+	}
+}
+
+func TestTenantBalancer_SharesPinsAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	a := kafka.NewTenantBalancer(store)
+	if err := a.SetPin(ctx, "noisy", &kafka.PartitionRange{First: 2, Last: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := kafka.NewTenantBalancer(store)
+	if err := b.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if pin, ok := b.Pin("noisy"); !ok || pin.First != 2 || pin.Last != 3 {
+		t.Errorf("expected the pin on the other node, got %+v, %v", pin, ok)
+	}
+}
+
+func TestTenantBalancer_NodesKeepEachOthersPins(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	// Neither node has loaded the other's pin before setting its own
+	a := kafka.NewTenantBalancer(store)
+	b := kafka.NewTenantBalancer(store)
+	if err := a.SetPin(ctx, "noisy", &kafka.PartitionRange{First: 2, Last: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetPin(ctx, "loud", &kafka.PartitionRange{First: 4, Last: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := kafka.NewTenantBalancer(store)
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"noisy", "loud"} {
+		if _, ok := reader.Pin(tenantID); !ok {
+			t.Errorf("%s: pin lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the pins set here in place
+	noop := kafka.NewTenantBalancer(state.NewNoopStore(""))
+	if err := noop.SetPin(ctx, "noisy", &kafka.PartitionRange{First: 2, Last: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := noop.Pin("noisy"); !ok {
+		t.Error("reloading an empty store dropped the pin")
+	}
+}
+
+func TestTenantBalancer_RejectsInvalidRanges(t *testing.T) {
+	b := kafka.NewTenantBalancer(nil)
+	for _, r := range []kafka.PartitionRange{{First: -1, Last: 2}, {First: 3, Last: 2}} {
+		if err := b.SetPin(context.Background(), "t", &r); !errors.Is(err, kafka.ErrInvalidPartitionRange) {
+			t.Errorf("range %+v: expected ErrInvalidPartitionRange, got %v", r, err)
+		}
+	}
+}
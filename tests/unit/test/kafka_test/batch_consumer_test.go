@@ -0,0 +1,143 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/config"
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+// chanReader serves messages from a channel and records commits
+type chanReader struct {
+	msgs chan kafkago.Message
+
+	mu        sync.Mutex
+	committed []int64
+}
+
+func (r *chanReader) ReadMessage(ctx context.Context) (kafkago.Message, error) {
+	return r.FetchMessage(ctx)
+}
+
+func (r *chanReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return kafkago.Message{}, ctx.Err()
+	}
+}
+
+func (r *chanReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (r *chanReader) Close() error { return nil }
+
+func (r *chanReader) commits() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.committed)
+}
+
+func envelopeMessage(t *testing.T, offset int64) kafkago.Message {
+	t.Helper()
+	value, err := json.Marshal(models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: "acme"}, "node-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafkago.Message{Offset: offset, Value: value}
+}
+
+// batchSizes records the size of each batch handled
+type batchSizes struct {
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (b *batchSizes) handle(ctx context.Context, envelopes []*models.Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sizes = append(b.sizes, len(envelopes))
+	return nil
+}
+
+func (b *batchSizes) get() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]int(nil), b.sizes...)
+}
+
+func TestBatchConsumer_DeliversFetchSizedBatches(t *testing.T) {
+	reader := &chanReader{msgs: make(chan kafkago.Message, 100)}
+	for i := 0; i < 25; i++ {
+		reader.msgs <- envelopeMessage(t, int64(i))
+	}
+	// An undecodable message is committed but not handled
+	reader.msgs <- kafkago.Message{Offset: 25, Value: []byte("not json")}
+
+	handled := &batchSizes{}
+	consumer, err := kafka.NewBatchConsumer([]string{"fake:9092"}, "logs", config.ConsumerConfig{
+		BatchSize: 10,
+		BatchWait: 20 * time.Millisecond,
+	}, handled.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer.WithReader(reader)
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for reader.commits() < 26 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sizes := handled.get()
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 10 || sizes[2] != 5 {
+		t.Errorf("handled batches %v, want [10 10 5]", sizes)
+	}
+	if got := reader.commits(); got != 26 {
+		t.Errorf("committed %d offsets, want 26", got)
+	}
+}
+
+func TestBatchConsumer_HandlesPartialBatchAfterWait(t *testing.T) {
+	reader := &chanReader{msgs: make(chan kafkago.Message, 10)}
+	handled := &batchSizes{}
+	consumer, err := kafka.NewBatchConsumer([]string{"fake:9092"}, "logs", config.ConsumerConfig{
+		BatchSize: 100,
+		BatchWait: 20 * time.Millisecond,
+	}, handled.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer.WithReader(reader)
+	consumer.Start(context.Background())
+	defer consumer.Stop()
+
+	reader.msgs <- envelopeMessage(t, 0)
+	reader.msgs <- envelopeMessage(t, 1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(handled.get()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if sizes := handled.get(); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("handled batches %v, want [2]", sizes)
+	}
+}
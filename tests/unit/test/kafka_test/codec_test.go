@@ -0,0 +1,102 @@
+package kafka_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/encryption"
+	"parsec/internal/kafka"
+)
+
+func TestDecodeValue_Plain(t *testing.T) {
+	msg := kafkago.Message{Value: []byte(`{"event":{}}`)}
+
+	got, err := kafka.DecodeValue(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != `{"event":{}}` {
+		t.Errorf("unexpected value: %s", got)
+	}
+}
+
+func TestDecodeValue_Gzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"event":{"id":"evt-1"}}`))
+	zw.Close()
+
+	msg := kafkago.Message{
+		Value: buf.Bytes(),
+		Headers: []kafkago.Header{
+			{Key: "tenant_id", Value: []byte("tenant-1")},
+			{Key: kafka.HeaderContentEncoding, Value: []byte(kafka.EncodingGzip)},
+		},
+	}
+
+	got, err := kafka.DecodeValue(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != `{"event":{"id":"evt-1"}}` {
+		t.Errorf("unexpected value: %s", got)
+	}
+}
+
+func TestDecodeValue_UnknownEncoding(t *testing.T) {
+	msg := kafkago.Message{
+		Value:   []byte("x"),
+		Headers: []kafkago.Header{{Key: kafka.HeaderContentEncoding, Value: []byte("brotli")}},
+	}
+
+	if _, err := kafka.DecodeValue(msg); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
+
+func TestDecryptValue_EncryptedGzip(t *testing.T) {
+	keyring, err := encryption.ParseKeyring("k1=AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", "tenant-1=k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher := encryption.NewCipher(keyring)
+
+	// Producers compress first, then encrypt
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"event":{"id":"evt-1"}}`))
+	zw.Close()
+	sealed, keyID, err := cipher.Seal(context.Background(), "tenant-1", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := kafkago.Message{
+		Value: sealed,
+		Headers: []kafkago.Header{
+			{Key: "tenant_id", Value: []byte("tenant-1")},
+			{Key: kafka.HeaderContentEncoding, Value: []byte(kafka.EncodingGzip)},
+			{Key: kafka.HeaderEncryptionKeyID, Value: []byte(keyID)},
+		},
+	}
+
+	if _, err := kafka.DecodeValue(msg); !errors.Is(err, kafka.ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted without keys, got %v", err)
+	}
+	if _, err := kafka.DecryptValue(context.Background(), msg, nil); !errors.Is(err, kafka.ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted with a nil cipher, got %v", err)
+	}
+
+	got, err := kafka.DecryptValue(context.Background(), msg, cipher)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != `{"event":{"id":"evt-1"}}` {
+		t.Errorf("unexpected value: %s", got)
+	}
+}
@@ -0,0 +1,156 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"parsec/internal/bus"
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+func handlerEnvelope() *models.Envelope {
+	e := models.NewEnvelope(&models.LogEvent{ID: "evt-1", TenantID: "acme", TraceID: "trace-1"}, "node-1")
+	e.Topic = "logs"
+	return e
+}
+
+// flaky fails its first failures calls
+func flaky(failures int, err error) (kafka.MessageHandler, *int) {
+	calls := 0
+	return func(ctx context.Context, envelope *models.Envelope) error {
+		calls++
+		if calls <= failures {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+// dlqRecorder records dead-lettered envelopes
+type dlqRecorder struct {
+	letters []*models.Envelope
+	err     error
+}
+
+func (d *dlqRecorder) Publish(ctx context.Context, envelope *models.Envelope) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.letters = append(d.letters, envelope)
+	return nil
+}
+
+func TestChainHandler_Order(t *testing.T) {
+	var order []string
+	mark := func(name string) kafka.HandlerMiddleware {
+		return func(next kafka.MessageHandler) kafka.MessageHandler {
+			return func(ctx context.Context, envelope *models.Envelope) error {
+				order = append(order, name)
+				return next(ctx, envelope)
+			}
+		}
+	}
+	h := kafka.ChainHandler(func(ctx context.Context, envelope *models.Envelope) error {
+		order = append(order, "handler")
+		return nil
+	}, mark("first"), mark("second"))
+
+	if err := h(context.Background(), handlerEnvelope()); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "handler" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestRetryHandler(t *testing.T) {
+	boom := errors.New("boom")
+
+	h, calls := flaky(2, boom)
+	envelope := handlerEnvelope()
+	if err := kafka.RetryHandler(3, time.Millisecond)(h)(context.Background(), envelope); err != nil {
+		t.Errorf("expected success on the third attempt, got %v", err)
+	}
+	if *calls != 3 || envelope.RetryCount != 2 {
+		t.Errorf("expected 3 calls and 2 retries, got %d and %d", *calls, envelope.RetryCount)
+	}
+
+	h, calls = flaky(5, boom)
+	if err := kafka.RetryHandler(3, time.Millisecond)(h)(context.Background(), handlerEnvelope()); !errors.Is(err, boom) || *calls != 3 {
+		t.Errorf("expected to give up after 3 calls, got %v after %d", err, *calls)
+	}
+
+	// Permanent errors are not retried
+	h, calls = flaky(5, bus.Permanent(boom))
+	if err := kafka.RetryHandler(3, time.Millisecond)(h)(context.Background(), handlerEnvelope()); !errors.Is(err, boom) || *calls != 1 {
+		t.Errorf("expected a single call, got %v after %d", err, *calls)
+	}
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	boom := errors.New("boom")
+	dlq := &dlqRecorder{}
+	h, _ := flaky(1, boom)
+
+	envelope := handlerEnvelope()
+	if err := kafka.DeadLetterHandler(dlq, "logs.dlq")(h)(context.Background(), envelope); err != nil {
+		t.Errorf("expected the dead-lettered envelope to count as handled, got %v", err)
+	}
+	if len(dlq.letters) != 1 {
+		t.Fatalf("expected one dead letter, got %d", len(dlq.letters))
+	}
+	letter := dlq.letters[0]
+	if letter.Topic != "logs.dlq" || letter.Event.Metadata.Get(bus.HeaderDLQTopic) != "logs" || letter.Event.Metadata.Get(bus.HeaderDLQError) != "boom" {
+		t.Errorf("unexpected dead letter %+v, metadata %v", letter, letter.Event.Metadata)
+	}
+	if envelope.Topic != "logs" || envelope.Event.Metadata != nil {
+		t.Error("expected the consumed envelope to be left unchanged")
+	}
+
+	// A failed dead-letter publish surfaces both errors
+	dlq.err = errors.New("dlq down")
+	h, _ = flaky(1, boom)
+	err := kafka.DeadLetterHandler(dlq, "logs.dlq")(h)(context.Background(), handlerEnvelope())
+	if !errors.Is(err, boom) || !errors.Is(err, dlq.err) {
+		t.Errorf("expected both errors, got %v", err)
+	}
+}
+
+func TestRecoverAndTraceHandlers(t *testing.T) {
+	h := kafka.ChainHandler(func(ctx context.Context, envelope *models.Envelope) error {
+		if zerolog.Ctx(ctx).GetLevel() == zerolog.Disabled {
+			t.Error("expected a logger in the context")
+		}
+		panic("bad envelope")
+	}, kafka.DefaultHandlerMiddleware()...)
+
+	if err := h(context.Background(), handlerEnvelope()); err == nil {
+		t.Error("expected the panic as an error")
+	}
+}
+
+func TestTimingsHandler(t *testing.T) {
+	stored := func(ctx context.Context, envelope *models.Envelope) error { return nil }
+	envelope := handlerEnvelope()
+	if err := kafka.TimingsHandler(stored)(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Timings.Persisted.IsZero() || envelope.Timings.Persisted.Before(envelope.Timings.Received) {
+		t.Errorf("unexpected persisted time %+v", envelope.Timings)
+	}
+
+	// Envelopes the handler fails on are not persisted
+	failing, _ := flaky(1, errors.New("disk full"))
+	envelope = handlerEnvelope()
+	if err := kafka.TimingsHandler(failing)(context.Background(), envelope); err == nil {
+		t.Fatal("expected the handler's error")
+	}
+	if !envelope.Timings.Persisted.IsZero() {
+		t.Error("failed envelope stamped as persisted")
+	}
+}
@@ -0,0 +1,163 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/config"
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+var errAudit = errors.New("audit rejected")
+
+// recordingWriter keeps the messages written to it
+type recordingWriter struct {
+	mu   sync.Mutex
+	msgs []kafkago.Message
+	fail error
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	if w.fail != nil {
+		return w.fail
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+// stamper adds a header and records the hook calls into a shared log
+type stamper struct {
+	name   string
+	reject string // event ID to reject
+	calls  *[]string
+	after  []kafka.PublishResult
+}
+
+func (s *stamper) BeforePublish(ctx context.Context, envelope *models.Envelope, msg *kafkago.Message) error {
+	*s.calls = append(*s.calls, "before "+s.name)
+	if envelope.Event.ID == s.reject {
+		return errAudit
+	}
+	msg.Headers = append(msg.Headers, kafkago.Header{Key: "stamped-by", Value: []byte(s.name)})
+	return nil
+}
+
+func (s *stamper) AfterPublish(ctx context.Context, result kafka.PublishResult) {
+	*s.calls = append(*s.calls, "after "+s.name)
+	s.after = append(s.after, result)
+}
+
+func interceptedProducer(t *testing.T, w *recordingWriter, interceptors ...kafka.Interceptor) *kafka.Producer {
+	t.Helper()
+	producer, err := kafka.NewProducer([]string{"fake:9092"}, "logs", config.ProducerConfig{PoolSize: 1},
+		kafka.WithWriterFactory(func() kafka.Writer { return w }),
+		kafka.WithInterceptors(interceptors...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { producer.Close() })
+	return producer
+}
+
+func interceptedEnvelope(id string) *models.Envelope {
+	return models.NewEnvelope(&models.LogEvent{ID: id, TenantID: "acme", Message: "hi"}, "node-1")
+}
+
+func stampedBy(msg kafkago.Message) []string {
+	var names []string
+	for _, h := range msg.Headers {
+		if h.Key == "stamped-by" {
+			names = append(names, string(h.Value))
+		}
+	}
+	return names
+}
+
+func TestInterceptors_WrapEachPublish(t *testing.T) {
+	var calls []string
+	outer := &stamper{name: "outer", calls: &calls}
+	inner := &stamper{name: "inner", calls: &calls}
+	w := &recordingWriter{}
+	producer := interceptedProducer(t, w, outer, inner)
+
+	if err := producer.Publish(context.Background(), interceptedEnvelope("evt-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"before outer", "before inner", "after inner", "after outer"}
+	if len(calls) != len(want) {
+		t.Fatalf("hook calls %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("hook calls %v, want %v", calls, want)
+		}
+	}
+
+	if len(w.msgs) != 1 {
+		t.Fatalf("wrote %d messages, want 1", len(w.msgs))
+	}
+	if got := stampedBy(w.msgs[0]); len(got) != 2 || got[0] != "outer" || got[1] != "inner" {
+		t.Errorf("expected headers stamped by both interceptors, got %v", got)
+	}
+	result := outer.after[0]
+	if result.Err != nil || result.Envelope.Event.ID != "evt-1" || len(stampedBy(result.Message)) != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestInterceptors_RejectMessages(t *testing.T) {
+	var calls []string
+	audit := &stamper{name: "audit", reject: "evt-2", calls: &calls}
+	w := &recordingWriter{}
+	producer := interceptedProducer(t, w, audit)
+
+	if err := producer.Publish(context.Background(), interceptedEnvelope("evt-2")); !errors.Is(err, errAudit) {
+		t.Errorf("expected the interceptor's error, got %v", err)
+	}
+
+	batch := []*models.Envelope{interceptedEnvelope("evt-1"), interceptedEnvelope("evt-2"), interceptedEnvelope("evt-3")}
+	if err := producer.PublishBatch(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.msgs) != 2 {
+		t.Fatalf("wrote %d messages, want the 2 accepted", len(w.msgs))
+	}
+
+	// Rejected messages get no AfterPublish
+	if len(audit.after) != 2 || audit.after[0].Envelope.Event.ID != "evt-1" || audit.after[1].Envelope.Event.ID != "evt-3" {
+		t.Errorf("unexpected results %+v", audit.after)
+	}
+	if producer.Stats().MessagesFailed != 2 {
+		t.Errorf("expected 2 failed messages, got %d", producer.Stats().MessagesFailed)
+	}
+}
+
+func TestInterceptors_SeeWriteFailures(t *testing.T) {
+	var calls []string
+	tracer := &stamper{name: "tracer", calls: &calls}
+	w := &recordingWriter{fail: errors.New("broken pipe")}
+	producer := interceptedProducer(t, w, tracer)
+
+	err := producer.PublishBatch(context.Background(), []*models.Envelope{interceptedEnvelope("evt-1"), interceptedEnvelope("evt-2")})
+	if err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if len(tracer.after) != 2 {
+		t.Fatalf("expected a result per message, got %d", len(tracer.after))
+	}
+	for _, result := range tracer.after {
+		if !errors.Is(result.Err, w.fail) || result.Duration <= 0 {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+}
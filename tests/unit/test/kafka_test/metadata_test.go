@@ -0,0 +1,88 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/kafka"
+)
+
+// topicLayout lays out a topic with the given leader per partition and
+// three replicas on brokers 1-3
+func topicLayout(topic string, leaders ...int) []kafkago.Partition {
+	replicas := []kafkago.Broker{{ID: 1}, {ID: 2}, {ID: 3}}
+	var list []kafkago.Partition
+	for i, leader := range leaders {
+		list = append(list, kafkago.Partition{
+			Topic:    topic,
+			ID:       i,
+			Leader:   kafkago.Broker{ID: leader, Host: "broker"},
+			Replicas: replicas,
+			Isr:      replicas,
+		})
+	}
+	return list
+}
+
+func TestMetadataCache_Layout(t *testing.T) {
+	var fetchErr error
+	layout := append(topicLayout("logs", 1, 2, 3, 1, 2, 3), topicLayout("logs-short", 1, 1, 1)...)
+	layout[0].Isr = layout[0].Isr[:1]
+
+	cache := kafka.NewMetadataCache(nil, "logs", "logs-short", "", "logs").
+		WithFetcher(func(ctx context.Context, topics []string) ([]kafkago.Partition, error) {
+			if len(topics) != 2 {
+				t.Errorf("expected duplicate and empty topics dropped, got %v", topics)
+			}
+			return layout, fetchErr
+		})
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	topics := cache.Topics()
+	if len(topics) != 2 || topics[0].Topic != "logs" || topics[1].Topic != "logs-short" {
+		t.Fatalf("unexpected topics %+v", topics)
+	}
+	logs, short := topics[0], topics[1]
+	if logs.Partitions != 6 || logs.LeaderImbalance != 1 || logs.UnderReplicated != 1 || len(logs.Leaders) != 3 {
+		t.Errorf("unexpected layout %+v", logs)
+	}
+	// All three partitions led by one of three brokers
+	if short.LeaderImbalance != 3 || short.Leaders[0].Partitions != 3 {
+		t.Errorf("expected an imbalanced topic, got %+v", short)
+	}
+
+	if w := logs.Warnings(4, 1.5); len(w) != 1 || !strings.Contains(w[0], "under-replicated") {
+		t.Errorf("expected only the under-replicated warning, got %v", w)
+	}
+	w := short.Warnings(4, 1.5)
+	if len(w) != 2 || !strings.Contains(w[0], "3 partitions for 4 concurrent writers") || !strings.Contains(w[1], "imbalanced") {
+		t.Errorf("expected partition count and imbalance warnings, got %v", w)
+	}
+
+	// A failed refresh keeps the last layout
+	fetchErr = errors.New("brokers unreachable")
+	if err := cache.Refresh(context.Background()); err == nil {
+		t.Fatal("expected the fetch error")
+	}
+	logs = cache.Topics()[0]
+	if logs.Partitions != 6 || logs.Error != "brokers unreachable" {
+		t.Errorf("expected the last layout with the error, got %+v", logs)
+	}
+}
+
+func TestMetadataCache_MissingTopic(t *testing.T) {
+	cache := kafka.NewMetadataCache(nil, "missing").
+		WithFetcher(func(ctx context.Context, topics []string) ([]kafkago.Partition, error) {
+			return nil, nil
+		})
+	cache.Refresh(context.Background())
+	if m := cache.Topics()[0]; m.Error == "" || m.Partitions != 0 || m.Warnings(4, 1.5) != nil {
+		t.Errorf("expected a missing topic without warnings, got %+v", m)
+	}
+}
@@ -0,0 +1,222 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+// fakeCluster serves one topic's offsets and one group's commits
+type fakeCluster struct {
+	topic     string
+	earliest  map[int]int64
+	latest    map[int]int64
+	atTime    map[int]int64 // offset per partition for any timestamp; missing = none
+	committed map[int]int64
+	members   int
+	deleted   []string
+}
+
+func (f *fakeCluster) Metadata(ctx context.Context, req *kafkago.MetadataRequest) (*kafkago.MetadataResponse, error) {
+	t := kafkago.Topic{Name: f.topic}
+	for p := range f.latest {
+		t.Partitions = append(t.Partitions, kafkago.Partition{Topic: f.topic, ID: p})
+	}
+	return &kafkago.MetadataResponse{Topics: []kafkago.Topic{t}}, nil
+}
+
+func (f *fakeCluster) ListOffsets(ctx context.Context, req *kafkago.ListOffsetsRequest) (*kafkago.ListOffsetsResponse, error) {
+	var offsets []kafkago.PartitionOffsets
+	for _, r := range req.Topics[f.topic] {
+		o := kafkago.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1, Offsets: map[int64]time.Time{}}
+		switch r.Timestamp {
+		case kafkago.FirstOffset:
+			o.FirstOffset = f.earliest[r.Partition]
+		case kafkago.LastOffset:
+			o.LastOffset = f.latest[r.Partition]
+		default:
+			if offset, ok := f.atTime[r.Partition]; ok {
+				o.Offsets[offset] = time.UnixMilli(r.Timestamp)
+			}
+		}
+		offsets = append(offsets, o)
+	}
+	return &kafkago.ListOffsetsResponse{Topics: map[string][]kafkago.PartitionOffsets{f.topic: offsets}}, nil
+}
+
+func (f *fakeCluster) DescribeGroups(ctx context.Context, req *kafkago.DescribeGroupsRequest) (*kafkago.DescribeGroupsResponse, error) {
+	desc := kafkago.DescribeGroupsResponseGroup{GroupID: req.GroupIDs[0], GroupState: "Empty"}
+	if f.members > 0 {
+		desc.GroupState = "Stable"
+		desc.Members = make([]kafkago.DescribeGroupsResponseMember, f.members)
+	}
+	return &kafkago.DescribeGroupsResponse{Groups: []kafkago.DescribeGroupsResponseGroup{desc}}, nil
+}
+
+func (f *fakeCluster) OffsetFetch(ctx context.Context, req *kafkago.OffsetFetchRequest) (*kafkago.OffsetFetchResponse, error) {
+	var partitions []kafkago.OffsetFetchPartition
+	for _, p := range req.Topics[f.topic] {
+		offset, ok := f.committed[p]
+		if !ok {
+			offset = -1
+		}
+		partitions = append(partitions, kafkago.OffsetFetchPartition{Partition: p, CommittedOffset: offset})
+	}
+	return &kafkago.OffsetFetchResponse{Topics: map[string][]kafkago.OffsetFetchPartition{f.topic: partitions}}, nil
+}
+
+func (f *fakeCluster) OffsetCommit(ctx context.Context, req *kafkago.OffsetCommitRequest) (*kafkago.OffsetCommitResponse, error) {
+	var partitions []kafkago.OffsetCommitPartition
+	for _, c := range req.Topics[f.topic] {
+		f.committed[c.Partition] = c.Offset
+		partitions = append(partitions, kafkago.OffsetCommitPartition{Partition: c.Partition})
+	}
+	return &kafkago.OffsetCommitResponse{Topics: map[string][]kafkago.OffsetCommitPartition{f.topic: partitions}}, nil
+}
+
+func (f *fakeCluster) DeleteGroups(ctx context.Context, req *kafkago.DeleteGroupsRequest) (*kafkago.DeleteGroupsResponse, error) {
+	f.deleted = append(f.deleted, req.GroupIDs...)
+	return &kafkago.DeleteGroupsResponse{Errors: map[string]error{}}, nil
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		topic:     "logs",
+		earliest:  map[int]int64{0: 100, 1: 50},
+		latest:    map[int]int64{0: 500, 1: 300},
+		atTime:    map[int]int64{0: 250},
+		committed: map[int]int64{0: 480, 1: 300},
+	}
+}
+
+func TestOffsetReset_Validate(t *testing.T) {
+	now := time.Now()
+	for _, r := range []kafka.OffsetReset{
+		{To: kafka.ResetEarliest},
+		{Topic: "logs"},
+		{Topic: "logs", To: "middle"},
+		{Topic: "logs", To: kafka.ResetLatest, Timestamp: &now},
+	} {
+		if err := r.Validate(); !errors.Is(err, kafka.ErrInvalidReset) {
+			t.Errorf("expected %+v to be invalid, got %v", r, err)
+		}
+	}
+}
+
+func TestGroupOffsets_Describe(t *testing.T) {
+	states, err := kafka.NewGroupOffsets(newFakeCluster()).Describe(context.Background(), "parsec", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected 2 partitions, got %+v", states)
+	}
+	if s := states[0]; s.Committed != 480 || s.Earliest != 100 || s.Latest != 500 || s.Lag != 20 {
+		t.Errorf("unexpected partition 0 state %+v", s)
+	}
+	if states[1].Lag != 0 {
+		t.Errorf("unexpected partition 1 state %+v", states[1])
+	}
+}
+
+func TestGroupOffsets_PlanTimestamp(t *testing.T) {
+	cluster := newFakeCluster()
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	moves, err := kafka.NewGroupOffsets(cluster).Plan(context.Background(), "parsec", kafka.OffsetReset{Topic: "logs", Timestamp: &ts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Partition 1 has nothing after the timestamp, so it moves to its end
+	if len(moves) != 2 || moves[0].From != 480 || moves[0].To != 250 || moves[1].To != 300 {
+		t.Errorf("unexpected moves %+v", moves)
+	}
+	if cluster.committed[0] != 480 {
+		t.Error("expected a plan to leave offsets alone")
+	}
+}
+
+func TestGroupOffsets_ApplyClampsAndCommits(t *testing.T) {
+	cluster := newFakeCluster()
+	moves, err := kafka.NewGroupOffsets(cluster).Apply(context.Background(), "parsec", kafka.OffsetReset{
+		Topic:   "logs",
+		Offsets: map[int]int64{1: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 1 || moves[0].Partition != 1 || moves[0].To != 50 || !moves[0].Clamped {
+		t.Errorf("expected partition 1 clamped to its earliest offset, got %+v", moves)
+	}
+	if cluster.committed[1] != 50 || cluster.committed[0] != 480 {
+		t.Errorf("unexpected commits %v", cluster.committed)
+	}
+
+	if _, err := kafka.NewGroupOffsets(cluster).Plan(context.Background(), "parsec", kafka.OffsetReset{
+		Topic:   "logs",
+		Offsets: map[int]int64{7: 10},
+	}); !errors.Is(err, kafka.ErrInvalidReset) {
+		t.Errorf("expected an unknown partition to be rejected, got %v", err)
+	}
+}
+
+func TestGroupOffsets_ApplyRefusesActiveGroup(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.members = 2
+	_, err := kafka.NewGroupOffsets(cluster).Apply(context.Background(), "parsec", kafka.OffsetReset{Topic: "logs", To: kafka.ResetEarliest})
+	if !errors.Is(err, kafka.ErrGroupActive) {
+		t.Errorf("expected ErrGroupActive, got %v", err)
+	}
+	if cluster.committed[0] != 480 {
+		t.Error("expected offsets to be left alone")
+	}
+}
+
+func TestRangeReader_ReadsToEndOffsets(t *testing.T) {
+	cluster := newFakeCluster()
+	cluster.latest[0] = 254
+
+	// Partition 0 is read from 250 (the offset at the timestamp) to 254;
+	// partition 1 has nothing after it. Offset 254 arrived after the start.
+	reader := &chanReader{msgs: make(chan kafkago.Message, 10)}
+	for offset := int64(250); offset <= 254; offset++ {
+		reader.msgs <- envelopeMessage(t, offset)
+	}
+
+	var total int64
+	var mu sync.Mutex
+	var read []string
+	rr := kafka.NewRangeReader([]string{"fake:9092"}, kafka.NewGroupOffsets(cluster)).
+		WithReaderFactory(func(group, topic string) kafka.Reader { return reader })
+	err := rr.Read(context.Background(), kafka.RangeSpec{
+		Group:   "reprocess-1",
+		Topic:   "logs",
+		From:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Readers: 2,
+		Started: func(n int64) { total = n },
+	}, func(e *models.Envelope) error {
+		mu.Lock()
+		defer mu.Unlock()
+		read = append(read, e.Event.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 4 || len(read) != 4 {
+		t.Errorf("expected 4 envelopes in range, got total %d and %d read", total, len(read))
+	}
+	if reader.commits() != 4 {
+		t.Errorf("expected 4 commits, got %d", reader.commits())
+	}
+	if len(cluster.deleted) != 1 || cluster.deleted[0] != "reprocess-1" {
+		t.Errorf("expected the temporary group to be deleted, got %v", cluster.deleted)
+	}
+}
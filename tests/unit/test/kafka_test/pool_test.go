@@ -0,0 +1,201 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"parsec/internal/config"
+	"parsec/internal/kafka"
+	"parsec/pkg/models"
+)
+
+// fakeWriter fails every write while wedged and can be slowed down
+type fakeWriter struct {
+	id     int
+	wedged bool
+	delay  time.Duration
+	writes atomic.Int64
+	closed atomic.Bool
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	w.writes.Add(1)
+	if w.delay > 0 {
+		time.Sleep(w.delay)
+	}
+	if w.wedged {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.closed.Store(true)
+	return nil
+}
+
+// writerFactory records the writers it creates; make decides each one
+type writerFactory struct {
+	mu      sync.Mutex
+	writers []*fakeWriter
+	make    func(id int) *fakeWriter
+}
+
+func (f *writerFactory) newWriter() kafka.Writer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.make(len(f.writers))
+	w.id = len(f.writers)
+	f.writers = append(f.writers, w)
+	return w
+}
+
+func (f *writerFactory) created() []*fakeWriter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeWriter(nil), f.writers...)
+}
+
+func poolEnvelope() *models.Envelope {
+	return models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: "acme", Timestamp: time.Now()}, "node-1")
+}
+
+func TestProducerPool_EvictsWedgedWriter(t *testing.T) {
+	factory := &writerFactory{make: func(id int) *fakeWriter {
+		return &fakeWriter{wedged: id == 0}
+	}}
+	producer, err := kafka.NewProducer([]string{"fake:9092"}, "logs", config.ProducerConfig{
+		PoolSize:             2,
+		WriterEvictErrorRate: 0.5,
+		WriterEvictWindow:    10,
+	}, kafka.WithWriterFactory(factory.newWriter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	failed := 0
+	for i := 0; i < 40; i++ {
+		if err := producer.Publish(context.Background(), poolEnvelope()); err != nil {
+			failed++
+		}
+	}
+
+	writers := factory.created()
+	if len(writers) != 3 {
+		t.Fatalf("created %d writers, want 3 (one replacement)", len(writers))
+	}
+	if !writers[0].closed.Load() {
+		t.Error("wedged writer was not closed")
+	}
+	if got := writers[0].writes.Load(); got != 5 {
+		t.Errorf("wedged writer used for %d writes, want 5 before eviction", got)
+	}
+	if failed != 5 {
+		t.Errorf("%d publishes failed, want 5", failed)
+	}
+	if producer.PoolSize() != 2 {
+		t.Errorf("pool size = %d, want 2", producer.PoolSize())
+	}
+
+	// The replacement takes over the evicted writer's metrics slot
+	stats := producer.WriterStats()
+	if len(stats) != 2 || stats[0].ID != 1 || stats[1].ID != 2 || stats[1].Slot != 0 || stats[0].Slot != 1 {
+		t.Errorf("unexpected writer slots %+v", stats)
+	}
+}
+
+func TestProducerPool_HealthyWritersAreKept(t *testing.T) {
+	factory := &writerFactory{make: func(id int) *fakeWriter { return &fakeWriter{} }}
+	producer, err := kafka.NewProducer([]string{"fake:9092"}, "logs", config.ProducerConfig{
+		PoolSize:             2,
+		WriterEvictErrorRate: 0.5,
+		WriterEvictWindow:    10,
+	}, kafka.WithWriterFactory(factory.newWriter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := producer.Publish(context.Background(), poolEnvelope()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(factory.created()); got != 2 {
+		t.Errorf("created %d writers, want 2", got)
+	}
+
+	stats := producer.WriterStats()
+	var writes, messages uint64
+	for i, ws := range stats {
+		if ws.ID != i || ws.Busy || ws.Errors != 0 {
+			t.Errorf("unexpected writer stats %+v", ws)
+		}
+		writes += ws.Writes
+		messages += ws.Messages
+	}
+	if len(stats) != 2 || writes != 20 || messages != 20 {
+		t.Errorf("expected 20 writes across 2 writers, got %+v", stats)
+	}
+
+	producer.Close()
+	for _, w := range factory.created() {
+		if !w.closed.Load() {
+			t.Errorf("writer %d not closed", w.id)
+		}
+	}
+}
+
+func TestProducerPool_GrowsUnderLatencyAndShrinksWhenIdle(t *testing.T) {
+	factory := &writerFactory{make: func(id int) *fakeWriter {
+		return &fakeWriter{delay: 20 * time.Millisecond}
+	}}
+	producer, err := kafka.NewProducer([]string{"fake:9092"}, "logs", config.ProducerConfig{
+		PoolSize:           1,
+		MinPoolSize:        1,
+		MaxPoolSize:        3,
+		PoolTargetLatency:  15 * time.Millisecond,
+		PoolResizeInterval: 50 * time.Millisecond,
+	}, kafka.WithWriterFactory(factory.newWriter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	// Eight concurrent publishers queue for writers
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				producer.Publish(ctx, poolEnvelope())
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for producer.PoolSize() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool size = %d under load, want 3", producer.PoolSize())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	deadline = time.Now().Add(3 * time.Second)
+	for producer.PoolSize() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pool size = %d when idle, want 1", producer.PoolSize())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 	"parsec/internal/config"
 	"parsec/internal/kafka"
-	"parsec/internal/models"
+	"parsec/pkg/models"
 )
 
 // skipIfNoKafka skips the test if Kafka is not available
@@ -0,0 +1,65 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/kafka"
+)
+
+func TestShaper_Unlimited(t *testing.T) {
+	s := kafka.NewShaper(kafka.ShaperLimits{})
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		if err := s.Wait(context.Background(), 100, 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited shaper delayed writes for %s", elapsed)
+	}
+}
+
+func TestShaper_LimitsMessageRate(t *testing.T) {
+	s := kafka.NewShaper(kafka.ShaperLimits{MessagesPerSec: 100})
+
+	// The first second's burst is free; the next 20 messages take ~200ms
+	start := time.Now()
+	for i := 0; i < 120; i++ {
+		if err := s.Wait(context.Background(), 1, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected ~200ms of shaping, took %s", elapsed)
+	}
+}
+
+func TestShaper_LimitsByteRateAndCancels(t *testing.T) {
+	s := kafka.NewShaper(kafka.ShaperLimits{BytesPerSec: 1000})
+
+	if err := s.Wait(context.Background(), 1, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// A 5s backlog is refused once the caller gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(ctx, 1, 5000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	// Raising the limit at runtime takes effect immediately
+	s.SetLimits(kafka.ShaperLimits{})
+	if got := s.Limits(); got.BytesPerSec != 0 {
+		t.Errorf("expected limits cleared, got %+v", got)
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if err := s.Wait(ctx2, 1, 1<<20); err != nil {
+		t.Errorf("expected unlimited write after clearing limits, got %v", err)
+	}
+}
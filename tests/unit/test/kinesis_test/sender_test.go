@@ -0,0 +1,115 @@
+package kinesis_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/kinesis"
+	"parsec/internal/sigv4"
+)
+
+type putRecords struct {
+	StreamName string
+	Records    []struct {
+		Data         []byte
+		PartitionKey string
+	}
+}
+
+func newSender(t *testing.T, handler http.HandlerFunc) *kinesis.Sender {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	s, err := kinesis.NewWithCredentials(config.KinesisConfig{
+		Region:       "eu-west-1",
+		StreamPrefix: "parsec-",
+		Endpoint:     srv.URL,
+	}, sigv4.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func message(id string) bus.Message {
+	return bus.Message{
+		Topic:   "logs",
+		Key:     []byte("acme"),
+		Value:   []byte(`{"event":{"id":"` + id + `"}}`),
+		Headers: []bus.Header{{Key: "event_id", Value: []byte(id)}},
+	}
+}
+
+func TestSender_PutRecords(t *testing.T) {
+	var got putRecords
+	s := newSender(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "Kinesis_20131202.PutRecords" {
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kinesis/aws4_request") {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		// The second record is throttled
+		w.Write([]byte(`{"FailedRecordCount":1,"Records":[{"SequenceNumber":"1","ShardId":"shardId-0"},` +
+			`{"ErrorCode":"ProvisionedThroughputExceededException","ErrorMessage":"slow down"}]}`))
+	})
+
+	errs := s.Send(context.Background(), []bus.Message{message("a"), message("b")})
+	if errs[0] != nil {
+		t.Errorf("unexpected error for first record: %v", errs[0])
+	}
+	var permanent *bus.PermanentError
+	if errs[1] == nil || errors.As(errs[1], &permanent) {
+		t.Errorf("expected a retryable error for the throttled record, got %v", errs[1])
+	}
+
+	if got.StreamName != "parsec-logs" || len(got.Records) != 2 || got.Records[0].PartitionKey != "acme" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	record, err := bus.UnmarshalRecord(got.Records[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(record.Value) != `{"event":{"id":"a"}}` || string(record.Headers[0].Value) != "a" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestSender_ClassifiesRequestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		errType   string
+		permanent bool
+	}{
+		{"missing stream", http.StatusBadRequest, "ResourceNotFoundException", true},
+		{"throttled", http.StatusBadRequest, "LimitExceededException", false},
+		{"server error", http.StatusInternalServerError, "InternalFailure", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSender(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"__type":"` + tt.errType + `","message":"nope"}`))
+			})
+
+			errs := s.Send(context.Background(), []bus.Message{message("a")})
+			var permanent *bus.PermanentError
+			if errs[0] == nil || errors.As(errs[0], &permanent) != tt.permanent {
+				t.Errorf("expected permanent=%v, got %v", tt.permanent, errs[0])
+			}
+		})
+	}
+}
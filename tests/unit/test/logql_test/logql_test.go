@@ -0,0 +1,132 @@
+package logql_test
+
+import (
+	"errors"
+	"testing"
+
+	"parsec/internal/logql"
+)
+
+func TestParse_SelectorAndFilters(t *testing.T) {
+	q, err := logql.Parse(`{source="api", level=~"error|warn"} |= "timeout" != "healthcheck" |~ ` + "`code=5\\d\\d`")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Matchers) != 2 || len(q.Filters) != 3 {
+		t.Fatalf("unexpected query %+v", q)
+	}
+
+	tests := []struct {
+		level, source, line string
+		want                bool
+	}{
+		{"error", "api", "request timeout code=504", true},
+		{"warn", "api", "request timeout code=503", true},
+		{"info", "api", "request timeout code=504", false},
+		{"errors", "api", "request timeout code=504", false}, // label regexps are anchored
+		{"error", "web", "request timeout code=504", false},
+		{"error", "api", "healthcheck timeout code=504", false},
+		{"error", "api", "request timeout code=404", false},
+		{"error", "api", "request ok code=500", false},
+	}
+	for _, tt := range tests {
+		got := q.Matches(map[string]string{"level": tt.level, "source": tt.source}, tt.line)
+		if got != tt.want {
+			t.Errorf("Matches(%s, %s, %q) = %v, want %v", tt.level, tt.source, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	unsupported := []string{
+		`count_over_time({source="api"}[5m])`,
+		`{source="api"} | json`,
+		`{source="api"} | logfmt | level="error"`,
+	}
+	for _, query := range unsupported {
+		if _, err := logql.Parse(query); !errors.Is(err, logql.ErrUnsupported) {
+			t.Errorf("Parse(%s) = %v, want ErrUnsupported", query, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`{}`,
+		`{source="api"`,
+		`{source api}`,
+		`{source="api" level="error"}`,
+		`{source="api} |= "x"`,
+		`{source=~"("}`,
+		`{source="api"} |= timeout`,
+		`{source="api"} garbage`,
+	}
+	for _, query := range invalid {
+		if _, err := logql.Parse(query); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	q, err := logql.ParseSelector(`{ level != "debug" }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Matches(map[string]string{"level": "info"}, "") || q.Matches(map[string]string{"level": "debug"}, "") {
+		t.Errorf("unexpected matches for %+v", q.Matchers[0])
+	}
+
+	if _, err := logql.ParseSelector(`{level="info"} |= "x"`); err == nil {
+		t.Error("expected line filters to be rejected in a selector")
+	}
+}
+
+func TestQuery_Take(t *testing.T) {
+	q, err := logql.Parse(`{tenant="acme", source="api"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, found, err := q.Take("tenant")
+	if err != nil || !found || value != "acme" {
+		t.Fatalf("Take = %q, %v, %v", value, found, err)
+	}
+	if len(q.Matchers) != 1 || q.Matchers[0].Name != "source" {
+		t.Errorf("tenant matcher not removed: %+v", q.Matchers)
+	}
+	if _, found, _ := q.Take("tenant"); found {
+		t.Error("expected no tenant left")
+	}
+
+	q, _ = logql.Parse(`{tenant=~"acme|globex"}`)
+	if _, _, err := q.Take("tenant"); err == nil {
+		t.Error("expected a regexp tenant matcher to be refused")
+	}
+}
+
+func TestQuery_String(t *testing.T) {
+	a, err := logql.Parse(`{source="api",level=~"error|warn"}   |= "time  out"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := logql.Parse(`{ level=~"error|warn", source="api" } |= "time  out"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{level=~"error|warn", source="api"} |= "time  out"`
+	if a.String() != want || b.String() != want {
+		t.Errorf("String() = %q and %q, want %q", a.String(), b.String(), want)
+	}
+
+	// Filters are applied in order, which is kept
+	c, err := logql.Parse(`{source="api"} |= "a" != "b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := logql.Parse(`{source="api"} != "b" |= "a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() == d.String() {
+		t.Errorf("expected filter order to be kept, got %q", c.String())
+	}
+}
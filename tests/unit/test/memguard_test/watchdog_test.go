@@ -0,0 +1,119 @@
+package memguard_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"parsec/internal/memguard"
+	"parsec/pkg/models"
+)
+
+// recorder is a Shedder recording what it was asked to do
+type recorder struct {
+	shrunk  bool
+	shrinks int
+	flushes int
+}
+
+func (r *recorder) ShrinkQueue(shrink bool) {
+	r.shrunk = shrink
+	r.shrinks++
+}
+
+func (r *recorder) Flush() { r.flushes++ }
+
+func newWatchdog(t *testing.T, used *atomic.Uint64, shedder memguard.Shedder) *memguard.Watchdog {
+	t.Helper()
+	w, err := memguard.New(memguard.Config{
+		Limit:       1000,
+		ShrinkQueue: 0.8,
+		RejectDebug: 0.9,
+		Flush:       0.95,
+		Usage:       used.Load,
+	}, shedder)
+	if err != nil || w == nil {
+		t.Fatalf("expected a watchdog, got %v, %v", w, err)
+	}
+	return w
+}
+
+func TestWatchdog_Levels(t *testing.T) {
+	var used atomic.Uint64
+	shedder := &recorder{}
+	w := newWatchdog(t, &used, shedder)
+
+	steps := []struct {
+		used    uint64
+		want    memguard.Level
+		shrunk  bool
+		flushes int
+	}{
+		{500, memguard.LevelNormal, false, 0},
+		{820, memguard.LevelShrinkQueue, true, 0},
+		{910, memguard.LevelRejectDebug, true, 0},
+		{960, memguard.LevelFlush, true, 1},
+		{960, memguard.LevelFlush, true, 2}, // flushes on every check
+		{920, memguard.LevelFlush, true, 3}, // within the hysteresis
+		{880, memguard.LevelRejectDebug, true, 3},
+		{700, memguard.LevelNormal, false, 3},
+		{990, memguard.LevelFlush, true, 4}, // straight to the top
+	}
+	for i, step := range steps {
+		used.Store(step.used)
+		if got := w.Check(); got != step.want {
+			t.Errorf("step %d (%d bytes): expected %s, got %s", i, step.used, step.want, got)
+		}
+		if shedder.shrunk != step.shrunk || shedder.flushes != step.flushes {
+			t.Errorf("step %d: expected shrunk=%v flushes=%d, got %v %d", i, step.shrunk, step.flushes, shedder.shrunk, shedder.flushes)
+		}
+	}
+
+	// The queue is shrunk and restored once per change, not per level
+	if shedder.shrinks != 3 {
+		t.Errorf("expected 3 queue changes, got %d", shedder.shrinks)
+	}
+}
+
+func TestWatchdog_Sheds(t *testing.T) {
+	var used atomic.Uint64
+	w := newWatchdog(t, &used, &recorder{})
+
+	used.Store(850)
+	w.Check()
+	if w.Sheds(models.SeverityDebug) {
+		t.Error("expected DEBUG events to be accepted while only the queue is shrunk")
+	}
+
+	used.Store(900)
+	w.Check()
+	if !w.Sheds(models.SeverityDebug) {
+		t.Error("expected DEBUG events to be shed")
+	}
+	if w.Sheds(models.SeverityInfo) || w.Sheds(models.SeverityError) {
+		t.Error("expected more severe events to be accepted")
+	}
+
+	// A nil watchdog sheds nothing
+	var none *memguard.Watchdog
+	if none.Sheds(models.SeverityDebug) || none.Level() != memguard.LevelNormal {
+		t.Error("expected a nil watchdog to shed nothing")
+	}
+}
+
+func TestNew(t *testing.T) {
+	// Without a limit (GOMEMLIMIT is unset in tests) there is no watchdog
+	w, err := memguard.New(memguard.Config{ShrinkQueue: 0.8, RejectDebug: 0.9, Flush: 0.95}, &recorder{})
+	if err != nil || w != nil {
+		t.Errorf("expected no watchdog, got %v, %v", w, err)
+	}
+
+	for _, cfg := range []memguard.Config{
+		{Limit: 1000},
+		{Limit: 1000, ShrinkQueue: 0.9, RejectDebug: 0.8, Flush: 0.95},
+		{Limit: 1000, ShrinkQueue: 0.8, RejectDebug: 0.9, Flush: 0.85},
+	} {
+		if _, err := memguard.New(cfg, &recorder{}); err == nil {
+			t.Errorf("expected an error for thresholds %g, %g, %g", cfg.ShrinkQueue, cfg.RejectDebug, cfg.Flush)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package metapolicy_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"parsec/internal/metapolicy"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func event(tenant string, metadata models.Metadata) *models.LogEvent {
+	return &models.LogEvent{ID: "evt-1", TenantID: tenant, Source: "api", Message: "ok", Metadata: metadata}
+}
+
+func TestEngine_GlobalLimits(t *testing.T) {
+	engine := metapolicy.NewEngine(nil, metapolicy.Limits{
+		MaxValueBytes: 8,
+		Deny:          []string{"Authorization", "x-secret-*"},
+	})
+
+	e := event("acme", models.Metadata{
+		"authorization":  "Bearer abc",
+		"x-secret-token": "t",
+		"path":           "/orders/123456",
+		"city":           "zürichzü",
+		"region":         "eu",
+	})
+	result, err := engine.Process(context.Background(), e)
+	if err != nil || !result.Changed {
+		t.Fatalf("unexpected result: %+v, %v", result, err)
+	}
+
+	want := map[string]string{"path": "/orders/", "city": "zürichz", "region": "eu"}
+	if len(e.Metadata) != len(want) {
+		t.Fatalf("unexpected metadata: %v", e.Metadata)
+	}
+	for key, value := range want {
+		if e.Metadata[key] != value {
+			t.Errorf("metadata %s = %q, want %q", key, e.Metadata[key], value)
+		}
+	}
+
+	// Events within the limits are untouched
+	clean := event("acme", models.Metadata{"region": "eu"})
+	if result, _ := engine.Process(context.Background(), clean); result.Changed {
+		t.Error("expected a compliant event to pass unchanged")
+	}
+}
+
+func TestEngine_TenantPolicy(t *testing.T) {
+	engine := metapolicy.NewEngine(nil, metapolicy.Limits{})
+	ctx := context.Background()
+
+	policy, err := engine.SetPolicy(ctx, "acme", metapolicy.Policy{
+		Allow: []string{"Order_ID", "http_*", "cookie"},
+		Deny:  []string{"cookie"},
+	})
+	if err != nil {
+		t.Fatalf("SetPolicy failed: %v", err)
+	}
+	if policy.Allow[0] != "order_id" {
+		t.Errorf("expected patterns to be lower-cased, got %v", policy.Allow)
+	}
+
+	e := event("acme", models.Metadata{"order_id": "1", "http_status": "200", "cookie": "c", "user": "alice"})
+	engine.Process(ctx, e)
+	if len(e.Metadata) != 2 || e.Metadata["order_id"] != "1" || e.Metadata["http_status"] != "200" {
+		t.Errorf("expected only allowed keys to remain, got %v", e.Metadata)
+	}
+
+	// Other tenants are unaffected
+	other := event("other", models.Metadata{"user": "bob"})
+	if engine.Process(ctx, other); other.Metadata["user"] != "bob" {
+		t.Error("policy leaked across tenants")
+	}
+}
+
+func TestEngine_RejectsInvalidPolicies(t *testing.T) {
+	engine := metapolicy.NewEngine(nil, metapolicy.Limits{})
+	ctx := context.Background()
+
+	if _, err := engine.SetPolicy(ctx, "acme", metapolicy.Policy{Deny: []string{"[a-"}}); !errors.Is(err, metapolicy.ErrInvalidPattern) {
+		t.Errorf("expected ErrInvalidPattern, got %v", err)
+	}
+
+	keys := strings.Split(strings.Repeat("k,", metapolicy.MaxPatterns+1), ",")
+	if _, err := engine.SetPolicy(ctx, "acme", metapolicy.Policy{Allow: keys}); !errors.Is(err, metapolicy.ErrTooManyKeys) {
+		t.Errorf("expected ErrTooManyKeys, got %v", err)
+	}
+}
+
+func TestEngine_SharedAcrossNodes(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	ctx := context.Background()
+	nodeA := metapolicy.NewEngine(store, metapolicy.Limits{})
+	nodeB := metapolicy.NewEngine(store, metapolicy.Limits{})
+
+	if _, err := nodeA.SetPolicy(ctx, "acme", metapolicy.Policy{Deny: []string{"password"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e := event("acme", models.Metadata{"password": "hunter2"})
+	if nodeB.Process(ctx, e); len(e.Metadata) != 0 {
+		t.Errorf("expected node B to strip the key, got %v", e.Metadata)
+	}
+
+	if _, err := nodeA.SetPolicy(ctx, "acme", metapolicy.Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !nodeB.Policy("acme").IsEmpty() {
+		t.Errorf("expected the policy to be cleared, got %+v", nodeB.Policy("acme"))
+	}
+}
+
+func TestEngine_NodesKeepEachOthersPolicies(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	ctx := context.Background()
+
+	// Neither node has loaded the other's policy before setting its own
+	nodeA := metapolicy.NewEngine(store, metapolicy.Limits{})
+	nodeB := metapolicy.NewEngine(store, metapolicy.Limits{})
+	if _, err := nodeA.SetPolicy(ctx, "acme", metapolicy.Policy{Deny: []string{"password"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nodeB.SetPolicy(ctx, "globex", metapolicy.Policy{Deny: []string{"password"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := metapolicy.NewEngine(store, metapolicy.Limits{})
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"acme", "globex"} {
+		if reader.Policy(tenantID).IsEmpty() {
+			t.Errorf("%s: policy lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the policies set here in place
+	noop := metapolicy.NewEngine(state.NewNoopStore(""), metapolicy.Limits{})
+	if _, err := noop.SetPolicy(ctx, "acme", metapolicy.Policy{Deny: []string{"password"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if noop.Policy("acme").IsEmpty() {
+		t.Error("reloading an empty store dropped the policy")
+	}
+}
@@ -0,0 +1,74 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"parsec/internal/abuse"
+	"parsec/internal/middleware"
+	"parsec/internal/state"
+)
+
+func TestAbuse(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	detector := abuse.NewDetector(store, abuse.Config{BlockThreshold: 3, BlockDuration: time.Minute})
+
+	handler := middleware.Abuse(detector)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("valid") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	send := func(remote, key, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/ingest"+query, nil)
+		r.RemoteAddr = remote
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Invalid payloads count against the key, wherever they come from
+	send("10.0.0.1:1000", "broken", "")
+	send("10.0.0.2:1000", "broken", "")
+	send("10.0.0.3:1000", "broken", "")
+	w := send("10.0.0.4:1000", "broken", "?valid=1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the key to be blocked, got %d", w.Code)
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "source_blocked" {
+		t.Errorf("unexpected body %s", w.Body.String())
+	}
+	if w := send("10.0.0.4:1000", "healthy", "?valid=1"); w.Code != http.StatusOK {
+		t.Errorf("other keys from the same IP: %d", w.Code)
+	}
+
+	// Missing credentials count against the IP
+	for i := 0; i < 3; i++ {
+		send("10.0.0.9:1000", "", "")
+	}
+	if w := send("10.0.0.9:2000", "healthy", "?valid=1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the IP to be blocked, got %d", w.Code)
+	}
+
+	// Without a detector nothing is counted
+	passthrough := middleware.Abuse(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodPost, "/ingest", nil)
+	rec := httptest.NewRecorder()
+	passthrough.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("nil detector: %d", rec.Code)
+	}
+}
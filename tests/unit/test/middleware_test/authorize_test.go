@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"parsec/internal/metrics"
+	"parsec/internal/middleware"
+	"parsec/internal/rbac"
+)
+
+func TestAuthorize(t *testing.T) {
+	authn, err := rbac.NewAuthenticator(rbac.Config{Keys: []rbac.Key{
+		{Key: "acme-ingest", Name: "acme-agents", Role: rbac.RoleIngest, Tenants: []string{"acme"}},
+		{Key: "acme-admin", Name: "acme-admins", Role: rbac.RoleTenantAdmin, Tenants: []string{"acme"}},
+		{Key: "viewer", Name: "dashboards", Role: rbac.RoleReadOnly},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var principal *rbac.Principal
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = rbac.FromContext(r.Context())
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/ingest", middleware.Authorize(authn, rbac.PermIngest)(ok))
+	mux.Handle("/heartbeats/{tenant}", middleware.Authorize(authn, rbac.PermIngest)(ok))
+	mux.Handle("/admin/flags", middleware.Authorize(authn, rbac.PermManage)(ok))
+	mux.Handle("/admin/tenants/{tenant}/routes", middleware.Authorize(authn, rbac.PermManage)(ok))
+	mux.Handle("/loki/api/v1/query_range", middleware.AuthorizeScoped(authn, rbac.PermManage)(ok))
+
+	tests := []struct {
+		method, path, key, orgID string
+		want                     int
+	}{
+		{http.MethodPost, "/ingest", "", "", http.StatusUnauthorized},
+		{http.MethodPost, "/ingest", "wrong", "", http.StatusUnauthorized},
+		// Tenant-limited ingest keys reach ingest; events are checked there
+		{http.MethodPost, "/ingest", "acme-ingest", "", http.StatusOK},
+		{http.MethodPut, "/heartbeats/acme", "acme-ingest", "", http.StatusOK},
+		{http.MethodPut, "/heartbeats/globex", "acme-ingest", "", http.StatusForbidden},
+		{http.MethodPost, "/ingest", "viewer", "", http.StatusForbidden},
+		{http.MethodGet, "/admin/flags", "viewer", "", http.StatusOK},
+		{http.MethodPut, "/admin/flags", "viewer", "", http.StatusForbidden},
+		{http.MethodGet, "/admin/flags", "acme-admin", "", http.StatusForbidden},
+		// Naming their own tenant doesn't open node-wide routes to tenant admins
+		{http.MethodGet, "/admin/flags", "acme-admin", "acme", http.StatusForbidden},
+		{http.MethodPut, "/admin/flags", "acme-admin", "acme", http.StatusForbidden},
+		{http.MethodPut, "/admin/tenants/acme/routes", "acme-admin", "", http.StatusOK},
+		{http.MethodPut, "/admin/tenants/globex/routes", "acme-admin", "", http.StatusForbidden},
+		{http.MethodGet, "/admin/tenants/globex/routes", "acme-ingest", "", http.StatusForbidden},
+		{http.MethodGet, "/loki/api/v1/query_range", "acme-admin", "acme", http.StatusOK},
+		{http.MethodGet, "/loki/api/v1/query_range", "acme-admin", "globex", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		principal = nil
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		if tt.orgID != "" {
+			r.Header.Set("X-Scope-OrgID", tt.orgID)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %q: expected %d, got %d: %s", tt.method, tt.path, tt.key, tt.want, w.Code, w.Body.String())
+		}
+		if tt.want == http.StatusOK && (principal == nil || principal.Name == "") {
+			t.Errorf("%s %s as %q: no principal in the context", tt.method, tt.path, tt.key)
+		}
+	}
+
+	if n := testutil.ToFloat64(metrics.AuthzDenials.WithLabelValues("manage", "forbidden")); n != 3 {
+		t.Errorf("expected 3 manage denials, got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.AuthzDenials.WithLabelValues("ingest", "unauthenticated")); n != 2 {
+		t.Errorf("expected 2 unauthenticated ingest requests, got %v", n)
+	}
+}
+
+func TestAuthorize_ExpiringKeyHeader(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	authn, err := rbac.NewAuthenticator(rbac.Config{Keys: []rbac.Key{
+		{Key: "soon", Name: "agents", Role: rbac.RoleIngest, ExpiresAt: expires},
+		{Key: "gone", Name: "agents", Role: rbac.RoleIngest, ExpiresAt: time.Now().Add(-time.Hour)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.Authorize(authn, rbac.PermIngest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodPost, "/ingest", nil)
+	r.Header.Set("X-API-Key", "soon")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-API-Key-Expires"); got != expires.UTC().Format(time.RFC3339) {
+		t.Errorf("X-API-Key-Expires = %q", got)
+	}
+
+	r.Header.Set("X-API-Key", "gone")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expired key: status %d", w.Code)
+	}
+}
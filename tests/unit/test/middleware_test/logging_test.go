@@ -0,0 +1,42 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"parsec/internal/metrics"
+	"parsec/internal/middleware"
+)
+
+func TestLogging_RecordsRoutePattern(t *testing.T) {
+	var route string
+	mux := http.NewServeMux()
+	mux.Handle("/admin/tenants/{tenant}/exports/{id}", middleware.Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = middleware.Route(r)
+	})))
+
+	for _, path := range []string{"/admin/tenants/acme/exports/1", "/admin/tenants/globex/exports/2"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	const pattern = "/admin/tenants/{tenant}/exports/{id}"
+	if route != pattern {
+		t.Errorf("expected route %q, got %q", pattern, route)
+	}
+	if n := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(http.MethodGet, pattern, "200")); n != 2 {
+		t.Errorf("expected both requests under the pattern, got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.HTTPRequestsTotal.WithLabelValues(http.MethodGet, "/admin/tenants/acme/exports/1", "200")); n != 0 {
+		t.Errorf("expected no series for the raw path, got %v", n)
+	}
+}
+
+func TestRoute_Unmatched(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/anything", nil)
+	if got := middleware.Route(r); got != "unmatched" {
+		t.Errorf("expected unmatched, got %q", got)
+	}
+}
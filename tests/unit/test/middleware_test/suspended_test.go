@@ -0,0 +1,66 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/middleware"
+	"parsec/internal/rbac"
+	"parsec/internal/suspension"
+)
+
+func TestSuspended(t *testing.T) {
+	registry := suspension.NewRegistry(nil)
+	ctx := context.Background()
+	registry.Suspend(ctx, suspension.Suspension{TenantID: "acme", Mode: suspension.ModePaused})
+	registry.Suspend(ctx, suspension.Suspension{TenantID: "globex", Mode: suspension.ModeBlocked})
+
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/ingest", middleware.Suspended(registry)(ok))
+	mux.Handle("/heartbeats/{tenant}", middleware.Suspended(registry)(ok))
+
+	tests := []struct {
+		path    string
+		tenants []string
+		want    int
+		code    string
+	}{
+		{"/ingest", nil, http.StatusOK, ""},
+		{"/heartbeats/acme", nil, http.StatusServiceUnavailable, "tenant_paused"},
+		{"/heartbeats/globex", nil, http.StatusForbidden, "tenant_blocked"},
+		{"/heartbeats/initech", nil, http.StatusOK, ""},
+		// Keys limited to suspended tenants only are refused up front
+		{"/ingest", []string{"globex"}, http.StatusForbidden, "tenant_blocked"},
+		{"/ingest", []string{"acme", "globex"}, http.StatusServiceUnavailable, "tenant_paused"},
+		{"/ingest", []string{"acme", "initech"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		if tt.tenants != nil {
+			principal := &rbac.Principal{Name: "agents", Role: rbac.RoleIngest, Tenants: tt.tenants}
+			r = r.WithContext(rbac.NewContext(r.Context(), principal))
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %v: status %d, want %d", tt.path, tt.tenants, w.Code, tt.want)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.code {
+			t.Errorf("%s %v: code %q, want %q", tt.path, tt.tenants, body.Code, tt.code)
+		}
+		if tt.want == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s %v: missing Retry-After", tt.path, tt.tenants)
+		}
+	}
+}
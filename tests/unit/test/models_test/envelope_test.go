@@ -0,0 +1,55 @@
+package models_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+func TestTimings_JSONOmitsUnreachedStages(t *testing.T) {
+	e := models.NewEnvelope(&models.LogEvent{ID: "evt-1", TenantID: "acme"}, "node-1")
+	if !e.Timings.Received.Equal(e.ReceivedAt) {
+		t.Errorf("received timing %s, want %s", e.Timings.Received, e.ReceivedAt)
+	}
+	e.Timings.Dequeued = e.Timings.Received.Add(20 * time.Millisecond)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"dequeued"`) || strings.Contains(string(data), `"published"`) {
+		t.Errorf("unexpected timings in %s", data)
+	}
+
+	var decoded models.Envelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Timings.Received.Equal(e.Timings.Received) || !decoded.Timings.Dequeued.Equal(e.Timings.Dequeued) || !decoded.Timings.Published.IsZero() {
+		t.Errorf("timings did not round-trip: %+v", decoded.Timings)
+	}
+	if wait := decoded.Timings.QueueWait(); wait != 20*time.Millisecond {
+		t.Errorf("queue wait %s, want 20ms", wait)
+	}
+}
+
+func TestTimings_Stages(t *testing.T) {
+	received := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timings := models.Timings{
+		Received:  received,
+		Dequeued:  received.Add(10 * time.Millisecond),
+		Persisted: received.Add(500 * time.Millisecond),
+	}
+
+	// A stage not reached is skipped; the next is timed from the last one
+	stages := timings.Stages()
+	if len(stages) != 2 || stages["dequeued"] != 10*time.Millisecond || stages["persisted"] != 490*time.Millisecond {
+		t.Errorf("unexpected stages %v", stages)
+	}
+	if len((models.Timings{}).Stages()) != 0 {
+		t.Error("expected no stages without timings")
+	}
+}
@@ -1,7 +1,7 @@
 package models_test
 
 import (
-	"parsec/internal/models"
+	"parsec/pkg/models"
 	"strings"
 	"testing"
 	"time"
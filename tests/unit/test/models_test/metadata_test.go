@@ -0,0 +1,87 @@
+package models_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"parsec/pkg/models"
+)
+
+func TestMetadata_Lookup(t *testing.T) {
+	metadata := models.Metadata{
+		"http":        map[string]any{"status": 503.0, "headers": map[string]any{"host": "api"}},
+		"tags":        []any{"a", true},
+		"user.id":     "42", // flattened by an older client
+		"description": "plain",
+	}
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"http.status", "503", true},
+		{"http.headers.host", "api", true},
+		{"tags.1", "true", true},
+		{"user.id", "42", true},
+		{"description", "plain", true},
+		{"tags.2", "", false},
+		{"http.missing", "", false},
+		{"description.x", "", false},
+	}
+	for _, tt := range tests {
+		v, ok := metadata.Lookup(tt.path)
+		if ok != tt.ok || models.Stringify(v) != tt.want {
+			t.Errorf("%s: got %v, %v", tt.path, v, ok)
+		}
+	}
+
+	if got := metadata.Get("http"); got != `{"headers":{"host":"api"},"status":503}` {
+		t.Errorf("expected objects as JSON, got %s", got)
+	}
+}
+
+func TestMetadata_Validate(t *testing.T) {
+	deep := any("leaf")
+	for i := 0; i <= models.MaxMetadataDepth; i++ {
+		deep = map[string]any{"a": deep}
+	}
+
+	tests := []struct {
+		name     string
+		metadata models.Metadata
+		want     error
+	}{
+		{"flat", models.Metadata{"a": "b", "n": 1.5, "ok": true, "none": nil}, nil},
+		{"too deep", models.Metadata{"deep": deep}, models.ErrMetadataTooDeep},
+		{"too large", models.Metadata{"big": strings.Repeat("x", models.MaxMetadataBytes)}, models.ErrMetadataTooLarge},
+		{"unsupported type", models.Metadata{"ch": make(chan int)}, models.ErrInvalidMetadata},
+	}
+	for _, tt := range tests {
+		if err := tt.metadata.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestStringify(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{"text", "text"},
+		{200.0, "200"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{int64(-3), "-3"},
+		{false, "false"},
+		{[]any{"a", 1.0}, `["a",1]`},
+	}
+	for _, tt := range tests {
+		if got := models.Stringify(tt.value); got != tt.want {
+			t.Errorf("Stringify(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"testing"
 	"time"
 
-	"parsec/internal/models"
+	"parsec/pkg/models"
 )
 
 func TestLogEventNormalize(t *testing.T) {
@@ -15,7 +15,7 @@ func TestLogEventNormalize(t *testing.T) {
 		Severity:  "info",
 		Source:    "  API-Gateway  ",
 		Message:   "  Request processed  ",
-		Metadata: map[string]string{
+		Metadata: models.Metadata{
 			"  KEY  ": "  value  ",
 		},
 		TraceID: "  trace-123  ",
@@ -0,0 +1,32 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+func TestParseRetention(t *testing.T) {
+	valid := map[string]time.Duration{
+		"3d":    3 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"7y":    7 * 365 * 24 * time.Hour,
+		"72h":   72 * time.Hour,
+		" 90m ": 90 * time.Minute,
+		"100y":  models.MaxRetention,
+	}
+	for s, want := range valid {
+		got, err := models.ParseRetention(s)
+		if err != nil || got != want {
+			t.Errorf("ParseRetention(%q) = %s, %v; want %s", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "d", "0d", "-3d", "1.5d", "101y", "forever", "0s", "100ms"} {
+		if _, err := models.ParseRetention(s); !errors.Is(err, models.ErrInvalidRetention) {
+			t.Errorf("ParseRetention(%q) = %v, want ErrInvalidRetention", s, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"parsec/pkg/models"
+)
+
+func TestLogEvent_SizeMatchesJSON(t *testing.T) {
+	base := models.LogEvent{
+		ID:        "evt-1",
+		TenantID:  "acme",
+		Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 123456789, time.UTC),
+		Severity:  models.SeverityInfo,
+		Source:    "api",
+		Message:   "ok",
+	}
+
+	tests := map[string]func(e *models.LogEvent){
+		"minimal": func(e *models.LogEvent) {},
+		"escapes": func(e *models.LogEvent) {
+			e.Message = "a \"quoted\" <tag> & \\ path\n\t\r\b\f\x01 \u2028 \u2029 \xff é 日本"
+		},
+		"offset timestamp": func(e *models.LogEvent) {
+			e.Timestamp = time.Date(2024, 1, 15, 10, 30, 0, 0, time.FixedZone("", -5*3600))
+		},
+		"metadata": func(e *models.LogEvent) {
+			e.Metadata = models.Metadata{
+				"region": "eu",
+				"http":   map[string]any{"status": 200.0, "ratio": 1e-7, "big": 1e21, "small": 0.5},
+				"tags":   []any{"a", true, nil, json.Number("12.50"), []any{}},
+				"empty":  map[string]any{},
+				"count":  int64(-42),
+			}
+		},
+		"typed metadata and tracing": func(e *models.LogEvent) {
+			e.TypedMetadata = map[string]any{"status": int64(503), "latency": 12.25, "ok": false}
+			e.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+			e.SpanID = "00f067aa0ba902b7"
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			event := base
+			mutate(&event)
+
+			data, err := json.Marshal(&event)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if got := event.Size(); got != len(data) {
+				t.Errorf("Size() = %d, want %d for %s", got, len(data), data)
+			}
+		})
+	}
+}
+
+func TestLogEvent_SizeAllocations(t *testing.T) {
+	event := models.LogEvent{
+		ID:        "evt-1",
+		TenantID:  "acme",
+		Timestamp: time.Now(),
+		Severity:  models.SeverityInfo,
+		Source:    "api",
+		Message:   "ok",
+		Metadata:  models.Metadata{"region": "eu", "status": 200.0},
+	}
+	if allocs := testing.AllocsPerRun(100, func() { event.Size() }); allocs != 0 {
+		t.Errorf("%.1f allocations per Size call, want 0", allocs)
+	}
+}
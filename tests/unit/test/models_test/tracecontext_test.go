@@ -0,0 +1,83 @@
+package models_test
+
+import (
+	"testing"
+
+	"parsec/pkg/models"
+)
+
+func TestExtractTraceContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     models.LogEvent
+		wantTrace string
+		wantSpan  string
+	}{
+		{
+			name:      "w3c traceparent metadata",
+			event:     models.LogEvent{Metadata: models.Metadata{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"}},
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:  "00f067aa0ba902b7",
+		},
+		{
+			name:      "b3 single header metadata",
+			event:     models.LogEvent{Metadata: models.Metadata{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"}},
+			wantTrace: "80f198ee56343ba864fe8b2a57d3eff7",
+			wantSpan:  "e457b5a2e4d86bd1",
+		},
+		{
+			name:      "b3 multi header metadata",
+			event:     models.LogEvent{Metadata: models.Metadata{"x-b3-traceid": "463ac35c9f6413ad", "x-b3-spanid": "a2fb4a1d1a96d312"}},
+			wantTrace: "463ac35c9f6413ad",
+			wantSpan:  "a2fb4a1d1a96d312",
+		},
+		{
+			name:      "traceparent in message",
+			event:     models.LogEvent{Message: "handled request traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 in 3ms"},
+			wantTrace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpan:  "00f067aa0ba902b7",
+		},
+		{
+			name:      "b3 in message",
+			event:     models.LogEvent{Message: `upstream call b3="463ac35c9f6413ad-a2fb4a1d1a96d312-1" ok`},
+			wantTrace: "463ac35c9f6413ad",
+			wantSpan:  "a2fb4a1d1a96d312",
+		},
+		{
+			name:  "all-zero trace id rejected",
+			event: models.LogEvent{Metadata: models.Metadata{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+		},
+		{
+			name:  "malformed b3 rejected",
+			event: models.LogEvent{Metadata: models.Metadata{"b3": "not-a-trace"}},
+		},
+		{
+			name:      "existing trace id kept",
+			event:     models.LogEvent{TraceID: "abc", SpanID: "def", Metadata: models.Metadata{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+			wantTrace: "abc",
+			wantSpan:  "def",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event
+			e.ExtractTraceContext()
+			if e.TraceID != tt.wantTrace || e.SpanID != tt.wantSpan {
+				t.Errorf("got trace=%q span=%q, want trace=%q span=%q", e.TraceID, e.SpanID, tt.wantTrace, tt.wantSpan)
+			}
+		})
+	}
+}
+
+func TestNormalizeExtractsTraceContext(t *testing.T) {
+	e := &models.LogEvent{
+		Message:  "test",
+		Metadata: models.Metadata{"TraceParent": " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 "},
+	}
+	e.Normalize()
+
+	if e.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace ID from normalized metadata, got %q", e.TraceID)
+	}
+}
@@ -0,0 +1,65 @@
+package models_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"parsec/pkg/models"
+)
+
+func TestTruncateMessage_KeepsHeadAndTail(t *testing.T) {
+	msg := "java.lang.IllegalStateException: boom\n" +
+		strings.Repeat("\tat com.example.Frame.call(Frame.java:42)\n", 3000) +
+		"Caused by: java.io.IOException: disk full"
+
+	e := &models.LogEvent{Message: msg}
+	policy := models.TruncationPolicy{Enabled: true, HeadBytes: 1024, TailBytes: 512}
+
+	if !e.TruncateMessage(policy) {
+		t.Fatal("expected message to be truncated")
+	}
+
+	if len(e.Message) > models.MaxMessageLength {
+		t.Errorf("truncated message still too long: %d", len(e.Message))
+	}
+	if !strings.HasPrefix(e.Message, "java.lang.IllegalStateException") {
+		t.Error("head of message not preserved")
+	}
+	if !strings.HasSuffix(e.Message, "Caused by: java.io.IOException: disk full") {
+		t.Error("tail of message not preserved")
+	}
+	if !strings.Contains(e.Message, "...[truncated ") {
+		t.Error("truncation marker missing")
+	}
+	if e.Metadata[models.MetadataOriginalLength] != strconv.Itoa(len(msg)) {
+		t.Errorf("original length not recorded: %v", e.Metadata)
+	}
+}
+
+func TestTruncateMessage_OversizedPolicyStillFits(t *testing.T) {
+	e := &models.LogEvent{Message: strings.Repeat("é", models.MaxMessageLength)}
+	policy := models.TruncationPolicy{Enabled: true, HeadBytes: models.MaxMessageLength, TailBytes: models.MaxMessageLength}
+
+	e.TruncateMessage(policy)
+
+	if len(e.Message) > models.MaxMessageLength {
+		t.Errorf("truncated message too long: %d", len(e.Message))
+	}
+	if !utf8.ValidString(e.Message) {
+		t.Error("truncation split a UTF-8 rune")
+	}
+}
+
+func TestTruncateMessage_Disabled(t *testing.T) {
+	msg := strings.Repeat("a", models.MaxMessageLength+1)
+	e := &models.LogEvent{Message: msg}
+
+	if e.TruncateMessage(models.TruncationPolicy{HeadBytes: 10, TailBytes: 10}) {
+		t.Error("disabled policy should not truncate")
+	}
+	if e.Message != msg {
+		t.Error("message modified by disabled policy")
+	}
+}
@@ -0,0 +1,315 @@
+package mqtt_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/mqtt"
+	"parsec/pkg/models"
+)
+
+// fakeBroker accepts one client, acknowledges its subscription and
+// publishes the queued messages at QoS 1
+type fakeBroker struct {
+	ln       net.Listener
+	messages []*packets.PublishPacket
+
+	mu       sync.Mutex
+	connect  *packets.ConnectPacket
+	topics   map[string]byte
+	acked    []uint16
+	conn     net.Conn
+	writeMu  sync.Mutex
+	finished chan struct{}
+}
+
+func newFakeBroker(t *testing.T, messages map[string]string) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, topics: make(map[string]byte), finished: make(chan struct{})}
+	id := uint16(1)
+	for topic, payload := range messages {
+		pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		pub.TopicName = topic
+		pub.Payload = []byte(payload)
+		pub.Qos = 1
+		pub.MessageID = id
+		id++
+		b.messages = append(b.messages, pub)
+	}
+	go b.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		b.mu.Lock()
+		if b.conn != nil {
+			b.conn.Close()
+		}
+		b.mu.Unlock()
+		<-b.finished
+	})
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *fakeBroker) write(p packets.ControlPacket) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	p.Write(b.conn)
+}
+
+func (b *fakeBroker) serve() {
+	defer close(b.finished)
+	conn, err := b.ln.Accept()
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.connect = p
+			b.mu.Unlock()
+			b.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			b.mu.Lock()
+			for i, topic := range p.Topics {
+				b.topics[topic] = p.Qoss[i]
+			}
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = p.Qoss
+			b.write(ack)
+			for _, pub := range b.messages {
+				b.write(pub)
+			}
+		case *packets.PubackPacket:
+			b.mu.Lock()
+			b.acked = append(b.acked, p.MessageID)
+			b.mu.Unlock()
+		case *packets.PingreqPacket:
+			b.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// waitAcked waits until n messages were acknowledged
+func (b *fakeBroker) waitAcked(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		got := len(b.acked)
+		b.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d acknowledgements", n)
+}
+
+// sink records submitted events, rejecting the first full attempts as if
+// the queue were full
+type sink struct {
+	mu     sync.Mutex
+	full   int
+	events map[string]*models.LogEvent
+}
+
+func (s *sink) Submit(_ context.Context, event *models.LogEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full > 0 {
+		s.full--
+		return handlers.ErrQueueFull
+	}
+	if s.events == nil {
+		s.events = make(map[string]*models.LogEvent)
+	}
+	s.events[event.Message] = event
+	return nil
+}
+
+func (s *sink) wait(t *testing.T, n int) map[string]*models.LogEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		if len(s.events) >= n {
+			s.mu.Unlock()
+			return s.events
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d events", n)
+	return nil
+}
+
+func testConfig(broker string) config.MQTTConfig {
+	cfg := config.Default().MQTT
+	cfg.Broker = broker
+	cfg.Topics = []string{"devices/+/+/logs", "alerts/#"}
+	cfg.Username = "parsec"
+	cfg.Password = "secret"
+	cfg.TopicTemplate = "devices/{tenant}/{device}/logs"
+	return cfg
+}
+
+func TestBridge_ConvertsMessages(t *testing.T) {
+	broker := newFakeBroker(t, map[string]string{
+		"devices/acme/sensor-7/logs": `{"msg":"temperature high","level":"warn","celsius":81}`,
+		"alerts/door":                "door opened",
+	})
+
+	s := &sink{}
+	bridge, err := mqtt.New(testConfig(broker.url()), "node-1", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge.Start(context.Background())
+	defer bridge.Close()
+
+	events := s.wait(t, 2)
+	broker.waitAcked(t, 2)
+
+	broker.mu.Lock()
+	if broker.connect.ClientIdentifier != "parsec-node-1" || broker.connect.Username != "parsec" || string(broker.connect.Password) != "secret" {
+		t.Errorf("unexpected connect: %s", broker.connect)
+	}
+	if broker.topics["devices/+/+/logs"] != 1 || broker.topics["alerts/#"] != 1 {
+		t.Errorf("unexpected subscriptions: %v", broker.topics)
+	}
+	broker.mu.Unlock()
+
+	// The template sets the tenant and device
+	high := events["temperature high"]
+	if high == nil {
+		t.Fatalf("missing device event: %v", events)
+	}
+	if high.TenantID != "acme" || high.Source != "mqtt" || high.Severity != models.SeverityWarning {
+		t.Errorf("unexpected device event: %+v", high)
+	}
+	for key, want := range map[string]string{
+		mqtt.MetadataTopic: "devices/acme/sensor-7/logs",
+		"device":           "sensor-7",
+		"celsius":          "81",
+	} {
+		if got := high.Metadata.Get(key); got != want {
+			t.Errorf("metadata %s = %q, want %q", key, got, want)
+		}
+	}
+	if err := high.Validate(); err != nil {
+		t.Errorf("event should validate: %v", err)
+	}
+
+	// Topics outside the template keep the defaults
+	door := events["door opened"]
+	if door == nil || door.TenantID != "system" || door.Metadata[mqtt.MetadataTopic] != "alerts/door" || door.Metadata.Get("device") != "" {
+		t.Errorf("unexpected alert event: %+v", door)
+	}
+}
+
+func TestBridge_AcknowledgesAfterFullQueue(t *testing.T) {
+	broker := newFakeBroker(t, map[string]string{"alerts/smoke": "smoke detected"})
+
+	s := &sink{full: 3}
+	bridge, err := mqtt.New(testConfig(broker.url()), "node-1", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge.Start(context.Background())
+	defer bridge.Close()
+
+	s.wait(t, 1)
+	broker.waitAcked(t, 1)
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	cfg := testConfig("tcp://127.0.0.1:1883")
+	cfg.QoS = 3
+	if _, err := mqtt.New(cfg, "node", &sink{}); err == nil {
+		t.Error("expected error for invalid QoS")
+	}
+
+	cfg = testConfig("tcp://127.0.0.1:1883")
+	cfg.Topics = []string{" "}
+	if _, err := mqtt.New(cfg, "node", &sink{}); err == nil {
+		t.Error("expected error without topics")
+	}
+
+	cfg = testConfig("tcp://127.0.0.1:1883")
+	cfg.Format = "xml"
+	if _, err := mqtt.New(cfg, "node", &sink{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+
+	cfg = testConfig("tcp://127.0.0.1:1883")
+	cfg.CAFile = "/nonexistent/ca.pem"
+	if _, err := mqtt.New(cfg, "node", &sink{}); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
+
+func TestTemplate_Match(t *testing.T) {
+	tests := []struct {
+		template string
+		topic    string
+		vars     map[string]string
+	}{
+		{"devices/{tenant}/{device}/logs", "devices/acme/s1/logs", map[string]string{"tenant": "acme", "device": "s1"}},
+		{"devices/{tenant}/{device}/logs", "devices/acme/s1/metrics", nil},
+		{"devices/{tenant}/{device}/logs", "devices/acme/s1/logs/extra", nil},
+		{"devices/{tenant}//logs", "devices/acme/s1/logs", nil},
+		{"devices/{device}", "devices/", nil},
+		{"+/{device}/#", "site-3/pump/logs/stderr", map[string]string{"device": "pump"}},
+		{"{site}/#", "site-3", map[string]string{"site": "site-3"}},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := mqtt.ParseTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.template, err)
+		}
+		vars, ok := tmpl.Match(tt.topic)
+		if ok != (tt.vars != nil) {
+			t.Errorf("%s on %s: match = %v", tt.template, tt.topic, ok)
+			continue
+		}
+		for k, v := range tt.vars {
+			if vars[k] != v {
+				t.Errorf("%s on %s: %s = %q, want %q", tt.template, tt.topic, k, vars[k], v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"a/#/b", "a/{}/b", "a/{x}/{x}", "a/b+/c", "a/{x/b"} {
+		if _, err := mqtt.ParseTemplate(bad); err == nil {
+			t.Errorf("expected error for template %q", bad)
+		}
+	}
+}
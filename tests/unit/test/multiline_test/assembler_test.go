@@ -0,0 +1,112 @@
+package multiline_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/multiline"
+	"parsec/pkg/models"
+)
+
+func newEvent(id, source, stream, message string) *models.LogEvent {
+	return &models.LogEvent{
+		ID:        id,
+		TenantID:  "tenant-1",
+		Timestamp: time.Now(),
+		Severity:  models.SeverityError,
+		Source:    source,
+		Message:   message,
+		Metadata:  models.Metadata{multiline.MetadataStreamID: stream},
+	}
+}
+
+func newAssembler(t *testing.T, timeout time.Duration) *multiline.Assembler {
+	rules, err := multiline.ParseRules([]byte(`[{"source": "java-app", "start_pattern": "^\\d{4}-\\d{2}-\\d{2}"}]`))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+	return multiline.NewAssembler(multiline.Config{Rules: rules, FlushTimeout: timeout})
+}
+
+func TestAssembler_MergesStackTrace(t *testing.T) {
+	a := newAssembler(t, time.Minute)
+
+	lines := []string{
+		"2024-01-15 10:30:00 ERROR request failed",
+		"java.lang.NullPointerException: boom",
+		"at com.example.Service.handle(Service.java:42)",
+	}
+	for i, line := range lines {
+		if ready := a.Add(newEvent("evt-"+string(rune('1'+i)), "java-app", "stderr", line)); len(ready) != 0 {
+			t.Fatalf("line %d: expected event to be held, got %d ready", i, len(ready))
+		}
+	}
+
+	// The next start line releases the merged event
+	ready := a.Add(newEvent("evt-4", "java-app", "stderr", "2024-01-15 10:30:01 INFO next"))
+	if len(ready) != 1 {
+		t.Fatalf("expected 1 ready event, got %d", len(ready))
+	}
+
+	merged := ready[0]
+	if merged.ID != "evt-1" {
+		t.Errorf("expected first event ID to be kept, got %s", merged.ID)
+	}
+	want := lines[0] + "\n" + lines[1] + "\n" + lines[2]
+	if merged.Message != want {
+		t.Errorf("unexpected merged message:\n%s", merged.Message)
+	}
+	if merged.Metadata[multiline.MetadataLineCount] != "3" {
+		t.Errorf("expected line count 3, got %q", merged.Metadata[multiline.MetadataLineCount])
+	}
+}
+
+func TestAssembler_SeparatesStreamsAndSources(t *testing.T) {
+	a := newAssembler(t, time.Minute)
+
+	// No rule for this source: passes straight through
+	plain := newEvent("evt-1", "nginx", "stdout", "GET /")
+	if ready := a.Add(plain); len(ready) != 1 || ready[0] != plain {
+		t.Fatalf("expected unmatched source to pass through")
+	}
+
+	a.Add(newEvent("evt-2", "java-app", "stdout", "2024-01-15 10:30:00 INFO a"))
+	a.Add(newEvent("evt-3", "java-app", "stderr", "2024-01-15 10:30:00 ERROR b"))
+	a.Add(newEvent("evt-4", "java-app", "stderr", "continuation for b"))
+
+	if a.Pending() != 2 {
+		t.Errorf("expected 2 open streams, got %d", a.Pending())
+	}
+}
+
+func TestAssembler_FlushTimeout(t *testing.T) {
+	a := newAssembler(t, 50*time.Millisecond)
+
+	var mu sync.Mutex
+	var flushed []*models.LogEvent
+	emit := func(e *models.LogEvent) {
+		mu.Lock()
+		flushed = append(flushed, e)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx, emit)
+
+	a.Add(newEvent("evt-1", "java-app", "stderr", "2024-01-15 10:30:00 ERROR failed"))
+	a.Add(newEvent("evt-2", "java-app", "stderr", "caused by: timeout"))
+
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(flushed) != 1 {
+		t.Fatalf("expected 1 flushed event, got %d", len(flushed))
+	}
+	if flushed[0].Message != "2024-01-15 10:30:00 ERROR failed\ncaused by: timeout" {
+		t.Errorf("unexpected flushed message: %q", flushed[0].Message)
+	}
+}
@@ -0,0 +1,174 @@
+package nats_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/nats"
+	"parsec/pkg/models"
+)
+
+// fakeJetStream acknowledges publishes, failing the first failures of them
+type fakeJetStream struct {
+	jetstream.JetStream
+
+	mu        sync.Mutex
+	created   *jetstream.StreamConfig
+	published []*natsgo.Msg
+	failures  int
+}
+
+func (f *fakeJetStream) Stream(ctx context.Context, name string) (jetstream.Stream, error) {
+	return nil, jetstream.ErrStreamNotFound
+}
+
+func (f *fakeJetStream) CreateStream(ctx context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error) {
+	f.created = &cfg
+	return nil, nil
+}
+
+func (f *fakeJetStream) PublishMsgAsync(msg *natsgo.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	future := &fakeFuture{msg: msg, ok: make(chan *jetstream.PubAck, 1), err: make(chan error, 1)}
+	if f.failures > 0 {
+		f.failures--
+		future.err <- errors.New("no responders")
+		return future, nil
+	}
+	f.published = append(f.published, msg)
+	future.ok <- &jetstream.PubAck{Stream: "PARSEC"}
+	return future, nil
+}
+
+type fakeFuture struct {
+	msg *natsgo.Msg
+	ok  chan *jetstream.PubAck
+	err chan error
+}
+
+func (f *fakeFuture) Ok() <-chan *jetstream.PubAck { return f.ok }
+func (f *fakeFuture) Err() <-chan error            { return f.err }
+func (f *fakeFuture) Msg() *natsgo.Msg             { return f.msg }
+
+func natsConfig() config.NATSConfig {
+	return config.NATSConfig{
+		Stream:         "PARSEC",
+		SubjectPrefix:  "parsec.",
+		PublishTimeout: time.Second,
+	}
+}
+
+func message(id, topic string) bus.Message {
+	return bus.Message{
+		Topic: topic,
+		Key:   []byte("acme"),
+		Value: []byte(`{"event":{}}`),
+		Headers: []bus.Header{
+			{Key: "tenant_id", Value: []byte("acme")},
+			{Key: "event_id", Value: []byte(id)},
+			{Key: "priority", Value: []byte("high")},
+		},
+	}
+}
+
+func TestSender_CreatesStreamAndPublishes(t *testing.T) {
+	js := &fakeJetStream{}
+	s, err := nats.New(context.Background(), js, natsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if js.created == nil || js.created.Subjects[0] != "parsec.>" {
+		t.Fatalf("expected stream over parsec.>, got %+v", js.created)
+	}
+
+	errs := s.Send(context.Background(), []bus.Message{message("evt-1", "logs"), message("evt-2", "audit")})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(js.published) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(js.published))
+	}
+	first, second := js.published[0], js.published[1]
+	if first.Subject != "parsec.logs" || second.Subject != "parsec.audit" {
+		t.Errorf("unexpected subjects %q, %q", first.Subject, second.Subject)
+	}
+	if first.Header.Get(jetstream.MsgIDHeader) != "evt-1" {
+		t.Errorf("expected message ID evt-1, got %q", first.Header.Get(jetstream.MsgIDHeader))
+	}
+	if first.Header.Get("tenant_id") != "acme" || first.Header.Get("priority") != "high" || first.Header.Get("partition_key") != "acme" {
+		t.Errorf("unexpected headers %v", first.Header)
+	}
+}
+
+func TestSender_ReportsFailuresPerMessage(t *testing.T) {
+	js := &fakeJetStream{failures: 1}
+	s, err := nats.New(context.Background(), js, natsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := s.Send(context.Background(), []bus.Message{message("a", "logs"), message("b", "logs")})
+	if errs[0] == nil || errs[1] != nil {
+		t.Fatalf("expected only the first message to fail, got %v", errs)
+	}
+	if len(js.published) != 1 || js.published[0].Header.Get("event_id") != "b" {
+		t.Errorf("unexpected published messages %v", js.published)
+	}
+}
+
+func TestSender_RetriedThroughDispatcher(t *testing.T) {
+	js := &fakeJetStream{failures: 2}
+	s, err := nats.New(context.Background(), js, natsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := bus.NewDispatcher(bus.BackendNATS, s, &bus.Encoder{Topic: "logs"}, bus.DispatchConfig{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	// Two failures are retried; only the unacknowledged messages are resent
+	if err := p.PublishBatch(context.Background(), []*models.Envelope{envelope("a"), envelope("b"), envelope("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(js.published) != 3 {
+		t.Errorf("expected 3 acknowledged messages, got %d", len(js.published))
+	}
+	if stats := p.Stats(); stats.MessagesSent != 3 || stats.MessagesFailed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func envelope(id string) *models.Envelope {
+	return &models.Envelope{
+		Event: &models.LogEvent{
+			ID:        id,
+			TenantID:  "acme",
+			Timestamp: time.Now(),
+			Severity:  models.SeverityError,
+			Message:   "boom",
+		},
+		PartitionKey: "acme",
+	}
+}
+
+func TestSender_RequiresStreamAndPrefix(t *testing.T) {
+	cfg := natsConfig()
+	cfg.SubjectPrefix = ""
+	if _, err := nats.New(context.Background(), &fakeJetStream{}, cfg); err == nil {
+		t.Error("expected error without a subject prefix")
+	}
+}
@@ -0,0 +1,49 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"parsec/internal/pipeline"
+	"parsec/pkg/models"
+	public "parsec/pkg/pipeline"
+)
+
+// redactStage is a stage written against the public API only
+type redactStage struct{ dryRuns int }
+
+func (*redactStage) Name() string { return "redact" }
+
+func (s *redactStage) Process(ctx context.Context, event *models.LogEvent) (public.Result, error) {
+	if public.IsDryRun(ctx) {
+		s.dryRuns++
+	}
+	if event.Message == "drop me" {
+		return public.Result{Drop: true}, nil
+	}
+	event.Message = "[redacted]"
+	return public.Result{Changed: true}, nil
+}
+
+func TestPublicStage_RunsInPipeline(t *testing.T) {
+	stage := &redactStage{}
+	p := pipeline.New(stage)
+
+	event := &models.LogEvent{Message: "secret"}
+	if err := p.Run(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Message != "[redacted]" {
+		t.Errorf("expected the stage to run, got %q", event.Message)
+	}
+
+	// Sentinels and dry runs are shared with the internal package
+	err := p.Run(pipeline.WithDryRun(context.Background()), &models.LogEvent{Message: "drop me"})
+	if !errors.Is(err, public.ErrDropped) || !errors.Is(err, pipeline.ErrDropped) {
+		t.Errorf("expected ErrDropped, got %v", err)
+	}
+	if stage.dryRuns != 1 {
+		t.Errorf("expected the stage to see one dry run, got %d", stage.dryRuns)
+	}
+}
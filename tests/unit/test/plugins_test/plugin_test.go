@@ -0,0 +1,213 @@
+package plugins_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/pipeline"
+	"parsec/internal/plugins"
+	"parsec/pkg/models"
+)
+
+// uleb and sleb encode LEB128 integers
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func section(id byte, contents ...[]byte) []byte {
+	var body []byte
+	for _, c := range contents {
+		body = append(body, c...)
+	}
+	return append(append([]byte{id}, uleb(uint64(len(body)))...), body...)
+}
+
+func name(s string) []byte {
+	return append(uleb(uint64(len(s))), s...)
+}
+
+// module builds a plugin exporting memory, parsec_alloc (always returning
+// 1024) and parsec_process with the given body. data is placed at offset 0.
+func module(process []byte, data string, imports ...[]byte) []byte {
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// Types: 0 = (i32) -> i32, 1 = (i32, i32) -> i64, 2 = (i32, i32) -> ()
+	wasm = append(wasm, section(1, []byte{0x03,
+		0x60, 0x01, 0x7f, 0x01, 0x7f,
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e,
+		0x60, 0x02, 0x7f, 0x7f, 0x00,
+	})...)
+
+	funcBase := byte(len(imports))
+	if len(imports) > 0 {
+		wasm = append(wasm, section(2, append(uleb(uint64(len(imports))), concat(imports)...))...)
+	}
+
+	wasm = append(wasm, section(3, []byte{0x02, 0x00, 0x01})...)
+	wasm = append(wasm, section(5, []byte{0x01, 0x00, 0x01})...)
+	wasm = append(wasm, section(7, []byte{0x03},
+		name("memory"), []byte{0x02, 0x00},
+		name(plugins.ExportAlloc), []byte{0x00, funcBase},
+		name(plugins.ExportProcess), []byte{0x00, funcBase + 1},
+	)...)
+
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	body := append([]byte{0x00}, append(process, 0x0b)...)
+	wasm = append(wasm, section(10, []byte{0x02},
+		uleb(uint64(len(alloc))), alloc,
+		uleb(uint64(len(body))), body,
+	)...)
+
+	if data != "" {
+		wasm = append(wasm, section(11, []byte{0x01, 0x00, 0x41, 0x00, 0x0b}, name(data))...)
+	}
+	return wasm
+}
+
+func concat(parts [][]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// returnData returns (0 << 32 | len(data)), i.e. the data segment
+func returnData(data string) []byte {
+	return append([]byte{0x42}, sleb(int64(len(data)))...)
+}
+
+var (
+	// identity returns its input: (ptr << 32) | len
+	identity = []byte{0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84}
+
+	// drop returns 0
+	drop = []byte{0x42, 0x00}
+
+	// spin loops forever
+	spin = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00}
+)
+
+func event() *models.LogEvent {
+	return &models.LogEvent{
+		ID:        "evt-1",
+		TenantID:  "tenant-1",
+		Timestamp: time.Now().UTC(),
+		Severity:  models.SeverityInfo,
+		Source:    "api",
+		Message:   "hello",
+	}
+}
+
+func load(t *testing.T, spec plugins.Spec, wasm []byte) *plugins.Plugin {
+	t.Helper()
+	if spec.Name == "" {
+		spec.Name = "test"
+	}
+	p, err := plugins.New(context.Background(), spec, wasm)
+	if err != nil {
+		t.Fatalf("failed to load plugin: %v", err)
+	}
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+func TestPlugin_Transform(t *testing.T) {
+	output := `{"tenant_id":"other","message":"rewritten","metadata":{"plugin":"yes"}}`
+	p := load(t, plugins.Spec{}, module(returnData(output), output))
+
+	e := event()
+	result, err := p.Process(context.Background(), e)
+	if err != nil || !result.Changed || result.Drop {
+		t.Fatalf("unexpected result: %+v, %v", result, err)
+	}
+	if e.Message != "rewritten" || e.Metadata["plugin"] != "yes" {
+		t.Errorf("output not applied: %+v", e)
+	}
+	if e.TenantID != "tenant-1" || e.Source != "api" {
+		t.Errorf("expected tenant and untouched fields preserved, got %+v", e)
+	}
+}
+
+func TestPlugin_IdentityAndDrop(t *testing.T) {
+	p := load(t, plugins.Spec{}, module(identity, ""))
+	e := event()
+	result, err := p.Process(context.Background(), e)
+	if err != nil || result.Changed || result.Drop || e.Message != "hello" {
+		t.Errorf("identity plugin changed the event: %+v, %v", result, err)
+	}
+
+	d := load(t, plugins.Spec{Tenants: []string{"tenant-1"}}, module(drop, ""))
+	if result, _ := d.Process(context.Background(), event()); !result.Drop {
+		t.Error("expected event to be dropped")
+	}
+
+	other := event()
+	other.TenantID = "tenant-2"
+	if result, _ := d.Process(pipeline.WithDryRun(context.Background()), other); result.Drop {
+		t.Error("plugin ran for a tenant it is not enabled for")
+	}
+}
+
+func TestPlugin_TimeoutPassesThrough(t *testing.T) {
+	p := load(t, plugins.Spec{TimeoutMS: 20}, module(spin, ""))
+
+	// Repeated calls must keep working after instances are killed
+	for i := 0; i < 2; i++ {
+		e := event()
+		start := time.Now()
+		result, err := p.Process(context.Background(), e)
+		if err != nil || result.Drop || result.Changed || result.Detail != "timeout" {
+			t.Fatalf("expected timed out event to pass through, got %+v, %v", result, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("timeout not enforced, took %s", elapsed)
+		}
+	}
+}
+
+func TestPlugin_Capabilities(t *testing.T) {
+	// Imports parsec.log with type (i32, i32) -> ()
+	importLog := concat([][]byte{name("parsec"), name("log"), {0x00, 0x02}})
+	wasm := module(identity, "", importLog)
+
+	if _, err := plugins.New(context.Background(), plugins.Spec{Name: "nolog"}, wasm); err == nil {
+		t.Error("expected plugin importing parsec.log without the capability to fail")
+	}
+
+	load(t, plugins.Spec{Capabilities: []string{plugins.CapabilityLog}}, wasm)
+
+	_, err := plugins.New(context.Background(), plugins.Spec{Name: "bad", Capabilities: []string{"network"}}, wasm)
+	if !errors.Is(err, plugins.ErrUnknownCap) {
+		t.Errorf("expected ErrUnknownCap, got %v", err)
+	}
+
+	// Modules without the ABI are rejected at load time
+	bare := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	if _, err := plugins.New(context.Background(), plugins.Spec{Name: "bare"}, bare); !errors.Is(err, plugins.ErrMissingExport) {
+		t.Errorf("expected ErrMissingExport, got %v", err)
+	}
+}
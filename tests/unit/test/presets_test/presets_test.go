@@ -0,0 +1,203 @@
+package presets_test
+
+import (
+	"fmt"
+	"testing"
+
+	"parsec/internal/presets"
+	"parsec/pkg/models"
+)
+
+func TestPresets_Extraction(t *testing.T) {
+	tests := []struct {
+		preset       string
+		message      string
+		metadata     models.Metadata
+		wantSeverity models.Severity
+		wantMessage  string
+		wantFields   map[string]string
+	}{
+		{
+			preset:       "nginx",
+			message:      `10.0.0.1 - - [15/Jan/2024:10:30:00 +0000] "GET /api/users HTTP/1.1" 503 512 "-" "curl/8.0"`,
+			wantSeverity: models.SeverityError,
+			wantFields:   map[string]string{"status": "503", "method": "GET", "path": "/api/users"},
+		},
+		{
+			preset:       "nginx",
+			message:      `2024/01/15 10:30:00 [warn] 12#12: *7 upstream response is buffered`,
+			wantSeverity: models.SeverityWarning,
+			wantMessage:  "upstream response is buffered",
+		},
+		{
+			preset:       "envoy",
+			message:      `[2024-01-15T10:30:00.000Z] "POST /orders HTTP/2" 404 NR 0 0 1 - "-" "grpc-go" "abc" "orders" "-"`,
+			wantSeverity: models.SeverityWarning,
+			wantFields:   map[string]string{"response_flags": "NR", "authority": "orders"},
+		},
+		{
+			preset:       "postgres",
+			message:      `2024-01-15 10:30:00.123 UTC [4242] FATAL:  password authentication failed for user "app"`,
+			wantSeverity: models.SeverityCritical,
+			wantFields:   map[string]string{"pid": "4242"},
+		},
+		{
+			preset:       "jvm",
+			message:      `2024-01-15 10:30:00,123 [main] WARN com.example.Service - slow query`,
+			wantSeverity: models.SeverityWarning,
+			wantFields:   map[string]string{"logger": "com.example.Service", "thread": "main"},
+		},
+		{
+			preset:       "jvm",
+			message:      `at com.example.Service.handle(Service.java:42)`,
+			wantSeverity: models.SeverityError,
+		},
+		{
+			preset:       "systemd",
+			message:      `2024-01-15T10:30:00+0000 host-1 sshd[812]: Accepted publickey for deploy`,
+			metadata:     models.Metadata{"priority": "4"},
+			wantSeverity: models.SeverityWarning,
+			wantMessage:  "Accepted publickey for deploy",
+			wantFields:   map[string]string{"unit": "sshd", "pid": "812"},
+		},
+		{
+			preset:       "cef",
+			message:      `<134>Jan 15 10:30:00 fw-1 CEF:0|Palo Alto|PAN-OS|10.1|THREAT|Port scan \| sweep|8|src=10.0.0.5 dst=10.0.0.9 dpt=22 act=blocked msg=scan from a\=b \\ host cs1Label=Rule Name cs1=block ssh`,
+			wantSeverity: models.SeverityError,
+			wantMessage:  `scan from a=b \ host`,
+			wantFields: map[string]string{
+				"device_vendor": "Palo Alto",
+				"name":          "Port scan | sweep",
+				"signature_id":  "THREAT",
+				"src":           "10.0.0.5",
+				"dpt":           "22",
+				"act":           "blocked",
+				"Rule Name":     "block ssh",
+				"log_format":    "cef",
+			},
+		},
+		{
+			preset:       "cef",
+			message:      `CEF:0|Snort|IDS|2.9|1000|ICMP flood|Very-High|`,
+			wantSeverity: models.SeverityCritical,
+			wantMessage:  "ICMP flood",
+			wantFields:   map[string]string{"device_product": "IDS"},
+		},
+		{
+			preset:       "leef",
+			message:      "LEEF:1.0|IBM|QRadar|7.5|Login Failed|src=10.1.1.1\tusrName=alice\tsev=5\tcat=auth failure",
+			wantSeverity: models.SeverityWarning,
+			wantFields:   map[string]string{"event_id": "Login Failed", "usrName": "alice", "cat": "auth failure"},
+		},
+		{
+			preset:       "leef",
+			message:      "<13>Jan 15 10:30:00 ids LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=9",
+			wantSeverity: models.SeverityCritical,
+			wantFields:   map[string]string{"device_vendor": "Lancope", "src": "10.0.1.8", "dst": "10.0.0.5"},
+		},
+		{
+			preset:       "leef",
+			message:      "LEEF:2.0|Vendor|Product|1.0|7|x7C|a=1|b=2",
+			wantSeverity: models.SeverityInfo,
+			wantFields:   map[string]string{"a": "1", "b": "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			p, ok := presets.Get(tt.preset)
+			if !ok {
+				t.Fatalf("preset %s not found", tt.preset)
+			}
+
+			e := &models.LogEvent{Message: tt.message, Metadata: tt.metadata}
+			p.Apply(e)
+
+			if e.Severity != tt.wantSeverity {
+				t.Errorf("severity = %s, want %s", e.Severity, tt.wantSeverity)
+			}
+			if tt.wantMessage != "" && e.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", e.Message, tt.wantMessage)
+			}
+			for k, v := range tt.wantFields {
+				if e.Metadata[k] != v {
+					t.Errorf("metadata[%s] = %q, want %q", k, e.Metadata[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_Bindings(t *testing.T) {
+	bindings, err := presets.ParseBindings([]byte(`[
+		{"tenant_id": "*", "source": "web", "preset": "nginx"},
+		{"tenant_id": "tenant-a", "source": "web", "preset": "envoy"},
+		{"source": "api", "preset": "jvm"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := presets.NewRegistry(bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, _ := registry.Apply(&models.LogEvent{TenantID: "tenant-a", Source: "web"}); name != "envoy" {
+		t.Errorf("expected tenant-specific binding to win, got %q", name)
+	}
+	if name, _ := registry.Apply(&models.LogEvent{TenantID: "tenant-b", Source: "web"}); name != "nginx" {
+		t.Errorf("expected wildcard binding, got %q", name)
+	}
+	if name, _ := registry.Apply(&models.LogEvent{TenantID: "tenant-b", Source: "db"}); name != "" {
+		t.Errorf("expected no binding, got %q", name)
+	}
+
+	rules, err := registry.MultilineRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Source != "api" {
+		t.Errorf("expected one multi-line rule for the jvm binding, got %+v", rules)
+	}
+}
+
+func TestRegistry_UnknownPreset(t *testing.T) {
+	if _, err := presets.NewRegistry([]presets.Binding{{Source: "x", Preset: "iis"}}); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
+
+func TestPresets_CEFManyExtensions(t *testing.T) {
+	message := "CEF:0|Vendor|Product|1|1|Noisy|3|"
+	for i := 0; i < 80; i++ {
+		message += fmt.Sprintf(" k%d=v%d", i, i)
+	}
+
+	p, _ := presets.Get("cef")
+	e := &models.LogEvent{Message: message}
+	if !p.Apply(e) {
+		t.Fatal("expected the record to parse")
+	}
+	if len(e.Metadata) > models.MaxMetadataKeys {
+		t.Errorf("metadata has %d keys, limit is %d", len(e.Metadata), models.MaxMetadataKeys)
+	}
+	if e.Metadata[presets.MetadataFormat] != "cef" {
+		t.Error("expected the format key to be kept")
+	}
+}
+
+func TestPresets_NotSecurityFormat(t *testing.T) {
+	for _, name := range []string{"cef", "leef"} {
+		p, _ := presets.Get(name)
+		for _, message := range []string{"plain text", "CEF:0|too|few", "LEEF:one|a|b|c|d|x=1"} {
+			e := &models.LogEvent{Message: message}
+			if p.Apply(e) {
+				t.Errorf("%s: %q should not parse", name, message)
+			}
+			if e.Message != message || e.Severity != models.SeverityInfo {
+				t.Errorf("%s: unexpected event %+v", name, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package pubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/pubsub"
+)
+
+type publishRequest struct {
+	Messages []struct {
+		Data       []byte
+		Attributes map[string]string
+	}
+}
+
+func newSender(t *testing.T, handler http.HandlerFunc) *pubsub.Sender {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	s, err := pubsub.NewWithClient(config.PubSubConfig{
+		Project:     "acme-prod",
+		TopicPrefix: "parsec-",
+		Endpoint:    srv.URL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSender_PublishesPerTopic(t *testing.T) {
+	requests := make(map[string]publishRequest)
+	s := newSender(t, func(w http.ResponseWriter, r *http.Request) {
+		var req publishRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests[r.URL.Path] = req
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	})
+
+	msgs := []bus.Message{
+		{Topic: "logs", Key: []byte("acme"), Value: []byte("one"), Headers: []bus.Header{{Key: "tenant_id", Value: []byte("acme")}}},
+		{Topic: "audit", Value: []byte("two")},
+		{Topic: "logs", Value: []byte("three")},
+	}
+	for _, err := range s.Send(context.Background(), msgs) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs := requests["/v1/projects/acme-prod/topics/parsec-logs:publish"]
+	if len(logs.Messages) != 2 || len(requests) != 2 {
+		t.Fatalf("expected one request per topic, got %v", requests)
+	}
+	first := logs.Messages[0]
+	if string(first.Data) != "one" || first.Attributes["tenant_id"] != "acme" || first.Attributes["partition_key"] != "acme" {
+		t.Errorf("unexpected message %+v", first)
+	}
+}
+
+func TestSender_ClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		permanent bool
+	}{
+		{"missing topic", http.StatusNotFound, true},
+		{"invalid", http.StatusBadRequest, true},
+		{"throttled", http.StatusTooManyRequests, false},
+		{"unavailable", http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSender(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tt.status)
+			})
+
+			errs := s.Send(context.Background(), []bus.Message{{Topic: "logs", Value: []byte("x")}, {Topic: "logs", Value: []byte("y")}})
+			var permanent *bus.PermanentError
+			for _, err := range errs {
+				if err == nil || errors.As(err, &permanent) != tt.permanent {
+					t.Errorf("expected permanent=%v, got %v", tt.permanent, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package querycache_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"parsec/internal/querycache"
+	"parsec/internal/state"
+)
+
+func TestCache_HitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{TTL: time.Minute})
+
+	var loads int
+	load := func(context.Context) ([]byte, error) {
+		loads++
+		return []byte("result"), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		data, err := cache.Do(ctx, "acme", "q1", load)
+		if err != nil || string(data) != "result" {
+			t.Fatalf("Do = %q, %v", data, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected 1 load, got %d", loads)
+	}
+
+	// Keys and tenants are cached apart
+	cache.Do(ctx, "acme", "q2", load)
+	cache.Do(ctx, "globex", "q1", load)
+	if loads != 3 {
+		t.Fatalf("expected 3 loads, got %d", loads)
+	}
+
+	// Invalidating a tenant reloads its queries only
+	if err := cache.Invalidate(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	cache.Do(ctx, "acme", "q1", load)
+	cache.Do(ctx, "globex", "q1", load)
+	if loads != 4 {
+		t.Errorf("expected 4 loads after invalidation, got %d", loads)
+	}
+}
+
+func TestCache_SkipsFailuresAndLargeResults(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{TTL: time.Minute, MaxBytes: 8})
+
+	var loads int
+	failing := func(context.Context) ([]byte, error) {
+		loads++
+		return nil, errors.New("scan failed")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Do(ctx, "acme", "failing", failing); err == nil {
+			t.Fatal("expected the load's error")
+		}
+	}
+
+	large := func(context.Context) ([]byte, error) {
+		loads++
+		return []byte(strings.Repeat("x", 9)), nil
+	}
+	for i := 0; i < 2; i++ {
+		if data, err := cache.Do(ctx, "acme", "large", large); err != nil || len(data) != 9 {
+			t.Fatalf("Do = %q, %v", data, err)
+		}
+	}
+	if loads != 4 {
+		t.Errorf("expected failed and oversized results to be reloaded, got %d loads", loads)
+	}
+}
+
+func TestCache_SharesConcurrentLoads(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{TTL: time.Minute})
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return []byte("result"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := cache.Do(ctx, "acme", "q", load); err != nil || string(data) != "result" {
+				t.Errorf("Do = %q, %v", data, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("expected concurrent misses to share 1 load, got %d", n)
+	}
+}
+
+func TestCache_SharedLoadOutlivesCancelledCaller(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{TTL: time.Minute})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context) ([]byte, error) {
+		close(started)
+		select {
+		case <-release:
+			return []byte("result"), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := cache.Do(first, "acme", "q1", load)
+		firstErr <- err
+	}()
+	<-started
+
+	second := make(chan []byte, 1)
+	go func() {
+		data, err := cache.Do(context.Background(), "acme", "q1", func(context.Context) ([]byte, error) {
+			return nil, errors.New("second load should share the first")
+		})
+		if err != nil {
+			t.Errorf("second caller: %v", err)
+		}
+		second <- data
+	}()
+
+	// The caller that started the load gives up; it returns at once and
+	// the load carries on for the other
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller: got %v", err)
+	}
+	close(release)
+	if data := <-second; string(data) != "result" {
+		t.Errorf("second caller got %q", data)
+	}
+}
+
+func TestCache_Bucket(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	cache := querycache.New(store, querycache.Config{Bucket: 10 * time.Second})
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if cache.Bucket(base.Add(3*time.Second)) != cache.Bucket(base.Add(9*time.Second)) {
+		t.Error("expected times within a bucket to share a key")
+	}
+	if cache.Bucket(base.Add(9*time.Second)) == cache.Bucket(base.Add(10*time.Second)) {
+		t.Error("expected times in different buckets to differ")
+	}
+}
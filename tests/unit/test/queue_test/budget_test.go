@@ -0,0 +1,137 @@
+package queue_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/queue"
+	"parsec/pkg/models"
+)
+
+// sized returns an envelope whose event has a message of n bytes
+func sized(id string, n int) *models.Envelope {
+	e := envelope(id, models.SeverityInfo)
+	e.Event.Message = strings.Repeat("x", n)
+	return e
+}
+
+func TestBudget(t *testing.T) {
+	if queue.NewBudget(0) != nil {
+		t.Error("expected no budget for a zero limit")
+	}
+
+	b := queue.NewBudget(2500)
+	first, second, third := sized("a", 1000), sized("b", 1000), sized("c", 1000)
+	if !b.Acquire(first) || !b.Acquire(second) {
+		t.Fatal("expected two events to fit")
+	}
+	if first.Bytes != int64(first.Event.Size()) || b.Used() != first.Bytes+second.Bytes {
+		t.Errorf("unexpected charge %d, used %d", first.Bytes, b.Used())
+	}
+	if b.Acquire(third) {
+		t.Error("expected the third event not to fit")
+	}
+	if third.Bytes != 0 {
+		t.Errorf("expected the rejected envelope to be uncharged, got %d", third.Bytes)
+	}
+
+	b.Release(first)
+	if !b.Acquire(third) {
+		t.Error("expected room after a release")
+	}
+	b.Release(second, third)
+	b.Release(second) // already released
+	if b.Used() != 0 {
+		t.Errorf("expected an empty budget, got %d", b.Used())
+	}
+
+	// An event larger than the whole budget fits an empty one
+	if !b.Acquire(sized("big", 10000)) {
+		t.Error("expected an oversized event to fit an empty budget")
+	}
+
+	// A nil budget is unbounded
+	var none *queue.Budget
+	if !none.Acquire(sized("d", 1000)) || none.Used() != 0 {
+		t.Error("expected a nil budget to accept everything")
+	}
+}
+
+func TestOverflow_Budget(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	budget := queue.NewBudget(2500)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyReject, Grace: time.Hour, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !o.Offer(sized("a", 1000)) || !o.Offer(sized("b", 1000)) {
+		t.Fatal("expected two events to fit")
+	}
+	if o.Offer(sized("c", 1000)) {
+		t.Error("expected the queue to count as full once the budget is exhausted")
+	}
+
+	// Dequeuing alone doesn't free the bytes; publishing does
+	head := <-ch
+	if o.Offer(sized("c", 1000)) {
+		t.Error("expected the bytes to stay charged until released")
+	}
+	budget.Release(head)
+	if !o.Offer(sized("c", 1000)) {
+		t.Error("expected room once the head is released")
+	}
+}
+
+func TestOverflow_BudgetDropOldest(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	budget := queue.NewBudget(2500)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyDropOldest, Grace: time.Nanosecond, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.Offer(sized("a", 1000))
+	o.Offer(sized("b", 1000))
+	o.Offer(sized("c", 1000)) // marks the queue full
+	time.Sleep(time.Millisecond)
+	if !o.Offer(sized("d", 1000)) {
+		t.Fatal("expected the oldest envelope to be evicted")
+	}
+
+	got := ids(ch)
+	if len(got) != 2 || got[0] != "b" || got[1] != "d" {
+		t.Errorf("unexpected queue %v", got)
+	}
+	if used := budget.Used(); used != 2*int64(sized("x", 1000).Event.Size()) {
+		t.Errorf("expected two events charged, got %d bytes", used)
+	}
+}
+
+func TestOverflow_Watermarks(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	budget := queue.NewBudget(10000)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyReject, Grace: time.Hour, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if !o.Offer(sized(id, 1000)) {
+			t.Fatalf("expected %s to fit", id)
+		}
+	}
+	peakBytes := budget.Used()
+	for len(ch) > 0 {
+		budget.Release(<-ch)
+	}
+	o.Offer(sized("d", 1000))
+
+	if o.Peak() != 3 {
+		t.Errorf("expected a peak of 3 envelopes, got %d", o.Peak())
+	}
+	if budget.Peak() != peakBytes || budget.Max() != 10000 {
+		t.Errorf("expected a peak of %d bytes of 10000, got %d of %d", peakBytes, budget.Peak(), budget.Max())
+	}
+}
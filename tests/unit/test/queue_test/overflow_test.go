@@ -0,0 +1,283 @@
+package queue_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"parsec/internal/queue"
+	"parsec/pkg/models"
+)
+
+func envelope(id string, severity models.Severity) *models.Envelope {
+	return models.NewEnvelope(&models.LogEvent{
+		ID:       id,
+		TenantID: "acme",
+		Severity: severity,
+		Source:   "api",
+		Message:  "msg " + id,
+	}, "node-1")
+}
+
+// fill offers one envelope per severity and checks the queue is then full
+func fill(t *testing.T, o *queue.Overflow, ch chan *models.Envelope, severities ...models.Severity) {
+	t.Helper()
+	for i, s := range severities {
+		if !o.Offer(envelope(string(rune('a'+i)), s)) {
+			t.Fatalf("offer %d rejected before queue was full", i)
+		}
+	}
+	if len(ch) != cap(ch) {
+		t.Fatalf("queue has %d of %d", len(ch), cap(ch))
+	}
+}
+
+func ids(ch chan *models.Envelope) []string {
+	var out []string
+	for len(ch) > 0 {
+		out = append(out, (<-ch).Event.ID)
+	}
+	return out
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    queue.Policy
+		wantErr bool
+	}{
+		{"", queue.PolicyReject, false},
+		{"reject", queue.PolicyReject, false},
+		{"drop_oldest", queue.PolicyDropOldest, false},
+		{"drop_lowest_severity", queue.PolicyDropLowestSeverity, false},
+		{"spill", queue.PolicySpill, false},
+		{"drop_newest", "", true},
+	}
+	for _, tt := range tests {
+		got, err := queue.ParsePolicy(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestOverflow_GracePeriodRejects(t *testing.T) {
+	ch := make(chan *models.Envelope, 2)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyDropOldest, Grace: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, o, ch, models.SeverityInfo, models.SeverityInfo)
+
+	// Within the grace period the queue behaves like reject
+	if o.Offer(envelope("z", models.SeverityError)) {
+		t.Error("expected rejection within grace period")
+	}
+	if got := ids(ch); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("queue = %v", got)
+	}
+}
+
+func TestOverflow_Policies(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     queue.Policy
+		queued     []models.Severity
+		incoming   models.Severity
+		wantAccept bool
+		wantQueue  []string
+	}{
+		{
+			name:       "reject keeps queue",
+			policy:     queue.PolicyReject,
+			queued:     []models.Severity{models.SeverityDebug, models.SeverityInfo},
+			incoming:   models.SeverityError,
+			wantAccept: false,
+			wantQueue:  []string{"a", "b"},
+		},
+		{
+			name:       "drop oldest",
+			policy:     queue.PolicyDropOldest,
+			queued:     []models.Severity{models.SeverityError, models.SeverityInfo},
+			incoming:   models.SeverityDebug,
+			wantAccept: true,
+			wantQueue:  []string{"b", "z"},
+		},
+		{
+			name:       "drop lowest severity evicts queued",
+			policy:     queue.PolicyDropLowestSeverity,
+			queued:     []models.Severity{models.SeverityError, models.SeverityDebug, models.SeverityInfo},
+			incoming:   models.SeverityWarning,
+			wantAccept: true,
+			wantQueue:  []string{"a", "c", "z"},
+		},
+		{
+			name:       "drop lowest severity rejects incoming",
+			policy:     queue.PolicyDropLowestSeverity,
+			queued:     []models.Severity{models.SeverityError, models.SeverityInfo},
+			incoming:   models.SeverityDebug,
+			wantAccept: false,
+			wantQueue:  []string{"a", "b"},
+		},
+		{
+			name:       "drop lowest severity prefers oldest on ties",
+			policy:     queue.PolicyDropLowestSeverity,
+			queued:     []models.Severity{models.SeverityInfo, models.SeverityInfo},
+			incoming:   models.SeverityInfo,
+			wantAccept: true,
+			wantQueue:  []string{"b", "z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan *models.Envelope, len(tt.queued))
+			o, err := queue.New(ch, queue.Config{Policy: tt.policy, Grace: time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fill(t, o, ch, tt.queued...)
+
+			// First full offer starts the grace period
+			o.Offer(envelope("y", models.SeverityDebug))
+			time.Sleep(5 * time.Millisecond)
+
+			if got := o.Offer(envelope("z", tt.incoming)); got != tt.wantAccept {
+				t.Errorf("Offer() = %v, want %v", got, tt.wantAccept)
+			}
+			if got := ids(ch); !slices.Equal(got, tt.wantQueue) {
+				t.Errorf("queue = %v, want %v", got, tt.wantQueue)
+			}
+		})
+	}
+}
+
+func TestOverflow_SpillAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan *models.Envelope, 2)
+	o, err := queue.New(ch, queue.Config{
+		Policy: queue.PolicySpill,
+		Grace:  time.Millisecond,
+		Spill:  queue.SpillConfig{Dir: dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, o, ch, models.SeverityInfo, models.SeverityInfo)
+	o.Offer(envelope("y", models.SeverityInfo))
+	time.Sleep(5 * time.Millisecond)
+
+	for _, id := range []string{"c", "d", "e"} {
+		if !o.Offer(envelope(id, models.SeverityInfo)) {
+			t.Fatalf("spill of %s rejected", id)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ch); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("queue = %v", got)
+	}
+
+	// A restarted node replays what was left on disk
+	spill, err := queue.OpenSpill(ch, queue.SpillConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+
+	if err := spill.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ch); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("first replay = %v", got)
+	}
+	if err := spill.Replay(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ch); !slices.Equal(got, []string{"e"}) {
+		t.Errorf("second replay = %v", got)
+	}
+	if pending := spill.Pending(); pending != 0 {
+		t.Errorf("Pending() = %d after full replay", pending)
+	}
+}
+
+func TestOverflow_SpillCap(t *testing.T) {
+	ch := make(chan *models.Envelope)
+	spill, err := queue.OpenSpill(ch, queue.SpillConfig{Dir: t.TempDir(), MaxBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+
+	if err := spill.Write(envelope("a", models.SeverityInfo)); err != queue.ErrSpillFull {
+		t.Errorf("Write() = %v, want ErrSpillFull", err)
+	}
+}
+
+func TestOverflow_SetLimit(t *testing.T) {
+	ch := make(chan *models.Envelope, 8)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyReject, Grace: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.SetLimit(2)
+	for i := 0; i < 2; i++ {
+		if !o.Offer(envelope(string(rune('a'+i)), models.SeverityInfo)) {
+			t.Fatalf("offer %d rejected below the limit", i)
+		}
+	}
+	if o.Offer(envelope("c", models.SeverityInfo)) {
+		t.Error("expected the queue to be full at its limit")
+	}
+
+	// Lifting the limit restores the full capacity
+	o.SetLimit(0)
+	if !o.Offer(envelope("c", models.SeverityInfo)) {
+		t.Error("expected the offer to succeed once the limit is lifted")
+	}
+	if got := ids(ch); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected queue %v", got)
+	}
+}
+
+func TestOverflow_Reserve(t *testing.T) {
+	ch := make(chan *models.Envelope, 4)
+	size := int64(envelope("a", models.SeverityInfo).Event.Size())
+	budget := queue.NewBudget(size * 10)
+	o, err := queue.New(ch, queue.Config{Policy: queue.PolicyReject, Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := o.Reserve(3, 3*size)
+	if r == nil {
+		t.Fatal("expected room for three envelopes")
+	}
+	if o.Reserve(2, 2*size) != nil {
+		t.Error("expected a second reservation not to fit beside the first")
+	}
+	// Reserved room is full for other producers
+	if !o.Offer(envelope("x", models.SeverityInfo)) || o.Offer(envelope("y", models.SeverityInfo)) {
+		t.Error("expected one free slot besides the reservation")
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if !r.Put(envelope(id, models.SeverityInfo)) {
+			t.Fatalf("Put %s failed", id)
+		}
+	}
+	r.Release()
+	r.Release()
+	if r.Put(envelope("c", models.SeverityInfo)) {
+		t.Error("expected Put to fail after Release")
+	}
+	if got := budget.Used(); got != 3*size {
+		t.Errorf("budget used = %d, want the three queued envelopes' %d", got, 3*size)
+	}
+	if !o.Offer(envelope("z", models.SeverityInfo)) {
+		t.Error("expected the released slot to be free again")
+	}
+}
@@ -0,0 +1,114 @@
+package ratelimit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"parsec/internal/api"
+	"parsec/internal/middleware"
+	"parsec/internal/ratelimit"
+	"parsec/internal/state"
+)
+
+func newLimiter(t *testing.T, limit int) *ratelimit.Limiter {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+	return ratelimit.NewLimiter(store, ratelimit.Config{Limit: limit, Window: time.Minute})
+}
+
+func request(method, path, apiKey string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-API-Key", apiKey)
+	return r
+}
+
+func TestRateLimit_HeadersAndRejection(t *testing.T) {
+	limiter := newLimiter(t, 2)
+	handler := middleware.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request(http.MethodPost, "/ingest", "key-a"))
+
+		if w.Code != tt.status {
+			t.Errorf("request %d: expected %d, got %d", i, tt.status, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: expected limit 2, got %q", i, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("request %d: expected remaining %s, got %q", i, tt.remaining, got)
+		}
+		reset, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil || reset < time.Now().Unix() {
+			t.Errorf("request %d: invalid reset %q", i, w.Header().Get("X-RateLimit-Reset"))
+		}
+	}
+
+	// Quotas are per caller
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request(http.MethodPost, "/ingest", "key-b"))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a different caller to be allowed, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_NilLimiterDisabled(t *testing.T) {
+	called := false
+	handler := middleware.RateLimit(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request(http.MethodPost, "/ingest", "key-a"))
+	if !called || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Error("expected a nil limiter to pass requests through without headers")
+	}
+}
+
+func TestLimitsHandler_DoesNotConsumeQuota(t *testing.T) {
+	limiter := newLimiter(t, 5)
+	limiter.Allow(context.Background(), ratelimit.CallerID(request(http.MethodPost, "/ingest", "key-a")))
+
+	handler := handlers.NewLimitsHandler(limiter)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request(http.MethodGet, "/limits", "key-a"))
+
+		var resp handlers.LimitsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if !resp.Enabled || resp.Quota == nil || resp.Quota.Remaining != 4 || resp.Quota.Limit != 5 {
+			t.Fatalf("unexpected quota: %+v", resp.Quota)
+		}
+		if resp.Quota.Caller == "key-a" {
+			t.Error("API key leaked into the caller ID")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handlers.NewLimitsHandler(nil).ServeHTTP(w, request(http.MethodGet, "/limits", "key-a"))
+	var resp handlers.LimitsResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Enabled || resp.Quota != nil {
+		t.Errorf("expected limiting disabled, got %+v", resp)
+	}
+}
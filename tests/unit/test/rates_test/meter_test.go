@@ -0,0 +1,61 @@
+package rates_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"parsec/internal/rates"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+func TestMeter_SteadyRate(t *testing.T) {
+	m := rates.NewMeter(5 * time.Second)
+
+	m.Tick(1000) // baseline
+	if r := m.Rates(); r != (rates.Rates{}) {
+		t.Errorf("expected no rate from the baseline alone, got %+v", r)
+	}
+
+	// 50 events every 5s is 10/s, seeded straight into every window
+	total := uint64(1000)
+	for i := 0; i < 5; i++ {
+		total += 50
+		m.Tick(total)
+	}
+	r := m.Rates()
+	if !near(r.M1, 10) || !near(r.M5, 10) || !near(r.M15, 10) {
+		t.Errorf("expected 10/s in every window, got %+v", r)
+	}
+}
+
+func TestMeter_ShorterWindowsReactFaster(t *testing.T) {
+	m := rates.NewMeter(5 * time.Second)
+	m.Tick(0)
+	m.Tick(500) // 100/s
+
+	// The counter stops growing for a minute
+	for i := 0; i < 12; i++ {
+		m.Tick(500)
+	}
+	r := m.Rates()
+	// One minute is one time constant of the 1m average
+	if !near(r.M1, 100/math.E) {
+		t.Errorf("expected the 1m rate to decay to %.2f, got %.2f", 100/math.E, r.M1)
+	}
+	if !(r.M1 < r.M5 && r.M5 < r.M15 && r.M15 < 100) {
+		t.Errorf("expected longer windows to decay slower, got %+v", r)
+	}
+}
+
+func TestMeter_CounterReset(t *testing.T) {
+	m := rates.NewMeter(time.Second)
+	m.Tick(100)
+	m.Tick(200)
+	m.Tick(5) // reset
+	m.Tick(15)
+	if r := m.Rates(); r.M1 <= 0 || r.M1 >= 100 {
+		t.Errorf("expected the reset to count as no growth, got %+v", r)
+	}
+}
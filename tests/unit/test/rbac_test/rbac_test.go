@@ -0,0 +1,343 @@
+package rbac_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/rbac"
+	"parsec/internal/state"
+)
+
+var secret = []byte("jwt-secret")
+
+func newAuthenticator(t *testing.T) *rbac.Authenticator {
+	t.Helper()
+	keys, err := rbac.ParseKeys([]byte(`[
+		{"key": "ingest-key", "name": "agents", "role": "ingest"},
+		{"key": "acme-ingest", "name": "acme-agents", "role": "ingest", "tenants": ["acme"]},
+		{"key": "acme-admin", "name": "acme-admins", "role": "tenant-admin", "tenants": ["acme"]},
+		{"key": "viewer", "name": "dashboards", "role": "read-only"},
+		{"key": "ops", "name": "oncall", "role": "operator"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := rbac.NewAuthenticator(rbac.Config{Keys: keys, JWTSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func authenticate(a *rbac.Authenticator, header, value string) (*rbac.Principal, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return a.Authenticate(r)
+}
+
+func TestPrincipal_Can(t *testing.T) {
+	a := newAuthenticator(t)
+
+	tests := []struct {
+		key    string
+		perm   rbac.Permission
+		tenant string
+		want   bool
+	}{
+		{"ingest-key", rbac.PermIngest, "acme", true},
+		{"ingest-key", rbac.PermRead, "acme", false},
+		{"acme-ingest", rbac.PermIngest, "acme", true},
+		{"acme-ingest", rbac.PermIngest, "globex", false},
+		{"acme-admin", rbac.PermManage, "acme", true},
+		{"acme-admin", rbac.PermRead, "acme", true},
+		{"acme-admin", rbac.PermManage, "globex", false},
+		{"acme-admin", rbac.PermManage, "", false}, // node-wide settings
+		{"viewer", rbac.PermRead, "", true},
+		{"viewer", rbac.PermRead, "globex", true},
+		{"viewer", rbac.PermManage, "acme", false},
+		{"viewer", rbac.PermIngest, "acme", false},
+		{"ops", rbac.PermManage, "", true},
+		{"ops", rbac.PermIngest, "globex", true},
+	}
+	for _, tt := range tests {
+		p, err := authenticate(a, "X-API-Key", tt.key)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.key, err)
+		}
+		if got := p.Can(tt.perm, tt.tenant); got != tt.want {
+			t.Errorf("%s (%s) Can(%s, %q) = %v, want %v", tt.key, p.Role, tt.perm, tt.tenant, got, tt.want)
+		}
+	}
+}
+
+func TestPrincipal_Covers(t *testing.T) {
+	operator := &rbac.Principal{Role: rbac.RoleOperator}
+	acme := &rbac.Principal{Role: rbac.RoleTenantAdmin, Tenants: []string{"acme", "globex"}}
+	viewer := &rbac.Principal{Role: rbac.RoleReadOnly}
+
+	tests := []struct {
+		name    string
+		p       *rbac.Principal
+		role    rbac.Role
+		tenants []string
+		want    bool
+	}{
+		{"operator covers operator", operator, rbac.RoleOperator, nil, true},
+		{"tenant admin covers its tenants", acme, rbac.RoleIngest, []string{"acme"}, true},
+		{"tenant admin not other tenants", acme, rbac.RoleIngest, []string{"acme", "initech"}, false},
+		{"tenant admin not unlimited keys", acme, rbac.RoleIngest, nil, false},
+		{"read-only not ingest", viewer, rbac.RoleIngest, nil, false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Covers(tt.role, tt.tenants); got != tt.want {
+			t.Errorf("%s: Covers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticator_Credentials(t *testing.T) {
+	a := newAuthenticator(t)
+
+	if _, err := authenticate(a, "", ""); !errors.Is(err, rbac.ErrNoCredentials) {
+		t.Errorf("no credentials: %v", err)
+	}
+	if _, err := authenticate(a, "X-API-Key", "nope"); !errors.Is(err, rbac.ErrInvalidCredentials) {
+		t.Errorf("unknown key: %v", err)
+	}
+	// The development default only applies without configured credentials
+	if _, err := authenticate(a, "X-API-Key", rbac.DefaultAPIKey); !errors.Is(err, rbac.ErrInvalidCredentials) {
+		t.Errorf("default key: %v", err)
+	}
+
+	open, err := rbac.NewAuthenticator(rbac.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := authenticate(open, "X-API-Key", rbac.DefaultAPIKey); err != nil || p.Role != rbac.RoleOperator {
+		t.Errorf("default key without configuration: %+v, %v", p, err)
+	}
+}
+
+func TestAuthenticator_Tokens(t *testing.T) {
+	a := newAuthenticator(t)
+	now := time.Now()
+
+	token, err := rbac.SignToken(rbac.Claims{Subject: "ci", Role: rbac.RoleIngest, Tenant: "acme", ExpiresAt: now.Add(time.Hour).Unix()}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := authenticate(a, "Authorization", "Bearer "+token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "ci" || p.Role != rbac.RoleIngest || !p.Can(rbac.PermIngest, "acme") || p.Can(rbac.PermIngest, "globex") {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	invalid := map[string]rbac.Claims{
+		"expired":      {Subject: "ci", Role: rbac.RoleIngest, ExpiresAt: now.Add(-time.Hour).Unix()},
+		"not yet":      {Subject: "ci", Role: rbac.RoleIngest, NotBefore: now.Add(time.Hour).Unix()},
+		"unknown role": {Subject: "ci", Role: "superuser"},
+		"no tenants":   {Subject: "ci", Role: rbac.RoleTenantAdmin},
+	}
+	for name, claims := range invalid {
+		token, _ := rbac.SignToken(claims, secret)
+		if _, err := authenticate(a, "Authorization", "Bearer "+token); !errors.Is(err, rbac.ErrInvalidCredentials) {
+			t.Errorf("%s: expected invalid credentials, got %v", name, err)
+		}
+	}
+
+	forged, _ := rbac.SignToken(rbac.Claims{Subject: "ci", Role: rbac.RoleOperator}, []byte("other-secret"))
+	if _, err := authenticate(a, "Authorization", "Bearer "+forged); !errors.Is(err, rbac.ErrInvalidCredentials) {
+		t.Errorf("forged token: %v", err)
+	}
+}
+
+func TestNewAuthenticator_RejectsBadKeys(t *testing.T) {
+	bad := map[string][]rbac.Key{
+		"unknown role":            {{Key: "k", Name: "a", Role: "root"}},
+		"tenant admin no tenants": {{Key: "k", Name: "a", Role: rbac.RoleTenantAdmin}},
+		"empty key":               {{Name: "a", Role: rbac.RoleIngest}},
+		"duplicate":               {{Key: "k", Name: "a", Role: rbac.RoleIngest}, {Key: "k", Name: "b", Role: rbac.RoleOperator}},
+	}
+	for name, keys := range bad {
+		if _, err := rbac.NewAuthenticator(rbac.Config{Keys: keys}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAuthenticator_ExpiredKeys(t *testing.T) {
+	now := time.Now()
+	a, err := rbac.NewAuthenticator(rbac.Config{
+		Keys: []rbac.Key{
+			{Key: "old", Name: "agents", Role: rbac.RoleIngest, ExpiresAt: now.Add(-time.Minute)},
+			{Key: "soon", Name: "agents", Role: rbac.RoleIngest, ExpiresAt: now.Add(time.Hour)},
+		},
+		ExpiryWarning: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authenticate(a, "X-API-Key", "old"); !errors.Is(err, rbac.ErrExpiredCredentials) {
+		t.Errorf("expired key: %v", err)
+	}
+	p, err := authenticate(a, "X-API-Key", "soon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.KeyID != "agents" || p.ExpiresAt.IsZero() {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	keys := a.Keys()
+	if len(keys) != 2 || !keys[0].Expired || !keys[1].Expiring {
+		t.Errorf("unexpected key listing %+v", keys)
+	}
+}
+
+func TestAuthenticator_Rotate(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	cfg := rbac.Config{
+		Keys:  []rbac.Key{{Key: "acme-admin", Name: "acme-admins", Role: rbac.RoleTenantAdmin, Tenants: []string{"acme"}}},
+		Store: store,
+	}
+	a, err := rbac.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Rotate(ctx, "nobody", time.Hour, 0); !errors.Is(err, rbac.ErrUnknownKey) {
+		t.Errorf("unknown ID: %v", err)
+	}
+
+	rotation, err := a.Rotate(ctx, "acme-admins", time.Hour, 90*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotation.Key == "" || rotation.ExpiresAt == nil {
+		t.Fatalf("unexpected rotation %+v", rotation)
+	}
+
+	// Both keys work during the overlap, and the new one has the old one's role
+	old, err := authenticate(a, "X-API-Key", "acme-admin")
+	if err != nil || old.ExpiresAt.IsZero() || old.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("old key during overlap: %+v, %v", old, err)
+	}
+	issued, err := authenticate(a, "X-API-Key", rotation.Key)
+	if err != nil || !issued.Can(rbac.PermManage, "acme") || issued.Can(rbac.PermManage, "globex") {
+		t.Errorf("new key: %+v, %v", issued, err)
+	}
+
+	// Other nodes pick the rotation up from the store
+	other, err := rbac.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticate(other, "X-API-Key", rotation.Key); err != nil {
+		t.Errorf("new key on another node: %v", err)
+	}
+
+	// Rotating without overlap retires the previous keys at once
+	next, err := other.Rotate(ctx, "acme-admins", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"acme-admin", rotation.Key} {
+		if _, err := authenticate(other, "X-API-Key", key); !errors.Is(err, rbac.ErrExpiredCredentials) {
+			t.Errorf("retired key: %v", err)
+		}
+	}
+	if p, err := authenticate(other, "X-API-Key", next.Key); err != nil || !p.ExpiresAt.IsZero() {
+		t.Errorf("latest key: %+v, %v", p, err)
+	}
+}
+
+func TestAuthenticator_LoadKeepsRotationsOnAnEmptyStore(t *testing.T) {
+	ctx := context.Background()
+	a, err := rbac.NewAuthenticator(rbac.Config{
+		Keys:  []rbac.Key{{Key: "agents-key", Name: "agents", Role: rbac.RoleIngest}},
+		Store: state.NewNoopStore(""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotation, err := a.Rotate(ctx, "agents", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh loop finds nothing stored
+	if err := a.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticate(a, "X-API-Key", rotation.Key); err != nil {
+		t.Errorf("rotated key after reload: %v", err)
+	}
+	if old, err := authenticate(a, "X-API-Key", "agents-key"); err != nil || old.ExpiresAt.IsZero() {
+		t.Errorf("old key lost its expiry: %+v, %v", old, err)
+	}
+}
+
+func TestAuthenticator_ConcurrentRotationsAreKept(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	cfg := rbac.Config{
+		Keys: []rbac.Key{
+			{Key: "acme-key", Name: "acme", Role: rbac.RoleIngest},
+			{Key: "globex-key", Name: "globex", Role: rbac.RoleIngest},
+		},
+		Store: store,
+	}
+	rotations := make([]*rbac.Rotation, 2)
+	var wg sync.WaitGroup
+	for i, id := range []string{"acme", "globex"} {
+		// Each rotation runs on its own node
+		node, err := rbac.NewAuthenticator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rotation, err := node.Rotate(ctx, id, time.Hour, 0)
+			if err != nil {
+				t.Errorf("rotate %s: %v", id, err)
+			}
+			rotations[i] = rotation
+		}()
+	}
+	wg.Wait()
+
+	reader, err := rbac.NewAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, rotation := range rotations {
+		if rotation == nil {
+			continue
+		}
+		if _, err := authenticate(reader, "X-API-Key", rotation.Key); err != nil {
+			t.Errorf("rotation of %s lost: %v", rotation.ID, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package region_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"parsec/internal/region"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func TestDeduplicator_HandlesEachEventOnce(t *testing.T) {
+	d := region.NewDeduplicator(state.NewMemoryStore(state.MemoryConfig{}), time.Hour)
+
+	var handled []string
+	handler := d.Wrap(func(ctx context.Context, e *models.Envelope) error {
+		handled = append(handled, e.Event.ID+"@"+e.Region)
+		return nil
+	})
+
+	ctx := context.Background()
+	for _, e := range []*models.Envelope{
+		envelope("evt-1", "eu-west-1"),
+		envelope("evt-1", "us-east-1"), // the mirrored copy
+		envelope("evt-2", "us-east-1"),
+	} {
+		if err := handler(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(handled) != 2 || handled[0] != "evt-1@eu-west-1" || handled[1] != "evt-2@us-east-1" {
+		t.Errorf("handled %v", handled)
+	}
+}
+
+func TestDeduplicator_FailedCopyLetsAnotherHandleIt(t *testing.T) {
+	d := region.NewDeduplicator(state.NewMemoryStore(state.MemoryConfig{}), time.Hour)
+
+	calls := 0
+	handler := d.Wrap(func(ctx context.Context, e *models.Envelope) error {
+		calls++
+		if e.Region == "eu-west-1" {
+			return errors.New("sink down")
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	if err := handler(ctx, envelope("evt-1", "eu-west-1")); err == nil {
+		t.Fatal("expected the handler error")
+	}
+	if err := handler(ctx, envelope("evt-1", "us-east-1")); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestDeduplicator_ConcurrentCopiesWaitForTheLease(t *testing.T) {
+	d := region.NewDeduplicator(state.NewMemoryStore(state.MemoryConfig{}), time.Hour)
+
+	var handled atomic.Int32
+	release := make(chan struct{})
+	handler := d.Wrap(func(ctx context.Context, e *models.Envelope) error {
+		handled.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for _, origin := range []string{"eu-west-1", "us-east-1", "ap-south-1"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handler(context.Background(), envelope("evt-1", origin)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := handled.Load(); got != 1 {
+		t.Errorf("handled %d times, want 1", got)
+	}
+}
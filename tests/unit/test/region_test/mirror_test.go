@@ -0,0 +1,153 @@
+package region_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/internal/config"
+	"parsec/internal/region"
+	"parsec/pkg/models"
+)
+
+// fakePublisher records published envelopes
+type fakePublisher struct {
+	mu        sync.Mutex
+	envelopes []*models.Envelope
+	err       error
+	block     chan struct{}
+	closed    bool
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return f.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+func (f *fakePublisher) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.envelopes = append(f.envelopes, envelopes...)
+	return nil
+}
+
+func (f *fakePublisher) HealthCheck(ctx context.Context) error { return f.err }
+func (f *fakePublisher) Stats() bus.Stats                      { return bus.Stats{} }
+
+func (f *fakePublisher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakePublisher) published() []*models.Envelope {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*models.Envelope(nil), f.envelopes...)
+}
+
+func envelope(id, origin string) *models.Envelope {
+	e := models.NewEnvelope(&models.LogEvent{ID: id, TenantID: "acme", Timestamp: time.Now()}, "node-1")
+	e.Region = origin
+	e.Topic = "logs-routed"
+	return e
+}
+
+func mirrorConfig() config.RegionConfig {
+	return config.RegionConfig{Name: "eu-west-1", MirrorTopic: "logs.eu-west-1", MirrorQueueSize: 10, MirrorBatchSize: 4}
+}
+
+func TestMirror_MirrorsLocalEnvelopesOnly(t *testing.T) {
+	local, remote := &fakePublisher{}, &fakePublisher{}
+	m := region.NewMirror(local, remote, mirrorConfig())
+
+	batch := []*models.Envelope{
+		envelope("evt-1", "eu-west-1"),
+		envelope("evt-2", "us-east-1"), // mirrored in; must not bounce back
+		envelope("evt-3", ""),
+	}
+	if err := m.PublishBatch(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(local.published()); got != 3 {
+		t.Fatalf("local got %d envelopes, want 3", got)
+	}
+	mirrored := remote.published()
+	if len(mirrored) != 2 {
+		t.Fatalf("remote got %d envelopes, want 2", len(mirrored))
+	}
+	for _, e := range mirrored {
+		if e.Topic != "logs.eu-west-1" || e.Region != "eu-west-1" {
+			t.Errorf("mirrored envelope %s has topic %q region %q", e.Event.ID, e.Topic, e.Region)
+		}
+	}
+	// The local copy keeps its routing
+	if batch[0].Topic != "logs-routed" {
+		t.Errorf("local envelope topic changed to %q", batch[0].Topic)
+	}
+	if !local.closed || !remote.closed {
+		t.Error("Close should close both publishers")
+	}
+}
+
+func TestMirror_LocalFailureIsNotMirrored(t *testing.T) {
+	local, remote := &fakePublisher{err: errors.New("broker down")}, &fakePublisher{}
+	m := region.NewMirror(local, remote, mirrorConfig())
+
+	if err := m.Publish(context.Background(), envelope("evt-1", "eu-west-1")); err == nil {
+		t.Fatal("expected the local error")
+	}
+	m.Close()
+	if got := len(remote.published()); got != 0 {
+		t.Errorf("remote got %d envelopes, want 0", got)
+	}
+}
+
+func TestMirror_RemoteOutageDoesNotBlockLocal(t *testing.T) {
+	local := &fakePublisher{}
+	remote := &fakePublisher{block: make(chan struct{})}
+	m := region.NewMirror(local, remote, mirrorConfig())
+
+	// Far more than the mirror queue holds
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 50; i++ {
+			if err := m.Publish(context.Background(), envelope("evt", "eu-west-1")); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("local publishing blocked on the remote region")
+	}
+	if got := len(local.published()); got != 50 {
+		t.Errorf("local got %d envelopes, want 50", got)
+	}
+	if err := m.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck = %v, want nil while only the remote is down", err)
+	}
+
+	close(remote.block)
+	m.Close()
+}
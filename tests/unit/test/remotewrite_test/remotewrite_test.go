@@ -0,0 +1,192 @@
+package remotewrite_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"parsec/internal/remotewrite"
+)
+
+// series is a decoded TimeSeries: its labels as name=value pairs and its
+// sample
+type series struct {
+	labels string
+	value  float64
+	at     int64
+}
+
+// fields splits a protobuf message into its length-delimited and scalar
+// fields, by number
+func fields(t *testing.T, b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, scalar uint64)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			fn(num, typ, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			fn(num, typ, nil, v)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			fn(num, typ, nil, v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+}
+
+// decode parses a WriteRequest into its series, sorted by labels
+func decode(t *testing.T, b []byte) []series {
+	t.Helper()
+	var out []series
+	fields(t, b, func(_ protowire.Number, _ protowire.Type, ts []byte, _ uint64) {
+		var s series
+		var labels []string
+		fields(t, ts, func(num protowire.Number, _ protowire.Type, msg []byte, _ uint64) {
+			if num == 1 {
+				var name, value string
+				fields(t, msg, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				labels = append(labels, name+"="+value)
+				return
+			}
+			fields(t, msg, func(num protowire.Number, _ protowire.Type, _ []byte, v uint64) {
+				if num == 1 {
+					s.value = math.Float64frombits(v)
+				} else {
+					s.at = int64(v)
+				}
+			})
+		})
+		if !sort.StringsAreSorted(labels) {
+			t.Errorf("labels not sorted: %v", labels)
+		}
+		s.labels = strings.Join(labels, ",")
+		out = append(out, s)
+	})
+	sort.Slice(out, func(a, b int) bool { return out[a].labels < out[b].labels })
+	return out
+}
+
+func registry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	events := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "parsec_events_total", Help: "h"}, []string{"tenant"})
+	events.WithLabelValues("acme").Add(3)
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "parsec_latency_seconds", Help: "h", Buckets: []float64{1}})
+	latency.Observe(0.5)
+	latency.Observe(2)
+	other := prometheus.NewGauge(prometheus.GaugeOpts{Name: "go_other", Help: "h"})
+	other.Set(1)
+	reg.MustRegister(events, latency, other)
+	return reg
+}
+
+func TestEncode_SelectsAndLabelsSeries(t *testing.T) {
+	families, err := registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.UnixMilli(1700000000000)
+
+	body, n := remotewrite.Encode(families, []string{"parsec_"}, map[string]string{"instance": "node-a", "tenant": "none"}, now)
+	got := decode(t, body)
+	if n != len(got) || n != 5 {
+		t.Fatalf("got %d series (%d decoded): %+v", n, len(got), got)
+	}
+
+	// External labels fill in for series without the label
+	want := []series{
+		{"__name__=parsec_events_total,instance=node-a,tenant=acme", 3, now.UnixMilli()},
+		{"__name__=parsec_latency_seconds_bucket,instance=node-a,le=+Inf,tenant=none", 2, now.UnixMilli()},
+		{"__name__=parsec_latency_seconds_bucket,instance=node-a,le=1,tenant=none", 1, now.UnixMilli()},
+		{"__name__=parsec_latency_seconds_count,instance=node-a,tenant=none", 2, now.UnixMilli()},
+		{"__name__=parsec_latency_seconds_sum,instance=node-a,tenant=none", 2.5, now.UnixMilli()},
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("series %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPusher_PushesSnappyProtobuf(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		request *http.Request
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		request, body = r, data
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := remotewrite.New(registry(), remotewrite.Config{
+		URL:         server.URL,
+		Prefixes:    []string{"parsec_events"},
+		Labels:      map[string]string{"instance": "node-a"},
+		BearerToken: "secret",
+	})
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if request.Header.Get("Content-Encoding") != "snappy" ||
+		request.Header.Get("Content-Type") != "application/x-protobuf" ||
+		request.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" ||
+		request.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := decode(t, raw)
+	if len(got) != 1 || got[0].labels != "__name__=parsec_events_total,instance=node-a,tenant=acme" || got[0].value != 3 {
+		t.Errorf("unexpected series %+v", got)
+	}
+}
+
+func TestPusher_ReportsRejectedPush(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := remotewrite.New(registry(), remotewrite.Config{URL: server.URL})
+	err := p.Push(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("err = %v, want the endpoint's error", err)
+	}
+}
@@ -0,0 +1,254 @@
+package reprocess_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/bus"
+	"parsec/internal/kafka"
+	"parsec/internal/pipeline"
+	"parsec/internal/reprocess"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+var base = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeSource serves fixed envelopes from several goroutines, like a range
+// reader with several consumers
+type fakeSource struct {
+	envelopes []*models.Envelope
+
+	mu   sync.Mutex
+	spec kafka.RangeSpec
+}
+
+func (s *fakeSource) Read(ctx context.Context, spec kafka.RangeSpec, fn func(*models.Envelope) error) error {
+	s.mu.Lock()
+	s.spec = spec
+	s.mu.Unlock()
+	spec.Started(int64(len(s.envelopes)))
+
+	work := make(chan *models.Envelope)
+	errs := make(chan error, spec.Readers)
+	var wg sync.WaitGroup
+	for i := 0; i < spec.Readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				if err := fn(e); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for _, e := range s.envelopes {
+		select {
+		case work <- e:
+		case err := <-errs:
+			close(work)
+			wg.Wait()
+			return err
+		}
+	}
+	close(work)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func envelope(id, tenantID string, at time.Time, message string) *models.Envelope {
+	e := models.NewEnvelope(&models.LogEvent{ID: id, TenantID: tenantID, Timestamp: at, Message: message}, "node-1")
+	e.Topic = "logs"
+	return e
+}
+
+func source() *fakeSource {
+	return &fakeSource{envelopes: []*models.Envelope{
+		envelope("1", "acme", base, "password=hunter2"),
+		envelope("2", "acme", base.Add(time.Hour), "debug noise"),
+		envelope("3", "acme", base.Add(2*time.Hour), "ok"),
+		envelope("4", "other", base, "not ours"),
+		envelope("5", "acme", base.Add(48*time.Hour), "out of range"),
+	}}
+}
+
+// redactStage masks passwords and drops debug noise
+type redactStage struct{}
+
+func (redactStage) Name() string { return "redact" }
+
+func (redactStage) Process(ctx context.Context, e *models.LogEvent) (pipeline.Result, error) {
+	if strings.HasPrefix(e.Message, "debug") {
+		return pipeline.Result{Drop: true}, nil
+	}
+	if strings.HasPrefix(e.Message, "password=") {
+		e.Message = "password=[REDACTED]"
+		return pipeline.Result{Changed: true}, nil
+	}
+	return pipeline.Result{}, nil
+}
+
+// sink records published envelopes
+type sink struct {
+	mu        sync.Mutex
+	envelopes []*models.Envelope
+	err       error
+}
+
+func (s *sink) Publish(ctx context.Context, e *models.Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.envelopes = append(s.envelopes, e)
+	return nil
+}
+
+func (s *sink) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	for _, e := range envelopes {
+		if err := s.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sink) HealthCheck(ctx context.Context) error { return nil }
+func (s *sink) Stats() bus.Stats                      { return bus.Stats{} }
+func (s *sink) Close() error                          { return nil }
+
+func newManager(t *testing.T, src reprocess.Source, out *sink) *reprocess.Manager {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+
+	m := reprocess.NewManager(store, src,
+		map[string]*pipeline.Pipeline{reprocess.DefaultPipeline: pipeline.New(redactStage{})},
+		map[string]bus.Publisher{reprocess.DefaultSink: out},
+		reprocess.Config{Readers: 3, ProgressInterval: time.Millisecond})
+	t.Cleanup(m.Close)
+	return m
+}
+
+// wait polls until the job leaves pending/running
+func wait(t *testing.T, m *reprocess.Manager, id string) *reprocess.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == reprocess.StatusSucceeded || job.Status == reprocess.StatusFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("reprocess job did not finish")
+	return nil
+}
+
+func TestManager_ReprocessesRange(t *testing.T) {
+	src, out := source(), &sink{}
+	m := newManager(t, src, out)
+
+	job, err := m.Create(context.Background(), reprocess.Request{
+		Topic:       "logs",
+		From:        base,
+		To:          base.Add(24 * time.Hour),
+		TenantID:    "acme",
+		TargetTopic: "logs-redacted",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != reprocess.StatusPending || job.Pipeline != reprocess.DefaultPipeline || job.Readers != 3 ||
+		!strings.HasPrefix(job.Group, "parsec-reprocess-") {
+		t.Errorf("unexpected new job: %+v", job)
+	}
+
+	done := wait(t, m, job.ID)
+	if done.Status != reprocess.StatusSucceeded {
+		t.Fatalf("unexpected job: %+v", done)
+	}
+	want := reprocess.Progress{Total: 5, Read: 5, Skipped: 2, Written: 2, Dropped: 1, Percent: 100}
+	if done.Progress != want {
+		t.Errorf("progress %+v, want %+v", done.Progress, want)
+	}
+	if src.spec.Group != job.Group || src.spec.Topic != "logs" || !src.spec.From.Equal(base) {
+		t.Errorf("unexpected range spec %+v", src.spec)
+	}
+
+	written := map[string]string{}
+	for _, e := range out.envelopes {
+		if e.Topic != "logs-redacted" {
+			t.Errorf("expected the target topic, got %q", e.Topic)
+		}
+		written[e.Event.ID] = e.Event.Message
+	}
+	if len(written) != 2 || written["1"] != "password=[REDACTED]" || written["3"] != "ok" {
+		t.Errorf("wrote %v", written)
+	}
+}
+
+func TestManager_Throttles(t *testing.T) {
+	src, out := source(), &sink{}
+	m := newManager(t, src, out)
+
+	start := time.Now()
+	job, err := m.Create(context.Background(), reprocess.Request{
+		Topic:         "logs",
+		From:          base,
+		To:            base.Add(24 * time.Hour),
+		RatePerSecond: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, job.ID)
+	// Five events at 100/s are spaced over at least 40ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected throttling, finished in %v", elapsed)
+	}
+}
+
+func TestManager_FailedAndInvalidJobs(t *testing.T) {
+	out := &sink{err: errors.New("sink down")}
+	m := newManager(t, source(), out)
+
+	for _, req := range []reprocess.Request{
+		{From: base, To: base.Add(time.Hour)},
+		{Topic: "logs", From: base, To: base},
+		{Topic: "logs", From: base, To: base.Add(time.Hour), Pipeline: "missing"},
+		{Topic: "logs", From: base, To: base.Add(time.Hour), Sink: "missing"},
+	} {
+		if _, err := m.Create(context.Background(), req); !errors.Is(err, reprocess.ErrInvalidRequest) {
+			t.Errorf("Create(%+v) = %v, want ErrInvalidRequest", req, err)
+		}
+	}
+
+	job, err := m.Create(context.Background(), reprocess.Request{Topic: "logs", From: base, To: base.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := wait(t, m, job.ID)
+	if done.Status != reprocess.StatusFailed || !strings.Contains(done.Error, "sink down") || done.Progress.Failed == 0 {
+		t.Errorf("expected the sink failure to fail the job, got %+v", done)
+	}
+
+	if _, err := m.Get(context.Background(), "unknown"); !errors.Is(err, reprocess.ErrJobNotFound) {
+		t.Errorf("Get() = %v, want ErrJobNotFound", err)
+	}
+}
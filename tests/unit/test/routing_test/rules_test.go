@@ -0,0 +1,266 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"parsec/internal/routing"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func event(severity models.Severity, source string, metadata models.Metadata) *models.LogEvent {
+	return &models.LogEvent{
+		ID:       "evt-1",
+		TenantID: "tenant-1",
+		Severity: severity,
+		Source:   source,
+		Metadata: metadata,
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine := routing.NewEngine(nil)
+	err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{
+		{Name: "drop-debug", Match: routing.Match{Severities: []models.Severity{"debug"}}, Action: routing.ActionDrop},
+		{Name: "audit", Match: routing.Match{Metadata: map[string]string{"Audit": "*"}}, Action: routing.ActionRoute, Topic: "audit-events"},
+		{Name: "payments-high", Match: routing.Match{Source: "payments-*"}, Action: routing.ActionPriority, Priority: routing.PriorityHigh},
+	})
+	if err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+
+	if d := engine.Evaluate(event(models.SeverityDebug, "api", nil)); !d.Drop {
+		t.Error("expected DEBUG event to be dropped")
+	}
+
+	d := engine.Evaluate(event(models.SeverityInfo, "payments-api", models.Metadata{"audit": "true"}))
+	if d.Drop || d.Topic != "audit-events" || d.Priority != routing.PriorityHigh {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+	if len(d.Matched) != 2 {
+		t.Errorf("expected 2 matched rules, got %v", d.Matched)
+	}
+
+	// Other tenants are unaffected
+	other := event(models.SeverityDebug, "api", nil)
+	other.TenantID = "tenant-2"
+	if d := engine.Evaluate(other); d.Drop {
+		t.Error("rules leaked across tenants")
+	}
+}
+
+func TestEngine_MaxSeverityAndSampling(t *testing.T) {
+	engine := routing.NewEngine(nil)
+	err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{
+		{Match: routing.Match{MaxSeverity: models.SeverityInfo}, Action: routing.ActionSample, SampleRate: 0.25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := engine.Evaluate(event(models.SeverityError, "api", nil)); d.Drop {
+		t.Error("ERROR should not match max_severity INFO")
+	}
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		e := event(models.SeverityInfo, "api", nil)
+		e.ID = fmt.Sprintf("evt-%d", i)
+		if !engine.Evaluate(e).Drop {
+			kept++
+		}
+	}
+	if kept < 150 || kept > 350 {
+		t.Errorf("expected roughly 25%% kept, got %d/1000", kept)
+	}
+}
+
+func TestEngine_Retention(t *testing.T) {
+	engine := routing.NewEngine(nil)
+	engine.SetRetentionTopics(map[string]string{
+		routing.RetentionShort: "logs-short",
+		routing.RetentionLong:  "logs-long",
+	})
+	err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{
+		{Name: "audit", Match: routing.Match{Metadata: map[string]string{"audit": "*"}}, Action: routing.ActionRoute, Topic: "audit-events"},
+		{Name: "short", Match: routing.Match{MaxSeverity: models.SeverityInfo}, Action: routing.ActionRetention, Retention: "SHORT"},
+		{Name: "long", Match: routing.Match{}, Action: routing.ActionRetention, Retention: routing.RetentionLong},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		event         *models.LogEvent
+		wantTopic     string
+		wantRetention string
+	}{
+		{"debug is short", event(models.SeverityDebug, "api", nil), "logs-short", routing.RetentionShort},
+		{"info is short", event(models.SeverityInfo, "api", nil), "logs-short", routing.RetentionShort},
+		{"warning is long", event(models.SeverityWarning, "api", nil), "logs-long", routing.RetentionLong},
+		{"explicit route wins topic", event(models.SeverityDebug, "api", models.Metadata{"audit": "1"}), "audit-events", routing.RetentionShort},
+	}
+	for _, tt := range tests {
+		d := engine.Evaluate(tt.event)
+		if d.Topic != tt.wantTopic || d.Retention != tt.wantRetention {
+			t.Errorf("%s: got topic %q retention %q", tt.name, d.Topic, d.Retention)
+		}
+	}
+}
+
+func TestEngine_RetentionHints(t *testing.T) {
+	engine := routing.NewEngine(nil)
+	err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{
+		{Name: "audit", Match: routing.Match{Metadata: map[string]string{"audit": "*"}}, Action: routing.ActionRetention, Retention: routing.RetentionLong, TTL: "7y"},
+		{Name: "debug", Match: routing.Match{MaxSeverity: models.SeverityDebug}, Action: routing.ActionRetention, TTL: "3d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := engine.Evaluate(event(models.SeverityDebug, "api", models.Metadata{"audit": "1"}))
+	if d.Retention != routing.RetentionLong || d.RetentionSeconds != 7*365*24*3600 {
+		t.Errorf("expected the audit rule's hint to win, got %+v", d)
+	}
+	if d := engine.Evaluate(event(models.SeverityDebug, "api", nil)); d.Retention != "" || d.RetentionSeconds != 3*24*3600 {
+		t.Errorf("expected a 3 day hint without a tier, got %+v", d)
+	}
+	if d := engine.Evaluate(event(models.SeverityInfo, "api", nil)); d.RetentionSeconds != 0 {
+		t.Errorf("expected no hint, got %+v", d)
+	}
+
+	for _, rule := range []routing.Rule{
+		{Action: routing.ActionRetention},
+		{Action: routing.ActionRetention, TTL: "forever"},
+	} {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestEngine_Partition(t *testing.T) {
+	drained, fallback := 3, 7
+	engine := routing.NewEngine(nil)
+	err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{
+		{Name: "drain", Match: routing.Match{Source: "api"}, Action: routing.ActionPartition, Partition: &drained},
+		{Name: "all", Match: routing.Match{}, Action: routing.ActionPartition, Partition: &fallback},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := engine.Evaluate(event(models.SeverityInfo, "api", nil)); d.Partition == nil || *d.Partition != 3 {
+		t.Errorf("expected the first matching rule's partition 3, got %+v", d)
+	}
+	if d := engine.Evaluate(event(models.SeverityInfo, "worker", nil)); d.Partition == nil || *d.Partition != 7 {
+		t.Errorf("expected partition 7, got %+v", d)
+	}
+
+	other := event(models.SeverityInfo, "api", nil)
+	other.TenantID = "tenant-2"
+	if d := engine.Evaluate(other); d.Partition != nil {
+		t.Errorf("expected no partition for another tenant, got %d", *d.Partition)
+	}
+}
+
+func TestEngine_RestrictsRouteTopics(t *testing.T) {
+	engine := routing.NewEngine(nil)
+	engine.SetAllowedTopics([]string{"logs", "audit-events"}, "logs.{tenant}.")
+
+	tests := []struct {
+		tenantID, topic string
+		allowed         bool
+	}{
+		{"acme", "logs", true},
+		{"acme", "audit-events", true},
+		{"acme", "logs.acme.payments", true},
+		{"acme", "logs.globex.payments", false},
+		{"acme", "logs.acme.", false},
+		{"acme", "__consumer_offsets", false},
+	}
+	for _, tt := range tests {
+		rule := routing.Rule{Action: routing.ActionRoute, Topic: tt.topic}
+		err := engine.SetRules(context.Background(), tt.tenantID, []routing.Rule{rule})
+		if tt.allowed && err != nil {
+			t.Errorf("%s to %q: %v", tt.tenantID, tt.topic, err)
+		}
+		if !tt.allowed && !errors.Is(err, routing.ErrTopicNotAllowed) {
+			t.Errorf("%s to %q: got %v, want ErrTopicNotAllowed", tt.tenantID, tt.topic, err)
+		}
+	}
+	if topics := engine.Topics("acme"); len(topics) != 1 || topics[0] != "logs.acme.payments" {
+		t.Errorf("rejected rules replaced the tenant's: %v", topics)
+	}
+}
+
+func TestEngine_RejectsInvalidRules(t *testing.T) {
+	negative := -1
+
+	engine := routing.NewEngine(nil)
+
+	tests := []struct {
+		rule routing.Rule
+		want error
+	}{
+		{routing.Rule{Action: "explode"}, routing.ErrUnknownAction},
+		{routing.Rule{Action: routing.ActionRoute}, routing.ErrMissingTopic},
+		{routing.Rule{Action: routing.ActionPriority, Priority: "urgent"}, routing.ErrInvalidPriority},
+		{routing.Rule{Action: routing.ActionSample, SampleRate: 1.5}, routing.ErrInvalidSample},
+		{routing.Rule{Action: routing.ActionRetention, Retention: "forever"}, routing.ErrInvalidRetention},
+		{routing.Rule{Action: routing.ActionPartition}, routing.ErrInvalidPartition},
+		{routing.Rule{Action: routing.ActionPartition, Partition: &negative}, routing.ErrInvalidPartition},
+		{routing.Rule{Action: routing.ActionDrop, Match: routing.Match{Source: "["}}, routing.ErrInvalidSource},
+	}
+
+	for _, tt := range tests {
+		err := engine.SetRules(context.Background(), "tenant-1", []routing.Rule{tt.rule})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("rule %+v: got %v, want %v", tt.rule, err, tt.want)
+		}
+	}
+}
+
+func TestEngine_NodesKeepEachOthersRules(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	drop := []routing.Rule{{Name: "drop-debug", Match: routing.Match{Severities: []models.Severity{"debug"}}, Action: routing.ActionDrop}}
+
+	// Neither node has loaded the other's rules before setting its own
+	a := routing.NewEngine(store)
+	b := routing.NewEngine(store)
+	if err := a.SetRules(ctx, "tenant-1", drop); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetRules(ctx, "tenant-2", drop); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := routing.NewEngine(store)
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"tenant-1", "tenant-2"} {
+		if len(reader.Rules(tenantID)) != 1 {
+			t.Errorf("%s: rules lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the rules set here in place
+	noop := routing.NewEngine(state.NewNoopStore(""))
+	if err := noop.SetRules(ctx, "tenant-1", drop); err != nil {
+		t.Fatal(err)
+	}
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(noop.Rules("tenant-1")) != 1 {
+		t.Error("reloading an empty store dropped the rules")
+	}
+}
@@ -0,0 +1,169 @@
+package schema_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"parsec/internal/pipeline"
+	"parsec/internal/schema"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["order_id", "region"],
+	"properties": {
+		"order_id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+		"region": {"enum": ["eu", "us"]}
+	}
+}`
+
+func event(tenant string, metadata models.Metadata) *models.LogEvent {
+	return &models.LogEvent{ID: "evt-1", TenantID: tenant, Source: "orders", Message: "ok", Metadata: metadata}
+}
+
+func TestRegistry_RejectMode(t *testing.T) {
+	registry := schema.NewRegistry(nil)
+	ctx := context.Background()
+	s, err := registry.Set(ctx, "acme", schema.Schema{Schema: json.RawMessage(orderSchema)})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if s.Mode != schema.ModeReject {
+		t.Errorf("expected reject to be the default mode, got %q", s.Mode)
+	}
+
+	if _, err := registry.Process(ctx, event("acme", models.Metadata{"order_id": "ord-42", "region": "eu"})); err != nil {
+		t.Errorf("expected valid metadata to pass, got %v", err)
+	}
+
+	_, err = registry.Process(ctx, event("acme", models.Metadata{"order_id": "42"}))
+	if !errors.Is(err, schema.ErrViolation) {
+		t.Fatalf("expected a violation, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "/order_id") || !strings.Contains(err.Error(), "region") {
+		t.Errorf("expected the error to name the failing keys, got %q", err)
+	}
+
+	// Other tenants are unaffected
+	if _, err := registry.Process(ctx, event("other", nil)); err != nil {
+		t.Errorf("schema leaked across tenants: %v", err)
+	}
+}
+
+func TestRegistry_FlagMode(t *testing.T) {
+	registry := schema.NewRegistry(nil)
+	ctx := context.Background()
+	if _, err := registry.Set(ctx, "acme", schema.Schema{Schema: json.RawMessage(orderSchema), Mode: schema.ModeFlag}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := event("acme", models.Metadata{"order_id": "ord-1", "region": "apac"})
+	result, err := registry.Process(ctx, e)
+	if err != nil || !result.Changed {
+		t.Fatalf("expected the event to be flagged, got %+v, %v", result, err)
+	}
+	if !strings.Contains(e.Metadata.Get(schema.MetadataViolation), "/region") {
+		t.Errorf("unexpected violation: %q", e.Metadata[schema.MetadataViolation])
+	}
+
+	// Dry runs flag the event the same way
+	dry := event("acme", nil)
+	if _, err := registry.Process(pipeline.WithDryRun(ctx), dry); err != nil || dry.Metadata.Get(schema.MetadataViolation) == "" {
+		t.Errorf("expected a dry run to flag the event, got %v, %v", dry.Metadata, err)
+	}
+}
+
+func TestRegistry_RejectsInvalid(t *testing.T) {
+	registry := schema.NewRegistry(nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		schema schema.Schema
+		want   error
+	}{
+		{schema.Schema{}, schema.ErrInvalidSchema},
+		{schema.Schema{Schema: json.RawMessage(`{"type": "nope"}`)}, schema.ErrInvalidSchema},
+		{schema.Schema{Schema: json.RawMessage(`{"$ref": "file:///etc/passwd"}`)}, schema.ErrInvalidSchema},
+		{schema.Schema{Schema: json.RawMessage(orderSchema), Mode: "warn"}, schema.ErrInvalidMode},
+	}
+	for _, tt := range tests {
+		if _, err := registry.Set(ctx, "acme", tt.schema); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.schema.Schema, tt.want, err)
+		}
+	}
+	if _, ok := registry.Get("acme"); ok {
+		t.Error("expected no schema after failed updates")
+	}
+}
+
+func TestRegistry_SharedAcrossNodes(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	ctx := context.Background()
+	nodeA := schema.NewRegistry(store)
+	nodeB := schema.NewRegistry(store)
+
+	if _, err := nodeA.Set(ctx, "acme", schema.Schema{Schema: json.RawMessage(orderSchema)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nodeB.Process(ctx, event("acme", nil)); !errors.Is(err, schema.ErrViolation) {
+		t.Errorf("expected node B to enforce the schema, got %v", err)
+	}
+
+	if existed, err := nodeA.Delete(ctx, "acme"); err != nil || !existed {
+		t.Fatalf("expected the schema to be deleted, got %v, %v", existed, err)
+	}
+	if err := nodeB.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := nodeB.Get("acme"); ok {
+		t.Error("expected the deletion to propagate")
+	}
+	if existed, _ := nodeA.Delete(ctx, "acme"); existed {
+		t.Error("expected a second delete to find nothing")
+	}
+}
+
+func TestRegistry_NodesKeepEachOthersTenants(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	ctx := context.Background()
+
+	// Neither node has loaded the other's schema before setting its own
+	nodeA := schema.NewRegistry(store)
+	nodeB := schema.NewRegistry(store)
+	if _, err := nodeA.Set(ctx, "acme", schema.Schema{Schema: json.RawMessage(orderSchema)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nodeB.Set(ctx, "globex", schema.Schema{Schema: json.RawMessage(orderSchema)}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := schema.NewRegistry(store)
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"acme", "globex"} {
+		if _, ok := reader.Get(tenantID); !ok {
+			t.Errorf("%s: schema lost to another node's write", tenantID)
+		}
+	}
+
+	// A store that keeps nothing leaves the schemas set here in place
+	noop := schema.NewRegistry(state.NewNoopStore(""))
+	if _, err := noop.Set(ctx, "acme", schema.Schema{Schema: json.RawMessage(orderSchema)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := noop.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := noop.Get("acme"); !ok {
+		t.Error("reloading an empty store dropped the schema")
+	}
+}
@@ -0,0 +1,204 @@
+package scripting_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/pipeline"
+	"parsec/internal/scripting"
+	"parsec/internal/state"
+	"parsec/pkg/models"
+)
+
+func event(severity models.Severity, message string) *models.LogEvent {
+	return &models.LogEvent{
+		ID:        "evt-1",
+		TenantID:  "tenant-1",
+		Timestamp: time.Now(),
+		Severity:  severity,
+		Source:    "payments-api",
+		Message:   message,
+		Metadata:  models.Metadata{"region": "eu"},
+	}
+}
+
+func TestEngine_FilterAndTransform(t *testing.T) {
+	engine := scripting.NewEngine(nil, scripting.Limits{})
+	_, err := engine.Set(context.Background(), "tenant-1", scripting.Script{
+		Filter:    `not (severity == "DEBUG" && message contains "healthcheck")`,
+		Transform: `message contains "timeout" ? {"severity": "error", "metadata.team": "payments", "metadata.region": nil} : nil`,
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	ctx := context.Background()
+
+	result, err := engine.Process(ctx, event(models.SeverityDebug, "GET /healthcheck"))
+	if err != nil || !result.Drop {
+		t.Errorf("expected healthcheck to be filtered, got %+v, %v", result, err)
+	}
+
+	e := event(models.SeverityInfo, "upstream timeout")
+	result, err = engine.Process(ctx, e)
+	if err != nil || result.Drop || !result.Changed {
+		t.Fatalf("unexpected result: %+v, %v", result, err)
+	}
+	if e.Severity != models.SeverityError || e.Metadata["team"] != "payments" {
+		t.Errorf("transform not applied: %+v", e)
+	}
+	if _, ok := e.Metadata["region"]; ok {
+		t.Error("expected nil metadata value to remove the key")
+	}
+
+	// Other tenants are unaffected
+	other := event(models.SeverityDebug, "GET /healthcheck")
+	other.TenantID = "tenant-2"
+	if result, _ := engine.Process(ctx, other); result.Drop {
+		t.Error("script leaked across tenants")
+	}
+}
+
+func TestEngine_RejectsInvalidScripts(t *testing.T) {
+	engine := scripting.NewEngine(nil, scripting.Limits{})
+
+	tests := []struct {
+		name   string
+		script scripting.Script
+		want   error
+	}{
+		{"empty", scripting.Script{}, scripting.ErrEmptyScript},
+		{"syntax", scripting.Script{Filter: `severity ==`}, scripting.ErrCompile},
+		{"non-bool filter", scripting.Script{Filter: `message`}, scripting.ErrCompile},
+		{"unknown variable", scripting.Script{Transform: `{"message": body}`}, scripting.ErrCompile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := engine.Set(context.Background(), "tenant-1", tt.script); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestEngine_DisablesAfterViolations(t *testing.T) {
+	engine := scripting.NewEngine(nil, scripting.Limits{MemoryBudget: 100, MaxViolations: 2})
+	_, err := engine.Set(context.Background(), "tenant-1", scripting.Script{
+		Transform: `{"metadata.count": len(map(1..100000, # * 2))}`,
+	})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		e := event(models.SeverityInfo, "hello")
+		result, err := engine.Process(context.Background(), e)
+		if err != nil || result.Drop || result.Changed {
+			t.Fatalf("failing scripts must pass events through unchanged, got %+v, %v", result, err)
+		}
+	}
+
+	status := engine.Status("tenant-1")
+	if !status.Disabled || status.DisabledReason == "" {
+		t.Errorf("expected script disabled after violations, got %+v", status)
+	}
+
+	// Dry runs never count violations
+	dry := scripting.NewEngine(nil, scripting.Limits{MemoryBudget: 100, MaxViolations: 1})
+	dry.Set(context.Background(), "tenant-1", scripting.Script{Transform: `{"x": len(map(1..100000, #))}`})
+	dry.Process(pipeline.WithDryRun(context.Background()), event(models.SeverityInfo, "hello"))
+	if dry.Status("tenant-1").Disabled {
+		t.Error("dry run disabled a script")
+	}
+}
+
+func TestEngine_VersionsAndHotReload(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	a := scripting.NewEngine(store, scripting.Limits{})
+	if _, err := a.Set(ctx, "tenant-1", scripting.Script{Filter: `severity != "DEBUG"`}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Set(ctx, "tenant-1", scripting.Script{Filter: `severity == "ERROR"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second node picks up the latest version
+	b := scripting.NewEngine(store, scripting.Limits{})
+	if err := b.Load(ctx); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if result, _ := b.Process(ctx, event(models.SeverityInfo, "hello")); !result.Drop {
+		t.Error("expected version 2 to filter INFO events")
+	}
+
+	// Rolling back re-activates version 1 as version 3
+	script, err := a.Rollback(ctx, "tenant-1", 1)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if script.Version != 3 || script.Filter != `severity != "DEBUG"` {
+		t.Errorf("unexpected rollback result: %+v", script)
+	}
+	if _, err := a.Rollback(ctx, "tenant-1", 42); !errors.Is(err, scripting.ErrVersionNotFound) {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+
+	if err := b.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := b.Process(ctx, event(models.SeverityInfo, "hello")); result.Drop {
+		t.Error("expected rollback to propagate on reload")
+	}
+	if status := b.Status("tenant-1"); len(status.History) != 3 || status.Current.Version != 3 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestEngine_NodesKeepEachOthersTenants(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+	ctx := context.Background()
+
+	// Neither node has loaded the other's script before setting its own
+	a := scripting.NewEngine(store, scripting.Limits{})
+	b := scripting.NewEngine(store, scripting.Limits{})
+	if _, err := a.Set(ctx, "tenant-1", scripting.Script{Filter: `severity == "ERROR"`}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Set(ctx, "tenant-2", scripting.Script{Filter: `severity == "ERROR"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := scripting.NewEngine(store, scripting.Limits{})
+	if err := reader.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"tenant-1", "tenant-2"} {
+		if status := reader.Status(tenantID); status.Current == nil {
+			t.Errorf("%s: script lost to another node's write", tenantID)
+		}
+	}
+}
+
+func TestEngine_NoopStoreKeepsScripts(t *testing.T) {
+	ctx := context.Background()
+	e := scripting.NewEngine(state.NewNoopStore(""), scripting.Limits{})
+	if _, err := e.Set(ctx, "tenant-1", scripting.Script{Filter: `severity == "ERROR"`}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Set(ctx, "tenant-1", scripting.Script{Filter: `severity != "DEBUG"`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := e.Status("tenant-1"); status.Current == nil || status.Current.Version != 2 {
+		t.Errorf("reloading an empty store dropped the script: %+v", status)
+	}
+}
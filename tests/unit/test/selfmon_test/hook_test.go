@@ -0,0 +1,145 @@
+package selfmon_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+
+	"parsec/internal/metrics"
+	"parsec/internal/selfmon"
+	"parsec/pkg/models"
+)
+
+func TestHook_ForwardsWarnings(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	hook := selfmon.NewHook(selfmon.Config{
+		EnvelopeChan: ch,
+		NodeID:       "test-node",
+		MinLevel:     zerolog.WarnLevel,
+	})
+	log := zerolog.New(io.Discard).Hook(hook)
+
+	log.Info().Msg("ignored")
+	log.Warn().Msg("kafka slow")
+
+	select {
+	case envelope := <-ch:
+		if envelope.Event.TenantID != models.InternalTenantID {
+			t.Errorf("expected internal tenant, got %s", envelope.Event.TenantID)
+		}
+		if envelope.Event.Severity != models.SeverityWarning {
+			t.Errorf("expected WARNING severity, got %s", envelope.Event.Severity)
+		}
+		if envelope.Event.Message != "kafka slow" {
+			t.Errorf("unexpected message: %q", envelope.Event.Message)
+		}
+		if err := envelope.Event.Validate(); err != nil {
+			t.Errorf("internal event should validate: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no envelope received")
+	}
+
+	if len(ch) != 0 {
+		t.Errorf("expected info log to be ignored, got %d extra envelopes", len(ch))
+	}
+}
+
+func TestHook_LoopProtection(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	hook := selfmon.NewHook(selfmon.Config{
+		EnvelopeChan:  ch,
+		NodeID:        "test-node",
+		RatePerSecond: 3,
+		DedupeWindow:  time.Minute,
+	})
+	log := zerolog.New(io.Discard).Hook(hook)
+
+	// Repeated messages are suppressed
+	for i := 0; i < 10; i++ {
+		log.Error().Msg("publish failed")
+	}
+	if len(ch) != 1 {
+		t.Fatalf("expected 1 envelope after dedupe, got %d", len(ch))
+	}
+
+	// Distinct messages are rate limited
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		log.Error().Msg(msg)
+	}
+	if len(ch) != 3 {
+		t.Errorf("expected rate limit to cap envelopes at 3, got %d", len(ch))
+	}
+}
+
+func TestHook_Close(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	hook := selfmon.NewHook(selfmon.Config{EnvelopeChan: ch})
+	log := zerolog.New(io.Discard).Hook(hook)
+
+	hook.Close()
+	log.Error().Msg("after close")
+
+	if len(ch) != 0 {
+		t.Errorf("expected no envelopes after close, got %d", len(ch))
+	}
+}
+
+func TestHook_ConcurrentLogsAreAllForwarded(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	hook := selfmon.NewHook(selfmon.Config{EnvelopeChan: ch, RatePerSecond: 100})
+	log := zerolog.New(io.Discard).Hook(hook)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Error().Msg(fmt.Sprintf("failure %d", i))
+		}()
+	}
+	wg.Wait()
+
+	if len(ch) != 50 {
+		t.Errorf("expected all 50 concurrent errors forwarded, got %d", len(ch))
+	}
+}
+
+func TestHook_SkipsLogsAboutItsOwnEvents(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	hook := selfmon.NewHook(selfmon.Config{EnvelopeChan: ch})
+	log := zerolog.New(io.Discard).Hook(hook)
+
+	log.Error().Msg("kafka down")
+	own := <-ch
+	if !selfmon.Emitted(own) {
+		t.Fatalf("hook event not marked: %+v", own.Event.Metadata)
+	}
+	tenant := models.NewEnvelope(&models.LogEvent{TenantID: "acme", Metadata: models.Metadata{selfmon.MarkerKey: true}}, "node")
+	if selfmon.Emitted(tenant) {
+		t.Error("a tenant's event claiming the marker counts as the hook's")
+	}
+
+	reentrant := metrics.SelfMonitorEventsTotal.WithLabelValues("reentrant")
+	before := testutil.ToFloat64(reentrant)
+
+	log.Error().Ctx(selfmon.Handling(context.Background(), own)).Msg("failed to publish batch")
+	if len(ch) != 0 {
+		t.Errorf("log about publishing the hook's event was republished")
+	}
+	if got := testutil.ToFloat64(reentrant) - before; got != 1 {
+		t.Errorf("expected 1 reentrant drop counted, got %v", got)
+	}
+
+	// A batch mixing tenant events is still reported
+	log.Error().Ctx(selfmon.Handling(context.Background(), own, tenant)).Msg("failed to publish batch")
+	if len(ch) != 1 {
+		t.Errorf("log about a mixed batch was dropped")
+	}
+}
@@ -0,0 +1,187 @@
+package sentry_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/sentry"
+	"parsec/pkg/models"
+)
+
+const exceptionEvent = `{"event_id":"fc6d8c0c43fc4630ad850ee518f1b9d0","timestamp":1718000000.5,"level":"error",
+"platform":"python","logger":"checkout","server_name":"web-1","release":"shop@1.4.0","environment":"production",
+"exception":{"values":[
+ {"type":"KeyError","value":"'sku'","stacktrace":{"frames":[{"function":"load","filename":"cart.py","lineno":10}]}},
+ {"type":"ValueError","value":"bad cart","module":"shop.cart","stacktrace":{"frames":[
+  {"function":"handle","filename":"views.py","lineno":42},
+  {"function":"validate","filename":"cart.py","lineno":17,"colno":3}]}}]},
+"tags":[["browser","Chrome"],["http.status",500]],
+"user":{"id":"u-1","email":"a@example.com"},
+"contexts":{"trace":{"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}},
+"sdk":{"name":"sentry.python","version":"2.1.0"}}`
+
+func TestParseEnvelope(t *testing.T) {
+	event := `{"message":"hi"}`
+	body := `{"event_id":"abc","dsn":"https://pubkey@sentry.example.com/42","sent_at":"2024-06-10T06:13:20Z"}
+{"type":"event","length":16}
+` + event + `
+{"type":"session"}
+{"started":"2024-06-10T06:13:20Z","status":"ok"}
+{"type":"attachment","length":5}
+a
+bc
+`
+	env, err := sentry.ParseEnvelope([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseEnvelope: %v", err)
+	}
+	if env.Header.EventID != "abc" || env.Header.PublicKey() != "pubkey" {
+		t.Errorf("unexpected header: %+v", env.Header)
+	}
+	if len(env.Items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(env.Items))
+	}
+	if env.Items[0].Type != "event" || string(env.Items[0].Payload) != event {
+		t.Errorf("unexpected event item: %s %q", env.Items[0].Type, env.Items[0].Payload)
+	}
+	if env.Items[1].Type != "session" || string(env.Items[1].Payload) != `{"started":"2024-06-10T06:13:20Z","status":"ok"}` {
+		t.Errorf("unexpected session item: %s %q", env.Items[1].Type, env.Items[1].Payload)
+	}
+	// A length-delimited payload may contain newlines
+	if string(env.Items[2].Payload) != "a\nbc\n" {
+		t.Errorf("unexpected attachment payload %q", env.Items[2].Payload)
+	}
+
+	for _, bad := range []string{
+		"not json",
+		"{}\nnot json\n{}",
+		"{}\n{\"length\":2}\n{}",
+		"{}\n{\"type\":\"event\",\"length\":100}\n{}",
+	} {
+		if _, err := sentry.ParseEnvelope([]byte(bad)); !errors.Is(err, sentry.ErrInvalidEnvelope) {
+			t.Errorf("%q: expected ErrInvalidEnvelope, got %v", bad, err)
+		}
+	}
+}
+
+func TestEvent_LogEvent(t *testing.T) {
+	parsed, err := sentry.ParseEvent([]byte(exceptionEvent))
+	if err != nil {
+		t.Fatalf("ParseEvent: %v", err)
+	}
+	event := parsed.LogEvent("web", "", time.Time{})
+
+	if event.ID != "fc6d8c0c43fc4630ad850ee518f1b9d0" || event.TenantID != "web" || event.Source != "checkout" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if !event.Timestamp.Equal(time.Date(2024, 6, 10, 6, 13, 20, 500000000, time.UTC)) {
+		t.Errorf("unexpected timestamp %s", event.Timestamp)
+	}
+	if event.Severity != models.SeverityError {
+		t.Errorf("unexpected severity %s", event.Severity)
+	}
+	want := "ValueError: bad cart\n    at validate (cart.py:17:3)\n    at handle (views.py:42)\n" +
+		"Caused by: KeyError: 'sku'\n    at load (cart.py:10)"
+	if event.Message != want {
+		t.Errorf("unexpected message:\n%s", event.Message)
+	}
+	if event.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || event.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected trace context %s/%s", event.TraceID, event.SpanID)
+	}
+
+	for key, want := range map[string]string{
+		"platform":       "python",
+		"server_name":    "web-1",
+		"release":        "shop@1.4.0",
+		"environment":    "production",
+		"exception_type": "ValueError",
+		"sdk":            "sentry.python/2.1.0",
+	} {
+		if event.Metadata[key] != want {
+			t.Errorf("metadata %s = %v, want %q", key, event.Metadata[key], want)
+		}
+	}
+	tags, _ := event.Metadata["tags"].(map[string]any)
+	if tags["browser"] != "Chrome" || tags["http.status"] != "500" {
+		t.Errorf("unexpected tags: %v", event.Metadata["tags"])
+	}
+	if user, _ := event.Metadata["user"].(map[string]any); user["id"] != "u-1" {
+		t.Errorf("unexpected user: %v", event.Metadata["user"])
+	}
+}
+
+func TestEvent_MessageDefaults(t *testing.T) {
+	parsed, err := sentry.ParseEvent([]byte(`{"logentry":{"message":"user %s logged in","formatted":"user bob logged in"},
+		"level":"info","timestamp":"2024-06-10T06:13:20Z","tags":{"region":"eu"}}`))
+	if err != nil {
+		t.Fatalf("ParseEvent: %v", err)
+	}
+	sentAt := time.Date(2024, 6, 10, 7, 0, 0, 0, time.UTC)
+	event := parsed.LogEvent("web", "envelope-id", sentAt)
+	if event.Message != "user bob logged in" || event.Severity != models.SeverityInfo || event.Source != sentry.Source {
+		t.Errorf("unexpected event: %s %s %q", event.Severity, event.Source, event.Message)
+	}
+	if event.ID != "envelope-id" || !event.Timestamp.Equal(time.Date(2024, 6, 10, 6, 13, 20, 0, time.UTC)) {
+		t.Errorf("unexpected id/timestamp: %s %s", event.ID, event.Timestamp)
+	}
+
+	// Without a timestamp the envelope's sent_at is used
+	parsed, _ = sentry.ParseEvent([]byte(`{"message":"plain"}`))
+	if event := parsed.LogEvent("web", "", sentAt); !event.Timestamp.Equal(sentAt) || event.ID == "" || event.Message != "plain" {
+		t.Errorf("unexpected defaults: %+v", event)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	for level, want := range map[string]models.Severity{
+		"fatal":   models.SeverityCritical,
+		"error":   models.SeverityError,
+		"warning": models.SeverityWarning,
+		"info":    models.SeverityInfo,
+		"debug":   models.SeverityDebug,
+		"":        models.SeverityError,
+	} {
+		if got := sentry.Severity(level); got != want {
+			t.Errorf("Severity(%q) = %s, want %s", level, got, want)
+		}
+	}
+}
+
+func TestParseLogs(t *testing.T) {
+	records, err := sentry.ParseLogs([]byte(`{"items":[{"timestamp":1718000000,"level":"warn","body":"slow query",
+		"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736",
+		"attributes":{"sentry.release":{"value":"1.0","type":"string"},"db.duration_ms":{"value":812,"type":"integer"}}}]}`))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ParseLogs: %v %d", err, len(records))
+	}
+	event := records[0].LogEvent("web", time.Time{})
+	if event.Message != "slow query" || event.Severity != models.SeverityWarning || event.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected log event: %+v", event)
+	}
+	if event.Metadata["release"] != "1.0" || event.Metadata["db.duration_ms"] != float64(812) {
+		t.Errorf("unexpected metadata: %v", event.Metadata)
+	}
+}
+
+func TestParseProjectsAndAuthKey(t *testing.T) {
+	projects, err := sentry.ParseProjects("42=web:abc, 7 = api : def")
+	if err != nil {
+		t.Fatalf("ParseProjects: %v", err)
+	}
+	if projects["42"] != (sentry.Project{Tenant: "web", Key: "abc"}) || projects["7"] != (sentry.Project{Tenant: "api", Key: "def"}) {
+		t.Errorf("unexpected projects: %+v", projects)
+	}
+	for _, bad := range []string{"42=web", "42", "=web:abc", "42=:abc"} {
+		if _, err := sentry.ParseProjects(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	if key := sentry.AuthKey("Sentry sentry_version=7, sentry_client=sentry.python/2.1.0, sentry_key=abc"); key != "abc" {
+		t.Errorf("unexpected key %q", key)
+	}
+	if key := sentry.AuthKey("Bearer token"); key != "" {
+		t.Errorf("expected no key, got %q", key)
+	}
+}
@@ -0,0 +1,141 @@
+package slo_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"parsec/internal/alerts"
+	"parsec/internal/slo"
+	"parsec/pkg/models"
+)
+
+// collector records emitted alert events
+type collector struct {
+	events []*models.LogEvent
+}
+
+func (c *collector) emit(event *models.LogEvent) {
+	c.events = append(c.events, event)
+}
+
+func objective(t *testing.T, snapshot slo.Snapshot, name string) slo.Status {
+	t.Helper()
+	for _, s := range snapshot.Objectives {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no %s objective in %+v", name, snapshot)
+	return slo.Status{}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestTracker_AvailabilityFromMiddleware(t *testing.T) {
+	tracker := slo.NewTracker(slo.Config{AvailabilityTarget: 0.9})
+	statuses := []int{http.StatusAccepted, http.StatusBadRequest, http.StatusServiceUnavailable, http.StatusAccepted}
+	for _, status := range statuses {
+		h := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ingest", nil))
+	}
+
+	// A panicking handler counts as a server error
+	func() {
+		defer func() { recover() }()
+		tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ingest", nil))
+	}()
+
+	s := objective(t, tracker.Snapshot(time.Now()), slo.Availability)
+	if s.Good != 3 || s.Total != 5 || !near(s.SLI, 0.6) {
+		t.Fatalf("expected 3 of 5 good, got %+v", s)
+	}
+	// 40% errors against a 10% budget
+	if !near(s.BurnRates["5m"], 4) || !near(s.BudgetRemaining, -3) {
+		t.Errorf("expected a burn rate of 4 and an overspent budget, got %+v", s)
+	}
+}
+
+func TestTracker_PublishLatency(t *testing.T) {
+	tracker := slo.NewTracker(slo.Config{LatencyThreshold: time.Second})
+	now := time.Now()
+	fresh := &models.Envelope{ReceivedAt: now}
+	stale := &models.Envelope{ReceivedAt: now.Add(-time.Minute)}
+	tracker.RecordPublish([]*models.Envelope{fresh, fresh, stale}, []*models.Envelope{fresh})
+
+	s := objective(t, tracker.Snapshot(now), slo.PublishLatency)
+	if s.Good != 2 || s.Total != 4 {
+		t.Errorf("expected 2 of 4 published in time, got %+v", s)
+	}
+
+	// Old events leave the burn windows but stay in the budget window
+	later := objective(t, tracker.Snapshot(now.Add(2*time.Hour)), slo.PublishLatency)
+	if later.BurnRates["1h"] != 0 || later.BurnRates["6h"] == 0 || later.Total != 4 {
+		t.Errorf("expected only the 6h window and budget to count the events, got %+v", later)
+	}
+}
+
+func TestTracker_EmptyObjectives(t *testing.T) {
+	tracker := slo.NewTracker(slo.Config{})
+	snapshot := tracker.Snapshot(time.Now())
+	if snapshot.Window != (30*24*time.Hour).String() || snapshot.LatencyThreshold != "1s" {
+		t.Errorf("unexpected defaults %+v", snapshot)
+	}
+	for _, s := range snapshot.Objectives {
+		if s.SLI != 1 || s.BudgetRemaining != 1 || s.BurnRates["1h"] != 0 {
+			t.Errorf("expected a full budget without events, got %+v", s)
+		}
+	}
+}
+
+func TestTracker_BurnAlerts(t *testing.T) {
+	ctx := context.Background()
+	tracker := slo.NewTracker(slo.Config{AvailabilityTarget: 0.99, AlertTenant: "system"})
+	engine := alerts.NewNoopEngine()
+	alerted := &collector{}
+
+	// Without an engine only the gauges are updated
+	for i := 0; i < 10; i++ {
+		tracker.RecordRequest(http.StatusInternalServerError)
+	}
+	if err := tracker.Check(ctx, time.Now(), nil, alerted.emit); err != nil || len(alerted.events) != 0 {
+		t.Fatalf("expected no alerts without an engine, got %v, %v", alerted.events, err)
+	}
+
+	// Every request failing burns 100x too fast
+	for i := 0; i < 2; i++ {
+		if err := tracker.Check(ctx, time.Now(), engine, alerted.emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerted.events) != 1 {
+		t.Fatalf("expected one alert while burning, got %d", len(alerted.events))
+	}
+	event := alerted.events[0]
+	if event.Severity != models.SeverityCritical || event.TenantID != "system" || event.Source != slo.AlertSource ||
+		event.Metadata["slo"] != slo.Availability || event.Metadata["slo_alert"] != slo.AlertFastBurn {
+		t.Errorf("unexpected alert %+v", event)
+	}
+	if s := objective(t, tracker.Snapshot(time.Now()), slo.Availability); s.Alert != slo.AlertFastBurn {
+		t.Errorf("expected the alert open in the snapshot, got %+v", s)
+	}
+
+	// Once the failures leave the short windows, the alert recovers
+	later := time.Now().Add(7 * time.Hour)
+	if err := tracker.Check(ctx, later, engine, alerted.emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerted.events) != 2 || alerted.events[1].Metadata["slo_alert"] != slo.AlertRecovered ||
+		alerted.events[1].Severity != models.SeverityInfo {
+		t.Errorf("expected a recovery, got %+v", alerted.events)
+	}
+}
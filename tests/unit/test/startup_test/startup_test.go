@@ -0,0 +1,148 @@
+package startup_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"parsec/internal/objstore"
+	"parsec/internal/startup"
+)
+
+var fast = startup.Config{
+	MaxWait:        time.Second,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	CheckTimeout:   100 * time.Millisecond,
+}
+
+func TestWait_RetriesUntilReachable(t *testing.T) {
+	var kafkaChecks, redisChecks atomic.Int32
+	deps := []startup.Dependency{
+		{Name: "kafka", Check: func(ctx context.Context) error {
+			if kafkaChecks.Add(1) < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}},
+		{Name: "redis", Check: func(ctx context.Context) error {
+			redisChecks.Add(1)
+			return nil
+		}},
+	}
+
+	if err := startup.Wait(context.Background(), fast, deps); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if kafkaChecks.Load() != 3 {
+		t.Errorf("expected 3 kafka checks, got %d", kafkaChecks.Load())
+	}
+	// Reachable dependencies are not checked again
+	if redisChecks.Load() != 1 {
+		t.Errorf("expected 1 redis check, got %d", redisChecks.Load())
+	}
+}
+
+func TestWait_Timeout(t *testing.T) {
+	cfg := fast
+	cfg.MaxWait = 30 * time.Millisecond
+	deps := []startup.Dependency{
+		{Name: "storage", Check: func(ctx context.Context) error { return errors.New("no such host") }},
+		{Name: "redis", Check: func(ctx context.Context) error { return nil }},
+	}
+
+	err := startup.Wait(context.Background(), cfg, deps)
+	if !errors.Is(err, startup.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "storage: no such host") || strings.Contains(err.Error(), "redis") {
+		t.Errorf("expected only the unreachable dependency in the error, got %v", err)
+	}
+}
+
+func TestWait_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := fast
+	cfg.MaxWait = 0
+	deps := []startup.Dependency{{Name: "kafka", Check: func(ctx context.Context) error {
+		cancel()
+		return errors.New("down")
+	}}}
+
+	if err := startup.Wait(ctx, cfg, deps); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWait_CheckTimeout(t *testing.T) {
+	cfg := fast
+	cfg.CheckTimeout = 5 * time.Millisecond
+	var calls atomic.Int32
+	deps := []startup.Dependency{{Name: "kafka", Check: func(ctx context.Context) error {
+		if calls.Add(1) == 1 {
+			<-ctx.Done() // a hung check is cut short and retried
+			return ctx.Err()
+		}
+		return nil
+	}}}
+
+	if err := startup.Wait(context.Background(), cfg, deps); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestParseDependencies(t *testing.T) {
+	names, err := startup.ParseDependencies(" Kafka, redis,,storage ")
+	if err != nil || strings.Join(names, ",") != "kafka,redis,storage" {
+		t.Errorf("unexpected dependencies %v, %v", names, err)
+	}
+	if _, err := startup.ParseDependencies("kafka,postgres"); err == nil {
+		t.Error("expected an unknown dependency to be rejected")
+	}
+}
+
+func TestRedisCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for i := 0; i < 3; i++ { // *1, $4, PING
+				r.ReadString('\n')
+			}
+			conn.Write([]byte("+PONG\r\n"))
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := startup.RedisCheck(ln.Addr().String())(ctx); err != nil {
+		t.Errorf("expected redis to be reachable: %v", err)
+	}
+
+	addr := ln.Addr().String()
+	ln.Close()
+	if err := startup.RedisCheck(addr)(ctx); err == nil {
+		t.Error("expected a closed port to be unreachable")
+	}
+}
+
+func TestStorageCheck(t *testing.T) {
+	check := startup.StorageCheck(objstore.NewDir(t.TempDir()), "exports")
+	if err := check(context.Background()); err != nil {
+		t.Errorf("expected storage to be reachable: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package state_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"parsec/internal/state"
+)
+
+func newStore(t *testing.T) *state.MemoryStore {
+	t.Helper()
+	s := state.NewMemoryStore(state.MemoryConfig{CleanupInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMemoryStore_GetSet(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	if v, err := s.Get(ctx, "missing"); v != nil || err != nil {
+		t.Errorf("expected nil for missing key, got %q, %v", v, err)
+	}
+
+	s.Set(ctx, "k", []byte("v1"))
+	prev, err := s.GetSet(ctx, "k", []byte("v2"))
+	if err != nil || string(prev) != "v1" {
+		t.Errorf("expected previous v1, got %q, %v", prev, err)
+	}
+	if v, _ := s.Get(ctx, "k"); string(v) != "v2" {
+		t.Errorf("expected v2, got %q", v)
+	}
+}
+
+func TestMemoryStore_Incr(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		delta int64
+		want  int64
+	}{
+		{1, 1},
+		{5, 6},
+		{-10, -4},
+	}
+	for _, tt := range tests {
+		got, err := s.Incr(ctx, "counter", tt.delta)
+		if err != nil || got != tt.want {
+			t.Errorf("Incr(%d): expected %d, got %d, %v", tt.delta, tt.want, got, err)
+		}
+	}
+
+	s.Set(ctx, "text", []byte("abc"))
+	if _, err := s.Incr(ctx, "text", 1); !errors.Is(err, state.ErrNotInteger) {
+		t.Errorf("expected ErrNotInteger, got %v", err)
+	}
+}
+
+func TestMemoryStore_TTL(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	ok, err := s.SetNX(ctx, "lock", []byte("node-1"), 30*time.Millisecond)
+	if !ok || err != nil {
+		t.Fatalf("expected SetNX to succeed, got %v, %v", ok, err)
+	}
+	if ok, _ := s.SetNX(ctx, "lock", []byte("node-2"), time.Second); ok {
+		t.Error("SetNX overwrote an existing key")
+	}
+
+	// Counters keep their TTL across increments
+	s.Incr(ctx, "rate", 1)
+	if ok, _ := s.Expire(ctx, "rate", 30*time.Millisecond); !ok {
+		t.Error("expected Expire to find the key")
+	}
+	s.Incr(ctx, "rate", 1)
+
+	if ok, _ := s.Expire(ctx, "missing", time.Second); ok {
+		t.Error("Expire reported a missing key as present")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if v, _ := s.Get(ctx, "lock"); v != nil {
+		t.Errorf("expected lock to expire, got %q", v)
+	}
+	if got, _ := s.Incr(ctx, "rate", 1); got != 1 {
+		t.Errorf("expected counter to restart after expiry, got %d", got)
+	}
+	if ok, _ := s.SetNX(ctx, "lock", []byte("node-2"), 0); !ok {
+		t.Error("expected SetNX to succeed after expiry")
+	}
+}
+
+func TestMemoryStore_EvictsExpiredKeys(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		s.SetNX(ctx, key, []byte("x"), 10*time.Millisecond)
+	}
+	s.Set(ctx, "keep", []byte("x"))
+
+	deadline := time.Now().Add(time.Second)
+	for s.Len() > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s.Len() != 1 {
+		t.Errorf("expected expired keys evicted without access, %d keys left", s.Len())
+	}
+}
+
+func TestMemoryStore_Window(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	base := time.Now()
+	window := time.Minute
+
+	for i := 0; i < 3; i++ {
+		s.WindowAdd(ctx, "errors", base.Add(time.Duration(i)*20*time.Second), window)
+	}
+
+	// At base+40s all three occurrences are within the last minute
+	if n, _ := s.WindowCount(ctx, "errors", base.Add(40*time.Second), window); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+
+	// At base+70s the first occurrence has slid out
+	n, err := s.WindowAdd(ctx, "errors", base.Add(70*time.Second), window)
+	if err != nil || n != 3 {
+		t.Errorf("expected 3 after sliding, got %d, %v", n, err)
+	}
+
+	s.Set(ctx, "plain", []byte("x"))
+	if _, err := s.WindowAdd(ctx, "plain", base, window); !errors.Is(err, state.ErrWrongType) {
+		t.Errorf("expected ErrWrongType, got %v", err)
+	}
+	if _, err := s.Get(ctx, "errors"); !errors.Is(err, state.ErrWrongType) {
+		t.Errorf("expected ErrWrongType reading a window, got %v", err)
+	}
+}
+
+func TestMemoryStore_WindowCap(t *testing.T) {
+	s := state.NewMemoryStore(state.MemoryConfig{MaxWindowEntries: 5})
+	defer s.Close()
+
+	now := time.Now()
+	var n int64
+	for i := 0; i < 10; i++ {
+		n, _ = s.WindowAdd(context.Background(), "burst", now, time.Minute)
+	}
+	if n != 5 {
+		t.Errorf("expected window capped at 5, got %d", n)
+	}
+}
@@ -0,0 +1,72 @@
+package state_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"parsec/internal/state"
+)
+
+func TestVersioned_ConcurrentUpdatesAreKept(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+
+	// Values written before versioning are version 0
+	s.Set(ctx, "counter", []byte("100"))
+	v := state.NewVersioned(s, "counter")
+	if data, err := v.Get(ctx); err != nil || string(data) != "100" {
+		t.Fatalf("expected the plain value, got %q, %v", data, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each writer has its own handle, as another node would
+			v := state.NewVersioned(s, "counter")
+			for j := 0; j < 5; j++ {
+				err := v.Update(ctx, func(current []byte) ([]byte, error) {
+					n, _ := strconv.Atoi(string(current))
+					return []byte(strconv.Itoa(n + 1)), nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if data, err := v.Get(ctx); err != nil || string(data) != "120" {
+		t.Errorf("expected every increment kept, got %q, %v", data, err)
+	}
+}
+
+func TestVersioned_LooksAheadOfLaggingHead(t *testing.T) {
+	s := newStore(t)
+	ctx := context.Background()
+	v := state.NewVersioned(s, "rules")
+
+	if data, err := v.Get(ctx); err != nil || data != nil {
+		t.Fatalf("expected nil before any write, got %q, %v", data, err)
+	}
+	if err := v.Update(ctx, func([]byte) ([]byte, error) { return []byte("a"), nil }); err != nil {
+		t.Fatal(err)
+	}
+	// A node that stopped after writing a version but before counting it
+	s.SetNX(ctx, "rules:v2", []byte("b"), 0)
+
+	if data, err := v.Get(ctx); err != nil || string(data) != "b" {
+		t.Errorf("expected the uncounted version, got %q, %v", data, err)
+	}
+	err := v.Update(ctx, func(current []byte) ([]byte, error) { return append(current, 'c'), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := v.Get(ctx); string(data) != "bc" {
+		t.Errorf("expected the change applied to the latest version, got %q", data)
+	}
+}
@@ -0,0 +1,149 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/storage"
+)
+
+// fakeAggregator records persisted keys and can be made to fail
+type fakeAggregator struct {
+	mu     sync.Mutex
+	keys   []string
+	fail   bool
+	closed bool
+}
+
+func (a *fakeAggregator) Persist(ctx context.Context, key string, payload []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.fail {
+		return errors.New("backend down")
+	}
+	a.keys = append(a.keys, key)
+	return nil
+}
+
+func (a *fakeAggregator) Close() error {
+	a.closed = true
+	return nil
+}
+
+func (a *fakeAggregator) persisted() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.keys...)
+}
+
+func TestBufferedWriter_FlushesOnSize(t *testing.T) {
+	inner := &fakeAggregator{}
+	w, err := storage.NewBufferedWriter(inner, storage.BufferConfig{MaxRows: 3, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b"} {
+		if err := w.Persist(ctx, key, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := inner.persisted(); len(got) != 0 {
+		t.Fatalf("flushed early: %v", got)
+	}
+
+	w.Persist(ctx, "c", []byte("x"))
+	if got := inner.persisted(); len(got) != 3 || got[2] != "c" {
+		t.Errorf("persisted = %v", got)
+	}
+}
+
+func TestBufferedWriter_FlushesOnInterval(t *testing.T) {
+	inner := &fakeAggregator{}
+	w, err := storage.NewBufferedWriter(inner, storage.BufferConfig{FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go w.Run()
+	defer w.Close()
+
+	w.Persist(context.Background(), "a", []byte("x"))
+	deadline := time.Now().Add(time.Second)
+	for len(inner.persisted()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := inner.persisted(); len(got) != 1 {
+		t.Errorf("persisted = %v", got)
+	}
+}
+
+func TestBufferedWriter_BoundedMemory(t *testing.T) {
+	inner := &fakeAggregator{fail: true}
+	w, err := storage.NewBufferedWriter(inner, storage.BufferConfig{MaxBytes: 10, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := w.Persist(ctx, "a", make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Persist(ctx, "b", make([]byte, 8)); !errors.Is(err, storage.ErrBufferFull) {
+		t.Errorf("Persist() = %v, want ErrBufferFull", err)
+	}
+	if w.Buffered() != 1 {
+		t.Errorf("Buffered() = %d, want 1", w.Buffered())
+	}
+}
+
+func TestBufferedWriter_SpillsOnShutdownAndReloads(t *testing.T) {
+	spill := filepath.Join(t.TempDir(), "storage.spill")
+	ctx := context.Background()
+
+	down := &fakeAggregator{fail: true}
+	w, err := storage.NewBufferedWriter(down, storage.BufferConfig{
+		FlushInterval:   time.Hour,
+		ShutdownTimeout: 50 * time.Millisecond,
+		SpillPath:       spill,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Persist(ctx, "a", []byte(`{"n":1}`))
+	w.Persist(ctx, "b", []byte(`{"n":2}`))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if !down.closed {
+		t.Error("backend not closed")
+	}
+
+	// The next run flushes the spilled rows before new ones
+	up := &fakeAggregator{}
+	w, err = storage.NewBufferedWriter(up, storage.BufferConfig{FlushInterval: time.Hour, SpillPath: spill})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Buffered() != 2 {
+		t.Fatalf("reloaded %d rows, want 2", w.Buffered())
+	}
+	w.Persist(ctx, "c", []byte(`{"n":3}`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := up.persisted()
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("persisted = %v", got)
+	}
+	if _, err := os.Stat(spill); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("spill file not removed after flush: %v", err)
+	}
+}
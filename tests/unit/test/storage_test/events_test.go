@@ -0,0 +1,59 @@
+package storage_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/storage"
+)
+
+func TestEventQuery(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	to := from.Add(5 * time.Minute)
+
+	query, args := storage.EventQuery("logs", storage.EventFilter{TenantID: "acme", From: from, To: to, BatchID: "batch-1"})
+	want := "SELECT * FROM logs WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ? AND batch_id = ? ORDER BY batch_index LIMIT 1000"
+	if query != want {
+		t.Errorf("got query %q", query)
+	}
+	if !reflect.DeepEqual(args, []any{"acme", from, to, "batch-1"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	// Without a batch, newest events come first
+	query, args = storage.EventQuery("logs", storage.EventFilter{TenantID: "acme", Limit: 50})
+	if !strings.HasSuffix(query, "WHERE tenant_id = ? ORDER BY timestamp DESC LIMIT 50") || len(args) != 1 {
+		t.Errorf("unexpected query %q with args %v", query, args)
+	}
+}
+
+func TestMigrations_AddBatchColumnsAfterRollups(t *testing.T) {
+	migrations := storage.Migrations("logs")
+	if len(migrations) != len(storage.DefaultRollups)+2 {
+		t.Fatalf("expected the rollups, the batch columns and the retention column, got %d migrations", len(migrations))
+	}
+
+	conn := &fakeConn{version: int64(len(storage.DefaultRollups))}
+	version, err := storage.Migrate(context.Background(), conn, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("expected version %d, got %d", len(migrations), version)
+	}
+	for _, stmt := range conn.statements {
+		if strings.Contains(stmt, "rollup") {
+			t.Errorf("expected applied rollups skipped, ran %s", stmt)
+		}
+	}
+	applied := strings.Join(conn.statements, "\n")
+	if !strings.Contains(applied, "ADD COLUMN IF NOT EXISTS batch_id String") {
+		t.Errorf("expected the batch columns added, got %v", conn.statements)
+	}
+	if !strings.Contains(applied, "ADD COLUMN IF NOT EXISTS retention_seconds UInt32") {
+		t.Errorf("expected the retention column added, got %v", conn.statements)
+	}
+}
@@ -0,0 +1,42 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"parsec/internal/storage"
+	"parsec/pkg/models"
+)
+
+func TestMetadataColumns(t *testing.T) {
+	flat, raw, err := storage.MetadataColumns(models.Metadata{"region": "eu", "retries": 2.0})
+	if err != nil || raw != "" || flat["region"] != "eu" || flat["retries"] != "2" {
+		t.Fatalf("expected flat metadata only, got %v %q %v", flat, raw, err)
+	}
+
+	var metadata models.Metadata
+	if err := json.Unmarshal([]byte(`{"http":{"status":503,"headers":{}},"tags":["a","b"],"ok":false}`), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	flat, raw, err = storage.MetadataColumns(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"http.status": "503", "http.headers": "{}", "tags.0": "a", "tags.1": "b", "ok": "false"}
+	if len(flat) != len(want) {
+		t.Errorf("unexpected flattened metadata: %v", flat)
+	}
+	for k, v := range want {
+		if flat[k] != v {
+			t.Errorf("%s = %q, want %q", k, flat[k], v)
+		}
+	}
+
+	var decoded models.Metadata
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		t.Fatalf("invalid metadata_json %q: %v", raw, err)
+	}
+	if status, ok := decoded.Lookup("http.status"); !ok || models.Stringify(status) != "503" {
+		t.Errorf("expected the JSON to keep the structure, got %s", raw)
+	}
+}
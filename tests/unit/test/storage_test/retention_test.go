@@ -0,0 +1,43 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/storage"
+)
+
+func TestRetentionPolicy_Place(t *testing.T) {
+	policy := storage.DefaultRetentionPolicy()
+	day := int64(24 * time.Hour / time.Second)
+
+	tests := []struct {
+		name  string
+		tier  string
+		hint  int64
+		table string
+		ttl   time.Duration
+	}{
+		{"no hint keeps the tier", storage.TierShort, 0, "logs_short", policy.ShortTTL},
+		{"untiered without hint", "", 0, "logs", policy.LongTTL},
+		{"short hint picks the short tier", "", 3 * day, "logs_short", 3 * 24 * time.Hour},
+		{"long hint picks the long tier", "", 7 * 365 * day, "logs_long", 7 * 365 * 24 * time.Hour},
+		{"hint overrides the tier's ttl", storage.TierShort, 30 * day, "logs_short", 30 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := policy.Place("logs", tt.tier, tt.hint)
+			if p.Table != tt.table || p.TTL != tt.ttl {
+				t.Errorf("got %+v, want %s with ttl %s", p, tt.table, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestRetentionColumnsDDL(t *testing.T) {
+	stmts := storage.RetentionColumnsDDL("logs", 90*24*time.Hour)
+	if len(stmts) != 2 || !strings.Contains(stmts[1], "if(retention_seconds = 0, 7776000, retention_seconds)") {
+		t.Errorf("unexpected statements %v", stmts)
+	}
+}
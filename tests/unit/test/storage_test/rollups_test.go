@@ -0,0 +1,98 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/storage"
+)
+
+// fakeConn records statements and tracks the recorded schema version
+type fakeConn struct {
+	statements []string
+	version    int64
+	failOn     string
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	if c.failOn != "" && strings.Contains(query, c.failOn) {
+		return errors.New("exec failed")
+	}
+	c.statements = append(c.statements, query)
+	if strings.HasPrefix(query, "INSERT INTO parsec_schema_migrations") {
+		c.version = int64(args[0].(int))
+	}
+	return nil
+}
+
+func (c *fakeConn) QueryInt(ctx context.Context, query string, args ...any) (int64, error) {
+	return c.version, nil
+}
+
+func TestRollupDDL(t *testing.T) {
+	ddl := storage.DefaultRollups[1].DDL("logs")
+	if len(ddl) != 2 {
+		t.Fatalf("expected table and view, got %d statements", len(ddl))
+	}
+	if !strings.Contains(ddl[0], "CREATE TABLE IF NOT EXISTS logs_rollup_1h") {
+		t.Errorf("unexpected table DDL: %s", ddl[0])
+	}
+	if !strings.Contains(ddl[1], "TO logs_rollup_1h") || !strings.Contains(ddl[1], "toStartOfHour(timestamp)") {
+		t.Errorf("unexpected view DDL: %s", ddl[1])
+	}
+}
+
+func TestMigrate_AppliesPendingOnly(t *testing.T) {
+	conn := &fakeConn{}
+	migrations := storage.RollupMigrations("logs")
+
+	version, err := storage.Migrate(context.Background(), conn, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("version = %d, want %d", version, len(migrations))
+	}
+
+	// Re-running only ensures the migrations table exists
+	conn.statements = nil
+	if _, err := storage.Migrate(context.Background(), conn, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.statements) != 1 {
+		t.Errorf("expected no pending migrations, ran %v", conn.statements)
+	}
+}
+
+func TestMigrate_StopsOnFailure(t *testing.T) {
+	conn := &fakeConn{failOn: "logs_rollup_1h_mv"}
+
+	version, err := storage.Migrate(context.Background(), conn, storage.RollupMigrations("logs"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if version != 1 {
+		t.Errorf("version = %d, want 1 (per-minute rollup applied)", version)
+	}
+}
+
+func TestRollupFor(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		span time.Duration
+		want string
+	}{
+		{"last hour", time.Hour, "1m"},
+		{"last day", 24 * time.Hour, "1h"},
+		{"last week", 7 * 24 * time.Hour, "1h"},
+	}
+	for _, tt := range tests {
+		if got := storage.RollupFor(now.Add(-tt.span), now, 12); got.Name != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got.Name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"parsec/internal/storage"
+)
+
+// schemaConn is a fakeConn whose table has no search index
+type schemaConn struct {
+	fakeConn
+}
+
+func (c *schemaConn) QueryInt(ctx context.Context, query string, args ...any) (int64, error) {
+	if strings.Contains(query, "data_skipping_indices") {
+		return 0, nil
+	}
+	return c.fakeConn.QueryInt(ctx, query, args...)
+}
+
+func TestPrepare_AppliesEveryMigration(t *testing.T) {
+	conn := &fakeConn{}
+	version, err := storage.Prepare(context.Background(), conn, storage.Schema{Table: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(storage.Migrations("logs")); version != want {
+		t.Errorf("version = %d, want %d", version, want)
+	}
+	if !strings.Contains(strings.Join(conn.statements, "\n"), "logs_rollup_1m") {
+		t.Errorf("rollups not created: %v", conn.statements)
+	}
+
+	// Another node starting finds nothing to do
+	conn.statements = nil
+	if _, err := storage.Prepare(context.Background(), conn, storage.Schema{Table: "logs"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.statements) != 1 {
+		t.Errorf("expected no pending migrations, ran %v", conn.statements)
+	}
+}
+
+func TestPrepare_AddsSearchIndexWhenAsked(t *testing.T) {
+	index := storage.DefaultSearchIndex()
+
+	conn := &schemaConn{}
+	if _, err := storage.Prepare(context.Background(), conn, storage.Schema{Table: "logs"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(conn.statements, "\n"), "idx_message_tokens") {
+		t.Error("search index added without being asked")
+	}
+
+	conn = &schemaConn{}
+	if _, err := storage.Prepare(context.Background(), conn, storage.Schema{Table: "logs", SearchIndex: &index}); err != nil {
+		t.Fatal(err)
+	}
+	last := conn.statements[len(conn.statements)-1]
+	if !strings.Contains(last, "MATERIALIZE INDEX idx_message_tokens") {
+		t.Errorf("search index not added after the migrations: %v", conn.statements)
+	}
+}
+
+func TestOpen_RejectsUnknownBackends(t *testing.T) {
+	if _, err := storage.Open("sqlite", "file:logs.db"); err == nil || !strings.Contains(err.Error(), "unknown storage backend") {
+		t.Errorf("Open(sqlite) = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package storage_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"parsec/internal/storage"
+)
+
+// indexConn reports whether the search index exists and records statements
+type indexConn struct {
+	exists     bool
+	statements []string
+}
+
+func (c *indexConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.statements = append(c.statements, query)
+	return nil
+}
+
+func (c *indexConn) QueryInt(ctx context.Context, query string, args ...any) (int64, error) {
+	if c.exists {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func TestEnsureSearchIndex(t *testing.T) {
+	conn := &indexConn{}
+	added, err := storage.EnsureSearchIndex(context.Background(), conn, "logs", storage.DefaultSearchIndex())
+	if err != nil || !added {
+		t.Fatalf("EnsureSearchIndex = %v, %v", added, err)
+	}
+	if len(conn.statements) != 2 ||
+		!strings.Contains(conn.statements[0], "ADD INDEX IF NOT EXISTS idx_message_tokens message TYPE tokenbf_v1(10240, 3, 0) GRANULARITY 4") ||
+		!strings.Contains(conn.statements[1], "MATERIALIZE INDEX idx_message_tokens") {
+		t.Errorf("unexpected statements %v", conn.statements)
+	}
+
+	// An existing index is not rebuilt
+	conn = &indexConn{exists: true}
+	added, err = storage.EnsureSearchIndex(context.Background(), conn, "logs", storage.DefaultSearchIndex())
+	if err != nil || added || len(conn.statements) != 0 {
+		t.Errorf("expected nothing to run, got %v, %v, %v", added, err, conn.statements)
+	}
+}
+
+func TestEventQuery_Search(t *testing.T) {
+	tests := []struct {
+		search string
+		tokens []any
+	}{
+		// Words at the ends may be parts of longer words
+		{"request timeout after 30s", []any{"timeout", "after"}},
+		{"timeout", nil},
+		{"[db] pool exhausted", []any{"db", "pool"}},
+		{"code=503 ", []any{"503"}},
+	}
+	for _, tt := range tests {
+		query, args := storage.EventQuery("logs", storage.EventFilter{TenantID: "acme", Search: tt.search})
+		want := "SELECT * FROM logs WHERE tenant_id = ?" +
+			strings.Repeat(" AND hasToken(message, ?)", len(tt.tokens)) +
+			" AND position(message, ?) > 0 ORDER BY timestamp DESC LIMIT 1000"
+		if query != want {
+			t.Errorf("search %q: got query %q", tt.search, query)
+		}
+		wantArgs := append(append([]any{"acme"}, tt.tokens...), tt.search)
+		if !reflect.DeepEqual(args, wantArgs) {
+			t.Errorf("search %q: got args %v, want %v", tt.search, args, wantArgs)
+		}
+	}
+}
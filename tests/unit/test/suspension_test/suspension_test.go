@@ -0,0 +1,124 @@
+package suspension_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/state"
+	"parsec/internal/suspension"
+)
+
+func TestRegistry_SuspendAndLift(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	registry := suspension.NewRegistry(store)
+	if _, err := registry.Suspend(ctx, suspension.Suspension{TenantID: "acme", Mode: "frozen"}); !errors.Is(err, suspension.ErrInvalidMode) {
+		t.Errorf("invalid mode: %v", err)
+	}
+
+	if _, err := registry.Suspend(ctx, suspension.Suspension{TenantID: "acme", Mode: suspension.ModePaused, Reason: "billing"}); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := registry.Get("acme")
+	if !ok || s.Mode != suspension.ModePaused || s.Code() != "tenant_paused" || s.Since.IsZero() {
+		t.Fatalf("unexpected suspension %+v, %v", s, ok)
+	}
+	if _, ok := registry.Get("globex"); ok {
+		t.Error("globex should not be suspended")
+	}
+
+	// Other nodes see the suspension once they reload
+	other := suspension.NewRegistry(store)
+	if err := other.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Get("acme"); !ok {
+		t.Error("suspension not shared through the store")
+	}
+
+	existed, err := other.Lift(ctx, "acme")
+	if err != nil || !existed {
+		t.Fatalf("lift: %v, %v", existed, err)
+	}
+	if err := registry.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.Get("acme"); ok {
+		t.Error("lift not shared through the store")
+	}
+	if existed, _ := registry.Lift(ctx, "acme"); existed {
+		t.Error("lifting twice should report no suspension")
+	}
+}
+
+func TestRegistry_Until(t *testing.T) {
+	registry := suspension.NewRegistry(nil)
+	past := time.Now().Add(-time.Second)
+	if _, err := registry.Suspend(context.Background(), suspension.Suspension{TenantID: "acme", Mode: suspension.ModeBlocked, Until: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.Get("acme"); ok {
+		t.Error("expired suspension still in force")
+	}
+	if len(registry.List()) != 0 {
+		t.Error("expired suspension listed")
+	}
+
+	var nilRegistry *suspension.Registry
+	if _, ok := nilRegistry.Get("acme"); ok {
+		t.Error("nil registry suspended a tenant")
+	}
+}
+
+func TestRegistry_NoopStoreKeepsSuspensions(t *testing.T) {
+	ctx := context.Background()
+	registry := suspension.NewRegistry(state.NewNoopStore(""))
+	for _, tenantID := range []string{"acme", "globex"} {
+		if _, err := registry.Suspend(ctx, suspension.Suspension{TenantID: tenantID, Mode: suspension.ModePaused}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.List()) != 2 {
+		t.Errorf("expected both suspensions kept after a reload, got %+v", registry.List())
+	}
+}
+
+func TestRegistry_ConcurrentNodesKeepEachOthersChanges(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	// Each node suspends its own tenants without reloading the other's
+	nodes := []*suspension.Registry{suspension.NewRegistry(store), suspension.NewRegistry(store)}
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				tenantID := fmt.Sprintf("tenant-%d-%d", i, j)
+				if _, err := node.Suspend(ctx, suspension.Suspension{TenantID: tenantID, Mode: suspension.ModeBlocked}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	fresh := suspension.NewRegistry(store)
+	if err := fresh.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fresh.List()); n != 10 {
+		t.Errorf("expected all 10 suspensions stored, got %d", n)
+	}
+}
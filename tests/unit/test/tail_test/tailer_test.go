@@ -0,0 +1,215 @@
+package tail_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	handlers "parsec/internal/api"
+	"parsec/internal/config"
+	"parsec/internal/state"
+	"parsec/internal/tail"
+	"parsec/pkg/models"
+)
+
+// sink records submitted messages; the first queueFull submissions fail
+type sink struct {
+	mu        sync.Mutex
+	events    []*models.LogEvent
+	queueFull int
+}
+
+func (s *sink) Submit(_ context.Context, event *models.LogEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queueFull > 0 {
+		s.queueFull--
+		return handlers.ErrQueueFull
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+// wait returns the messages once n have arrived
+func (s *sink) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		if len(s.events) >= n {
+			var messages []string
+			for _, e := range s.events {
+				messages = append(messages, e.Message)
+			}
+			s.mu.Unlock()
+			return messages
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Fatalf("timed out waiting for %d lines, got %d", n, len(s.events))
+	return nil
+}
+
+func testConfig(dir string) config.TailConfig {
+	cfg := config.Default().Tail
+	cfg.Paths = []string{filepath.Join(dir, "*.log")}
+	cfg.PollInterval = 10 * time.Millisecond
+	cfg.RescanInterval = 50 * time.Millisecond
+	cfg.CheckpointInterval = 20 * time.Millisecond
+	return cfg
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectLines(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestTailer_ReadsLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "first\r\n\nsecond\npart")
+
+	cfg := testConfig(dir)
+	cfg.ReadFromHead = true
+	s := &sink{queueFull: 2}
+	tailer, err := tail.New(cfg, s, state.NewMemoryStore(state.MemoryConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer.Start(context.Background())
+	defer tailer.Close()
+
+	expectLines(t, s.wait(t, 2), "first", "second")
+
+	// A partial line is held until its newline arrives
+	appendFile(t, path, "ial\n")
+	messages := s.wait(t, 3)
+	expectLines(t, messages, "first", "second", "partial")
+
+	s.mu.Lock()
+	event := s.events[0]
+	s.mu.Unlock()
+	if event.TenantID != "system" || event.Source != "file" || event.Metadata[tail.MetadataFile] != path {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestTailer_StartsAtEndAndResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old\n")
+
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	s := &sink{}
+	tailer, err := tail.New(testConfig(dir), s, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer.Start(context.Background())
+
+	appendFile(t, path, "one\n")
+	expectLines(t, s.wait(t, 1), "one")
+	tailer.Close()
+
+	// Written while stopped
+	appendFile(t, path, "two\n")
+
+	tailer, err = tail.New(testConfig(dir), s, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer.Start(context.Background())
+	defer tailer.Close()
+
+	expectLines(t, s.wait(t, 2), "one", "two")
+}
+
+func TestTailer_FollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+
+	s := &sink{}
+	tailer, err := tail.New(testConfig(dir), s, state.NewMemoryStore(state.MemoryConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer.Start(context.Background())
+	defer tailer.Close()
+
+	appendFile(t, path, "before\n")
+	s.wait(t, 1)
+
+	// Rename out of the glob; lines written to the old file after the
+	// rename are still read
+	if err := os.Rename(path, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, filepath.Join(dir, "app.log.1"), "late\n")
+	appendFile(t, path, "after\n")
+
+	expectLines(t, s.wait(t, 3), "before", "late", "after")
+}
+
+func TestTailer_RestartsTruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "")
+
+	s := &sink{}
+	tailer, err := tail.New(testConfig(dir), s, state.NewMemoryStore(state.MemoryConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer.Start(context.Background())
+	defer tailer.Close()
+
+	appendFile(t, path, "a long line before truncation\n")
+	s.wait(t, 1)
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "new\n")
+
+	expectLines(t, s.wait(t, 2), "a long line before truncation", "new")
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	store := state.NewMemoryStore(state.MemoryConfig{})
+
+	cfg := config.Default().Tail
+	if _, err := tail.New(cfg, &sink{}, store); err == nil {
+		t.Error("expected error without paths")
+	}
+
+	cfg.Paths = []string{"/var/log/[.log"}
+	if _, err := tail.New(cfg, &sink{}, store); err == nil {
+		t.Error("expected error for malformed glob")
+	}
+}
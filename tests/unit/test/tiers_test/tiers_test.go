@@ -0,0 +1,266 @@
+package tiers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/routing"
+	"parsec/internal/state"
+	"parsec/internal/tiers"
+	"parsec/pkg/models"
+)
+
+func TestRegistry_TierPrecedence(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	registry, err := tiers.NewRegistry(store, tiers.Config{
+		Assignments: map[string]tiers.Tier{"acme": tiers.Gold},
+		Default:     tiers.Bronze,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tier, ok := registry.Tier("acme"); !ok || tier != tiers.Gold {
+		t.Errorf("acme = %q, want gold from the configuration", tier)
+	}
+	if tier, ok := registry.Tier("globex"); !ok || tier != tiers.Bronze {
+		t.Errorf("globex = %q, want the default bronze", tier)
+	}
+
+	if _, err := registry.Assign(ctx, tiers.Assignment{TenantID: "acme", Tier: "platinum"}); !errors.Is(err, tiers.ErrUnknownTier) {
+		t.Errorf("unknown tier: %v", err)
+	}
+	a, err := registry.Assign(ctx, tiers.Assignment{TenantID: "acme", Tier: "Silver", By: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Tier != tiers.Silver || a.Since == nil {
+		t.Errorf("unexpected assignment %+v", a)
+	}
+
+	// Other nodes see the assignment once they reload, over the configuration
+	other, err := tiers.NewRegistry(store, tiers.Config{Assignments: map[string]tiers.Tier{"acme": tiers.Gold}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tier, _ := other.Tier("acme"); tier != tiers.Silver {
+		t.Errorf("acme = %q on another node, want silver", tier)
+	}
+	if _, ok := other.Tier("globex"); ok {
+		t.Error("globex should have no tier without a default")
+	}
+
+	if err := other.Unassign(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if tier, _ := other.Tier("acme"); tier != tiers.Gold {
+		t.Errorf("acme = %q after unassigning, want gold from the configuration", tier)
+	}
+	if err := other.Unassign(ctx, "acme"); !errors.Is(err, tiers.ErrStaticTier) {
+		t.Errorf("unassigning a configured tier: %v", err)
+	}
+	if err := other.Unassign(ctx, "globex"); !errors.Is(err, tiers.ErrNotAssigned) {
+		t.Errorf("unassigning an unassigned tenant: %v", err)
+	}
+
+	list := other.List()
+	if len(list) != 1 || list[0].TenantID != "acme" || !list[0].Static {
+		t.Errorf("unexpected list %+v", list)
+	}
+}
+
+func TestRegistry_RejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]tiers.Config{
+		"unknown default":    {Default: "platinum"},
+		"unknown assignment": {Assignments: map[string]tiers.Tier{"acme": "platinum"}},
+		"unknown policy":     {Policies: map[tiers.Tier]tiers.Policy{"platinum": {}}},
+		"invalid priority":   {Policies: map[tiers.Tier]tiers.Policy{tiers.Gold: {Priority: "urgent"}}},
+		"invalid acks":       {Policies: map[tiers.Tier]tiers.Policy{tiers.Gold: {Acks: "some"}}},
+		"invalid sample":     {Policies: map[tiers.Tier]tiers.Policy{tiers.Gold: {DebugSampleRate: 2}}},
+		"invalid ttl":        {Policies: map[tiers.Tier]tiers.Policy{tiers.Gold: {TTL: "forever"}}},
+	} {
+		if _, err := tiers.NewRegistry(nil, cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	assignments, err := tiers.ParseAssignments(" acme=gold, globex=Silver ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 2 || assignments["acme"] != tiers.Gold || assignments["globex"] != tiers.Silver {
+		t.Errorf("unexpected assignments %v", assignments)
+	}
+	for _, s := range []string{"acme", "=gold", "acme=platinum"} {
+		if _, err := tiers.ParseAssignments(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestRegistry_Allow(t *testing.T) {
+	registry, err := tiers.NewRegistry(nil, tiers.Config{
+		Policies:    map[tiers.Tier]tiers.Policy{tiers.Bronze: {EventsPerSecond: 3}},
+		Assignments: map[string]tiers.Tier{"acme": tiers.Bronze, "initech": tiers.Gold},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if registry.Allow("acme") {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("allowed %d of acme's events, want its burst of 3", allowed)
+	}
+	// Gold is unlimited, and tenants without a tier are not limited
+	for i := 0; i < 10; i++ {
+		if !registry.Allow("initech") || !registry.Allow("globex") {
+			t.Fatal("unlimited tenant was limited")
+		}
+	}
+
+	var none *tiers.Registry
+	if !none.Allow("acme") || none.Acks("acme") != "" {
+		t.Error("a nil registry should not limit or set acks")
+	}
+}
+
+func TestRegistry_AllowSweepsIdleTenants(t *testing.T) {
+	registry, err := tiers.NewRegistry(nil, tiers.Config{
+		Policies: map[tiers.Tier]tiers.Policy{tiers.Bronze: {EventsPerSecond: 1000}},
+		Default:  tiers.Bronze,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Made-up tenant IDs each get a bucket only until it refills
+	for i := 0; i < 100; i++ {
+		registry.Allow(fmt.Sprintf("tenant-%d", i))
+	}
+	if n := registry.Limited(); n != 100 {
+		t.Fatalf("expected 100 buckets, got %d", n)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	registry.Allow("acme")
+	if n := registry.Limited(); n != 1 {
+		t.Errorf("expected the refilled buckets swept, %d left", n)
+	}
+}
+
+func TestRegistry_NoopStoreKeepsAssignments(t *testing.T) {
+	ctx := context.Background()
+	registry, err := tiers.NewRegistry(state.NewNoopStore(""), tiers.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tenantID := range []string{"acme", "globex"} {
+		if _, err := registry.Assign(ctx, tiers.Assignment{TenantID: tenantID, Tier: tiers.Gold}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(registry.List()); n != 2 {
+		t.Errorf("expected both assignments kept after a reload, got %d", n)
+	}
+}
+
+func TestRegistry_ConcurrentNodesKeepEachOthersAssignments(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		node, err := tiers.NewRegistry(store, tiers.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				a := tiers.Assignment{TenantID: fmt.Sprintf("tenant-%d-%d", i, j), Tier: tiers.Silver}
+				if _, err := node.Assign(ctx, a); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	fresh, err := tiers.NewRegistry(store, tiers.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fresh.List()); n != 10 {
+		t.Errorf("expected all 10 assignments stored, got %d", n)
+	}
+}
+
+func TestRegistry_RoutingDefaults(t *testing.T) {
+	registry, err := tiers.NewRegistry(nil, tiers.Config{
+		Assignments: map[string]tiers.Tier{"acme": tiers.Bronze, "initech": tiers.Gold},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := routing.NewEngine(nil)
+	engine.SetDefaults(registry.Rules)
+	engine.SetRetentionTopics(map[string]string{routing.RetentionShort: "logs-short"})
+
+	event := &models.LogEvent{ID: "evt-1", TenantID: "acme", Severity: models.SeverityError, Source: "api"}
+	d := engine.Evaluate(event)
+	if d.Priority != routing.PriorityLow || d.Retention != routing.RetentionShort || d.Topic != "logs-short" {
+		t.Errorf("bronze defaults not applied: %+v", d)
+	}
+
+	// A tenant's own rules win over its tier's
+	if err := engine.SetRules(context.Background(), "acme", []routing.Rule{
+		{Match: routing.Match{Source: "api"}, Action: routing.ActionPriority, Priority: routing.PriorityHigh},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if d := engine.Evaluate(event); d.Priority != routing.PriorityHigh || d.Retention != routing.RetentionShort {
+		t.Errorf("tenant rule should override the tier's priority: %+v", d)
+	}
+
+	// Bronze keeps a tenth of DEBUG events
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		debug := &models.LogEvent{ID: fmt.Sprintf("debug-%d", i), TenantID: "acme", Severity: models.SeverityDebug}
+		if !engine.Evaluate(debug).Drop {
+			kept++
+		}
+	}
+	if kept < 50 || kept > 150 {
+		t.Errorf("kept %d of 1000 DEBUG events, want about 100", kept)
+	}
+
+	if d := engine.Evaluate(&models.LogEvent{ID: "evt-2", TenantID: "initech"}); d.Priority != routing.PriorityHigh || d.Retention != routing.RetentionLong {
+		t.Errorf("gold defaults not applied: %+v", d)
+	}
+	if registry.Acks("initech") != tiers.AcksAll || registry.Acks("globex") != "" {
+		t.Error("unexpected acks levels")
+	}
+}
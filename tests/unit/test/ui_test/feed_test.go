@@ -0,0 +1,132 @@
+package ui_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"parsec/internal/ui"
+	"parsec/pkg/models"
+)
+
+func event(id, tenant string, severity models.Severity) *models.LogEvent {
+	return &models.LogEvent{
+		ID:        id,
+		TenantID:  tenant,
+		Timestamp: time.Now(),
+		Severity:  severity,
+		Source:    "api",
+		Message:   "message " + id,
+	}
+}
+
+func TestFeed_RecentKeepsLatest(t *testing.T) {
+	feed := ui.NewFeed(ui.FeedConfig{Size: 3})
+	for i := 1; i <= 5; i++ {
+		tenant := "acme"
+		if i == 4 {
+			tenant = "globex"
+		}
+		feed.Observe(event(strconv.Itoa(i), tenant, models.SeverityInfo))
+	}
+
+	var ids []string
+	for _, e := range feed.Recent("", 10) {
+		ids = append(ids, e.ID)
+	}
+	if strings.Join(ids, ",") != "3,4,5" {
+		t.Errorf("recent = %v, want the last 3 oldest first", ids)
+	}
+
+	acme := feed.Recent("acme", 10)
+	if len(acme) != 2 || acme[0].ID != "3" || acme[1].ID != "5" {
+		t.Errorf("unexpected acme events %+v", acme)
+	}
+	if got := feed.Recent("", 1); len(got) != 1 || got[0].ID != "5" {
+		t.Errorf("unexpected limited events %+v", got)
+	}
+}
+
+func TestFeed_ErrorsByTenant(t *testing.T) {
+	feed := ui.NewFeed(ui.FeedConfig{ErrorsPerTenant: 2, MaxTenants: 2})
+	feed.Observe(event("1", "acme", models.SeverityError))
+	feed.Observe(event("2", "acme", models.SeverityInfo))
+	feed.Observe(event("3", "acme", models.SeverityCritical))
+	feed.Observe(event("4", "acme", models.SeverityError))
+	time.Sleep(time.Millisecond)
+	feed.Observe(event("5", "globex", models.SeverityError))
+
+	errors := feed.Errors()
+	if len(errors) != 2 || errors[0].TenantID != "globex" || errors[1].TenantID != "acme" {
+		t.Fatalf("unexpected tenants %+v", errors)
+	}
+	acme := errors[1]
+	if acme.Count != 3 || len(acme.Recent) != 2 || acme.Recent[0].ID != "4" || acme.Recent[1].ID != "3" {
+		t.Errorf("unexpected acme errors %+v", acme)
+	}
+
+	// A third tenant evicts the one whose last error is oldest
+	time.Sleep(time.Millisecond)
+	feed.Observe(event("6", "initech", models.SeverityError))
+	errors = feed.Errors()
+	if len(errors) != 2 || errors[0].TenantID != "initech" || errors[1].TenantID != "globex" {
+		t.Errorf("unexpected tenants after eviction %+v", errors)
+	}
+}
+
+func TestFeed_Subscribe(t *testing.T) {
+	feed := ui.NewFeed(ui.FeedConfig{Buffer: 2})
+	feed.Observe(event("1", "acme", models.SeverityInfo))
+
+	recent, events, cancel := feed.Subscribe("acme", 10)
+	if len(recent) != 1 || recent[0].ID != "1" {
+		t.Fatalf("unexpected backlog %+v", recent)
+	}
+
+	feed.Observe(event("2", "globex", models.SeverityInfo))
+	feed.Observe(event("3", "acme", models.SeverityInfo))
+	if e := <-events; e.ID != "3" {
+		t.Errorf("expected acme's event 3, got %s", e.ID)
+	}
+
+	// A full subscriber drops events rather than blocking
+	for i := 4; i < 10; i++ {
+		feed.Observe(event(strconv.Itoa(i), "acme", models.SeverityInfo))
+	}
+	if len(events) != 2 {
+		t.Errorf("expected the buffer of 2 to be full, got %d", len(events))
+	}
+
+	cancel()
+	<-events
+	<-events
+	feed.Observe(event("10", "acme", models.SeverityInfo))
+	if len(events) != 0 {
+		t.Error("cancelled subscriber still receives events")
+	}
+}
+
+func TestAssets(t *testing.T) {
+	server := httptest.NewServer(ui.Assets("/ui/"))
+	defer server.Close()
+
+	for path, contentType := range map[string]string{
+		"/ui/":          "text/html",
+		"/ui/app.js":    "javascript",
+		"/ui/style.css": "text/css",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), contentType) || len(body) == 0 {
+			t.Errorf("%s: %d %s", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package uploads_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/state"
+	"parsec/internal/uploads"
+)
+
+// sink records the batches it is given, rejecting lines containing "bad"
+type sink struct {
+	mu      sync.Mutex
+	batches []string
+	lines   []string
+}
+
+func (s *sink) ingest(ctx context.Context, batchID string, lines [][]byte) uploads.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, batchID)
+
+	var result uploads.Result
+	for i, line := range lines {
+		s.lines = append(s.lines, string(line))
+		if bytes.Contains(line, []byte("bad")) {
+			result.Rejected++
+			result.Errors = append(result.Errors, uploads.LineError{Line: int64(i), Error: "bad line"})
+			continue
+		}
+		result.Accepted++
+	}
+	return result
+}
+
+func newManager(t *testing.T, s *sink, cfg uploads.Config) (*uploads.Manager, state.StateStore) {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	cfg.NodeID = "node-a"
+	m, err := uploads.NewManager(store, s.ingest, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m, store
+}
+
+// wait polls until the upload is finished
+func wait(t *testing.T, m *uploads.Manager, id string) *uploads.Upload {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		upload, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upload.Finished() {
+			return upload
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("upload did not finish")
+	return nil
+}
+
+func TestManager_ChunkedUploadIngestsLines(t *testing.T) {
+	s := &sink{}
+	dir := t.TempDir()
+	m, _ := newManager(t, s, uploads.Config{Dir: dir, BatchSize: 2})
+	ctx := context.Background()
+
+	upload, err := m.Create(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunks may split lines anywhere
+	data := "{\"id\":\"1\"}\n{\"id\":\"2\"}\n\n{\"id\":\"bad\"}\n{\"id\":\"4\"}"
+	offset := int64(0)
+	for _, chunk := range []string{data[:7], data[7:30], data[30:]} {
+		upload, err = m.Append(ctx, upload.ID, offset, strings.NewReader(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += int64(len(chunk))
+		if upload.Offset != offset {
+			t.Fatalf("offset = %d, want %d", upload.Offset, offset)
+		}
+	}
+
+	if _, err := m.Commit(ctx, upload.ID); err != nil {
+		t.Fatal(err)
+	}
+	upload = wait(t, m, upload.ID)
+
+	if upload.Status != uploads.StatusCompleted {
+		t.Fatalf("status = %s (%s)", upload.Status, upload.Error)
+	}
+	if upload.Lines != 4 || upload.Accepted != 3 || upload.Rejected != 1 {
+		t.Errorf("totals = %+v", upload)
+	}
+	if len(upload.Errors) != 1 || upload.Errors[0].Line != 4 {
+		t.Errorf("errors = %+v, want line 4", upload.Errors)
+	}
+	if len(s.batches) != 2 || s.batches[0] != upload.ID+"-1" || s.batches[1] != upload.ID+"-2" {
+		t.Errorf("batches = %v", s.batches)
+	}
+	if strings.Join(s.lines, "|") != `{"id":"1"}|{"id":"2"}|{"id":"bad"}|{"id":"4"}` {
+		t.Errorf("lines = %v", s.lines)
+	}
+	if _, err := os.Stat(filepath.Join(dir, upload.ID+".ndjson")); !os.IsNotExist(err) {
+		t.Errorf("upload data not removed: %v", err)
+	}
+}
+
+func TestManager_OffsetMismatchReportsOffset(t *testing.T) {
+	m, _ := newManager(t, &sink{}, uploads.Config{})
+	ctx := context.Background()
+
+	upload, _ := m.Create(ctx, 0)
+	if _, err := m.Append(ctx, upload.ID, 0, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A retried chunk that already landed
+	got, err := m.Append(ctx, upload.ID, 0, strings.NewReader("abc"))
+	if !errors.Is(err, uploads.ErrOffsetMismatch) {
+		t.Fatalf("err = %v, want ErrOffsetMismatch", err)
+	}
+	if got.Offset != 3 {
+		t.Errorf("offset = %d, want 3", got.Offset)
+	}
+}
+
+// failingReader returns some data and then an error, like a dropped
+// connection
+type failingReader struct{ data []byte }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestManager_FailedChunkIsDiscarded(t *testing.T) {
+	s := &sink{}
+	m, _ := newManager(t, s, uploads.Config{})
+	ctx := context.Background()
+
+	upload, _ := m.Create(ctx, 0)
+	m.Append(ctx, upload.ID, 0, strings.NewReader("{\"id\":\"1\"}\n"))
+
+	got, err := m.Append(ctx, upload.ID, 11, &failingReader{data: []byte("{\"id\":\"partial")})
+	if err == nil {
+		t.Fatal("expected the failed chunk to return an error")
+	}
+	if got.Offset != 11 {
+		t.Fatalf("offset = %d, want 11", got.Offset)
+	}
+
+	// The client resends the chunk from the same offset
+	if _, err := m.Append(ctx, upload.ID, 11, strings.NewReader("{\"id\":\"2\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+	m.Commit(ctx, upload.ID)
+	upload = wait(t, m, upload.ID)
+	if upload.Accepted != 2 || strings.Join(s.lines, "|") != `{"id":"1"}|{"id":"2"}` {
+		t.Errorf("accepted = %d, lines = %v", upload.Accepted, s.lines)
+	}
+}
+
+func TestManager_SizeLimits(t *testing.T) {
+	m, _ := newManager(t, &sink{}, uploads.Config{MaxBytes: 10})
+	ctx := context.Background()
+
+	if _, err := m.Create(ctx, 11); !errors.Is(err, uploads.ErrTooLarge) {
+		t.Errorf("create err = %v, want ErrTooLarge", err)
+	}
+
+	upload, _ := m.Create(ctx, 5)
+	if _, err := m.Append(ctx, upload.ID, 0, strings.NewReader("123456")); !errors.Is(err, uploads.ErrTooLarge) {
+		t.Errorf("append err = %v, want ErrTooLarge", err)
+	}
+	m.Append(ctx, upload.ID, 0, strings.NewReader("123"))
+	if _, err := m.Commit(ctx, upload.ID); !errors.Is(err, uploads.ErrIncomplete) {
+		t.Errorf("commit err = %v, want ErrIncomplete", err)
+	}
+
+	empty, _ := m.Create(ctx, 0)
+	if _, err := m.Commit(ctx, empty.ID); !errors.Is(err, uploads.ErrEmpty) {
+		t.Errorf("commit err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestManager_AbortAndCommitOnlyOpenUploads(t *testing.T) {
+	m, _ := newManager(t, &sink{}, uploads.Config{})
+	ctx := context.Background()
+
+	upload, _ := m.Create(ctx, 0)
+	m.Append(ctx, upload.ID, 0, strings.NewReader("x\n"))
+	aborted, err := m.Abort(ctx, upload.ID)
+	if err != nil || aborted.Status != uploads.StatusAborted {
+		t.Fatalf("abort = %+v, %v", aborted, err)
+	}
+
+	if _, err := m.Append(ctx, upload.ID, 2, strings.NewReader("y\n")); !errors.Is(err, uploads.ErrNotOpen) {
+		t.Errorf("append err = %v, want ErrNotOpen", err)
+	}
+	if _, err := m.Commit(ctx, upload.ID); !errors.Is(err, uploads.ErrNotOpen) {
+		t.Errorf("commit err = %v, want ErrNotOpen", err)
+	}
+	if _, err := m.Abort(ctx, upload.ID); !errors.Is(err, uploads.ErrFinished) {
+		t.Errorf("abort err = %v, want ErrFinished", err)
+	}
+	if _, err := m.Get(ctx, "missing"); !errors.Is(err, uploads.ErrNotFound) {
+		t.Errorf("get err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_OtherNodesUploadsAreRefused(t *testing.T) {
+	s := &sink{}
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	defer store.Close()
+
+	a, err := uploads.NewManager(store, s.ingest, uploads.Config{Dir: t.TempDir(), NodeID: "node-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := uploads.NewManager(store, s.ingest, uploads.Config{Dir: t.TempDir(), NodeID: "node-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx := context.Background()
+	upload, _ := a.Create(ctx, 0)
+	if _, err := b.Append(ctx, upload.ID, 0, strings.NewReader("x\n")); !errors.Is(err, uploads.ErrWrongNode) {
+		t.Errorf("err = %v, want ErrWrongNode", err)
+	}
+
+	// Any node reports it
+	if got, err := b.Get(ctx, upload.ID); err != nil || got.Node != "node-a" {
+		t.Errorf("get = %+v, %v", got, err)
+	}
+}
+
+func TestManager_RunRemovesExpiredAndFailsInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	m, store := newManager(t, &sink{}, uploads.Config{Dir: dir})
+	ctx := context.Background()
+
+	// Data left from an upload whose record expired
+	orphan := filepath.Join(dir, "orphan.ndjson")
+	os.WriteFile(orphan, []byte("x\n"), 0o600)
+
+	// An upload being ingested when the node stopped
+	interrupted := filepath.Join(dir, "interrupted.ndjson")
+	os.WriteFile(interrupted, []byte("x\n"), 0o600)
+	store.Set(ctx, "parsec:uploads:interrupted", []byte(`{"id":"interrupted","node":"node-a","offset":2,"status":"ingesting"}`))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(runCtx, time.Hour)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		upload, err := m.Get(ctx, "interrupted")
+		if err == nil && upload.Status == uploads.StatusFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("interrupted upload = %+v, %v", upload, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	for _, path := range []string{orphan, interrupted} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", filepath.Base(path), err)
+		}
+	}
+}
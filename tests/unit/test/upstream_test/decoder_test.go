@@ -0,0 +1,152 @@
+package upstream_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"parsec/internal/config"
+	"parsec/internal/upstream"
+	"parsec/pkg/models"
+)
+
+var kafkaTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func message(value string) kafka.Message {
+	return kafka.Message{Topic: "legacy-app", Partition: 2, Offset: 41, Value: []byte(value), Time: kafkaTime}
+}
+
+func decoder(t *testing.T, format string) *upstream.Decoder {
+	t.Helper()
+	d, err := upstream.NewDecoder(format, "legacy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDecode_RawLine(t *testing.T) {
+	event, err := decoder(t, upstream.FormatAuto).Decode(message("  GET /health 200\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Message != "GET /health 200" || event.TenantID != "legacy" || event.Source != "legacy-app" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.Severity != models.SeverityInfo || !event.Timestamp.Equal(kafkaTime) {
+		t.Errorf("expected INFO at the Kafka timestamp, got %s at %s", event.Severity, event.Timestamp)
+	}
+	if event.Metadata[upstream.MetadataTopic] != "legacy-app" || event.Metadata[upstream.MetadataPartition] != "2" || event.Metadata[upstream.MetadataOffset] != "41" {
+		t.Errorf("unexpected position metadata: %v", event.Metadata)
+	}
+	if err := event.Validate(); err != nil {
+		t.Errorf("decoded event should validate: %v", err)
+	}
+
+	// Redelivery keeps the ID
+	again, _ := decoder(t, upstream.FormatAuto).Decode(message("GET /health 200"))
+	if again.ID != event.ID {
+		t.Error("expected the same ID for the same position")
+	}
+}
+
+func TestDecode_JSON(t *testing.T) {
+	event, err := decoder(t, upstream.FormatAuto).Decode(message(
+		`{"msg":"payment failed","level":"warn","ts":1717243200.5,"service":"billing","tenant":"acme","order":1234,"retry":true,"ctx":{"a":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Message != "payment failed" || event.Severity != models.SeverityWarning {
+		t.Errorf("unexpected message/severity: %q %s", event.Message, event.Severity)
+	}
+	if event.Source != "billing" || event.TenantID != "acme" {
+		t.Errorf("unexpected source/tenant: %s %s", event.Source, event.TenantID)
+	}
+	if want := time.Unix(1717243200, 500000000).UTC(); !event.Timestamp.Equal(want) {
+		t.Errorf("expected %s, got %s", want, event.Timestamp)
+	}
+	for key, want := range map[string]string{"order": "1234", "retry": "true", "ctx": `{"a":1}`} {
+		if got := event.Metadata.Get(key); got != want {
+			t.Errorf("metadata %s = %q, want %q", key, got, want)
+		}
+	}
+	// Nested values keep their structure
+	if a, ok := event.Metadata.Lookup("ctx.a"); !ok || models.Stringify(a) != "1" {
+		t.Errorf("expected nested ctx.a, got %v", event.Metadata["ctx"])
+	}
+	if _, ok := event.Metadata["msg"]; ok {
+		t.Error("mapped fields should not be copied to metadata")
+	}
+}
+
+func TestDecode_JSONTimestampsAndLevels(t *testing.T) {
+	tests := []struct {
+		value    string
+		severity models.Severity
+		ts       time.Time
+	}{
+		{`{"message":"x","severity":"ERROR","timestamp":"2024-06-01T10:00:00Z"}`, models.SeverityError, time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{`{"log":"x","lvl":"fatal","time":1717236000000}`, models.SeverityCritical, time.UnixMilli(1717236000000).UTC()},
+		{`{"message":"x","level":"verbose","@timestamp":"not a time"}`, models.SeverityInfo, kafkaTime},
+	}
+
+	for _, tt := range tests {
+		event, err := decoder(t, upstream.FormatJSON).Decode(message(tt.value))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.value, err)
+		}
+		if event.Severity != tt.severity || !event.Timestamp.Equal(tt.ts) {
+			t.Errorf("%s: got %s at %s", tt.value, event.Severity, event.Timestamp)
+		}
+	}
+}
+
+func TestDecode_Formats(t *testing.T) {
+	// auto keeps JSON without a message field as a raw line
+	event, err := decoder(t, upstream.FormatAuto).Decode(message(`{"status":"ok"}`))
+	if err != nil || event.Message != `{"status":"ok"}` {
+		t.Errorf("expected raw fallback, got %+v, %v", event, err)
+	}
+
+	// json rejects it
+	if _, err := decoder(t, upstream.FormatJSON).Decode(message(`{"status":"ok"}`)); err != upstream.ErrNoMessage {
+		t.Errorf("expected ErrNoMessage, got %v", err)
+	}
+	if _, err := decoder(t, upstream.FormatJSON).Decode(message(`plain`)); err != upstream.ErrNotObject {
+		t.Errorf("expected ErrNotObject, got %v", err)
+	}
+
+	// raw never decodes
+	event, _ = decoder(t, upstream.FormatRaw).Decode(message(`{"message":"x"}`))
+	if event.Message != `{"message":"x"}` {
+		t.Errorf("raw format should keep the value, got %q", event.Message)
+	}
+
+	if _, err := decoder(t, upstream.FormatAuto).Decode(message("   ")); err != upstream.ErrEmptyMessage {
+		t.Errorf("expected ErrEmptyMessage, got %v", err)
+	}
+}
+
+func TestNew_RejectsOwnTopics(t *testing.T) {
+	kafkaCfg := config.Default().Kafka
+
+	cfg := config.Default().Upstream
+	cfg.Topics = []string{kafkaCfg.Topic}
+	if _, err := upstream.New(cfg, kafkaCfg, nil); err == nil {
+		t.Error("expected error consuming Parsec's own topic")
+	}
+
+	cfg.Topics = nil
+	if _, err := upstream.New(cfg, kafkaCfg, nil); err == nil {
+		t.Error("expected error without topics")
+	}
+
+	cfg.Topics = []string{"legacy"}
+	cfg.StartOffset = "middle"
+	if _, err := upstream.New(cfg, kafkaCfg, nil); err == nil {
+		t.Error("expected error for unknown start offset")
+	}
+}
@@ -0,0 +1,323 @@
+package usage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/jobs"
+	"parsec/internal/objstore"
+	"parsec/internal/state"
+	"parsec/internal/usage"
+	"parsec/pkg/models"
+)
+
+func memoryStore(t *testing.T) state.StateStore {
+	t.Helper()
+	store := state.NewMemoryStore(state.MemoryConfig{})
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newScheduler(t *testing.T, store state.StateStore) *jobs.Scheduler {
+	t.Helper()
+	s := jobs.NewScheduler(store, jobs.Config{
+		NodeID:           "node-1",
+		ProgressInterval: time.Millisecond,
+		CancelPoll:       5 * time.Millisecond,
+	})
+	t.Cleanup(s.Close)
+	return s
+}
+
+func envelope(tenantID, message string) *models.Envelope {
+	return &models.Envelope{Event: &models.LogEvent{TenantID: tenantID, Message: message}}
+}
+
+// waitReport polls a report until its job has ended
+func waitReport(t *testing.T, reports *usage.Reports, month string) *usage.Report {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		report, err := reports.Get(context.Background(), month)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		switch report.Status {
+		case usage.StatusSucceeded, usage.StatusFailed, usage.StatusCancelled:
+			return report
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("report did not finish")
+	return nil
+}
+
+// failingUploader rejects every upload
+type failingUploader struct{}
+
+func (failingUploader) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	return errors.New("bucket unavailable")
+}
+
+func (failingUploader) SignedURL(key string, ttl time.Duration) (string, error) {
+	return "", errors.New("bucket unavailable")
+}
+
+func TestMeter_FlushAddsToMonthlyTotals(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore(t)
+	meter := usage.NewMeter(store)
+
+	a := envelope("acme", "hello")
+	meter.Published([]*models.Envelope{a, envelope("acme", "world"), envelope("globex", "hi"), {}})
+	meter.Query("acme")
+	if err := meter.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// A second node's counts add to the same totals
+	other := usage.NewMeter(store)
+	other.Published([]*models.Envelope{envelope("acme", "again")})
+	if err := other.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	month := usage.Month(time.Now())
+	reports := usage.NewReports(store, newScheduler(t, store), usage.Config{})
+	if _, err := reports.Generate(ctx, month); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	report := waitReport(t, reports, month)
+	if report.Status != usage.StatusSucceeded {
+		t.Fatalf("status = %q (%s), want succeeded", report.Status, report.Error)
+	}
+	if len(report.Tenants) != 2 || report.Tenants[0].TenantID != "acme" || report.Tenants[1].TenantID != "globex" {
+		t.Fatalf("tenants = %+v, want acme and globex", report.Tenants)
+	}
+	acme := report.Tenants[0]
+	if acme.Events != 3 || acme.Queries != 1 {
+		t.Errorf("acme = %+v, want 3 events and 1 query", acme)
+	}
+	if acme.Bytes < int64(a.Event.Size()*3) {
+		t.Errorf("acme bytes = %d, want at least %d", acme.Bytes, a.Event.Size()*3)
+	}
+	if g := report.Tenants[1]; g.Events != 1 || g.Queries != 0 {
+		t.Errorf("globex = %+v, want 1 event and no queries", g)
+	}
+}
+
+func TestMeter_NilCountsNothing(t *testing.T) {
+	var meter *usage.Meter
+	meter.Published([]*models.Envelope{envelope("acme", "hello")})
+	meter.Query("acme")
+}
+
+func TestMeter_ConcurrentFlushesKeepEveryTenant(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore(t)
+
+	// Each meter stands for a node flushing its own tenants at once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		meter := usage.NewMeter(store)
+		meter.Published([]*models.Envelope{envelope(fmt.Sprintf("tenant-%d", i), "hello")})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := meter.Flush(ctx); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reports := usage.NewReports(store, newScheduler(t, store), usage.Config{})
+	month := usage.Month(time.Now())
+	if _, err := reports.Generate(ctx, month); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if report := waitReport(t, reports, month); len(report.Tenants) != 8 {
+		t.Errorf("report has %d tenants, want 8", len(report.Tenants))
+	}
+}
+
+func TestReport_WriteCSVEscapesFormulas(t *testing.T) {
+	report := &usage.Report{Month: "2024-06", Tenants: []usage.TenantUsage{
+		{TenantID: "=HYPERLINK(\"x\")"},
+		{TenantID: "+acme"},
+		{TenantID: "-acme"},
+		{TenantID: "@acme"},
+		{TenantID: "acme-1"},
+	}}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")[1:]
+	want := []string{`'=HYPERLINK(""x"")`, "'+acme", "'-acme", "'@acme", "acme-1"}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "2024-06,"+want[i]+",") && !strings.HasPrefix(line, `2024-06,"`+want[i]+`",`) {
+			t.Errorf("row %d = %q, want tenant %s", i, line, want[i])
+		}
+	}
+}
+
+func TestReports_ExportsCSVAndJSON(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore(t)
+	meter := usage.NewMeter(store)
+	meter.Published([]*models.Envelope{envelope("acme", "hello")})
+	if err := meter.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// acme has two archived objects, globex's are not counted against it
+	archive := t.TempDir()
+	for name, body := range map[string]string{
+		"exports/acme/a.ndjson.gz":   "12345",
+		"exports/acme/b.ndjson.gz":   "123",
+		"exports/globex/c.ndjson.gz": "1234567",
+	} {
+		path := filepath.Join(archive, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := t.TempDir()
+	reports := usage.NewReports(store, newScheduler(t, store), usage.Config{
+		Dest:     objstore.NewDir(dest),
+		Prefix:   "billing/",
+		Archives: []usage.Archive{{Store: objstore.NewDir(archive), Prefix: "exports/"}},
+	})
+	month := usage.Month(time.Now())
+	if _, err := reports.Generate(ctx, month); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	report := waitReport(t, reports, month)
+	if report.Status != usage.StatusSucceeded {
+		t.Fatalf("status = %q (%s), want succeeded", report.Status, report.Error)
+	}
+	if got := report.Tenants[0].StorageBytes; got != 8 {
+		t.Errorf("storage bytes = %d, want 8", got)
+	}
+
+	csvData, err := os.ReadFile(filepath.Join(dest, "billing", "usage", month+".csv"))
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(csvData)), "\n")
+	if len(lines) != 2 || lines[0] != "month,tenant_id,events,bytes,storage_bytes,queries" {
+		t.Fatalf("CSV = %q", csvData)
+	}
+	if !strings.HasPrefix(lines[1], month+",acme,1,") || !strings.HasSuffix(lines[1], ",8,0") {
+		t.Errorf("CSV row = %q", lines[1])
+	}
+
+	jsonData, err := os.ReadFile(filepath.Join(dest, "billing", "usage", month+".json"))
+	if err != nil {
+		t.Fatalf("read JSON: %v", err)
+	}
+	var exported struct {
+		Month   string              `json:"month"`
+		Tenants []usage.TenantUsage `json:"tenants"`
+	}
+	if err := json.Unmarshal(jsonData, &exported); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if exported.Month != month || len(exported.Tenants) != 1 || exported.Tenants[0].Events != 1 {
+		t.Errorf("JSON = %s", jsonData)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	if buf.String() != string(csvData) {
+		t.Errorf("WriteCSV = %q, want the exported CSV", buf.String())
+	}
+}
+
+func TestReports_FailedExportIsRecorded(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore(t)
+	reports := usage.NewReports(store, newScheduler(t, store), usage.Config{Dest: failingUploader{}})
+
+	if _, err := reports.Generate(ctx, "2024-05"); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	report := waitReport(t, reports, "2024-05")
+	if report.Status != usage.StatusFailed || !strings.Contains(report.Error, "bucket unavailable") {
+		t.Errorf("report = %+v, want failed with the upload error", report)
+	}
+
+	// A failed month can be generated again
+	if _, err := reports.Generate(ctx, "2024-05"); err != nil {
+		t.Errorf("Generate after failure: %v", err)
+	}
+	waitReport(t, reports, "2024-05")
+}
+
+func TestReports_GenerateRejectsInvalidMonths(t *testing.T) {
+	store := memoryStore(t)
+	reports := usage.NewReports(store, newScheduler(t, store), usage.Config{})
+
+	next := usage.Month(time.Now().AddDate(0, 1, 0))
+	for _, month := range []string{"", "2024-13", "June", "2024-06-01", next} {
+		if _, err := reports.Generate(context.Background(), month); !errors.Is(err, usage.ErrInvalidMonth) {
+			t.Errorf("Generate(%q) = %v, want ErrInvalidMonth", month, err)
+		}
+	}
+	if _, err := reports.Get(context.Background(), "2024-06"); !errors.Is(err, usage.ErrReportNotFound) {
+		t.Errorf("Get = %v, want ErrReportNotFound", err)
+	}
+}
+
+func TestReports_CheckGeneratesPreviousMonthAfterGrace(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore(t)
+	scheduler := newScheduler(t, store)
+	cfg := usage.Config{Grace: time.Hour}
+	reports := usage.NewReports(store, scheduler, cfg)
+
+	// Within the grace nothing is generated
+	if err := reports.Check(ctx, time.Date(2024, 7, 1, 0, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if _, err := reports.Get(ctx, "2024-06"); !errors.Is(err, usage.ErrReportNotFound) {
+		t.Fatalf("Get within grace = %v, want ErrReportNotFound", err)
+	}
+
+	// A second node checking at once doesn't generate it again
+	now := time.Date(2024, 7, 1, 2, 0, 0, 0, time.UTC)
+	if err := reports.Check(ctx, now); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if err := usage.NewReports(store, scheduler, cfg).Check(ctx, now); err != nil {
+		t.Fatalf("second Check: %v", err)
+	}
+	report := waitReport(t, reports, "2024-06")
+	if report.Status != usage.StatusSucceeded {
+		t.Errorf("status = %q (%s), want succeeded", report.Status, report.Error)
+	}
+
+	list, err := reports.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].Month != "2024-06" || list[0].JobID != report.JobID {
+		t.Errorf("List = %+v, want the one June report", list)
+	}
+}
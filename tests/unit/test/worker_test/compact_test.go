@@ -0,0 +1,119 @@
+package workertest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"parsec/internal/worker"
+	"parsec/pkg/models"
+)
+
+// batchRecorder records the size of each batch published
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecorder) Publish(ctx context.Context, envelope *models.Envelope) error {
+	return r.PublishBatch(ctx, []*models.Envelope{envelope})
+}
+
+func (r *batchRecorder) PublishBatch(ctx context.Context, envelopes []*models.Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, len(envelopes))
+	return nil
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+func testEnvelope() *models.Envelope {
+	return models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: "tenant-1", Timestamp: time.Now()}, "test-node")
+}
+
+func TestWorkerPool_CompactsTrickleIntoFullBatches(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	rec := &batchRecorder{}
+
+	pool := worker.NewPool(worker.Config{
+		Publisher:     rec,
+		EnvelopeChan:  ch,
+		Workers:       8,
+		BatchSize:     10,
+		BatchTimeout:  10 * time.Millisecond,
+		Compact:       true,
+		CompactLinger: time.Second,
+	})
+	pool.Start()
+	defer pool.Stop()
+
+	// A trickle: every worker times out holding one or two events
+	for i := 0; i < 20; i++ {
+		ch <- testEnvelope()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(rec.sizes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sizes := rec.sizes()
+	if len(sizes) != 2 || sizes[0] != 10 || sizes[1] != 10 {
+		t.Errorf("published batches %v, want [10 10]", sizes)
+	}
+	if got := pool.Stats().Processed; got != 20 {
+		t.Errorf("processed %d, want 20", got)
+	}
+}
+
+func TestWorkerPool_CompactionLingerAndStopFlush(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	rec := &batchRecorder{}
+
+	pool := worker.NewPool(worker.Config{
+		Publisher:     rec,
+		EnvelopeChan:  ch,
+		Workers:       4,
+		BatchSize:     100,
+		BatchTimeout:  10 * time.Millisecond,
+		Compact:       true,
+		CompactLinger: 50 * time.Millisecond,
+	})
+	pool.Start()
+
+	for i := 0; i < 3; i++ {
+		ch <- testEnvelope()
+	}
+	time.Sleep(300 * time.Millisecond)
+	if got := rec.sizes(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("after linger published %v, want [3]", got)
+	}
+
+	// Held by the aggregator when the pool stops
+	pool2 := worker.NewPool(worker.Config{
+		Publisher:     rec,
+		EnvelopeChan:  ch,
+		Workers:       4,
+		BatchSize:     100,
+		BatchTimeout:  10 * time.Millisecond,
+		Compact:       true,
+		CompactLinger: time.Hour,
+	})
+	pool.Stop()
+	pool2.Start()
+	for i := 0; i < 5; i++ {
+		ch <- testEnvelope()
+	}
+	time.Sleep(100 * time.Millisecond)
+	pool2.Stop()
+
+	if got := rec.sizes(); len(got) != 2 || got[1] != 5 {
+		t.Errorf("after stop published %v, want [3 5]", got)
+	}
+}
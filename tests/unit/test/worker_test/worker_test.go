@@ -2,12 +2,14 @@ package workertest
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
-	"parsec/internal/models"
+	"parsec/internal/queue"
 	"parsec/internal/worker"
+	"parsec/pkg/models"
 )
 
 // MockPublisher is a mock implementation of Publisher for testing
@@ -226,3 +228,222 @@ func TestWorkerPool_ErrorHandling(t *testing.T) {
 		t.Error("expected some failures")
 	}
 }
+
+func TestWorkerPool_Flush(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		ch := make(chan *models.Envelope, 100)
+		mock := &MockPublisher{}
+
+		// Batches would otherwise wait an hour to fill or time out
+		pool := worker.NewPool(worker.Config{
+			Publisher:     mock,
+			EnvelopeChan:  ch,
+			Workers:       2,
+			BatchSize:     1000,
+			BatchTimeout:  time.Hour,
+			Compact:       compact,
+			CompactLinger: time.Hour,
+		})
+		pool.Start()
+
+		for i := 0; i < 5; i++ {
+			ch <- models.NewEnvelope(&models.LogEvent{
+				ID:        "evt",
+				TenantID:  "tenant-1",
+				Timestamp: time.Now(),
+				Severity:  models.SeverityInfo,
+				Source:    "test",
+				Message:   "test message",
+			}, "test-node")
+		}
+		// Let the workers take the envelopes
+		for len(ch) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if got := mock.published.Load(); got != 0 {
+			t.Fatalf("compact=%v: expected nothing published before the flush, got %d", compact, got)
+		}
+
+		pool.Flush()
+		deadline := time.Now().Add(2 * time.Second)
+		for mock.published.Load() < 5 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := mock.published.Load(); got != 5 {
+			t.Errorf("compact=%v: expected 5 published after the flush, got %d", compact, got)
+		}
+		pool.Stop()
+	}
+}
+
+func TestWorkerPool_ReleasesBudget(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	budget := queue.NewBudget(1 << 20)
+	pool := worker.NewPool(worker.Config{
+		Publisher:    &MockPublisher{},
+		EnvelopeChan: ch,
+		Workers:      2,
+		BatchSize:    10,
+		BatchTimeout: 20 * time.Millisecond,
+		Budget:       budget,
+	})
+	pool.Start()
+	defer pool.Stop()
+
+	for i := 0; i < 15; i++ {
+		envelope := models.NewEnvelope(&models.LogEvent{
+			ID:        "evt",
+			TenantID:  "tenant-1",
+			Timestamp: time.Now(),
+			Severity:  models.SeverityInfo,
+			Source:    "test",
+			Message:   "test message",
+		}, "test-node")
+		if !budget.Acquire(envelope) {
+			t.Fatal("expected the envelope to fit")
+		}
+		ch <- envelope
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for budget.Used() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if used := budget.Used(); used != 0 {
+		t.Errorf("expected published envelopes to be released, %d bytes still charged", used)
+	}
+}
+
+func TestWorkerPool_TopTenants(t *testing.T) {
+	ch := make(chan *models.Envelope, 100)
+	pool := worker.NewPool(worker.Config{
+		Publisher:    &MockPublisher{},
+		EnvelopeChan: ch,
+		Workers:      2,
+		BatchSize:    10,
+		BatchTimeout: 10 * time.Millisecond,
+	})
+	pool.Start()
+
+	for tenant, n := range map[string]int{"acme": 5, "globex": 3, "initech": 1} {
+		for i := 0; i < n; i++ {
+			ch <- models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: tenant, Timestamp: time.Now()}, "test-node")
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Stats().Processed < 9 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	pool.Stop()
+
+	top := pool.TopTenants(2)
+	if len(top) != 2 || top[0].TenantID != "acme" || top[0].Processed != 5 || top[1].TenantID != "globex" {
+		t.Errorf("unexpected top tenants %+v", top)
+	}
+	if all := pool.TopTenants(10); len(all) != 3 {
+		t.Errorf("expected 3 tenants, got %+v", all)
+	}
+
+	stats := pool.Stats()
+	var items uint64
+	for _, ws := range stats.Workers {
+		items += ws.Items
+	}
+	if len(stats.Workers) != 2 || items != 9 {
+		t.Errorf("expected 9 events across 2 workers, got %+v", stats.Workers)
+	}
+}
+
+func TestWorkerPool_OnPublish(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		var mu sync.Mutex
+		var published, failed int
+		ch := make(chan *models.Envelope, 10)
+		pool := worker.NewPool(worker.Config{
+			Publisher:    &MockPublisher{shouldFail: fail},
+			EnvelopeChan: ch,
+			Workers:      1,
+			BatchSize:    3,
+			BatchTimeout: 10 * time.Millisecond,
+			OnPublish: func(p, f []*models.Envelope) {
+				mu.Lock()
+				published += len(p)
+				failed += len(f)
+				mu.Unlock()
+			},
+		})
+		pool.Start()
+		for i := 0; i < 3; i++ {
+			ch <- models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: "acme", Timestamp: time.Now()}, "test-node")
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for stats := pool.Stats(); stats.Processed+stats.Failed < 3 && time.Now().Before(deadline); stats = pool.Stats() {
+			time.Sleep(5 * time.Millisecond)
+		}
+		pool.Stop()
+
+		mu.Lock()
+		if fail && (published != 0 || failed != 3) || !fail && (published != 3 || failed != 0) {
+			t.Errorf("fail=%v: expected every envelope reported once, got %d published and %d failed", fail, published, failed)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestWorkerPool_RecordsQueueWait(t *testing.T) {
+	ch := make(chan *models.Envelope, 10)
+	var (
+		mu    sync.Mutex
+		waits []time.Duration
+	)
+	pool := worker.NewPool(worker.Config{
+		Publisher:    &MockPublisher{},
+		EnvelopeChan: ch,
+		Workers:      1,
+		BatchSize:    2,
+		BatchTimeout: time.Hour,
+		OnPublish: func(published, failed []*models.Envelope) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, e := range published {
+				if e.Timings.Published.Before(e.Timings.Dequeued) {
+					t.Errorf("published at %s before being dequeued at %s", e.Timings.Published, e.Timings.Dequeued)
+				}
+				waits = append(waits, e.Timings.QueueWait())
+			}
+		},
+	})
+
+	// Envelopes received a while ago have waited at least that long
+	for i := 0; i < 2; i++ {
+		envelope := models.NewEnvelope(&models.LogEvent{ID: "evt", TenantID: "acme", Timestamp: time.Now()}, "test-node")
+		envelope.ReceivedAt = time.Now().Add(-50 * time.Millisecond)
+		envelope.Timings.Received = envelope.ReceivedAt
+		ch <- envelope
+	}
+	pool.Start()
+	defer pool.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(waits)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(waits) != 2 {
+		t.Fatalf("expected 2 published envelopes, got %d", len(waits))
+	}
+	for _, wait := range waits {
+		if wait < 50*time.Millisecond || wait > time.Second {
+			t.Errorf("unexpected queue wait %s", wait)
+		}
+	}
+}